@@ -0,0 +1,543 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/elpic/blueprint/internal/handlers"
+)
+
+// Every command is described once in the commands table: the flags it
+// accepts, its subcommands, its help and the function running it. main
+// parses a command line with a flag.FlagSet built from the command's flags,
+// so a typo such as --skip-grp fails with a suggestion instead of being
+// ignored, and the shell completions are generated from the same table.
+
+// flagSpec is a flag a command accepts. value names the value the flag
+// takes, as its help shows it; it is "" for a switch.
+type flagSpec struct {
+	name  string
+	value string
+}
+
+// command is a blueprint command.
+type command struct {
+	name        string
+	summary     string                   // one line, for completions
+	help        func()                   // prints `blueprint <name> --help`
+	subcommands []string                 // words accepted as the first argument
+	flags       []flagSpec               // besides --help and -h
+	run         func(in *invocation) int // runs the parsed command line, returning the exit code
+}
+
+// shortFlags maps the one-letter aliases of flags to their long name. A
+// command accepting the long flag accepts its alias too.
+var shortFlags = map[string]string{"-h": "--help", "-y": "--yes", "-v": "--verbose"}
+
+// engineFlags are the engine switches applyEngineFlags sets, accepted by the
+// commands reading a blueprint.
+var engineFlags = []flagSpec{
+	{name: "--yes"}, {name: "--show-sensitive"}, {name: "--strict"},
+	{name: "--detect-flapping"}, {name: "--interactive"}, {name: "--no-sudo"}, {name: "--debug"},
+}
+
+// selectFlags choose the blueprints of plan and apply and the rules they run.
+var selectFlags = []flagSpec{
+	{"--shared", "<name>"}, {"--manifest", "<file>"},
+	{"--skip-group", "<name>"}, {"--skip-id", "<name>"}, {"--only", "<id>"}, {"--only-id", "<id>"},
+	{"--only-group", "<name>"}, {name: "--skip-decrypt"}, {name: "--prefer-ssh"},
+	{"--var", "KEY=VALUE"}, {"--cleanup-grace", "<applies|age>"}, {"--output", outputFormats},
+}
+
+// kdfFlags are the key derivation costs of encrypt and rekey.
+var kdfFlags = []flagSpec{{"--kdf-time", "<passes>"}, {"--kdf-memory", "<MiB>"}, {"--kdf-threads", "<n>"}}
+
+// templateFlags are the flags of the commands reading a blueprint for its data.
+var templateFlags = []flagSpec{{name: "--prefer-ssh"}, {"--var", "KEY=VALUE"}}
+
+// outputFormats is the value of --output for the commands where it selects
+// the output format rather than a path.
+const outputFormats = "json|text"
+
+// commands are the blueprint commands, in the order of the global help.
+// The table is filled in by init, as the run functions refer back to it.
+var commands []command
+
+// knownCommands maps the name of every command to its description.
+var knownCommands map[string]*command
+
+func init() {
+	commands = []command{
+		{name: "plan", summary: "Dry-run: show what would be applied", help: printPlanHelp, run: runPlan,
+			flags: slices.Concat(selectFlags, engineFlags)},
+		{name: "apply", summary: "Apply a blueprint (with automatic cleanup)", help: printApplyHelp, run: runApply,
+			flags: slices.Concat(selectFlags, engineFlags, []flagSpec{
+				{name: "--no-status"}, {"--deadline", "<duration>"}, {"--report", "<file>"},
+				{"--target", "<user@host>"}, {name: "--refresh-only"},
+			})},
+		{name: "validate", summary: "Parse and semantically check a blueprint", help: printValidateHelp, run: runValidate,
+			flags: slices.Concat([]flagSpec{{name: "--prefer-ssh"}}, engineFlags)},
+		{name: "impact", summary: "Show the rules that depend on a rule", help: printImpactHelp, run: runImpact,
+			flags: slices.Concat([]flagSpec{{name: "--prefer-ssh"}, {"--rule", "<id>"}}, engineFlags)},
+		{name: "diff", summary: "Show rules that differ from current status", help: printDiffHelp, run: runDiff,
+			flags: slices.Concat([]flagSpec{{name: "--prefer-ssh"}}, engineFlags)},
+		{name: "export", summary: "Generate a shell script from a blueprint", help: printExportHelp, run: runExport,
+			flags: slices.Concat([]flagSpec{{name: "--prefer-ssh"}, {"--format", "bash|sh"}, {"--output", "<file>"}}, engineFlags)},
+		{name: "export-script", summary: "Print a blueprint's commands as a plain shell script", help: printExportScriptHelp, run: runExportScript,
+			flags: slices.Concat(templateFlags, []flagSpec{
+				{"--format", "bash|sh"}, {"--os", "<os>"}, {"--arch", "<arch>"}, {"--output", "<file>"},
+			}, engineFlags)},
+		{name: "record", summary: "Record the commands a blueprint would run into a golden file", help: printRecordHelp, run: runRecord,
+			flags: slices.Concat(templateFlags, []flagSpec{{"--os", "<os,...>"}, {"--output", "<file>"}, {"--check", "<file>"}}, engineFlags)},
+		{name: "render", summary: "Render Go templates using blueprint data", help: printRenderHelp, run: runRender,
+			flags: slices.Concat(templateFlags, []flagSpec{{"--template", "<file.tmpl|dir>"}, {"--output", "<file|dir>"}}, engineFlags)},
+		{name: "check", summary: "Compare rendered output against existing files", help: printCheckHelp, run: runCheck,
+			flags: slices.Concat(templateFlags, []flagSpec{{"--template", "<file.tmpl|dir>"}, {"--against", "<file|dir>"}}, engineFlags)},
+		{name: "get", summary: "Extract a value from a blueprint", help: printGetHelp, run: runGet,
+			flags: slices.Concat(templateFlags, engineFlags)},
+		{name: "template", summary: "Scaffold a project from a template directory", help: printTemplateHelp, run: runTemplate,
+			flags: slices.Concat(templateFlags, []flagSpec{{"--output", "<dir>"}}, engineFlags)},
+		{name: "encrypt", summary: "Encrypt a file with AES-256-GCM", help: printEncryptHelp, run: runEncrypt,
+			flags: slices.Concat([]flagSpec{{"--password-id", "<id>"}}, kdfFlags)},
+		{name: "rekey", summary: "Re-encrypt files with a new password or key derivation", help: printRekeyHelp, run: runRekey,
+			flags: slices.Concat([]flagSpec{{name: "--upgrade"}}, kdfFlags)},
+		{name: "status", summary: "Show installed resource state", help: printStatusHelp, run: runStatus,
+			subcommands: []string{"prune"},
+			flags: []flagSpec{
+				{name: "--check"}, {"--host", "<user@host>"}, {"--older-than", "<days>"}, {name: "--down"},
+				{name: "--yes"}, {name: "--relative"}, {"--output", outputFormats},
+			}},
+		{name: "state", summary: "Back up or restore the state in ~/.blueprint", help: printStateHelp, run: runState,
+			subcommands: []string{"backup", "restore"},
+			flags:       []flagSpec{{"--to", "<dir>"}, {name: "--yes"}}},
+		{name: "workspace", summary: "Keep separate status and history on one machine", help: printWorkspaceHelp, run: runWorkspace,
+			subcommands: []string{"new", "select", "list"}},
+		{name: "refresh-keys", summary: "Re-download GPG keys and replace rotated ones", help: printRefreshKeysHelp, run: runRefreshKeys,
+			flags: []flagSpec{{name: "--dry-run"}, {"--schedule", "daily|weekly|hourly"}, {name: "--unschedule"}}},
+		{name: "rollback", summary: "Undo a run, or restore shell rc files blueprint appended to", help: printRollbackHelp, run: runRollback,
+			flags: []flagSpec{{name: "--dry-run"}, {name: "--prefer-ssh"}, {name: "--rc-files"}}},
+		{name: "hook", summary: "Apply a repository's blueprint on every git pull", help: printHookHelp, run: runHook,
+			subcommands: []string{"install", "uninstall"},
+			flags:       []flagSpec{{"--repo", "<dir>"}, {"--blueprint", "<file>"}, {"--only-group", "<name>"}, {"--skip-group", "<name>"}}},
+		{name: "clean", summary: "Remove caches and leftovers of interrupted runs", help: printCleanHelp, run: runClean,
+			flags: []flagSpec{{name: "--dry-run"}}},
+		{name: "history", summary: "View execution history", help: printHistoryHelp, run: runHistory,
+			subcommands: []string{"list", "search", "prune"},
+			flags: []flagSpec{
+				{name: "--stats"}, {"--since", "<date>"}, {"--blueprint", "<file>"}, {"--group", "<name>"},
+				{"--keep", "<runs>"}, {"--older-than", "<age>"}, {name: "--dry-run"},
+				{name: "--relative"}, {"--output", outputFormats},
+			}},
+		{name: "explain", summary: "Show the command, exit code and environment of a step", help: printExplainHelp, run: runExplain,
+			flags: []flagSpec{{name: "--relative"}, {"--output", outputFormats}}},
+		{name: "ps", summary: "Show progress summary", help: printPSHelp, run: runPS},
+		{name: "slow", summary: "Show slowest rules from history", help: printSlowHelp, run: runSlow,
+			flags: []flagSpec{{"--top", "<n>"}}},
+		{name: "stats", summary: "Show local usage stats of rules", help: printStatsHelp, run: runStats,
+			flags: []flagSpec{{"--top", "<n>"}, {"--output", outputFormats}}},
+		{name: "doctor", summary: "Diagnose and optionally fix issues", help: printDoctorHelp, run: runDoctor,
+			flags: []flagSpec{{name: "--fix"}, {name: "--verbose"}}},
+		{name: "lsp", summary: "Run the language server for editors", help: printLSPHelp, run: runLSP,
+			flags: []flagSpec{{name: "--stdio"}}},
+		{name: "help-rules", summary: "Document rule actions, their attributes and examples", help: printHelpRulesHelp, run: runHelpRules},
+		{name: "completion", summary: "Print a shell completion script", help: printCompletionHelp, run: runCompletion,
+			subcommands: completionShells},
+		{name: "version", summary: "Show version information", help: printVersionHelp, run: runVersion,
+			flags: []flagSpec{{name: "--short"}, {name: "--commit"}, {name: "--json"}, {"--output", outputFormats}}},
+	}
+
+	knownCommands = make(map[string]*command, len(commands))
+	for i := range commands {
+		knownCommands[commands[i].name] = &commands[i]
+	}
+}
+
+// flag returns the spec of the flag called name, a long name or its
+// one-letter alias, and whether cmd accepts it.
+func (cmd *command) flag(name string) (flagSpec, bool) {
+	if long, ok := shortFlags[name]; ok {
+		name = long
+	}
+	if name == "--help" {
+		return flagSpec{name: name}, true
+	}
+	for _, f := range cmd.flags {
+		if f.name == name {
+			return f, true
+		}
+	}
+	return flagSpec{}, false
+}
+
+// flagNames returns the flags cmd accepts, with --help and the aliases of
+// the flags that have one.
+func (cmd *command) flagNames() []string {
+	var names []string
+	for _, f := range slices.Concat([]flagSpec{{name: "--help"}}, cmd.flags) {
+		if slices.Contains(names, f.name) {
+			continue
+		}
+		names = append(names, f.name)
+		if short := shortFlag(f.name); short != "" {
+			names = append(names, short)
+		}
+	}
+	return names
+}
+
+// shortFlag returns the one-letter alias of the flag called name, or "".
+func shortFlag(name string) string {
+	for short, long := range shortFlags {
+		if long == name {
+			return short
+		}
+	}
+	return ""
+}
+
+// flagArg is an argument of a parsed command line: a flag with its value,
+// "true" or "false" for a switch, or a positional argument, without a name.
+type flagArg struct {
+	name  string
+	value string
+}
+
+// invocation is a command line of a command, parsed against its flags.
+type invocation struct {
+	cmd  *command
+	argv []flagArg // in command line order
+	err  error     // set by flagValue for a value the flag package would misreport
+}
+
+// flagValue is the flag.Value of every flag of a command: it appends each
+// occurrence of the flag to the invocation, under the flag's long name.
+type flagValue struct {
+	in   *invocation
+	spec flagSpec
+}
+
+func (v *flagValue) String() string { return "" }
+
+func (v *flagValue) IsBoolFlag() bool { return v.spec.value == "" }
+
+func (v *flagValue) Set(s string) error {
+	if v.IsBoolFlag() {
+		if _, err := strconv.ParseBool(s); err != nil {
+			v.in.err = fmt.Errorf("%s does not take a value", v.spec.name)
+			return v.in.err
+		}
+	}
+	v.in.argv = append(v.in.argv, flagArg{name: v.spec.name, value: s})
+	return nil
+}
+
+// parse parses args, the arguments of cmd, against the flags cmd accepts.
+// Flags may come before, between or after the positional arguments, as
+// --flag value or --flag=value; the arguments after "--" are positional.
+func (cmd *command) parse(args []string) (*invocation, error) {
+	in := &invocation{cmd: cmd}
+	fs := flag.NewFlagSet("blueprint "+cmd.name, flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	for _, spec := range slices.Concat([]flagSpec{{name: "--help"}}, cmd.flags) {
+		v := &flagValue{in: in, spec: spec}
+		fs.Var(v, strings.TrimLeft(spec.name, "-"), spec.value)
+		if short := shortFlag(spec.name); short != "" {
+			fs.Var(v, strings.TrimLeft(short, "-"), spec.value)
+		}
+	}
+
+	// fs stops at the first positional argument: record it and go on with
+	// the arguments after it, until they are all parsed.
+	for {
+		if err := fs.Parse(args); err != nil {
+			if in.err != nil {
+				return nil, in.err
+			}
+			return nil, cmd.flagError(err)
+		}
+		rest := fs.Args()
+		if len(rest) == 0 {
+			return in, nil
+		}
+		if terminated := len(rest) < len(args) && args[len(args)-len(rest)-1] == "--"; terminated {
+			for _, arg := range rest {
+				in.argv = append(in.argv, flagArg{value: arg})
+			}
+			return in, nil
+		}
+		in.argv = append(in.argv, flagArg{value: rest[0]})
+		args = rest[1:]
+	}
+}
+
+// flagError rewrites an error of the flag package about a flag of cmd in
+// blueprint's words, suggesting the flag meant for an unknown one.
+func (cmd *command) flagError(err error) error {
+	if name, ok := strings.CutPrefix(err.Error(), "flag provided but not defined: -"); ok {
+		name = dashed(name)
+		msg := fmt.Sprintf("unknown flag %s for blueprint %s", name, cmd.name)
+		if suggestion := closest(name, cmd.flagNames()); suggestion != "" {
+			msg += fmt.Sprintf(" (did you mean %s?)", suggestion)
+		}
+		return fmt.Errorf("%s\nRun 'blueprint %s --help' for the flags it accepts", msg, cmd.name)
+	}
+	if name, ok := strings.CutPrefix(err.Error(), "flag needs an argument: -"); ok {
+		spec, _ := cmd.flag(dashed(name))
+		return fmt.Errorf("%s requires %s", spec.name, spec.value)
+	}
+	return err
+}
+
+// dashed returns name, as the flag package reports it, with the dashes
+// blueprint writes it with: one for a one-letter alias, two otherwise.
+func dashed(name string) string {
+	if len(name) == 1 {
+		return "-" + name
+	}
+	return "--" + name
+}
+
+// args returns the positional arguments, in order.
+func (in *invocation) args() []string {
+	var args []string
+	for _, arg := range in.argv {
+		if arg.name == "" {
+			args = append(args, arg.value)
+		}
+	}
+	return args
+}
+
+// values returns the values given to the flag called name, in order.
+func (in *invocation) values(name string) []string {
+	var values []string
+	for _, arg := range in.argv {
+		if arg.name == name {
+			values = append(values, arg.value)
+		}
+	}
+	return values
+}
+
+// lookup returns the last value given to the flag called name, and whether
+// it was given at all.
+func (in *invocation) lookup(name string) (string, bool) {
+	values := in.values(name)
+	if len(values) == 0 {
+		return "", false
+	}
+	return values[len(values)-1], true
+}
+
+// value returns the last value given to the flag called name, or fallback
+// when it is not given.
+func (in *invocation) value(name, fallback string) string {
+	if value, ok := in.lookup(name); ok {
+		return value
+	}
+	return fallback
+}
+
+// on reports whether the switch called name is set.
+func (in *invocation) on(name string) bool {
+	on, _ := strconv.ParseBool(in.value(name, "false"))
+	return on
+}
+
+// flagArgs returns the flags of the command line, but the ones in except, as
+// the arguments of a command line again: --flag value, or --flag for a set
+// switch.
+func (in *invocation) flagArgs(except ...string) []string {
+	var args []string
+	for _, arg := range in.argv {
+		if arg.name == "" || slices.Contains(except, arg.name) {
+			continue
+		}
+		spec, _ := in.cmd.flag(arg.name)
+		if spec.value != "" {
+			args = append(args, arg.name, arg.value)
+		} else if on, _ := strconv.ParseBool(arg.value); on {
+			args = append(args, arg.name)
+		}
+	}
+	return args
+}
+
+// closest returns the candidate nearest to word, for a "did you mean"
+// suggestion, or "" when none is near enough to be a typo of it.
+func closest(word string, candidates []string) string {
+	best, bestDistance := "", 0
+	for _, candidate := range candidates {
+		d := editDistance(word, candidate)
+		if strings.HasPrefix(candidate, word) && len(word) > 3 {
+			d = min(d, 1)
+		}
+		if d <= max(2, len(word)/4) && (best == "" || d < bestDistance) {
+			best, bestDistance = candidate, d
+		}
+	}
+	return best
+}
+
+// editDistance returns the Levenshtein distance between a and b.
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur := make([]int, len(b)+1)
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
+
+// commandNames returns the names of the commands, in table order.
+func commandNames() []string {
+	names := make([]string, len(commands))
+	for i, cmd := range commands {
+		names[i] = cmd.name
+	}
+	return names
+}
+
+// completionShells are the shells `blueprint completion` writes a script for.
+var completionShells = []string{"bash", "zsh", "fish"}
+
+func printCompletionHelp() {
+	fmt.Print(`blueprint completion - print a shell completion script
+
+Usage:
+  blueprint completion bash|zsh|fish
+
+Description:
+  Prints a script that completes blueprint's commands, subcommands and
+  flags, and file names for their arguments. Load it from your shell's
+  startup file:
+
+    bash  echo 'source <(blueprint completion bash)' >> ~/.bashrc
+    zsh   echo 'source <(blueprint completion zsh)' >> ~/.zshrc
+    fish  blueprint completion fish > ~/.config/fish/completions/blueprint.fish
+
+Flags:
+  --help, -h          Show this help message
+`)
+}
+
+// writeCompletion writes the completion script for shell to w.
+func writeCompletion(w io.Writer, shell string) error {
+	switch shell {
+	case "bash":
+		writeBashCompletion(w)
+	case "zsh":
+		writeZshCompletion(w)
+	case "fish":
+		writeFishCompletion(w)
+	default:
+		return fmt.Errorf("unsupported shell %q (want %s)", shell, strings.Join(completionShells, ", "))
+	}
+	return nil
+}
+
+func writeBashCompletion(w io.Writer) {
+	fmt.Fprintf(w, `# bash completion for blueprint                     -*- shell-script -*-
+
+_blueprint() {
+    local cur=${COMP_WORDS[COMP_CWORD]} flags="" subcommands=""
+    if [[ $COMP_CWORD -eq 1 ]]; then
+        COMPREPLY=($(compgen -W "%s --chdir --help" -- "$cur"))
+        return
+    fi
+    case ${COMP_WORDS[1]} in
+`, strings.Join(commandNames(), " "))
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "        %s) flags=%q; subcommands=%q ;;\n", cmd.name, strings.Join(cmd.flagNames(), " "), strings.Join(cmd.subcommands, " "))
+	}
+	fmt.Fprint(w, `    esac
+    if [[ $cur == -* ]]; then
+        COMPREPLY=($(compgen -W "$flags" -- "$cur"))
+    elif [[ $COMP_CWORD -eq 2 && -n $subcommands ]]; then
+        COMPREPLY=($(compgen -W "$subcommands" -- "$cur"))
+    else
+        COMPREPLY=() # fall back to file names
+    fi
+}
+
+complete -o default -F _blueprint blueprint
+`)
+}
+
+func writeZshCompletion(w io.Writer) {
+	fmt.Fprint(w, `#compdef blueprint
+
+_blueprint() {
+    local -a commands flags subcommands
+    commands=(
+`)
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "        %s\n", handlers.ShellQuote(cmd.name+":"+strings.ReplaceAll(cmd.summary, ":", `\:`)))
+	}
+	fmt.Fprint(w, `    )
+    if (( CURRENT == 2 )); then
+        _describe 'command' commands
+        return
+    fi
+    case $words[2] in
+`)
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "        %s) flags=(%s); subcommands=(%s) ;;\n", cmd.name, strings.Join(cmd.flagNames(), " "), strings.Join(cmd.subcommands, " "))
+	}
+	fmt.Fprint(w, `    esac
+    if [[ $PREFIX == -* ]]; then
+        compadd -a flags
+    elif (( CURRENT == 3 && $#subcommands )); then
+        compadd -a subcommands
+    else
+        _files
+    fi
+}
+
+if [[ $funcstack[1] == _blueprint ]]; then
+    _blueprint "$@"
+else
+    compdef _blueprint blueprint
+fi
+`)
+}
+
+func writeFishCompletion(w io.Writer) {
+	fmt.Fprint(w, "# fish completion for blueprint\n\n")
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "complete -c blueprint -n __fish_use_subcommand -f -a %s -d %s\n", cmd.name, handlers.ShellQuote(cmd.summary))
+	}
+	for _, cmd := range commands {
+		seen := "__fish_seen_subcommand_from " + cmd.name
+		if len(cmd.subcommands) > 0 {
+			words := strings.Join(cmd.subcommands, " ")
+			fmt.Fprintf(w, "complete -c blueprint -n %s -f -a %s\n", handlers.ShellQuote(seen+"; and not __fish_seen_subcommand_from "+words), handlers.ShellQuote(words))
+		}
+		for _, name := range cmd.flagNames() {
+			spec, _ := cmd.flag(name)
+			option := "-l " + strings.TrimPrefix(name, "--")
+			if !strings.HasPrefix(name, "--") {
+				option = "-s " + strings.TrimPrefix(name, "-")
+			}
+			if spec.value != "" {
+				option += " -r -d " + handlers.ShellQuote(spec.value)
+			}
+			fmt.Fprintf(w, "complete -c blueprint -n %s %s\n", handlers.ShellQuote(seen), option)
+		}
+	}
+}
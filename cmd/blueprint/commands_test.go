@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// captureStdout returns what fn prints on stdout.
+func captureStdout(t *testing.T, fn func()) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	orig := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = orig }()
+	fn()
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	out, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(out)
+}
+
+// documentedFlag matches the flags a help lists, one per line.
+var documentedFlag = regexp.MustCompile(`(?m)^\s+(--?[a-z][a-z-]*)(?:, (-[a-z]))?`)
+
+func TestEveryDocumentedFlagIsAccepted(t *testing.T) {
+	for _, cmd := range commands {
+		help := captureStdout(t, cmd.help)
+		if !strings.HasPrefix(help, "blueprint "+cmd.name+" ") {
+			t.Errorf("help of %s starts with %q", cmd.name, strings.SplitN(help, "\n", 2)[0])
+		}
+		for _, match := range documentedFlag.FindAllStringSubmatch(help, -1) {
+			for _, name := range match[1:] {
+				if name == "" {
+					continue
+				}
+				if _, ok := cmd.flag(name); !ok {
+					t.Errorf("blueprint %s --help documents %s, which it does not accept", cmd.name, name)
+				}
+			}
+		}
+	}
+}
+
+func TestGlobalHelpListsEveryCommand(t *testing.T) {
+	help := captureStdout(t, printGlobalHelp)
+	for _, cmd := range commands {
+		if !regexp.MustCompile(`(?m)^  ` + regexp.QuoteMeta(cmd.name) + ` `).MatchString(help) {
+			t.Errorf("global help does not list %s", cmd.name)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	apply := knownCommands["apply"]
+	in, err := apply.parse([]string{"setup.bp", "--skip-group=dev", "--var", "A=--b", "-y", "work.bp", "--", "--not-a-flag"})
+	if err != nil {
+		t.Fatalf("parse() error = %v", err)
+	}
+	if got, want := in.args(), []string{"setup.bp", "work.bp", "--not-a-flag"}; !slices.Equal(got, want) {
+		t.Errorf("args() = %v, want %v", got, want)
+	}
+	if got := in.value("--skip-group", ""); got != "dev" {
+		t.Errorf("--skip-group = %q, want dev", got)
+	}
+	if got := in.values("--var"); !slices.Equal(got, []string{"A=--b"}) {
+		t.Errorf("--var = %v, want [A=--b]", got)
+	}
+	if !in.on("--yes") {
+		t.Error("-y did not set --yes")
+	}
+
+	for _, tt := range []struct {
+		args []string
+		want string
+	}{
+		{[]string{"setup.bp", "--skip-grp", "dev"}, "unknown flag --skip-grp for blueprint apply (did you mean --skip-group?)"},
+		{[]string{"setup.bp", "--frobnicate"}, "unknown flag --frobnicate for blueprint apply\n"},
+		{[]string{"setup.bp", "--strict=yes"}, "--strict does not take a value"},
+		{[]string{"setup.bp", "--deadline"}, "--deadline requires <duration>"},
+	} {
+		_, err := apply.parse(tt.args)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("parse(%v) error = %v, want %q", tt.args, err, tt.want)
+		}
+	}
+
+	// Flags of other commands are not accepted
+	if _, err := knownCommands["validate"].parse([]string{"setup.bp", "--skip-group", "dev"}); err == nil {
+		t.Error("parse() accepted --skip-group for validate")
+	}
+}
+
+func TestUnknownCommandSuggestion(t *testing.T) {
+	if msg := unknownCommandMessage("aply"); !strings.Contains(msg, "did you mean apply?") {
+		t.Errorf("unknownCommandMessage(aply) = %q, want a suggestion of apply", msg)
+	}
+	if msg := unknownCommandMessage("setup.bp"); strings.Contains(msg, "did you mean") {
+		t.Errorf("unknownCommandMessage(setup.bp) = %q, want no suggestion", msg)
+	}
+}
+
+func TestWriteCompletion(t *testing.T) {
+	for _, shell := range completionShells {
+		var buf bytes.Buffer
+		if err := writeCompletion(&buf, shell); err != nil {
+			t.Fatalf("writeCompletion(%s) error = %v", shell, err)
+		}
+		for _, want := range []string{"export-script", "skip-group", "backup"} {
+			if !strings.Contains(buf.String(), want) {
+				t.Errorf("%s completion does not complete %s", shell, want)
+			}
+		}
+	}
+	if err := writeCompletion(io.Discard, "tcsh"); err == nil {
+		t.Error("writeCompletion(tcsh) succeeded, want an error")
+	}
+}
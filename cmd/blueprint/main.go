@@ -5,54 +5,111 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"time"
 
+	cryptopkg "github.com/elpic/blueprint/internal/crypto"
 	"github.com/elpic/blueprint/internal/engine"
 	"github.com/elpic/blueprint/internal/logging"
+	"github.com/elpic/blueprint/internal/lsp"
+	"github.com/elpic/blueprint/internal/prompt"
+	"github.com/elpic/blueprint/internal/ui/timeutil"
 )
 
-// version and commit are set at build time via -ldflags.
-// They default to "dev" / "none" for local development builds.
+// version, commit and buildDate are set at build time via -ldflags.
+// They default to "dev" / "none" / "unknown" for local development builds.
 var version = "dev"
 var commit = "none"
-
-// parseFlags extracts --skip-group, --skip-id, --skip-decrypt, --only, --prefer-ssh, --no-status, and --debug flags from arguments
-func parseFlags(args []string) (skipGroup, skipID, onlyID string, skipDecrypt, preferSSH, noStatus bool) {
-	for i := 0; i < len(args); i++ {
-		switch args[i] {
-		case "--skip-group":
-			if i+1 < len(args) {
-				skipGroup = args[i+1]
-				i++
+var buildDate = "unknown"
+
+// blueprintFiles returns the blueprints plan and apply run, in the order they
+// are given: each argument is a path or git URL, "--shared <name>" a
+// blueprint in /etc/blueprint and "--manifest <file>" the blueprints listed
+// in a file. ok is false (after printing an error) when one cannot be
+// resolved or none is given.
+func blueprintFiles(in *invocation) (files []string, ok bool) {
+	for _, arg := range in.argv {
+		switch arg.name {
+		case "":
+			files = append(files, arg.value)
+		case "--shared":
+			if arg.value == "" {
+				fmt.Fprintf(os.Stderr, "error: --shared requires a blueprint name\n")
+				if names := engine.SharedBlueprints(); len(names) > 0 {
+					fmt.Fprintf(os.Stderr, "Shared blueprints: %s\n", strings.Join(names, ", "))
+				}
+				return nil, false
 			}
-		case "--skip-id":
-			if i+1 < len(args) {
-				skipID = args[i+1]
-				i++
+			file, err := engine.ResolveSharedBlueprint(arg.value)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "error: %v\n", err)
+				return nil, false
 			}
-		case "--only":
-			if i+1 < len(args) {
-				onlyID = args[i+1]
-				i++
+			files = append(files, file)
+		case "--manifest":
+			listed, err := engine.ReadManifest(arg.value)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "error: %v\n", err)
+				return nil, false
 			}
-		case "--skip-decrypt":
-			skipDecrypt = true
-		case "--prefer-ssh":
-			preferSSH = true
-		case "--no-status":
-			noStatus = true
-		case "--debug":
-			logging.SetLogLevel(logging.DEBUG)
+			files = append(files, listed...)
 		}
 	}
-	return
+	if len(files) == 0 {
+		fmt.Fprintf(os.Stderr, "error: no blueprint given\n")
+		return nil, false
+	}
+	return files, true
 }
 
-var knownCommands = map[string]bool{
-	"plan": true, "apply": true, "encrypt": true, "export": true,
-	"status": true, "history": true, "ps": true, "slow": true, "diff": true,
-	"version": true, "doctor": true, "validate": true,
-	"render": true, "check": true, "get": true,
-	"template": true,
+// runOptions returns the blueprints plan and apply run and the options they
+// run them with, from the flags of in. The cleanup grace falls back to
+// $BLUEPRINT_CLEANUP_GRACE. ok is false (after printing an error) for an
+// invalid value.
+func runOptions(in *invocation) (files []string, opts engine.RunOptions, ok bool) {
+	if files, ok = blueprintFiles(in); !ok {
+		return nil, opts, false
+	}
+	if opts.Vars, ok = cliVars(in); !ok {
+		return nil, opts, false
+	}
+
+	grace, source := os.Getenv(engine.CleanupGraceEnv), engine.CleanupGraceEnv
+	if value, given := in.lookup("--cleanup-grace"); given {
+		grace, source = value, "--cleanup-grace"
+	}
+	var err error
+	if opts.CleanupGrace, err = engine.ParseCleanupGrace(grace); err != nil {
+		fmt.Fprintf(os.Stderr, "error: %s: %v\n", source, err)
+		return nil, opts, false
+	}
+
+	if value, given := in.lookup("--deadline"); given {
+		if opts.Deadline, err = time.ParseDuration(value); err != nil || opts.Deadline <= 0 {
+			fmt.Fprintf(os.Stderr, "error: --deadline must be a positive duration such as 30m or 1h, got %q\n", value)
+			return nil, opts, false
+		}
+	}
+	if value, given := in.lookup("--report"); given {
+		if _, err := engine.ReportFormat(value); err != nil {
+			fmt.Fprintf(os.Stderr, "error: --report: %v\n", err)
+			return nil, opts, false
+		}
+		opts.ReportPath = value
+	}
+
+	opts.SkipGroup = in.value("--skip-group", "")
+	opts.SkipID = in.value("--skip-id", "")
+	opts.OnlyID = in.value("--only-id", in.value("--only", ""))
+	opts.OnlyGroup = in.value("--only-group", "")
+	// --only-id and --only-group select the rules with their after:
+	// dependencies, --only without them
+	_, onlyByID := in.lookup("--only-id")
+	_, onlyByGroup := in.lookup("--only-group")
+	opts.OnlyDeps = onlyByID || onlyByGroup
+	opts.SkipDecrypt = in.on("--skip-decrypt")
+	opts.PreferSSH = in.on("--prefer-ssh")
+	opts.NoStatus = in.on("--no-status")
+	return files, opts, true
 }
 
 // isHelpFlag returns true if the argument is --help or -h.
@@ -74,45 +131,115 @@ func printGlobalHelp() {
 	fmt.Print(`blueprint - declarative machine setup tool
 
 Usage:
-  blueprint <command> [arguments]
+  blueprint [--chdir <dir>] <command> [arguments]
 
 Commands:
   plan      <file.bp>   Dry-run: show what would be applied
   apply     <file.bp>   Apply a blueprint (with automatic cleanup)
   validate  <file.bp>   Parse and semantically check a blueprint
+  impact    <file.bp>   Show the rules that depend on a rule
   diff      <file.bp>   Show rules that differ from current status
   export    <file.bp>   Generate a shell script or Dockerfile from a blueprint
+  export-script <file.bp>  Print a blueprint's commands as a plain, ordered shell script
+  record    <file.bp>   Record the commands a blueprint would run into a golden file
   render    <file.bp>       Render Go templates using blueprint data
   check     <file.bp>       Compare rendered output against existing files
   get       <file.bp>       Extract a value from a blueprint
   template  <template-path>  Scaffold a project from a template directory (interactive)
   encrypt   <file>      Encrypt a file with AES-256-GCM
+  rekey     <file.enc>  Re-encrypt files with a new password or key derivation
   status                Show installed resource state
+  state     backup|restore  Back up or restore the state in ~/.blueprint
+  workspace new|select|list  Keep separate status and history on one machine
+  refresh-keys          Re-download GPG keys and replace rotated ones
+  rollback              Undo a run, or restore shell rc files blueprint appended to
+  hook      install|uninstall  Apply a repository's blueprint on every git pull
+  clean                 Remove caches and leftovers of interrupted runs
   history               View execution history
+  explain <run> <step>  Show the command, exit code and environment of a step
   ps                    Show progress summary
   slow                  Show slowest rules from history
+  stats                 Show local usage stats of rules (opt-in)
   doctor                Diagnose and optionally fix issues
+  lsp                   Run the language server for editors (stdio)
+  help-rules [action]   Document rule actions, their attributes and examples
+  completion bash|zsh|fish  Print a shell completion script
   version               Show version information
 
+Global flags:
+  --output json|text    Print plan, apply, status, history, explain, stats and
+                        version as JSON on stdout instead of colored text
+                        (default text)
+  --chdir <dir>         Switch to dir before running, so blueprint paths,
+                        includes and relative sources resolve from there
+
+Environment:
+  BLUEPRINT_READONLY=1  Only report: apply, encrypt, rekey, rollback, clean,
+                        hook and state restore fail (also read-only = true in
+                        the [security] section of ~/.blueprint/config)
+  BLUEPRINT_WORKSPACE=<name>  Work in that workspace for this command
+
 Run 'blueprint <command> --help' for usage details on a specific command.
 `)
 }
 
+func printHelpRulesHelp() {
+	fmt.Print(`blueprint help-rules - document the rule actions
+
+Usage:
+  blueprint help-rules [action]
+
+Description:
+  Without an action, lists every action a blueprint can use and the
+  attributes all rules accept. With an action, shows its usage, attributes
+  (type, default, required), supported operating systems and examples.
+
+  The text comes from the handlers themselves, so it always matches the
+  installed version of blueprint.
+
+Examples:
+  blueprint help-rules
+  blueprint help-rules clone
+
+Flags:
+  --help, -h          Show this help message
+`)
+}
+
 func printPlanHelp() {
 	fmt.Print(`blueprint plan - dry-run preview of what would be applied
 
 Usage:
-  blueprint plan <file.bp> [flags]
+  blueprint plan <file.bp>... [flags]
+  blueprint plan --shared <name> [flags]
+  blueprint plan --manifest <file> [flags]
 
 Arguments:
-  <file.bp>           Path to the blueprint file
+  <file.bp>           Path to the blueprint file; several are planned as one run
+  --shared <name>     Use the blueprint an administrator installed as
+                      /etc/blueprint/<name>.bp or /etc/blueprint/<name>/setup.bp
+  --manifest <file>   Use the blueprints listed in <file>, one per line
 
 Flags:
   --skip-group <name> Skip all rules in the given group
-  --skip-id <name>    Skip the rule with the given id
-  --only <id>         Only run the rule with the given id
+  --skip-id <name>    Skip the rule with the given id or address
+  --only <id>         Only run the rule with the given id or address
+                      (rules without an id: are addressed as install.curl,
+                      clone.~/src/repo and so on; plan shows each address)
+  --only-id <id>      Like --only, but also run the rules it depends on
+                      through after:, transitively
+  --only-group <name> Only run the rules in the given group, with the rules
+                      they depend on through after:
   --skip-decrypt      Skip encrypted rules (useful when no password is available)
   --prefer-ssh        Prefer SSH over HTTPS for git operations
+  --strict            Stop at attributes a rule's action does not accept
+                      instead of warning about them
+  --cleanup-grace <n> Show removals as apply would with this grace period
+                      (see blueprint apply --help)
+  --output json       Print the plan as JSON (rules, commands, cleanup and
+                      skipped rules) instead of text
+  --interactive       Browse the plan as a tree of rules by group: arrow keys
+                      move, enter shows a rule's command, q quits
   --debug             Enable debug logging (printed to stderr)
   --help, -h          Show this help message
 
@@ -120,6 +247,11 @@ Examples:
   blueprint plan setup.bp
   blueprint plan setup.bp --skip-group expensive
   blueprint plan setup.bp --only my-rule
+  blueprint plan setup.bp --only-id my-rule
+  blueprint plan --shared workstation
+  blueprint plan work.bp personal.bp
+  blueprint plan setup.bp --output json
+  blueprint plan setup.bp --interactive
 `)
 }
 
@@ -127,28 +259,84 @@ func printApplyHelp() {
 	fmt.Print(`blueprint apply - apply a blueprint with automatic cleanup
 
 Usage:
-  blueprint apply <file.bp> [flags]
+  blueprint apply <file.bp>... [flags]
+  blueprint apply --shared <name> [flags]
+  blueprint apply --manifest <file> [flags]
 
 Arguments:
-  <file.bp>           Path to the blueprint file
+  <file.bp>           Path to the blueprint file; several are applied as one
+                      run, with one dependency graph and one set of prompts,
+                      while each keeps its own status and cleanup
+  --shared <name>     Apply the blueprint an administrator installed as
+                      /etc/blueprint/<name>.bp or /etc/blueprint/<name>/setup.bp;
+                      state is still recorded in your own ~/.blueprint
+  --manifest <file>   Apply the blueprints listed in <file>, one per line;
+                      relative paths are resolved against the manifest
 
 Flags:
   --skip-group <name> Skip all rules in the given group
-  --skip-id <name>    Skip the rule with the given id
-  --only <id>         Only run the rule with the given id
+  --skip-id <name>    Skip the rule with the given id or address
+  --only <id>         Only run the rule with the given id or address
+                      (rules without an id: are addressed as install.curl,
+                      clone.~/src/repo and so on; plan shows each address)
+  --only-id <id>      Like --only, but also run the rules it depends on
+                      through after:, transitively
+  --only-group <name> Only run the rules in the given group, with the rules
+                      they depend on through after:
   --skip-decrypt      Skip encrypted rules (useful when no password is available)
   --prefer-ssh        Prefer SSH over HTTPS for git operations
+  --strict            Stop at attributes a rule's action does not accept
+                      instead of warning about them
+  --detect-flapping   Fail when a rule changes something again although an
+                      earlier run with the same command already applied it
+                      (rules with expect-changed: false are always checked)
   --no-status         Do not write to ~/.blueprint/status.json
+  --target <targets>  Apply on other machines over SSH instead, one after
+                      another (user@host, comma-separated): the blueprint and
+                      the files it references are copied there and the other
+                      flags are passed on; see blueprint status --host
+  --no-sudo           Never ask for the sudo password: rules that need sudo
+                      for commands sudoers does not allow without a password
+                      (NOPASSWD) fail instead
+  --refresh-only      Change nothing: update status.json from this machine,
+                      dropping resources removed by hand and recording the
+                      installed versions and clone SHAs
   --var KEY=VALUE     Override or set a blueprint variable (can be repeated)
+  --deadline <dur>    Stop starting new rules once <dur> (e.g. 30m) has elapsed;
+                      remaining rules are recorded as not attempted and the
+                      command exits with status 2
+  --cleanup-grace <n> Only auto-uninstall resources missing from the blueprint
+                      for <n> consecutive applies (3) or for at least an age
+                      (7d, 36h); defaults to $BLUEPRINT_CLEANUP_GRACE
+  --report <file>     Write a report of the run (rules, results, durations,
+                      outputs and cleanup) to <file>; .md for Markdown,
+                      .html for a standalone page
+  --show-sensitive    Show the output of sensitive: true rules in the terminal;
+                      history and reports still only get a placeholder
+  --output json       Print the results as JSON (rules, commands, results,
+                      durations) on stdout; progress goes to stderr
+  --interactive       Show the run as a live tree of rules by group, with the
+                      running ones, durations, the output of failed rules and
+                      a summary panel, instead of printing rule after rule
   --debug             Enable debug logging (printed to stderr)
   --help, -h          Show this help message
 
 Examples:
   blueprint apply setup.bp
+  blueprint apply setup.bp --deadline 30m
+  blueprint apply setup.bp --only-group dotfiles
+  blueprint apply setup.bp --cleanup-grace 3
+  blueprint apply setup.bp --report setup-report.md
+  blueprint apply setup.bp --output json > run.json
+  blueprint apply setup.bp --interactive
+  blueprint apply setup.bp --refresh-only
+  blueprint apply work.bp personal.bp
+  blueprint apply --manifest machines/laptop.txt
   blueprint apply setup.bp --skip-group expensive --prefer-ssh
   blueprint apply setup.bp --only my-rule
   blueprint apply @github:elpic/blueprint --var WORKSPACE=~/other/path
   blueprint apply setup.bp --debug
+  blueprint apply --shared workstation
 `)
 }
 
@@ -161,13 +349,53 @@ Usage:
 Arguments:
   <file>              Path to the file to encrypt
 
+Description:
+  Writes <file>.enc. The key is derived from the password with Argon2id;
+  the cost flags below raise or lower how much work each decryption takes.
+
 Flags:
   --password-id <id>  Named password identifier (default: "default")
+  --kdf-time <n>      Argon2id passes over memory (default: 3)
+  --kdf-memory <MiB>  Argon2id memory in MiB (default: 64)
+  --kdf-threads <n>   Argon2id parallel lanes (default: 4)
   --help, -h          Show this help message
 
 Examples:
   blueprint encrypt secrets.yaml
   blueprint encrypt secrets.yaml --password-id mypassword
+  blueprint encrypt secrets.yaml --kdf-memory 256
+`)
+}
+
+func printRekeyHelp() {
+	fmt.Print(`blueprint rekey - re-encrypt encrypted files
+
+Usage:
+  blueprint rekey <file.enc>... [flags]
+
+Arguments:
+  <file.enc>          Files written by 'blueprint encrypt'
+
+Description:
+  Decrypts each file and encrypts it again in place, asking for its
+  current password and a new one.
+
+  With --upgrade the password is kept and only files that need it are
+  rewritten: files encrypted by older versions of blueprint (PBKDF2 key
+  derivation) and files whose Argon2id parameters are lower than the
+  ones requested. Other files are left untouched.
+
+Flags:
+  --upgrade           Keep the password; re-encrypt only legacy or weaker files
+  --kdf-time <n>      Argon2id passes over memory (default: 3)
+  --kdf-memory <MiB>  Argon2id memory in MiB (default: 64)
+  --kdf-threads <n>   Argon2id parallel lanes (default: 4)
+  --help, -h          Show this help message
+
+Examples:
+  blueprint rekey secrets.yaml.enc
+  blueprint rekey --upgrade secrets/*.enc
+  blueprint rekey --upgrade --kdf-memory 256 secrets.yaml.enc
 `)
 }
 
@@ -193,17 +421,190 @@ Examples:
 `)
 }
 
+func printExportScriptHelp() {
+	fmt.Print(`blueprint export-script - print a blueprint's commands as a plain shell script
+
+Usage:
+  blueprint export-script <file.bp> [flags]
+
+Description:
+  Writes the commands the blueprint runs as a plain shell script, for
+  machines where the blueprint binary cannot be installed. Variables are
+  resolved, rules for other systems are left out and the rest come in the
+  order apply runs them, each under a comment naming the rule, the file and
+  line it is written on, its id: and after:. Rules that need blueprint
+  itself, such as decrypt, are left as comments.
+
+  Unlike export, the script shows no progress and keeps no log: it is just
+  the commands, stopping at the first that fails.
+
+Arguments:
+  <file.bp>           Path to the blueprint file
+
+Flags:
+  --format <fmt>      Shell: sh (default) or bash
+  --os <os>           System the script is for: mac or linux (default: this one)
+  --arch <arch>       Architecture the script is for, e.g. arm64 (default: this one)
+  --output <path>     Write the script to a file instead of stdout
+  --var KEY=VALUE     Override or set a blueprint variable (can be repeated)
+  --prefer-ssh        Prefer SSH over HTTPS for git operations
+  --help, -h          Show this help message
+
+Examples:
+  blueprint export-script setup.bp > setup.sh
+  blueprint export-script setup.bp --os linux --arch amd64 --output server.sh
+`)
+}
+
+func printRecordHelp() {
+	fmt.Print(`blueprint record - record the commands a blueprint would run
+
+Usage:
+  blueprint record <file.bp> [flags]
+
+Description:
+  Writes every command the blueprint would run, per OS and in execution
+  order, with variables resolved, without running anything or reading the
+  status file. Keep the output as a golden file and check it in CI to catch
+  unintended changes to a blueprint. Paths in your home directory are
+  written with ~, and arch: filters are matched against amd64, so the file
+  is the same on every machine.
+
+Flags:
+  --os <list>         Comma-separated systems to record (default: linux,mac)
+  --output <path>     Write the recording to a file instead of stdout
+  --check <path>      Compare with a golden file; print a diff and exit 1 on mismatch
+  --var KEY=VALUE     Set a variable (repeatable)
+  --prefer-ssh        Prefer SSH over HTTPS for git operations
+  --help, -h          Show this help message
+
+Examples:
+  blueprint record setup.bp --output setup.golden
+  blueprint record setup.bp --check setup.golden
+  blueprint record setup.bp --os mac
+`)
+}
+
+func printWorkspaceHelp() {
+	fmt.Print(`blueprint workspace - keep separate state contexts on one machine
+
+Usage:
+  blueprint workspace new <name>
+  blueprint workspace select <name>
+  blueprint workspace list
+
+Description:
+  Each workspace has its own status, history and run numbers, so the same
+  blueprint can be applied as "work" and as "experimental" without one
+  cleaning up what the other installed. status, history, plan, apply and
+  their automatic cleanup all work in the current workspace; the config,
+  caches and cloned repos are shared.
+
+  The default workspace keeps its state in ~/.blueprint as before; the
+  others in ~/.blueprint/workspaces/<name>.
+
+  new creates a workspace and selects it. select switches to an existing
+  one for the commands that follow. list shows them all, the current one
+  marked with *. BLUEPRINT_WORKSPACE=<name> picks a workspace for a single
+  command instead.
+
+Flags:
+  --help, -h          Show this help message
+
+Examples:
+  blueprint workspace new experimental
+  blueprint apply setup.bp
+  blueprint workspace select default
+  BLUEPRINT_WORKSPACE=experimental blueprint status
+`)
+}
+
+func printStateHelp() {
+	fmt.Print(`blueprint state - back up or restore blueprint's own state
+
+Usage:
+  blueprint state backup [--to <dir>]
+  blueprint state restore <archive> [--yes]
+
+Description:
+  backup writes blueprint-state-<date>-<time>.tar.gz to <dir> (default:
+  the current directory). It holds status.json, the run history with its
+  outputs, state.db with the SQLite state backend, the cached plans and
+  the state of every workspace. Cloned repos, logs and temporary files
+  are left out, and no secrets are stored in ~/.blueprint to begin with.
+
+  restore replaces those files with the ones in <archive> after
+  confirmation. The current state is backed up next to the archive first,
+  so a restore can be undone by restoring that backup.
+
+  The state-backup rule runs 'blueprint state backup' from cron:
+    state-backup every: weekly to: ~/Backups
+
+Flags:
+  --to <dir>          backup: directory to write the archive to
+  --yes, -y           restore: restore without asking for confirmation
+  --help, -h          Show this help message
+
+Examples:
+  blueprint state backup --to ~/Backups
+  blueprint state restore ~/Backups/blueprint-state-20260101-090000.tar.gz
+`)
+}
+
 func printStatusHelp() {
 	fmt.Print(`blueprint status - show installed resource state
 
 Usage:
-  blueprint status
+  blueprint status [--check]
+  blueprint status --host <user@host>
+  blueprint status prune [--older-than <days>] [--down] [--yes]
 
 Description:
-  Reads ~/.blueprint/status.json and prints all tracked resources:
+  Reads the recorded status and prints all tracked resources:
   installed packages, cloned repos, symlinks, downloads, and commands.
+  Each entry shows how many days ago it was applied and, once checked,
+  when it was last verified present.
+
+  --check verifies that the resources recorded for this OS still exist
+  (directories, clones, downloads, dotfiles, known hosts, ...), records
+  the time for those found and lists the missing ones. It exits with 1
+  when any resource is missing.
+
+  prune lists entries whose blueprint file no longer exists (and, with
+  --older-than, entries not applied in that many days) and removes them
+  from the status after confirmation. Git blueprints are only pruned by age.
 
 Flags:
+  --check             verify recorded resources are still present
+  --host <user@host>  show the status of a machine applied with apply --target,
+                      as copied from it after its last run
+  --older-than <days> prune: also select entries last applied more than <days> ago
+  --down              prune: uninstall the resources (entries for this OS) before removing them
+  --yes, -y           prune: remove without asking for confirmation
+  --relative          Show times as how long ago they were ("3 days ago")
+  --output json       Print the status as JSON instead of text
+  --help, -h          Show this help message
+`)
+}
+
+func printLSPHelp() {
+	fmt.Print(`blueprint lsp - language server for editors
+
+Usage:
+  blueprint lsp
+
+Description:
+  Speaks the Language Server Protocol on stdin/stdout. Configure your editor
+  to start 'blueprint lsp' for *.bp files to get:
+
+    - diagnostics: unknown directives, parse errors, missing includes,
+      after: entries that match no rule, unknown on: values
+    - completion of directives, attribute keywords and after: ids
+    - go-to-definition for after: ids (across includes) and include paths
+    - hover documentation for directives and attributes
+
+Flags:
+  --stdio             Accepted for editors that pass it; stdio is the only transport
   --help, -h          Show this help message
 `)
 }
@@ -213,25 +614,84 @@ func printHistoryHelp() {
 
 Usage:
   blueprint history [run_number [step_number]] [flags]
+  blueprint history list [--since <prefix>] [--blueprint <name>]
+  blueprint history search <text>
+  blueprint history prune [--keep <runs>] [--older-than <age>] [--dry-run]
 
 Arguments:
   run_number          Show details for a specific run (0 = latest)
   step_number         Show details for a specific step within the run
 
 Flags:
-  --since <prefix>    Filter records by timestamp prefix (e.g. 2025, 2025-05, 2025-05-01)
+  --since <prefix>    Filter records by local timestamp prefix (e.g. 2025, 2025-05, 2025-05-01)
   --blueprint <name>  Filter records by blueprint name substring
+  --group <name>      Show only the rules of a group (latest run only)
   --stats             Show aggregate stats instead of run details
+  --relative          Show times as how long ago they were ("3 days ago")
+  --output json       Print the run or the stats as JSON instead of text
   --help, -h          Show this help message
 
+Listing and searching:
+  list prints a table of the runs, oldest first: number, date, blueprints,
+  rule counts and result. search prints every step of every run whose
+  command or stored output contains <text>, ignoring case, with the lines
+  that match, and exits with 1 when there are none.
+
+Pruning:
+  prune removes old runs, records and outputs, and reports the space
+  reclaimed. The latest run is always kept. Without --keep or --older-than
+  it applies the retention set in ~/.blueprint/config, which apply also
+  enforces after every run:
+
+    [history]
+    keep = 200         # the latest runs to keep
+    max-age = 90d      # remove runs older than this
+
+  --keep <runs>       prune: keep only the latest <runs> runs
+  --older-than <age>  prune: remove runs older than <age> (12h, 30d)
+  --dry-run           prune: report what would be removed without removing it
+
 Examples:
   blueprint history                          # show latest run
   blueprint history 0                        # show latest run explicitly
   blueprint history 0 3                      # show step 3 of the latest run
   blueprint history --since 2025-05          # runs from May 2025
   blueprint history --blueprint dotfiles     # runs for a specific blueprint
+  blueprint history --group vim              # vim group rules of the latest run
   blueprint history --stats                  # aggregate stats
   blueprint history --stats --since 2025     # stats for this year
+  blueprint history --output json            # latest run as JSON
+  blueprint history list --since 2025-05     # runs from May 2025
+  blueprint history search "permission denied"  # steps that hit it
+  blueprint history prune --keep 50          # keep the latest 50 runs
+  blueprint history prune --older-than 30d   # remove runs older than 30 days
+`)
+}
+
+func printExplainHelp() {
+	fmt.Print(`blueprint explain - show how a step of a run was executed
+
+Usage:
+  blueprint explain <run_number> <step_number> [flags]
+
+Arguments:
+  run_number          The run, as listed by history (0 = latest)
+  step_number         The step within the run, as numbered by history
+
+Description:
+  Prints what history kept about one step: the command, its status and exit
+  code, how long it took, the directory it ran in and the environment it saw
+  (USER, HOME, SHELL, PATH and LANG), followed by its output. Runs saved by
+  older versions of blueprint have no exit code, directory or environment.
+
+Flags:
+  --relative          Show when it ran as how long ago it was ("3 days ago")
+  --output json       Print the step as JSON instead of text
+  --help, -h          Show this help message
+
+Examples:
+  blueprint explain 0 3                      # step 3 of the latest run
+  blueprint explain 12 1 --output json       # step 1 of run 12 as JSON
 `)
 }
 
@@ -266,6 +726,29 @@ Examples:
 `)
 }
 
+func printStatsHelp() {
+	fmt.Print(`blueprint stats - show local usage stats of rules
+
+Usage:
+  blueprint stats [flags]
+
+Stats are opt-in: with this in ~/.blueprint/config, every apply adds its
+rules to ~/.blueprint/stats.json. Nothing is sent anywhere.
+
+  [stats]
+  enabled = true
+
+Flags:
+  --top <n>           Show the top N slowest and failing rules (default: 10)
+  --output json|text  Print the stats file as JSON (default text)
+  --help, -h          Show this help message
+
+Examples:
+  blueprint stats
+  blueprint stats --top 5
+`)
+}
+
 func printDiffHelp() {
 	fmt.Print(`blueprint diff - show rules that differ from current status
 
@@ -310,6 +793,11 @@ Examples:
 func printValidateHelp() {
 	fmt.Print(`blueprint validate - parse and semantically check a blueprint
 
+Reports unknown actions, duplicate ids, after: references that match no
+rule, circular dependencies and unknown os:/arch: values, each with the
+file and line of the rule. Exits 1 when any are found. Attributes a rule's
+action does not accept, such as a misspelled brnach:, are warned about.
+
 Usage:
   blueprint validate <file.bp> [flags]
 
@@ -318,10 +806,196 @@ Arguments:
 
 Flags:
   --prefer-ssh        Prefer SSH over HTTPS for git operations
+  --strict            Fail on unknown attributes instead of warning
   --help, -h          Show this help message
 
 Examples:
   blueprint validate setup.bp
+  blueprint validate setup.bp --strict
+`)
+}
+
+func printHookHelp() {
+	fmt.Print(`blueprint hook - apply a repository's blueprint on every git pull
+
+Usage:
+  blueprint hook install --repo <dir> [flags]
+  blueprint hook uninstall --repo <dir>
+
+Description:
+  install adds a post-merge hook to the git repository in <dir>, such as
+  your dotfiles, that runs 'blueprint apply' on its blueprint after every
+  git pull or merge, so each machine picks up upstream changes as soon as
+  it pulls them. The hook runs the blueprint binary that installed it.
+
+  Installing again replaces the hook. A post-merge hook blueprint did not
+  install is never overwritten or removed; add the apply line to it
+  yourself instead.
+
+Flags:
+  --repo <dir>        The git repository (default: the current directory)
+  --blueprint <file>  Blueprint to apply, relative to the repository
+                      (default: setup.bp)
+  --only-group <name> Only apply the rules in the given group
+  --skip-group <name> Skip the rules in the given group
+  --help, -h          Show this help message
+
+Examples:
+  blueprint hook install --repo ~/src/dotfiles
+  blueprint hook install --repo ~/src/dotfiles --only-group dotfiles
+  blueprint hook uninstall --repo ~/src/dotfiles
+`)
+}
+
+func printRefreshKeysHelp() {
+	fmt.Print(`blueprint refresh-keys - re-download GPG keys and replace rotated ones
+
+Usage:
+  blueprint refresh-keys [flags]
+
+Description:
+  Re-downloads the key of every gpg_key and repo rule applied on this
+  machine and compares it with the installed keyring. A key the vendor
+  re-published or rotated replaces the installed one, and the package
+  cache is refreshed so apt picks it up. Keys that are expired, or whose
+  new key no longer has the fingerprint: the rule pinned, are reported
+  and left alone. Exits 1 when any key needs attention.
+
+Flags:
+  --dry-run           Report what changed without replacing any key
+  --schedule <every>  Run refresh-keys from cron: daily, weekly or hourly
+                      (needs passwordless sudo to replace keys)
+  --unschedule        Remove the cron entry installed by --schedule
+  --help, -h          Show this help message
+
+Examples:
+  blueprint refresh-keys
+  blueprint refresh-keys --dry-run
+  blueprint refresh-keys --schedule weekly
+`)
+}
+
+func printRollbackHelp() {
+	fmt.Print(`blueprint rollback - undo a run, or restore shell rc files blueprint appended to
+
+Usage:
+  blueprint rollback [flags] [<run_number>]
+  blueprint rollback --rc-files [flags] [<rc-file>...]
+
+Description:
+  rollback undoes what a run changed, the latest one unless a run number
+  is given: every rule the run applied successfully is uninstalled, most
+  recent first, as its blueprint now declares it. Rules that cannot be
+  undone, such as a run without undo: or a render, and rules no longer in
+  their blueprint are skipped with a warning. The rules to undo are listed
+  and undone only after confirmation. Run 0 is also the latest run.
+
+  With --rc-files, rollback restores shell startup files instead. Before
+  blueprint first appends to a file such as ~/.bashrc or ~/.zshrc it keeps
+  a backup and a checksum in the status. rollback puts every such file, or
+  only the ones given, back as it was: a file unchanged since blueprint's
+  last append gets the backup byte for byte, a file created by blueprint is
+  removed, and a file edited since only loses the lines blueprint added.
+
+Flags:
+  --dry-run     Report what would be undone or restored without changing anything
+  --prefer-ssh  Clone git blueprints of the run over SSH
+  --rc-files    Restore shell rc files instead of undoing a run
+  --help, -h    Show this help message
+
+Examples:
+  blueprint rollback --dry-run
+  blueprint rollback
+  blueprint rollback 12
+  blueprint rollback --rc-files
+  blueprint rollback --rc-files ~/.zshrc
+`)
+}
+
+// rollbackRun and rollbackRCFiles undo a run and restore rc files. Defined
+// as vars to allow stubbing in tests.
+var (
+	rollbackRun     = engine.RollbackRun
+	rollbackRCFiles = engine.RollbackRCFiles
+)
+
+// runRollback runs `blueprint rollback`: it undoes the run given, the latest
+// without one, or with --rc-files restores the rc files given, every one
+// blueprint changed without any.
+func runRollback(in *invocation) int {
+	args, dryRun := in.args(), in.on("--dry-run")
+	if in.on("--rc-files") {
+		return rollbackRCFiles(args, dryRun)
+	}
+	if len(args) > 1 {
+		printRollbackHelp()
+		return 1
+	}
+	runNumber := 0
+	if len(args) == 1 {
+		n, ok := parseNonNegativeInt(args[0], "run_number")
+		if !ok {
+			fmt.Fprintln(os.Stderr, "Use --rc-files to restore shell rc files.")
+			return 1
+		}
+		runNumber = n
+	}
+	return rollbackRun(runNumber, dryRun, in.on("--prefer-ssh"))
+}
+
+func printCleanHelp() {
+	fmt.Print(`blueprint clean - remove caches and leftovers of interrupted runs
+
+Usage:
+  blueprint clean [flags]
+
+Description:
+  Clears ~/.blueprint/cache, removes temporary clones and staging
+  directories that interrupted runs left behind, removes old entries of
+  ~/.blueprint/trash and cuts history outputs down to their last lines,
+  then reports the space reclaimed.
+
+  How old leftovers must be and how large outputs may grow is set in the
+  [clean] section of ~/.blueprint/config:
+
+    [clean]
+    temp-age = 24h     # temporary clones and staging directories
+    trash-age = 30d    # trash entries
+    max-output = 1M    # history outputs; 0 keeps them whole
+
+Flags:
+  --dry-run    Report what would be removed without removing anything
+  --help, -h   Show this help message
+
+Examples:
+  blueprint clean
+  blueprint clean --dry-run
+`)
+}
+
+func printImpactHelp() {
+	fmt.Print(`blueprint impact - show the rules that depend on a rule
+
+Usage:
+  blueprint impact <file.bp> --rule <id> [flags]
+
+Arguments:
+  <file.bp>           Path to the blueprint file
+
+Description:
+  Lists every rule that runs after the given rule, directly or through
+  other rules. These are the rules apply skips when that rule fails.
+  Only rules for the current OS are considered.
+
+Flags:
+  --rule <id>         The rule: an id: or anything after: accepts, such as
+                      a package name or a path
+  --prefer-ssh        Prefer SSH over HTTPS for git operations
+  --help, -h          Show this help message
+
+Examples:
+  blueprint impact setup.bp --rule ssh-dir
+  blueprint impact setup.bp --rule git
 `)
 }
 
@@ -382,6 +1056,7 @@ Arguments:
 Flags:
   --output <dir>      Output directory where rendered files are written (required)
   --var KEY=VALUE     Pre-set a template variable (repeatable) — skips the prompt for that variable
+  --yes, -y           Accept every default without prompting
   --prefer-ssh        Prefer SSH over HTTPS for git operations
   --help, -h          Show this help message
 
@@ -395,7 +1070,9 @@ Description:
   are required.
 
   Use --var to skip prompting for known values. Useful for complex variables
-  like JSON arrays or when automating from scripts.
+  like JSON arrays or when automating from scripts. When stdin is not a
+  terminal, or with --yes, defaults are used without prompting and any
+  required variable not given with --var is an error.
 
 Examples:
   blueprint template ./my-template --output ./my-project
@@ -438,39 +1115,133 @@ Usage:
 Flags:
   --short             Print only the version number
   --commit            Print only the commit hash
+  --json              Print version, commit, build date, Go version and the
+                      actions compiled in as JSON
   --help, -h          Show this help message
 
 Examples:
   blueprint version
   blueprint version --short
   blueprint version --commit
+  blueprint version --json
 `)
 }
 
-// parseVarFlags extracts all --var KEY=VALUE pairs from args into a map.
-func parseVarFlags(args []string) map[string]string {
-	vars := map[string]string{}
-	for i := 0; i < len(args); i++ {
-		if args[i] == "--var" && i+1 < len(args) {
-			kv := args[i+1]
-			i++
-			idx := strings.Index(kv, "=")
-			if idx < 0 {
-				fmt.Fprintf(os.Stderr, "error: --var must be KEY=VALUE, got %q\n", kv)
-				os.Exit(1)
-			}
-			vars[kv[:idx]] = kv[idx+1:]
+// cliVars returns the --var KEY=VALUE pairs of in as a map. ok is false
+// (after printing an error) for a pair without "=".
+func cliVars(in *invocation) (vars map[string]string, ok bool) {
+	vars = map[string]string{}
+	for _, kv := range in.values("--var") {
+		key, value, found := strings.Cut(kv, "=")
+		if !found {
+			fmt.Fprintf(os.Stderr, "error: --var must be KEY=VALUE, got %q\n", kv)
+			return nil, false
 		}
+		vars[key] = value
+	}
+	return vars, true
+}
+
+// kdfParams returns the Argon2id costs of encrypt and rekey: --kdf-time
+// <passes>, --kdf-memory <MiB> and --kdf-threads <n>. Flags left out keep
+// their cryptopkg.DefaultKDFParams value. ok is false (after printing an
+// error) for invalid values.
+func kdfParams(in *invocation) (params cryptopkg.KDFParams, ok bool) {
+	params = cryptopkg.DefaultKDFParams
+	for _, name := range []string{"--kdf-time", "--kdf-memory", "--kdf-threads"} {
+		value, given := in.lookup(name)
+		if !given {
+			continue
+		}
+		n, valid := parsePositiveInt(value, name)
+		if !valid {
+			return params, false
+		}
+		switch name {
+		case "--kdf-time":
+			params.Time = uint32(n)
+		case "--kdf-memory":
+			params.MemoryKiB = uint32(n) * 1024
+		case "--kdf-threads":
+			params.Threads = uint8(min(n, 255))
+		}
+	}
+	if err := params.Validate(); err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return params, false
+	}
+	return params, true
+}
+
+// historyRetention returns the runs `history prune` keeps: --keep <runs> and
+// --older-than <age>. ok is false (after printing an error) for invalid
+// values.
+func historyRetention(in *invocation) (retention engine.HistoryRetention, ok bool) {
+	if value, given := in.lookup("--keep"); given {
+		n, valid := parsePositiveInt(value, "--keep")
+		if !valid {
+			return retention, false
+		}
+		retention.Keep = n
+	}
+	if value, given := in.lookup("--older-than"); given {
+		age, err := engine.ParseAge(value)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: --older-than: %v\n", err)
+			return retention, false
+		}
+		retention.MaxAge = age
+	}
+	return retention, true
+}
+
+// topCount returns the number of rules slow and stats show: --top <n>, 10
+// without it. ok is false (after printing an error) for an invalid value.
+func topCount(in *invocation) (int, bool) {
+	if value, given := in.lookup("--top"); given {
+		return parsePositiveInt(value, "--top")
+	}
+	return 10, true
+}
+
+// mutatesMachine reports whether a command line changes the machine or the
+// state in ~/.blueprint, which read-only machines refuse. Plan, status,
+// history, validate and the other reporting commands pass, as do dry runs;
+// pruning status or history and switching workspaces do not.
+func mutatesMachine(in *invocation) bool {
+	args := in.args()
+	switch in.cmd.name {
+	case "apply", "encrypt", "rekey", "hook":
+		return true
+	case "rollback", "clean", "refresh-keys":
+		return !in.on("--dry-run")
+	case "status", "history":
+		return len(args) > 0 && args[0] == "prune" && !in.on("--dry-run")
+	case "workspace":
+		return len(args) > 0 && (args[0] == "new" || args[0] == "select")
+	case "state":
+		return len(args) > 0 && args[0] == "restore"
+	case "doctor":
+		return in.on("--fix")
 	}
-	return vars
+	return false
 }
 
-func isKnownCommand(cmd string) bool {
-	return knownCommands[cmd]
+// exitIfReadOnly exits with an error when this machine is read-only, as
+// blueprint mode would change it.
+func exitIfReadOnly(mode string) {
+	if reason := engine.ReadOnlyReason(); reason != "" {
+		fmt.Fprintf(os.Stderr, "error: this machine is read-only (%s); blueprint %s would change it\n", reason, mode)
+		os.Exit(1)
+	}
 }
 
 func unknownCommandMessage(cmd string) string {
-	return fmt.Sprintf("unknown command: %q\nUsage: blueprint <plan|apply|encrypt|export|status|history|ps|slow|diff|doctor|validate|version|render|check|get|template> [<file>]", cmd)
+	msg := fmt.Sprintf("unknown command: %q", cmd)
+	if suggestion := closest(cmd, commandNames()); suggestion != "" {
+		msg += fmt.Sprintf(" (did you mean %s?)", suggestion)
+	}
+	return fmt.Sprintf("%s\nUsage: blueprint <%s> [<file>]", msg, strings.Join(commandNames(), "|"))
 }
 
 // parseNonNegativeInt parses s as a non-negative integer. On any error it
@@ -503,12 +1274,90 @@ func parsePositiveInt(s, flagName string) (int, bool) {
 	return n, true
 }
 
+// engineSwitches set the engine and prompt options of the switches of the
+// same name, whichever command they are given to.
+var engineSwitches = map[string]func(){
+	"--yes":             func() { prompt.SetAssumeYes(true) },
+	"--show-sensitive":  func() { engine.SetShowSensitive(true) },
+	"--strict":          func() { engine.SetStrict(true) },
+	"--detect-flapping": func() { engine.SetDetectFlapping(true) },
+	"--interactive":     func() { engine.SetInteractive(true) },
+	"--no-sudo":         func() { engine.SetNoSudo(true) },
+	"--debug":           func() { logging.SetLogLevel(logging.DEBUG) },
+}
+
+// applyEngineFlags applies the flags of in that configure the engine rather
+// than the command: the engine switches, --output json|text and --relative,
+// which makes timestamps show as how long ago they were.
+func applyEngineFlags(in *invocation) error {
+	for name, set := range engineSwitches {
+		if in.on(name) {
+			set()
+		}
+	}
+	if spec, _ := in.cmd.flag("--output"); spec.value == outputFormats {
+		if format, given := in.lookup("--output"); given {
+			if err := engine.SetOutputFormat(format); err != nil {
+				return err
+			}
+		}
+	}
+	if in.on("--relative") {
+		timeutil.SetRelative(true)
+	}
+	return nil
+}
+
+// parseChdirFlag extracts --chdir <dir> or --chdir=<dir> from args, given
+// before or after the command, and returns the remaining arguments with the
+// directory, "" when the flag is absent. It writes a message to stderr and
+// returns false when the value is missing.
+func parseChdirFlag(args []string) ([]string, string, bool) {
+	dir := ""
+	var rest []string
+	for i := 0; i < len(args); i++ {
+		switch {
+		case args[i] == "--chdir":
+			if i+1 >= len(args) || args[i+1] == "" {
+				fmt.Fprintln(os.Stderr, "error: --chdir requires a directory")
+				return nil, "", false
+			}
+			dir = args[i+1]
+			i++
+		case strings.HasPrefix(args[i], "--chdir="):
+			dir = strings.TrimPrefix(args[i], "--chdir=")
+			if dir == "" {
+				fmt.Fprintln(os.Stderr, "error: --chdir requires a directory")
+				return nil, "", false
+			}
+		default:
+			rest = append(rest, args[i])
+		}
+	}
+	return rest, dir, true
+}
+
 func main() {
 	// When invoked via `go run`, os.Args[0] is a temp binary like /tmp/go-build.../exe/blueprint.
 	// Detect this and set the hint name so "Run to fix" suggestions are copy-pasteable.
 	if strings.Contains(os.Args[0], "go-build") {
 		engine.ExecutableName = "go run ./cmd/blueprint"
 	}
+	engine.Version, engine.Commit, engine.BuildDate = version, commit, buildDate
+
+	// --chdir switches directory before anything else, so blueprint paths,
+	// includes and relative sources resolve as if run from there.
+	rest, dir, ok := parseChdirFlag(os.Args[1:])
+	if !ok {
+		os.Exit(1)
+	}
+	if dir != "" {
+		if err := os.Chdir(dir); err != nil {
+			fmt.Fprintf(os.Stderr, "error: --chdir: %v\n", err)
+			os.Exit(1)
+		}
+		os.Args = append(os.Args[:1], rest...)
+	}
 
 	if len(os.Args) < 2 || isHelpFlag(os.Args[1]) {
 		printGlobalHelp()
@@ -520,330 +1369,517 @@ func main() {
 	}
 
 	mode := os.Args[1]
-
-	switch mode {
-	case "version":
-		args := os.Args[2:]
-		if hasHelpFlag(args) {
-			printVersionHelp()
-			os.Exit(0)
-		}
-		if len(args) > 0 && args[0] == "--commit" {
-			fmt.Println(commit)
-		} else if len(args) > 0 && args[0] == "--short" {
-			fmt.Println(version)
-		} else {
-			fmt.Printf("Version: %s\nCommit:  %s\n", version, commit)
-		}
-	case "history":
-		if hasHelpFlag(os.Args[2:]) {
-			printHistoryHelp()
-			os.Exit(0)
-		}
-		var since, blueprintFilter string
-		var statsOnly bool
-		args := os.Args[2:]
-		var positional []string
-		for i := 0; i < len(args); i++ {
-			switch {
-			case args[i] == "--stats":
-				statsOnly = true
-			case args[i] == "--since" && i+1 < len(args):
-				i++
-				since = args[i]
-			case strings.HasPrefix(args[i], "--since="):
-				since = strings.TrimPrefix(args[i], "--since=")
-			case args[i] == "--blueprint" && i+1 < len(args):
-				i++
-				blueprintFilter = args[i]
-			case strings.HasPrefix(args[i], "--blueprint="):
-				blueprintFilter = strings.TrimPrefix(args[i], "--blueprint=")
-			default:
-				positional = append(positional, args[i])
-			}
+	cmd := knownCommands[mode]
+	if cmd == nil {
+		// Short mode: treat as file path only if it looks like a path (not a known command typo).
+		if _, err := os.Stat(mode); err == nil { // #nosec G703 -- user-supplied file path is intentional
+			exitIfReadOnly(mode)
+			os.Exit(engine.Run(mode, false))
 		}
-		runNumber := 0
-		stepNumber := -1
-		if len(positional) >= 1 {
-			n, ok := parseNonNegativeInt(positional[0], "run_number")
-			if !ok {
-				os.Exit(1)
+		fmt.Fprintln(os.Stderr, unknownCommandMessage(mode))
+		os.Exit(1)
+	}
+	if hasHelpFlag(os.Args[2:]) {
+		cmd.help()
+		os.Exit(0)
+	}
+
+	in, err := cmd.parse(os.Args[2:])
+	if err == nil {
+		err = applyEngineFlags(in)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+	if mutatesMachine(in) {
+		exitIfReadOnly(mode)
+	}
+	os.Exit(cmd.run(in))
+}
+
+func runVersion(in *invocation) int {
+	switch {
+	case in.on("--commit"):
+		fmt.Println(engine.CurrentBuildInfo().Commit)
+	case in.on("--short"):
+		fmt.Println(version)
+	default:
+		return engine.PrintVersion(engine.JSONOutput() || in.on("--json"))
+	}
+	return 0
+}
+
+func runHelpRules(in *invocation) int {
+	action := ""
+	if args := in.args(); len(args) > 0 {
+		action = args[0]
+	}
+	return engine.PrintRuleHelp(action)
+}
+
+func runCompletion(in *invocation) int {
+	args := in.args()
+	if len(args) != 1 {
+		printCompletionHelp()
+		return 1
+	}
+	if err := writeCompletion(os.Stdout, args[0]); err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+func runLSP(in *invocation) int {
+	if err := lsp.Serve(os.Stdin, os.Stdout, version); err != nil {
+		fmt.Fprintf(os.Stderr, "blueprint lsp: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+func runHistory(in *invocation) int {
+	args := in.args()
+	since, blueprintFilter, group := in.value("--since", ""), in.value("--blueprint", ""), in.value("--group", "")
+	if len(args) > 0 {
+		switch args[0] {
+		case "prune":
+			if len(args) > 1 {
+				fmt.Fprintf(os.Stderr, "error: unknown history prune argument %q\n", args[1])
+				return 1
 			}
-			runNumber = n
-		}
-		if len(positional) >= 2 {
-			n, ok := parseNonNegativeInt(positional[1], "step_number")
+			retention, ok := historyRetention(in)
 			if !ok {
-				os.Exit(1)
-			}
-			stepNumber = n
-		}
-		if statsOnly {
-			engine.PrintHistoryStats(since, blueprintFilter)
-		} else {
-			engine.PrintHistory(runNumber, stepNumber, since, blueprintFilter)
-		}
-	case "plan":
-		if hasHelpFlag(os.Args[2:]) {
-			printPlanHelp()
-			os.Exit(0)
-		}
-		if len(os.Args) < 3 {
-			printPlanHelp()
-			os.Exit(1)
-		}
-		file := os.Args[2]
-		skipGroup, skipID, onlyID, skipDecrypt, preferSSH, _ := parseFlags(os.Args[3:])
-		cliVars := parseVarFlags(os.Args[3:])
-		os.Exit(engine.RunWithSkip(file, true, skipGroup, skipID, onlyID, skipDecrypt, preferSSH, false, cliVars))
-	case "apply":
-		if hasHelpFlag(os.Args[2:]) {
-			printApplyHelp()
-			os.Exit(0)
-		}
-		if len(os.Args) < 3 {
-			printApplyHelp()
-			os.Exit(1)
-		}
-		file := os.Args[2]
-		skipGroup, skipID, onlyID, skipDecrypt, preferSSH, noStatus := parseFlags(os.Args[3:])
-		cliVars := parseVarFlags(os.Args[3:])
-		os.Exit(engine.RunWithSkip(file, false, skipGroup, skipID, onlyID, skipDecrypt, preferSSH, noStatus, cliVars))
-	case "encrypt":
-		if hasHelpFlag(os.Args[2:]) {
-			printEncryptHelp()
-			os.Exit(0)
-		}
-		if len(os.Args) < 3 {
-			printEncryptHelp()
-			os.Exit(1)
-		}
-		file := os.Args[2]
-		passwordID := "default"
-		// Check for --password-id flag
-		for i := 3; i < len(os.Args); i++ {
-			if os.Args[i] == "--password-id" && i+1 < len(os.Args) {
-				passwordID = os.Args[i+1]
-				break
-			}
-		}
-		engine.EncryptFile(file, passwordID)
-	case "export":
-		if hasHelpFlag(os.Args[2:]) {
-			printExportHelp()
-			os.Exit(0)
-		}
-		if len(os.Args) < 3 {
-			printExportHelp()
-			os.Exit(1)
-		}
-		file := os.Args[2]
-		format := "bash"
-		output := ""
-		_, _, _, _, preferSSH, _ := parseFlags(os.Args[3:])
-		for i := 3; i < len(os.Args); i++ {
-			switch os.Args[i] {
-			case "--format":
-				if i+1 < len(os.Args) {
-					format = os.Args[i+1]
-					i++
-				}
-			case "--output":
-				if i+1 < len(os.Args) {
-					output = os.Args[i+1]
-					i++
-				}
-			}
-		}
-		if format != "bash" && format != "sh" {
-			fmt.Fprintf(os.Stderr, "error: --format must be \"bash\" or \"sh\", got %q\n", format)
-			os.Exit(1)
-		}
-		engine.Export(file, format, output, preferSSH)
-	case "status":
-		if hasHelpFlag(os.Args[2:]) {
-			printStatusHelp()
-			os.Exit(0)
-		}
-		engine.PrintStatus()
-	case "ps":
-		if hasHelpFlag(os.Args[2:]) {
-			printPSHelp()
-			os.Exit(0)
-		}
-		engine.PrintPS()
-	case "diff":
-		if hasHelpFlag(os.Args[2:]) {
-			printDiffHelp()
-			os.Exit(0)
-		}
-		if len(os.Args) < 3 {
-			printDiffHelp()
-			os.Exit(1)
-		}
-		_, _, _, _, preferSSH, _ := parseFlags(os.Args[3:])
-		engine.PrintDiff(os.Args[2], preferSSH)
-	case "slow":
-		if hasHelpFlag(os.Args[2:]) {
-			printSlowHelp()
-			os.Exit(0)
-		}
-		topN := 10
-		for i := 2; i < len(os.Args); i++ {
-			if os.Args[i] == "--top" && i+1 < len(os.Args) {
-				n, ok := parsePositiveInt(os.Args[i+1], "--top")
-				if !ok {
-					os.Exit(1)
-				}
-				topN = n
-				i++
-			}
-		}
-		engine.PrintSlow(topN)
-	case "doctor":
-		if hasHelpFlag(os.Args[2:]) {
-			printDoctorHelp()
-			os.Exit(0)
-		}
-		fix := false
-		verbose := false
-		for _, arg := range os.Args[2:] {
-			if arg == "--fix" {
-				fix = true
+				return 1
 			}
-			if arg == "--verbose" || arg == "-v" {
-				verbose = true
+			return engine.PruneHistory(retention, in.on("--dry-run"))
+		case "list":
+			return engine.PrintHistoryList(since, blueprintFilter)
+		case "search":
+			if len(args) != 2 {
+				fmt.Fprintf(os.Stderr, "usage: blueprint history search <text>\n")
+				return 1
 			}
+			return engine.SearchHistory(args[1])
 		}
-		engine.DoctorCheck(fix, verbose)
-	case "validate":
-		if hasHelpFlag(os.Args[2:]) {
-			printValidateHelp()
-			os.Exit(0)
-		}
-		if len(os.Args) < 3 {
-			printValidateHelp()
-			os.Exit(1)
-		}
-		_, _, _, _, preferSSH, _ := parseFlags(os.Args[3:])
-		engine.Validate(os.Args[2], preferSSH)
-	case "render":
-		if hasHelpFlag(os.Args[2:]) {
-			printRenderHelp()
-			os.Exit(0)
-		}
-		if len(os.Args) < 3 {
-			printRenderHelp()
-			os.Exit(1)
-		}
-		file := os.Args[2]
-		tmplPath := ""
-		output := ""
-		_, _, _, _, preferSSH, _ := parseFlags(os.Args[3:])
-		for i := 3; i < len(os.Args); i++ {
-			switch os.Args[i] {
-			case "--template":
-				if i+1 < len(os.Args) {
-					tmplPath = os.Args[i+1]
-					i++
-				}
-			case "--output":
-				if i+1 < len(os.Args) {
-					output = os.Args[i+1]
-					i++
-				}
-			}
-		}
-		if tmplPath == "" {
-			fmt.Fprintln(os.Stderr, "error: --template <file.tmpl|dir> is required")
-			os.Exit(1)
-		}
-		cliVars := parseVarFlags(os.Args[3:])
-		engine.Render(file, tmplPath, output, preferSSH, cliVars)
-	case "check":
-		if hasHelpFlag(os.Args[2:]) {
-			printCheckHelp()
-			os.Exit(0)
+	}
+	runNumber := 0
+	stepNumber := -1
+	if len(args) >= 1 {
+		n, ok := parseNonNegativeInt(args[0], "run_number")
+		if !ok {
+			return 1
 		}
-		if len(os.Args) < 3 {
-			printCheckHelp()
-			os.Exit(1)
+		runNumber = n
+	}
+	if len(args) >= 2 {
+		n, ok := parseNonNegativeInt(args[1], "step_number")
+		if !ok {
+			return 1
 		}
-		file := os.Args[2]
-		tmplPath := ""
-		against := ""
-		_, _, _, _, preferSSH, _ := parseFlags(os.Args[3:])
-		for i := 3; i < len(os.Args); i++ {
-			switch os.Args[i] {
-			case "--template":
-				if i+1 < len(os.Args) {
-					tmplPath = os.Args[i+1]
-					i++
-				}
-			case "--against":
-				if i+1 < len(os.Args) {
-					against = os.Args[i+1]
-					i++
-				}
+		stepNumber = n
+	}
+	if in.on("--stats") {
+		engine.PrintHistoryStats(since, blueprintFilter, group)
+	} else {
+		engine.PrintHistory(runNumber, stepNumber, since, blueprintFilter, group)
+	}
+	return 0
+}
+
+func runExplain(in *invocation) int {
+	args := in.args()
+	if len(args) != 2 {
+		printExplainHelp()
+		return 1
+	}
+	runNumber, ok := parseNonNegativeInt(args[0], "run_number")
+	if !ok {
+		return 1
+	}
+	stepNumber, ok := parsePositiveInt(args[1], "step_number")
+	if !ok {
+		return 1
+	}
+	return engine.Explain(runNumber, stepNumber)
+}
+
+func runPlan(in *invocation) int {
+	if len(in.argv) == 0 {
+		printPlanHelp()
+		return 1
+	}
+	files, opts, ok := runOptions(in)
+	if !ok {
+		return 1
+	}
+	opts.Dry = true
+	return engine.RunWithSkip(files, opts)
+}
+
+func runApply(in *invocation) int {
+	if len(in.argv) == 0 {
+		printApplyHelp()
+		return 1
+	}
+	files, opts, ok := runOptions(in)
+	if !ok {
+		return 1
+	}
+	if values := in.values("--target"); len(values) > 0 {
+		var targets []string
+		for _, value := range values {
+			parsed, err := engine.ParseTargets(value)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "error: %v\n", err)
+				return 1
 			}
+			targets = append(targets, parsed...)
 		}
-		if tmplPath == "" {
-			fmt.Fprintln(os.Stderr, "error: --template <file.tmpl|dir> is required")
-			os.Exit(1)
-		}
-		cliVars := parseVarFlags(os.Args[3:])
-		engine.Check(file, tmplPath, against, preferSSH, cliVars)
-	case "template":
-		if hasHelpFlag(os.Args[2:]) {
-			printTemplateHelp()
-			os.Exit(0)
+		// The other flags are passed on to the apply on the targets
+		return engine.ApplyRemote(files, targets, in.flagArgs("--target", "--shared", "--manifest", "--output"), opts.Vars)
+	}
+	if in.on("--refresh-only") {
+		exit := 0
+		for _, file := range files {
+			exit = max(exit, engine.RefreshOnly(file, opts.PreferSSH))
 		}
-		if len(os.Args) < 3 {
-			printTemplateHelp()
-			os.Exit(1)
+		return exit
+	}
+	return engine.RunWithSkip(files, opts)
+}
+
+func runEncrypt(in *invocation) int {
+	args := in.args()
+	if len(args) == 0 {
+		printEncryptHelp()
+		return 1
+	}
+	params, ok := kdfParams(in)
+	if !ok {
+		return 1
+	}
+	engine.EncryptFile(args[0], in.value("--password-id", "default"), params)
+	return 0
+}
+
+func runRekey(in *invocation) int {
+	files := in.args()
+	if len(files) == 0 {
+		printRekeyHelp()
+		return 1
+	}
+	params, ok := kdfParams(in)
+	if !ok {
+		return 1
+	}
+	return engine.RekeyFiles(files, in.on("--upgrade"), params)
+}
+
+func runExport(in *invocation) int {
+	args := in.args()
+	if len(args) == 0 {
+		printExportHelp()
+		return 1
+	}
+	format := in.value("--format", "bash")
+	if format != "bash" && format != "sh" {
+		fmt.Fprintf(os.Stderr, "error: --format must be \"bash\" or \"sh\", got %q\n", format)
+		return 1
+	}
+	engine.Export(args[0], format, in.value("--output", ""), in.on("--prefer-ssh"))
+	return 0
+}
+
+func runExportScript(in *invocation) int {
+	args := in.args()
+	if len(args) == 0 {
+		printExportScriptHelp()
+		return 1
+	}
+	vars, ok := cliVars(in)
+	if !ok {
+		return 1
+	}
+	opts := engine.ScriptOptions{
+		Format:    in.value("--format", "sh"),
+		Vars:      vars,
+		PreferSSH: in.on("--prefer-ssh"),
+		OS:        in.value("--os", ""),
+		Arch:      in.value("--arch", ""),
+		Output:    in.value("--output", ""),
+	}
+	if opts.Format != "bash" && opts.Format != "sh" {
+		fmt.Fprintf(os.Stderr, "error: --format must be \"bash\" or \"sh\", got %q\n", opts.Format)
+		return 1
+	}
+	return engine.ExportScript(args[0], opts)
+}
+
+func runRecord(in *invocation) int {
+	args := in.args()
+	if len(args) == 0 {
+		printRecordHelp()
+		return 1
+	}
+	vars, ok := cliVars(in)
+	if !ok {
+		return 1
+	}
+	var osNames []string
+	if value, given := in.lookup("--os"); given {
+		osNames = strings.Split(value, ",")
+	}
+	return engine.Record(args[0], osNames, in.value("--output", ""), in.value("--check", ""), vars, in.on("--prefer-ssh"))
+}
+
+func runStatus(in *invocation) int {
+	args := in.args()
+	if len(args) > 0 {
+		if args[0] != "prune" {
+			fmt.Fprintf(os.Stderr, "unknown status command: %q (use prune)\n", args[0])
+			return 1
 		}
-		tmplPath := os.Args[2]
-		output := ""
-		_, _, _, _, preferSSH, _ := parseFlags(os.Args[3:])
-		for i := 3; i < len(os.Args); i++ {
-			switch os.Args[i] {
-			case "--output":
-				if i+1 < len(os.Args) {
-					output = os.Args[i+1]
-					i++
-				}
+		var olderThan time.Duration
+		if value, given := in.lookup("--older-than"); given {
+			days, ok := parsePositiveInt(value, "--older-than")
+			if !ok {
+				return 1
 			}
+			olderThan = time.Duration(days) * 24 * time.Hour
 		}
-		if output == "" {
-			fmt.Fprintln(os.Stderr, "error: --output <dir> is required")
-			os.Exit(1)
+		return engine.PruneStatus(olderThan, in.on("--down"))
+	}
+	if in.on("--check") {
+		return engine.CheckStatus()
+	}
+	if host := in.value("--host", ""); host != "" {
+		engine.PrintTargetStatus(host)
+		return 0
+	}
+	engine.PrintStatus()
+	return 0
+}
+
+func runState(in *invocation) int {
+	args := in.args()
+	if len(args) == 0 {
+		printStateHelp()
+		return 1
+	}
+	switch args[0] {
+	case "backup":
+		return engine.BackupState(in.value("--to", "."))
+	case "restore":
+		if len(args) != 2 {
+			printStateHelp()
+			return 1
 		}
-		cliVars := parseVarFlags(os.Args[3:])
-		engine.Template(tmplPath, output, preferSSH, cliVars)
-	case "get":
-		if hasHelpFlag(os.Args[2:]) {
-			printGetHelp()
-			os.Exit(0)
+		return engine.RestoreState(args[1])
+	default:
+		fmt.Fprintf(os.Stderr, "unknown state command: %q (use backup or restore)\n", args[0])
+		return 1
+	}
+}
+
+func runWorkspace(in *invocation) int {
+	args := in.args()
+	if len(args) == 0 {
+		printWorkspaceHelp()
+		return 1
+	}
+	switch args[0] {
+	case "new", "select":
+		if len(args) != 2 {
+			fmt.Fprintf(os.Stderr, "usage: blueprint workspace %s <name>\n", args[0])
+			return 1
 		}
-		if len(os.Args) < 5 {
-			printGetHelp()
-			os.Exit(1)
+		if args[0] == "new" {
+			return engine.WorkspaceNew(args[1])
 		}
-		file := os.Args[2]
-		action := os.Args[3]
-		key := os.Args[4]
-		_, _, _, _, preferSSH, _ := parseFlags(os.Args[5:])
-		cliVars := parseVarFlags(os.Args[5:])
-		engine.Get(file, action, key, preferSSH, cliVars)
+		return engine.WorkspaceSelect(args[1])
+	case "list":
+		return engine.WorkspaceList()
 	default:
-		// Short mode: treat as file path only if it looks like a path (not a known command typo).
-		if !isKnownCommand(mode) {
-			if _, err := os.Stat(mode); err == nil { // #nosec G703 -- user-supplied file path is intentional
-				os.Exit(engine.Run(mode, false))
-				return
-			}
-		}
-		fmt.Fprintln(os.Stderr, unknownCommandMessage(mode))
-		os.Exit(1)
+		fmt.Fprintf(os.Stderr, "unknown workspace command: %q (use new, select or list)\n", args[0])
+		return 1
+	}
+}
+
+func runHook(in *invocation) int {
+	args := in.args()
+	if len(args) == 0 {
+		printHookHelp()
+		return 1
+	}
+	repo := in.value("--repo", ".")
+	switch args[0] {
+	case "install":
+		return engine.InstallHook(repo, engine.HookOptions{
+			Blueprint: in.value("--blueprint", ""),
+			OnlyGroup: in.value("--only-group", ""),
+			SkipGroup: in.value("--skip-group", ""),
+		})
+	case "uninstall":
+		return engine.UninstallHook(repo)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown hook command: %q (use install or uninstall)\n", args[0])
+		return 1
+	}
+}
+
+func runRefreshKeys(in *invocation) int {
+	if args := in.args(); len(args) > 0 {
+		fmt.Fprintf(os.Stderr, "unknown refresh-keys argument: %q\n", args[0])
+		return 1
+	}
+	if every, given := in.lookup("--schedule"); given {
+		return engine.ScheduleRefreshKeys(every)
+	}
+	if in.on("--unschedule") {
+		return engine.ScheduleRefreshKeys("")
+	}
+	return engine.RefreshKeys(in.on("--dry-run"))
+}
+
+func runClean(in *invocation) int {
+	if args := in.args(); len(args) > 0 {
+		fmt.Fprintf(os.Stderr, "unknown clean argument: %q\n", args[0])
+		return 1
+	}
+	return engine.Clean(in.on("--dry-run"))
+}
+
+func runPS(in *invocation) int {
+	engine.PrintPS()
+	return 0
+}
+
+func runDiff(in *invocation) int {
+	args := in.args()
+	if len(args) == 0 {
+		printDiffHelp()
+		return 1
+	}
+	engine.PrintDiff(args[0], in.on("--prefer-ssh"))
+	return 0
+}
+
+func runSlow(in *invocation) int {
+	topN, ok := topCount(in)
+	if !ok {
+		return 1
+	}
+	engine.PrintSlow(topN)
+	return 0
+}
+
+func runStats(in *invocation) int {
+	topN, ok := topCount(in)
+	if !ok {
+		return 1
+	}
+	engine.PrintStats(topN)
+	return 0
+}
+
+func runDoctor(in *invocation) int {
+	engine.DoctorCheck(in.on("--fix"), in.on("--verbose"))
+	return 0
+}
+
+func runValidate(in *invocation) int {
+	args := in.args()
+	if len(args) == 0 {
+		printValidateHelp()
+		return 1
+	}
+	engine.Validate(args[0], in.on("--prefer-ssh"))
+	return 0
+}
+
+func runImpact(in *invocation) int {
+	args := in.args()
+	if len(args) == 0 {
+		printImpactHelp()
+		return 1
+	}
+	ruleRef := in.value("--rule", "")
+	if ruleRef == "" {
+		fmt.Fprintf(os.Stderr, "error: --rule <id> is required\n")
+		return 1
+	}
+	return engine.Impact(args[0], ruleRef, in.on("--prefer-ssh"))
+}
+
+func runRender(in *invocation) int {
+	args := in.args()
+	if len(args) == 0 {
+		printRenderHelp()
+		return 1
+	}
+	tmplPath := in.value("--template", "")
+	if tmplPath == "" {
+		fmt.Fprintln(os.Stderr, "error: --template <file.tmpl|dir> is required")
+		return 1
+	}
+	vars, ok := cliVars(in)
+	if !ok {
+		return 1
+	}
+	engine.Render(args[0], tmplPath, in.value("--output", ""), in.on("--prefer-ssh"), vars)
+	return 0
+}
+
+func runCheck(in *invocation) int {
+	args := in.args()
+	if len(args) == 0 {
+		printCheckHelp()
+		return 1
+	}
+	tmplPath := in.value("--template", "")
+	if tmplPath == "" {
+		fmt.Fprintln(os.Stderr, "error: --template <file.tmpl|dir> is required")
+		return 1
+	}
+	vars, ok := cliVars(in)
+	if !ok {
+		return 1
+	}
+	engine.Check(args[0], tmplPath, in.value("--against", ""), in.on("--prefer-ssh"), vars)
+	return 0
+}
+
+func runTemplate(in *invocation) int {
+	args := in.args()
+	if len(args) == 0 {
+		printTemplateHelp()
+		return 1
+	}
+	output := in.value("--output", "")
+	if output == "" {
+		fmt.Fprintln(os.Stderr, "error: --output <dir> is required")
+		return 1
+	}
+	vars, ok := cliVars(in)
+	if !ok {
+		return 1
+	}
+	engine.Template(args[0], output, in.on("--prefer-ssh"), vars)
+	return 0
+}
+
+func runGet(in *invocation) int {
+	args := in.args()
+	if len(args) < 3 {
+		printGetHelp()
+		return 1
+	}
+	vars, ok := cliVars(in)
+	if !ok {
+		return 1
 	}
+	engine.Get(args[0], args[1], args[2], in.on("--prefer-ssh"), vars)
+	return 0
 }
@@ -1,8 +1,16 @@
 package main
 
 import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
 	"strings"
 	"testing"
+	"time"
+
+	cryptopkg "github.com/elpic/blueprint/internal/crypto"
+	"github.com/elpic/blueprint/internal/engine"
 )
 
 // ---------------------------------------------------------------------------
@@ -121,110 +129,161 @@ func TestParsePositiveInt_EmptyRejected(t *testing.T) {
 }
 
 // ---------------------------------------------------------------------------
-// parseFlags
+// runOptions
 // ---------------------------------------------------------------------------
 
-func TestParseFlags_Empty(t *testing.T) {
-	skipGroup, skipID, onlyID, skipDecrypt, preferSSH, noStatus := parseFlags([]string{})
-	if skipGroup != "" || skipID != "" || onlyID != "" || skipDecrypt || preferSSH || noStatus {
-		t.Fatal("expected all zero values for empty args")
-	}
+// mustParse parses args as the arguments of the command called name.
+func mustParse(t *testing.T, name string, args ...string) *invocation {
+	t.Helper()
+	in, err := knownCommands[name].parse(args)
+	if err != nil {
+		t.Fatalf("parse(%s %q) error = %v", name, args, err)
+	}
+	return in
 }
 
-func TestParseFlags_SkipGroup(t *testing.T) {
-	skipGroup, _, _, _, _, _ := parseFlags([]string{"--skip-group", "mygroup"})
-	if skipGroup != "mygroup" {
-		t.Fatalf("expected skipGroup=%q, got %q", "mygroup", skipGroup)
+func TestRunOptions_Defaults(t *testing.T) {
+	t.Setenv(engine.CleanupGraceEnv, "")
+	files, opts, ok := runOptions(mustParse(t, "apply", "setup.bp"))
+	if !ok || !slices.Equal(files, []string{"setup.bp"}) {
+		t.Fatalf("runOptions() = %q, %v", files, ok)
 	}
-}
-
-func TestParseFlags_SkipID(t *testing.T) {
-	_, skipID, _, _, _, _ := parseFlags([]string{"--skip-id", "myid"})
-	if skipID != "myid" {
-		t.Fatalf("expected skipID=%q, got %q", "myid", skipID)
+	if opts.SkipGroup != "" || opts.SkipID != "" || opts.OnlyID != "" || opts.OnlyGroup != "" || opts.OnlyDeps ||
+		opts.SkipDecrypt || opts.PreferSSH || opts.NoStatus || len(opts.Vars) != 0 ||
+		opts.Deadline != 0 || opts.ReportPath != "" || opts.CleanupGrace != (engine.CleanupGrace{}) {
+		t.Fatalf("expected all zero values without flags, got %+v", opts)
 	}
 }
 
-func TestParseFlags_Only(t *testing.T) {
-	_, _, onlyID, _, _, _ := parseFlags([]string{"--only", "step-42"})
-	if onlyID != "step-42" {
-		t.Fatalf("expected onlyID=%q, got %q", "step-42", onlyID)
+func TestRunOptions_Combined(t *testing.T) {
+	_, opts, ok := runOptions(mustParse(t, "apply",
+		"--skip-group", "grp",
+		"setup.bp",
+		"--skip-id=sid",
+		"--only", "oid",
+		"--skip-decrypt",
+		"--prefer-ssh",
+		"--no-status",
+		"--var", "A=--b",
+		"--deadline", "1h30m",
+		"--report", "out/setup.html",
+	))
+	if !ok {
+		t.Fatal("expected flags to parse")
+	}
+	if opts.SkipGroup != "grp" {
+		t.Errorf("SkipGroup: want %q got %q", "grp", opts.SkipGroup)
+	}
+	if opts.SkipID != "sid" {
+		t.Errorf("SkipID: want %q got %q", "sid", opts.SkipID)
+	}
+	if opts.OnlyID != "oid" || opts.OnlyDeps {
+		t.Errorf("expected --only oid without dependencies, got %q, %v", opts.OnlyID, opts.OnlyDeps)
+	}
+	if !opts.SkipDecrypt || !opts.PreferSSH || !opts.NoStatus {
+		t.Errorf("expected every switch set, got %+v", opts)
+	}
+	if opts.Vars["A"] != "--b" {
+		t.Errorf("Vars: want A=--b got %v", opts.Vars)
+	}
+	if opts.Deadline != 90*time.Minute {
+		t.Errorf("Deadline: want 1h30m got %v", opts.Deadline)
+	}
+	if opts.ReportPath != "out/setup.html" {
+		t.Errorf("ReportPath: want out/setup.html got %q", opts.ReportPath)
 	}
 }
 
-func TestParseFlags_SkipDecrypt(t *testing.T) {
-	_, _, _, skipDecrypt, _, _ := parseFlags([]string{"--skip-decrypt"})
-	if !skipDecrypt {
-		t.Fatal("expected skipDecrypt=true")
+func TestRunOptions_OnlySelectsDependencies(t *testing.T) {
+	if _, opts, _ := runOptions(mustParse(t, "plan", "setup.bp", "--only-id", "step-42")); opts.OnlyID != "step-42" || !opts.OnlyDeps {
+		t.Errorf("expected OnlyID=step-42 with dependencies, got %q, %v", opts.OnlyID, opts.OnlyDeps)
+	}
+	if _, opts, _ := runOptions(mustParse(t, "plan", "setup.bp", "--only-group", "dotfiles")); opts.OnlyGroup != "dotfiles" || !opts.OnlyDeps {
+		t.Errorf("expected OnlyGroup=dotfiles with dependencies, got %q, %v", opts.OnlyGroup, opts.OnlyDeps)
 	}
 }
 
-func TestParseFlags_PreferSSH(t *testing.T) {
-	_, _, _, _, preferSSH, _ := parseFlags([]string{"--prefer-ssh"})
-	if !preferSSH {
-		t.Fatal("expected preferSSH=true")
+func TestRunOptions_InvalidValues(t *testing.T) {
+	for _, args := range [][]string{
+		{"setup.bp", "--deadline", "soon"},
+		{"setup.bp", "--deadline", "-5m"},
+		{"setup.bp", "--report", "setup.txt"},
+		{"setup.bp", "--var", "NOVALUE"},
+		{"setup.bp", "--cleanup-grace", "soon"},
+	} {
+		if _, _, ok := runOptions(mustParse(t, "apply", args...)); ok {
+			t.Errorf("runOptions(%q) ok = true, want an error", args)
+		}
 	}
 }
 
-func TestParseFlags_Combined(t *testing.T) {
-	skipGroup, skipID, onlyID, skipDecrypt, preferSSH, noStatus := parseFlags([]string{
-		"--skip-group", "grp",
-		"--skip-id", "sid",
-		"--only", "oid",
-		"--skip-decrypt",
-		"--prefer-ssh",
-		"--no-status",
-	})
-	if skipGroup != "grp" {
-		t.Errorf("skipGroup: want %q got %q", "grp", skipGroup)
-	}
-	if skipID != "sid" {
-		t.Errorf("skipID: want %q got %q", "sid", skipID)
+func TestRunOptions_CleanupGrace(t *testing.T) {
+	t.Setenv(engine.CleanupGraceEnv, "7d")
+
+	if _, opts, _ := runOptions(mustParse(t, "apply", "setup.bp")); opts.CleanupGrace.Age != 7*24*time.Hour {
+		t.Errorf("expected the environment default of 7d, got %+v", opts.CleanupGrace)
 	}
-	if onlyID != "oid" {
-		t.Errorf("onlyID: want %q got %q", "oid", onlyID)
+	_, opts, _ := runOptions(mustParse(t, "apply", "setup.bp", "--cleanup-grace", "3"))
+	if opts.CleanupGrace.Applies != 3 || opts.CleanupGrace.Age != 0 {
+		t.Errorf("expected the flag to override with 3 applies, got %+v", opts.CleanupGrace)
 	}
-	if !skipDecrypt {
-		t.Error("expected skipDecrypt=true")
+}
+
+func TestApplyEngineFlags_OutputFormat(t *testing.T) {
+	t.Cleanup(func() { _ = engine.SetOutputFormat("text") })
+
+	if err := applyEngineFlags(mustParse(t, "plan", "setup.bp", "--output=json")); err != nil || !engine.JSONOutput() {
+		t.Fatalf("applyEngineFlags(--output=json) = %v, JSON output %v", err, engine.JSONOutput())
 	}
-	if !preferSSH {
-		t.Error("expected preferSSH=true")
+	if err := applyEngineFlags(mustParse(t, "plan", "setup.bp", "--output", "yaml")); err == nil {
+		t.Error("expected --output yaml to be rejected")
 	}
-	if !noStatus {
-		t.Error("expected noStatus=true")
+	_ = engine.SetOutputFormat("text")
+	// --output of export is the file to write
+	if err := applyEngineFlags(mustParse(t, "export", "setup.bp", "--output", "setup.sh")); err != nil || engine.JSONOutput() {
+		t.Errorf("applyEngineFlags(export --output setup.sh) = %v, JSON output %v", err, engine.JSONOutput())
 	}
 }
 
-func TestParseFlags_NoStatus(t *testing.T) {
-	_, _, _, _, _, noStatus := parseFlags([]string{"--no-status"})
-	if !noStatus {
-		t.Fatal("expected noStatus=true")
+func TestFlagArgs(t *testing.T) {
+	in := mustParse(t, "apply", "setup.bp", "--target", "me@host", "--var", "A=1", "--strict", "--prefer-ssh=false", "--output", "json")
+	got := in.flagArgs("--target", "--shared", "--manifest", "--output")
+	if want := []string{"--var", "A=1", "--strict"}; !slices.Equal(got, want) {
+		t.Errorf("flagArgs() = %q, want %q", got, want)
 	}
 }
 
-func TestParseFlags_MissingValueIgnored(t *testing.T) {
-	// Flag present but no following argument — should not panic, value stays empty.
-	skipGroup, _, _, _, _, _ := parseFlags([]string{"--skip-group"})
-	if skipGroup != "" {
-		t.Fatalf("expected skipGroup=%q when value is missing, got %q", "", skipGroup)
+func TestParseChdirFlag(t *testing.T) {
+	rest, dir, ok := parseChdirFlag([]string{"--chdir", "dotfiles", "apply", "setup.bp"})
+	if !ok || dir != "dotfiles" || !slices.Equal(rest, []string{"apply", "setup.bp"}) {
+		t.Fatalf("parseChdirFlag() = %q, %q, %v", rest, dir, ok)
+	}
+	if _, dir, _ := parseChdirFlag([]string{"plan", "setup.bp", "--chdir=/srv/bp"}); dir != "/srv/bp" {
+		t.Errorf("--chdir=/srv/bp gave %q", dir)
+	}
+	if _, dir, _ := parseChdirFlag([]string{"plan", "setup.bp"}); dir != "" {
+		t.Errorf("default dir = %q, want empty", dir)
+	}
+	if _, _, ok := parseChdirFlag([]string{"plan", "--chdir"}); ok {
+		t.Error("expected --chdir without a directory to be rejected")
 	}
 }
 
 // ---------------------------------------------------------------------------
-// isKnownCommand / unknownCommandMessage
+// knownCommands / unknownCommandMessage
 // ---------------------------------------------------------------------------
 
-func TestIsKnownCommand_AllKnown(t *testing.T) {
+func TestKnownCommands_AllKnown(t *testing.T) {
 	known := []string{"plan", "apply", "encrypt", "status", "history", "ps", "slow", "diff", "version", "doctor", "validate"}
 	for _, cmd := range known {
-		if !isKnownCommand(cmd) {
+		if knownCommands[cmd] == nil {
 			t.Errorf("%q should be a known command", cmd)
 		}
 	}
 }
 
-func TestIsKnownCommand_Unknown(t *testing.T) {
-	if isKnownCommand("bogus") {
+func TestKnownCommands_Unknown(t *testing.T) {
+	if knownCommands["bogus"] != nil {
 		t.Error("\"bogus\" should not be a known command")
 	}
 }
@@ -242,3 +301,173 @@ func TestUnknownCommandMessage_ContainsUsage(t *testing.T) {
 		t.Errorf("message should contain usage hint, got: %s", msg)
 	}
 }
+
+// ---------------------------------------------------------------------------
+// kdfParams
+// ---------------------------------------------------------------------------
+
+func TestKDFParams(t *testing.T) {
+	params, ok := kdfParams(mustParse(t, "rekey", "secrets.enc", "--upgrade"))
+	if !ok || params != cryptopkg.DefaultKDFParams {
+		t.Errorf("expected the defaults without flags, got %+v (ok=%v)", params, ok)
+	}
+	params, ok = kdfParams(mustParse(t, "encrypt", "secrets.txt", "--kdf-memory", "256", "--kdf-time=4"))
+	want := cryptopkg.KDFParams{Time: 4, MemoryKiB: 256 * 1024, Threads: cryptopkg.DefaultKDFParams.Threads}
+	if !ok || params != want {
+		t.Errorf("expected %+v, got %+v (ok=%v)", want, params, ok)
+	}
+	if _, ok := kdfParams(mustParse(t, "encrypt", "secrets.txt", "--kdf-time", "0")); ok {
+		t.Error("expected --kdf-time 0 to be rejected")
+	}
+}
+
+// ---------------------------------------------------------------------------
+// historyRetention
+// ---------------------------------------------------------------------------
+
+func TestHistoryRetention(t *testing.T) {
+	in := mustParse(t, "history", "prune", "--keep", "50", "--older-than", "30d", "--dry-run")
+	retention, ok := historyRetention(in)
+	if !ok || !in.on("--dry-run") {
+		t.Fatalf("historyRetention() = %+v, %v", retention, ok)
+	}
+	if retention.Keep != 50 || retention.MaxAge != 30*24*time.Hour {
+		t.Errorf("retention = %+v, want keep 50 and 720h", retention)
+	}
+
+	for _, args := range [][]string{{"prune", "--keep", "0"}, {"prune", "--older-than", "soon"}} {
+		if _, ok := historyRetention(mustParse(t, "history", args...)); ok {
+			t.Errorf("historyRetention(%q) should fail", args)
+		}
+	}
+	if _, err := knownCommands["history"].parse([]string{"prune", "--force"}); err == nil {
+		t.Error("expected history prune --force to be rejected")
+	}
+}
+
+// ---------------------------------------------------------------------------
+// blueprintFiles
+// ---------------------------------------------------------------------------
+
+func TestBlueprintFiles(t *testing.T) {
+	files, ok := blueprintFiles(mustParse(t, "apply", "setup.bp", "--no-status"))
+	if !ok || !slices.Equal(files, []string{"setup.bp"}) {
+		t.Errorf("blueprintFiles(path) = %q, %v", files, ok)
+	}
+	files, ok = blueprintFiles(mustParse(t, "apply", "work.bp", "--no-status", "personal.bp"))
+	if !ok || !slices.Equal(files, []string{"work.bp", "personal.bp"}) {
+		t.Errorf("blueprintFiles(two paths) = %q, %v", files, ok)
+	}
+
+	dir := t.TempDir()
+	if err := os.Chmod(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "base.bp"), []byte("install git\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	old := engine.SharedBlueprintDir
+	engine.SharedBlueprintDir = dir
+	t.Cleanup(func() { engine.SharedBlueprintDir = old })
+
+	files, ok = blueprintFiles(mustParse(t, "apply", "--shared", "base", "--only", "git"))
+	if !ok || !slices.Equal(files, []string{filepath.Join(dir, "base.bp")}) {
+		t.Errorf("blueprintFiles(--shared base) = %q, %v", files, ok)
+	}
+	files, ok = blueprintFiles(mustParse(t, "apply", "--shared", "base", "work.bp"))
+	if !ok || !slices.Equal(files, []string{filepath.Join(dir, "base.bp"), "work.bp"}) {
+		t.Errorf("blueprintFiles(--shared base work.bp) = %q, %v", files, ok)
+	}
+	if _, ok := blueprintFiles(mustParse(t, "apply", "--shared=")); ok {
+		t.Error("expected --shared without a name to be rejected")
+	}
+	if _, ok := blueprintFiles(mustParse(t, "apply", "--shared", "missing")); ok {
+		t.Error("expected an unknown shared blueprint to be rejected")
+	}
+	if _, ok := blueprintFiles(mustParse(t, "apply", "--no-status")); ok {
+		t.Error("expected flags without a blueprint to be rejected")
+	}
+
+	manifest := filepath.Join(dir, "laptop.txt")
+	if err := os.WriteFile(manifest, []byte("# laptop\nwork.bp\n\n/srv/personal.bp\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	files, ok = blueprintFiles(mustParse(t, "apply", "--manifest", manifest, "--no-status"))
+	if !ok || !slices.Equal(files, []string{filepath.Join(dir, "work.bp"), "/srv/personal.bp"}) {
+		t.Errorf("blueprintFiles(--manifest) = %q, %v", files, ok)
+	}
+}
+
+func TestMutatesMachine(t *testing.T) {
+	tests := []struct {
+		mode string
+		args []string
+		want bool
+	}{
+		{"apply", []string{"setup.bp"}, true},
+		{"plan", []string{"setup.bp"}, false},
+		{"status", nil, false},
+		{"history", nil, false},
+		{"status", []string{"prune"}, true},
+		{"status", []string{"prune", "--down"}, true},
+		{"history", []string{"prune", "--keep", "10"}, true},
+		{"history", []string{"prune", "--dry-run"}, false},
+		{"workspace", []string{"list"}, false},
+		{"workspace", []string{"new", "work"}, true},
+		{"workspace", []string{"select", "work"}, true},
+		{"validate", []string{"setup.bp"}, false},
+		{"encrypt", []string{"secret.txt"}, true},
+		{"clean", nil, true},
+		{"clean", []string{"--dry-run"}, false},
+		{"state", []string{"backup"}, false},
+		{"state", []string{"restore", "backup.tar.gz"}, true},
+		{"doctor", nil, false},
+		{"doctor", []string{"--fix"}, true},
+		{"hook", []string{"install"}, true},
+	}
+	for _, tt := range tests {
+		if got := mutatesMachine(mustParse(t, tt.mode, tt.args...)); got != tt.want {
+			t.Errorf("mutatesMachine(%s %q) = %v, want %v", tt.mode, tt.args, got, tt.want)
+		}
+	}
+}
+
+// ---------------------------------------------------------------------------
+// runRollback
+// ---------------------------------------------------------------------------
+
+func TestRunRollback(t *testing.T) {
+	origRun, origRC := rollbackRun, rollbackRCFiles
+	defer func() { rollbackRun, rollbackRCFiles = origRun, origRC }()
+	var calls []string
+	rollbackRun = func(run int, dryRun, preferSSH bool) int {
+		calls = append(calls, fmt.Sprintf("run %d dry=%v ssh=%v", run, dryRun, preferSSH))
+		return 0
+	}
+	rollbackRCFiles = func(paths []string, dryRun bool) int {
+		calls = append(calls, fmt.Sprintf("rc %v dry=%v", paths, dryRun))
+		return 0
+	}
+
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{nil, "run 0 dry=false ssh=false"}, // the latest run
+		{[]string{"--dry-run"}, "run 0 dry=true ssh=false"},
+		{[]string{"12", "--prefer-ssh"}, "run 12 dry=false ssh=true"},
+		{[]string{"--rc-files"}, "rc [] dry=false"},
+		{[]string{"--rc-files", "~/.zshrc", "--dry-run"}, "rc [~/.zshrc] dry=true"},
+	}
+	for _, tt := range tests {
+		calls = nil
+		if code := runRollback(mustParse(t, "rollback", tt.args...)); code != 0 || len(calls) != 1 || calls[0] != tt.want {
+			t.Errorf("runRollback(%v) = %d, calls %v; want %q", tt.args, code, calls, tt.want)
+		}
+	}
+
+	calls = nil
+	if code := runRollback(mustParse(t, "rollback", "~/.zshrc")); code != 1 || len(calls) != 0 {
+		t.Errorf("runRollback(~/.zshrc) = %d, calls %v; want 1 without --rc-files", code, calls)
+	}
+}
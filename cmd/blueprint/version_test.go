@@ -29,7 +29,7 @@ func TestUnknownCommandMessageIncludesVersion(t *testing.T) {
 	}
 	// Verify version is listed in known commands
 	for _, cmd := range []string{"plan", "apply", "version"} {
-		if !isKnownCommand(cmd) {
+		if knownCommands[cmd] == nil {
 			t.Errorf("%q should be a known command", cmd)
 		}
 	}
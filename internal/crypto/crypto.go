@@ -1,37 +1,110 @@
 package crypto
 
 import (
+	"bytes"
 	"crypto/aes"
 	"crypto/cipher"
 	"crypto/rand"
 	"crypto/sha256"
+	"encoding/binary"
 	"fmt"
 	"io"
 
+	"golang.org/x/crypto/argon2"
 	"golang.org/x/crypto/pbkdf2"
 )
 
-const saltSize = 32
+// Encrypted files start with a header naming the format version and the KDF
+// parameters they were encrypted with, so the parameters can be raised
+// without breaking files encrypted earlier:
+//
+//	v1:     "BPENC" | 0x01 | time (4) | memory KiB (4) | threads (1) | salt (16) | nonce | ciphertext+tag
+//	legacy: salt (32) | nonce | ciphertext+tag
+//
+// v1 derives the key with Argon2id and authenticates the header as GCM
+// additional data, so tampering with the parameters fails decryption.
+// Legacy files, written before the header existed, use PBKDF2-SHA256.
+const (
+	VersionLegacy   = 0
+	VersionArgon2id = 1
+
+	// CurrentVersion is the format EncryptFile writes.
+	CurrentVersion = VersionArgon2id
+)
+
+var magic = []byte("BPENC")
+
+const (
+	saltSize       = 32 // legacy files
+	argon2SaltSize = 16
+	keySize        = 32
+	headerSize     = 5 + 1 + 4 + 4 + 1 + argon2SaltSize
+)
+
+// KDFParams are the Argon2id cost parameters of an encrypted file.
+type KDFParams struct {
+	Time      uint32 // passes over memory
+	MemoryKiB uint32 // memory used, in KiB
+	Threads   uint8  // lanes computed in parallel
+}
+
+// DefaultKDFParams are the parameters EncryptFile uses, the second
+// recommended option of RFC 9106: t=3, 64 MiB, 4 lanes.
+var DefaultKDFParams = KDFParams{Time: 3, MemoryKiB: 64 * 1024, Threads: 4}
+
+// Limits on the parameters read from a file header, so a crafted file cannot
+// make decryption allocate or run without bound.
+const (
+	maxKDFTime      = 64
+	maxKDFMemoryKiB = 4 * 1024 * 1024 // 4 GiB
+)
+
+// Validate reports whether p can be used to encrypt or decrypt a file.
+func (p KDFParams) Validate() error {
+	if p.Time < 1 || p.Time > maxKDFTime {
+		return fmt.Errorf("KDF time must be between 1 and %d, got %d", maxKDFTime, p.Time)
+	}
+	if p.Threads < 1 {
+		return fmt.Errorf("KDF threads must be at least 1")
+	}
+	if p.MemoryKiB < 8*uint32(p.Threads) || p.MemoryKiB > maxKDFMemoryKiB {
+		return fmt.Errorf("KDF memory must be between %d KiB and %d KiB, got %d KiB", 8*uint32(p.Threads), maxKDFMemoryKiB, p.MemoryKiB)
+	}
+	return nil
+}
+
+// Weaker reports whether p costs less than other in any parameter.
+func (p KDFParams) Weaker(other KDFParams) bool {
+	return p.Time < other.Time || p.MemoryKiB < other.MemoryKiB || p.Threads < other.Threads
+}
 
-// EncryptFile encrypts a file using AES-256-GCM and returns the encrypted data
+// String formats p for messages, e.g. "t=3, m=64 MiB, p=4".
+func (p KDFParams) String() string {
+	return fmt.Sprintf("t=%d, m=%d MiB, p=%d", p.Time, p.MemoryKiB/1024, p.Threads)
+}
+
+// EncryptFile encrypts a file using AES-256-GCM with a key derived by
+// Argon2id with DefaultKDFParams, and returns the encrypted data.
 func EncryptFile(plaintext []byte, password string) ([]byte, error) {
+	return EncryptFileWithParams(plaintext, password, DefaultKDFParams)
+}
+
+// EncryptFileWithParams is EncryptFile with the given Argon2id parameters.
+func EncryptFileWithParams(plaintext []byte, password string, params KDFParams) ([]byte, error) {
+	if err := params.Validate(); err != nil {
+		return nil, err
+	}
+
 	// Generate random salt
-	salt := make([]byte, saltSize)
+	salt := make([]byte, argon2SaltSize)
 	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
 		return nil, fmt.Errorf("failed to generate salt: %w", err)
 	}
+	header := encodeHeader(params, salt)
 
-	key := deriveKey(password, salt)
-
-	// Create cipher
-	block, err := aes.NewCipher(key)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create cipher: %w", err)
-	}
-
-	aead, err := cipher.NewGCM(block)
+	aead, err := newGCM(deriveArgon2Key(password, salt, params))
 	if err != nil {
-		return nil, fmt.Errorf("failed to create GCM: %w", err)
+		return nil, err
 	}
 
 	// Generate random nonce
@@ -40,33 +113,37 @@ func EncryptFile(plaintext []byte, password string) ([]byte, error) {
 		return nil, fmt.Errorf("failed to generate nonce: %w", err)
 	}
 
-	// Output: [salt | nonce | ciphertext+tag]
-	out := make([]byte, 0, saltSize+len(nonce)+len(plaintext)+aead.Overhead())
-	out = append(out, salt...)
-	out = aead.Seal(append(out, nonce...), nonce, plaintext, nil)
+	// Output: [header | nonce | ciphertext+tag]
+	out := make([]byte, 0, len(header)+len(nonce)+len(plaintext)+aead.Overhead())
+	out = append(out, header...)
+	out = aead.Seal(append(out, nonce...), nonce, plaintext, header)
 
 	return out, nil
 }
 
-// DecryptFile decrypts a file encrypted with EncryptFile using AES-256-GCM
+// DecryptFile decrypts a file encrypted with EncryptFile using AES-256-GCM.
+// Files in the legacy format are decrypted too.
 func DecryptFile(ciphertext []byte, password string) ([]byte, error) {
-	// Extract salt, then nonce, then encrypted data
-	if len(ciphertext) < saltSize {
-		return nil, fmt.Errorf("ciphertext too short")
+	version, params, err := FileParams(ciphertext)
+	if err != nil {
+		return nil, err
 	}
-	salt := ciphertext[:saltSize]
-	rest := ciphertext[saltSize:]
 
-	key := deriveKey(password, salt)
-
-	block, err := aes.NewCipher(key)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	var key, header, rest []byte
+	if version == VersionLegacy {
+		// Extract salt, then nonce, then encrypted data
+		salt := ciphertext[:saltSize]
+		rest = ciphertext[saltSize:]
+		key = deriveKey(password, salt)
+	} else {
+		header = ciphertext[:headerSize]
+		rest = ciphertext[headerSize:]
+		key = deriveArgon2Key(password, header[headerSize-argon2SaltSize:], params)
 	}
 
-	aead, err := cipher.NewGCM(block)
+	aead, err := newGCM(key)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create GCM: %w", err)
+		return nil, err
 	}
 
 	nonceSize := aead.NonceSize()
@@ -78,7 +155,7 @@ func DecryptFile(ciphertext []byte, password string) ([]byte, error) {
 	encryptedData := rest[nonceSize:]
 
 	// Decrypt
-	plaintext, err := aead.Open(nil, nonce, encryptedData, nil)
+	plaintext, err := aead.Open(nil, nonce, encryptedData, header)
 	if err != nil {
 		return nil, fmt.Errorf("decryption failed: %w", err)
 	}
@@ -86,10 +163,79 @@ func DecryptFile(ciphertext []byte, password string) ([]byte, error) {
 	return plaintext, nil
 }
 
+// FileParams returns the format version of encrypted data and, for versioned
+// files, the KDF parameters it was encrypted with. Data without the header is
+// a legacy file. A legacy salt starting with the header by chance is too
+// unlikely (one in 2^48) to be worth guessing around.
+func FileParams(data []byte) (int, KDFParams, error) {
+	if !bytes.HasPrefix(data, magic) {
+		if len(data) < saltSize {
+			return 0, KDFParams{}, fmt.Errorf("ciphertext too short")
+		}
+		return VersionLegacy, KDFParams{}, nil
+	}
+	if len(data) < headerSize {
+		return 0, KDFParams{}, fmt.Errorf("ciphertext too short")
+	}
+	if version := int(data[len(magic)]); version != VersionArgon2id {
+		return 0, KDFParams{}, fmt.Errorf("unsupported encrypted file version %d: upgrade blueprint to decrypt it", version)
+	}
+	p := data[len(magic)+1:]
+	params := KDFParams{
+		Time:      binary.BigEndian.Uint32(p[0:4]),
+		MemoryKiB: binary.BigEndian.Uint32(p[4:8]),
+		Threads:   p[8],
+	}
+	if err := params.Validate(); err != nil {
+		return 0, KDFParams{}, fmt.Errorf("invalid encrypted file header: %w", err)
+	}
+	return VersionArgon2id, params, nil
+}
+
+// NeedsUpgrade reports whether data should be re-encrypted to use params:
+// it is a legacy file, or its KDF parameters are weaker than params.
+func NeedsUpgrade(data []byte, params KDFParams) (bool, error) {
+	version, current, err := FileParams(data)
+	if err != nil {
+		return false, err
+	}
+	return version < CurrentVersion || current.Weaker(params), nil
+}
+
+// encodeHeader builds the v1 header for params and salt.
+func encodeHeader(params KDFParams, salt []byte) []byte {
+	header := make([]byte, 0, headerSize)
+	header = append(header, magic...)
+	header = append(header, VersionArgon2id)
+	header = binary.BigEndian.AppendUint32(header, params.Time)
+	header = binary.BigEndian.AppendUint32(header, params.MemoryKiB)
+	header = append(header, params.Threads)
+	return append(header, salt...)
+}
+
+// newGCM creates an AES-256-GCM AEAD for key.
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create GCM: %w", err)
+	}
+	return aead, nil
+}
+
+// deriveArgon2Key creates a 32-byte AES key from a password and a random
+// salt using Argon2id with params.
+func deriveArgon2Key(password string, salt []byte, params KDFParams) []byte {
+	return argon2.IDKey([]byte(password), salt, params.Time, params.MemoryKiB, params.Threads, keySize)
+}
+
 const pbkdf2Iterations = 260_000 // OWASP recommended minimum for PBKDF2-SHA256
 
-// deriveKey creates a 32-byte AES key from a password and a random salt
-// using PBKDF2-SHA256 with 260,000 iterations.
+// deriveKey creates the 32-byte AES key of a legacy file from a password and
+// a random salt using PBKDF2-SHA256 with 260,000 iterations.
 func deriveKey(password string, salt []byte) []byte {
-	return pbkdf2.Key([]byte(password), salt, pbkdf2Iterations, 32, sha256.New)
+	return pbkdf2.Key([]byte(password), salt, pbkdf2Iterations, keySize, sha256.New)
 }
@@ -2,6 +2,7 @@ package crypto
 
 import (
 	"bytes"
+	"strings"
 	"testing"
 )
 
@@ -198,3 +199,142 @@ func TestDeriveKeyDeterminism(t *testing.T) {
 		t.Errorf("deriveKey should return 32-byte key, got %d bytes", len(key1))
 	}
 }
+
+// ---- versioned header -----------------------------------------------------
+
+// fastParams keeps tests that do not check the defaults quick.
+var fastParams = KDFParams{Time: 1, MemoryKiB: 8 * 1024, Threads: 1}
+
+// encryptLegacy encrypts plaintext the way blueprint did before files had a
+// header: [salt | nonce | ciphertext+tag] with a PBKDF2 key.
+func encryptLegacy(t *testing.T, plaintext []byte, password string) []byte {
+	t.Helper()
+	salt := bytes.Repeat([]byte{0x42}, saltSize)
+	aead, err := newGCM(deriveKey(password, salt))
+	if err != nil {
+		t.Fatal(err)
+	}
+	nonce := make([]byte, aead.NonceSize())
+	out := append(append([]byte{}, salt...), nonce...)
+	return aead.Seal(out, nonce, plaintext, nil)
+}
+
+func TestDecryptLegacyFile(t *testing.T) {
+	legacy := encryptLegacy(t, []byte("old secret"), "password")
+
+	got, err := DecryptFile(legacy, "password")
+	if err != nil {
+		t.Fatalf("DecryptFile() error on a legacy file: %v", err)
+	}
+	if string(got) != "old secret" {
+		t.Errorf("DecryptFile() = %q, want %q", got, "old secret")
+	}
+	if version, _, _ := FileParams(legacy); version != VersionLegacy {
+		t.Errorf("FileParams() version = %d, want legacy", version)
+	}
+}
+
+func TestEncryptFileWritesParams(t *testing.T) {
+	ciphertext, err := EncryptFileWithParams([]byte("data"), "password", fastParams)
+	if err != nil {
+		t.Fatalf("EncryptFileWithParams() error: %v", err)
+	}
+	version, params, err := FileParams(ciphertext)
+	if err != nil || version != VersionArgon2id || params != fastParams {
+		t.Fatalf("FileParams() = %d, %+v, %v; want v1 with %+v", version, params, err, fastParams)
+	}
+	if got, err := DecryptFile(ciphertext, "password"); err != nil || string(got) != "data" {
+		t.Errorf("DecryptFile() = %q, %v", got, err)
+	}
+
+	if _, params, _ := FileParams(mustEncrypt(t)); params != DefaultKDFParams {
+		t.Errorf("EncryptFile() params = %+v, want the defaults %+v", params, DefaultKDFParams)
+	}
+}
+
+func mustEncrypt(t *testing.T) []byte {
+	t.Helper()
+	ciphertext, err := EncryptFile([]byte("data"), "password")
+	if err != nil {
+		t.Fatalf("EncryptFile() error: %v", err)
+	}
+	return ciphertext
+}
+
+func TestDecryptTamperedHeaderFails(t *testing.T) {
+	ciphertext, err := EncryptFileWithParams([]byte("data"), "password", KDFParams{Time: 2, MemoryKiB: 8 * 1024, Threads: 1})
+	if err != nil {
+		t.Fatalf("EncryptFileWithParams() error: %v", err)
+	}
+	// Lower the time cost recorded in the header
+	tampered := append([]byte{}, ciphertext...)
+	tampered[len(magic)+4] = 1
+
+	if _, err := DecryptFile(tampered, "password"); err == nil {
+		t.Fatal("DecryptFile() should fail when the header parameters were changed")
+	}
+}
+
+func TestFileParamsRejectsBadHeaders(t *testing.T) {
+	valid, err := EncryptFileWithParams([]byte("data"), "password", fastParams)
+	if err != nil {
+		t.Fatalf("EncryptFileWithParams() error: %v", err)
+	}
+
+	future := append([]byte{}, valid...)
+	future[len(magic)] = 9
+	if _, _, err := FileParams(future); err == nil || !strings.Contains(err.Error(), "unsupported encrypted file version 9") {
+		t.Errorf("FileParams() on a newer version = %v", err)
+	}
+
+	// A crafted header asking for more memory than decryption may use
+	huge := append([]byte{}, valid...)
+	copy(huge[len(magic)+5:], []byte{0xff, 0xff, 0xff, 0xff})
+	if _, _, err := FileParams(huge); err == nil || !strings.Contains(err.Error(), "KDF memory") {
+		t.Errorf("FileParams() on unbounded memory = %v", err)
+	}
+
+	if _, _, err := FileParams(valid[:headerSize-1]); err == nil {
+		t.Error("FileParams() should fail on a truncated header")
+	}
+}
+
+func TestNeedsUpgrade(t *testing.T) {
+	current, err := EncryptFileWithParams([]byte("data"), "password", fastParams)
+	if err != nil {
+		t.Fatalf("EncryptFileWithParams() error: %v", err)
+	}
+	tests := []struct {
+		name   string
+		data   []byte
+		params KDFParams
+		want   bool
+	}{
+		{"legacy", encryptLegacy(t, []byte("data"), "password"), fastParams, true},
+		{"same params", current, fastParams, false},
+		{"weaker than requested", current, KDFParams{Time: 1, MemoryKiB: 16 * 1024, Threads: 1}, true},
+		{"stronger than requested", current, KDFParams{Time: 1, MemoryKiB: 8, Threads: 1}, false},
+	}
+	for _, tt := range tests {
+		got, err := NeedsUpgrade(tt.data, tt.params)
+		if err != nil || got != tt.want {
+			t.Errorf("%s: NeedsUpgrade() = %v, %v; want %v", tt.name, got, err, tt.want)
+		}
+	}
+}
+
+func TestKDFParamsValidate(t *testing.T) {
+	if err := DefaultKDFParams.Validate(); err != nil {
+		t.Errorf("DefaultKDFParams.Validate() = %v", err)
+	}
+	for _, p := range []KDFParams{
+		{Time: 0, MemoryKiB: 8 * 1024, Threads: 1},
+		{Time: 1, MemoryKiB: 8 * 1024, Threads: 0},
+		{Time: 1, MemoryKiB: 16, Threads: 4},
+		{Time: 1, MemoryKiB: maxKDFMemoryKiB + 1, Threads: 1},
+	} {
+		if err := p.Validate(); err == nil {
+			t.Errorf("%+v.Validate() should fail", p)
+		}
+	}
+}
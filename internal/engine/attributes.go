@@ -0,0 +1,112 @@
+package engine
+
+import (
+	"fmt"
+	"os"
+
+	handlerskg "github.com/elpic/blueprint/internal/handlers"
+	"github.com/elpic/blueprint/internal/parser"
+	"github.com/elpic/blueprint/internal/ui"
+)
+
+// strictAttributes is set by --strict: attributes a rule's action does not
+// know fail plan, apply and validate instead of only being warned about.
+var strictAttributes bool
+
+// SetStrict controls whether unknown rule attributes are errors.
+func SetStrict(strict bool) {
+	strictAttributes = strict
+}
+
+// checkAttributes flags attributes that the action of a rule does not accept,
+// typically misspellings such as brnach: that the parser would otherwise take
+// as an attribute nothing reads. shell: is left to checkShells.
+func checkAttributes(rules []parser.Rule) []validateIssue {
+	var issues []validateIssue
+	for i, r := range rules {
+		known := knownAttributes(r)
+		if known == nil {
+			continue
+		}
+		for _, attr := range r.Attributes {
+			if known[attr] || attr == "shell" {
+				continue
+			}
+			message := fmt.Sprintf("unknown attribute %s: for %s rules", attr, r.Action)
+			if guess := closestAttribute(attr, known); guess != "" {
+				message += fmt.Sprintf(" (did you mean %s:?)", guess)
+			}
+			issues = append(issues, ruleIssue(i, r, message))
+		}
+	}
+	return issues
+}
+
+// knownAttributes returns the attributes the action of r accepts, or nil when
+// the action is unknown (checkActions reports those).
+func knownAttributes(r parser.Rule) map[string]bool {
+	action := r.Action
+	if action == "uninstall" {
+		action = handlerskg.DetectRuleType(r)
+	}
+	def := handlerskg.GetAction(action)
+	if def == nil {
+		return nil
+	}
+	known := map[string]bool{}
+	for _, a := range handlerskg.CommonAttrs {
+		known[a.Name] = true
+	}
+	for _, a := range def.Meta.Attrs {
+		known[a.Name] = true
+	}
+	return known
+}
+
+// closestAttribute returns the known attribute attr is most likely a typo
+// of, or "" when none is within two edits.
+func closestAttribute(attr string, known map[string]bool) string {
+	best, bestDist := "", 3
+	for name := range known {
+		if d := editDistance(attr, name); d < bestDist || d == bestDist && name < best {
+			best, bestDist = name, d
+		}
+	}
+	return best
+}
+
+// editDistance is the Levenshtein distance between a and b.
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur := make([]int, len(b)+1)
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
+
+// reportAttributes prints the unknown attributes of rules to stderr, as
+// errors under --strict and as warnings otherwise. It reports whether the
+// run must stop.
+func reportAttributes(rules []parser.Rule) bool {
+	issues := checkAttributes(rules)
+	for _, issue := range issues {
+		if strictAttributes {
+			fmt.Fprintf(os.Stderr, "%s\n", ui.FormatError(issue.String()))
+		} else {
+			fmt.Fprintf(os.Stderr, "Warning: %s\n", issue.String())
+		}
+	}
+	return strictAttributes && len(issues) > 0
+}
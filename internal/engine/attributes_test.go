@@ -0,0 +1,54 @@
+package engine
+
+import (
+	"strings"
+	"testing"
+
+	handlerskg "github.com/elpic/blueprint/internal/handlers"
+	"github.com/elpic/blueprint/internal/parser"
+)
+
+func TestCheckAttributes(t *testing.T) {
+	rules, err := parser.Parse(`clone https://github.com/user/repo.git to: ~/repo brnach: main
+clone https://github.com/user/other.git to: ~/other branch: main id: other after: repo retries: 2
+var GREETING "hello: world"
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	issues := checkAttributes(rules)
+	if len(issues) != 1 {
+		t.Fatalf("checkAttributes() = %v, want one issue", issues)
+	}
+	if got := issues[0].String(); !strings.Contains(got, "unknown attribute brnach:") || !strings.Contains(got, "did you mean branch:?") {
+		t.Errorf("issue = %q, want brnach: flagged with a suggestion", got)
+	}
+}
+
+func TestActionExamplesUseKnownAttributes(t *testing.T) {
+	for _, def := range handlerskg.DocumentedActions() {
+		for _, example := range def.Meta.Examples {
+			rules, err := parser.Parse(example)
+			if err != nil {
+				continue // reported by the registry tests
+			}
+			for _, issue := range checkAttributes(rules) {
+				t.Errorf("%s example %q: %s", def.Name, example, issue)
+			}
+		}
+	}
+}
+
+func TestReportAttributes(t *testing.T) {
+	rules := []parser.Rule{{Action: "mkdir", Mkdir: "/tmp/x", Attributes: []string{"mode"}}}
+	t.Cleanup(func() { SetStrict(false) })
+
+	if reportAttributes(rules) {
+		t.Error("an unknown attribute should only be warned about without --strict")
+	}
+	SetStrict(true)
+	if !reportAttributes(rules) {
+		t.Error("an unknown attribute should stop the run with --strict")
+	}
+}
@@ -0,0 +1,111 @@
+package engine
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	handlerskg "github.com/elpic/blueprint/internal/handlers"
+	"github.com/elpic/blueprint/internal/ui"
+	"github.com/elpic/blueprint/internal/ui/timeutil"
+)
+
+// checkResult is the outcome of verifying the status entries of one OS.
+type checkResult struct {
+	verified     int
+	missing      []handlerskg.StatusEntry
+	unverifiable map[string]int // entries per action that has no Verify
+	otherOSCount int
+}
+
+// verifyEntries checks every entry recorded on osName with its action's
+// Verify and stamps the ones still present with now. Missing entries keep
+// their previous verified time so their age keeps showing how long they have
+// been gone. Entries of other operating systems or machines cannot be checked
+// from here.
+func verifyEntries(status *handlerskg.Status, osName string, now time.Time) checkResult {
+	machine := machineID()
+	result := checkResult{unverifiable: map[string]int{}}
+	for _, e := range status.AllEntries() {
+		if e.GetOS() != osName || !handlerskg.OnMachine(e, machine) {
+			result.otherOSCount++
+			continue
+		}
+		def := handlerskg.GetAction(e.GetAction())
+		if def == nil || def.Verify == nil {
+			result.unverifiable[e.GetAction()]++
+			continue
+		}
+		if !def.Verify(e) {
+			result.missing = append(result.missing, e)
+			continue
+		}
+		e.SetVerifiedAt(timeutil.Format(now))
+		result.verified++
+	}
+	return result
+}
+
+// CheckStatus verifies that the resources recorded in status.json for this
+// OS are still present, records when each was last found and then prints the
+// status. It returns 1 when any resource is missing.
+func CheckStatus() int {
+	status, err := loadStatus()
+	if os.IsNotExist(err) {
+		fmt.Printf("%s\n", ui.FormatInfo("No status found — nothing to check."))
+		return 0
+	}
+	if err != nil {
+		fmt.Printf("%s\n", ui.FormatError(fmt.Sprintf("Error reading status: %v", err)))
+		return 1
+	}
+
+	result := verifyEntries(&status, getOSName(), time.Now())
+
+	if err := storeStatus(status); err != nil {
+		fmt.Printf("%s\n", ui.FormatError(fmt.Sprintf("Error writing status: %v", err)))
+		return 1
+	}
+
+	PrintStatus()
+	printCheckResult(result)
+	if len(result.missing) > 0 {
+		return 1
+	}
+	return 0
+}
+
+// printCheckResult prints the summary of a status check.
+func printCheckResult(result checkResult) {
+	fmt.Printf("\n%s\n", ui.FormatHighlight("=== Status Check ==="))
+	fmt.Printf("%s\n", ui.FormatSuccess(fmt.Sprintf("%d resources verified present", result.verified)))
+
+	if len(result.unverifiable) > 0 {
+		actions := make([]string, 0, len(result.unverifiable))
+		count := 0
+		for action, n := range result.unverifiable {
+			actions = append(actions, action)
+			count += n
+		}
+		sort.Strings(actions)
+		fmt.Printf("%s\n", ui.FormatDim(fmt.Sprintf("%d entries cannot be verified (%s)", count, strings.Join(actions, ", "))))
+	}
+	if result.otherOSCount > 0 {
+		fmt.Printf("%s\n", ui.FormatDim(fmt.Sprintf("%d entries recorded on other operating systems or machines were skipped", result.otherOSCount)))
+	}
+
+	if len(result.missing) == 0 {
+		return
+	}
+	fmt.Printf("%s\n", ui.FormatError(fmt.Sprintf("%d resources are missing:", len(result.missing))))
+	for _, e := range result.missing {
+		fmt.Printf("  %s %s %s\n",
+			ui.FormatError("✗"),
+			ui.FormatInfo(e.GetAction()+" "+ui.AbbreviateHome(e.GetResourceKey())),
+			ui.FormatDim("["+ui.AbbreviateHome(e.GetBlueprint())+"]"),
+		)
+	}
+	fmt.Printf("%s\n", ui.FormatDim("Re-apply their blueprints, or remove the entries with 'blueprint status prune'."))
+}
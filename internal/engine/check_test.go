@@ -0,0 +1,47 @@
+package engine
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	handlerskg "github.com/elpic/blueprint/internal/handlers"
+)
+
+func TestVerifyEntries(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	earlier := "2026-09-01T00:00:00Z"
+
+	status := &handlerskg.Status{
+		Mkdirs: []handlerskg.MkdirStatus{
+			{Path: dir, OS: "linux"},
+			{Path: filepath.Join(dir, "gone"), OS: "linux", VerifiedAt: earlier},
+			{Path: "/somewhere/else", OS: "mac"},
+		},
+		Runs: []handlerskg.RunStatus{
+			{Action: "run", Command: "echo hi", OS: "linux"},
+		},
+	}
+
+	result := verifyEntries(status, "linux", now)
+
+	if result.verified != 1 {
+		t.Errorf("verified = %d, want 1", result.verified)
+	}
+	if got := status.Mkdirs[0].VerifiedAt; got != now.Format(time.RFC3339) {
+		t.Errorf("present dir VerifiedAt = %q, want it stamped with now", got)
+	}
+	if len(result.missing) != 1 || result.missing[0].GetResourceKey() != filepath.Join(dir, "gone") {
+		t.Fatalf("missing = %v, want the removed dir", result.missing)
+	}
+	if got := status.Mkdirs[1].VerifiedAt; got != earlier {
+		t.Errorf("missing dir VerifiedAt = %q, want it unchanged", got)
+	}
+	if result.unverifiable["run"] != 1 {
+		t.Errorf("unverifiable = %v, want the run entry", result.unverifiable)
+	}
+	if result.otherOSCount != 1 || status.Mkdirs[2].VerifiedAt != "" {
+		t.Errorf("entries of other operating systems should be skipped, got %d", result.otherOSCount)
+	}
+}
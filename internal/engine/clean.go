@@ -0,0 +1,200 @@
+package engine
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/elpic/blueprint/internal"
+	"github.com/elpic/blueprint/internal/ui"
+)
+
+// cleanItem is a file or directory `blueprint clean` removes or, for a
+// history output larger than the configured size, cuts down.
+type cleanItem struct {
+	path     string
+	kind     string
+	size     int64 // bytes reclaimed
+	truncate bool
+}
+
+// tempArtifact is a pattern of temporary files and directories that a run
+// removes itself unless it is interrupted.
+type tempArtifact struct {
+	inTempDir bool // pattern is in the system temp directory, else in ~/.blueprint
+	pattern   string
+	kind      string
+}
+
+var tempArtifacts = []tempArtifact{
+	{inTempDir: true, pattern: "blueprint-*", kind: "interrupted clone"},
+	{inTempDir: true, pattern: "asdf-install-*", kind: "interrupted asdf install"},
+	{pattern: ".restore-*", kind: "interrupted restore"},
+	{pattern: "blueprint-sudoers-*", kind: "sudoers draft"},
+}
+
+// truncatedMarker starts a history output cut down by `blueprint clean`.
+const truncatedMarker = "=== OUTPUT TRUNCATED BY blueprint clean ===\n"
+
+// findCleanItems returns what `blueprint clean` would reclaim: the cache,
+// temporary artifacts older than cfg.TempAge, trash entries older than
+// cfg.TrashAge and history outputs larger than cfg.MaxOutput.
+func findCleanItems(blueprintDir, tempDir string, cfg CleanConfig, now time.Time) []cleanItem {
+	var items []cleanItem
+
+	cache := filepath.Join(blueprintDir, "cache")
+	if _, err := os.Lstat(cache); err == nil {
+		items = append(items, cleanItem{path: cache, kind: "cache", size: diskUsage(cache)})
+	}
+
+	for _, a := range tempArtifacts {
+		dir := blueprintDir
+		if a.inTempDir {
+			dir = tempDir
+		}
+		matches, _ := filepath.Glob(filepath.Join(dir, a.pattern))
+		for _, path := range matches {
+			if olderThan(path, now, cfg.TempAge) {
+				items = append(items, cleanItem{path: path, kind: a.kind, size: diskUsage(path)})
+			}
+		}
+	}
+
+	trash := filepath.Join(blueprintDir, "trash")
+	if entries, err := os.ReadDir(trash); err == nil {
+		for _, e := range entries {
+			path := filepath.Join(trash, e.Name())
+			if olderThan(path, now, cfg.TrashAge) {
+				items = append(items, cleanItem{path: path, kind: "trash", size: diskUsage(path)})
+			}
+		}
+	}
+
+	if cfg.MaxOutput > 0 {
+		outputs, _ := filepath.Glob(filepath.Join(blueprintDir, "history", "*", "*.output"))
+		inWorkspaces, _ := filepath.Glob(filepath.Join(blueprintDir, workspacesDir, "*", "history", "*", "*.output"))
+		outputs = append(outputs, inWorkspaces...)
+		for _, path := range outputs {
+			info, err := os.Lstat(path)
+			if err != nil || !info.Mode().IsRegular() {
+				continue
+			}
+			if excess := info.Size() - cfg.MaxOutput - int64(len(truncatedMarker)); excess > 0 {
+				items = append(items, cleanItem{path: path, kind: "history output", size: excess, truncate: true})
+			}
+		}
+	}
+	return items
+}
+
+// olderThan reports whether path was last modified more than age before now.
+func olderThan(path string, now time.Time, age time.Duration) bool {
+	info, err := os.Lstat(path)
+	return err == nil && now.Sub(info.ModTime()) > age
+}
+
+// diskUsage returns the size of the regular files under path.
+func diskUsage(path string) int64 {
+	var total int64
+	_ = filepath.WalkDir(path, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if info, err := d.Info(); err == nil && info.Mode().IsRegular() {
+			total += info.Size()
+		}
+		return nil
+	})
+	return total
+}
+
+// truncateOutput keeps the last maxSize bytes of a history output, starting
+// at a line boundary, after a marker saying the rest was removed.
+func truncateOutput(path string, maxSize int64) error {
+	data, err := os.ReadFile(path) // #nosec G304 -- history output under ~/.blueprint
+	if err != nil {
+		return err
+	}
+	if int64(len(data)) <= maxSize {
+		return nil
+	}
+	tail := data[int64(len(data))-maxSize:]
+	if i := bytes.IndexByte(tail, '\n'); i >= 0 {
+		tail = tail[i+1:]
+	}
+	return os.WriteFile(path, append([]byte(truncatedMarker), tail...), internal.FilePermission)
+}
+
+// formatBytes formats a byte count for the clean report.
+func formatBytes(n int64) string {
+	switch {
+	case n >= 1<<30:
+		return fmt.Sprintf("%.1f GiB", float64(n)/(1<<30))
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MiB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1f KiB", float64(n)/(1<<10))
+	}
+	return fmt.Sprintf("%d B", n)
+}
+
+// Clean clears ~/.blueprint/cache and removes temporary clones and staging
+// directories left by interrupted runs, old trash entries and the excess of
+// oversized history outputs, as set in the [clean] section of
+// ~/.blueprint/config, then reports the space reclaimed. With dryRun it only
+// reports what would be removed. It returns 1 when something could not be
+// removed.
+func Clean(dryRun bool) int {
+	cfg, err := loadConfig()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", ui.FormatError(err.Error()))
+		return 1
+	}
+	blueprintDir, err := getBlueprintDir()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", ui.FormatError(err.Error()))
+		return 1
+	}
+
+	items := findCleanItems(blueprintDir, os.TempDir(), cfg.Clean, time.Now())
+	if len(items) == 0 {
+		fmt.Printf("%s\n", ui.FormatInfo("Nothing to clean"))
+		return 0
+	}
+	sort.SliceStable(items, func(i, j int) bool { return items[i].path < items[j].path })
+
+	rows := make([][]string, 0, len(items))
+	var reclaimed int64
+	exit := 0
+	for _, item := range items {
+		row := []string{ui.AbbreviateHome(item.path), item.kind}
+		if !dryRun {
+			if item.truncate {
+				err = truncateOutput(item.path, cfg.Clean.MaxOutput)
+			} else {
+				err = os.RemoveAll(item.path)
+			}
+			if err != nil {
+				rows = append(rows, append(row, ui.FormatError(err.Error())))
+				exit = 1
+				continue
+			}
+		}
+		reclaimed += item.size
+		rows = append(rows, append(row, formatBytes(item.size)))
+	}
+	for _, line := range ui.AlignColumns(rows) {
+		fmt.Printf("  %s\n", line)
+	}
+
+	if dryRun {
+		fmt.Printf("%s\n", ui.FormatInfo(fmt.Sprintf("Would reclaim %s (dry run)", formatBytes(reclaimed))))
+	} else {
+		fmt.Printf("%s\n", ui.FormatSuccess(fmt.Sprintf("Reclaimed %s", formatBytes(reclaimed))))
+	}
+	return exit
+}
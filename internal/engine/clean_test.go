@@ -0,0 +1,87 @@
+package engine
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFindCleanItems(t *testing.T) {
+	bpDir := t.TempDir()
+	tmpDir := t.TempDir()
+	now := time.Now()
+	old := now.Add(-48 * time.Hour)
+	age := func(path string, at time.Time) {
+		t.Helper()
+		if err := os.Chtimes(path, at, at); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	writeTestFile(t, filepath.Join(bpDir, "cache", "a", "blob"), "12345")
+	writeTestFile(t, filepath.Join(tmpDir, "blueprint-old", ".git", "HEAD"), "ref")
+	age(filepath.Join(tmpDir, "blueprint-old"), old)
+	writeTestFile(t, filepath.Join(tmpDir, "blueprint-new", ".git", "HEAD"), "ref")
+	writeTestFile(t, filepath.Join(tmpDir, "other-old", "x"), "x")
+	age(filepath.Join(tmpDir, "other-old"), old)
+	writeTestFile(t, filepath.Join(bpDir, "blueprint-sudoers-1"), "draft")
+	age(filepath.Join(bpDir, "blueprint-sudoers-1"), old)
+	writeTestFile(t, filepath.Join(bpDir, "trash", "old"), "x")
+	age(filepath.Join(bpDir, "trash", "old"), now.Add(-40*24*time.Hour))
+	writeTestFile(t, filepath.Join(bpDir, "trash", "recent"), "x")
+	writeTestFile(t, filepath.Join(bpDir, "history", "3", "0.output"), strings.Repeat("line\n", 100))
+	writeTestFile(t, filepath.Join(bpDir, "history", "3", "1.output"), "short\n")
+
+	items := findCleanItems(bpDir, tmpDir, CleanConfig{TempAge: 24 * time.Hour, TrashAge: 30 * 24 * time.Hour, MaxOutput: 100}, now)
+	got := map[string]string{}
+	for _, item := range items {
+		rel, _ := filepath.Rel(bpDir, item.path)
+		if strings.HasPrefix(item.path, tmpDir) {
+			rel, _ = filepath.Rel(tmpDir, item.path)
+			rel = "tmp/" + rel
+		}
+		got[rel] = item.kind
+	}
+	want := map[string]string{
+		"cache":                       "cache",
+		"tmp/blueprint-old":           "interrupted clone",
+		"blueprint-sudoers-1":         "sudoers draft",
+		filepath.Join("trash", "old"): "trash",
+		filepath.Join("history", "3", "0.output"): "history output",
+	}
+	if len(got) != len(want) {
+		t.Errorf("findCleanItems() = %v, want %v", got, want)
+	}
+	for path, kind := range want {
+		if got[path] != kind {
+			t.Errorf("%s: kind = %q, want %q", path, got[path], kind)
+		}
+	}
+	for _, item := range items {
+		if item.kind == "cache" && item.size != 5 {
+			t.Errorf("cache size = %d, want 5", item.size)
+		}
+	}
+
+	if items := findCleanItems(bpDir, tmpDir, CleanConfig{TempAge: 72 * time.Hour, TrashAge: 60 * 24 * time.Hour}, now); len(items) != 1 || items[0].kind != "cache" {
+		t.Errorf("with longer retention and no output limit, findCleanItems() = %+v, want only the cache", items)
+	}
+}
+
+func TestTruncateOutput(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "0.output")
+	writeTestFile(t, path, "first line\nsecond line\nthird line\n")
+
+	if err := truncateOutput(path, 15); err != nil {
+		t.Fatalf("truncateOutput() error: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := truncatedMarker + "third line\n"; string(data) != want {
+		t.Errorf("truncated output = %q, want %q", data, want)
+	}
+}
@@ -1,7 +1,9 @@
 package engine
 
 import (
+	"bytes"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"os/user"
@@ -14,6 +16,7 @@ import (
 	"github.com/elpic/blueprint/internal/logging"
 	"github.com/elpic/blueprint/internal/parser"
 	"github.com/elpic/blueprint/internal/ui"
+	"github.com/elpic/blueprint/internal/ui/timeutil"
 )
 
 // RealCommandExecutor implements platform.CommandExecutor for production use
@@ -63,8 +66,22 @@ func needsSudo(command string) bool {
 var sudoRunWithPassword = func(password, cmdStr string) (string, error) {
 	cmd := exec.Command("sh", "-c", "sudo -S "+cmdStr) // #nosec G204 -- user-supplied command from blueprint
 	cmd.Stdin = strings.NewReader(password + "\n")
-	output, err := cmd.CombinedOutput()
-	return string(output), err
+	return runStreaming(cmd)
+}
+
+// runStreaming runs cmd and returns its combined output. The output is
+// passed on to the status line of the apply as the command prints it, rather
+// than once it exits.
+func runStreaming(cmd *exec.Cmd) (string, error) {
+	var output bytes.Buffer
+	var w io.Writer = &output
+	if p := liveProgress; p != nil {
+		w = io.MultiWriter(&output, p)
+	}
+	cmd.Stdout = w
+	cmd.Stderr = w
+	err := cmd.Run()
+	return output.String(), err
 }
 
 func executeCommand(cmdStr string) (string, error) {
@@ -72,11 +89,20 @@ func executeCommand(cmdStr string) (string, error) {
 	needsShell := strings.ContainsAny(cmdStr, "|><&;$()~`")
 
 	// Check if sudo is needed
-	if needsSudo(cmdStr) {
+	if needsSudo(cmdStr) && privilegeTool() != handlerskg.PrivilegeSudo {
+		// doas and run0 take no password on stdin: they ask on the terminal
+		// themselves, unless they are set up not to
+		if noSudo && !privilegeWithoutPassword() {
+			return "", errNoSudo
+		}
+		cmdStr = handlerskg.EscalateCommand(cmdStr)
+	} else if needsSudo(cmdStr) {
 		// Check if user has passwordless sudo
-		if exec.Command("sudo", "-n", "true").Run() == nil {
+		if privilegeWithoutPassword() || sudoWithoutPassword(cmdStr) {
 			// User has passwordless sudo, use -n flag
 			cmdStr = "sudo -n " + cmdStr
+		} else if noSudo {
+			return "", errNoSudo
 		} else if sudoPassword, ok := passwordCache.get("sudo"); ok {
 			// Use cached sudo password if available
 			return sudoRunWithPassword(sudoPassword, cmdStr)
@@ -91,8 +117,7 @@ func executeCommand(cmdStr string) (string, error) {
 		cmd := exec.Command("sh", "-c", cmdStr)
 		// Explicitly set Stdin to nil to prevent blocking on input
 		cmd.Stdin = nil
-		output, err := cmd.CombinedOutput()
-		return string(output), err
+		return runStreaming(cmd)
 	}
 
 	// Parse command string into parts for direct execution
@@ -106,10 +131,7 @@ func executeCommand(cmdStr string) (string, error) {
 	// Explicitly set Stdin to nil to prevent blocking on input
 	cmd.Stdin = nil
 
-	// Capture output
-	output, err := cmd.CombinedOutput()
-
-	return string(output), err
+	return runStreaming(cmd)
 }
 
 // ruleResult holds the output of a single rule execution, keyed by its
@@ -118,30 +140,36 @@ type ruleResult struct {
 	globalIndex int             // 0-based position in the flattened sorted rules
 	record      ExecutionRecord // the execution record
 	output      string          // buffered terminal output (printed atomically)
+	followUps   []parser.Rule   // rules the handler emitted to apply next, see prepareFollowUps
 }
 
 // executeOneRule runs a single rule and returns the result without printing.
-// All output is captured into ruleResult.output for atomic flushing.
+// All output is captured into ruleResult.output for atomic flushing, headed
+// by number (e.g. "[3/12]"). When txn is set, the rule's file writes go to
+// txn's staging area.
 func executeOneRule(
 	rule parser.Rule,
 	globalIndex int,
-	totalRules int,
+	number string,
 	blueprint string,
 	osName string,
 	basePath string,
 	currentStatus *handlerskg.Status,
 	priorRecords []ExecutionRecord,
+	txn *transaction,
 ) ruleResult {
 	isUninstall := rule.Action == "uninstall"
 
 	var buf strings.Builder
-	fmt.Fprintf(&buf, "[%d/%d] %s", globalIndex+1, totalRules, ui.FormatHighlight(rule.Action))
+	fmt.Fprintf(&buf, "%s %s", number, ui.FormatHighlight(rule.Action))
 
 	var handler handlerskg.Handler
 	var output string
 	var execErr error
 	var actualCmd string
 	var durationMs int64
+	var followUps []parser.Rule
+	var ran bool
 
 	handler = handlerskg.NewHandler(rule, basePath, passwordCache.snapshot())
 
@@ -168,8 +196,9 @@ func executeOneRule(
 		if isUninstall {
 			if !handler.IsInstalled(currentStatus, blueprint, osName) {
 				output = "not installed"
-			} else {
-				output, execErr = handler.Down()
+			} else if execErr = checkNoSudo(rule, handler); execErr == nil {
+				output, execErr = runWithPolicy(rule, handler.Down)
+				ran = true
 			}
 		} else {
 			alwaysRun := false
@@ -178,8 +207,29 @@ func executeOneRule(
 			}
 			if !alwaysRun && handler.IsInstalled(currentStatus, blueprint, osName) {
 				output = "already installed"
+			} else if !alwaysRun && isSatisfied(handler) {
+				output = "already satisfied"
 			} else {
-				output, execErr = handler.Up()
+				runner := handler
+				execErr = checkNoSudo(rule, handler)
+				if execErr == nil && txn != nil {
+					runner, execErr = txn.handlerFor(rule, handler)
+				}
+				if execErr == nil {
+					output, execErr = runWithPolicy(rule, runner.Up)
+					ran = true
+				}
+				if txn != nil {
+					output = txn.finalPaths(output)
+				}
+			}
+		}
+		if execErr == nil && !isUninstall {
+			if provider, ok := handler.(handlerskg.FollowUpProvider); ok {
+				followUps, execErr = provider.FollowUpRules()
+				if execErr == nil {
+					followUps, execErr = prepareFollowUps(followUps, osName)
+				}
 			}
 		}
 		durationMs = time.Since(start).Milliseconds()
@@ -190,34 +240,84 @@ func executeOneRule(
 	}
 
 	record := ExecutionRecord{
-		Timestamp:  time.Now().Format(time.RFC3339),
+		Timestamp:  timeutil.Now(),
 		Blueprint:  blueprint,
 		OS:         osName,
 		Command:    actualCmd,
 		DurationMs: durationMs,
+		Cwd:        currentDir(),
+		Env:        environmentSummary(),
 		Output:     strings.TrimSpace(output),
+		Sensitive:  rule.Sensitive,
+		Group:      rule.Group,
 	}
 
 	if execErr != nil {
-		fmt.Fprintf(&buf, " %s\n", ui.FormatError("Failed"))
-		fmt.Fprintf(&buf, "       %s\n", ui.FormatError(execErr.Error()))
+		shown := execErr.Error()
+		if rule.Sensitive && !showSensitive {
+			shown = sensitivePlaceholder
+		}
+		fmt.Fprintf(&buf, " %s%s\n", ui.FormatError("Failed"), elapsedNote(durationMs))
+		fmt.Fprintf(&buf, "       %s\n", ui.FormatError(shown))
+		hint := handlerskg.RemediationHint(execErr.Error() + "\n" + output)
+		if hint != "" {
+			fmt.Fprintf(&buf, "       %s\n", ui.FormatDim("→ "+hint))
+		}
 		if logging.IsDebug() {
 			fmt.Fprintf(&buf, "       %s: %s\n", ui.FormatDim("Command"), ui.FormatInfo(actualCmd))
 		}
 		record.Status = "error"
 		record.Error = execErr.Error()
+		record.ExitCode = exitCodeOf(execErr)
+		record.Hint = hint
 	} else {
-		fmt.Fprintf(&buf, " %s\n", ui.FormatSuccess("Done"))
+		fmt.Fprintf(&buf, " %s%s\n", ui.FormatSuccess("Done"), elapsedNote(durationMs))
 		if logging.IsDebug() {
 			fmt.Fprintf(&buf, "       %s: %s\n", ui.FormatDim("Command"), ui.FormatInfo(actualCmd))
 		}
 		record.Status = "success"
+		record.Changed = ran
 	}
 
 	return ruleResult{
 		globalIndex: globalIndex,
 		record:      record,
 		output:      buf.String(),
+		followUps:   followUps,
+	}
+}
+
+// isSatisfied reports whether the system already holds what handler's rule
+// asks for, so Up can be skipped. A failed check runs the rule as usual.
+func isSatisfied(handler handlerskg.Handler) bool {
+	satisfied, err := handler.IsSatisfied()
+	if err != nil {
+		logging.Debugf("checking whether %T is satisfied: %v", handler, err)
+		return false
+	}
+	return satisfied
+}
+
+// notAttemptedResult builds the result for a rule skipped because the run
+// deadline passed. The command is still recorded so history shows what was left.
+func notAttemptedResult(rule parser.Rule, globalIndex int, number, blueprint, osName, basePath string) ruleResult {
+	var actualCmd string
+	if handler := handlerskg.NewHandler(rule, basePath, passwordCache.snapshot()); handler != nil {
+		actualCmd = handler.GetCommand()
+	}
+	output := fmt.Sprintf("%s %s %s\n", number, ui.FormatHighlight(rule.Action), ui.FormatDim("Not attempted (deadline exceeded)"))
+	return ruleResult{
+		globalIndex: globalIndex,
+		record: ExecutionRecord{
+			Timestamp: timeutil.Now(),
+			Blueprint: blueprint,
+			OS:        osName,
+			Command:   actualCmd,
+			Status:    statusNotAttempted,
+			Error:     "run deadline exceeded",
+			Group:     rule.Group,
+		},
+		output: output,
 	}
 }
 
@@ -225,11 +325,28 @@ func executeOneRule(
 // Independent rules (those without mutual after: dependencies) run in parallel
 // within the same "wave". Waves are executed sequentially.
 func executeRules(rules []parser.Rule, blueprint string, osName string, basePath string, runNumber int) []ExecutionRecord {
-	// Set up the handler package with our command executor
+	return executeRulesWithDeadline(rules, blueprint, osName, basePath, runNumber, time.Time{})
+}
+
+// statusNotAttempted marks a rule that was never started because the run
+// deadline passed before its turn came.
+const statusNotAttempted = "not attempted"
+
+// executeRulesWithDeadline is executeRules with a run deadline. Once the
+// deadline has passed no new rules are started: rules already running are
+// allowed to finish, and every rule after them is recorded as not attempted.
+// A zero deadline means no limit.
+func executeRulesWithDeadline(rules []parser.Rule, blueprint string, osName string, basePath string, runNumber int, deadline time.Time) []ExecutionRecord {
+	// Set up the handler package with our command executor, and the
+	// privilege tool the handlers run commands as root with
 	handlerskg.SetCommandExecutor(&RealCommandExecutor{})
+	privilegeTool()
+	// Lookups and index refreshes are shared by the rules of this run only
+	handlerskg.ResetRunCache()
 
 	// Load current status once — used for idempotency checks before Up()/Down()
-	currentStatus := loadCurrentStatus()
+	currentStatus, _ := loadCurrentStatus().SplitByMachine(machineID())
+	handlerskg.MigrateAliases(&currentStatus, rules, blueprint, osName)
 
 	// Sort rules by dependencies
 	sortedRules, err := resolveDependencies(rules)
@@ -243,13 +360,52 @@ func executeRules(rules []parser.Rule, blueprint string, osName string, basePath
 	// Group sorted rules into waves for parallel execution.
 	waves := groupIntoWaves(sortedRules)
 
+	// Records are indexed in wave order, which transactions need to follow.
+	var ordered []parser.Rule
+	for _, wave := range waves {
+		ordered = append(ordered, wave...)
+	}
+	txns := newTransactions(ordered)
+	numbers, headers := groupProgress(ordered)
+	stopProgress := startProgress()
+	trackRules(ordered)
+	// show prints the result of the rule at idx, under its group header
+	show := func(idx int, output string) {
+		printAboveProgress(func() {
+			if headers[idx] != "" {
+				fmt.Printf("\n%s\n", ui.FormatHighlight(headers[idx]))
+			}
+			fmt.Print(output)
+		})
+	}
+
+	// Rules whose dependencies failed are skipped rather than run against a
+	// half-configured machine. failedRoot maps each failed or skipped rule to
+	// the failure behind it.
+	graph := newDependencyGraph(ordered)
+	failedRoot := map[int]int{}
+
+	// A fallback (on-failure:) runs only when the rule it backs up failed,
+	// and the failure of a rule with a fallback is left for the fallback to
+	// settle: the rules after it also wait for the fallback.
+	fallbacks := fallbackPrimaries(ordered)
+	unneeded := map[int]bool{}
+	backedUp := func(idx int) bool {
+		for _, p := range fallbacks {
+			if p == idx {
+				return true
+			}
+		}
+		return false
+	}
+
 	// Write initial process state and ensure cleanup
 	psState := ProcessState{
 		PID:           os.Getpid(),
 		BlueprintFile: blueprint,
 		OS:            osName,
 		TotalRules:    totalRules,
-		StartedAt:     time.Now().Format(time.RFC3339),
+		StartedAt:     timeutil.Now(),
 	}
 	_ = writePSState(psState)
 	defer clearPSState()
@@ -258,36 +414,140 @@ func executeRules(rules []parser.Rule, blueprint string, osName string, basePath
 	records := make([]ExecutionRecord, totalRules)
 	globalIdx := 0 // tracks position in the flattened sorted order
 
-	for _, wave := range waves {
+	// noteFailure records a failed or skipped rule so its dependents are skipped.
+	noteFailure := func(idx int) {
+		switch records[idx].Status {
+		case "error":
+			if !backedUp(idx) {
+				failedRoot[idx] = idx
+			}
+		case statusSkipped:
+			if unneeded[idx] {
+				return
+			}
+			if root, ok := graph.failedDependency(idx, failedRoot); ok {
+				failedRoot[idx] = root
+			}
+		}
+	}
+
+	// Rules handlers emit to apply next join the run after the rules
+	// already in it; bases holds the directory each rule's relative paths
+	// resolve against, and depths how deep each rule's follow-ups nest.
+	var pending []followUpBatch
+	bases := make([]string, totalRules)
+	depths := make([]int, totalRules)
+	for i := range bases {
+		bases[i] = basePath
+	}
+	collect := func(idx int, res ruleResult) {
+		if len(res.followUps) > 0 {
+			pending = append(pending, followUpBatch{emitter: idx, rules: res.followUps})
+		}
+	}
+
+	// notNeeded returns the result of a fallback whose rule did not fail,
+	// nor was skipped for a failure of its own dependencies.
+	notNeeded := func(idx int) (ruleResult, bool) {
+		p, ok := fallbacks[idx]
+		if !ok || records[p].Status == "error" {
+			return ruleResult{}, false
+		}
+		if _, failed := failedRoot[p]; failed {
+			return ruleResult{}, false
+		}
+		unneeded[idx] = true
+		return fallbackNotNeededResult(ordered[idx], ordered[p], idx, numbers[idx], blueprint, osName, bases[idx]), true
+	}
+	// settleFallback records on the result of a fallback which rule it backs
+	// up, and on that rule which fallback made up for its failure.
+	settleFallback := func(idx int, res *ruleResult) {
+		p, ok := fallbacks[idx]
+		if !ok || unneeded[idx] {
+			return
+		}
+		res.record.FallbackFor = ruleLabel(ordered[p])
+		if res.record.Status == "success" {
+			records[p].SatisfiedBy = ruleLabel(ordered[idx])
+			res.output += fmt.Sprintf("       %s\n", ui.FormatDim("Stood in for "+ruleLabel(ordered[p])+", which failed"))
+		}
+	}
+
+	deadlineReported := false
+	runWave := func(wave []parser.Rule) {
+		if !deadline.IsZero() && !time.Now().Before(deadline) {
+			if !deadlineReported {
+				printAboveProgress(func() {
+					fmt.Printf("%s\n", ui.FormatError("Run deadline exceeded — remaining rules will not be attempted"))
+				})
+				deadlineReported = true
+			}
+			for _, rule := range wave {
+				res := notAttemptedResult(rule, globalIdx, numbers[globalIdx], blueprint, osName, bases[globalIdx])
+				show(globalIdx, res.output)
+				records[globalIdx] = res.record
+				ruleFinished(globalIdx, res.record)
+				globalIdx++
+			}
+			settleTransactions(txns, ordered, records, globalIdx-len(wave), globalIdx)
+			return
+		}
+
 		if len(wave) == 1 {
 			// Single rule — run directly, no goroutine overhead.
 			rule := wave[0]
 			idx := globalIdx
 			globalIdx++
 
+			if res, ok := notNeeded(idx); ok {
+				show(idx, res.output)
+				records[idx] = res.record
+				ruleFinished(idx, res.record)
+				settleTransactions(txns, ordered, records, idx, idx+1)
+				return
+			}
+			if root, ok := graph.failedDependency(idx, failedRoot); ok {
+				res := skippedResult(rule, ordered[root], idx, numbers[idx], blueprint, osName, bases[idx])
+				settleFallback(idx, &res)
+				show(idx, res.output)
+				records[idx] = res.record
+				ruleFinished(idx, res.record)
+				noteFailure(idx)
+				settleTransactions(txns, ordered, records, idx, idx+1)
+				return
+			}
+
 			// Update process state
 			psState.CurrentRule = idx + 1
 			psState.CurrentAction = rule.Action
 			psState.HandlerState = nil
-			handler := handlerskg.NewHandler(rule, basePath, passwordCache.snapshot())
+			handler := handlerskg.NewHandler(rule, bases[idx], passwordCache.snapshot())
 			if handler != nil {
 				if sp, ok := handler.(handlerskg.StateProvider); ok {
 					psState.HandlerState = sp.GetState(rule.Action == "uninstall")
 				}
 			}
-			psState.RuleStartedAt = time.Now().Format(time.RFC3339)
+			psState.RuleStartedAt = timeutil.Now()
 			_ = writePSState(psState)
 
-			res := executeOneRule(rule, idx, totalRules, blueprint, osName, basePath, &currentStatus, records[:idx])
-			fmt.Print(res.output)
+			ruleStarted(idx)
+			res := executeOneRule(rule, idx, numbers[idx], blueprint, osName, bases[idx], &currentStatus, records[:idx], txns[rule.Transaction])
+			settleFallback(idx, &res)
+			show(idx, res.output)
 			records[idx] = res.record
+			ruleFinished(idx, res.record)
+			noteFailure(idx)
+			collect(idx, res)
 
 			if runNumber > 0 {
-				if err := saveRuleOutput(runNumber, idx+1, res.record.Output, res.record.Error); err != nil {
+				stored := res.record.redacted()
+				if err := saveRuleOutput(runNumber, idx+1, stored.Output, stored.Error); err != nil {
 					fmt.Fprintf(os.Stderr, "Warning: failed to save rule output to history: %v\n", err)
 				}
 			}
-			continue
+			settleTransactions(txns, ordered, records, idx, idx+1)
+			printAboveProgress(refreshPackageCaches)
+			return
 		}
 
 		// Multiple rules in this wave — run in parallel.
@@ -298,34 +558,182 @@ func executeRules(rules []parser.Rule, blueprint string, osName string, basePath
 		results := make([]ruleResult, len(wave))
 		var wg sync.WaitGroup
 
+		var runnable []int
 		for wi, rule := range wave {
+			if res, ok := notNeeded(globalIdx + wi); ok {
+				results[wi] = res
+				continue
+			}
+			if root, ok := graph.failedDependency(globalIdx+wi, failedRoot); ok {
+				results[wi] = skippedResult(rule, ordered[root], globalIdx+wi, numbers[globalIdx+wi], blueprint, osName, bases[globalIdx+wi])
+				continue
+			}
+			runnable = append(runnable, wi)
+		}
+
+		// Rules sharing a concurrency class (apt, brew, ...) would fight over
+		// the package manager's lock, so each class runs as one serial lane.
+		classOf := func(rule parser.Rule) string {
+			return handlerskg.ConcurrencyClass(handlerskg.NewHandler(rule, basePath, passwordCache.snapshot()))
+		}
+		for _, lane := range groupIntoLanes(wave, runnable, classOf) {
 			wg.Add(1)
-			go func(wi int, rule parser.Rule, idx int) {
+			go func(lane []int) {
 				defer wg.Done()
-				results[wi] = executeOneRule(rule, idx, totalRules, blueprint, osName, basePath, &currentStatus, priorRecords)
-			}(wi, rule, globalIdx+wi)
+				for _, wi := range lane {
+					rule := wave[wi]
+					ruleStarted(globalIdx + wi)
+					results[wi] = executeOneRule(rule, globalIdx+wi, numbers[globalIdx+wi], blueprint, osName, bases[globalIdx+wi], &currentStatus, priorRecords, txns[rule.Transaction])
+					ruleFinished(globalIdx+wi, results[wi].record)
+				}
+			}(lane)
 		}
 		wg.Wait()
 
 		// Flush output and collect records in deterministic order.
 		for wi, res := range results {
 			idx := globalIdx + wi
-			fmt.Print(res.output)
+			settleFallback(idx, &res)
+			show(idx, res.output)
 			records[idx] = res.record
+			if res.record.Status == statusSkipped {
+				ruleFinished(idx, res.record)
+			}
+			noteFailure(idx)
+			collect(idx, res)
 
 			if runNumber > 0 {
-				if err := saveRuleOutput(runNumber, idx+1, res.record.Output, res.record.Error); err != nil {
+				stored := res.record.redacted()
+				if err := saveRuleOutput(runNumber, idx+1, stored.Output, stored.Error); err != nil {
 					fmt.Fprintf(os.Stderr, "Warning: failed to save rule output to history: %v\n", err)
 				}
 			}
 		}
+		settleTransactions(txns, ordered, records, globalIdx, globalIdx+len(wave))
+		printAboveProgress(refreshPackageCaches)
 
 		globalIdx += len(wave)
 	}
 
+	for _, wave := range waves {
+		runWave(wave)
+	}
+
+	for len(pending) > 0 {
+		batches := pending
+		pending = nil
+		added, addedBases, addedDepths := acceptFollowUps(batches, ordered, bases, depths, txns)
+		if len(added) == 0 {
+			continue
+		}
+		addedOrdered, err := executionOrder(added)
+		if err != nil {
+			fmt.Printf("%s\n", ui.FormatError(fmt.Sprintf("Follow-up rules: %v", err)))
+			break
+		}
+		// executionOrder reorders the rules; carry their bases and depths along
+		byKey := map[string]int{}
+		for i, rule := range added {
+			byKey[handlerskg.RuleKey(rule)] = i
+		}
+		for _, rule := range addedOrdered {
+			i := byKey[handlerskg.RuleKey(rule)]
+			bases = append(bases, addedBases[i])
+			depths = append(depths, addedDepths[i])
+		}
+
+		start := len(ordered)
+		ordered = append(ordered, addedOrdered...)
+		records = append(records, make([]ExecutionRecord, len(addedOrdered))...)
+		trackRules(addedOrdered)
+		for name, t := range newTransactions(addedOrdered) {
+			for i := range t.members {
+				t.members[i] += start
+			}
+			txns[name] = t
+		}
+		numbers, headers = groupProgress(ordered)
+		graph = newDependencyGraph(ordered)
+		fallbacks = fallbackPrimaries(ordered)
+		psState.TotalRules = len(ordered)
+
+		printAboveProgress(func() {
+			fmt.Printf("%s\n", ui.FormatInfo(fmt.Sprintf("Applying %d follow-up rule(s)", len(addedOrdered))))
+		})
+		for _, wave := range groupIntoWaves(addedOrdered) {
+			runWave(wave)
+		}
+		for idx := start; idx < len(ordered); idx++ {
+			rule := ordered[idx]
+			records[idx].followUp = &rule
+		}
+	}
+
+	stopProgress()
+	printSkippedDependents(ordered, failedRoot)
 	return records
 }
 
+// groupProgress returns, for rules in the order they run, the "[n/total]"
+// label each is printed with and the section header printed before it, if
+// any. When no rule has a group: rules are numbered across the whole run and
+// there are no headers. Otherwise each rule is numbered within its group, and
+// a header opens every stretch of rules from the same group; a group whose
+// rules are split up by dependencies gets a "continued" header when it
+// comes back.
+func groupProgress(ordered []parser.Rule) (numbers, headers []string) {
+	numbers = make([]string, len(ordered))
+	headers = make([]string, len(ordered))
+
+	totals := map[string]int{}
+	grouped := false
+	for _, r := range ordered {
+		totals[r.Group]++
+		grouped = grouped || r.Group != ""
+	}
+	if !grouped {
+		for i := range ordered {
+			numbers[i] = fmt.Sprintf("[%d/%d]", i+1, len(ordered))
+		}
+		return numbers, headers
+	}
+
+	seen := map[string]int{}
+	for i, r := range ordered {
+		seen[r.Group]++
+		numbers[i] = fmt.Sprintf("[%d/%d]", seen[r.Group], totals[r.Group])
+		if i > 0 && ordered[i-1].Group == r.Group {
+			continue
+		}
+		name := r.Group
+		if name == "" {
+			name = "ungrouped"
+		}
+		switch {
+		case seen[r.Group] > 1:
+			headers[i] = fmt.Sprintf("── %s (continued) ──", name)
+		case totals[r.Group] == 1:
+			headers[i] = fmt.Sprintf("── %s (1 rule) ──", name)
+		default:
+			headers[i] = fmt.Sprintf("── %s (%d rules) ──", name, totals[r.Group])
+		}
+	}
+	return numbers, headers
+}
+
+// refreshPackageCaches refreshes, once per package manager, the caches that
+// repo rules in the wave that just finished invalidated, before the next wave
+// installs from them.
+func refreshPackageCaches() {
+	for _, r := range handlerskg.RefreshPackageCaches() {
+		if r.Err != nil {
+			fmt.Printf("%s\n", ui.FormatError(fmt.Sprintf("Failed to refresh %s package cache: %v", r.Manager, r.Err)))
+			continue
+		}
+		fmt.Printf("       %s\n", ui.FormatDim(fmt.Sprintf("Refreshed %s package cache", r.Manager)))
+	}
+}
+
 func toHandlerRecords(records []ExecutionRecord) []handlerskg.ExecutionRecord {
 	out := make([]handlerskg.ExecutionRecord, len(records))
 	for i, r := range records {
@@ -345,9 +753,18 @@ func toHandlerRecords(records []ExecutionRecord) []handlerskg.ExecutionRecord {
 // clearSudoCache clears the sudo password cache on all operating systems
 // On Linux: runs 'sudo -K' to invalidate the sudo timestamp
 // On macOS: runs 'sudo -K' to invalidate the sudo timestamp
+// With doas: runs 'doas -L' to clear its persisted authentication
 func clearSudoCache() {
-	// Run sudo -K to clear the cached sudo session on all operating systems
-	cmd := exec.Command("sudo", "-K")
+	var cmd *exec.Cmd
+	switch privilegeTool() {
+	case handlerskg.PrivilegeSudo:
+		cmd = exec.Command("sudo", "-K")
+	case handlerskg.PrivilegeDoas:
+		cmd = exec.Command("doas", "-L")
+	default:
+		// run0 keeps no session of its own
+		return
+	}
 	// Ignore errors - this is a cleanup operation
 	_ = cmd.Run()
 }
@@ -2,8 +2,11 @@ package engine
 
 import (
 	"fmt"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	handlerskg "github.com/elpic/blueprint/internal/handlers"
 	"github.com/elpic/blueprint/internal/parser"
@@ -559,3 +562,96 @@ func TestToHandlerRecords_ErrorField(t *testing.T) {
 		t.Errorf("Error not preserved: got %q, want %q", result[0].Error, "command failed with exit code 1")
 	}
 }
+
+func TestExecuteRulesWithDeadline_PastDeadlineSkipsAllRules(t *testing.T) {
+	mockExecutor := mocks.NewMockCommandExecutor().WithDefaultSuccess("success")
+	originalExecutor := getCurrentCommandExecutor()
+	defer restoreCommandExecutor(originalExecutor)
+	handlerskg.SetCommandExecutor(mockExecutor)
+
+	rules := []parser.Rule{
+		{ID: "a", Action: "mkdir", Mkdir: t.TempDir() + "/a"},
+		{ID: "b", Action: "mkdir", Mkdir: t.TempDir() + "/b", After: []string{"a"}},
+	}
+
+	records := executeRulesWithDeadline(rules, "/tmp/test.bp", "linux", "/tmp", 0, time.Now().Add(-time.Second))
+	if len(records) != 2 {
+		t.Fatalf("expected 2 records, got %d", len(records))
+	}
+	for i, r := range records {
+		if r.Status != statusNotAttempted {
+			t.Errorf("record %d status = %q, want %q", i, r.Status, statusNotAttempted)
+		}
+		if r.Command == "" {
+			t.Errorf("record %d should still record the command it would have run", i)
+		}
+	}
+}
+
+func TestExecuteRulesWithDeadline_ZeroDeadlineRunsRules(t *testing.T) {
+	mockExecutor := mocks.NewMockCommandExecutor().WithDefaultSuccess("success")
+	originalExecutor := getCurrentCommandExecutor()
+	defer restoreCommandExecutor(originalExecutor)
+	handlerskg.SetCommandExecutor(mockExecutor)
+
+	dir := t.TempDir() + "/made"
+	rules := []parser.Rule{{ID: "a", Action: "mkdir", Mkdir: dir}}
+
+	records := executeRulesWithDeadline(rules, "/tmp/test.bp", "linux", "/tmp", 0, time.Time{})
+	if len(records) != 1 {
+		t.Fatalf("expected 1 record, got %d", len(records))
+	}
+	if records[0].Status == statusNotAttempted {
+		t.Errorf("rule should have been attempted with no deadline")
+	}
+}
+
+func TestGroupProgress(t *testing.T) {
+	t.Run("no groups numbers the whole run", func(t *testing.T) {
+		numbers, headers := groupProgress([]parser.Rule{{Action: "run"}, {Action: "run"}})
+		if strings.Join(numbers, " ") != "[1/2] [2/2]" || strings.Join(headers, "") != "" {
+			t.Errorf("groupProgress() = %q, %q", numbers, headers)
+		}
+	})
+
+	t.Run("numbers within groups and heads each stretch", func(t *testing.T) {
+		ordered := []parser.Rule{
+			{Action: "install", Group: "base"},
+			{Action: "install", Group: "base"},
+			{Action: "clone", Group: "dotfiles"},
+			{Action: "run"},
+			{Action: "mkdir", Group: "dotfiles"},
+		}
+		numbers, headers := groupProgress(ordered)
+		wantNumbers := []string{"[1/2]", "[2/2]", "[1/2]", "[1/1]", "[2/2]"}
+		wantHeaders := []string{"── base (2 rules) ──", "", "── dotfiles (2 rules) ──", "── ungrouped (1 rule) ──", "── dotfiles (continued) ──"}
+		if strings.Join(numbers, "|") != strings.Join(wantNumbers, "|") {
+			t.Errorf("numbers = %q, want %q", numbers, wantNumbers)
+		}
+		if strings.Join(headers, "|") != strings.Join(wantHeaders, "|") {
+			t.Errorf("headers = %q, want %q", headers, wantHeaders)
+		}
+	})
+}
+
+func TestExecuteRulesSkipsSatisfiedRule(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	dir := t.TempDir()
+	created := filepath.Join(dir, "created")
+	if err := os.WriteFile(created, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	ran := filepath.Join(dir, "ran")
+
+	rules := []parser.Rule{{ID: "setup", Action: "run", RunCommand: "touch " + ran, RunCreates: created}}
+	records := executeRules(rules, "/tmp/test.bp", "linux", "/tmp", 0)
+	if len(records) != 1 {
+		t.Fatalf("expected 1 record, got %d", len(records))
+	}
+	if records[0].Status != "success" || records[0].Output != "already satisfied" || records[0].Changed {
+		t.Errorf("record = %+v, want a success that changed nothing", records[0])
+	}
+	if _, err := os.Stat(ran); err == nil {
+		t.Error("the rule ran although what it creates already exists")
+	}
+}
@@ -0,0 +1,172 @@
+package engine
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	gitpkg "github.com/elpic/blueprint/internal/git"
+	handlerskg "github.com/elpic/blueprint/internal/handlers"
+	"github.com/elpic/blueprint/internal/logging"
+	"github.com/elpic/blueprint/internal/parser"
+)
+
+// blueprintSource is one of the blueprints applied together in a run. Each
+// keeps its own identity in status, so applying work.bp and personal.bp in
+// one run records the same as applying them one after the other.
+type blueprintSource struct {
+	file  string // as given on the command line, the blueprint's identity in status and history
+	path  string // the file parsed, inside a temporary clone for git blueprints
+	sha   string // commit of a git blueprint
+	rules []parser.Rule
+}
+
+// loadBlueprints resolves and parses the blueprints of a run and
+// interpolates the variables of each with its own defaults. The returned
+// cleanup removes the temporary clones of git blueprints.
+func loadBlueprints(files []string, dry, preferSSH bool, cliVars map[string]string) ([]blueprintSource, func(), error) {
+	var cleanups []func()
+	cleanup := func() {
+		for _, c := range cleanups {
+			c()
+		}
+	}
+
+	overrides, err := withMachineVars(cliVars)
+	if err != nil {
+		return nil, cleanup, err
+	}
+
+	var sources []blueprintSource
+	for _, file := range files {
+		logging.Debugf("resolving blueprint file: %s", file)
+		setupPath, sha, clean, err := resolveBlueprintFile(file, dry, preferSSH)
+		if err != nil {
+			return nil, cleanup, err
+		}
+		cleanups = append(cleanups, clean)
+		logging.Debugf("blueprint resolved: %s", setupPath)
+
+		// ParseFile handles includes in local files and git repositories alike
+		rules, err := parser.ParseFile(setupPath)
+		if err != nil {
+			if len(files) > 1 {
+				err = fmt.Errorf("%s: %w", file, err)
+			}
+			return nil, cleanup, fmt.Errorf("parse error: %w", err)
+		}
+
+		// Interpolate ${VAR_NAME} before any further processing so that paths
+		// like ${WORKSPACE}/repo are resolved consistently everywhere — OS
+		// filtering, skip/only flags, auto-uninstall comparisons, execution,
+		// and status saving all see the same expanded values.
+		vars := resolveVarMap(rules, overrides)
+		for i, r := range rules {
+			rules[i] = interpolateRule(r, vars)
+		}
+		sources = append(sources, blueprintSource{file: file, path: setupPath, sha: sha, rules: rules})
+	}
+
+	// Addresses come from all the rules of the run, so --skip-id and --only
+	// name one rule even when two blueprints declare the same resource, and a
+	// rule keeps its address on every OS
+	var all []parser.Rule
+	for _, s := range sources {
+		all = append(all, s.rules...)
+	}
+	handlerskg.SetRuleAddresses(all)
+	start := 0
+	for i := range sources {
+		end := start + len(sources[i].rules)
+		sources[i].rules = all[start:end:end]
+		start = end
+	}
+	return sources, cleanup, nil
+}
+
+// runLabel names the blueprints of a run in output, reports and history.
+func runLabel(sources []blueprintSource) string {
+	files := make([]string, len(sources))
+	for i, s := range sources {
+		files[i] = s.file
+	}
+	return strings.Join(files, ", ")
+}
+
+// combinedRules returns the rules of every blueprint of the run, in order.
+func combinedRules(sources []blueprintSource) []parser.Rule {
+	var rules []parser.Rule
+	for _, s := range sources {
+		rules = append(rules, s.rules...)
+	}
+	return rules
+}
+
+// ruleOwners maps the key of each rule of a run to the blueprint that
+// declares it, the first one when several do. uninstalls maps each source
+// file to its auto-uninstall rules.
+func ruleOwners(sources []blueprintSource, uninstalls map[string][]parser.Rule, osName string) map[string]string {
+	owner := map[string]string{}
+	for _, s := range sources {
+		declared := append(filterRulesFor(s.rules, osName, getArchName()), uninstalls[s.file]...)
+		for _, rule := range declared {
+			key := handlerskg.RuleKey(rule)
+			if _, ok := owner[key]; !ok {
+				owner[key] = s.file
+			}
+		}
+	}
+	return owner
+}
+
+// attributeRecords sets the blueprint of each execution record of a run of
+// several blueprints to the one that declared its rule; a rule declared by
+// more than one is recorded under the first. rules are the rules that were
+// executed and uninstalls maps each source file to its auto-uninstall rules.
+func attributeRecords(records []ExecutionRecord, rules []parser.Rule, sources []blueprintSource, uninstalls map[string][]parser.Rule, osName string) {
+	owner := ruleOwners(sources, uninstalls, osName)
+	ordered, err := runRules(rules, records)
+	if err != nil || len(ordered) != len(records) {
+		return
+	}
+	for i, rule := range ordered {
+		if file, ok := owner[handlerskg.RuleKey(rule)]; ok {
+			records[i].Blueprint = file
+		}
+	}
+}
+
+// ReadManifest returns the blueprints listed in a manifest file, one per
+// line. Blank lines and lines starting with # are ignored, and relative
+// paths are resolved against the manifest's directory.
+func ReadManifest(path string) ([]string, error) {
+	data, err := os.ReadFile(path) // #nosec G304 -- manifest named on the command line
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest: %w", err)
+	}
+	var files []string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if !gitpkg.IsGitURL(line) {
+			line = expandHomedir(line)
+			if !filepath.IsAbs(line) {
+				line = filepath.Join(filepath.Dir(path), line)
+			}
+		}
+		files = append(files, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read manifest: %w", err)
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("manifest %s lists no blueprints", path)
+	}
+	return files, nil
+}
@@ -0,0 +1,123 @@
+package engine
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/elpic/blueprint/internal/parser"
+)
+
+func TestLoadBlueprints(t *testing.T) {
+	orig := machineVarsFiles
+	t.Cleanup(func() { machineVarsFiles = orig })
+	machineVarsFiles = func() []string { return nil }
+
+	dir := t.TempDir()
+	work := filepath.Join(dir, "work.bp")
+	personal := filepath.Join(dir, "personal.bp")
+	if err := os.WriteFile(work, []byte("var DIR = ~/work\nmkdir ${DIR}\ninstall curl\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(personal, []byte("var DIR = ~/personal\nmkdir ${DIR}\ninstall curl\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	sources, cleanup, err := loadBlueprints([]string{work, personal}, true, false, nil)
+	defer cleanup()
+	if err != nil {
+		t.Fatalf("loadBlueprints() error = %v", err)
+	}
+	if len(sources) != 2 || sources[0].file != work || sources[1].file != personal {
+		t.Fatalf("loadBlueprints() = %+v", sources)
+	}
+	if got := sources[1].rules[1].Mkdir; got != "~/personal" {
+		t.Errorf("personal.bp mkdir = %q, want its own ~/personal", got)
+	}
+
+	var addresses []string
+	for _, r := range combinedRules(sources) {
+		addresses = append(addresses, r.Address)
+	}
+	want := []string{"var.DIR", "mkdir.~/work", "install.curl", "var.DIR#2", "mkdir.~/personal", "install.curl#2"}
+	if !slices.Equal(addresses, want) {
+		t.Errorf("addresses = %v, want %v", addresses, want)
+	}
+	if label := runLabel(sources); label != work+", "+personal {
+		t.Errorf("runLabel() = %q", label)
+	}
+
+	if _, _, err := loadBlueprints([]string{work, filepath.Join(dir, "missing.bp")}, true, false, nil); err == nil {
+		t.Error("expected a missing blueprint to fail the run")
+	}
+}
+
+func TestAttributeRecords(t *testing.T) {
+	sources := []blueprintSource{
+		{file: "work.bp", rules: []parser.Rule{{Action: "mkdir", Mkdir: "~/work"}, {Action: "mkdir", Mkdir: "~/shared"}}},
+		{file: "personal.bp", rules: []parser.Rule{{Action: "mkdir", Mkdir: "~/shared"}, {Action: "mkdir", Mkdir: "~/photos"}}},
+	}
+	uninstall := parser.Rule{Action: "uninstall", Mkdir: "~/old"}
+	rules := append(filterRulesByOS(combinedRules(sources)), uninstall)
+	records := make([]ExecutionRecord, len(rules))
+	for i := range records {
+		records[i].Blueprint = "work.bp, personal.bp"
+	}
+
+	attributeRecords(records, rules, sources, map[string][]parser.Rule{"personal.bp": {uninstall}}, getOSName())
+
+	ordered, err := executionOrder(rules)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"~/work": "work.bp", "~/shared": "work.bp", "~/photos": "personal.bp", "~/old": "personal.bp"}
+	for i, rule := range ordered {
+		if records[i].Blueprint != want[rule.Mkdir] {
+			t.Errorf("record of %s %s = %q, want %q", rule.Action, rule.Mkdir, records[i].Blueprint, want[rule.Mkdir])
+		}
+	}
+}
+
+func TestReadManifest(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	dir := t.TempDir()
+	path := filepath.Join(dir, "laptop.txt")
+	manifest := "# blueprints of the laptop\n" +
+		"work.bp\n" +
+		"\n" +
+		"  ~/dotfiles/personal.bp  \n" +
+		"/srv/base.bp\n" +
+		"https://github.com/me/setup.git\n" +
+		"@github:me/setup\n"
+	if err := os.WriteFile(path, []byte(manifest), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := ReadManifest(path)
+	if err != nil {
+		t.Fatalf("ReadManifest() error = %v", err)
+	}
+	want := []string{
+		filepath.Join(dir, "work.bp"),
+		filepath.Join(home, "dotfiles", "personal.bp"),
+		"/srv/base.bp",
+		"https://github.com/me/setup.git",
+		"@github:me/setup",
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("ReadManifest() = %q, want %q", got, want)
+	}
+
+	empty := filepath.Join(dir, "empty.txt")
+	if err := os.WriteFile(empty, []byte("# nothing yet\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadManifest(empty); err == nil {
+		t.Error("expected a manifest without blueprints to be rejected")
+	}
+	if _, err := ReadManifest(filepath.Join(dir, "missing.txt")); err == nil {
+		t.Error("expected a missing manifest to be rejected")
+	}
+}
@@ -0,0 +1,365 @@
+package engine
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	handlerskg "github.com/elpic/blueprint/internal/handlers"
+	"github.com/elpic/blueprint/internal/parser"
+)
+
+// Config is the user configuration in ~/.blueprint/config.
+//
+// The file is INI-style: "[section]" headers, "key = value" lines and "#"
+// comments. [pins] maps a remote blueprint to the sha256 its content must
+// have, [clean] sets what `blueprint clean` removes, [security] how the
+// installers apply downloads are checked and whether the machine is
+// read-only, [stats] whether apply keeps usage stats for `blueprint stats`,
+// [state] where status and history are stored, [history] how many runs
+// apply keeps in the history and [privilege] which tool runs the commands
+// that need root:
+//
+//	[pins]
+//	github.com/me/dotfiles@main:setup.bp = sha256:3f2a...
+//
+//	[clean]
+//	temp-age = 24h
+//	trash-age = 30d
+//	max-output = 1M
+//
+//	[security]
+//	forbid-remote-scripts = true
+//	asdf-version = 0.16.7
+//	asdf-sha256 = sha256:8b1e...
+//	homebrew-install-ref = 4.4.0
+//	homebrew-install-sha256 = sha256:9c2d...
+//	read-only = true
+//
+//	[stats]
+//	enabled = true
+//
+//	[state]
+//	backend = sqlite
+//
+//	[history]
+//	keep = 200
+//	max-age = 90d
+//
+//	[privilege]
+//	tool = doas
+type Config struct {
+	Pins     parser.Pins
+	Clean    CleanConfig
+	Security handlerskg.RemoteInstallPolicy
+	// ReadOnly blocks the commands that change the machine (see ReadOnlyReason).
+	ReadOnly bool
+	// Stats turns on the local usage stats file; it is off unless enabled.
+	Stats bool
+	// StateBackend is where status and history are kept: "json" (the
+	// default) or "sqlite" (see openStateStore).
+	StateBackend string
+	// History is the retention apply enforces after saving each run.
+	History HistoryRetention
+	// PrivilegeTool runs the commands that need root: sudo, doas or run0.
+	// Empty or "auto" uses the first of them installed.
+	PrivilegeTool string
+}
+
+// CleanConfig is the retention `blueprint clean` applies.
+type CleanConfig struct {
+	// TempAge is how old a temporary clone or staging directory must be
+	// before it is considered left over from an interrupted run.
+	TempAge time.Duration
+	// TrashAge is how long entries stay in ~/.blueprint/trash.
+	TrashAge time.Duration
+	// MaxOutput is the size history outputs are cut down to; 0 keeps them whole.
+	MaxOutput int64
+}
+
+// defaultCleanConfig is the retention used for keys the config leaves out.
+var defaultCleanConfig = CleanConfig{
+	TempAge:   24 * time.Hour,
+	TrashAge:  30 * 24 * time.Hour,
+	MaxOutput: 1 << 20,
+}
+
+func init() {
+	parser.RemoteHook = verifyConfigPin
+}
+
+// configPath returns the path of the user configuration file.
+func configPath() (string, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %w", err)
+	}
+	return filepath.Join(homeDir, ".blueprint", "config"), nil
+}
+
+// loadConfig reads ~/.blueprint/config. A missing file is an empty config
+// with the default retention.
+func loadConfig() (Config, error) {
+	path, err := configPath()
+	if err != nil {
+		return Config{}, err
+	}
+	f, err := os.Open(path) // #nosec G304 -- fixed path under the user's home
+	if os.IsNotExist(err) {
+		return Config{Clean: defaultCleanConfig}, nil
+	}
+	if err != nil {
+		return Config{}, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	defer func() { _ = f.Close() }()
+
+	cfg, err := parseConfig(bufio.NewScanner(f))
+	if err != nil {
+		return Config{}, fmt.Errorf("%s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+func parseConfig(scanner *bufio.Scanner) (Config, error) {
+	cfg := Config{Pins: parser.Pins{}, Clean: defaultCleanConfig}
+	section := ""
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = strings.TrimSpace(line[1 : len(line)-1])
+			continue
+		}
+		// Keys are URLs, which may contain "=" in a query; checksums never do
+		idx := strings.LastIndex(line, "=")
+		if idx < 0 {
+			return Config{}, fmt.Errorf("line %d: expected key = value", lineNum)
+		}
+		key := unquote(strings.TrimSpace(line[:idx]))
+		value := unquote(strings.TrimSpace(line[idx+1:]))
+
+		switch section {
+		case "pins":
+			sum, err := parser.ParseSHA256(value)
+			if err != nil {
+				return Config{}, fmt.Errorf("line %d: %w", lineNum, err)
+			}
+			cfg.Pins[parser.PinKey(key)] = sum
+		case "clean":
+			if err := setCleanKey(&cfg.Clean, key, value); err != nil {
+				return Config{}, fmt.Errorf("line %d: %w", lineNum, err)
+			}
+		case "security":
+			if key == "read-only" {
+				readOnly, err := strconv.ParseBool(value)
+				if err != nil {
+					return Config{}, fmt.Errorf("line %d: read-only: %w", lineNum, err)
+				}
+				cfg.ReadOnly = readOnly
+				continue
+			}
+			if err := setSecurityKey(&cfg.Security, key, value); err != nil {
+				return Config{}, fmt.Errorf("line %d: %w", lineNum, err)
+			}
+		case "stats":
+			if key != "enabled" {
+				return Config{}, fmt.Errorf("line %d: unknown stats key %q", lineNum, key)
+			}
+			enabled, err := strconv.ParseBool(value)
+			if err != nil {
+				return Config{}, fmt.Errorf("line %d: enabled: %w", lineNum, err)
+			}
+			cfg.Stats = enabled
+		case "state":
+			if key != "backend" {
+				return Config{}, fmt.Errorf("line %d: unknown state key %q", lineNum, key)
+			}
+			if value != stateBackendJSON && value != stateBackendSQLite {
+				return Config{}, fmt.Errorf("line %d: backend: want %s or %s, got %q", lineNum, stateBackendJSON, stateBackendSQLite, value)
+			}
+			if value == stateBackendSQLite && !sqliteSupported {
+				return Config{}, fmt.Errorf("line %d: backend: this blueprint is built without cgo, which the sqlite backend needs", lineNum)
+			}
+			cfg.StateBackend = value
+		case "history":
+			if err := setHistoryKey(&cfg.History, key, value); err != nil {
+				return Config{}, fmt.Errorf("line %d: %w", lineNum, err)
+			}
+		case "privilege":
+			if key != "tool" {
+				return Config{}, fmt.Errorf("line %d: unknown privilege key %q", lineNum, key)
+			}
+			if value != "auto" && !slices.Contains(handlerskg.PrivilegeTools, value) {
+				return Config{}, fmt.Errorf("line %d: tool: want auto, %s, got %q", lineNum, strings.Join(handlerskg.PrivilegeTools, ", "), value)
+			}
+			cfg.PrivilegeTool = value
+		default:
+			return Config{}, fmt.Errorf("line %d: unknown section %q", lineNum, section)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return Config{}, err
+	}
+	// A checksum only holds for one release
+	if cfg.Security.AsdfSHA256 != "" && cfg.Security.AsdfVersion == "" {
+		return Config{}, fmt.Errorf("asdf-sha256 needs asdf-version")
+	}
+	return cfg, nil
+}
+
+// setCleanKey sets one key of the [clean] section.
+func setCleanKey(c *CleanConfig, key, value string) error {
+	var err error
+	switch key {
+	case "temp-age":
+		c.TempAge, err = ParseAge(value)
+	case "trash-age":
+		c.TrashAge, err = ParseAge(value)
+	case "max-output":
+		c.MaxOutput, err = parseByteSize(value)
+	default:
+		return fmt.Errorf("unknown clean key %q", key)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", key, err)
+	}
+	return nil
+}
+
+// setHistoryKey sets one key of the [history] section.
+func setHistoryKey(r *HistoryRetention, key, value string) error {
+	var err error
+	switch key {
+	case "keep":
+		r.Keep, err = strconv.Atoi(value)
+		if err == nil && r.Keep < 1 {
+			err = fmt.Errorf("must be at least 1, got %d", r.Keep)
+		}
+	case "max-age":
+		r.MaxAge, err = ParseAge(value)
+	default:
+		return fmt.Errorf("unknown history key %q", key)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", key, err)
+	}
+	return nil
+}
+
+// releaseRef matches a version, tag or commit in an installer URL.
+var releaseRef = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// setSecurityKey sets one key of the [security] section.
+func setSecurityKey(p *handlerskg.RemoteInstallPolicy, key, value string) error {
+	var err error
+	switch key {
+	case "forbid-remote-scripts":
+		p.ForbidRemoteScripts, err = strconv.ParseBool(value)
+	case "asdf-version":
+		p.AsdfVersion = value
+		if !releaseRef.MatchString(value) {
+			err = fmt.Errorf("invalid version %q", value)
+		}
+	case "asdf-sha256":
+		p.AsdfSHA256, err = parser.ParseSHA256(value)
+	case "homebrew-install-ref":
+		p.HomebrewInstallRef = value
+		if !releaseRef.MatchString(value) {
+			err = fmt.Errorf("invalid commit or tag %q", value)
+		}
+	case "homebrew-install-sha256":
+		p.HomebrewInstallSHA256, err = parser.ParseSHA256(value)
+	default:
+		return fmt.Errorf("unknown security key %q", key)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", key, err)
+	}
+	return nil
+}
+
+// ParseAge parses a positive duration such as 12h or 30d, as the config and
+// --older-than of `blueprint history prune` take it.
+func ParseAge(s string) (time.Duration, error) {
+	var d time.Duration
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration %q", s)
+		}
+		d = time.Duration(n) * 24 * time.Hour
+	} else {
+		var err error
+		if d, err = time.ParseDuration(s); err != nil {
+			return 0, fmt.Errorf("invalid duration %q", s)
+		}
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("duration must be positive, got %q", s)
+	}
+	return d, nil
+}
+
+// parseByteSize parses a size such as 512K, 1M or 2G (powers of 1024) or a
+// plain number of bytes.
+func parseByteSize(s string) (int64, error) {
+	num := strings.TrimSuffix(strings.TrimSuffix(strings.ToUpper(s), "B"), "I")
+	shift := 0
+	switch {
+	case strings.HasSuffix(num, "K"):
+		shift = 10
+	case strings.HasSuffix(num, "M"):
+		shift = 20
+	case strings.HasSuffix(num, "G"):
+		shift = 30
+	}
+	if shift > 0 {
+		num = num[:len(num)-1]
+	}
+	n, err := strconv.ParseInt(strings.TrimSpace(num), 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return n << shift, nil
+}
+
+func unquote(s string) string {
+	if len(s) >= 2 && (s[0] == '"' || s[0] == '\'') && s[len(s)-1] == s[0] {
+		return s[1 : len(s)-1]
+	}
+	return s
+}
+
+// verifyConfigPin checks content, fetched from the remote blueprint source,
+// against its pin in ~/.blueprint/config. Sources without a pin pass.
+func verifyConfigPin(source string, content []byte) error {
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	want, ok := cfg.Pins[parser.PinKey(source)]
+	if !ok {
+		return nil
+	}
+	return parser.VerifyPin(source, want, content)
+}
+
+// verifyRemoteBlueprint checks the setup file fetched for a remote blueprint
+// against the pins of ~/.blueprint/config before anything reads it.
+func verifyRemoteBlueprint(source, setupPath string) error {
+	content, err := os.ReadFile(setupPath) // #nosec G304 -- setup file of a cloned blueprint
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", setupPath, err)
+	}
+	return verifyConfigPin(source, content)
+}
@@ -0,0 +1,177 @@
+package engine
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	handlerskg "github.com/elpic/blueprint/internal/handlers"
+	"github.com/elpic/blueprint/internal/parser"
+)
+
+func TestLoadConfigPins(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	cfg, err := loadConfig()
+	if err != nil || len(cfg.Pins) != 0 {
+		t.Fatalf("loadConfig() without a file = %+v, %v; want an empty config", cfg, err)
+	}
+
+	sum := sha256.Sum256([]byte("install git\n"))
+	hexSum := hex.EncodeToString(sum[:])
+	writeTestFile(t, filepath.Join(home, ".blueprint", "config"), `# pinned upstreams
+[pins]
+github.com/acme/setup@main:setup.bp = sha256:`+hexSum+`
+"https://github.com/acme/other.git" = '`+strings.ToUpper(hexSum)+`'
+`)
+	cfg, err = loadConfig()
+	if err != nil {
+		t.Fatalf("loadConfig() error: %v", err)
+	}
+	if cfg.Pins[parser.PinKey("@github:acme/setup@main")] != hexSum || cfg.Pins[parser.PinKey("@github:acme/other")] != hexSum {
+		t.Errorf("Pins = %v", cfg.Pins)
+	}
+
+	if err := verifyConfigPin("git@github.com:acme/setup.git@main", []byte("install git\n")); err != nil {
+		t.Errorf("verifyConfigPin() of pinned content error: %v", err)
+	}
+	if err := verifyConfigPin("@github:acme/setup@main", []byte("changed\n")); err == nil || !strings.Contains(err.Error(), hexSum) {
+		t.Errorf("verifyConfigPin() error = %v, want a mismatch naming the pin", err)
+	}
+	if err := verifyConfigPin("@github:acme/setup@dev", []byte("changed\n")); err != nil {
+		t.Errorf("another branch is not pinned, got %v", err)
+	}
+}
+
+func TestLoadConfigErrors(t *testing.T) {
+	for _, content := range []string{
+		"[pins]\ngithub.com/acme/setup = sha256:abc\n",
+		"[pins]\ngithub.com/acme/setup\n",
+		"[other]\nkey = value\n",
+		"[clean]\ntemp-age = soon\n",
+		"[clean]\nkeep = 3\n",
+		"[security]\nforbid-remote-scripts = maybe\n",
+		"[security]\nhomebrew-install-ref = ../main\n",
+		"[stats]\nenabled = maybe\n",
+		"[stats]\nupload = true\n",
+		"[state]\nbackend = postgres\n",
+		"[state]\npath = /tmp/state.db\n",
+		"[history]\nkeep = 0\n",
+		"[history]\nmax-age = forever\n",
+		"[privilege]\ntool = su\n",
+		"[privilege]\nuser = root\n",
+	} {
+		home := t.TempDir()
+		t.Setenv("HOME", home)
+		writeTestFile(t, filepath.Join(home, ".blueprint", "config"), content)
+		if _, err := loadConfig(); err == nil || !strings.Contains(err.Error(), "line 2") {
+			t.Errorf("loadConfig(%q) error = %v, want a line 2 error", content, err)
+		}
+		// A broken config must not let a remote blueprint through unchecked
+		if err := verifyConfigPin("@github:acme/setup", nil); err == nil {
+			t.Errorf("verifyConfigPin() with config %q should fail", content)
+		}
+	}
+}
+
+func TestLoadConfigState(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	cfg, err := loadConfig()
+	if err != nil || cfg.StateBackend != "" {
+		t.Fatalf("loadConfig() without a file = %+v, %v; want the default backend", cfg, err)
+	}
+	writeTestFile(t, filepath.Join(home, ".blueprint", "config"), "[state]\nbackend = sqlite\n")
+	cfg, err = loadConfig()
+	if !sqliteSupported {
+		if err == nil || !strings.Contains(err.Error(), "cgo") {
+			t.Errorf("loadConfig() without cgo = %+v, %v; want the sqlite backend rejected", cfg, err)
+		}
+		return
+	}
+	if err != nil || cfg.StateBackend != stateBackendSQLite {
+		t.Errorf("loadConfig() = %+v, %v; want the sqlite backend", cfg, err)
+	}
+}
+
+func TestLoadConfigPrivilege(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	writeTestFile(t, filepath.Join(home, ".blueprint", "config"), "[privilege]\ntool = doas\n")
+	if cfg, err := loadConfig(); err != nil || cfg.PrivilegeTool != "doas" {
+		t.Errorf("loadConfig() = %+v, %v; want doas", cfg, err)
+	}
+}
+
+func TestLoadConfigHistory(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	writeTestFile(t, filepath.Join(home, ".blueprint", "config"), "[history]\nkeep = 50\nmax-age = 90d\n")
+	cfg, err := loadConfig()
+	if err != nil {
+		t.Fatalf("loadConfig() error: %v", err)
+	}
+	want := HistoryRetention{Keep: 50, MaxAge: 90 * 24 * time.Hour}
+	if cfg.History != want {
+		t.Errorf("History = %+v, want %+v", cfg.History, want)
+	}
+}
+
+func TestLoadConfigClean(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	cfg, err := loadConfig()
+	if err != nil || cfg.Clean != defaultCleanConfig {
+		t.Fatalf("loadConfig() without a file = %+v, %v; want the default retention", cfg.Clean, err)
+	}
+
+	writeTestFile(t, filepath.Join(home, ".blueprint", "config"), "[clean]\ntemp-age = 2h\ntrash-age = 7d\nmax-output = 512KiB\n")
+	cfg, err = loadConfig()
+	if err != nil {
+		t.Fatalf("loadConfig() error: %v", err)
+	}
+	want := CleanConfig{TempAge: 2 * time.Hour, TrashAge: 7 * 24 * time.Hour, MaxOutput: 512 << 10}
+	if cfg.Clean != want {
+		t.Errorf("Clean = %+v, want %+v", cfg.Clean, want)
+	}
+}
+
+func TestLoadConfigSecurity(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	sum := strings.Repeat("ab", 32)
+	writeTestFile(t, filepath.Join(home, ".blueprint", "config"), `[security]
+forbid-remote-scripts = true
+asdf-version = v0.16.7
+asdf-sha256 = sha256:`+strings.ToUpper(sum)+`
+homebrew-install-ref = 4.4.0
+homebrew-install-sha256 = `+sum+`
+`)
+	cfg, err := loadConfig()
+	if err != nil {
+		t.Fatalf("loadConfig() error: %v", err)
+	}
+	want := handlerskg.RemoteInstallPolicy{
+		ForbidRemoteScripts:   true,
+		AsdfVersion:           "v0.16.7",
+		AsdfSHA256:            sum,
+		HomebrewInstallRef:    "4.4.0",
+		HomebrewInstallSHA256: sum,
+	}
+	if cfg.Security != want {
+		t.Errorf("Security = %+v, want %+v", cfg.Security, want)
+	}
+
+	writeTestFile(t, filepath.Join(home, ".blueprint", "config"), "[security]\nasdf-sha256 = "+sum+"\n")
+	if _, err := loadConfig(); err == nil || !strings.Contains(err.Error(), "asdf-version") {
+		t.Errorf("loadConfig() error = %v, want asdf-sha256 without asdf-version rejected", err)
+	}
+}
@@ -20,7 +20,7 @@ import (
 	"golang.org/x/term"
 )
 
-func EncryptFile(filePath string, passwordID string) {
+func EncryptFile(filePath string, passwordID string, params cryptopkg.KDFParams) {
 	// Check if file exists
 	if _, err := os.Stat(filePath); err != nil {
 		fmt.Printf("%s\n", ui.FormatError(fmt.Sprintf("File not found: %s", filePath)))
@@ -43,7 +43,7 @@ func EncryptFile(filePath string, passwordID string) {
 	}
 
 	// Encrypt file
-	encryptedData, err := cryptopkg.EncryptFile(plaintext, password)
+	encryptedData, err := cryptopkg.EncryptFileWithParams(plaintext, password, params)
 	if err != nil {
 		fmt.Printf("%s\n", ui.FormatError(fmt.Sprintf("Encryption failed: %v", err)))
 		os.Exit(1)
@@ -59,6 +59,97 @@ func EncryptFile(filePath string, passwordID string) {
 	fmt.Printf("%s\n", ui.FormatSuccess(fmt.Sprintf("File encrypted: %s -> %s", filePath, encryptedPath)))
 }
 
+// rekeyData decrypts an encrypted file with password and encrypts it again
+// with newPassword and params. With upgrade set, data that needs no upgrade
+// is returned as is and rewritten reports false.
+func rekeyData(data []byte, password, newPassword string, upgrade bool, params cryptopkg.KDFParams) (out []byte, rewritten bool, err error) {
+	if upgrade {
+		needed, err := cryptopkg.NeedsUpgrade(data, params)
+		if err != nil {
+			return nil, false, err
+		}
+		if !needed {
+			return data, false, nil
+		}
+	}
+	plaintext, err := cryptopkg.DecryptFile(data, password)
+	if err != nil {
+		return nil, false, err
+	}
+	out, err = cryptopkg.EncryptFileWithParams(plaintext, newPassword, params)
+	if err != nil {
+		return nil, false, err
+	}
+	return out, true, nil
+}
+
+// RekeyFiles re-encrypts encrypted files under the current format with
+// params. With upgrade each file keeps its password and only files in a
+// legacy format, or with KDF parameters weaker than params, are rewritten;
+// without it every file is rewritten under a new password. Files are
+// replaced atomically. Returns 1 when any file could not be rekeyed.
+func RekeyFiles(paths []string, upgrade bool, params cryptopkg.KDFParams) int {
+	failed := 0
+	for _, path := range paths {
+		if err := rekeyFile(path, upgrade, params); err != nil {
+			fmt.Printf("%s\n", ui.FormatError(fmt.Sprintf("%s: %v", path, err)))
+			failed++
+		}
+	}
+	if failed > 0 {
+		return 1
+	}
+	return 0
+}
+
+// rekeyFile rekeys one file for RekeyFiles, prompting for its passwords.
+func rekeyFile(path string, upgrade bool, params cryptopkg.KDFParams) error {
+	data, err := os.ReadFile(path) // #nosec G304 -- path is a user-supplied encrypted file
+	if err != nil {
+		return fmt.Errorf("failed to read file: %w", err)
+	}
+	if upgrade {
+		needed, err := cryptopkg.NeedsUpgrade(data, params)
+		if err != nil {
+			return err
+		}
+		if !needed {
+			fmt.Printf("%s\n", ui.FormatDim(fmt.Sprintf("Already up to date: %s", path)))
+			return nil
+		}
+	}
+
+	fmt.Printf("Enter password for %s: ", path)
+	password, err := readPassword()
+	if err != nil {
+		return fmt.Errorf("failed to read password: %w", err)
+	}
+	newPassword := password
+	if !upgrade {
+		fmt.Printf("Enter new password for %s: ", path)
+		if newPassword, err = readPassword(); err != nil {
+			return fmt.Errorf("failed to read password: %w", err)
+		}
+	}
+
+	out, _, err := rekeyData(data, password, newPassword, upgrade, params)
+	if err != nil {
+		return err
+	}
+
+	// Write atomically: write to temp file then rename
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, out, internal.FilePermission); err != nil { // #nosec G703 -- tmpPath is derived from a user-supplied file path
+		return fmt.Errorf("failed to write encrypted file: %w", err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		_ = os.Remove(tmpPath)
+		return fmt.Errorf("failed to replace encrypted file: %w", err)
+	}
+	fmt.Printf("%s\n", ui.FormatSuccess(fmt.Sprintf("File rekeyed: %s (Argon2id, %s)", path, params)))
+	return nil
+}
+
 // promptForDecryptPasswords collects all unique password-ids from decrypt rules and prompts for passwords upfront
 
 func promptForDecryptPasswords(rules []parser.Rule) error {
@@ -127,26 +218,43 @@ func promptForSudoPasswordWithOS(rules []parser.Rule, currentOS string) error {
 		}
 	}
 
-	// Check if user has passwordless sudo (sudo -n true)
+	// Check if user has passwordless sudo (sudo -n true, or doas -n true)
 	// If this succeeds, user can run sudo without password
-	if cmd := exec.Command("sudo", "-n", "true"); cmd.Run() == nil {
+	if privilegeWithoutPassword() {
 		// User has passwordless sudo, no need to prompt
 		return nil
 	}
 
+	// With --no-sudo the rules needing the password fail instead
+	if noSudo {
+		return nil
+	}
+
 	// Check if any rule needs sudo by asking the handler
-	// This delegates sudo requirement determination to each handler type
+	// This delegates sudo requirement determination to each handler type;
+	// commands sudoers allows without a password do not count
 	needsSudoPassword := false
 	for _, rule := range rules {
 		handler := handlerskg.NewHandler(rule, "", make(map[string]string))
-		if sudoAwareHandler, ok := handler.(handlerskg.SudoAwareHandler); ok {
-			if sudoAwareHandler.NeedsSudo() {
-				needsSudoPassword = true
-				break
-			}
+		if handler != nil && ruleNeedsSudoPassword(rule, handler) {
+			needsSudoPassword = true
+			break
 		}
 	}
 
+	// doas and run0 read the password from the terminal themselves: have
+	// them ask once now, which doas.conf persist or polkit can remember for
+	// the rest of the run
+	if tool := privilegeTool(); needsSudoPassword && tool != handlerskg.PrivilegeSudo {
+		logging.Debugf("authenticating with %s", tool)
+		cmd := exec.Command(tool, "true") // #nosec G204 -- one of the known privilege tools
+		cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("%s failed: %w", tool, err)
+		}
+		return nil
+	}
+
 	// If sudo is needed, prompt for password upfront
 	if needsSudoPassword {
 		fmt.Printf("Enter sudo password: ")
@@ -0,0 +1,44 @@
+package engine
+
+import (
+	"bytes"
+	"testing"
+
+	cryptopkg "github.com/elpic/blueprint/internal/crypto"
+)
+
+func TestRekeyData(t *testing.T) {
+	weak := cryptopkg.KDFParams{Time: 1, MemoryKiB: 8 * 1024, Threads: 1}
+	strong := cryptopkg.KDFParams{Time: 2, MemoryKiB: 8 * 1024, Threads: 1}
+	data, err := cryptopkg.EncryptFileWithParams([]byte("secret"), "old", weak)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// --upgrade leaves files that already meet the parameters alone
+	out, rewritten, err := rekeyData(data, "old", "old", true, weak)
+	if err != nil || rewritten || !bytes.Equal(out, data) {
+		t.Fatalf("rekeyData(upgrade, same params) = rewritten %v, %v; want the file untouched", rewritten, err)
+	}
+
+	out, rewritten, err = rekeyData(data, "old", "old", true, strong)
+	if err != nil || !rewritten {
+		t.Fatalf("rekeyData(upgrade, stronger params) = rewritten %v, %v", rewritten, err)
+	}
+	if _, params, _ := cryptopkg.FileParams(out); params != strong {
+		t.Errorf("upgraded file params = %+v, want %+v", params, strong)
+	}
+
+	// Without --upgrade the file is always rewritten, under the new password
+	out, rewritten, err = rekeyData(out, "old", "new", false, strong)
+	if err != nil || !rewritten {
+		t.Fatalf("rekeyData(new password) = rewritten %v, %v", rewritten, err)
+	}
+	if got, err := cryptopkg.DecryptFile(out, "new"); err != nil || string(got) != "secret" {
+		t.Errorf("DecryptFile(new password) = %q, %v", got, err)
+	}
+
+	if _, _, err := rekeyData(data, "wrong", "wrong", false, weak); err == nil {
+		t.Error("rekeyData() with the wrong password should fail")
+	}
+}
@@ -4,10 +4,10 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"strings"
 
+	"github.com/elpic/blueprint/internal"
 	gitpkg "github.com/elpic/blueprint/internal/git"
 	handlerskg "github.com/elpic/blueprint/internal/handlers"
 	"github.com/elpic/blueprint/internal/parser"
@@ -281,7 +281,7 @@ func checkOrphansWithLoader(status *handlerskg.Status, loader func(string) []par
 			return nil
 		}
 		// Interpolate ${VAR_NAME} so rule keys match the paths stored in status.
-		vars := resolveVarMap(rules, nil)
+		vars := resolveVarMap(rules, machineVars(nil))
 		for i, r := range rules {
 			rules[i] = interpolateRule(r, vars)
 		}
@@ -480,16 +480,17 @@ func checkStaleSymlinks(status *handlerskg.Status) []doctorIssue {
 	}
 }
 
-// expandHomedir replaces a leading ~ with the current user's home directory.
+// expandHomedir replaces a leading ~ (or %USERPROFILE% on Windows) with the
+// current user's home directory.
 func expandHomedir(path string) string {
-	if len(path) == 0 || path[0] != '~' {
+	if !internal.HasHomePrefix(path) {
 		return path
 	}
 	home, err := os.UserHomeDir()
 	if err != nil {
 		return path
 	}
-	return filepath.Join(home, path[1:])
+	return internal.ExpandHome(path, home)
 }
 
 // checkMissingCloneDirs scans all CloneStatus entries and reports entries
@@ -562,35 +563,26 @@ func checkMissingDownloadFiles(status *handlerskg.Status) []doctorIssue {
 	}
 }
 
-// brewListInstalled runs "brew list --versions" once and returns a set of
-// formula names that are currently installed. Uses exec.Command directly to
-// avoid the overhead of executing brew once per formula.
+// brewVersions returns the formulas and casks brew has installed with their
+// installed and current versions. Overridable for testing.
+var brewVersions = handlerskg.BrewInstalledVersions
+
+// brewListInstalled queries brew once (via its JSON interface) and returns the
+// sets of formula and cask names that are currently installed. Returns empty
+// sets when brew cannot be queried.
 func brewListInstalled() (map[string]bool, map[string]bool) {
 	formulas := map[string]bool{}
 	casks := map[string]bool{}
 
-	brew := handlerskg.BrewCmd()
-
-	// Get all installed formulas.
-	out, err := exec.Command("sh", "-c", brew+" list --versions 2>/dev/null").Output()
-	if err == nil {
-		for _, line := range strings.Split(string(out), "\n") {
-			fields := strings.Fields(line)
-			if len(fields) > 0 {
-				formulas[fields[0]] = true // "opencode 1.0.0" → "opencode"
-			}
-		}
+	installedFormulas, installedCasks, err := brewVersions()
+	if err != nil {
+		return formulas, casks
 	}
-
-	// Get all installed casks.
-	out, err = exec.Command("sh", "-c", brew+" list --cask --versions 2>/dev/null").Output()
-	if err == nil {
-		for _, line := range strings.Split(string(out), "\n") {
-			fields := strings.Fields(line)
-			if len(fields) > 0 {
-				casks[fields[0]] = true
-			}
-		}
+	for name := range installedFormulas {
+		formulas[name] = true
+	}
+	for name := range installedCasks {
+		casks[name] = true
 	}
 
 	return formulas, casks
@@ -662,6 +654,65 @@ func checkStaleHomebrewEntries(status *handlerskg.Status) []doctorIssue {
 	}
 }
 
+// checkOutdatedHomebrew reports the formulas and casks blueprint installed,
+// with homebrew rules or with install rules on mac, that brew knows a newer
+// version of than the one installed.
+func checkOutdatedHomebrew(status *handlerskg.Status) []doctorIssue {
+	var names []string
+	for _, entry := range status.Brews {
+		names = append(names, entry.Formula)
+	}
+	for _, entry := range status.Packages {
+		if entry.OS == "mac" {
+			names = append(names, entry.Name)
+		}
+	}
+	if len(names) == 0 {
+		return nil
+	}
+
+	formulas, casks, err := brewVersions()
+	if err != nil {
+		// brew cannot be queried — can't check. Skip silently.
+		return nil
+	}
+
+	var outdated []string
+	seen := make(map[string]bool)
+	for _, name := range names {
+		var version handlerskg.BrewVersion
+		var ok bool
+		if cask, isCask := strings.CutPrefix(name, "cask:"); isCask {
+			version, ok = casks[cask]
+		} else if version, ok = formulas[name]; !ok {
+			version, ok = casks[name]
+		}
+		if !ok || !version.Outdated() || seen[name] {
+			continue
+		}
+		seen[name] = true
+		outdated = append(outdated, fmt.Sprintf("%s %s → %s", name, version.Installed, version.Current))
+	}
+
+	if len(outdated) == 0 {
+		return nil
+	}
+
+	examples := outdated
+	if len(examples) > 3 {
+		examples = examples[:3]
+	}
+
+	return []doctorIssue{
+		{
+			description: fmt.Sprintf("%d homebrew package(s) have a newer version available", len(outdated)),
+			count:       len(outdated),
+			examples:    examples,
+			hint:        "Run 'brew upgrade' to update them; the next 'blueprint apply' records the new versions.",
+		},
+	}
+}
+
 // checkStaleMkdirEntries scans all MkdirStatus entries and reports directories
 // that the status file claims exist but are missing from disk.
 func checkStaleMkdirEntries(status *handlerskg.Status) []doctorIssue {
@@ -762,6 +813,30 @@ func prefetchBlueprints(status *handlerskg.Status) {
 	}
 }
 
+// loadDoctorStatus returns the recorded status for the checks. A status.json
+// is read as written, without the schema migrations, so the checks see what
+// an older blueprint left in the file.
+func loadDoctorStatus() (handlerskg.Status, error) {
+	store, err := openStateStore()
+	if err != nil {
+		return handlerskg.Status{}, err
+	}
+	defer func() { _ = store.Close() }()
+	js, ok := store.(*jsonStateStore)
+	if !ok {
+		return store.LoadStatus()
+	}
+	var status handlerskg.Status
+	data, err := readBlueprintFile(js.statusPath())
+	if err != nil {
+		return status, err
+	}
+	if err := json.Unmarshal(data, &status); err != nil {
+		return handlerskg.Status{}, err
+	}
+	return status, nil
+}
+
 // DoctorCheck reads ~/.blueprint/status.json, reports all issues found, and
 // optionally rewrites the file with issues fixed when fix is true.
 // When verbose is true, prints progress messages for each check as it runs.
@@ -773,25 +848,17 @@ func DoctorCheck(fix bool, verbose bool) {
 	}
 	fmt.Printf("\n%s\n", ui.FormatHeader("═══ Blueprint Doctor"+mode+" ═══"))
 
-	statusPath, err := getStatusPath()
-	if err != nil {
-		fmt.Printf("  %s\n", ui.FormatError(fmt.Sprintf("Error getting status path: %v", err)))
-		os.Exit(1)
-	}
-
-	data, err := readBlueprintFile(statusPath)
-	if err != nil {
+	status, err := loadDoctorStatus()
+	if os.IsNotExist(err) {
 		if verbose {
 			fmt.Printf("\n")
 		}
-		fmt.Printf("  %s\n", ui.FormatDim("No status file found — nothing to check."))
+		fmt.Printf("  %s\n", ui.FormatDim("No status found — nothing to check."))
 		fmt.Printf("\n  %s\n\n", ui.FormatSuccess("No issues found."))
 		return
 	}
-
-	var status handlerskg.Status
-	if err := json.Unmarshal(data, &status); err != nil {
-		fmt.Printf("  %s\n", ui.FormatError(fmt.Sprintf("Error parsing status file: %v", err)))
+	if err != nil {
+		fmt.Printf("  %s\n", ui.FormatError(fmt.Sprintf("Error reading status: %v", err)))
 		os.Exit(1)
 	}
 
@@ -836,6 +903,9 @@ func DoctorCheck(fix bool, verbose bool) {
 	issues = append(issues, runCheck("Checking for stale homebrew entries...", func() []doctorIssue {
 		return checkStaleHomebrewEntries(&status)
 	})...)
+	issues = append(issues, runCheck("Checking for outdated homebrew packages...", func() []doctorIssue {
+		return checkOutdatedHomebrew(&status)
+	})...)
 	issues = append(issues, runCheck("Checking for stale mkdir entries...", func() []doctorIssue {
 		return checkStaleMkdirEntries(&status)
 	})...)
@@ -868,13 +938,8 @@ func DoctorCheck(fix bool, verbose bool) {
 			}
 		}
 
-		fixed, err := json.MarshalIndent(status, "", "  ")
-		if err != nil {
-			fmt.Printf("%s\n", ui.FormatError(fmt.Sprintf("Error serializing status: %v", err)))
-			os.Exit(1)
-		}
-		if err := os.WriteFile(statusPath, fixed, 0600); err != nil {
-			fmt.Printf("%s\n", ui.FormatError(fmt.Sprintf("Error writing status file: %v", err)))
+		if err := storeStatus(status); err != nil {
+			fmt.Printf("%s\n", ui.FormatError(fmt.Sprintf("Error writing status: %v", err)))
 			os.Exit(1)
 		}
 
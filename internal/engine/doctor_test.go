@@ -825,3 +825,50 @@ func TestCheckBranchDuplicates_Fix(t *testing.T) {
 		t.Errorf("expected branchless blueprint, got %q", status.Packages[0].Blueprint)
 	}
 }
+
+func TestCheckOutdatedHomebrew(t *testing.T) {
+	orig := brewVersions
+	defer func() { brewVersions = orig }()
+	brewVersions = func() (map[string]handlerskg.BrewVersion, map[string]handlerskg.BrewVersion, error) {
+		return map[string]handlerskg.BrewVersion{
+			"git":  {Installed: "2.44.0", Current: "2.45.0"},
+			"jq":   {Installed: "1.7.1", Current: "1.7.1"},
+			"wget": {Installed: "1.24.5", Current: "1.25.0"},
+		}, map[string]handlerskg.BrewVersion{
+			"wezterm": {Installed: "20240203", Current: "20240520"},
+			"firefox": {Installed: "125.0", Current: "latest"},
+		}, nil
+	}
+
+	status := &handlerskg.Status{
+		Brews: []handlerskg.HomebrewStatus{
+			{Formula: "git", Version: "2.44.0", OS: "mac"},
+			{Formula: "jq", Version: "1.7.1", OS: "mac"},
+			{Formula: "cask:wezterm", Version: "20240203", OS: "mac"},
+			{Formula: "cask:firefox", Version: "125.0", OS: "mac"},
+		},
+		Packages: []handlerskg.PackageStatus{
+			{Name: "wget", Version: "1.24.5", OS: "mac"},
+			{Name: "wget", Version: "1.21.4", OS: "linux"},
+		},
+	}
+	issues := checkOutdatedHomebrew(status)
+	if len(issues) != 1 || issues[0].count != 3 {
+		t.Fatalf("checkOutdatedHomebrew() = %+v, want one issue for git, wezterm and wget", issues)
+	}
+	want := []string{"git 2.44.0 → 2.45.0", "cask:wezterm 20240203 → 20240520", "wget 1.24.5 → 1.25.0"}
+	for i, example := range issues[0].examples {
+		if example != want[i] {
+			t.Errorf("examples[%d] = %q, want %q", i, example, want[i])
+		}
+	}
+
+	// Status without brew entries does not run brew
+	brewVersions = func() (map[string]handlerskg.BrewVersion, map[string]handlerskg.BrewVersion, error) {
+		t.Error("brew was queried for a status without brew entries")
+		return nil, nil, nil
+	}
+	if issues := checkOutdatedHomebrew(&handlerskg.Status{Packages: []handlerskg.PackageStatus{{Name: "git", OS: "linux"}}}); issues != nil {
+		t.Errorf("checkOutdatedHomebrew() = %+v, want none", issues)
+	}
+}
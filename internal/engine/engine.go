@@ -2,11 +2,15 @@ package engine
 
 import (
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"slices"
 	"sync"
+	"time"
 
 	gitpkg "github.com/elpic/blueprint/internal/git"
+	handlerskg "github.com/elpic/blueprint/internal/handlers"
 	"github.com/elpic/blueprint/internal/logging"
 	"github.com/elpic/blueprint/internal/parser"
 	"github.com/elpic/blueprint/internal/ui"
@@ -17,14 +21,26 @@ import (
 var ExecutableName = "blueprint"
 
 type ExecutionRecord struct {
-	Timestamp  string `json:"timestamp"`
-	Blueprint  string `json:"blueprint"`
-	OS         string `json:"os"`
-	Command    string `json:"command"`
-	Status     string `json:"status"`
-	DurationMs int64  `json:"duration_ms,omitempty"`
-	Output     string `json:"output,omitempty"`
-	Error      string `json:"error,omitempty"`
+	Timestamp   string            `json:"timestamp"`
+	Blueprint   string            `json:"blueprint"`
+	OS          string            `json:"os"`
+	Command     string            `json:"command"`
+	Status      string            `json:"status"`
+	DurationMs  int64             `json:"duration_ms,omitempty"`
+	ExitCode    int               `json:"exit_code,omitempty"` // exit status of the failed command, when one exited
+	Cwd         string            `json:"cwd,omitempty"`       // working directory the rule ran in
+	Env         map[string]string `json:"env,omitempty"`       // summary of the environment, see environmentSummary
+	Output      string            `json:"output,omitempty"`
+	Error       string            `json:"error,omitempty"`
+	Hint        string            `json:"hint,omitempty"`         // remediation advice for well-known failures
+	Sensitive   bool              `json:"sensitive,omitempty"`    // the rule is sensitive: true, see redacted
+	Group       string            `json:"group,omitempty"`        // the rule's group:, for filtering history
+	Changed     bool              `json:"changed,omitempty"`      // the rule's Up or Down ran and succeeded, rather than finding nothing to do
+	Flapping    bool              `json:"flapping,omitempty"`     // the rule changed something again with nothing edited, see markFlapping
+	FallbackFor string            `json:"fallback_for,omitempty"` // the rule this one is the on-failure: fallback of, see linkFallbacks
+	SatisfiedBy string            `json:"satisfied_by,omitempty"` // the fallback that did what this failed rule could not
+
+	followUp *parser.Rule // set on the records of follow-up rules, see runRules
 }
 
 // passwordStore is a mutex-protected map of password-id → password.
@@ -59,19 +75,77 @@ func (p *passwordStore) snapshot() map[string]string {
 // passwordCache stores decryption passwords by password-id to avoid re-prompting
 var passwordCache = &passwordStore{m: make(map[string]string)}
 
-// RunWithSkip executes the blueprint and returns an exit code:
+// ExitDeadlineExceeded is returned by RunWithSkip when the run deadline passed
+// before every rule could be started.
+const ExitDeadlineExceeded = 2
+
+// RunOptions are the settings of a run besides its blueprints, as plan and
+// apply take them from the command line.
+type RunOptions struct {
+	// Dry plans the run without changing anything.
+	Dry bool
+	// SkipGroup and SkipID leave out the rules of a group and a rule.
+	SkipGroup string
+	SkipID    string
+	// OnlyID and OnlyGroup narrow the run to one rule or group, with
+	// OnlyDeps along with the rules they depend on.
+	OnlyID    string
+	OnlyGroup string
+	OnlyDeps  bool
+	// SkipDecrypt leaves out the decrypt rules.
+	SkipDecrypt bool
+	// PreferSSH clones git blueprints over SSH.
+	PreferSSH bool
+	// NoStatus applies without recording the status.
+	NoStatus bool
+	// Vars are the --var values, overriding the blueprints' own.
+	Vars map[string]string
+	// Deadline limits how long the run may start rules; 0 means no limit.
+	Deadline time.Duration
+	// CleanupGrace holds back auto-uninstalls of resources that have not
+	// been missing for long enough.
+	CleanupGrace CleanupGrace
+	// ReportPath, when set, is where a Markdown or HTML report of the run
+	// is written.
+	ReportPath string
+}
+
+// RunWithSkip executes the blueprints in files as one run and returns an exit code:
 // 0 = success (all rules applied or dry-run completed),
-// 1 = one or more rules failed or a fatal error occurred.
-func RunWithSkip(file string, dry bool, skipGroup string, skipID string, onlyID string, skipDecrypt bool, preferSSH bool, noStatus bool, cliVars map[string]string) int {
-	if preferSSH {
-		file = gitpkg.ExpandShorthandSSH(file)
-	} else {
-		file = gitpkg.ExpandShorthand(file)
+// 1 = one or more rules failed or a fatal error occurred,
+// 2 = the deadline passed and some rules were not attempted (ExitDeadlineExceeded).
+// Several blueprints share one dependency graph, one set of prompts and one
+// history entry, while status and auto-uninstall stay per blueprint.
+func RunWithSkip(files []string, opts RunOptions) int {
+	startedAt := time.Now()
+	if reason := checkInteractive(); reason != "" {
+		fmt.Fprintf(os.Stderr, "%s\n", ui.FormatError(reason))
+		return 1
+	}
+	// With --output json the text a run prints goes to stderr and stdout
+	// carries only the JSON document
+	var jsonOut io.Writer
+	if jsonOutput {
+		var restore func()
+		jsonOut, restore = redirectStdout()
+		defer restore()
+	}
+	var deadlineAt time.Time
+	if opts.Deadline > 0 {
+		deadlineAt = time.Now().Add(opts.Deadline)
+	}
+	files = slices.Clone(files)
+	for i, file := range files {
+		if opts.PreferSSH {
+			files[i] = gitpkg.ExpandShorthandSSH(file)
+		} else {
+			files[i] = gitpkg.ExpandShorthand(file)
+		}
 	}
 	var runNumber int
 
 	// Get next run number (only for non-dry runs)
-	if !dry {
+	if !opts.Dry {
 		var err error
 		runNumber, err = getNextRunNumber()
 		if err != nil {
@@ -80,100 +154,158 @@ func RunWithSkip(file string, dry bool, skipGroup string, skipID string, onlyID
 		}
 	}
 
-	logging.Debugf("resolving blueprint file: %s", file)
-	setupPath, blueprintSHA, cleanup, err := resolveBlueprintFile(file, dry, preferSSH)
+	sources, cleanup, err := loadBlueprints(files, opts.Dry, opts.PreferSSH, opts.Vars)
+	defer cleanup()
 	if err != nil {
+		if opts.Dry {
+			reportMissingIncludes(files)
+		}
 		fmt.Printf("Error: %v\n", err)
 		return 1
 	}
-	defer cleanup()
-	logging.Debugf("blueprint resolved: %s", setupPath)
-
-	// Parse the setup file (with include support for both local and git repositories)
-	var rules []parser.Rule
-	// Use ParseFile for both local files and git repositories
-	// This enables include directive support in both cases
-	rules, err = parser.ParseFile(setupPath)
-	if err != nil {
-		fmt.Println("Parse error:", err)
+	file := runLabel(sources)
+	rules := combinedRules(sources)
+	if reportAttributes(rules) {
 		return 1
 	}
 
-	// Interpolate ${VAR_NAME} in all rules before any further processing so that
-	// paths like ${WORKSPACE}/repo are resolved consistently everywhere — OS
-	// filtering, skip/only flags, auto-uninstall comparisons, execution, and
-	// status saving all see the same expanded values.
-	{
-		vars := resolveVarMap(rules, cliVars)
-		for i, r := range rules {
-			rules[i] = interpolateRule(r, vars)
-		}
-	}
-
 	// Filter rules by current OS first, before applying skip flags.
 	// We keep the full OS-filtered set separately so auto-uninstall comparisons
 	// see the complete blueprint (skipped rules should not trigger uninstalls).
 	currentOS := getOSName()
 	allOSRules := filterRulesByOS(rules)
+	skipped := osSkippedRules(rules, currentOS, getArchName())
 
-	// Filter rules by skip/only flags
+	// Filter rules by skip/only flags, keeping why each one is left out. The
+	// only flags select rules outright, so the skip flags do not apply then.
+	narrowed := opts.OnlyID != "" || opts.OnlyGroup != ""
+	onlyReasons := onlySkipReasons(allOSRules, opts.OnlyID, opts.OnlyGroup, opts.OnlyDeps)
 	var filteredRules []parser.Rule
-	for _, rule := range allOSRules {
-		if onlyID != "" {
-			// --only: keep only the rule with this ID
-			if rule.ID == onlyID {
-				filteredRules = append(filteredRules, rule)
-			}
-			continue
+	for i, rule := range allOSRules {
+		var reason string
+		if narrowed {
+			reason = onlyReasons[i]
+		} else {
+			reason = flagSkipReason(rule, opts.SkipGroup, opts.SkipID, opts.SkipDecrypt)
 		}
-		if skipGroup != "" && rule.Group == skipGroup {
-			continue
-		}
-		if skipID != "" && rule.ID == skipID {
-			continue
-		}
-		if skipDecrypt && rule.Action == "decrypt" {
+		if reason != "" {
+			skipped = append(skipped, skippedRule{rule: rule, reason: reason})
 			continue
 		}
 		filteredRules = append(filteredRules, rule)
 	}
 
-	if onlyID != "" && len(filteredRules) == 0 {
-		fmt.Printf("No rule found with id: %s\n", onlyID)
+	if narrowed && len(filteredRules) == 0 {
+		if opts.OnlyGroup != "" {
+			fmt.Printf("No rule found in group: %s\n", opts.OnlyGroup)
+		} else {
+			fmt.Printf("No rule found with id or address: %s\n", opts.OnlyID)
+		}
 		return 1
 	}
 
 	// Check history and add auto-uninstall rules for removed packages.
-	// Skip auto-uninstall when --only is set (we're targeting one specific rule).
+	// Skip auto-uninstall when --only and the like are set (we're targeting
+	// specific rules).
 	// Use allOSRules (not filteredRules) so that rules excluded by skip flags
-	// are not mistakenly treated as "removed from the blueprint".
+	// are not mistakenly treated as "removed from the blueprint", and so that
+	// a resource moved from one blueprint of the run to another is kept.
 	var autoUninstallRules []parser.Rule
-	if onlyID == "" {
-		autoUninstallRules = getAutoUninstallRules(allOSRules, file, currentOS)
+	var heldRemovals []heldRemoval
+	var pendingRemovals []handlerskg.PendingRemoval
+	uninstallsBySource := map[string][]parser.Rule{}
+	if !narrowed {
+		pendingRemovals = pendingOnMachine(loadCurrentStatus().PendingRemovals, machineID(), true)
+		for _, src := range sources {
+			var due []parser.Rule
+			var held []heldRemoval
+			due, held, pendingRemovals = holdBackRemovals(getAutoUninstallRules(allOSRules, src.file, currentOS), pendingRemovals, src.file, currentOS, opts.CleanupGrace)
+			uninstallsBySource[src.file] = due
+			autoUninstallRules = append(autoUninstallRules, due...)
+			heldRemovals = append(heldRemovals, held...)
+		}
 	}
 	allRules := append(filteredRules, autoUninstallRules...)
 
 	// Count cleanup operations only when not using skip/only options
 	var numCleanups int
-	if skipGroup == "" && skipID == "" && onlyID == "" {
+	if opts.SkipGroup == "" && opts.SkipID == "" && !narrowed {
 		numCleanups = len(autoUninstallRules)
 	}
 
-	// Extract base directory from setupPath for resolving relative file paths
-	basePath := filepath.Dir(setupPath)
+	// Relative file paths are resolved against the directory of the first
+	// blueprint
+	basePath := filepath.Dir(sources[0].path)
+
+	// A plan stops at configuration errors the handlers can find up front,
+	// as apply would only hit them part way through
+	if opts.Dry {
+		if issues := checkHandlers(filteredRules); len(issues) > 0 {
+			for _, issue := range issues {
+				fmt.Fprintf(os.Stderr, "%s\n", ui.FormatError(issue.String()))
+			}
+			return 1
+		}
+		if issues := checkMissingFiles(filteredRules, basePath); len(issues) > 0 {
+			printMissingFiles(issues)
+		}
+	}
+
+	var changes, cleanupChanges []handlerskg.PlanChange
+	if opts.Dry {
+		changes = planRuleChanges(filteredRules, sources, uninstallsBySource, currentOS)
+		cleanupChanges = planRuleChanges(autoUninstallRules, sources, uninstallsBySource, currentOS)
+	}
 
-	if dry {
+	if opts.Dry && jsonOut != nil {
+		if err := printJSON(jsonOut, planJSON(file, currentOS, filteredRules, changes, autoUninstallRules, skipped, heldRemovals)); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return 1
+		}
+		return 0
+	}
+
+	if opts.Dry && interactive {
+		if err := browsePlan("Plan: "+file+" ("+currentOS+")", filteredRules, changes, autoUninstallRules, cleanupChanges); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return 1
+		}
+		return 0
+	}
+
+	if opts.Dry {
 		ui.PrintExecutionHeader(false, currentOS, file, len(filteredRules), len(autoUninstallRules), numCleanups)
-		displayRules(filteredRules)
+		printWorkspaceLine()
+		displaySudoSummary(allRules)
+		// A plan narrowed by skip/only flags is not comparable with a full one,
+		// nor is one of several blueprints with a plan of each
+		if opts.SkipGroup == "" && opts.SkipID == "" && !narrowed && len(sources) == 1 {
+			comparePlanWithPrevious(file, filteredRules, autoUninstallRules)
+		}
+		displayRules(filteredRules, changes)
 		if len(autoUninstallRules) > 0 {
 			ui.PrintAutoUninstallSection()
-			displayRules(autoUninstallRules)
+			displayRules(autoUninstallRules, cleanupChanges)
 		}
+		displaySkippedRules(skipped)
+		displayHeldRemovals(heldRemovals, opts.CleanupGrace)
+		fmt.Printf("%s\n\n", ui.FormatHighlight(planSummary(slices.Concat(changes, cleanupChanges))))
 		ui.PrintPlanFooter()
 		return 0
 	}
 
 	ui.PrintExecutionHeader(true, currentOS, file, len(filteredRules), len(autoUninstallRules), numCleanups)
+	printWorkspaceLine()
+	displaySkippedRules(skipped)
+	displayHeldRemovals(heldRemovals, opts.CleanupGrace)
+
+	// Installers that rules download follow [security] of ~/.blueprint/config
+	cfg, err := loadConfig()
+	if err != nil {
+		fmt.Printf("%s\n", ui.FormatError(fmt.Sprintf("Error: %v", err)))
+		return 1
+	}
+	handlerskg.SetRemoteInstallPolicy(cfg.Security)
 
 	// Prompt for sudo password upfront (before decrypt passwords)
 	// Check all rules including auto-uninstall rules
@@ -192,29 +324,115 @@ func RunWithSkip(file string, dry bool, skipGroup string, skipID string, onlyID
 	}
 	logging.Debugf("password prompts complete, starting rule execution")
 
-	records := executeRules(allRules, file, currentOS, basePath, runNumber)
-	if err := saveHistory(records); err != nil {
+	stopDashboard := func() {}
+	if interactive {
+		stopDashboard = startDashboard("Apply: " + file + " (" + currentOS + ")")
+	}
+	records := executeRulesWithDeadline(allRules, file, currentOS, basePath, runNumber, deadlineAt)
+	stopDashboard()
+	if len(sources) > 1 {
+		attributeRecords(records, allRules, sources, uninstallsBySource, currentOS)
+	}
+	flapping := markFlapping(allRules, records, runNumber)
+	if err := saveHistory(runNumber, slices.Concat(records, skippedRecords(skipped, file, currentOS))); err != nil {
 		fmt.Printf("Warning: Failed to save history: %v\n", err)
+	} else if err := applyHistoryRetention(cfg.History); err != nil {
+		fmt.Printf("Warning: Failed to prune history: %v\n", err)
+	}
+	if cfg.Stats {
+		if err := recordUsageStats(allRules, records); err != nil {
+			fmt.Printf("Warning: Failed to save usage stats: %v\n", err)
+		}
 	}
 	// Use the original file path/URL for status (never temp paths)
-	if !noStatus {
-		if err := saveStatus(allRules, records, file, blueprintSHA, currentOS); err != nil {
-			fmt.Printf("Warning: Failed to save status: %v\n", err)
+	if !opts.NoStatus {
+		ran := map[string]bool{}
+		for _, rule := range filteredRules {
+			ran[handlerskg.RuleKey(rule)] = true
+		}
+		for _, src := range sources {
+			// Each blueprint records the rules it declares, as if applied alone
+			var srcRules []parser.Rule
+			for _, rule := range filterRulesByOS(src.rules) {
+				if ran[handlerskg.RuleKey(rule)] {
+					srcRules = append(srcRules, rule)
+				}
+			}
+			srcRules = append(srcRules, uninstallsBySource[src.file]...)
+			if err := saveStatus(srcRules, records, src.file, src.sha, currentOS); err != nil {
+				fmt.Printf("Warning: Failed to save status: %v\n", err)
+			}
+		}
+		if !narrowed {
+			if err := savePendingRemovals(pendingRemovals); err != nil {
+				fmt.Printf("Warning: Failed to save pending removals: %v\n", err)
+			}
 		}
 	}
 
 	// Clear sudo cache on all operating systems
 	clearSudoCache()
 
-	// Return exit code 1 if any rule failed.
+	// Rules left unattempted take precedence: the run is incomplete regardless
+	// of how the attempted rules fared.
+	notAttempted := 0
+	failed := false
 	for _, r := range records {
-		if r.Status == "error" {
-			return 1
+		switch r.Status {
+		case statusNotAttempted:
+			notAttempted++
+		case "error":
+			// A failure its fallback made up for does not fail the run
+			failed = failed || r.SatisfiedBy == ""
+		}
+	}
+	exitCode := 0
+	switch {
+	case notAttempted > 0:
+		exitCode = ExitDeadlineExceeded
+	case failed, len(flapping) > 0:
+		exitCode = 1
+	}
+
+	if runNumber > 0 {
+		flags := runFlags(opts)
+		if err := saveRunMetadata(newRunMetadata(runNumber, sources, currentOS, startedAt, records, len(skipped), flags, exitCode)); err != nil {
+			fmt.Printf("Warning: Failed to save run metadata: %v\n", err)
+		}
+	}
+
+	if opts.ReportPath != "" || jsonOut != nil {
+		report, err := newApplyReport(file, currentOS, startedAt, allRules, records, heldRemovals, opts.CleanupGrace)
+		if err == nil {
+			report.Skipped = skipped
 		}
+		if opts.ReportPath != "" {
+			if err == nil {
+				err = writeApplyReport(opts.ReportPath, report)
+			}
+			if err != nil {
+				fmt.Printf("Warning: Failed to write report: %v\n", err)
+			} else {
+				fmt.Printf("%s\n", ui.FormatInfo("Report written to "+opts.ReportPath))
+			}
+		}
+		if jsonOut != nil {
+			if err == nil {
+				err = printJSON(jsonOut, applyJSON(report, runNumber, exitCode))
+			}
+			if err != nil {
+				fmt.Printf("Error: %v\n", err)
+			}
+		}
+	}
+
+	displayFlapping(flapping)
+	if notAttempted > 0 {
+		fmt.Printf("%s\n", ui.FormatError(fmt.Sprintf("Deadline of %s exceeded: %d rule(s) not attempted. Re-run 'blueprint apply' to continue.", opts.Deadline, notAttempted)))
 	}
-	return 0
+	return exitCode
 }
 
 func Run(file string, dry bool) int {
-	return RunWithSkip(file, dry, "", "", "", false, false, false, nil)
+	return RunWithSkip([]string{file}, RunOptions{Dry: dry})
 }
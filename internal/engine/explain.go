@@ -0,0 +1,210 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/elpic/blueprint/internal/ui"
+	"github.com/elpic/blueprint/internal/ui/timeutil"
+)
+
+// environmentKeys are the variables kept in a record's environment summary:
+// enough to tell which user, shell and PATH a command saw, without saving
+// the whole environment and the secrets it may hold.
+var environmentKeys = []string{"USER", "HOME", "SHELL", "PATH", "LANG"}
+
+// environmentSummary returns the set variables of environmentKeys.
+func environmentSummary() map[string]string {
+	env := map[string]string{}
+	for _, key := range environmentKeys {
+		if value, ok := os.LookupEnv(key); ok {
+			env[key] = value
+		}
+	}
+	if len(env) == 0 {
+		return nil
+	}
+	return env
+}
+
+// currentDir returns the working directory commands run in, or "" when it
+// cannot be read.
+func currentDir() string {
+	dir, err := os.Getwd()
+	if err != nil {
+		return ""
+	}
+	return dir
+}
+
+// exitCodeOf returns the exit status of the command behind err, or 0 when
+// err did not come from a command that exited (a timeout, a download error).
+func exitCodeOf(err error) int {
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode()
+	}
+	return 0
+}
+
+// splitRuleOutput splits the content of a <rule>.output file into its
+// stdout and stderr sections.
+func splitRuleOutput(content string) (stdout, stderr string) {
+	parts := strings.Split(content, "\n=== STDERR ===\n")
+	stdout = strings.TrimSpace(strings.TrimPrefix(parts[0], "=== STDOUT ===\n"))
+	if len(parts) >= 2 {
+		stderr = strings.TrimSpace(parts[1])
+	}
+	return stdout, stderr
+}
+
+// explainStep is what explain prints with --output json.
+type explainStep struct {
+	Run        int               `json:"run"`
+	Step       int               `json:"step"`
+	Timestamp  string            `json:"timestamp,omitempty"`
+	Blueprint  string            `json:"blueprint,omitempty"`
+	OS         string            `json:"os,omitempty"`
+	Group      string            `json:"group,omitempty"`
+	Command    string            `json:"command,omitempty"`
+	Status     string            `json:"status,omitempty"`
+	ExitCode   *int              `json:"exit_code,omitempty"`
+	DurationMs int64             `json:"duration_ms"`
+	Cwd        string            `json:"cwd,omitempty"`
+	Env        map[string]string `json:"env,omitempty"`
+	Error      string            `json:"error,omitempty"`
+	Hint       string            `json:"hint,omitempty"`
+	Stdout     string            `json:"stdout"`
+	Stderr     string            `json:"stderr"`
+}
+
+// newExplainStep pairs the record of step with its saved output. The exit
+// code is left unset when the step failed without a command exiting.
+func newExplainStep(runNumber, step int, record ExecutionRecord, stdout, stderr string) explainStep {
+	e := explainStep{
+		Run:        runNumber,
+		Step:       step,
+		Timestamp:  record.Timestamp,
+		Blueprint:  record.Blueprint,
+		OS:         record.OS,
+		Group:      record.Group,
+		Command:    record.Command,
+		Status:     record.Status,
+		DurationMs: record.DurationMs,
+		Cwd:        record.Cwd,
+		Env:        record.Env,
+		Error:      record.Error,
+		Hint:       record.Hint,
+		Stdout:     stdout,
+		Stderr:     stderr,
+	}
+	switch {
+	case record.ExitCode != 0:
+		code := record.ExitCode
+		e.ExitCode = &code
+	case record.Status == "success":
+		code := 0
+		e.ExitCode = &code
+	}
+	return e
+}
+
+// Explain prints everything history kept about one step of a run: the
+// command, its exit code, duration, working directory and environment,
+// followed by its output. A run number of 0 means the latest run. It returns
+// the process exit code.
+func Explain(runNumber, step int) int {
+	if runNumber == 0 {
+		latest, err := getLatestRunNumber()
+		if err != nil {
+			fmt.Printf("%s\n", ui.FormatError("No history found"))
+			return 1
+		}
+		runNumber = latest
+	}
+
+	records, err := loadRunRecords(runNumber)
+	if err != nil {
+		fmt.Printf("%s\n", ui.FormatError(fmt.Sprintf("No history found for run %d", runNumber)))
+		return 1
+	}
+	if step < 1 || step > len(records) {
+		fmt.Printf("%s\n", ui.FormatError(fmt.Sprintf("Run %d has no step %d (it has %d)", runNumber, step, len(records))))
+		return 1
+	}
+	record := records[step-1].redacted()
+
+	var stdout, stderr string
+	if historyDir, err := getHistoryDir(); err == nil {
+		outputPath := filepath.Join(historyDir, fmt.Sprintf("%d", runNumber), fmt.Sprintf("%d.output", step))
+		if content, err := readBlueprintFile(outputPath); err == nil {
+			stdout, stderr = splitRuleOutput(string(content))
+		}
+	}
+
+	e := newExplainStep(runNumber, step, record, stdout, stderr)
+	if jsonOutput {
+		_ = printJSON(os.Stdout, e)
+		return 0
+	}
+	printExplainStep(e)
+	return 0
+}
+
+// printExplainStep prints e as text.
+func printExplainStep(e explainStep) {
+	fmt.Printf("\n%s\n", ui.FormatHighlight(fmt.Sprintf("=== RUN %d STEP %d ===", e.Run, e.Step)))
+
+	field := func(name, value string) {
+		if value != "" {
+			fmt.Printf("  %-11s %s\n", ui.FormatDim(name+":"), value)
+		}
+	}
+	field("Command", e.Command)
+	field("Status", e.Status)
+	switch {
+	case e.ExitCode != nil:
+		field("Exit code", fmt.Sprintf("%d", *e.ExitCode))
+	case e.Status == "error":
+		field("Exit code", "none (failed before a command exited)")
+	}
+	field("Duration", timeutil.Milliseconds(e.DurationMs))
+	if e.Timestamp != "" {
+		field("Started", timeutil.Display(e.Timestamp))
+	}
+	field("Blueprint", e.Blueprint)
+	field("OS", e.OS)
+	field("Group", e.Group)
+	field("Directory", e.Cwd)
+	field("Hint", e.Hint)
+
+	if len(e.Env) > 0 {
+		fmt.Printf("  %s\n", ui.FormatDim("Environment:"))
+		keys := make([]string, 0, len(e.Env))
+		for key := range e.Env {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			fmt.Printf("    %s=%s\n", key, e.Env[key])
+		}
+	}
+
+	if e.Stdout != "" {
+		fmt.Printf("%s\n%s\n", "───────────────", e.Stdout)
+	}
+	if e.Stderr != "" {
+		for _, line := range strings.Split(e.Stderr, "\n") {
+			fmt.Printf("%s\n", ui.FormatError(line))
+		}
+	}
+	if e.Stdout == "" && e.Stderr == "" {
+		fmt.Printf("%s\n", ui.FormatInfo("(no output)"))
+	}
+	fmt.Printf("\n")
+}
@@ -0,0 +1,77 @@
+package engine
+
+import (
+	"testing"
+
+	handlerskg "github.com/elpic/blueprint/internal/handlers"
+	"github.com/elpic/blueprint/internal/parser"
+)
+
+func TestExecuteOneRuleRecordsExecutionContext(t *testing.T) {
+	t.Setenv("LANG", "C.UTF-8")
+	rule := parser.Rule{Action: "run", RunCommand: "echo oops >&2; exit 3"}
+
+	res := executeOneRule(rule, 0, "[1/1]", "/tmp/test.bp", "linux", t.TempDir(), &handlerskg.Status{}, nil, nil)
+	if res.record.Status != "error" || res.record.ExitCode != 3 {
+		t.Errorf("record = %+v, want a failure with exit code 3", res.record)
+	}
+	if res.record.Cwd == "" {
+		t.Error("record has no working directory")
+	}
+	if res.record.Env["LANG"] != "C.UTF-8" {
+		t.Errorf("record env = %v, want LANG kept", res.record.Env)
+	}
+}
+
+func TestNewExplainStepExitCode(t *testing.T) {
+	tests := []struct {
+		name   string
+		record ExecutionRecord
+		want   int
+		known  bool
+	}{
+		{"success", ExecutionRecord{Status: "success"}, 0, true},
+		{"command exited", ExecutionRecord{Status: "error", ExitCode: 2}, 2, true},
+		{"no command exited", ExecutionRecord{Status: "error"}, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := newExplainStep(1, 1, tt.record, "", "")
+			if (e.ExitCode != nil) != tt.known || (tt.known && *e.ExitCode != tt.want) {
+				t.Errorf("exit code = %v, want %d (known %v)", e.ExitCode, tt.want, tt.known)
+			}
+		})
+	}
+}
+
+func TestExplain(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	if code := Explain(0, 1); code != 1 {
+		t.Errorf("Explain without history = %d, want 1", code)
+	}
+
+	if err := saveHistory(1, []ExecutionRecord{{Command: "false", Status: "error", ExitCode: 1}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := saveRuleOutput(1, 1, "", "exit status 1"); err != nil {
+		t.Fatal(err)
+	}
+
+	if code := Explain(0, 1); code != 0 {
+		t.Errorf("Explain(0, 1) = %d, want 0", code)
+	}
+	if code := Explain(1, 2); code != 1 {
+		t.Errorf("Explain of a missing step = %d, want 1", code)
+	}
+	if code := Explain(2, 1); code != 1 {
+		t.Errorf("Explain of a missing run = %d, want 1", code)
+	}
+}
+
+func TestSplitRuleOutput(t *testing.T) {
+	stdout, stderr := splitRuleOutput("=== STDOUT ===\nhello\n\n=== STDERR ===\nboom\n")
+	if stdout != "hello" || stderr != "boom" {
+		t.Errorf("splitRuleOutput = %q, %q", stdout, stderr)
+	}
+}
@@ -79,6 +79,7 @@ type toolNeeds struct {
 	mise   bool
 	asdf   bool
 	ollama bool
+	mas    bool
 }
 
 func detectToolNeeds(rules []parser.Rule, osName string) toolNeeds {
@@ -103,6 +104,9 @@ func detectToolNeeds(rules []parser.Rule, osName string) toolNeeds {
 			}
 		case "ollama":
 			t.ollama = true
+		case "mas":
+			t.mas = true
+			t.brew = true // mas is installed via brew
 		}
 	}
 	return t
@@ -110,7 +114,7 @@ func detectToolNeeds(rules []parser.Rule, osName string) toolNeeds {
 
 func writePrerequisites(b *strings.Builder, rules []parser.Rule, osName string) {
 	needs := detectToolNeeds(rules, osName)
-	if !needs.brew && !needs.mise && !needs.asdf && !needs.ollama {
+	if !needs.brew && !needs.mise && !needs.asdf && !needs.ollama && !needs.mas {
 		return
 	}
 
@@ -171,6 +175,13 @@ fi
 `)
 	}
 
+	if needs.mas {
+		b.WriteString(`if ! command_exists mas; then
+  brew install mas
+fi
+`)
+	}
+
 	b.WriteString("\n")
 }
 
@@ -0,0 +1,162 @@
+package engine
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	handlerskg "github.com/elpic/blueprint/internal/handlers"
+	"github.com/elpic/blueprint/internal/parser"
+	"github.com/elpic/blueprint/internal/ui"
+)
+
+// ScriptOptions selects what `blueprint export-script` writes.
+type ScriptOptions struct {
+	Format    string            // "sh" (default) or "bash"
+	OS        string            // system the script is for; "" for this one
+	Arch      string            // architecture the script is for; "" for this one
+	Output    string            // file to write; "" for stdout
+	Vars      map[string]string // --var overrides
+	PreferSSH bool
+}
+
+// ExportScript implements `blueprint export-script`: it writes the commands
+// of file as a plain shell script, for machines where the blueprint binary
+// cannot be installed. Unlike export, the script has no progress display or
+// log redirection, just each rule's commands in apply order under a comment
+// naming the rule and where it was written. It returns an exit code.
+func ExportScript(file string, opts ScriptOptions) int {
+	if opts.OS == "" {
+		opts.OS = getOSName()
+	}
+	if opts.Arch == "" {
+		opts.Arch = getArchName()
+	}
+	if !IsValidOSName(opts.OS) {
+		fmt.Fprintf(os.Stderr, "%s\n", ui.FormatError(fmt.Sprintf("unknown OS %q", opts.OS)))
+		return 1
+	}
+	if !IsValidArchName(opts.Arch) {
+		fmt.Fprintf(os.Stderr, "%s\n", ui.FormatError(fmt.Sprintf("unknown architecture %q", opts.Arch)))
+		return 1
+	}
+
+	setupPath, _, cleanup, err := resolveBlueprintFile(file, false, opts.PreferSSH)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", ui.FormatError(fmt.Sprintf("Error: %v", err)))
+		return 1
+	}
+	defer cleanup()
+
+	script, err := plainScript(setupPath, file, opts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", ui.FormatError(err.Error()))
+		return 1
+	}
+	if opts.Output == "" {
+		fmt.Print(script)
+		return 0
+	}
+	if err := os.WriteFile(opts.Output, []byte(script), 0o700); err != nil { // #nosec G306 -- exported shell script must be executable
+		fmt.Fprintf(os.Stderr, "%s\n", ui.FormatError(fmt.Sprintf("Error writing file: %v", err)))
+		return 1
+	}
+	fmt.Fprintf(os.Stderr, "%s\n", ui.FormatSuccess(fmt.Sprintf("Exported to %s", opts.Output)))
+	return 0
+}
+
+// plainScript returns the script of the blueprint at path, named name in its
+// header: variables resolved, rules for other systems dropped and the rest
+// in dependency order.
+func plainScript(path, name string, opts ScriptOptions) (string, error) {
+	rules, err := parser.ParseFile(path)
+	if err != nil {
+		return "", fmt.Errorf("parse error: %w", err)
+	}
+	vars := resolveVarMap(rules, opts.Vars)
+	for i, r := range rules {
+		rules[i] = interpolateRule(r, vars)
+	}
+	ordered, err := resolveDependencies(filterRulesFor(rules, opts.OS, opts.Arch))
+	if err != nil {
+		return "", err
+	}
+	// Variables are already substituted into the commands
+	var sorted []parser.Rule
+	for _, rule := range ordered {
+		if rule.Action != "var" {
+			sorted = append(sorted, rule)
+		}
+	}
+
+	format := opts.Format
+	if format == "" {
+		format = "sh"
+	}
+	var b strings.Builder
+	if format == "bash" {
+		b.WriteString("#!/bin/bash\n")
+	} else {
+		b.WriteString("#!/bin/sh\n")
+	}
+	fmt.Fprintf(&b, "# Generated by blueprint export-script from %s for %s/%s.\n", name, opts.OS, opts.Arch)
+	b.WriteString("# Each block holds the commands of one rule, in the order blueprint apply\n")
+	b.WriteString("# runs them; its comment names the rule and where it is written.\n")
+	if format == "bash" {
+		b.WriteString("set -euo pipefail\n\n")
+	} else {
+		b.WriteString("set -eu\n\n")
+	}
+	if needs := detectToolNeeds(sorted, opts.OS); needs != (toolNeeds{}) {
+		b.WriteString("command_exists() { command -v \"$1\" >/dev/null 2>&1; }\n\n")
+		writePrerequisites(&b, sorted, opts.OS)
+	}
+
+	base := filepath.Dir(path)
+	for i, rule := range sorted {
+		writePlainRule(&b, rule, i+1, len(sorted), name, base, format, opts.OS)
+	}
+	return b.String(), nil
+}
+
+// writePlainRule writes the comment mapping a rule back to the blueprint and
+// its commands. A rule that cannot run without blueprint is written as a
+// comment telling how to apply it from the blueprint named name.
+func writePlainRule(b *strings.Builder, rule parser.Rule, index, total int, name, base, format, osName string) {
+	fmt.Fprintf(b, "# [%d/%d] %s %s\n", index, total, rule.Action, handlerskg.RuleSummary(rule))
+	var origin []string
+	if rule.SourceFile != "" {
+		source := rule.SourceFile
+		if rel, err := filepath.Rel(base, source); err == nil && !strings.HasPrefix(rel, "..") {
+			source = rel
+		}
+		origin = append(origin, fmt.Sprintf("%s:%d", source, rule.SourceLine))
+	}
+	if rule.ID != "" {
+		origin = append(origin, "id: "+rule.ID)
+	}
+	if len(rule.After) > 0 {
+		origin = append(origin, "after: "+strings.Join(rule.After, ", "))
+	}
+	if len(origin) > 0 {
+		fmt.Fprintf(b, "#   %s\n", strings.Join(origin, ", "))
+	}
+
+	var lines []string
+	if def := handlerskg.GetAction(rule.Action); def != nil && def.ShellExport != nil {
+		lines = def.ShellExport(rule, format, osName)
+	}
+	if lines == nil {
+		fmt.Fprintf(b, "# SKIP: %s cannot run without blueprint", rule.Action)
+		if rule.ID != "" {
+			fmt.Fprintf(b, "; apply it with: blueprint apply %s --only %s", name, rule.ID)
+		}
+		b.WriteString("\n\n")
+		return
+	}
+	for _, line := range lines {
+		b.WriteString(line + "\n")
+	}
+	b.WriteString("\n")
+}
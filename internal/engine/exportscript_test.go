@@ -0,0 +1,47 @@
+package engine
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPlainScript(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "s.bp")
+	blueprint := "var tools = curl git\n" +
+		"run echo done after: tools-pkg id: finish\n" +
+		"install ${tools} id: tools-pkg on: [linux]\n" +
+		"decrypt secret.enc to: ~/.secret id: sec\n" +
+		"mkdir ~/mac-only on: [mac]\n"
+	if err := os.WriteFile(path, []byte(blueprint), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	script, err := plainScript(path, "s.bp", ScriptOptions{Format: "sh", OS: "linux", Arch: "amd64"})
+	if err != nil {
+		t.Fatalf("plainScript() error = %v", err)
+	}
+	if !strings.HasPrefix(script, "#!/bin/sh\n") || !strings.Contains(script, "set -eu\n") {
+		t.Errorf("script does not start as a POSIX sh script:\n%s", script)
+	}
+	if strings.Contains(script, "var tools") {
+		t.Errorf("script has a block for the var rule:\n%s", script)
+	}
+	if strings.Contains(script, "mac-only") {
+		t.Errorf("script has the mac-only rule on linux:\n%s", script)
+	}
+
+	install := strings.Index(script, "s.bp:3, id: tools-pkg")
+	finish := strings.Index(script, "s.bp:2, id: finish, after: tools-pkg")
+	if install < 0 || finish < 0 || install > finish {
+		t.Errorf("want the install (s.bp:3) before the run after it (s.bp:2):\n%s", script)
+	}
+	if !strings.Contains(script, "curl") || strings.Contains(script, "${tools}") {
+		t.Errorf("var tools not resolved in the install commands:\n%s", script)
+	}
+	if !strings.Contains(script, "# SKIP: decrypt cannot run without blueprint; apply it with: blueprint apply s.bp --only sec") {
+		t.Errorf("decrypt rule not written as a skip comment:\n%s", script)
+	}
+}
@@ -0,0 +1,102 @@
+package engine
+
+import (
+	"fmt"
+	"slices"
+
+	handlerskg "github.com/elpic/blueprint/internal/handlers"
+	"github.com/elpic/blueprint/internal/parser"
+	"github.com/elpic/blueprint/internal/ui"
+	"github.com/elpic/blueprint/internal/ui/timeutil"
+)
+
+// A rule with on-failure: names a fallback, a rule that runs only when the
+// first one fails and then stands in for it: "install neovim on-failure:
+// build-neovim". The fallback runs after the rule it backs up, and rules
+// that run after that one wait for the fallback too, so they run once either
+// of the two has done the job.
+
+// dependencyRef returns the after: entry that names r.
+func dependencyRef(r parser.Rule) string {
+	if r.ID != "" {
+		return r.ID
+	}
+	return handlerskg.RuleKey(r)
+}
+
+// linkFallbacks returns rules with the after: entries their fallbacks need:
+// each fallback runs after the rule naming it, and the rules after that rule
+// also run after its fallback. rules itself is left as it is.
+func linkFallbacks(rules []parser.Rule) []parser.Rule {
+	if !slices.ContainsFunc(rules, func(r parser.Rule) bool { return r.OnFailure != "" }) {
+		return rules
+	}
+	index := dependencyIndex(rules)
+	linked := slices.Clone(rules)
+	for i := range linked {
+		linked[i].After = slices.Clone(linked[i].After)
+	}
+	for p, r := range rules {
+		f, ok := index[r.OnFailure]
+		if r.OnFailure == "" || !ok || f == p {
+			continue
+		}
+		linked[f].After = append(linked[f].After, dependencyRef(r))
+		for k, other := range rules {
+			if k == f || k == p {
+				continue
+			}
+			for _, dep := range other.After {
+				if j, ok := index[dep]; ok && j == p {
+					linked[k].After = append(linked[k].After, dependencyRef(rules[f]))
+					break
+				}
+			}
+		}
+	}
+	return linked
+}
+
+// fallbackPrimaries maps the index of each fallback in ordered to the index
+// of the rule it backs up. A rule whose fallback is not in the run has none.
+func fallbackPrimaries(ordered []parser.Rule) map[int]int {
+	primaries := map[int]int{}
+	graph := newDependencyGraph(ordered)
+	for p, r := range ordered {
+		if r.OnFailure == "" {
+			continue
+		}
+		f, ok := graph.lookup(r.OnFailure)
+		if !ok || f == p {
+			continue
+		}
+		if _, taken := primaries[f]; !taken {
+			primaries[f] = p
+		}
+	}
+	return primaries
+}
+
+// fallbackNotNeededResult builds the result for a fallback whose rule did not
+// fail, so it did not have to run.
+func fallbackNotNeededResult(rule parser.Rule, primary parser.Rule, globalIndex int, number, blueprint, osName, basePath string) ruleResult {
+	var actualCmd string
+	if handler := handlerskg.NewHandler(rule, basePath, passwordCache.snapshot()); handler != nil {
+		actualCmd = handler.GetCommand()
+	}
+	output := fmt.Sprintf("%s %s %s\n", number, ui.FormatHighlight(rule.Action), ui.FormatDim("Not needed ("+ruleLabel(primary)+" succeeded)"))
+	return ruleResult{
+		globalIndex: globalIndex,
+		record: ExecutionRecord{
+			Timestamp:   timeutil.Now(),
+			Blueprint:   blueprint,
+			OS:          osName,
+			Command:     actualCmd,
+			Status:      statusSkipped,
+			Error:       fmt.Sprintf("fallback not needed: %s succeeded", ruleLabel(primary)),
+			Group:       rule.Group,
+			FallbackFor: ruleLabel(primary),
+		},
+		output: output,
+	}
+}
@@ -0,0 +1,67 @@
+package engine
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/elpic/blueprint/internal/parser"
+)
+
+func TestExecuteRulesRunsFallbackOnFailure(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	dir := t.TempDir()
+	blocker := filepath.Join(dir, "file")
+	if err := os.WriteFile(blocker, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	run := func(primary string) map[string]ExecutionRecord {
+		t.Helper()
+		rules := []parser.Rule{
+			{ID: "dep", Action: "mkdir", Mkdir: filepath.Join(dir, "dep"), After: []string{"primary"}},
+			{ID: "primary", Action: "mkdir", Mkdir: primary, OnFailure: "fallback"},
+			{ID: "fallback", Action: "mkdir", Mkdir: filepath.Join(dir, "fallback")},
+		}
+		records := executeRules(rules, "/tmp/test.bp", "linux", "/tmp", 0)
+		ordered, err := executionOrder(rules)
+		if err != nil {
+			t.Fatal(err)
+		}
+		byID := map[string]ExecutionRecord{}
+		for i, r := range ordered {
+			byID[r.ID] = records[i]
+		}
+		return byID
+	}
+
+	// The primary rule fails: its fallback runs and the rule after it too
+	got := run(filepath.Join(blocker, "sub"))
+	if got["primary"].Status != "error" || got["primary"].SatisfiedBy != "fallback" {
+		t.Errorf("primary = %+v, want an error satisfied by the fallback", got["primary"])
+	}
+	if got["fallback"].Status != "success" || got["fallback"].FallbackFor != "primary" {
+		t.Errorf("fallback = %+v, want it run in place of primary", got["fallback"])
+	}
+	if got["dep"].Status != "success" {
+		t.Errorf("dep = %+v, want it run once the fallback succeeded", got["dep"])
+	}
+
+	// The primary rule succeeds: the fallback is not needed
+	if err := os.Remove(filepath.Join(dir, "fallback")); err != nil {
+		t.Fatal(err)
+	}
+	got = run(filepath.Join(dir, "primary"))
+	if got["primary"].Status != "success" || got["primary"].SatisfiedBy != "" {
+		t.Errorf("primary = %+v, want success", got["primary"])
+	}
+	if got["fallback"].Status != statusSkipped || got["fallback"].FallbackFor != "primary" {
+		t.Errorf("fallback = %+v, want it skipped as not needed", got["fallback"])
+	}
+	if _, err := os.Stat(filepath.Join(dir, "fallback")); err == nil {
+		t.Error("the fallback ran although primary succeeded")
+	}
+	if got["dep"].Status != "success" {
+		t.Errorf("dep = %+v, want success", got["dep"])
+	}
+}
@@ -0,0 +1,43 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// fileLockStale is how old a lock file may get before it is taken to be left
+// by a process that died holding it.
+const fileLockStale = 30 * time.Second
+
+// fileLockTimeout is how long withFileLock waits for another process to
+// release the lock.
+const fileLockTimeout = 10 * time.Second
+
+// withFileLock runs fn while holding the lock file path, which it creates
+// exclusively, so processes sharing the blueprint directory run fn one at a
+// time. It works the same on every OS, unlike flock.
+func withFileLock(path string, fn func() error) error {
+	deadline := time.Now().Add(fileLockTimeout)
+	for {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600) // #nosec G304 -- lock file in the blueprint directory
+		if err == nil {
+			_ = f.Close()
+			break
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return fmt.Errorf("failed to lock %s: %w", path, err)
+		}
+		if info, err := os.Stat(path); err == nil && time.Since(info.ModTime()) > fileLockStale {
+			_ = os.Remove(path)
+			continue
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("failed to lock %s: held by another blueprint for over %s", path, fileLockTimeout)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	defer os.Remove(path) //nolint:errcheck // a leftover lock goes stale
+	return fn()
+}
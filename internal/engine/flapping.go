@@ -0,0 +1,118 @@
+package engine
+
+import (
+	"fmt"
+	"slices"
+
+	handlerskg "github.com/elpic/blueprint/internal/handlers"
+	"github.com/elpic/blueprint/internal/parser"
+	"github.com/elpic/blueprint/internal/ui"
+)
+
+// detectFlapping is set by `apply --detect-flapping`: every rule is checked
+// for convergence, not only the ones asserting expect-changed: false.
+var detectFlapping bool
+
+// SetDetectFlapping turns on the convergence check of every rule of a run.
+func SetDetectFlapping(on bool) {
+	detectFlapping = on
+}
+
+// flappingLookback bounds how many earlier runs are searched for the
+// previous run of a rule.
+const flappingLookback = 20
+
+// markFlapping sets Flapping on the records of rules that changed something
+// although an earlier run with the very same command, so with nothing
+// edited, already put them in place. A rule that converges finds nothing to
+// do the second time; one that changes on every run has broken idempotency,
+// such as a run: rule without unless:. Rules asserting expect-changed: false
+// are always checked, every other rule with --detect-flapping, and rules
+// with expect-changed: true never. It returns the rules flagged.
+func markFlapping(rules []parser.Rule, records []ExecutionRecord, runNumber int) []parser.Rule {
+	ordered, err := runRules(rules, records)
+	if err != nil || len(ordered) != len(records) {
+		return nil
+	}
+	var checked []int
+	for i, rule := range ordered {
+		if records[i].Changed && rule.Action != "uninstall" && expectsConvergence(rule) {
+			checked = append(checked, i)
+		}
+	}
+	if len(checked) == 0 {
+		return nil
+	}
+
+	previous := previousRecords(runNumber)
+	var flapping []parser.Rule
+	for _, i := range checked {
+		prior, ok := previous[[2]string{records[i].Blueprint, records[i].Command}]
+		if !ok || prior.Status != "success" {
+			continue
+		}
+		// Without the assertion, only a rule that changed both times flaps:
+		// it may have found nothing to do before something outside blueprint
+		// undid it
+		if ordered[i].ExpectChanged != "false" && !prior.Changed {
+			continue
+		}
+		records[i].Flapping = true
+		flapping = append(flapping, ordered[i])
+	}
+	return flapping
+}
+
+// expectsConvergence reports whether rule is checked for flapping.
+func expectsConvergence(rule parser.Rule) bool {
+	switch rule.ExpectChanged {
+	case "false":
+		return true
+	case "true":
+		return false
+	}
+	return detectFlapping
+}
+
+// previousRecords returns the latest record of each blueprint and command in
+// the runs before runNumber, searching at most flappingLookback runs back.
+func previousRecords(runNumber int) map[[2]string]ExecutionRecord {
+	previous := map[[2]string]ExecutionRecord{}
+	entries, err := readHistoryIndex()
+	if err != nil {
+		return previous
+	}
+	slices.Reverse(entries)
+	searched := 0
+	for _, entry := range entries {
+		if entry.Run >= runNumber {
+			continue
+		}
+		if searched++; searched > flappingLookback {
+			break
+		}
+		records, err := loadRunRecords(entry.Run)
+		if err != nil {
+			continue
+		}
+		for _, record := range records {
+			key := [2]string{record.Blueprint, record.Command}
+			if _, seen := previous[key]; !seen && record.Command != "" {
+				previous[key] = record
+			}
+		}
+	}
+	return previous
+}
+
+// displayFlapping lists the rules markFlapping flagged after a run.
+func displayFlapping(flapping []parser.Rule) {
+	if len(flapping) == 0 {
+		return
+	}
+	fmt.Printf("%s\n", ui.FormatError(fmt.Sprintf("%d rule(s) changed something again with nothing edited; they do not converge:", len(flapping))))
+	for _, rule := range flapping {
+		fmt.Printf("  %s %s\n", ui.FormatHighlight(rule.Action), ui.FormatInfo(handlerskg.RuleSummary(rule)))
+	}
+	fmt.Printf("%s\n", ui.FormatDim("Make them check whether there is anything to do (e.g. unless: on run rules), or mark them expect-changed: true."))
+}
@@ -0,0 +1,59 @@
+package engine
+
+import (
+	"testing"
+
+	"github.com/elpic/blueprint/internal/parser"
+)
+
+func TestMarkFlapping(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Cleanup(func() { SetDetectFlapping(false) })
+
+	rules := []parser.Rule{
+		{Action: "run", RunCommand: "echo a", ID: "a"},
+		{Action: "run", RunCommand: "echo b", ID: "b", ExpectChanged: "false"},
+		{Action: "run", RunCommand: "echo c", ID: "c", ExpectChanged: "true"},
+		{Action: "run", RunCommand: "echo d", ID: "d"},
+	}
+	record := func(cmd string, changed bool) ExecutionRecord {
+		return ExecutionRecord{Blueprint: "/tmp/setup.bp", Command: cmd, Status: "success", Changed: changed}
+	}
+	// The first run applied a, b and c; d found nothing to do
+	if err := saveHistory(1, []ExecutionRecord{record("echo a", true), record("echo b", false), record("echo c", true), record("echo d", false)}); err != nil {
+		t.Fatal(err)
+	}
+	second := func() []ExecutionRecord {
+		return []ExecutionRecord{record("echo a", true), record("echo b", true), record("echo c", true), record("echo d", true)}
+	}
+
+	// Without --detect-flapping only the assertion of b is checked
+	records := second()
+	flapping := markFlapping(rules, records, 2)
+	if len(flapping) != 1 || flapping[0].ID != "b" || !records[1].Flapping {
+		t.Errorf("markFlapping() = %+v, want only b", flapping)
+	}
+
+	// With it, a changed both times too; c is exempt and d changed only now
+	SetDetectFlapping(true)
+	records = second()
+	flapping = markFlapping(rules, records, 2)
+	var ids []string
+	for _, r := range flapping {
+		ids = append(ids, r.ID)
+	}
+	if len(ids) != 2 || ids[0] != "a" || ids[1] != "b" {
+		t.Errorf("markFlapping() with --detect-flapping = %v, want [a b]", ids)
+	}
+	if records[2].Flapping || records[3].Flapping {
+		t.Errorf("records of c and d marked flapping: %+v", records)
+	}
+
+	// An edited command is a new rule, not a flapping one
+	rules[0].RunCommand = "echo a2"
+	records = second()
+	records[0].Command = "echo a2"
+	if flapping := markFlapping(rules, records, 2); len(flapping) != 1 {
+		t.Errorf("markFlapping() after editing a = %+v, want only b", flapping)
+	}
+}
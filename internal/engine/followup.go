@@ -0,0 +1,114 @@
+package engine
+
+import (
+	"fmt"
+	"path/filepath"
+
+	handlerskg "github.com/elpic/blueprint/internal/handlers"
+	"github.com/elpic/blueprint/internal/logging"
+	"github.com/elpic/blueprint/internal/parser"
+	"github.com/elpic/blueprint/internal/ui"
+)
+
+// maxFollowUpDepth bounds how deeply follow-up rules may nest: rules emitted
+// by a follow-up rule are at depth 2, and so on. It stops a repository whose
+// blueprint clones another one that clones it back from running forever.
+const maxFollowUpDepth = 5
+
+// followUpBatch holds the rules one rule emitted (see
+// handlerskg.FollowUpProvider), by its index in record order.
+type followUpBatch struct {
+	emitter int
+	rules   []parser.Rule
+}
+
+// prepareFollowUps readies the rules a handler emitted the way
+// loadBlueprints readies a blueprint: ${VAR} references are interpolated and
+// rules for other platforms dropped. The remaining rules are checked the way
+// plan checks them, so a broken blueprint fails the rule that emitted it
+// rather than whichever of its rules runs first.
+func prepareFollowUps(rules []parser.Rule, osName string) ([]parser.Rule, error) {
+	if len(rules) == 0 {
+		return nil, nil
+	}
+	overrides, err := withMachineVars(nil)
+	if err != nil {
+		return nil, err
+	}
+	vars := resolveVarMap(rules, overrides)
+	for i, r := range rules {
+		rules[i] = interpolateRule(r, vars)
+	}
+	rules = filterRulesFor(rules, osName, getArchName())
+	if issues := checkHandlers(rules); len(issues) > 0 {
+		return nil, fmt.Errorf("follow-up rules: %s", issues[0])
+	}
+	if _, err := resolveDependencies(rules); err != nil {
+		return nil, fmt.Errorf("follow-up rules: %w", err)
+	}
+	return rules, nil
+}
+
+// acceptFollowUps picks the emitted rules that join the run, with the
+// directory each resolves relative paths against (its blueprint's) and its
+// depth. Rules for a resource the run already has are left out, so a
+// blueprint applying itself does not loop; so are rules nested deeper than
+// maxFollowUpDepth and rules naming a transaction: the run already uses.
+func acceptFollowUps(batches []followUpBatch, ordered []parser.Rule, bases []string, depths []int, txns map[string]*transaction) (rules []parser.Rule, ruleBases []string, ruleDepths []int) {
+	seen := map[string]bool{}
+	for _, r := range ordered {
+		seen[followUpResource(r)] = true
+	}
+	for _, batch := range batches {
+		emitter := ordered[batch.emitter]
+		depth := depths[batch.emitter] + 1
+		if depth > maxFollowUpDepth {
+			fmt.Printf("%s\n", ui.FormatError(fmt.Sprintf("Ignoring the follow-up rules of %s %s: nested more than %d levels deep", emitter.Action, handlerskg.RuleSummary(emitter), maxFollowUpDepth)))
+			continue
+		}
+		for _, rule := range batch.rules {
+			key := followUpResource(rule)
+			if seen[key] {
+				logging.Debugf("follow-up rule %s is already part of the run", key)
+				continue
+			}
+			if rule.Transaction != "" && txns[rule.Transaction] != nil {
+				fmt.Printf("%s\n", ui.FormatError(fmt.Sprintf("Ignoring follow-up rule %s %s: transaction %s is already used by the run", rule.Action, handlerskg.RuleSummary(rule), rule.Transaction)))
+				continue
+			}
+			seen[key] = true
+			base := bases[batch.emitter]
+			if rule.SourceFile != "" {
+				base = filepath.Dir(rule.SourceFile)
+			}
+			rules = append(rules, rule)
+			ruleBases = append(ruleBases, base)
+			ruleDepths = append(ruleDepths, depth)
+		}
+	}
+	return rules, ruleBases, ruleDepths
+}
+
+// followUpResource identifies what a rule manages regardless of its id:, so
+// a follow-up rule is recognized as part of the run whatever it is named.
+func followUpResource(rule parser.Rule) string {
+	if address := handlerskg.RuleAddress(rule); address != rule.Action {
+		return address
+	}
+	return handlerskg.RuleKey(rule)
+}
+
+// runRules returns the rules records were made for: rules in execution
+// order, followed by the follow-up rules handlers added to the run.
+func runRules(rules []parser.Rule, records []ExecutionRecord) ([]parser.Rule, error) {
+	ordered, err := executionOrder(rules)
+	if err != nil {
+		return nil, err
+	}
+	for _, record := range records {
+		if record.followUp != nil {
+			ordered = append(ordered, *record.followUp)
+		}
+	}
+	return ordered, nil
+}
@@ -0,0 +1,95 @@
+package engine
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	gitpkg "github.com/elpic/blueprint/internal/git"
+	"github.com/elpic/blueprint/internal/parser"
+)
+
+// stubClone makes clone rules write blueprint as the repository's
+// .blueprint.bp instead of cloning anything.
+func stubClone(t *testing.T, blueprint string) {
+	t.Helper()
+	orig := gitpkg.CloneOrUpdateRepositoryTwoStage
+	t.Cleanup(func() { gitpkg.CloneOrUpdateRepositoryTwoStage = orig })
+	gitpkg.CloneOrUpdateRepositoryTwoStage = func(url, path, branch string) (string, string, string, error) {
+		if err := os.MkdirAll(path, 0o755); err != nil {
+			return "", "", "", err
+		}
+		return "", "", "Cloned", os.WriteFile(filepath.Join(path, parser.DefaultCloneBlueprint), []byte(blueprint), 0o600)
+	}
+}
+
+func TestExecuteRulesAppliesFollowUpRules(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	dir := t.TempDir()
+	repo := filepath.Join(dir, "repo")
+	made := filepath.Join(dir, "made")
+	// The repository's blueprint also clones itself, which must not loop
+	stubClone(t, "mkdir "+made+"\nclone https://example.com/repo.git to: "+repo+" apply: true\n")
+
+	rules := []parser.Rule{{ID: "repo", Action: "clone", CloneURL: "https://example.com/repo.git", ClonePath: repo, CloneApply: parser.DefaultCloneBlueprint}}
+	records := executeRules(rules, "/tmp/test.bp", getOSName(), dir, 0)
+
+	if len(records) != 2 {
+		t.Fatalf("got %d records, want the clone and its follow-up mkdir: %+v", len(records), records)
+	}
+	for _, r := range records {
+		if r.Status != "success" {
+			t.Errorf("record %+v did not succeed", r)
+		}
+	}
+	if _, err := os.Stat(made); err != nil {
+		t.Errorf("follow-up mkdir did not run: %v", err)
+	}
+
+	ordered, err := runRules(rules, records)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ordered) != 2 || ordered[1].Action != "mkdir" || ordered[1].Mkdir != made {
+		t.Errorf("runRules() = %+v, want the clone followed by the mkdir", ordered)
+	}
+}
+
+func TestExecuteRulesFailsRuleWithBrokenFollowUps(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	dir := t.TempDir()
+	stubClone(t, "not a rule\n")
+
+	rules := []parser.Rule{{ID: "repo", Action: "clone", CloneURL: "https://example.com/repo.git", ClonePath: filepath.Join(dir, "repo"), CloneApply: parser.DefaultCloneBlueprint}}
+	records := executeRules(rules, "/tmp/test.bp", getOSName(), dir, 0)
+
+	if len(records) != 1 || records[0].Status != "error" || !strings.Contains(records[0].Error, parser.DefaultCloneBlueprint) {
+		t.Errorf("records = %+v, want the clone failed on its blueprint", records)
+	}
+}
+
+func TestAcceptFollowUps(t *testing.T) {
+	ordered := []parser.Rule{
+		{Action: "clone", CloneURL: "https://example.com/a.git", ClonePath: "/tmp/a"},
+		{Action: "clone", CloneURL: "https://example.com/b.git", ClonePath: "/tmp/b"},
+	}
+	bases := []string{"/base", "/base"}
+	depths := []int{0, maxFollowUpDepth}
+	batches := []followUpBatch{
+		{emitter: 0, rules: []parser.Rule{
+			{Action: "mkdir", Mkdir: "/tmp/a/x", SourceFile: "/tmp/a/.blueprint.bp"},
+			{Action: "clone", CloneURL: "https://example.com/b.git", ClonePath: "/tmp/b"}, // already in the run
+			{Action: "mkdir", Mkdir: "/tmp/a/x"},                                          // emitted twice
+		}},
+		{emitter: 1, rules: []parser.Rule{{Action: "mkdir", Mkdir: "/tmp/b/x"}}}, // too deep
+	}
+
+	rules, ruleBases, ruleDepths := acceptFollowUps(batches, ordered, bases, depths, map[string]*transaction{})
+	if len(rules) != 1 || rules[0].Mkdir != "/tmp/a/x" {
+		t.Fatalf("accepted %+v, want only the first mkdir", rules)
+	}
+	if ruleBases[0] != "/tmp/a" || ruleDepths[0] != 1 {
+		t.Errorf("base %q depth %d, want the blueprint's directory at depth 1", ruleBases[0], ruleDepths[0])
+	}
+}
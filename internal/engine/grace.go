@@ -0,0 +1,216 @@
+package engine
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	handlerskg "github.com/elpic/blueprint/internal/handlers"
+	"github.com/elpic/blueprint/internal/parser"
+	"github.com/elpic/blueprint/internal/ui"
+	"github.com/elpic/blueprint/internal/ui/timeutil"
+)
+
+// CleanupGraceEnv names the environment variable holding the default cleanup
+// grace period; apply --cleanup-grace overrides it.
+const CleanupGraceEnv = "BLUEPRINT_CLEANUP_GRACE"
+
+// CleanupGrace is how long a resource must have been missing from its
+// blueprint before apply auto-uninstalls it: a number of consecutive applies,
+// or a minimum age. The zero value uninstalls on the first apply, as before.
+type CleanupGrace struct {
+	Applies int
+	Age     time.Duration
+}
+
+// ParseCleanupGrace parses "3" (three consecutive applies), "7d" (seven days)
+// or a Go duration such as "36h". An empty string is the zero grace.
+func ParseCleanupGrace(s string) (CleanupGrace, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return CleanupGrace{}, nil
+	}
+	if n, err := strconv.Atoi(s); err == nil {
+		if n < 1 {
+			return CleanupGrace{}, fmt.Errorf("cleanup grace must be at least 1 apply, got %q", s)
+		}
+		return CleanupGrace{Applies: n}, nil
+	}
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		if n, err := strconv.Atoi(days); err == nil && n > 0 {
+			return CleanupGrace{Age: time.Duration(n) * 24 * time.Hour}, nil
+		}
+	}
+	if d, err := time.ParseDuration(s); err == nil && d > 0 {
+		return CleanupGrace{Age: d}, nil
+	}
+	return CleanupGrace{}, fmt.Errorf("cleanup grace must be a number of applies (3) or an age (7d, 36h), got %q", s)
+}
+
+// IsZero reports whether removals happen on the first apply that misses them.
+func (g CleanupGrace) IsZero() bool {
+	return g.Applies <= 1 && g.Age == 0
+}
+
+func (g CleanupGrace) String() string {
+	if g.Age > 0 {
+		if g.Age%(24*time.Hour) == 0 {
+			return fmt.Sprintf("%dd", g.Age/(24*time.Hour))
+		}
+		return g.Age.String()
+	}
+	return fmt.Sprintf("%d applies", g.Applies)
+}
+
+// due reports whether a removal tracked by p is past the grace period.
+func (g CleanupGrace) due(p handlerskg.PendingRemoval, now time.Time) bool {
+	if g.Age > 0 {
+		since, err := timeutil.Parse(p.MissingSince)
+		return err != nil || now.Sub(since) >= g.Age
+	}
+	return p.Applies >= g.Applies
+}
+
+// heldRemoval is an auto-uninstall rule held back by the grace period.
+type heldRemoval struct {
+	rule    parser.Rule
+	pending handlerskg.PendingRemoval
+}
+
+// removalIdentity returns the action and resource an uninstall rule removes.
+func removalIdentity(rule parser.Rule) (string, string) {
+	action := handlerskg.DetectRuleType(rule)
+	if def := handlerskg.GetAction(action); def != nil && def.RuleKey != nil {
+		return action, def.RuleKey(rule)
+	}
+	return action, handlerskg.RuleKey(rule)
+}
+
+// applyCleanupGrace counts this apply against every resource the
+// auto-uninstall rules would remove and splits them into the rules due now
+// and the ones held back. Install rules are split per package, so each
+// package has its own count. pending is the whole PendingRemovals list; the
+// returned list replaces the entries for blueprint and osName, dropping
+// resources that are back in the blueprint.
+func applyCleanupGrace(rules []parser.Rule, pending []handlerskg.PendingRemoval, blueprint, osName string, grace CleanupGrace, now time.Time) ([]parser.Rule, []heldRemoval, []handlerskg.PendingRemoval) {
+	blueprint = handlerskg.NormalizeBlueprint(blueprint)
+
+	previous := map[string]handlerskg.PendingRemoval{}
+	var next []handlerskg.PendingRemoval
+	for _, p := range pending {
+		if handlerskg.NormalizeBlueprint(p.Blueprint) == blueprint && p.OS == osName {
+			previous[p.Action+"\x00"+p.Resource] = p
+		} else {
+			next = append(next, p)
+		}
+	}
+
+	var due []parser.Rule
+	var held []heldRemoval
+	for _, rule := range rules {
+		units := []parser.Rule{rule}
+		if len(rule.Packages) > 1 {
+			units = units[:0]
+			for _, pkg := range rule.Packages {
+				unit := rule
+				unit.Packages = []parser.Package{pkg}
+				units = append(units, unit)
+			}
+		}
+
+		var duePackages []parser.Package
+		for _, unit := range units {
+			action, resource := removalIdentity(unit)
+			p, ok := previous[action+"\x00"+resource]
+			if !ok {
+				p = handlerskg.PendingRemoval{
+					Action:       action,
+					Resource:     resource,
+					Blueprint:    blueprint,
+					OS:           osName,
+					MissingSince: timeutil.Format(now),
+				}
+			}
+			p.Applies++
+			next = append(next, p)
+
+			switch {
+			case !grace.due(p, now):
+				held = append(held, heldRemoval{rule: unit, pending: p})
+			case len(rule.Packages) > 1:
+				duePackages = append(duePackages, unit.Packages...)
+			default:
+				due = append(due, unit)
+			}
+		}
+		if len(duePackages) > 0 {
+			merged := rule
+			merged.Packages = duePackages
+			due = append(due, merged)
+		}
+	}
+	return due, held, next
+}
+
+// holdBackRemovals applies the cleanup grace to the auto-uninstall rules of
+// an apply (or plan) of blueprint, and returns the rules due now, the ones
+// held back, and the PendingRemovals list to save after the apply. pending
+// is the current list, as recorded in status or as returned for another
+// blueprint of the same run.
+func holdBackRemovals(rules []parser.Rule, pending []handlerskg.PendingRemoval, blueprint, osName string, grace CleanupGrace) ([]parser.Rule, []heldRemoval, []handlerskg.PendingRemoval) {
+	if grace.IsZero() {
+		// Without a grace period nothing is pending; forget earlier counts
+		// for this blueprint so a later grace period starts from scratch.
+		_, _, next := applyCleanupGrace(nil, pending, blueprint, osName, grace, time.Now())
+		return rules, nil, next
+	}
+	return applyCleanupGrace(rules, pending, blueprint, osName, grace, time.Now())
+}
+
+// pendingOnMachine returns the pending removals recorded on machine, and
+// those recorded before machines were, when mine is set; the ones of other
+// machines otherwise. See handlerskg.OnMachine.
+func pendingOnMachine(pending []handlerskg.PendingRemoval, machine string, mine bool) []handlerskg.PendingRemoval {
+	var out []handlerskg.PendingRemoval
+	for _, p := range pending {
+		if (p.Machine == "" || p.Machine == machine) == mine {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// savePendingRemovals replaces the pending removals of this machine recorded
+// in status, leaving those of other machines alone.
+func savePendingRemovals(pending []handlerskg.PendingRemoval) error {
+	machine := machineID()
+	for i := range pending {
+		if pending[i].Machine == "" {
+			pending[i].Machine = machine
+		}
+	}
+	return updateStatus(func(status *handlerskg.Status) error {
+		status.PendingRemovals = append(pending, pendingOnMachine(status.PendingRemovals, machine, false)...)
+		return nil
+	})
+}
+
+// displayHeldRemovals lists the resources kept installed by the grace period.
+func displayHeldRemovals(held []heldRemoval, grace CleanupGrace) {
+	if len(held) == 0 {
+		return
+	}
+	fmt.Println(ui.FormatDim(fmt.Sprintf("─── Kept until the cleanup grace period (%s) has passed ───", grace)) + "\n")
+	for _, h := range held {
+		progress := fmt.Sprintf("missing for %d of %d applies", h.pending.Applies, grace.Applies)
+		if grace.Age > 0 {
+			progress = "missing since " + h.pending.MissingSince
+		}
+		fmt.Printf("  %s %s %s\n",
+			ui.FormatDim("○"),
+			ui.FormatInfo(fmt.Sprintf("%s %s", h.pending.Action, handlerskg.RuleSummary(h.rule))),
+			ui.FormatDim("("+progress+")"))
+	}
+	fmt.Println()
+}
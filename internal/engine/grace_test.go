@@ -0,0 +1,88 @@
+package engine
+
+import (
+	"testing"
+	"time"
+
+	handlerskg "github.com/elpic/blueprint/internal/handlers"
+	"github.com/elpic/blueprint/internal/parser"
+)
+
+func TestParseCleanupGrace(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    CleanupGrace
+		wantErr bool
+	}{
+		{in: "", want: CleanupGrace{}},
+		{in: "3", want: CleanupGrace{Applies: 3}},
+		{in: "7d", want: CleanupGrace{Age: 7 * 24 * time.Hour}},
+		{in: "36h", want: CleanupGrace{Age: 36 * time.Hour}},
+		{in: "0", wantErr: true},
+		{in: "-2d", wantErr: true},
+		{in: "soon", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseCleanupGrace(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseCleanupGrace(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseCleanupGrace(%q) = %+v, want %+v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestApplyCleanupGraceCountsApplies(t *testing.T) {
+	grace := CleanupGrace{Applies: 2}
+	now := time.Now()
+	removed := []parser.Rule{
+		{Action: "uninstall", Packages: []parser.Package{{Name: "git"}, {Name: "curl"}}, OSList: []string{"linux"}},
+		{Action: "uninstall", KnownHosts: "github.com", OSList: []string{"linux"}},
+	}
+	other := handlerskg.PendingRemoval{Action: "mkdir", Resource: "/tmp/x", Blueprint: "/other.bp", OS: "linux", Applies: 1}
+	// git was already missing on the previous apply
+	pending := []handlerskg.PendingRemoval{
+		other,
+		{Action: "install", Resource: "git", Blueprint: "/setup.bp", OS: "linux", Applies: 1},
+	}
+
+	due, held, next := applyCleanupGrace(removed, pending, "/setup.bp", "linux", grace, now)
+
+	if len(due) != 1 || len(due[0].Packages) != 1 || due[0].Packages[0].Name != "git" {
+		t.Errorf("due = %+v, want only git", due)
+	}
+	if len(held) != 2 || held[0].rule.Packages[0].Name != "curl" || held[1].rule.KnownHosts != "github.com" {
+		t.Errorf("held = %+v, want curl and github.com", held)
+	}
+	if len(next) != 4 || next[0] != other {
+		t.Fatalf("next = %+v, want the other blueprint's entry kept plus three", next)
+	}
+
+	// On the next apply curl and github.com are due; git is back in the blueprint
+	due, held, next = applyCleanupGrace(removed[:1], next, "/setup.bp", "linux", grace, now)
+	if len(held) != 0 || len(due) != 1 || len(due[0].Packages) != 2 {
+		t.Errorf("due = %+v, held = %+v, want git and curl merged into one due rule", due, held)
+	}
+	_, _, next = applyCleanupGrace(nil, next, "/setup.bp", "linux", grace, now)
+	if len(next) != 1 || next[0] != other {
+		t.Errorf("next = %+v, want only the other blueprint's entry once nothing is missing", next)
+	}
+}
+
+func TestApplyCleanupGraceByAge(t *testing.T) {
+	grace := CleanupGrace{Age: 7 * 24 * time.Hour}
+	now := time.Now()
+	removed := []parser.Rule{{Action: "uninstall", KnownHosts: "github.com", OSList: []string{"mac"}}}
+
+	due, held, next := applyCleanupGrace(removed, nil, "/setup.bp", "mac", grace, now)
+	if len(due) != 0 || len(held) != 1 {
+		t.Fatalf("due = %+v, held = %+v, want held on first sight", due, held)
+	}
+
+	due, _, _ = applyCleanupGrace(removed, next, "/setup.bp", "mac", grace, now.Add(8*24*time.Hour))
+	if len(due) != 1 {
+		t.Errorf("due = %+v, want github.com after eight days", due)
+	}
+}
@@ -0,0 +1,110 @@
+package engine
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/elpic/blueprint/internal/handlers"
+	"github.com/elpic/blueprint/internal/ui"
+)
+
+// PrintRuleHelp documents the rule actions from the handler registry: a list
+// of every action when action is "", or the usage, attributes, supported OSes
+// and examples of one action. Returns the process exit code.
+func PrintRuleHelp(action string) int {
+	if action == "" {
+		printRuleList()
+		return 0
+	}
+	def := handlers.GetAction(action)
+	if def == nil || def.IsAlias || def.Name == "uninstall" {
+		fmt.Fprintf(os.Stderr, "%s\n", ui.FormatError(fmt.Sprintf("Unknown action %q", action)))
+		fmt.Fprintf(os.Stderr, "Available actions: %s\n", strings.Join(documentedActionNames(), ", "))
+		return 1
+	}
+	printRuleDetail(def)
+	return 0
+}
+
+func documentedActionNames() []string {
+	var names []string
+	for _, def := range handlers.DocumentedActions() {
+		names = append(names, def.Name)
+	}
+	return names
+}
+
+func printRuleList() {
+	defs := handlers.DocumentedActions()
+	width := 0
+	for _, def := range defs {
+		width = max(width, len(def.Name))
+	}
+
+	fmt.Printf("\n%s\n\n", ui.FormatHighlight("=== Blueprint Rules ==="))
+	for _, def := range defs {
+		fmt.Printf("  %-*s  %s\n", width, def.Name, def.Meta.Summary)
+	}
+	fmt.Println("\nCommon attributes (accepted by every rule):")
+	printAttrs(handlers.CommonAttrs)
+	fmt.Printf("\nRun %s for usage, attributes and examples.\n\n", ui.FormatInfo("blueprint help-rules <action>"))
+}
+
+func printRuleDetail(def *handlers.ActionDef) {
+	meta := def.Meta
+	fmt.Printf("\n%s\n\n", ui.FormatHighlight("=== "+def.Name+" ==="))
+	fmt.Println(meta.Summary)
+	fmt.Printf("\nUsage:\n  %s\n", meta.Usage)
+
+	if len(meta.Attrs) > 0 {
+		fmt.Println("\nAttributes:")
+		printAttrs(meta.Attrs)
+	}
+	if def.Name != "var" {
+		fmt.Println("\nCommon attributes:")
+		printAttrs(handlers.CommonAttrs)
+	}
+
+	supported := "all"
+	if len(meta.OS) > 0 {
+		supported = strings.Join(meta.OS, ", ")
+	}
+	fmt.Printf("\nSupported OS: %s\n", supported)
+
+	if len(meta.Examples) > 0 {
+		fmt.Println("\nExamples:")
+		for _, example := range meta.Examples {
+			fmt.Printf("  %s\n", example)
+		}
+	}
+	if url := meta.DocURL(); url != "" {
+		fmt.Printf("\nDocumentation: %s\n", ui.FormatDim(url))
+	}
+	fmt.Println()
+}
+
+// printAttrs prints one attribute per line: keyword, type (with required or
+// default) and description, in aligned columns.
+func printAttrs(attrs []handlers.AttrMeta) {
+	keyWidth, typeWidth := 0, 0
+	types := make([]string, len(attrs))
+	for i, attr := range attrs {
+		types[i] = attrType(attr)
+		keyWidth = max(keyWidth, len(attr.Keyword()))
+		typeWidth = max(typeWidth, len(types[i]))
+	}
+	for i, attr := range attrs {
+		fmt.Printf("  %-*s  %-*s  %s\n", keyWidth, attr.Keyword(), typeWidth, types[i], attr.Description)
+	}
+}
+
+func attrType(attr handlers.AttrMeta) string {
+	switch {
+	case attr.Required:
+		return attr.Type + ", required"
+	case attr.Default != "":
+		return attr.Type + ", default " + attr.Default
+	}
+	return attr.Type
+}
@@ -0,0 +1,37 @@
+package engine
+
+import (
+	"testing"
+
+	"github.com/elpic/blueprint/internal/handlers"
+)
+
+func TestPrintRuleHelpExitCodes(t *testing.T) {
+	if code := PrintRuleHelp(""); code != 0 {
+		t.Errorf("listing actions returned %d, want 0", code)
+	}
+	if code := PrintRuleHelp("clone"); code != 0 {
+		t.Errorf("documenting clone returned %d, want 0", code)
+	}
+	for _, action := range []string{"nope", "uninstall"} {
+		if code := PrintRuleHelp(action); code != 1 {
+			t.Errorf("PrintRuleHelp(%q) returned %d, want 1", action, code)
+		}
+	}
+}
+
+func TestAttrType(t *testing.T) {
+	tests := []struct {
+		attr handlers.AttrMeta
+		want string
+	}{
+		{handlers.AttrMeta{Type: "path", Required: true}, "path, required"},
+		{handlers.AttrMeta{Type: "bool", Default: "false"}, "bool, default false"},
+		{handlers.AttrMeta{Type: "list"}, "list"},
+	}
+	for _, tt := range tests {
+		if got := attrType(tt.attr); got != tt.want {
+			t.Errorf("attrType(%+v) = %q, want %q", tt.attr, got, tt.want)
+		}
+	}
+}
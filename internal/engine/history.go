@@ -0,0 +1,114 @@
+package engine
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/elpic/blueprint/internal"
+)
+
+// History is kept per run in the configured StateStore. With the JSON
+// backend ~/.blueprint/history/<run>/manifest.json holds the run's records
+// and ~/.blueprint/history/index.jsonl gets one line per run. A run only ever
+// writes its own files, so runs never rewrite each other's history and a
+// crash mid-write loses at most the run being saved.
+
+const (
+	historyManifestName = "manifest.json"
+	historyIndexName    = "index.jsonl"
+)
+
+// historyIndexEntry summarizes a run, enough to list and filter runs without
+// loading their records. It is one line of history/index.jsonl.
+type historyIndexEntry struct {
+	Run        int      `json:"run"`
+	Timestamp  string   `json:"timestamp"`
+	Blueprints []string `json:"blueprints,omitempty"`
+	OS         string   `json:"os,omitempty"`
+	Rules      int      `json:"rules"`
+	Failed     int      `json:"failed,omitempty"`
+}
+
+// getHistoryDir returns the history directory of the current workspace,
+// ~/.blueprint/history for the default one, creating it if needed.
+func getHistoryDir() (string, error) {
+	stateDir, err := getStateDir()
+	if err != nil {
+		return "", err
+	}
+	historyDir := filepath.Join(stateDir, "history")
+	if err := os.MkdirAll(historyDir, internal.DirectoryPermission); err != nil {
+		return "", fmt.Errorf("failed to create history directory: %w", err)
+	}
+	return historyDir, nil
+}
+
+// saveHistory saves the records of a run to the state store. Output is left
+// out — it is already persisted in the run's <rule>.output files — as are the
+// errors of sensitive rules.
+func saveHistory(runNumber int, records []ExecutionRecord) error {
+	if len(records) == 0 {
+		return nil
+	}
+	store, err := openStateStore()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = store.Close() }()
+	return store.SaveRun(runNumber, historyRecords(records))
+}
+
+// historyRecords returns records as history stores them: redacted and
+// without their output.
+func historyRecords(records []ExecutionRecord) []ExecutionRecord {
+	stored := make([]ExecutionRecord, len(records))
+	for i, record := range records {
+		stored[i] = record.redacted()
+		stored[i].Output = ""
+	}
+	return stored
+}
+
+// readHistoryIndex returns a summary of every run in the history, in run
+// order.
+func readHistoryIndex() ([]historyIndexEntry, error) {
+	store, err := openStateStore()
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = store.Close() }()
+	return store.ListRuns()
+}
+
+// loadRunRecords returns the records saved for a run.
+func loadRunRecords(runNumber int) ([]ExecutionRecord, error) {
+	store, err := openStateStore()
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = store.Close() }()
+	return store.LoadRun(runNumber)
+}
+
+// indexEntryFor summarizes the records of a run for the history index.
+func indexEntryFor(runNumber int, records []ExecutionRecord) historyIndexEntry {
+	entry := historyIndexEntry{Run: runNumber, Rules: len(records)}
+	seen := map[string]bool{}
+	for _, r := range records {
+		if entry.Timestamp == "" {
+			entry.Timestamp = r.Timestamp
+		}
+		if entry.OS == "" {
+			entry.OS = r.OS
+		}
+		if r.Blueprint != "" && !seen[r.Blueprint] {
+			seen[r.Blueprint] = true
+			entry.Blueprints = append(entry.Blueprints, r.Blueprint)
+		}
+		if r.Status == "error" {
+			entry.Failed++
+		}
+	}
+	return entry
+}
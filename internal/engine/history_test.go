@@ -0,0 +1,119 @@
+package engine
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSaveHistoryKeepsEveryRun(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	if err := saveHistory(1, []ExecutionRecord{
+		{Timestamp: "2025-05-01T10:00:00Z", Blueprint: "/tmp/a.bp", Command: "cmd1", Status: "success", Output: "out"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := saveHistory(2, []ExecutionRecord{
+		{Timestamp: "2025-06-01T10:00:00Z", Blueprint: "/tmp/b.bp", Command: "cmd2", Status: "error"},
+		{Timestamp: "2025-06-01T10:00:01Z", Blueprint: "/tmp/b.bp", Command: "cmd3", Status: "success"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	runs, err := readHistoryIndex()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(runs) != 2 || runs[0].Run != 1 || runs[1].Run != 2 {
+		t.Fatalf("index runs = %+v, want runs 1 and 2", runs)
+	}
+	if runs[1].Rules != 2 || runs[1].Failed != 1 || len(runs[1].Blueprints) != 1 || runs[1].Blueprints[0] != "/tmp/b.bp" {
+		t.Errorf("run 2 index entry = %+v", runs[1])
+	}
+
+	records, err := loadRunRecords(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 || records[0].Command != "cmd1" || records[0].Output != "" {
+		t.Errorf("run 1 records = %+v, want cmd1 without output", records)
+	}
+
+	all, err := loadHistoryRecords("2025-06", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 2 {
+		t.Errorf("records since 2025-06 = %d, want 2", len(all))
+	}
+}
+
+func TestReadHistoryIndexSkipsTornLines(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	if err := saveHistory(1, []ExecutionRecord{{Command: "cmd1", Status: "success"}}); err != nil {
+		t.Fatal(err)
+	}
+	historyDir, err := getHistoryDir()
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.OpenFile(filepath.Join(historyDir, historyIndexName), os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = f.WriteString(`{"run":2,"timest`)
+	_ = f.Close()
+
+	runs, err := readHistoryIndex()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(runs) != 1 || runs[0].Run != 1 {
+		t.Errorf("runs = %+v, want only run 1", runs)
+	}
+}
+
+func TestMigrateLegacyHistory(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	blueprintDir := filepath.Join(home, ".blueprint")
+	if err := os.MkdirAll(blueprintDir, 0750); err != nil {
+		t.Fatal(err)
+	}
+	legacy := `[{"timestamp":"2025-05-01T10:00:00Z","blueprint":"/tmp/a.bp","command":"cmd1","status":"success","duration_ms":1500}]`
+	if err := os.WriteFile(filepath.Join(blueprintDir, "history.json"), []byte(legacy), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(blueprintDir, "run_number"), []byte("7"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// Taking the next run number migrates history.json to run 7 first
+	runNumber, err := getNextRunNumber()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if runNumber != 8 {
+		t.Fatalf("next run = %d, want 8", runNumber)
+	}
+	if _, err := os.Stat(filepath.Join(blueprintDir, "history.json")); !os.IsNotExist(err) {
+		t.Error("expected history.json to be removed after migration")
+	}
+
+	records, err := loadRunRecords(7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 || records[0].Command != "cmd1" || records[0].DurationMs != 1500 {
+		t.Errorf("migrated records = %+v", records)
+	}
+	runs, err := readHistoryIndex()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(runs) != 1 || runs[0].Run != 7 {
+		t.Errorf("index runs = %+v, want run 7", runs)
+	}
+}
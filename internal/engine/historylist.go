@@ -0,0 +1,231 @@
+package engine
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/elpic/blueprint/internal/ui"
+	"github.com/elpic/blueprint/internal/ui/timeutil"
+)
+
+// maxSearchLines bounds the matching lines history search prints per step.
+const maxSearchLines = 5
+
+// historyListEntry is a run as history list prints it with --output json.
+type historyListEntry struct {
+	historyIndexEntry
+	Result string `json:"result"`
+}
+
+// runResult sums up a run for history list: "failed" when any rule failed.
+func runResult(entry historyIndexEntry) string {
+	if entry.Failed > 0 {
+		return "failed"
+	}
+	return "ok"
+}
+
+// filterHistoryRuns keeps the runs started at a local time beginning with
+// since and applying a blueprint containing blueprintFilter, as the other
+// history commands filter records.
+func filterHistoryRuns(runs []historyIndexEntry, since, blueprintFilter string) []historyIndexEntry {
+	var filtered []historyIndexEntry
+	for _, run := range runs {
+		if since != "" && !strings.HasPrefix(localTimestamp(run.Timestamp), since) {
+			continue
+		}
+		if blueprintFilter != "" && !strings.Contains(strings.Join(run.Blueprints, "\n"), blueprintFilter) {
+			continue
+		}
+		filtered = append(filtered, run)
+	}
+	return filtered
+}
+
+// PrintHistoryList prints a table of the runs in the history, oldest first:
+// number, date, blueprints, rule counts and result. since and
+// blueprintFilter filter the runs as they filter history records.
+func PrintHistoryList(since, blueprintFilter string) int {
+	runs, err := readHistoryIndex()
+	if err != nil && !os.IsNotExist(err) {
+		fmt.Printf("%s\n", ui.FormatError(fmt.Sprintf("Error reading history: %v", err)))
+		return 1
+	}
+	runs = filterHistoryRuns(runs, since, blueprintFilter)
+
+	if jsonOutput {
+		entries := make([]historyListEntry, 0, len(runs))
+		for _, run := range runs {
+			entries = append(entries, historyListEntry{historyIndexEntry: run, Result: runResult(run)})
+		}
+		_ = printJSON(os.Stdout, entries)
+		return 0
+	}
+	if len(runs) == 0 {
+		fmt.Printf("%s\n", ui.FormatInfo("No runs found. Run 'blueprint apply' to create one."))
+		return 0
+	}
+
+	rows := [][]string{{"RUN", "DATE", "BLUEPRINT", "RULES", "FAILED", "RESULT"}}
+	for _, run := range runs {
+		blueprints := make([]string, len(run.Blueprints))
+		for i, bp := range run.Blueprints {
+			blueprints[i] = ui.AbbreviateHome(bp)
+		}
+		result := ui.FormatSuccess(runResult(run))
+		if run.Failed > 0 {
+			result = ui.FormatError(runResult(run))
+		}
+		rows = append(rows, []string{
+			strconv.Itoa(run.Run),
+			timeutil.Display(run.Timestamp),
+			strings.Join(blueprints, ", "),
+			strconv.Itoa(run.Rules),
+			strconv.Itoa(run.Failed),
+			result,
+		})
+	}
+	lines := ui.AlignColumns(rows)
+	fmt.Printf("%s\n", ui.FormatHighlight(lines[0]))
+	for _, line := range lines[1:] {
+		fmt.Printf("%s\n", line)
+	}
+	return 0
+}
+
+// historyMatch is a step of a run whose command or output contains the text
+// history search looks for.
+type historyMatch struct {
+	Run       int      `json:"run"`
+	Step      int      `json:"step"`
+	Timestamp string   `json:"timestamp,omitempty"`
+	Command   string   `json:"command,omitempty"`
+	Lines     []string `json:"lines"`
+}
+
+// searchHistory returns the steps, in run and step order, whose command or
+// stored output contains text, ignoring case, with the output lines that do.
+func searchHistory(historyDir, text string) ([]historyMatch, error) {
+	dirs, err := os.ReadDir(historyDir)
+	if err != nil {
+		return nil, err
+	}
+	var runs []int
+	for _, d := range dirs {
+		if n, err := strconv.Atoi(d.Name()); err == nil && d.IsDir() {
+			runs = append(runs, n)
+		}
+	}
+	sort.Ints(runs)
+
+	needle := strings.ToLower(text)
+	var matches []historyMatch
+	for _, run := range runs {
+		records, _ := loadRunRecords(run)
+		steps := map[int]historyMatch{}
+		for i, r := range records {
+			if strings.Contains(strings.ToLower(r.Command), needle) {
+				steps[i+1] = historyMatch{Run: run, Step: i + 1, Lines: []string{}}
+			}
+		}
+
+		outputs, _ := filepath.Glob(filepath.Join(historyDir, strconv.Itoa(run), "*.output"))
+		for _, path := range outputs {
+			step, err := strconv.Atoi(strings.TrimSuffix(filepath.Base(path), ".output"))
+			if err != nil {
+				continue
+			}
+			content, err := readBlueprintFile(path)
+			if err != nil {
+				continue
+			}
+			stdout, stderr := splitRuleOutput(string(content))
+			var lines []string
+			for _, line := range strings.Split(stdout+"\n"+stderr, "\n") {
+				if strings.Contains(strings.ToLower(line), needle) {
+					lines = append(lines, strings.TrimSpace(line))
+				}
+			}
+			if len(lines) == 0 {
+				continue
+			}
+			m, ok := steps[step]
+			if !ok {
+				m = historyMatch{Run: run, Step: step}
+			}
+			m.Lines = lines
+			steps[step] = m
+		}
+
+		for step, m := range steps {
+			if step <= len(records) {
+				m.Timestamp = records[step-1].Timestamp
+				m.Command = records[step-1].Command
+			}
+			matches = append(matches, m)
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		if matches[i].Run != matches[j].Run {
+			return matches[i].Run < matches[j].Run
+		}
+		return matches[i].Step < matches[j].Step
+	})
+	return matches, nil
+}
+
+// SearchHistory prints the steps of every run whose command or stored
+// output contains text, ignoring case, with up to maxSearchLines matching
+// lines each. It returns 1 when nothing matched, like grep.
+func SearchHistory(text string) int {
+	historyDir, err := getHistoryDir()
+	if err != nil {
+		fmt.Printf("%s\n", ui.FormatError(fmt.Sprintf("Error reading history: %v", err)))
+		return 1
+	}
+	matches, err := searchHistory(historyDir, text)
+	if err != nil {
+		fmt.Printf("%s\n", ui.FormatError(fmt.Sprintf("Error reading history: %v", err)))
+		return 1
+	}
+
+	if jsonOutput {
+		if matches == nil {
+			matches = []historyMatch{}
+		}
+		_ = printJSON(os.Stdout, matches)
+		if len(matches) == 0 {
+			return 1
+		}
+		return 0
+	}
+	if len(matches) == 0 {
+		fmt.Printf("%s\n", ui.FormatInfo(fmt.Sprintf("No step of any run mentions %q", text)))
+		return 1
+	}
+
+	for _, m := range matches {
+		header := fmt.Sprintf("Run %d step %d", m.Run, m.Step)
+		if m.Command != "" {
+			header += ": " + m.Command
+		}
+		fmt.Printf("\n%s", ui.FormatHighlight(header))
+		if m.Timestamp != "" {
+			fmt.Printf(" %s", ui.FormatDim("("+timeutil.Display(m.Timestamp)+")"))
+		}
+		fmt.Printf("\n")
+		for i, line := range m.Lines {
+			if i == maxSearchLines {
+				fmt.Printf("  %s\n", ui.FormatDim(fmt.Sprintf("… %d more matching lines", len(m.Lines)-maxSearchLines)))
+				break
+			}
+			fmt.Printf("  %s\n", line)
+		}
+	}
+	fmt.Printf("\n%s\n", ui.FormatDim(fmt.Sprintf("%d matching steps; see one with 'blueprint history <run> <step>'", len(matches))))
+	return 0
+}
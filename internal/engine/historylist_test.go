@@ -0,0 +1,63 @@
+package engine
+
+import (
+	"testing"
+)
+
+func TestFilterHistoryRuns(t *testing.T) {
+	runs := []historyIndexEntry{
+		{Run: 1, Timestamp: "2025-04-15T10:00:00Z", Blueprints: []string{"/home/me/dotfiles/setup.bp"}},
+		{Run: 2, Timestamp: "2025-05-14T10:00:00Z", Blueprints: []string{"/home/me/work.bp"}, Failed: 1},
+		{Run: 3, Timestamp: "2025-05-15T10:00:00Z", Blueprints: []string{"/home/me/dotfiles/setup.bp"}},
+	}
+	if got := filterHistoryRuns(runs, "2025-05", "dotfiles"); len(got) != 1 || got[0].Run != 3 {
+		t.Errorf("filterHistoryRuns() = %+v, want run 3", got)
+	}
+	if got := filterHistoryRuns(runs, "", ""); len(got) != 3 {
+		t.Errorf("filterHistoryRuns() without filters = %d runs, want 3", len(got))
+	}
+	if runResult(runs[1]) != "failed" || runResult(runs[0]) != "ok" {
+		t.Errorf("runResult() = %q/%q, want failed/ok", runResult(runs[1]), runResult(runs[0]))
+	}
+}
+
+func TestSearchHistory(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	if err := saveHistory(1, []ExecutionRecord{
+		{Timestamp: "2025-05-01T10:00:00Z", Command: "apt-get install -y neovim", Status: "success"},
+		{Timestamp: "2025-05-01T10:00:01Z", Command: "mkdir -p ~/.config", Status: "success"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := saveRuleOutput(1, 2, "created ~/.config", ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := saveRuleOutput(2, 1, "fetching\nE: Permission denied\n", "permission DENIED again"); err != nil {
+		t.Fatal(err)
+	}
+	historyDir, err := getHistoryDir()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	matches, err := searchHistory(historyDir, "permission denied")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(matches) != 1 || matches[0].Run != 2 || matches[0].Step != 1 || len(matches[0].Lines) != 2 {
+		t.Fatalf("search for the error = %+v, want run 2 step 1 with two lines", matches)
+	}
+
+	// A command matches too, even with no output line that does
+	matches, err = searchHistory(historyDir, "NEOVIM")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(matches) != 1 || matches[0].Run != 1 || matches[0].Step != 1 || matches[0].Command != "apt-get install -y neovim" {
+		t.Errorf("search for neovim = %+v, want run 1 step 1", matches)
+	}
+	if code := SearchHistory("nowhere to be found"); code != 1 {
+		t.Errorf("SearchHistory() without a match = %d, want 1", code)
+	}
+}
@@ -0,0 +1,198 @@
+package engine
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/elpic/blueprint/internal/ui"
+	"github.com/elpic/blueprint/internal/ui/timeutil"
+)
+
+// HistoryRetention is how much history is kept: the Keep latest runs and the
+// runs younger than MaxAge. A zero field sets no limit, and the latest run is
+// always kept.
+type HistoryRetention struct {
+	Keep   int
+	MaxAge time.Duration
+}
+
+// storedRun is a run kept in the history, listed in the state store or, for
+// runs saved before there was an index, only a directory of outputs.
+type storedRun struct {
+	run  int
+	when time.Time // zero when unknown; such a run is not pruned by age
+}
+
+// listHistoryRuns returns the runs of the store and of historyDir in run
+// order. A run without a readable timestamp is dated by its directory.
+func listHistoryRuns(store StateStore, historyDir string) ([]storedRun, error) {
+	entries, err := store.ListRuns()
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	byRun := map[int]storedRun{}
+	for _, e := range entries {
+		when, _ := timeutil.Parse(e.Timestamp)
+		byRun[e.Run] = storedRun{run: e.Run, when: when}
+	}
+
+	dirs, err := os.ReadDir(historyDir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read history directory: %w", err)
+	}
+	for _, d := range dirs {
+		n, err := strconv.Atoi(d.Name())
+		if err != nil || !d.IsDir() {
+			continue
+		}
+		run := byRun[n]
+		run.run = n
+		if run.when.IsZero() {
+			if info, err := d.Info(); err == nil {
+				run.when = info.ModTime()
+			}
+		}
+		byRun[n] = run
+	}
+
+	runs := make([]storedRun, 0, len(byRun))
+	for _, run := range byRun {
+		runs = append(runs, run)
+	}
+	sort.Slice(runs, func(i, j int) bool { return runs[i].run < runs[j].run })
+	return runs, nil
+}
+
+// runsBeyondRetention returns the runs, in run order, that retention does not
+// keep as of now.
+func runsBeyondRetention(runs []storedRun, retention HistoryRetention, now time.Time) []storedRun {
+	var prune []storedRun
+	for i, run := range runs {
+		newer := len(runs) - 1 - i
+		if newer == 0 {
+			break
+		}
+		tooMany := retention.Keep > 0 && newer >= retention.Keep
+		tooOld := retention.MaxAge > 0 && !run.when.IsZero() && now.Sub(run.when) > retention.MaxAge
+		if tooMany || tooOld {
+			prune = append(prune, run)
+		}
+	}
+	return prune
+}
+
+// deleteHistoryRuns removes the runs from the store and their directories
+// from historyDir.
+func deleteHistoryRuns(store StateStore, historyDir string, runs []storedRun) error {
+	numbers := make([]int, len(runs))
+	for i, run := range runs {
+		numbers[i] = run.run
+	}
+	if err := store.DeleteRuns(numbers); err != nil {
+		return err
+	}
+	for _, n := range numbers {
+		if err := os.RemoveAll(filepath.Join(historyDir, strconv.Itoa(n))); err != nil {
+			return fmt.Errorf("failed to remove history of run %d: %w", n, err)
+		}
+	}
+	return nil
+}
+
+// PruneHistory removes the runs of the history beyond retention, the latest
+// run aside, and reports the space reclaimed; a zero retention is the one in
+// the [history] section of ~/.blueprint/config. With dryRun it only reports
+// what would be removed. It returns 1 when the history could not be pruned.
+func PruneHistory(retention HistoryRetention, dryRun bool) int {
+	if retention == (HistoryRetention{}) {
+		cfg, err := loadConfig()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", ui.FormatError(err.Error()))
+			return 1
+		}
+		if cfg.History == (HistoryRetention{}) {
+			fmt.Fprintf(os.Stderr, "%s\n", ui.FormatError("Nothing says which runs to prune: pass --keep or --older-than, or set keep or max-age in the [history] section of ~/.blueprint/config"))
+			return 1
+		}
+		retention = cfg.History
+	}
+
+	store, err := openStateStore()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", ui.FormatError(err.Error()))
+		return 1
+	}
+	defer func() { _ = store.Close() }()
+	historyDir, err := getHistoryDir()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", ui.FormatError(err.Error()))
+		return 1
+	}
+
+	runs, err := listHistoryRuns(store, historyDir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", ui.FormatError(fmt.Sprintf("Error reading history: %v", err)))
+		return 1
+	}
+	prune := runsBeyondRetention(runs, retention, time.Now())
+	if len(prune) == 0 {
+		fmt.Printf("%s\n", ui.FormatInfo("No runs to prune"))
+		return 0
+	}
+
+	rows := make([][]string, 0, len(prune))
+	var reclaimed int64
+	for _, run := range prune {
+		size := diskUsage(filepath.Join(historyDir, strconv.Itoa(run.run)))
+		reclaimed += size
+		when := "unknown"
+		if !run.when.IsZero() {
+			when = timeutil.Display(timeutil.Format(run.when))
+		}
+		rows = append(rows, []string{fmt.Sprintf("run %d", run.run), when, formatBytes(size)})
+	}
+	for _, line := range ui.AlignColumns(rows) {
+		fmt.Printf("  %s\n", line)
+	}
+
+	if dryRun {
+		fmt.Printf("%s\n", ui.FormatInfo(fmt.Sprintf("Would remove %d of %d runs, reclaiming %s (dry run)", len(prune), len(runs), formatBytes(reclaimed))))
+		return 0
+	}
+	if err := deleteHistoryRuns(store, historyDir, prune); err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", ui.FormatError(err.Error()))
+		return 1
+	}
+	fmt.Printf("%s\n", ui.FormatSuccess(fmt.Sprintf("Removed %d of %d runs, reclaimed %s", len(prune), len(runs), formatBytes(reclaimed))))
+	return 0
+}
+
+// applyHistoryRetention prunes the history to the [history] retention of
+// ~/.blueprint/config, if any, after apply saved its run.
+func applyHistoryRetention(retention HistoryRetention) error {
+	if retention == (HistoryRetention{}) {
+		return nil
+	}
+	store, err := openStateStore()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = store.Close() }()
+	historyDir, err := getHistoryDir()
+	if err != nil {
+		return err
+	}
+	runs, err := listHistoryRuns(store, historyDir)
+	if err != nil {
+		return err
+	}
+	prune := runsBeyondRetention(runs, retention, time.Now())
+	if len(prune) == 0 {
+		return nil
+	}
+	return deleteHistoryRuns(store, historyDir, prune)
+}
@@ -0,0 +1,85 @@
+package engine
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRunsBeyondRetention(t *testing.T) {
+	now := time.Date(2025, 6, 30, 12, 0, 0, 0, time.UTC)
+	runs := []storedRun{
+		{run: 1, when: now.AddDate(0, 0, -60)},
+		{run: 2},
+		{run: 3, when: now.AddDate(0, 0, -10)},
+		{run: 4, when: now.AddDate(0, 0, -40)},
+	}
+	numbers := func(runs []storedRun) []int {
+		var out []int
+		for _, r := range runs {
+			out = append(out, r.run)
+		}
+		return out
+	}
+
+	if got := numbers(runsBeyondRetention(runs, HistoryRetention{Keep: 2}, now)); len(got) != 2 || got[0] != 1 || got[1] != 2 {
+		t.Errorf("keep 2 prunes %v, want [1 2]", got)
+	}
+	// An undated run is kept by age, and so is the latest run however old
+	if got := numbers(runsBeyondRetention(runs, HistoryRetention{MaxAge: 30 * 24 * time.Hour}, now)); len(got) != 1 || got[0] != 1 {
+		t.Errorf("max-age 30d prunes %v, want [1]", got)
+	}
+	if got := runsBeyondRetention(runs[3:], HistoryRetention{Keep: 1, MaxAge: time.Hour}, now); len(got) != 0 {
+		t.Errorf("the only run was pruned: %v", got)
+	}
+}
+
+func TestPruneHistory(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	old := time.Now().AddDate(0, 0, -45).UTC().Format(time.RFC3339)
+	recent := time.Now().UTC().Format(time.RFC3339)
+	for run, ts := range map[int]string{1: old, 2: old, 3: recent} {
+		if err := saveHistory(run, []ExecutionRecord{{Timestamp: ts, Command: "cmd", Status: "success"}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	historyDir, err := getHistoryDir()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Run 1 also has an output, which goes with it
+	writeTestFile(t, filepath.Join(historyDir, "1", "0.output"), "out")
+
+	if code := PruneHistory(HistoryRetention{MaxAge: 30 * 24 * time.Hour}, true); code != 0 {
+		t.Fatalf("PruneHistory() dry run = %d", code)
+	}
+	if runs, _ := readHistoryIndex(); len(runs) != 3 {
+		t.Fatalf("dry run removed runs: %+v", runs)
+	}
+
+	if code := PruneHistory(HistoryRetention{MaxAge: 30 * 24 * time.Hour}, false); code != 0 {
+		t.Fatalf("PruneHistory() = %d", code)
+	}
+	runs, err := readHistoryIndex()
+	if err != nil || len(runs) != 1 || runs[0].Run != 3 {
+		t.Errorf("index after prune = %+v, %v; want run 3 only", runs, err)
+	}
+	if _, err := os.Stat(filepath.Join(historyDir, "1")); !os.IsNotExist(err) {
+		t.Errorf("run 1 directory is still there: %v", err)
+	}
+	if _, err := loadRunRecords(3); err != nil {
+		t.Errorf("run 3 records: %v", err)
+	}
+
+	// Without flags or a [history] section there is nothing to go by
+	if code := PruneHistory(HistoryRetention{}, false); code != 1 {
+		t.Errorf("PruneHistory() without a retention = %d, want 1", code)
+	}
+	writeTestFile(t, filepath.Join(home, ".blueprint", "config"), "[history]\nkeep = 1\n")
+	if code := PruneHistory(HistoryRetention{}, false); code != 0 {
+		t.Errorf("PruneHistory() with keep = 1 configured = %d, want 0", code)
+	}
+}
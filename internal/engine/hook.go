@@ -0,0 +1,157 @@
+package engine
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	handlerskg "github.com/elpic/blueprint/internal/handlers"
+	"github.com/elpic/blueprint/internal/ui"
+)
+
+// hookMarker is the line that identifies the git hooks blueprint installed,
+// so that they are updated and removed without touching anyone else's.
+const hookMarker = "# Installed by blueprint hook install"
+
+// hookName is the git hook the apply runs from: git runs it after every
+// merge, including the one a git pull makes.
+const hookName = "post-merge"
+
+// HookOptions selects what the hook of a repository applies.
+type HookOptions struct {
+	Blueprint string // blueprint to apply, relative to the repository; "" for setup.bp
+	OnlyGroup string // --only-group passed to apply
+	SkipGroup string // --skip-group passed to apply
+}
+
+// InstallHook installs a post-merge hook in the git repository repo that
+// applies a blueprint from it whenever a pull brings in changes, and returns
+// an exit code. A hook blueprint installed before is replaced; any other
+// post-merge hook is left alone and the install fails.
+func InstallHook(repo string, opts HookOptions) int {
+	hookPath, err := gitHookPath(repo)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", ui.FormatError(err.Error()))
+		return 1
+	}
+	blueprint, err := hookBlueprint(repo, opts.Blueprint)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", ui.FormatError(err.Error()))
+		return 1
+	}
+	if data, err := os.ReadFile(hookPath); err == nil && !strings.Contains(string(data), hookMarker) { // #nosec G304 -- the repository's own hook
+		fmt.Fprintf(os.Stderr, "%s\n", ui.FormatError(fmt.Sprintf("%s already has a %s hook that blueprint did not install; add this line to it instead:\n  %s", ui.AbbreviateHome(repo), hookName, hookCommand(blueprint, opts))))
+		return 1
+	}
+	if err := os.MkdirAll(filepath.Dir(hookPath), 0o755); err != nil { // #nosec G301 -- git's own hooks directory
+		fmt.Fprintf(os.Stderr, "%s\n", ui.FormatError(fmt.Sprintf("failed to create hooks directory: %v", err)))
+		return 1
+	}
+	if err := os.WriteFile(hookPath, []byte(hookScript(blueprint, opts)), 0o755); err != nil { // #nosec G306 -- hooks must be executable
+		fmt.Fprintf(os.Stderr, "%s\n", ui.FormatError(fmt.Sprintf("failed to write %s: %v", hookPath, err)))
+		return 1
+	}
+	fmt.Println(ui.FormatSuccess(fmt.Sprintf("Installed %s hook in %s: git pull applies %s", hookName, ui.AbbreviateHome(repo), ui.AbbreviateHome(blueprint))))
+	return 0
+}
+
+// UninstallHook removes the hook InstallHook put in repo and returns an exit
+// code. A hook blueprint did not install is left alone.
+func UninstallHook(repo string) int {
+	hookPath, err := gitHookPath(repo)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", ui.FormatError(err.Error()))
+		return 1
+	}
+	data, err := os.ReadFile(hookPath) // #nosec G304 -- the repository's own hook
+	if os.IsNotExist(err) {
+		fmt.Println(ui.FormatInfo(fmt.Sprintf("No %s hook in %s", hookName, ui.AbbreviateHome(repo))))
+		return 0
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", ui.FormatError(err.Error()))
+		return 1
+	}
+	if !strings.Contains(string(data), hookMarker) {
+		fmt.Fprintf(os.Stderr, "%s\n", ui.FormatError(fmt.Sprintf("the %s hook in %s was not installed by blueprint; leaving it alone", hookName, ui.AbbreviateHome(repo))))
+		return 1
+	}
+	if err := os.Remove(hookPath); err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", ui.FormatError(err.Error()))
+		return 1
+	}
+	fmt.Println(ui.FormatSuccess(fmt.Sprintf("Removed %s hook from %s", hookName, ui.AbbreviateHome(repo))))
+	return 0
+}
+
+// gitHookPath returns where git looks for the post-merge hook of repo,
+// honoring core.hooksPath and worktrees.
+func gitHookPath(repo string) (string, error) {
+	out, err := exec.Command("git", "-C", repo, "rev-parse", "--git-path", "hooks/"+hookName).Output() // #nosec G204 -- fixed git arguments
+	if err != nil {
+		return "", fmt.Errorf("%s is not a git repository", ui.AbbreviateHome(repo))
+	}
+	path := strings.TrimSpace(string(out))
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(repo, path)
+	}
+	return path, nil
+}
+
+// hookBlueprint returns the absolute path of the blueprint the hook applies:
+// name resolved against repo, setup.bp when name is empty.
+func hookBlueprint(repo, name string) (string, error) {
+	if name == "" {
+		name = "setup.bp"
+	}
+	if !filepath.IsAbs(name) {
+		name = filepath.Join(repo, name)
+	}
+	path, err := filepath.Abs(name)
+	if err != nil {
+		return "", err
+	}
+	if _, err := os.Stat(path); err != nil {
+		return "", fmt.Errorf("blueprint %s not found", ui.AbbreviateHome(path))
+	}
+	return path, nil
+}
+
+// hookCommand returns the apply command line the hook runs.
+func hookCommand(blueprint string, opts HookOptions) string {
+	exe, err := os.Executable()
+	if err != nil || strings.Contains(exe, "go-build") {
+		exe = "blueprint"
+	}
+	words := []string{exe, "apply", blueprint}
+	if opts.OnlyGroup != "" {
+		words = append(words, "--only-group", opts.OnlyGroup)
+	}
+	if opts.SkipGroup != "" {
+		words = append(words, "--skip-group", opts.SkipGroup)
+	}
+	for i, w := range words {
+		words[i] = hookQuote(w)
+	}
+	return strings.Join(words, " ")
+}
+
+// hookScript returns the post-merge hook that applies blueprint. The apply
+// runs with the binary that installed the hook, since git clients do not
+// always have blueprint on their PATH.
+func hookScript(blueprint string, opts HookOptions) string {
+	return "#!/bin/sh\n" +
+		hookMarker + "; remove it with: blueprint hook uninstall --repo .\n" +
+		"# Applies the repository's blueprint after every merge, such as a git pull.\n" +
+		hookCommand(blueprint, opts) + "\n"
+}
+
+// hookQuote quotes s for the hook's shell command line.
+func hookQuote(s string) string {
+	if s != "" && !strings.ContainsAny(s, " \t\n'\"\\$`!*?[]{}()<>|&;#~") {
+		return s
+	}
+	return handlerskg.ShellQuote(s)
+}
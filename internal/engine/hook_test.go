@@ -0,0 +1,87 @@
+package engine
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// initRepo creates a git repository with a setup.bp and returns its path.
+func initRepo(t *testing.T) string {
+	t.Helper()
+	repo := t.TempDir()
+	if out, err := exec.Command("git", "init", "-q", repo).CombinedOutput(); err != nil {
+		t.Skipf("git init failed: %v: %s", err, out)
+	}
+	if err := os.WriteFile(filepath.Join(repo, "setup.bp"), []byte("mkdir ~/src\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return repo
+}
+
+func TestInstallHook(t *testing.T) {
+	repo := initRepo(t)
+	hookPath := filepath.Join(repo, ".git", "hooks", hookName)
+
+	if code := InstallHook(repo, HookOptions{OnlyGroup: "dotfiles"}); code != 0 {
+		t.Fatalf("InstallHook() = %d", code)
+	}
+	info, err := os.Stat(hookPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode()&0o100 == 0 {
+		t.Errorf("hook mode %v is not executable", info.Mode())
+	}
+	data, _ := os.ReadFile(hookPath)
+	if !strings.Contains(string(data), hookMarker) || !strings.Contains(string(data), "apply "+filepath.Join(repo, "setup.bp")+" --only-group dotfiles") {
+		t.Errorf("hook = %q, want the marker and the apply of setup.bp", data)
+	}
+
+	// Installing again replaces blueprint's own hook
+	if code := InstallHook(repo, HookOptions{}); code != 0 {
+		t.Errorf("reinstalling InstallHook() = %d", code)
+	}
+	if code := UninstallHook(repo); code != 0 {
+		t.Fatalf("UninstallHook() = %d", code)
+	}
+	if _, err := os.Stat(hookPath); !os.IsNotExist(err) {
+		t.Errorf("hook still exists after uninstall: %v", err)
+	}
+}
+
+func TestInstallHookKeepsForeignHook(t *testing.T) {
+	repo := initRepo(t)
+	hookPath := filepath.Join(repo, ".git", "hooks", hookName)
+	foreign := "#!/bin/sh\nnpm install\n"
+	if err := os.WriteFile(hookPath, []byte(foreign), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	if code := InstallHook(repo, HookOptions{}); code != 1 {
+		t.Errorf("InstallHook() over another hook = %d, want 1", code)
+	}
+	if code := UninstallHook(repo); code != 1 {
+		t.Errorf("UninstallHook() of another hook = %d, want 1", code)
+	}
+	if data, _ := os.ReadFile(hookPath); string(data) != foreign {
+		t.Errorf("foreign hook changed to %q", data)
+	}
+	if code := InstallHook(repo, HookOptions{Blueprint: "missing.bp"}); code != 1 {
+		t.Errorf("InstallHook() with a missing blueprint = %d, want 1", code)
+	}
+}
+
+func TestHookQuote(t *testing.T) {
+	for in, want := range map[string]string{
+		"/home/me/setup.bp":   "/home/me/setup.bp",
+		"/home/me/my dots/bp": "'/home/me/my dots/bp'",
+		"it's":                `'it'\''s'`,
+	} {
+		if got := hookQuote(in); got != want {
+			t.Errorf("hookQuote(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,236 @@
+package engine
+
+import (
+	"fmt"
+	"strings"
+
+	handlerskg "github.com/elpic/blueprint/internal/handlers"
+	"github.com/elpic/blueprint/internal/parser"
+	"github.com/elpic/blueprint/internal/ui"
+	"github.com/elpic/blueprint/internal/ui/timeutil"
+)
+
+// statusSkipped marks a rule that was not run because a rule it depends on,
+// directly or through other rules, failed.
+const statusSkipped = "skipped"
+
+// dependencyGraph links rules through their after: references, resolved the
+// way resolveDependencies resolves them: by id: (or an alias) first, then by
+// resource key or package name.
+type dependencyGraph struct {
+	rules      []parser.Rule
+	byID       map[string]int
+	byKey      map[string]int
+	deps       [][]int // deps[i]: the rules rule i runs after
+	dependents [][]int // dependents[i]: the rules that run after rule i
+}
+
+func newDependencyGraph(rules []parser.Rule) *dependencyGraph {
+	g := &dependencyGraph{
+		rules:      rules,
+		byID:       map[string]int{},
+		byKey:      map[string]int{},
+		deps:       make([][]int, len(rules)),
+		dependents: make([][]int, len(rules)),
+	}
+	for i, r := range rules {
+		if r.ID != "" {
+			g.byID[r.ID] = i
+		}
+		for _, alias := range r.Aliases {
+			if _, taken := g.byID[alias]; !taken {
+				g.byID[alias] = i
+			}
+		}
+		g.byKey[handlerskg.RuleKey(r)] = i
+		for _, pkg := range r.Packages {
+			g.byKey[pkg.Name] = i
+		}
+	}
+	for i, r := range rules {
+		for _, ref := range r.After {
+			dep, ok := g.lookup(ref)
+			if !ok || dep == i {
+				continue
+			}
+			g.deps[i] = append(g.deps[i], dep)
+			g.dependents[dep] = append(g.dependents[dep], i)
+		}
+	}
+	return g
+}
+
+// lookup returns the index of the rule ref names in an after: entry.
+func (g *dependencyGraph) lookup(ref string) (int, bool) {
+	if i, ok := g.byID[ref]; ok {
+		return i, true
+	}
+	i, ok := g.byKey[ref]
+	return i, ok
+}
+
+// transitiveDependencies returns the rules rule i runs after, directly or
+// through other rules, in the order of g.rules.
+func (g *dependencyGraph) transitiveDependencies(i int) []int {
+	seen := map[int]bool{i: true}
+	queue := []int{i}
+	for len(queue) > 0 {
+		cur := queue[0]
+		queue = queue[1:]
+		for _, d := range g.deps[cur] {
+			if !seen[d] {
+				seen[d] = true
+				queue = append(queue, d)
+			}
+		}
+	}
+	var found []int
+	for j := range g.rules {
+		if seen[j] && j != i {
+			found = append(found, j)
+		}
+	}
+	return found
+}
+
+// transitiveDependents returns the rules that depend on rule i, directly or
+// through other rules, in the order of g.rules. via maps each of them to the
+// rule it names in after: on the way to rule i.
+func (g *dependencyGraph) transitiveDependents(i int) (found []int, via map[int]int) {
+	via = map[int]int{}
+	queue := []int{i}
+	for len(queue) > 0 {
+		cur := queue[0]
+		queue = queue[1:]
+		for _, d := range g.dependents[cur] {
+			if _, seen := via[d]; seen || d == i {
+				continue
+			}
+			via[d] = cur
+			queue = append(queue, d)
+		}
+	}
+	for j := range g.rules {
+		if _, ok := via[j]; ok {
+			found = append(found, j)
+		}
+	}
+	return found, via
+}
+
+// skippedResult builds the result for a rule not run because failed, a rule
+// it depends on, did not succeed.
+func skippedResult(rule parser.Rule, failed parser.Rule, globalIndex int, number, blueprint, osName, basePath string) ruleResult {
+	var actualCmd string
+	if handler := handlerskg.NewHandler(rule, basePath, passwordCache.snapshot()); handler != nil {
+		actualCmd = handler.GetCommand()
+	}
+	reason := fmt.Sprintf("skipped: depends on %s, which failed", ruleLabel(failed))
+	output := fmt.Sprintf("%s %s %s\n", number, ui.FormatHighlight(rule.Action), ui.FormatDim("Skipped ("+ruleLabel(failed)+" failed)"))
+	return ruleResult{
+		globalIndex: globalIndex,
+		record: ExecutionRecord{
+			Timestamp: timeutil.Now(),
+			Blueprint: blueprint,
+			OS:        osName,
+			Command:   actualCmd,
+			Status:    statusSkipped,
+			Error:     reason,
+			Group:     rule.Group,
+		},
+		output: output,
+	}
+}
+
+// failedDependency returns the failed rule that keeps rule i from running:
+// the root failure behind the first of its dependencies that failed or was
+// skipped. failedRoot maps each such rule to the root failure.
+func (g *dependencyGraph) failedDependency(i int, failedRoot map[int]int) (int, bool) {
+	for _, dep := range g.deps[i] {
+		if root, ok := failedRoot[dep]; ok {
+			return root, true
+		}
+	}
+	return 0, false
+}
+
+// printSkippedDependents lists, after a run, the rules skipped because a
+// rule they depend on failed, grouped by the failed rule.
+func printSkippedDependents(rules []parser.Rule, failedRoot map[int]int) {
+	skipped := map[int][]string{}
+	var roots []int
+	for i := range rules {
+		root, ok := failedRoot[i]
+		if !ok || root == i {
+			continue
+		}
+		if len(skipped[root]) == 0 {
+			roots = append(roots, root)
+		}
+		skipped[root] = append(skipped[root], ruleLabel(rules[i]))
+	}
+	if len(roots) == 0 {
+		return
+	}
+
+	total := 0
+	for _, labels := range skipped {
+		total += len(labels)
+	}
+	fmt.Printf("\n%s\n", ui.FormatError(fmt.Sprintf("%d rule(s) skipped because a rule they depend on failed:", total)))
+	for _, root := range roots {
+		fmt.Printf("  %s failed → skipped %s\n", ui.FormatHighlight(ruleLabel(rules[root])), strings.Join(skipped[root], ", "))
+	}
+}
+
+// Impact prints every rule of the blueprint that depends on the rule ref
+// names (an id or anything after: accepts), directly or transitively: the
+// rules that would be skipped if it failed. Only rules for the current OS are
+// considered, as in apply.
+func Impact(file, ref string, preferSSH bool) int {
+	setupPath, _, cleanup, err := resolveBlueprintFile(file, true, preferSSH)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+	defer cleanup()
+
+	rules, err := parser.ParseFile(setupPath)
+	if err != nil {
+		fmt.Println("Parse error:", err)
+		return 1
+	}
+	vars := resolveVarMap(rules, machineVars(nil))
+	for i, r := range rules {
+		rules[i] = interpolateRule(r, vars)
+	}
+	rules = filterRulesByOS(rules)
+	ordered, err := executionOrder(rules)
+	if err != nil {
+		fmt.Printf("%s\n", ui.FormatError(err.Error()))
+		return 1
+	}
+
+	g := newDependencyGraph(ordered)
+	target, ok := g.lookup(ref)
+	if !ok {
+		fmt.Printf("%s\n", ui.FormatError(fmt.Sprintf("No rule matches %q (use an id: or a resource after: accepts)", ref)))
+		return 1
+	}
+
+	found, via := g.transitiveDependents(target)
+	fmt.Printf("\n%s\n\n", ui.FormatHighlight(fmt.Sprintf("=== Impact of %s ===", ruleLabel(ordered[target]))))
+	if len(found) == 0 {
+		fmt.Printf("%s\n\n", ui.FormatSuccess("No rule depends on it."))
+		return 0
+	}
+	rows := make([][]string, 0, len(found))
+	for _, i := range found {
+		rows = append(rows, []string{ruleLabel(ordered[i]), ui.FormatDim("after: " + ruleLabel(ordered[via[i]]))})
+	}
+	for _, line := range ui.AlignColumns(rows) {
+		fmt.Printf("  %s\n", line)
+	}
+	fmt.Printf("\n%d rule(s) depend on %s and would be skipped if it failed.\n\n", len(found), ruleLabel(ordered[target]))
+	return 0
+}
@@ -0,0 +1,75 @@
+package engine
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/elpic/blueprint/internal/parser"
+)
+
+func TestDependencyGraphTransitiveDependents(t *testing.T) {
+	rules := []parser.Rule{
+		{ID: "ssh-dir", Action: "mkdir", Mkdir: "~/.ssh"},
+		{ID: "hosts", Action: "known_hosts", KnownHosts: "github.com", After: []string{"ssh-dir"}},
+		{Action: "install", Packages: []parser.Package{{Name: "git"}}},
+		{ID: "clone", Action: "clone", CloneURL: "git@github.com:u/r.git", ClonePath: "~/r", After: []string{"hosts", "git"}},
+		{ID: "renamed", Aliases: []string{"old-dir"}, Action: "mkdir", Mkdir: "~/w"},
+		{ID: "work", Action: "mkdir", Mkdir: "~/w/x", After: []string{"old-dir"}},
+	}
+	g := newDependencyGraph(rules)
+
+	found, via := g.transitiveDependents(0)
+	if !reflect.DeepEqual(found, []int{1, 3}) || via[1] != 0 || via[3] != 1 {
+		t.Errorf("dependents of ssh-dir = %v via %v, want hosts and clone", found, via)
+	}
+	if i, ok := g.lookup("git"); !ok || i != 2 {
+		t.Errorf("lookup(git) = %d, %v; want the install rule", i, ok)
+	}
+	if found, _ := g.transitiveDependents(2); !reflect.DeepEqual(found, []int{3}) {
+		t.Errorf("dependents of git = %v, want clone", found)
+	}
+	if found, _ := g.transitiveDependents(4); !reflect.DeepEqual(found, []int{5}) {
+		t.Errorf("dependents through an alias = %v, want work", found)
+	}
+	if found, _ := g.transitiveDependents(3); len(found) != 0 {
+		t.Errorf("clone has no dependents, got %v", found)
+	}
+}
+
+func TestExecuteRulesSkipsDependentsOfFailedRule(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	dir := t.TempDir()
+	blocker := filepath.Join(dir, "file")
+	if err := os.WriteFile(blocker, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	rules := []parser.Rule{
+		{ID: "a", Action: "mkdir", Mkdir: filepath.Join(blocker, "sub")}, // fails: parent is a file
+		{ID: "b", Action: "mkdir", Mkdir: filepath.Join(dir, "b"), After: []string{"a"}},
+		{ID: "c", Action: "mkdir", Mkdir: filepath.Join(dir, "c"), After: []string{"b"}},
+		{ID: "d", Action: "mkdir", Mkdir: filepath.Join(dir, "d")},
+		{ID: "e", Action: "mkdir", Mkdir: filepath.Join(dir, "e"), After: []string{"a"}},
+	}
+	records := executeRules(rules, "/tmp/test.bp", "linux", "/tmp", 0)
+
+	ordered, err := executionOrder(rules)
+	if err != nil {
+		t.Fatal(err)
+	}
+	status := map[string]string{}
+	for i, r := range ordered {
+		status[r.ID] = records[i].Status
+	}
+	want := map[string]string{"a": "error", "b": statusSkipped, "c": statusSkipped, "d": "success", "e": statusSkipped}
+	if !reflect.DeepEqual(status, want) {
+		t.Errorf("statuses = %v, want %v", status, want)
+	}
+	for _, id := range []string{"b", "c", "e"} {
+		if _, err := os.Stat(filepath.Join(dir, id)); err == nil {
+			t.Errorf("rule %s should not have run", id)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package engine
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	handlerskg "github.com/elpic/blueprint/internal/handlers"
+	"github.com/elpic/blueprint/internal/parser"
+	"github.com/elpic/blueprint/internal/ui"
+)
+
+// interactive is set by --interactive: plan and apply draw their rules as a
+// live tree on the terminal (see ui.Dashboard) instead of printing them one
+// after another.
+var interactive bool
+
+// SetInteractive controls whether plan and apply show the interactive view.
+func SetInteractive(on bool) {
+	interactive = on
+}
+
+// runDashboard is the view of the apply in progress, nil unless
+// --interactive. Its items are the rules in record order.
+var runDashboard *ui.Dashboard
+
+// checkInteractive returns why --interactive cannot be used for this run, or
+// "" when it can.
+func checkInteractive() string {
+	switch {
+	case !interactive:
+		return ""
+	case jsonOutput:
+		return "--interactive cannot be combined with --output json"
+	case !ui.IsTerminal(os.Stdout):
+		return "--interactive needs a terminal"
+	}
+	return ""
+}
+
+// dashboardItem describes rule as the interactive view lists it.
+func dashboardItem(rule parser.Rule) ui.DashboardItem {
+	label := rule.Action + " " + handlerskg.RuleSummary(rule)
+	if rule.ID != "" {
+		label += " (" + rule.ID + ")"
+	}
+	return ui.DashboardItem{Group: rule.Group, Label: label}
+}
+
+// dashboardAdd lists rules on the interactive view, if any.
+func dashboardAdd(rules []parser.Rule) {
+	if runDashboard == nil {
+		return
+	}
+	for _, rule := range rules {
+		runDashboard.Add(dashboardItem(rule))
+	}
+}
+
+// dashboardBegin shows the rule at idx as running on the interactive view.
+func dashboardBegin(idx int) {
+	if runDashboard != nil {
+		runDashboard.Begin(idx)
+	}
+}
+
+// dashboardEnd shows the result of the rule at idx on the interactive view,
+// with its output as the terminal would show it.
+func dashboardEnd(idx int, record ExecutionRecord) {
+	if runDashboard == nil {
+		return
+	}
+	state := ui.ItemDone
+	switch record.Status {
+	case "error":
+		state = ui.ItemFailed
+	case statusSkipped, statusNotAttempted:
+		state = ui.ItemSkipped
+	}
+	if !showSensitive {
+		record = record.redacted()
+	}
+	detail := record.Output
+	if record.Error != "" {
+		detail = strings.TrimSpace(detail + "\n" + record.Error)
+	}
+	if record.Hint != "" {
+		detail += "\n→ " + record.Hint
+	}
+	runDashboard.End(idx, state, detail)
+}
+
+// startDashboard shows the apply of a blueprint as a live tree and returns
+// the function that stops it. Until then the text the run prints is
+// discarded, as the tree replaces it.
+func startDashboard(title string) func() {
+	tty := os.Stdout
+	devNull, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	if err != nil {
+		return func() {}
+	}
+	runDashboard = ui.NewDashboard(tty, title, nil)
+	os.Stdout = devNull
+	runDashboard.Run()
+	return func() {
+		runDashboard.Stop()
+		fmt.Fprint(tty, "\n\n")
+		runDashboard = nil
+		os.Stdout = tty
+		_ = devNull.Close()
+	}
+}
+
+// browsePlan shows a plan as a tree the user browses: the rules by group
+// with what applying each would change, and its command when opened.
+func browsePlan(title string, rules []parser.Rule, changes []handlerskg.PlanChange, cleanups []parser.Rule, cleanupChanges []handlerskg.PlanChange) error {
+	var items []ui.DashboardItem
+	add := func(rule parser.Rule, change handlerskg.PlanChange, group string) {
+		item := dashboardItem(rule)
+		if group != "" {
+			item.Group = group
+		}
+		item.Note = formatPlanChange(change)
+		if handler := handlerskg.NewHandler(rule, "", map[string]string{}); handler != nil {
+			item.Detail = handler.GetCommand()
+		}
+		if len(rule.After) > 0 {
+			item.Detail += "\nafter: " + strings.Join(rule.After, ", ")
+		}
+		items = append(items, item)
+	}
+	for i, rule := range rules {
+		add(rule, changes[i], "")
+	}
+	for i, rule := range cleanups {
+		add(rule, cleanupChanges[i], "auto-uninstall")
+	}
+
+	view := ui.NewDashboard(os.Stdout, title, items)
+	view.SetFooter(ui.FormatHighlight(planSummary(slices.Concat(changes, cleanupChanges))))
+	return view.Browse(os.Stdin)
+}
@@ -0,0 +1,64 @@
+package engine
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// machineIDEnv names the variable that overrides the machine ID, for hosts
+// cloned from one image that share a machine-id.
+const machineIDEnv = "BLUEPRINT_MACHINE_ID"
+
+// machineIDFiles are read in order for the machine ID on Linux.
+var machineIDFiles = []string{"/etc/machine-id", "/var/lib/dbus/machine-id"}
+
+// platformUUIDPattern finds the hardware UUID in `ioreg` output on macOS.
+var platformUUIDPattern = regexp.MustCompile(`"IOPlatformUUID" = "([^"]+)"`)
+
+// machineID identifies this machine in status entries, so that the machines
+// sharing one home directory (over NFS, or the two systems of a dual-boot
+// machine) each manage only what they installed. It is $BLUEPRINT_MACHINE_ID
+// when set, and otherwise a short hash of the systemd machine-id, the macOS
+// hardware UUID or the hostname, so the identifier itself is not stored.
+func machineID() string {
+	if id := os.Getenv(machineIDEnv); id != "" {
+		return id
+	}
+	return hostMachineID()
+}
+
+// hostMachineID is looked up once per process. Var for test stubbing.
+var hostMachineID = sync.OnceValue(func() string {
+	raw := readMachineID()
+	if raw == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(raw))
+	return hex.EncodeToString(sum[:])[:12]
+})
+
+// readMachineID returns the raw identifier of this machine, or "" when there
+// is none to be found.
+func readMachineID() string {
+	for _, path := range machineIDFiles {
+		if data, err := os.ReadFile(path); err == nil { // #nosec G304 -- fixed system paths
+			if id := strings.TrimSpace(string(data)); id != "" {
+				return id
+			}
+		}
+	}
+	if out, err := exec.Command("ioreg", "-rd1", "-c", "IOPlatformExpertDevice").Output(); err == nil {
+		if m := platformUUIDPattern.FindSubmatch(out); m != nil {
+			return string(m[1])
+		}
+	}
+	if host, err := os.Hostname(); err == nil {
+		return host
+	}
+	return ""
+}
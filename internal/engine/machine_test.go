@@ -0,0 +1,59 @@
+package engine
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+
+	handlerskg "github.com/elpic/blueprint/internal/handlers"
+)
+
+func TestStatusIsScopedToMachine(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv(machineIDEnv, "laptop")
+	bp := "/tmp/test.bp"
+
+	statusPath, err := getStatusPath()
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(handlerskg.Status{Mkdirs: []handlerskg.MkdirStatus{
+		{Path: "/tmp/desktop-only", Blueprint: bp, OS: "linux", Machine: "desktop"},
+		{Path: "/tmp/legacy", Blueprint: bp, OS: "linux"},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(statusPath, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	uninstalls := getAutoUninstallRules(nil, bp, "linux")
+	if len(uninstalls) != 1 || uninstalls[0].Mkdir != "/tmp/legacy" {
+		t.Errorf("getAutoUninstallRules() = %+v, want only the entry not recorded on another machine", uninstalls)
+	}
+
+	if err := saveStatus(nil, nil, bp, "", "linux"); err != nil {
+		t.Fatal(err)
+	}
+	machines := map[string]string{}
+	for _, m := range loadCurrentStatus().Mkdirs {
+		machines[m.Path] = m.Machine
+	}
+	if machines["/tmp/desktop-only"] != "desktop" {
+		t.Errorf("the other machine's entry was not kept: %v", machines)
+	}
+	if machine, ok := machines["/tmp/legacy"]; ok && machine != "laptop" {
+		t.Errorf("legacy entry recorded on %q, want it taken over by this machine", machine)
+	}
+}
+
+func TestPendingOnMachine(t *testing.T) {
+	pending := []handlerskg.PendingRemoval{{Machine: "laptop"}, {Machine: "desktop"}, {}}
+	if mine := pendingOnMachine(pending, "laptop", true); len(mine) != 2 {
+		t.Errorf("mine = %+v, want this machine's and the unrecorded one", mine)
+	}
+	if others := pendingOnMachine(pending, "laptop", false); len(others) != 1 || others[0].Machine != "desktop" {
+		t.Errorf("others = %+v, want the desktop one", others)
+	}
+}
@@ -0,0 +1,61 @@
+package engine
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+
+	"github.com/elpic/blueprint/internal/parser"
+)
+
+// machineVarsFiles returns the machine-scoped variable files, the one in
+// SharedBlueprintDir first so the user's ~/.blueprint/vars.toml overrides it.
+var machineVarsFiles = func() []string {
+	files := []string{filepath.Join(SharedBlueprintDir, "vars.toml")}
+	if homeDir, err := os.UserHomeDir(); err == nil {
+		files = append(files, filepath.Join(homeDir, ".blueprint", "vars.toml"))
+	}
+	return files
+}
+
+// withMachineVars returns cliVars layered over the values of the machine's
+// vars.toml files, so a shared blueprint can be parameterized per host
+// without editing it. Like --var, these values win over the defaults in the
+// blueprint. Missing files are skipped; the system file is refused when
+// other users could change it.
+func withMachineVars(cliVars map[string]string) (map[string]string, error) {
+	vars := map[string]string{}
+	for i, path := range machineVarsFiles() {
+		data, err := os.ReadFile(path) // #nosec G304 -- fixed machine config paths
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", path, err)
+		}
+		if i == 0 {
+			if err := checkNotShared(path); err != nil {
+				return nil, err
+			}
+		}
+		fileVars, err := parser.ParseVarsFile(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		maps.Copy(vars, fileVars)
+	}
+	maps.Copy(vars, cliVars)
+	return vars, nil
+}
+
+// machineVars is withMachineVars for commands that only read a blueprint,
+// such as status and doctor: a broken vars.toml is reported by apply, so
+// here it only leaves the machine values out.
+func machineVars(cliVars map[string]string) map[string]string {
+	vars, err := withMachineVars(cliVars)
+	if err != nil {
+		return cliVars
+	}
+	return vars
+}
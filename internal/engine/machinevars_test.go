@@ -0,0 +1,64 @@
+package engine
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/elpic/blueprint/internal/parser"
+)
+
+func stubMachineVarsFiles(t *testing.T, files ...string) {
+	t.Helper()
+	orig := machineVarsFiles
+	t.Cleanup(func() { machineVarsFiles = orig })
+	machineVarsFiles = func() []string { return files }
+}
+
+func TestWithMachineVars(t *testing.T) {
+	dir := t.TempDir()
+	system := filepath.Join(dir, "etc", "vars.toml")
+	user := filepath.Join(dir, "home", "vars.toml")
+	writeTestFile(t, system, "workspace = \"/srv/work\"\nregion = \"eu\"\n")
+	writeTestFile(t, user, "workspace = \"~/work\"\n")
+	stubMachineVarsFiles(t, system, user, filepath.Join(dir, "missing.toml"))
+
+	vars, err := withMachineVars(map[string]string{"region": "us"})
+	if err != nil {
+		t.Fatalf("withMachineVars() error: %v", err)
+	}
+	if vars["workspace"] != "~/work" || vars["region"] != "us" {
+		t.Errorf("withMachineVars() = %v, want the user file over the system one and --var over both", vars)
+	}
+
+	rules, err := parser.Parse("var workspace = ~/code\nvar region\nmkdir ${workspace}/${region}\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resolved := resolveVarMap(rules, vars)
+	if got := interpolateRule(rules[2], resolved).Mkdir; got != "~/work/us" {
+		t.Errorf("mkdir = %q, want machine and --var values over the blueprint default", got)
+	}
+}
+
+func TestWithMachineVarsErrors(t *testing.T) {
+	dir := t.TempDir()
+	broken := filepath.Join(dir, "vars.toml")
+	writeTestFile(t, broken, "workspace\n")
+	stubMachineVarsFiles(t, broken)
+	if _, err := withMachineVars(nil); err == nil || !strings.Contains(err.Error(), broken) {
+		t.Errorf("withMachineVars() error = %v, want it to name %s", err, broken)
+	}
+	if vars := machineVars(map[string]string{"a": "b"}); len(vars) != 1 || vars["a"] != "b" {
+		t.Errorf("machineVars() with a broken file = %v, want only the --var values", vars)
+	}
+
+	writeTestFile(t, broken, "workspace = \"/srv\"\n")
+	if err := os.Chmod(broken, 0o666); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := withMachineVars(nil); err == nil || !strings.Contains(err.Error(), "writable by other users") {
+		t.Errorf("withMachineVars() error = %v, want a world-writable system file refused", err)
+	}
+}
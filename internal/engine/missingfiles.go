@@ -0,0 +1,217 @@
+package engine
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/elpic/blueprint/internal"
+	"github.com/elpic/blueprint/internal/git"
+	"github.com/elpic/blueprint/internal/parser"
+	"github.com/elpic/blueprint/internal/ui"
+)
+
+// Plan and validate look for the local files a blueprint reads before apply
+// does: decrypt sources, authorized keys files, render templates and include
+// targets. Every one that is missing is listed at once, rather than apply
+// failing on them one rule at a time. It is a heuristic: paths built from
+// variables are not checked, files in repositories the run has yet to clone
+// are trusted, and any other file an earlier rule creates is reported.
+
+// fileRef is a local file a rule reads.
+type fileRef struct {
+	kind string // what the file is to the rule, for the message
+	path string // as written in the blueprint
+	cwd  bool   // apply also looks for a relative path in the working directory
+}
+
+// ruleFileRefs returns the local files rule reads, as written. Remote
+// sources (@github: shorthands and URLs) and paths built from variables are
+// left out.
+func ruleFileRefs(rule parser.Rule) []fileRef {
+	if rule.Action == "uninstall" {
+		return nil
+	}
+	candidates := []fileRef{
+		{kind: "decrypt source", path: rule.DecryptFile, cwd: true},
+		{kind: "authorized keys file", path: rule.AuthorizedKeysFile, cwd: true},
+		{kind: "encrypted authorized keys file", path: rule.AuthorizedKeysEncrypted, cwd: true},
+		{kind: "template", path: rule.RenderTemplate},
+	}
+	var refs []fileRef
+	for _, ref := range candidates {
+		if ref.path == "" || strings.HasPrefix(ref.path, "@") || strings.Contains(ref.path, "://") || strings.Contains(ref.path, "$") {
+			continue
+		}
+		refs = append(refs, ref)
+	}
+	return refs
+}
+
+// fileRefCandidates returns the paths apply tries for ref, in order: a
+// relative path against basePath and, when ref.cwd, the working directory,
+// as the handlers resolve it.
+func fileRefCandidates(ref fileRef, basePath string) []string {
+	if strings.HasPrefix(ref.path, "~") || filepath.IsAbs(ref.path) {
+		return []string{expandHomedir(ref.path)}
+	}
+	candidates := []string{filepath.Join(basePath, ref.path)}
+	if ref.cwd {
+		if wd, err := os.Getwd(); err == nil && wd != basePath {
+			candidates = append(candidates, filepath.Join(wd, ref.path))
+		}
+	}
+	return candidates
+}
+
+// checkMissingFiles reports the files rules read that cannot be found, with
+// relative paths resolved against basePath, the directory of the blueprint
+// (of its clone, for a blueprint from git). A file inside a repository a
+// clone rule of the run has not cloned yet cannot be checked, and is not
+// reported.
+func checkMissingFiles(rules []parser.Rule, basePath string) []validateIssue {
+	var pendingClones []string
+	for _, r := range rules {
+		for _, dir := range []string{r.ClonePath, r.DotfilesPath} {
+			if dir == "" {
+				continue
+			}
+			if dir = expandHomedir(dir); !fileExists(dir) {
+				pendingClones = append(pendingClones, dir)
+			}
+		}
+	}
+
+	var issues []validateIssue
+	for i, r := range rules {
+	refs:
+		for _, ref := range ruleFileRefs(r) {
+			candidates := fileRefCandidates(ref, basePath)
+			var looked []string
+			for _, path := range candidates {
+				if fileExists(path) {
+					continue refs
+				}
+				for _, clone := range pendingClones {
+					if internal.HasPathPrefix(path, clone) {
+						continue refs
+					}
+				}
+				looked = append(looked, ui.AbbreviateHome(filepath.Dir(path)))
+			}
+			issues = append(issues, ruleIssue(i, r, fmt.Sprintf("%s %s not found (looked in %s)", ref.kind, ref.path, strings.Join(looked, ", "))))
+		}
+	}
+	return issues
+}
+
+// fileExists reports whether path exists.
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// checkIncludes reports every local include of the blueprint at path, and of
+// the blueprints it includes, whose target is missing. The parser stops at
+// the first one; this lists them all. Git includes and YAML blueprints are
+// not followed.
+func checkIncludes(path string) []validateIssue {
+	var issues []validateIssue
+	seen := map[string]bool{}
+	var scan func(file string)
+	scan = func(file string) {
+		abs, err := filepath.Abs(file)
+		if err != nil || seen[abs] {
+			return
+		}
+		seen[abs] = true
+		if ext := filepath.Ext(abs); ext == ".yaml" || ext == ".yml" {
+			return
+		}
+		data, err := parser.ReadInclude(abs)
+		if err != nil {
+			return
+		}
+		scanner := bufio.NewScanner(bytes.NewReader(data))
+		for lineNum := 1; scanner.Scan(); lineNum++ {
+			code, _ := parser.SplitComment(scanner.Text())
+			target, ok := includeTarget(strings.TrimSpace(code))
+			if !ok || git.IsGitURL(target) || strings.Contains(target, "$") {
+				continue
+			}
+			resolved := expandHomedir(target)
+			if !filepath.IsAbs(resolved) {
+				resolved = filepath.Join(filepath.Dir(abs), resolved)
+			}
+			if !fileExists(resolved) {
+				issues = append(issues, validateIssue{
+					at:      fmt.Sprintf("%s:%d", ui.AbbreviateHome(abs), lineNum),
+					summary: "include",
+					message: fmt.Sprintf("%s not found", ui.AbbreviateHome(resolved)),
+				})
+				continue
+			}
+			scan(resolved)
+		}
+	}
+	scan(path)
+	return issues
+}
+
+// includeTarget returns the file an include line names, without its
+// prefer_ssh: flag and "as <namespace>" suffix.
+func includeTarget(line string) (string, bool) {
+	rest, ok := strings.CutPrefix(line, "include ")
+	if !ok {
+		return "", false
+	}
+	var words []string
+	fields := strings.Fields(rest)
+	for i := 0; i < len(fields); i++ {
+		if fields[i] == "prefer_ssh:" {
+			i++ // and its value
+			continue
+		}
+		if strings.HasPrefix(fields[i], "prefer_ssh:") {
+			continue
+		}
+		words = append(words, fields[i])
+	}
+	if n := len(words); n >= 3 && words[n-2] == "as" {
+		words = words[:n-2]
+	}
+	if len(words) == 0 {
+		return "", false
+	}
+	return strings.Join(words, " "), true
+}
+
+// printMissingFiles prints issues about missing files as warnings, under a
+// line counting them.
+func printMissingFiles(issues []validateIssue) {
+	word := "file"
+	if len(issues) != 1 {
+		word = "files"
+	}
+	fmt.Fprintf(os.Stderr, "%s\n", ui.FormatError(fmt.Sprintf("Warning: %d referenced %s not found:", len(issues), word)))
+	for _, issue := range issues {
+		fmt.Fprintf(os.Stderr, "  %s\n", issue.String())
+	}
+}
+
+// reportMissingIncludes prints the missing include targets of the local
+// blueprints among files, when a plan could not load them.
+func reportMissingIncludes(files []string) {
+	var issues []validateIssue
+	for _, file := range files {
+		if !git.IsGitURL(file) {
+			issues = append(issues, checkIncludes(file)...)
+		}
+	}
+	if len(issues) > 0 {
+		printMissingFiles(issues)
+	}
+}
@@ -0,0 +1,66 @@
+package engine
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/elpic/blueprint/internal/parser"
+)
+
+func TestCheckMissingFiles(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	base := t.TempDir()
+	t.Chdir(t.TempDir())
+	writeTestFile(t, filepath.Join(base, "secrets", "token.enc"), "x")
+
+	rules := []parser.Rule{
+		{Action: "decrypt", DecryptFile: "secrets/token.enc", DecryptPath: "~/.token"},
+		{Action: "decrypt", DecryptFile: "secrets/missing.enc", DecryptPath: "~/.missing"},
+		{Action: "render", RenderTemplate: "templates/app.tmpl"},
+		{Action: "render", RenderTemplate: "@github:org/templates@main:app"},
+		{Action: "authorized_keys", AuthorizedKeysFile: "~/keys.pub"},
+		// Not cloned yet: files inside it cannot be checked
+		{Action: "clone", CloneURL: "https://github.com/me/dotfiles.git", ClonePath: "~/dotfiles"},
+		{Action: "decrypt", DecryptFile: "~/dotfiles/secret.enc", DecryptPath: "~/.secret"},
+		{Action: "uninstall", DecryptFile: "secrets/gone.enc", DecryptPath: "~/.gone"},
+	}
+	issues := checkMissingFiles(rules, base)
+	if len(issues) != 3 {
+		t.Fatalf("checkMissingFiles() = %v, want missing.enc, app.tmpl and keys.pub", issues)
+	}
+	for i, want := range []string{"decrypt source secrets/missing.enc not found", "template templates/app.tmpl not found", "authorized keys file ~/keys.pub not found"} {
+		if !strings.Contains(issues[i].message, want) {
+			t.Errorf("issue %d = %q, want it to contain %q", i, issues[i].message, want)
+		}
+	}
+	if issues[0].line != 2 {
+		t.Errorf("issue about missing.enc is on rule %d, want 2", issues[0].line)
+	}
+}
+
+func TestCheckIncludes(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "setup.bp"), strings.Join([]string{
+		"include base.bp",
+		"include missing-one.bp as one # a comment",
+		"include prefer_ssh: true missing-two.bp",
+		"include https://github.com/org/shared.git",
+		"install git",
+	}, "\n"))
+	writeTestFile(t, filepath.Join(dir, "base.bp"), "include nested/missing-three.bp\ninclude setup.bp\n")
+
+	issues := checkIncludes(filepath.Join(dir, "setup.bp"))
+	var got []string
+	for _, issue := range issues {
+		got = append(got, filepath.Base(strings.TrimSuffix(issue.message, " not found")))
+	}
+	want := "missing-three.bp missing-one.bp missing-two.bp"
+	if strings.Join(got, " ") != want {
+		t.Errorf("checkIncludes() = %v, want %s", issues, want)
+	}
+	if !strings.HasSuffix(issues[1].at, "setup.bp:2") {
+		t.Errorf("issue about missing-one.bp at %q, want setup.bp:2", issues[1].at)
+	}
+}
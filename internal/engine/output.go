@@ -0,0 +1,193 @@
+package engine
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	handlerskg "github.com/elpic/blueprint/internal/handlers"
+	"github.com/elpic/blueprint/internal/parser"
+)
+
+// jsonOutput is set by --output json: plan, apply, status, history and explain
+// then print one JSON document on stdout instead of colored text.
+var jsonOutput bool
+
+// SetOutputFormat selects how plan, apply, status and history print their
+// results: "text" (the default) or "json".
+func SetOutputFormat(format string) error {
+	switch format {
+	case "text":
+		jsonOutput = false
+	case "json":
+		jsonOutput = true
+	default:
+		return fmt.Errorf("unknown output format %q: use text or json", format)
+	}
+	return nil
+}
+
+// JSONOutput reports whether --output json was given.
+func JSONOutput() bool {
+	return jsonOutput
+}
+
+// printJSON writes v to w as indented JSON.
+func printJSON(w io.Writer, v any) error {
+	out, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(w, string(out))
+	return err
+}
+
+// redirectStdout sends what a JSON run prints as text to stderr, where it
+// still shows progress and prompts, and returns the real stdout for the JSON
+// document along with a function that restores it.
+func redirectStdout() (io.Writer, func()) {
+	stdout := os.Stdout
+	os.Stdout = os.Stderr
+	return stdout, func() { os.Stdout = stdout }
+}
+
+// jsonRun is the document plan and apply print with --output json.
+type jsonRun struct {
+	Blueprint  string        `json:"blueprint"`
+	OS         string        `json:"os"`
+	DryRun     bool          `json:"dry_run"`
+	Run        int           `json:"run,omitempty"`
+	Started    string        `json:"started,omitempty"`
+	DurationMs int64         `json:"duration_ms,omitempty"`
+	Result     string        `json:"result,omitempty"`
+	ExitCode   int           `json:"exit_code"`
+	Rules      []jsonRule    `json:"rules"`
+	Cleanups   []jsonRule    `json:"cleanups,omitempty"`
+	Skipped    []jsonSkipped `json:"skipped,omitempty"`
+	Held       []jsonHeld    `json:"held,omitempty"`
+}
+
+// jsonRule is a rule of a plan or apply. Change is only set by plan and the
+// fields after it only by apply.
+type jsonRule struct {
+	Action     string `json:"action"`
+	ID         string `json:"id,omitempty"`
+	Address    string `json:"address,omitempty"`
+	Summary    string `json:"summary"`
+	Command    string `json:"command,omitempty"`
+	Group      string `json:"group,omitempty"`
+	Sudo       bool   `json:"sudo,omitempty"`
+	Change     string `json:"change,omitempty"`
+	Blueprint  string `json:"blueprint,omitempty"`
+	Result     string `json:"result,omitempty"`
+	Status     string `json:"status,omitempty"`
+	DurationMs int64  `json:"duration_ms,omitempty"`
+	Error      string `json:"error,omitempty"`
+	Hint       string `json:"hint,omitempty"`
+	Flapping   bool   `json:"flapping,omitempty"`
+}
+
+// jsonSkipped is a rule the run left out and why.
+type jsonSkipped struct {
+	Action  string `json:"action"`
+	Summary string `json:"summary"`
+	Reason  string `json:"reason"`
+}
+
+// jsonHeld is a removal held back by the cleanup grace period.
+type jsonHeld struct {
+	Action       string `json:"action"`
+	Resource     string `json:"resource"`
+	Applies      int    `json:"applies"`
+	MissingSince string `json:"missing_since"`
+}
+
+// newJSONRule describes rule as plan shows it.
+func newJSONRule(rule parser.Rule) jsonRule {
+	action := rule.Action
+	if action == "uninstall" {
+		action = handlerskg.DetectRuleType(rule)
+	}
+	r := jsonRule{
+		Action:  action,
+		ID:      rule.ID,
+		Address: rule.Address,
+		Summary: handlerskg.RuleSummary(rule),
+		Group:   rule.Group,
+		Sudo:    ruleNeedsSudo(rule),
+	}
+	if handler := handlerskg.NewHandler(rule, "", passwordCache.snapshot()); handler != nil {
+		r.Command = handler.GetCommand()
+	}
+	return r
+}
+
+// newJSONRun returns the parts of the JSON document shared by plan and apply.
+func newJSONRun(blueprint, osName string, dry bool, skipped []skippedRule, held []heldRemoval) jsonRun {
+	run := jsonRun{Blueprint: blueprint, OS: osName, DryRun: dry, Rules: []jsonRule{}}
+	for _, s := range skipped {
+		run.Skipped = append(run.Skipped, jsonSkipped{Action: s.rule.Action, Summary: handlerskg.RuleSummary(s.rule), Reason: s.reason})
+	}
+	for _, h := range held {
+		run.Held = append(run.Held, jsonHeld{
+			Action:       h.pending.Action,
+			Resource:     h.pending.Resource,
+			Applies:      h.pending.Applies,
+			MissingSince: h.pending.MissingSince,
+		})
+	}
+	return run
+}
+
+// planJSON returns the JSON document of a plan.
+// changes holds what applying each of rules would do.
+func planJSON(blueprint, osName string, rules []parser.Rule, changes []handlerskg.PlanChange, autoUninstall []parser.Rule, skipped []skippedRule, held []heldRemoval) jsonRun {
+	run := newJSONRun(blueprint, osName, true, skipped, held)
+	for i, rule := range rules {
+		r := newJSONRule(rule)
+		r.Change = string(changes[i])
+		run.Rules = append(run.Rules, r)
+	}
+	for _, rule := range autoUninstall {
+		r := newJSONRule(rule)
+		r.Change = string(handlerskg.PlanDelete)
+		run.Cleanups = append(run.Cleanups, r)
+	}
+	return run
+}
+
+// applyJSON returns the JSON document of an apply, from the rules it ran
+// paired with their records as in the apply report.
+func applyJSON(report *applyReport, runNumber, exitCode int) jsonRun {
+	run := newJSONRun(report.Blueprint, report.OS, false, report.Skipped, report.Held)
+	run.Run = runNumber
+	run.Started = report.Started.Format(time.RFC3339)
+	run.DurationMs = report.Finished.Sub(report.Started).Milliseconds()
+	run.ExitCode = exitCode
+	for i, count := range report.counts() {
+		if i > 0 {
+			run.Result += ", "
+		}
+		run.Result += count
+	}
+	for _, r := range report.Rules {
+		record := r.record.redacted()
+		rule := newJSONRule(r.rule)
+		rule.Command = record.Command
+		rule.Blueprint = record.Blueprint
+		rule.Result = r.result()
+		rule.Status = record.Status
+		rule.DurationMs = record.DurationMs
+		rule.Error = record.Error
+		rule.Hint = record.Hint
+		rule.Flapping = record.Flapping
+		if r.cleanup() {
+			run.Cleanups = append(run.Cleanups, rule)
+		} else {
+			run.Rules = append(run.Rules, rule)
+		}
+	}
+	return run
+}
@@ -0,0 +1,74 @@
+package engine
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	handlerskg "github.com/elpic/blueprint/internal/handlers"
+	"github.com/elpic/blueprint/internal/parser"
+)
+
+func TestSetOutputFormat(t *testing.T) {
+	t.Cleanup(func() { jsonOutput = false })
+	if err := SetOutputFormat("json"); err != nil || !JSONOutput() {
+		t.Fatalf("SetOutputFormat(json) = %v, JSONOutput() = %v", err, JSONOutput())
+	}
+	if err := SetOutputFormat("text"); err != nil || JSONOutput() {
+		t.Fatalf("SetOutputFormat(text) = %v, JSONOutput() = %v", err, JSONOutput())
+	}
+	if err := SetOutputFormat("yaml"); err == nil {
+		t.Error("expected an unknown format to be rejected")
+	}
+}
+
+func TestPlanJSON(t *testing.T) {
+	rules := []parser.Rule{{Action: "mkdir", Mkdir: "~/code", ID: "code", Group: "dirs"}}
+	cleanups := []parser.Rule{{Action: "uninstall", Mkdir: "~/old"}}
+	skipped := []skippedRule{{rule: parser.Rule{Action: "mkdir", Mkdir: "~/Library"}, reason: "on: [mac] does not include linux"}}
+
+	var buf bytes.Buffer
+	if err := printJSON(&buf, planJSON("setup.bp", "linux", rules, []handlerskg.PlanChange{handlerskg.PlanNoOp}, cleanups, skipped, nil)); err != nil {
+		t.Fatal(err)
+	}
+	var got jsonRun
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("plan JSON does not parse: %v\n%s", err, buf.String())
+	}
+	if !got.DryRun || got.Blueprint != "setup.bp" || got.OS != "linux" {
+		t.Errorf("plan header = %+v", got)
+	}
+	if len(got.Rules) != 1 || got.Rules[0].Action != "mkdir" || got.Rules[0].ID != "code" || got.Rules[0].Group != "dirs" || got.Rules[0].Summary != "~/code" || got.Rules[0].Change != "no-op" {
+		t.Errorf("plan rules = %+v", got.Rules)
+	}
+	if len(got.Cleanups) != 1 || got.Cleanups[0].Action != "mkdir" || got.Cleanups[0].Summary != "~/old" || got.Cleanups[0].Change != "delete" {
+		t.Errorf("plan cleanups = %+v", got.Cleanups)
+	}
+	if len(got.Skipped) != 1 || got.Skipped[0].Reason != "on: [mac] does not include linux" {
+		t.Errorf("plan skipped = %+v", got.Skipped)
+	}
+}
+
+func TestApplyJSON(t *testing.T) {
+	run := applyJSON(testApplyReport(t), 7, 1)
+
+	if run.DryRun || run.Run != 7 || run.ExitCode != 1 || run.Started != "2026-10-01T09:00:00Z" {
+		t.Errorf("apply header = %+v", run)
+	}
+	if run.Result != "1 removed, 1 unchanged, 1 failed" {
+		t.Errorf("apply result = %q", run.Result)
+	}
+	if len(run.Rules) != 2 || len(run.Cleanups) != 1 {
+		t.Fatalf("apply rules = %+v, cleanups = %+v", run.Rules, run.Cleanups)
+	}
+	failed := run.Rules[1]
+	if failed.Result != "failed" || failed.Status != "error" || failed.DurationMs != 1500 || failed.Error != "exit status 2" {
+		t.Errorf("failed rule = %+v", failed)
+	}
+	if run.Cleanups[0].Result != "removed" || run.Cleanups[0].Summary != "~/old" {
+		t.Errorf("cleanup = %+v", run.Cleanups[0])
+	}
+	if len(run.Skipped) != 1 {
+		t.Errorf("apply skipped = %+v", run.Skipped)
+	}
+}
@@ -0,0 +1,58 @@
+package engine
+
+import (
+	"fmt"
+	"strings"
+
+	handlerskg "github.com/elpic/blueprint/internal/handlers"
+	"github.com/elpic/blueprint/internal/parser"
+	"github.com/elpic/blueprint/internal/ui"
+)
+
+// planRuleChanges returns what applying each of rules would do to the
+// resources status.json records for the blueprint that declares it.
+func planRuleChanges(rules []parser.Rule, sources []blueprintSource, uninstalls map[string][]parser.Rule, osName string) []handlerskg.PlanChange {
+	status, _ := loadCurrentStatus().SplitByMachine(machineID())
+	for _, src := range sources {
+		handlerskg.MigrateAliases(&status, src.rules, src.file, osName)
+	}
+	owners := ruleOwners(sources, uninstalls, osName)
+	changes := make([]handlerskg.PlanChange, len(rules))
+	for i, rule := range rules {
+		blueprint, ok := owners[handlerskg.RuleKey(rule)]
+		if !ok {
+			blueprint = sources[0].file
+		}
+		changes[i] = handlerskg.PlanRuleChange(rule, &status, blueprint, osName)
+	}
+	return changes
+}
+
+// formatPlanChange renders a change the way plan marks each rule.
+func formatPlanChange(change handlerskg.PlanChange) string {
+	switch change {
+	case handlerskg.PlanCreate:
+		return ui.Success.Render("+ create")
+	case handlerskg.PlanUpdate:
+		return ui.FormatHighlight("~ update")
+	case handlerskg.PlanDelete:
+		return ui.Error.Render("- delete")
+	}
+	return ui.FormatDim("= no-op")
+}
+
+// planSummary counts the changes of a plan, e.g.
+// "Plan: 2 to create, 1 to update, 1 to delete, 3 unchanged."
+func planSummary(changes []handlerskg.PlanChange) string {
+	counts := map[handlerskg.PlanChange]int{}
+	for _, c := range changes {
+		counts[c]++
+	}
+	parts := []string{
+		fmt.Sprintf("%d to create", counts[handlerskg.PlanCreate]),
+		fmt.Sprintf("%d to update", counts[handlerskg.PlanUpdate]),
+		fmt.Sprintf("%d to delete", counts[handlerskg.PlanDelete]),
+		fmt.Sprintf("%d unchanged", counts[handlerskg.PlanNoOp]),
+	}
+	return "Plan: " + strings.Join(parts, ", ") + "."
+}
@@ -0,0 +1,14 @@
+package engine
+
+import (
+	"testing"
+
+	handlerskg "github.com/elpic/blueprint/internal/handlers"
+)
+
+func TestPlanSummary(t *testing.T) {
+	changes := []handlerskg.PlanChange{handlerskg.PlanCreate, handlerskg.PlanNoOp, handlerskg.PlanCreate, handlerskg.PlanDelete}
+	if got, want := planSummary(changes), "Plan: 2 to create, 0 to update, 1 to delete, 1 unchanged."; got != want {
+		t.Errorf("planSummary() = %q, want %q", got, want)
+	}
+}
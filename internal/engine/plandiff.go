@@ -0,0 +1,181 @@
+package engine
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/elpic/blueprint/internal"
+	handlerskg "github.com/elpic/blueprint/internal/handlers"
+	"github.com/elpic/blueprint/internal/parser"
+	"github.com/elpic/blueprint/internal/ui"
+	"github.com/elpic/blueprint/internal/ui/timeutil"
+)
+
+// plannedRule is one rule of a plan, as remembered for the next plan.
+type plannedRule struct {
+	Key    string `json:"key"`    // action and resource; stays the same when other attributes change
+	Label  string `json:"label"`  // action and summary, for display
+	Hash   string `json:"hash"`   // digest of every attribute, to notice edits
+	Number string `json:"number"` // where plan listed it: "#3", or "cleanup #1" for auto-uninstalls
+}
+
+// cachedPlan is the last plan computed for a blueprint.
+type cachedPlan struct {
+	PlannedAt string        `json:"planned_at"`
+	Rules     []plannedRule `json:"rules"`
+}
+
+// planChange is a difference between the previous plan and the current one.
+type planChange struct {
+	kind string // "new", "changed" or "removed"
+	rule plannedRule
+}
+
+// getPlanCachePath returns the path to the plan cache of the current
+// workspace.
+func getPlanCachePath() (string, error) {
+	stateDir, err := getStateDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(stateDir, "plans.json"), nil
+}
+
+// planRules describes the rules plan lists: the blueprint's rules, then the
+// auto-uninstalls numbered in their own section.
+func planRules(rules, autoUninstall []parser.Rule) []plannedRule {
+	planned := make([]plannedRule, 0, len(rules)+len(autoUninstall))
+	for i, rule := range rules {
+		planned = append(planned, newPlannedRule(rule, fmt.Sprintf("#%d", i+1)))
+	}
+	for i, rule := range autoUninstall {
+		planned = append(planned, newPlannedRule(rule, fmt.Sprintf("cleanup #%d", i+1)))
+	}
+	return planned
+}
+
+func newPlannedRule(rule parser.Rule, number string) plannedRule {
+	action, resource := rule.Action, handlerskg.RuleKey(rule)
+	if rule.Action == "uninstall" {
+		detected, key := removalIdentity(rule)
+		action, resource = "uninstall "+detected, key
+	} else if def := handlerskg.GetAction(rule.Action); def != nil && def.RuleKey != nil {
+		// The resource, not the id, so renaming an id reads as a change
+		resource = def.RuleKey(rule)
+	}
+
+	// Rule holds only plain values and maps, which marshal deterministically
+	data, _ := json.Marshal(rule)
+	sum := sha256.Sum256(data)
+
+	return plannedRule{
+		Key:    action + "\x00" + resource,
+		Label:  action + " " + handlerskg.RuleSummary(rule),
+		Hash:   hex.EncodeToString(sum[:8]),
+		Number: number,
+	}
+}
+
+// diffPlans lists the rules of current that are new or changed since
+// previous, in current's order, followed by the rules no longer planned.
+func diffPlans(previous, current []plannedRule) []planChange {
+	before := make(map[string]plannedRule, len(previous))
+	for _, r := range previous {
+		before[r.Key] = r
+	}
+	now := make(map[string]bool, len(current))
+
+	var changes []planChange
+	for _, r := range current {
+		now[r.Key] = true
+		old, ok := before[r.Key]
+		switch {
+		case !ok:
+			changes = append(changes, planChange{kind: "new", rule: r})
+		case old.Hash != r.Hash:
+			changes = append(changes, planChange{kind: "changed", rule: r})
+		}
+	}
+	for _, r := range previous {
+		if !now[r.Key] {
+			changes = append(changes, planChange{kind: "removed", rule: r})
+		}
+	}
+	return changes
+}
+
+// loadPlanCache reads the cached plans, keyed by normalized blueprint.
+// A missing or unreadable cache is empty.
+func loadPlanCache(path string) map[string]cachedPlan {
+	plans := map[string]cachedPlan{}
+	if data, err := os.ReadFile(path); err == nil { // #nosec G304 -- path is derived from the user's home directory
+		_ = json.Unmarshal(data, &plans)
+	}
+	return plans
+}
+
+// comparePlanWithPrevious prints how the plan for blueprint differs from the
+// last plan computed for it, then remembers this plan for the next run.
+// Failing to read or write the cache never fails the plan.
+func comparePlanWithPrevious(blueprint string, rules, autoUninstall []parser.Rule) {
+	path, err := getPlanCachePath()
+	if err != nil {
+		return
+	}
+	key := normalizeBlueprint(blueprint)
+	plans := loadPlanCache(path)
+	current := planRules(rules, autoUninstall)
+
+	if previous, ok := plans[key]; ok {
+		displayPlanChanges(diffPlans(previous.Rules, current), previous.PlannedAt)
+	}
+
+	plans[key] = cachedPlan{PlannedAt: timeutil.Now(), Rules: current}
+	if out, err := json.MarshalIndent(plans, "", "  "); err == nil {
+		_ = os.WriteFile(path, out, internal.FilePermission)
+	}
+}
+
+// displayPlanChanges prints the changes since the previous plan: new rules
+// with +, changed ones with ~ and rules no longer planned with -, each with
+// the number plan lists it under (the previous number for removed ones).
+func displayPlanChanges(changes []planChange, previousAt string) {
+	since := "the last plan"
+	if previousAt != "" {
+		since += " (" + timeutil.Display(previousAt) + ")"
+	}
+	if len(changes) == 0 {
+		fmt.Println(ui.FormatDim("No changes since "+since) + "\n")
+		return
+	}
+
+	noun := "changes"
+	if len(changes) == 1 {
+		noun = "change"
+	}
+	fmt.Println(ui.FormatDim(fmt.Sprintf("─── %d %s since %s ───", len(changes), noun, since)) + "\n")
+	rows := make([][]string, 0, len(changes))
+	for _, c := range changes {
+		marker, style := "+", ui.Success
+		switch c.kind {
+		case "changed":
+			marker, style = "~", ui.Highlight
+		case "removed":
+			marker, style = "-", ui.Error
+		}
+		rows = append(rows, []string{
+			style.Render(marker),
+			ui.FormatDim(c.rule.Number),
+			style.Render(c.rule.Label),
+			ui.FormatDim("(" + c.kind + ")"),
+		})
+	}
+	for _, line := range ui.AlignColumns(rows) {
+		fmt.Printf("  %s\n", line)
+	}
+	fmt.Println()
+}
@@ -0,0 +1,88 @@
+package engine
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/elpic/blueprint/internal/parser"
+)
+
+func TestDiffPlans(t *testing.T) {
+	previous := planRules([]parser.Rule{
+		{Action: "install", Packages: []parser.Package{{Name: "git"}}},
+		{Action: "mkdir", Mkdir: "~/code"},
+		{Action: "run", RunCommand: "echo old"},
+	}, nil)
+	current := planRules([]parser.Rule{
+		{Action: "install", Packages: []parser.Package{{Name: "git"}}},
+		{Action: "mkdir", Mkdir: "~/code", MkdirPerms: "700"},
+		{Action: "install", Packages: []parser.Package{{Name: "curl"}}},
+	}, []parser.Rule{
+		{Action: "uninstall", Packages: []parser.Package{{Name: "wget"}}},
+	})
+
+	changes := diffPlans(previous, current)
+
+	want := []struct{ kind, number string }{
+		{"changed", "#2"},
+		{"new", "#3"},
+		{"new", "cleanup #1"},
+		{"removed", "#3"},
+	}
+	if len(changes) != len(want) {
+		t.Fatalf("got %d changes, want %d: %+v", len(changes), len(want), changes)
+	}
+	for i, w := range want {
+		if changes[i].kind != w.kind || changes[i].rule.Number != w.number {
+			t.Errorf("change %d = %s %s, want %s %s", i, changes[i].kind, changes[i].rule.Number, w.kind, w.number)
+		}
+	}
+	if changes[3].rule.Label != "run echo old" {
+		t.Errorf("removed label = %q, want %q", changes[3].rule.Label, "run echo old")
+	}
+
+	if got := diffPlans(current, current); len(got) != 0 {
+		t.Errorf("identical plans: got %d changes, want none", len(got))
+	}
+}
+
+func TestComparePlanWithPreviousSavesPlan(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	rules := []parser.Rule{{Action: "mkdir", Mkdir: "~/code"}}
+	comparePlanWithPrevious("setup.bp", rules, nil)
+
+	if _, err := os.Stat(filepath.Join(home, ".blueprint", "plans.json")); err != nil {
+		t.Fatalf("plan cache not written: %v", err)
+	}
+	plans := loadPlanCache(filepath.Join(home, ".blueprint", "plans.json"))
+	plan, ok := plans[normalizeBlueprint("setup.bp")]
+	if !ok || len(plan.Rules) != 1 || plan.Rules[0].Number != "#1" {
+		t.Errorf("cached plan = %+v, want the one mkdir rule", plans)
+	}
+}
+
+func TestPlanCacheIsPerWorkspace(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv(WorkspaceEnv, "")
+
+	comparePlanWithPrevious("setup.bp", []parser.Rule{{Action: "mkdir", Mkdir: "~/code"}}, nil)
+	if code := WorkspaceNew("work"); code != 0 {
+		t.Fatalf("WorkspaceNew() = %d", code)
+	}
+	comparePlanWithPrevious("setup.bp", []parser.Rule{{Action: "mkdir", Mkdir: "~/work"}}, nil)
+
+	blueprintDir := filepath.Join(home, ".blueprint")
+	for _, tt := range []struct{ dir, want string }{
+		{blueprintDir, "mkdir ~/code"},
+		{filepath.Join(blueprintDir, workspacesDir, "work"), "mkdir ~/work"},
+	} {
+		plan := loadPlanCache(filepath.Join(tt.dir, "plans.json"))[normalizeBlueprint("setup.bp")]
+		if len(plan.Rules) != 1 || plan.Rules[0].Label != tt.want {
+			t.Errorf("plan cached in %s = %+v, want %s", tt.dir, plan, tt.want)
+		}
+	}
+}
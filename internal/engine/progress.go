@@ -0,0 +1,245 @@
+package engine
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	handlerskg "github.com/elpic/blueprint/internal/handlers"
+	"github.com/elpic/blueprint/internal/parser"
+	"github.com/elpic/blueprint/internal/ui"
+	"github.com/elpic/blueprint/internal/ui/timeutil"
+)
+
+// progressInterval is how often the status line is redrawn.
+const progressInterval = 200 * time.Millisecond
+
+// progressBarWidth is the width of the status line's bar, in cells.
+const progressBarWidth = 20
+
+// ansiEscape matches the color and cursor sequences command output carries,
+// which would garble the status line.
+var ansiEscape = regexp.MustCompile(`\x1b\[[0-9;?]*[A-Za-z]`)
+
+// progress is the status line apply keeps under the rule results on a
+// terminal while rules run: a bar of the rules finished, the time elapsed and
+// an estimate of the time left, the running rule with how long it has been
+// running and the last line its commands printed. Without it a large brew or
+// apt install looks frozen for minutes.
+type progress struct {
+	mu        sync.Mutex
+	out       *os.File
+	labels    []string
+	sensitive []bool            // the rule is sensitive: true, see hideOutput
+	started   map[int]time.Time // running rules, by index
+	done      int
+	last      string // last line of command output
+	begin     time.Time
+	hidden    bool // the line is cleared while results are printed
+	drawn     bool
+	stop      chan struct{}
+	stopped   chan struct{}
+}
+
+// liveProgress is the status line of the apply in progress, nil when there
+// is none: output is not a terminal, or JSON or the interactive view is on.
+var liveProgress *progress
+
+// startProgress shows the status line on stdout when it is a terminal and
+// returns the function that removes it.
+func startProgress() func() {
+	if jsonOutput || interactive || !ui.IsTerminal(os.Stdout) {
+		return func() {}
+	}
+	p := &progress{
+		out:     os.Stdout,
+		started: map[int]time.Time{},
+		begin:   time.Now(),
+		stop:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	liveProgress = p
+	handlerskg.SetLiveOutput(p)
+	handlerskg.SetAskAbove(printAboveProgress)
+	go func() {
+		defer close(p.stopped)
+		ticker := time.NewTicker(progressInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-p.stop:
+				return
+			case <-ticker.C:
+				p.mu.Lock()
+				p.draw()
+				p.mu.Unlock()
+			}
+		}
+	}()
+	return func() {
+		close(p.stop)
+		<-p.stopped
+		p.mu.Lock()
+		p.clear()
+		p.mu.Unlock()
+		liveProgress = nil
+		handlerskg.SetLiveOutput(nil)
+		handlerskg.SetAskAbove(nil)
+	}
+}
+
+// trackRules lists rules, in record order, on the status line and the
+// interactive view.
+func trackRules(rules []parser.Rule) {
+	dashboardAdd(rules)
+	if p := liveProgress; p != nil {
+		p.mu.Lock()
+		for _, rule := range rules {
+			p.labels = append(p.labels, rule.Action+" "+handlerskg.RuleSummary(rule))
+			p.sensitive = append(p.sensitive, rule.Sensitive)
+		}
+		p.mu.Unlock()
+	}
+}
+
+// ruleStarted notes that the rule at idx began running.
+func ruleStarted(idx int) {
+	dashboardBegin(idx)
+	if p := liveProgress; p != nil {
+		p.mu.Lock()
+		p.started[idx] = time.Now()
+		p.last = ""
+		p.mu.Unlock()
+	}
+}
+
+// ruleFinished notes the result of the rule at idx.
+func ruleFinished(idx int, record ExecutionRecord) {
+	dashboardEnd(idx, record)
+	if p := liveProgress; p != nil {
+		p.mu.Lock()
+		delete(p.started, idx)
+		p.done++
+		p.mu.Unlock()
+	}
+}
+
+// printAboveProgress runs print, which writes to stdout, with the status
+// line cleared, and draws the line again under what it printed.
+func printAboveProgress(print func()) {
+	p := liveProgress
+	if p == nil {
+		print()
+		return
+	}
+	p.mu.Lock()
+	p.clear()
+	p.hidden = true
+	p.mu.Unlock()
+	print()
+	p.mu.Lock()
+	p.hidden = false
+	p.draw()
+	p.mu.Unlock()
+}
+
+// Write takes the output of the running commands, keeping its last line for
+// the status line.
+func (p *progress) Write(b []byte) (int, error) {
+	text := ansiEscape.ReplaceAllString(string(b), "")
+	lines := strings.FieldsFunc(text, func(r rune) bool { return r == '\n' || r == '\r' })
+	for i := len(lines) - 1; i >= 0; i-- {
+		if line := strings.TrimSpace(lines[i]); line != "" {
+			p.mu.Lock()
+			p.last = line
+			p.mu.Unlock()
+			break
+		}
+	}
+	return len(b), nil
+}
+
+// line returns the status line. p.mu must be held.
+func (p *progress) line() string {
+	total := len(p.labels)
+	elapsed := time.Since(p.begin)
+
+	filled := 0
+	if total > 0 {
+		filled = p.done * progressBarWidth / total
+	}
+	bar := "[" + strings.Repeat("█", filled) + strings.Repeat("░", progressBarWidth-filled) + "]"
+	parts := []string{fmt.Sprintf("%s %d/%d", bar, p.done, total), timeutil.Duration(elapsed)}
+	if p.done > 0 && p.done < total {
+		left := time.Duration(int64(elapsed) / int64(p.done) * int64(total-p.done))
+		parts = append(parts, "~"+timeutil.Duration(left)+" left")
+	}
+
+	// The rule running longest is the one worth watching
+	current := -1
+	for idx, at := range p.started {
+		if current < 0 || at.Before(p.started[current]) {
+			current = idx
+		}
+	}
+	if current >= 0 && current < total {
+		running := fmt.Sprintf("%s (%s)", p.labels[current], timeutil.Duration(time.Since(p.started[current])))
+		if more := len(p.started) - 1; more > 0 {
+			running += fmt.Sprintf(" +%d more", more)
+		}
+		if p.last != "" && !p.hideOutput() {
+			running += ": " + p.last
+		}
+		parts = append(parts, running)
+	}
+	return strings.Join(parts, " · ")
+}
+
+// hideOutput reports whether a running rule is sensitive: true, whose output
+// the terminal does not show without --show-sensitive. Output cannot be told
+// apart between rules running at once, so none is shown then. p.mu must be
+// held.
+func (p *progress) hideOutput() bool {
+	if showSensitive {
+		return false
+	}
+	for idx := range p.started {
+		if idx < len(p.sensitive) && p.sensitive[idx] {
+			return true
+		}
+	}
+	return false
+}
+
+// draw replaces the status line. p.mu must be held.
+func (p *progress) draw() {
+	if p.hidden {
+		return
+	}
+	line := p.line()
+	if width := ui.TerminalWidth(); width > 0 {
+		line = ui.Truncate(line, width-1)
+	}
+	fmt.Fprint(p.out, "\r\033[K"+ui.FormatDim(line))
+	p.drawn = true
+}
+
+// clear removes the status line. p.mu must be held.
+func (p *progress) clear() {
+	if p.drawn {
+		fmt.Fprint(p.out, "\r\033[K")
+		p.drawn = false
+	}
+}
+
+// elapsedNote returns how long a rule ran, to follow its result, or "" for
+// rules done in under a second.
+func elapsedNote(durationMs int64) string {
+	if durationMs < 1000 {
+		return ""
+	}
+	return " " + ui.FormatDim("("+timeutil.Duration(time.Duration(durationMs)*time.Millisecond)+")")
+}
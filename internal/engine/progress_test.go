@@ -0,0 +1,49 @@
+package engine
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProgressLine(t *testing.T) {
+	p := &progress{
+		labels:    []string{"install curl", "run make", "clone repo"},
+		sensitive: []bool{false, false, true},
+		started:   map[int]time.Time{},
+		begin:     time.Now().Add(-30 * time.Second),
+	}
+	if _, err := p.Write([]byte("Fetching...\n\x1b[32mUnpacking curl\x1b[0m\r\n\n")); err != nil {
+		t.Fatal(err)
+	}
+	p.done = 1
+	p.started[1] = time.Now().Add(-5 * time.Second)
+
+	line := p.line()
+	for _, want := range []string{"1/3", "30s", "~1m 0s left", "run make (5s)", ": Unpacking curl"} {
+		if !strings.Contains(line, want) {
+			t.Errorf("line() = %q, want it to contain %q", line, want)
+		}
+	}
+	if strings.Contains(line, "\x1b") {
+		t.Errorf("line() = %q, want the escape sequences of the output stripped", line)
+	}
+
+	p.started[2] = time.Now()
+	line = p.line()
+	if !strings.Contains(line, "run make (5s) +1 more") {
+		t.Errorf("line() = %q, want the longest-running rule and the count of the others", line)
+	}
+	if strings.Contains(line, "Unpacking") {
+		t.Errorf("line() = %q, want output hidden while a sensitive rule runs", line)
+	}
+}
+
+func TestElapsedNote(t *testing.T) {
+	if got := elapsedNote(400); got != "" {
+		t.Errorf("elapsedNote(400) = %q, want \"\"", got)
+	}
+	if got := elapsedNote(75_000); !strings.Contains(got, "(1m 15s)") {
+		t.Errorf("elapsedNote(75000) = %q, want it to contain (1m 15s)", got)
+	}
+}
@@ -0,0 +1,266 @@
+package engine
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	gitpkg "github.com/elpic/blueprint/internal/git"
+	handlerskg "github.com/elpic/blueprint/internal/handlers"
+	"github.com/elpic/blueprint/internal/parser"
+	"github.com/elpic/blueprint/internal/prompt"
+	"github.com/elpic/blueprint/internal/ui"
+	"github.com/elpic/blueprint/internal/ui/timeutil"
+)
+
+// pruneCandidate is a status entry selected for removal by `blueprint status prune`.
+type pruneCandidate struct {
+	entry  handlerskg.StatusEntry
+	reason string
+}
+
+// localBlueprintExists reports whether a local blueprint file is still on disk.
+// Git blueprints always count as existing: whether the repo still exists can't
+// be known without network access, so they are only pruned by age.
+var localBlueprintExists = func(blueprint string) bool {
+	if gitpkg.IsGitURL(blueprint) {
+		return true
+	}
+	_, err := os.Stat(blueprint)
+	return err == nil
+}
+
+// findPruneCandidates returns the entries whose blueprint file no longer exists
+// and, when olderThan is non-zero, the entries last applied more than olderThan
+// before now. Entries without a parseable timestamp are never pruned by age.
+func findPruneCandidates(status *handlerskg.Status, now time.Time, olderThan time.Duration) []pruneCandidate {
+	exists := map[string]bool{}
+	var candidates []pruneCandidate
+	for _, e := range status.AllEntries() {
+		bp := e.GetBlueprint()
+		if _, ok := exists[bp]; !ok {
+			exists[bp] = bp == "" || localBlueprintExists(bp)
+		}
+		if !exists[bp] {
+			candidates = append(candidates, pruneCandidate{entry: e, reason: "blueprint file no longer exists"})
+			continue
+		}
+		if olderThan <= 0 {
+			continue
+		}
+		appliedAt, err := timeutil.Parse(e.GetAppliedAt())
+		if err != nil {
+			continue
+		}
+		if age := now.Sub(appliedAt); age > olderThan {
+			candidates = append(candidates, pruneCandidate{
+				entry:  e,
+				reason: fmt.Sprintf("not applied in %d days", int(age.Hours()/24)),
+			})
+		}
+	}
+	return candidates
+}
+
+// statusWithEntries returns a copy of status holding only the given entries.
+// Handlers' FindUninstallRules work on a whole Status, so this lets them build
+// uninstall rules for exactly the pruned entries.
+func statusWithEntries(status *handlerskg.Status, keep map[handlerskg.StatusEntry]bool) handlerskg.Status {
+	// FilterEntries rebuilds each slice, so filtering the copy leaves status untouched
+	subset := *status
+	matches := map[string]bool{}
+	for e := range keep {
+		matches[pruneKey(e)] = true
+	}
+	subset.FilterEntries(func(e handlerskg.StatusEntry) bool { return matches[pruneKey(e)] })
+	return subset
+}
+
+// pruneKey identifies a status entry across copies of a Status.
+func pruneKey(e handlerskg.StatusEntry) string {
+	return e.GetAction() + "\x00" + e.GetResourceKey() + "\x00" + e.GetBlueprint() + "\x00" + e.GetOS() + "\x00" + e.GetMachine()
+}
+
+// uninstallRulesForPrune returns, per blueprint, the uninstall rules that undo
+// the pruned entries recorded on osName and this machine. Entries from other
+// operating systems or machines cannot be undone from here and get no rules.
+func uninstallRulesForPrune(status *handlerskg.Status, candidates []pruneCandidate, osName string) map[string][]parser.Rule {
+	machine := machineID()
+	byBlueprint := map[string]map[handlerskg.StatusEntry]bool{}
+	for _, c := range candidates {
+		if c.entry.GetOS() != osName || !handlerskg.OnMachine(c.entry, machine) {
+			continue
+		}
+		bp := c.entry.GetBlueprint()
+		if byBlueprint[bp] == nil {
+			byBlueprint[bp] = map[handlerskg.StatusEntry]bool{}
+		}
+		byBlueprint[bp][c.entry] = true
+	}
+
+	rules := map[string][]parser.Rule{}
+	for bp, entries := range byBlueprint {
+		subset := statusWithEntries(status, entries)
+		for _, handler := range handlerskg.GetStatusProviderHandlers() {
+			if provider, ok := handler.(handlerskg.StatusProvider); ok {
+				rules[bp] = append(rules[bp], provider.FindUninstallRules(&subset, nil, bp, osName)...)
+			}
+		}
+	}
+	return rules
+}
+
+// prunePrompt is the confirmation asked before pruning; a variable so tests
+// can answer it.
+var prunePrompt = prompt.Confirm
+
+// PruneStatus removes status entries whose blueprint file no longer exists or,
+// when olderThan is non-zero, that were last applied longer ago than olderThan.
+// The entries are listed and removed only after confirmation. When down is
+// true the resources are uninstalled first (for entries recorded on this OS);
+// a blueprint whose uninstall fails keeps its entries so the prune can be retried.
+func PruneStatus(olderThan time.Duration, down bool) int {
+	status, err := loadStatus()
+	if os.IsNotExist(err) {
+		fmt.Printf("%s\n", ui.FormatInfo("No status found — nothing to prune."))
+		return 0
+	}
+	if err != nil {
+		fmt.Printf("%s\n", ui.FormatError(fmt.Sprintf("Error reading status: %v", err)))
+		return 1
+	}
+
+	candidates := findPruneCandidates(&status, time.Now(), olderThan)
+	if len(candidates) == 0 {
+		fmt.Printf("%s\n", ui.FormatSuccess("No status entries to prune."))
+		return 0
+	}
+	printPruneCandidates(candidates)
+
+	question := fmt.Sprintf("Remove %d entries from status?", len(candidates))
+	if down {
+		question = fmt.Sprintf("Uninstall and remove %d entries from status?", len(candidates))
+	}
+	ok, err := prunePrompt(question, false)
+	if err != nil || !ok {
+		fmt.Printf("%s\n", ui.FormatInfo("Nothing removed."))
+		return 0
+	}
+
+	currentOS := getOSName()
+	failedBlueprints := map[string]bool{}
+	if down {
+		failedBlueprints = runPruneUninstalls(&status, candidates, currentOS)
+	}
+
+	remove := map[string]bool{}
+	kept := 0
+	for _, c := range candidates {
+		if c.entry.GetOS() == currentOS && failedBlueprints[c.entry.GetBlueprint()] {
+			kept++
+			continue
+		}
+		remove[pruneKey(c.entry)] = true
+	}
+	status.FilterEntries(func(e handlerskg.StatusEntry) bool { return !remove[pruneKey(e)] })
+
+	if err := storeStatus(status); err != nil {
+		fmt.Printf("%s\n", ui.FormatError(fmt.Sprintf("Error writing status: %v", err)))
+		return 1
+	}
+
+	fmt.Printf("\n%s\n", ui.FormatSuccess(fmt.Sprintf("Removed %d entries from status.", len(remove))))
+	if kept > 0 {
+		fmt.Printf("%s\n", ui.FormatError(fmt.Sprintf("Kept %d entries whose uninstall failed; fix the errors above and run 'blueprint status prune --down' again.", kept)))
+		return 1
+	}
+	return 0
+}
+
+// runPruneUninstalls runs the uninstall rules for the pruned entries, one
+// blueprint at a time, and returns the blueprints where any rule failed.
+func runPruneUninstalls(status *handlerskg.Status, candidates []pruneCandidate, osName string) map[string]bool {
+	failed := map[string]bool{}
+	rulesByBlueprint := uninstallRulesForPrune(status, candidates, osName)
+
+	var blueprints []string
+	for bp := range rulesByBlueprint {
+		blueprints = append(blueprints, bp)
+	}
+	sort.Strings(blueprints)
+
+	var allRules []parser.Rule
+	for _, bp := range blueprints {
+		allRules = append(allRules, rulesByBlueprint[bp]...)
+	}
+	if len(allRules) == 0 {
+		return failed
+	}
+	if err := promptForSudoPasswordWithOS(allRules, osName); err != nil {
+		fmt.Printf("%s\n", ui.FormatError(fmt.Sprintf("Error prompting for sudo password: %v", err)))
+		for _, bp := range blueprints {
+			failed[bp] = true
+		}
+		return failed
+	}
+	defer clearSudoCache()
+
+	runNumber, err := getNextRunNumber()
+	if err != nil {
+		runNumber = 0
+	}
+	var history []ExecutionRecord
+	for _, bp := range blueprints {
+		fmt.Printf("\n%s\n", ui.FormatHighlight(fmt.Sprintf("Uninstalling resources from %s", bp)))
+		records := executeRules(rulesByBlueprint[bp], bp, osName, "", runNumber)
+		for _, r := range records {
+			if r.Status == "error" {
+				failed[bp] = true
+			}
+		}
+		history = append(history, records...)
+	}
+	if err := saveHistory(runNumber, history); err != nil {
+		fmt.Printf("Warning: Failed to save history: %v\n", err)
+	}
+	return failed
+}
+
+// printPruneCandidates lists the candidates grouped by blueprint.
+func printPruneCandidates(candidates []pruneCandidate) {
+	byBlueprint := map[string][]pruneCandidate{}
+	var blueprints []string
+	for _, c := range candidates {
+		bp := c.entry.GetBlueprint()
+		if _, ok := byBlueprint[bp]; !ok {
+			blueprints = append(blueprints, bp)
+		}
+		byBlueprint[bp] = append(byBlueprint[bp], c)
+	}
+	sort.Strings(blueprints)
+
+	fmt.Printf("\n%s\n", ui.FormatHighlight("=== Prunable Status Entries ==="))
+	for _, bp := range blueprints {
+		fmt.Printf("\n%s\n", ui.FormatInfo(bp))
+		for _, c := range byBlueprint[bp] {
+			fmt.Printf("  %s %s %s\n",
+				ui.FormatError("-"),
+				fmt.Sprintf("%s %s", c.entry.GetAction(), displayResourceKey(c.entry)),
+				ui.FormatDim(fmt.Sprintf("(%s, %s)", c.entry.GetOS(), c.reason)))
+		}
+	}
+	fmt.Printf("\n")
+}
+
+// displayResourceKey renders a resource key for humans; composite keys
+// (plugin + version) are stored NUL-separated.
+func displayResourceKey(e handlerskg.StatusEntry) string {
+	key := []byte(e.GetResourceKey())
+	for i, b := range key {
+		if b == 0 {
+			key[i] = '@'
+		}
+	}
+	return string(key)
+}
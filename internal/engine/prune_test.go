@@ -0,0 +1,125 @@
+package engine
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	handlerskg "github.com/elpic/blueprint/internal/handlers"
+)
+
+func TestFindPruneCandidates(t *testing.T) {
+	dir := t.TempDir()
+	live := filepath.Join(dir, "live.bp")
+	if err := os.WriteFile(live, []byte("mkdir ~/x\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	gone := filepath.Join(dir, "gone.bp")
+	now := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+	old := now.Add(-100 * 24 * time.Hour).Format(time.RFC3339)
+	recent := now.Add(-2 * 24 * time.Hour).Format(time.RFC3339)
+
+	status := &handlerskg.Status{
+		Packages: []handlerskg.PackageStatus{
+			{Name: "git", InstalledAt: recent, Blueprint: gone, OS: "linux"},
+			{Name: "vim", InstalledAt: recent, Blueprint: live, OS: "linux"},
+			{Name: "htop", InstalledAt: old, Blueprint: live, OS: "linux"},
+		},
+		Mkdirs: []handlerskg.MkdirStatus{
+			{Path: "/tmp/a", CreatedAt: "not a time", Blueprint: live, OS: "linux"},
+		},
+		Clones: []handlerskg.CloneStatus{
+			{Path: "/tmp/repo", ClonedAt: recent, Blueprint: "https://github.com/user/gone", OS: "mac"},
+		},
+	}
+
+	got := findPruneCandidates(status, now, 0)
+	if len(got) != 1 || got[0].entry.GetResourceKey() != "git" {
+		t.Fatalf("without --older-than, expected only git (dead blueprint), got %v", got)
+	}
+
+	got = findPruneCandidates(status, now, 30*24*time.Hour)
+	keys := map[string]string{}
+	for _, c := range got {
+		keys[c.entry.GetResourceKey()] = c.reason
+	}
+	if len(keys) != 2 {
+		t.Fatalf("expected git and htop, got %v", keys)
+	}
+	if keys["git"] != "blueprint file no longer exists" {
+		t.Errorf("git reason = %q", keys["git"])
+	}
+	if keys["htop"] != "not applied in 100 days" {
+		t.Errorf("htop reason = %q", keys["htop"])
+	}
+}
+
+func TestUninstallRulesForPrune(t *testing.T) {
+	status := &handlerskg.Status{
+		Mkdirs: []handlerskg.MkdirStatus{
+			{Path: "/tmp/pruned", Blueprint: "/gone.bp", OS: "linux"},
+			{Path: "/tmp/kept", Blueprint: "/gone.bp", OS: "linux"},
+			{Path: "/tmp/other-os", Blueprint: "/gone.bp", OS: "mac"},
+		},
+	}
+	entries := status.AllEntries()
+	candidates := []pruneCandidate{{entry: entries[0]}, {entry: entries[2]}}
+
+	rules := uninstallRulesForPrune(status, candidates, "linux")
+	if len(rules["/gone.bp"]) != 1 {
+		t.Fatalf("expected one uninstall rule, got %+v", rules)
+	}
+	if r := rules["/gone.bp"][0]; r.Action != "uninstall" || r.Mkdir != "/tmp/pruned" {
+		t.Errorf("unexpected rule %+v", r)
+	}
+	if len(status.Mkdirs) != 3 {
+		t.Errorf("status must not be modified, got %d mkdirs", len(status.Mkdirs))
+	}
+}
+
+func TestPruneStatusRemovesConfirmedEntries(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	live := filepath.Join(home, "live.bp")
+	if err := os.WriteFile(live, []byte("mkdir ~/x\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	status := handlerskg.Status{
+		Packages: []handlerskg.PackageStatus{
+			{Name: "git", Blueprint: filepath.Join(home, "gone.bp"), OS: "linux"},
+			{Name: "vim", Blueprint: live, OS: "linux"},
+		},
+	}
+	statusPath, err := getStatusPath()
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := json.Marshal(status)
+	if err := os.WriteFile(statusPath, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	orig := prunePrompt
+	defer func() { prunePrompt = orig }()
+
+	// Declining leaves status.json untouched
+	prunePrompt = func(string, bool) (bool, error) { return false, nil }
+	if code := PruneStatus(0, false); code != 0 {
+		t.Fatalf("PruneStatus() = %d, want 0", code)
+	}
+	if got := loadCurrentStatus(); len(got.Packages) != 2 {
+		t.Fatalf("declined prune removed entries: %+v", got.Packages)
+	}
+
+	prunePrompt = func(string, bool) (bool, error) { return true, nil }
+	if code := PruneStatus(0, false); code != 0 {
+		t.Fatalf("PruneStatus() = %d, want 0", code)
+	}
+	got := loadCurrentStatus()
+	if len(got.Packages) != 1 || got.Packages[0].Name != "vim" {
+		t.Errorf("expected only vim left, got %+v", got.Packages)
+	}
+}
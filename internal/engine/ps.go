@@ -10,6 +10,7 @@ import (
 
 	"github.com/elpic/blueprint/internal"
 	"github.com/elpic/blueprint/internal/ui"
+	"github.com/elpic/blueprint/internal/ui/timeutil"
 )
 
 // ProcessState represents the current execution state written to ~/.blueprint/ps.json
@@ -91,22 +92,6 @@ func isProcessAlive(pid int) bool {
 	return err == nil
 }
 
-// formatDuration formats a duration as a human-readable string
-func formatDuration(d time.Duration) string {
-	if d < time.Minute {
-		return fmt.Sprintf("%ds", int(d.Seconds()))
-	}
-	if d < time.Hour {
-		m := int(d.Minutes())
-		s := int(d.Seconds()) % 60
-		return fmt.Sprintf("%dm %ds", m, s)
-	}
-	h := int(d.Hours())
-	m := int(d.Minutes()) % 60
-	s := int(d.Seconds()) % 60
-	return fmt.Sprintf("%dh %dm %ds", h, m, s)
-}
-
 // PrintPS displays the current blueprint process state
 func PrintPS() {
 	state, err := readPSState()
@@ -124,7 +109,7 @@ func PrintPS() {
 	}
 
 	// Parse timestamps
-	startedAt, err := time.Parse(time.RFC3339, state.StartedAt)
+	startedAt, err := timeutil.Parse(state.StartedAt)
 	if err != nil {
 		fmt.Println("No blueprint process running.")
 		return
@@ -136,7 +121,7 @@ func PrintPS() {
 	fmt.Printf("Blueprint: %s\n", ui.FormatInfo(state.BlueprintFile))
 	fmt.Printf("OS:        %s\n", state.OS)
 	fmt.Printf("PID:       %d\n", state.PID)
-	fmt.Printf("Running:   %s\n", formatDuration(elapsed))
+	fmt.Printf("Running:   %s\n", timeutil.Duration(elapsed))
 
 	// Show current rule progress
 	if state.CurrentRule > 0 {
@@ -145,10 +130,10 @@ func PrintPS() {
 			detail += " " + summary
 		}
 
-		ruleStartedAt, err := time.Parse(time.RFC3339, state.RuleStartedAt)
+		ruleStartedAt, err := timeutil.Parse(state.RuleStartedAt)
 		ruleElapsed := ""
 		if err == nil {
-			ruleElapsed = fmt.Sprintf(" (running for %s)", formatDuration(time.Since(ruleStartedAt)))
+			ruleElapsed = fmt.Sprintf(" (running for %s)", timeutil.Duration(time.Since(ruleStartedAt)))
 		}
 
 		fmt.Printf("\n[%d/%d] %s%s\n", state.CurrentRule, state.TotalRules, detail, ruleElapsed)
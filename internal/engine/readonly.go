@@ -0,0 +1,38 @@
+package engine
+
+import (
+	"os"
+	"strconv"
+)
+
+// readOnlyEnv names the variable that makes this machine read-only.
+const readOnlyEnv = "BLUEPRINT_READONLY"
+
+// ReadOnlyReason returns why this machine is read-only, or "" when it is not.
+// A machine is read-only when $BLUEPRINT_READONLY is set to anything but a
+// false value, or when ~/.blueprint/config has read-only = true in its
+// [security] section; such machines, like production bastion hosts, only
+// ever report. A config that cannot be read keeps the machine read-only, so
+// a typo never turns the gate off.
+func ReadOnlyReason() string {
+	if v := os.Getenv(readOnlyEnv); v != "" {
+		if on, err := strconv.ParseBool(v); err != nil || on {
+			return readOnlyEnv + " is set"
+		}
+	}
+	path, err := configPath()
+	if err != nil {
+		return ""
+	}
+	if _, err := os.Stat(path); err != nil {
+		return ""
+	}
+	cfg, err := loadConfig()
+	if err != nil {
+		return "~/.blueprint/config cannot be read (" + err.Error() + ")"
+	}
+	if cfg.ReadOnly {
+		return "read-only = true in ~/.blueprint/config"
+	}
+	return ""
+}
@@ -0,0 +1,47 @@
+package engine
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReadOnlyReason(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv(readOnlyEnv, "")
+	if reason := ReadOnlyReason(); reason != "" {
+		t.Errorf("ReadOnlyReason() without env or config = %q", reason)
+	}
+
+	for _, v := range []string{"1", "true", "yes"} {
+		t.Setenv(readOnlyEnv, v)
+		if reason := ReadOnlyReason(); !strings.Contains(reason, readOnlyEnv) {
+			t.Errorf("ReadOnlyReason() with %s=%s = %q", readOnlyEnv, v, reason)
+		}
+	}
+	t.Setenv(readOnlyEnv, "0")
+	if reason := ReadOnlyReason(); reason != "" {
+		t.Errorf("ReadOnlyReason() with %s=0 = %q", readOnlyEnv, reason)
+	}
+
+	// The config makes the machine read-only whatever the environment says
+	config := filepath.Join(home, ".blueprint", "config")
+	if err := os.MkdirAll(filepath.Dir(config), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(config, []byte("[security]\nread-only = true\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if reason := ReadOnlyReason(); !strings.Contains(reason, "read-only = true") {
+		t.Errorf("ReadOnlyReason() with read-only config = %q", reason)
+	}
+
+	if err := os.WriteFile(config, []byte("[security]\nread-only = maybe\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if reason := ReadOnlyReason(); !strings.Contains(reason, "cannot be read") {
+		t.Errorf("ReadOnlyReason() with a broken config = %q", reason)
+	}
+}
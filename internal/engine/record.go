@@ -0,0 +1,166 @@
+package engine
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	gitpkg "github.com/elpic/blueprint/internal/git"
+	handlerskg "github.com/elpic/blueprint/internal/handlers"
+	"github.com/elpic/blueprint/internal/parser"
+	"github.com/elpic/blueprint/internal/ui"
+)
+
+// DefaultRecordOSes are the systems a recording covers when none are named.
+var DefaultRecordOSes = []string{"linux", "mac"}
+
+// recordArch is the architecture arch: filters are matched against in a
+// recording, so golden files do not depend on the machine that made them.
+const recordArch = "amd64"
+
+// RecordedRule is one rule of a recording and the commands it would run.
+type RecordedRule struct {
+	Action   string
+	Summary  string
+	ID       string
+	Commands []string
+}
+
+// recordRules returns the commands rules would run on osName, in the order
+// apply runs them. The commands are those blueprint export writes; rules it
+// cannot export are represented by their plan command.
+func recordRules(rules []parser.Rule, osName string) ([]RecordedRule, error) {
+	sorted, err := resolveDependencies(filterRulesFor(rules, osName, recordArch))
+	if err != nil {
+		return nil, err
+	}
+
+	home, _ := os.UserHomeDir()
+	recorded := make([]RecordedRule, 0, len(sorted))
+	for _, rule := range sorted {
+		r := RecordedRule{Action: rule.Action, Summary: rule.Action, ID: rule.ID}
+		def := handlerskg.GetAction(rule.Action)
+		if def != nil && def.Summary != nil {
+			r.Summary = def.Summary(rule)
+		}
+		if def != nil && def.ShellExport != nil {
+			r.Commands = def.ShellExport(rule, "bash", osName)
+		}
+		if r.Commands == nil {
+			if h := handlerskg.NewHandler(rule, "", nil); h != nil && h.GetCommand() != "" {
+				r.Commands = []string{h.GetCommand()}
+			}
+		}
+		// Paths under the home directory are written with ~ so a golden
+		// file recorded on one machine matches on another
+		if home != "" {
+			homeRe := regexp.MustCompile(regexp.QuoteMeta(home) + `\b`)
+			r.Summary = homeRe.ReplaceAllString(r.Summary, "~")
+			for i, c := range r.Commands {
+				r.Commands[i] = homeRe.ReplaceAllString(c, "~")
+			}
+		}
+		recorded = append(recorded, r)
+	}
+	return recorded, nil
+}
+
+// formatRecording renders the recordings of one blueprint, per OS, as the
+// text kept in golden files.
+func formatRecording(name string, osNames []string, recordings map[string][]RecordedRule) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# blueprint record %s\n", name)
+	for _, osName := range osNames {
+		fmt.Fprintf(&b, "\n## %s\n", osName)
+		for i, r := range recordings[osName] {
+			fmt.Fprintf(&b, "\n[%d] %s: %s", i+1, r.Action, r.Summary)
+			if r.ID != "" {
+				fmt.Fprintf(&b, " (id: %s)", r.ID)
+			}
+			b.WriteString("\n")
+			for _, c := range r.Commands {
+				for _, line := range strings.Split(c, "\n") {
+					fmt.Fprintf(&b, "  %s\n", line)
+				}
+			}
+		}
+	}
+	return b.String()
+}
+
+// RecordBlueprint parses the blueprint at path and returns the commands it
+// would run on each of osNames (DefaultRecordOSes when empty), formatted for
+// a golden file. Nothing is executed and the status file is not read.
+func RecordBlueprint(path string, osNames []string, cliVars map[string]string) (string, error) {
+	if len(osNames) == 0 {
+		osNames = DefaultRecordOSes
+	}
+	rules, err := parser.ParseFile(path)
+	if err != nil {
+		return "", fmt.Errorf("parse error: %w", err)
+	}
+	vars := resolveVarMap(rules, cliVars)
+	for i, r := range rules {
+		rules[i] = interpolateRule(r, vars)
+	}
+
+	recordings := make(map[string][]RecordedRule, len(osNames))
+	for _, osName := range osNames {
+		if !IsValidOSName(osName) {
+			return "", fmt.Errorf("unknown OS %q", osName)
+		}
+		if recordings[osName], err = recordRules(rules, osName); err != nil {
+			return "", err
+		}
+	}
+	return formatRecording(filepath.Base(path), osNames, recordings), nil
+}
+
+// Record implements `blueprint record`: it writes the recording of file to
+// output (stdout when empty) or, with check set, compares it with that
+// golden file and prints a diff. It returns 1 on errors and mismatches.
+func Record(file string, osNames []string, output, check string, cliVars map[string]string, preferSSH bool) int {
+	if preferSSH {
+		file = gitpkg.ExpandShorthandSSH(file)
+	} else {
+		file = gitpkg.ExpandShorthand(file)
+	}
+	setupPath, _, cleanup, err := resolveBlueprintFile(file, true, preferSSH)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", ui.FormatError(fmt.Sprintf("Error: %v", err)))
+		return 1
+	}
+	defer cleanup()
+
+	recording, err := RecordBlueprint(setupPath, osNames, cliVars)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", ui.FormatError(err.Error()))
+		return 1
+	}
+
+	switch {
+	case check != "":
+		golden, err := os.ReadFile(check) // #nosec G304 -- golden file named on the command line
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", ui.FormatError(fmt.Sprintf("Error reading golden file: %v", err)))
+			return 1
+		}
+		if string(golden) != recording {
+			fmt.Print(printDiff(string(golden), recording, check))
+			fmt.Fprintf(os.Stderr, "%s\n", ui.FormatError(fmt.Sprintf("%s does not match; rerun with --output %s to update it", check, check)))
+			return 1
+		}
+		fmt.Fprintf(os.Stderr, "%s\n", ui.FormatSuccess(fmt.Sprintf("%s matches", check)))
+	case output != "":
+		if err := os.WriteFile(output, []byte(recording), 0o600); err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", ui.FormatError(fmt.Sprintf("Error writing file: %v", err)))
+			return 1
+		}
+		fmt.Fprintf(os.Stderr, "%s\n", ui.FormatSuccess(fmt.Sprintf("Recorded to %s", output)))
+	default:
+		fmt.Print(recording)
+	}
+	return 0
+}
@@ -0,0 +1,53 @@
+package engine
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/elpic/blueprint/internal/parser"
+)
+
+func TestRecordRulesFiltersAndOrders(t *testing.T) {
+	rules := []parser.Rule{
+		{Action: "run", ID: "second", RunCommand: "echo second", After: []string{"first"}},
+		{Action: "run", ID: "first", RunCommand: "echo first"},
+		{Action: "run", ID: "mac-only", RunCommand: "echo mac", OSList: []string{"mac"}},
+		{Action: "run", ID: "arm-only", RunCommand: "echo arm", ArchList: []string{"arm64"}},
+	}
+
+	recorded, err := recordRules(rules, "linux")
+	if err != nil {
+		t.Fatalf("recordRules() error: %v", err)
+	}
+	var ids []string
+	for _, r := range recorded {
+		ids = append(ids, r.ID)
+	}
+	if strings.Join(ids, ",") != "first,second" {
+		t.Errorf("recorded %v, want first,second: other OSes and arm64 excluded, dependencies first", ids)
+	}
+}
+
+func TestRecordBlueprintAbbreviatesHome(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	bp := filepath.Join(t.TempDir(), "setup.bp")
+	content := "run ls " + filepath.Join(home, "code") + "\n"
+	if err := os.WriteFile(bp, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := RecordBlueprint(bp, []string{"linux"}, nil)
+	if err != nil {
+		t.Fatalf("RecordBlueprint() error: %v", err)
+	}
+	if !strings.Contains(got, "  ls ~/code\n") || strings.Contains(got, home) {
+		t.Errorf("RecordBlueprint() = %q, want the home directory written as ~", got)
+	}
+
+	if _, err := RecordBlueprint(bp, []string{"plan9"}, nil); err == nil {
+		t.Error("RecordBlueprint() with an unknown OS should fail")
+	}
+}
@@ -0,0 +1,145 @@
+package engine
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	gitpkg "github.com/elpic/blueprint/internal/git"
+	handlerskg "github.com/elpic/blueprint/internal/handlers"
+	"github.com/elpic/blueprint/internal/ui"
+	"github.com/elpic/blueprint/internal/ui/timeutil"
+)
+
+// refreshResult is the outcome of refreshing the status entries of one
+// blueprint against the live system.
+type refreshResult struct {
+	verified     int
+	removed      []handlerskg.StatusEntry
+	changes      []string // "<action> <detail>" for each updated entry
+	unverifiable int
+}
+
+// refreshEntries re-queries this machine for every entry blueprint recorded
+// on osName: entries whose resource is gone are dropped, present ones are
+// stamped with now and get their recorded details (versions, commit SHAs)
+// updated by their action's Refresh. Entries of actions that cannot be
+// verified are kept as they are.
+func refreshEntries(status *handlerskg.Status, blueprint, osName string, now time.Time) refreshResult {
+	var result refreshResult
+	key := handlerskg.NormalizeBlueprint(blueprint)
+	present := map[string][]handlerskg.StatusEntry{}
+	var actions []string
+	removed := map[handlerskg.StatusEntry]bool{}
+	for _, e := range status.AllEntries() {
+		if e.GetOS() != osName || handlerskg.NormalizeBlueprint(e.GetBlueprint()) != key {
+			continue
+		}
+		def := handlerskg.GetAction(e.GetAction())
+		if def == nil || def.Verify == nil {
+			result.unverifiable++
+			continue
+		}
+		if !def.Verify(e) {
+			removed[e] = true
+			result.removed = append(result.removed, e)
+			continue
+		}
+		e.SetVerifiedAt(timeutil.Format(now))
+		result.verified++
+		if len(present[e.GetAction()]) == 0 {
+			actions = append(actions, e.GetAction())
+		}
+		present[e.GetAction()] = append(present[e.GetAction()], e)
+	}
+
+	for _, action := range actions {
+		def := handlerskg.GetAction(action)
+		if def.Refresh == nil {
+			continue
+		}
+		for _, change := range def.Refresh(present[action]) {
+			result.changes = append(result.changes, action+" "+change)
+		}
+	}
+
+	// Packages and other actions without Verify can still have details to
+	// refresh, as long as nothing claims they are gone
+	for _, def := range handlerskg.AllActions() {
+		if def.Verify != nil || def.Refresh == nil {
+			continue
+		}
+		var entries []handlerskg.StatusEntry
+		for _, e := range status.AllEntries() {
+			if e.GetAction() == def.Name && e.GetOS() == osName && handlerskg.NormalizeBlueprint(e.GetBlueprint()) == key {
+				entries = append(entries, e)
+			}
+		}
+		if len(entries) == 0 {
+			continue
+		}
+		for _, change := range def.Refresh(entries) {
+			result.changes = append(result.changes, def.Name+" "+change)
+		}
+	}
+
+	if len(removed) > 0 {
+		status.FilterEntries(func(e handlerskg.StatusEntry) bool { return !removed[e] })
+	}
+	return result
+}
+
+// RefreshOnly updates status.json for file from what is actually on this
+// machine, without applying anything: resources removed by hand are dropped
+// from the status, and recorded versions and commit SHAs are brought up to
+// date. The blueprint itself is not fetched or parsed; only what status
+// already records for it is refreshed.
+func RefreshOnly(file string, preferSSH bool) int {
+	if preferSSH {
+		file = gitpkg.ExpandShorthandSSH(file)
+	} else {
+		file = gitpkg.ExpandShorthand(file)
+	}
+
+	status, err := loadStatus()
+	if os.IsNotExist(err) {
+		fmt.Printf("%s\n", ui.FormatInfo("No status found — nothing to refresh."))
+		return 0
+	}
+	if err != nil {
+		fmt.Printf("%s\n", ui.FormatError(fmt.Sprintf("Error reading status: %v", err)))
+		return 1
+	}
+
+	result := refreshEntries(&status, file, getOSName(), time.Now())
+
+	if err := storeStatus(status); err != nil {
+		fmt.Printf("%s\n", ui.FormatError(fmt.Sprintf("Error writing status: %v", err)))
+		return 1
+	}
+
+	printRefreshResult(file, result)
+	return 0
+}
+
+// printRefreshResult prints what a refresh-only apply changed in status.
+func printRefreshResult(file string, result refreshResult) {
+	fmt.Printf("\n%s\n", ui.FormatHighlight("=== Refresh Only: "+ui.AbbreviateHome(file)+" ==="))
+	fmt.Printf("%s\n", ui.FormatSuccess(fmt.Sprintf("%d resources verified present", result.verified)))
+	for _, change := range result.changes {
+		fmt.Printf("  %s %s\n", ui.FormatInfo("~"), change)
+	}
+	for _, e := range result.removed {
+		fmt.Printf("  %s %s\n", ui.FormatError("-"), e.GetAction()+" "+ui.AbbreviateHome(e.GetResourceKey()))
+	}
+	if len(result.removed) > 0 {
+		fmt.Printf("%s\n", ui.FormatDim(fmt.Sprintf("%d resources no longer exist and were removed from status; the next apply installs them again.", len(result.removed))))
+	}
+	if result.unverifiable > 0 {
+		fmt.Printf("%s\n", ui.FormatDim(fmt.Sprintf("%d entries cannot be verified and were kept", result.unverifiable)))
+	}
+	if len(result.changes) == 0 && len(result.removed) == 0 {
+		fmt.Printf("%s\n", ui.FormatDim("Status already matches this machine."))
+	}
+	fmt.Println()
+}
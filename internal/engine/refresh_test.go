@@ -0,0 +1,46 @@
+package engine
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	handlerskg "github.com/elpic/blueprint/internal/handlers"
+)
+
+func TestRefreshEntries(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	bp := filepath.Join(dir, "setup.bp")
+	other := filepath.Join(dir, "other.bp")
+
+	status := &handlerskg.Status{
+		Mkdirs: []handlerskg.MkdirStatus{
+			{Path: dir, Blueprint: bp, OS: "linux"},
+			{Path: filepath.Join(dir, "gone"), Blueprint: bp, OS: "linux"},
+			{Path: filepath.Join(dir, "gone-too"), Blueprint: other, OS: "linux"},
+			{Path: filepath.Join(dir, "elsewhere"), Blueprint: bp, OS: "mac"},
+		},
+		Runs: []handlerskg.RunStatus{
+			{Action: "run", Command: "echo hi", Blueprint: bp, OS: "linux"},
+		},
+	}
+
+	result := refreshEntries(status, bp, "linux", now)
+
+	if result.verified != 1 || result.unverifiable != 1 {
+		t.Errorf("verified = %d, unverifiable = %d, want 1 and 1", result.verified, result.unverifiable)
+	}
+	if len(result.removed) != 1 || result.removed[0].GetResourceKey() != filepath.Join(dir, "gone") {
+		t.Fatalf("removed = %v, want the directory deleted by hand", result.removed)
+	}
+	if len(status.Mkdirs) != 3 {
+		t.Fatalf("Mkdirs = %+v, want only the missing entry of this blueprint dropped", status.Mkdirs)
+	}
+	if status.Mkdirs[0].VerifiedAt != now.Format(time.RFC3339) {
+		t.Errorf("present dir VerifiedAt = %q, want it stamped with now", status.Mkdirs[0].VerifiedAt)
+	}
+	if len(status.Runs) != 1 {
+		t.Error("entries that cannot be verified must be kept")
+	}
+}
@@ -0,0 +1,76 @@
+package engine
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	handlerskg "github.com/elpic/blueprint/internal/handlers"
+	"github.com/elpic/blueprint/internal/ui"
+	"github.com/elpic/blueprint/internal/ui/timeutil"
+)
+
+// RefreshKeys re-downloads the keys of the gpg_key and repo rules applied on
+// this machine, replaces the ones the vendor re-published or rotated and
+// refreshes the package caches that use them. With dryRun nothing is
+// written. It returns 1 when a key could not be refreshed or is expired, so
+// a scheduled run shows up in the log.
+func RefreshKeys(dryRun bool) int {
+	status, err := loadStatus()
+	if os.IsNotExist(err) {
+		fmt.Printf("%s\n", ui.FormatInfo("No status found. Run 'blueprint apply' to create one."))
+		return 0
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", ui.FormatError(fmt.Sprintf("Error reading status: %v", err)))
+		return 1
+	}
+
+	results := handlerskg.RefreshKeys(&status, getOSName(), dryRun, "", time.Now())
+	if len(results) == 0 {
+		fmt.Printf("%s\n", ui.FormatInfo("No GPG keys to refresh"))
+		return 0
+	}
+
+	fmt.Printf("\n%s\n\n", ui.FormatHighlight(fmt.Sprintf("=== Refresh Keys [%s] ===", timeutil.Now())))
+	rows := make([][]string, 0, len(results))
+	exit := 0
+	for _, r := range results {
+		var result string
+		switch r.Result {
+		case handlerskg.KeyUnchanged:
+			result = ui.FormatSuccess(r.Result)
+		case handlerskg.KeyUpdated, handlerskg.KeyRotated:
+			if dryRun {
+				result = ui.FormatInfo(r.Result + " (dry run)")
+			} else {
+				result = ui.FormatInfo(r.Result)
+			}
+		default:
+			result = ui.FormatError(r.Result)
+			exit = 1
+		}
+		rows = append(rows, []string{r.Name, result, ui.FormatDim(r.Detail)})
+	}
+	for _, line := range ui.AlignColumns(rows) {
+		fmt.Printf("  %s\n", line)
+	}
+	fmt.Println()
+
+	if !dryRun {
+		refreshPackageCaches()
+	}
+	return exit
+}
+
+// ScheduleRefreshKeys installs a crontab entry running refresh-keys every
+// period (daily, weekly or hourly), or removes it when every is empty.
+func ScheduleRefreshKeys(every string) int {
+	msg, err := handlerskg.ScheduleKeyRefresh(every)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", ui.FormatError(err.Error()))
+		return 1
+	}
+	fmt.Println(ui.FormatSuccess(msg))
+	return 0
+}
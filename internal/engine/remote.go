@@ -0,0 +1,388 @@
+package engine
+
+import (
+	"archive/tar"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"slices"
+	"strings"
+
+	"github.com/elpic/blueprint/internal"
+	gitpkg "github.com/elpic/blueprint/internal/git"
+	handlerskg "github.com/elpic/blueprint/internal/handlers"
+	"github.com/elpic/blueprint/internal/parser"
+	"github.com/elpic/blueprint/internal/ui"
+)
+
+// remoteDir is where blueprints are copied on a target, relative to the home
+// directory of the SSH user. Each blueprint directory gets a stable
+// subdirectory, so the remote status keeps tracking it from run to run.
+const remoteDir = ".blueprint/remote"
+
+// remoteBinary is the name a copied blueprint binary gets in the remote
+// directory, for targets where blueprint is not installed.
+const remoteBinary = ".blueprint-bin"
+
+// validTarget matches the user@host targets --target accepts. A target never
+// starts with "-", which ssh would read as an option.
+var validTarget = regexp.MustCompile(`^[A-Za-z0-9_.\[\]:%]([A-Za-z0-9_.\[\]:%@-]*)$`)
+
+// sshCommand returns the ssh command running remoteCmd on target, with a
+// terminal when tty is set. Defined as a var to allow stubbing in tests.
+var sshCommand = func(target, remoteCmd string, tty bool) *exec.Cmd {
+	args := []string{}
+	if tty {
+		args = append(args, "-t")
+	}
+	args = append(args, "--", target, remoteCmd)
+	return exec.Command("ssh", args...) // #nosec G204 -- target is validated, remoteCmd quotes every argument
+}
+
+// remoteBundle is what a remote apply copies to each target: the local files
+// the blueprints need, relative to the directory of the first blueprint,
+// against which the rules resolve relative paths.
+type remoteBundle struct {
+	base       string   // local directory the files are relative to
+	files      []string // files and directories to copy, relative to base
+	blueprints []string // blueprints to apply, relative to base, or git URLs
+	dir        string   // directory on the targets, relative to home
+}
+
+// ParseTargets splits the value of --target into user@host targets.
+func ParseTargets(value string) ([]string, error) {
+	var targets []string
+	for _, target := range strings.Split(value, ",") {
+		target = strings.TrimSpace(target)
+		if target == "" {
+			continue
+		}
+		if !validTarget.MatchString(target) {
+			return nil, fmt.Errorf("invalid target %q: expected user@host", target)
+		}
+		if !slices.Contains(targets, target) {
+			targets = append(targets, target)
+		}
+	}
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("--target requires at least one user@host")
+	}
+	return targets, nil
+}
+
+// newRemoteBundle collects the files applying files on another machine
+// needs: the blueprints, their includes, and the encrypted files, keys and
+// templates their rules read. Paths starting with ~ or / are left out, as
+// they name files on the target itself.
+func newRemoteBundle(files []string, cliVars map[string]string) (*remoteBundle, error) {
+	bundle := &remoteBundle{}
+	seen := map[string]bool{}
+	add := func(path string) error {
+		rel, err := filepath.Rel(bundle.base, path)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return fmt.Errorf("%s is outside %s; remote apply only copies the files in the directory of the first blueprint", path, bundle.base)
+		}
+		if _, err := os.Stat(path); err != nil {
+			return fmt.Errorf("cannot copy %s: %w", path, err)
+		}
+		if !seen[rel] {
+			seen[rel] = true
+			bundle.files = append(bundle.files, rel)
+		}
+		return nil
+	}
+
+	for _, file := range files {
+		if gitpkg.IsGitURL(file) {
+			bundle.blueprints = append(bundle.blueprints, file)
+			continue
+		}
+		path, err := filepath.Abs(file)
+		if err != nil {
+			return nil, err
+		}
+		if info, err := os.Stat(path); err == nil && info.IsDir() {
+			path = filepath.Join(path, "setup.bp")
+		}
+		if bundle.base == "" {
+			bundle.base = filepath.Dir(path)
+		}
+		if err := add(path); err != nil {
+			return nil, err
+		}
+		rel, _ := filepath.Rel(bundle.base, path)
+		bundle.blueprints = append(bundle.blueprints, filepath.ToSlash(rel))
+
+		rules, err := parser.ParseFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("parse error: %w", err)
+		}
+		vars := resolveVarMap(rules, cliVars)
+		for _, rule := range rules {
+			rule = interpolateRule(rule, vars)
+			if rule.SourceFile != "" && !isGitInclude(rule.SourceFile) {
+				if err := add(rule.SourceFile); err != nil {
+					return nil, err
+				}
+			}
+			for _, ref := range ruleFileReferences(rule) {
+				if err := add(filepath.Join(bundle.base, ref)); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+
+	slices.Sort(bundle.files)
+	name := "git"
+	if bundle.base != "" {
+		name = filepath.Base(bundle.base)
+	}
+	sum := sha256.Sum256([]byte(bundle.base + "\n" + strings.Join(bundle.blueprints, "\n")))
+	bundle.dir = remoteDir + "/" + name + "-" + hex.EncodeToString(sum[:4])
+	return bundle, nil
+}
+
+// isGitInclude reports whether file is in the clone of a git include, which
+// the target fetches itself.
+func isGitInclude(file string) bool {
+	home, err := os.UserHomeDir()
+	return err == nil && internal.HasPathPrefix(file, filepath.Join(home, ".blueprint", "repos"))
+}
+
+// ruleFileReferences returns the local files rule reads that are resolved
+// against the blueprint directory: relative paths only.
+func ruleFileReferences(rule parser.Rule) []string {
+	var refs []string
+	for _, path := range []string{rule.DecryptFile, rule.AuthorizedKeysFile, rule.AuthorizedKeysEncrypted, rule.RenderTemplate} {
+		if path == "" || filepath.IsAbs(path) || strings.HasPrefix(path, "~") || strings.HasPrefix(path, "@") || strings.Contains(path, "://") {
+			continue
+		}
+		refs = append(refs, path)
+	}
+	return refs
+}
+
+// writeTar writes the files of the bundle, and binary as remoteBinary when
+// not empty, to w as a tar archive.
+func (b *remoteBundle) writeTar(w io.Writer, binary string) error {
+	tw := tar.NewWriter(w)
+	addFile := func(path, name string) error {
+		info, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		header, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		header.Name = filepath.ToSlash(name)
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		f, err := os.Open(path) // #nosec G304 -- files the blueprint references
+		if err != nil {
+			return err
+		}
+		defer func() { _ = f.Close() }()
+		_, err = io.Copy(tw, f)
+		return err
+	}
+
+	for _, rel := range b.files {
+		root := filepath.Join(b.base, rel)
+		err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() && d.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			name, _ := filepath.Rel(b.base, path)
+			return addFile(path, name)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if binary != "" {
+		if err := addFile(binary, remoteBinary); err != nil {
+			return err
+		}
+	}
+	return tw.Close()
+}
+
+// remotePlatform maps the output of uname -s and uname -m to GOOS and
+// GOARCH.
+func remotePlatform(kernel, machine string) (string, string) {
+	goos := strings.ToLower(kernel)
+	goarch := machine
+	switch machine {
+	case "x86_64", "amd64":
+		goarch = "amd64"
+	case "aarch64", "arm64":
+		goarch = "arm64"
+	}
+	return goos, goarch
+}
+
+// remoteResult is the outcome of the apply on one target.
+type remoteResult struct {
+	target string
+	code   int
+	err    error
+}
+
+// ApplyRemote applies the blueprints on each target over SSH, one target
+// after another: it copies the blueprints and the files they reference to
+// the target, runs blueprint apply there with args, streaming its output
+// and prompts to this terminal, and keeps a copy of the target's status in
+// ~/.blueprint/hosts/<target>/status.json. Targets without blueprint get
+// this binary when they run the same OS and architecture. It returns the
+// highest exit code of the targets.
+func ApplyRemote(files []string, targets []string, args []string, cliVars map[string]string) int {
+	bundle, err := newRemoteBundle(files, cliVars)
+	if err != nil {
+		fmt.Printf("%s\n", ui.FormatError(fmt.Sprintf("Error: %v", err)))
+		return 1
+	}
+
+	var results []remoteResult
+	for _, target := range targets {
+		fmt.Printf("\n%s\n\n", ui.FormatHighlight("═══ "+target+" ═══"))
+		code, err := applyOnTarget(target, bundle, args)
+		if err != nil {
+			fmt.Printf("%s\n", ui.FormatError(fmt.Sprintf("%s: %v", target, err)))
+			code = max(code, 1)
+		}
+		results = append(results, remoteResult{target: target, code: code, err: err})
+	}
+
+	exit := 0
+	fmt.Printf("\n%s\n", ui.FormatHighlight("Targets:"))
+	for _, r := range results {
+		switch {
+		case r.err != nil:
+			fmt.Printf("  %s %s\n", ui.FormatError(r.target), ui.FormatDim(r.err.Error()))
+		case r.code != 0:
+			fmt.Printf("  %s %s\n", ui.FormatError(r.target), ui.FormatDim(fmt.Sprintf("exit status %d", r.code)))
+		default:
+			fmt.Printf("  %s\n", ui.FormatSuccess(r.target))
+		}
+		exit = max(exit, r.code)
+	}
+	return exit
+}
+
+// applyOnTarget copies bundle to target and applies it there. It returns the
+// exit code of the remote apply, or an error when the target could not be
+// prepared.
+func applyOnTarget(target string, bundle *remoteBundle, args []string) (int, error) {
+	probe, err := sshCommand(target, "uname -s; uname -m; command -v blueprint || true", false).Output()
+	if err != nil {
+		return 1, fmt.Errorf("cannot connect: %w", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(probe)), "\n")
+	if len(lines) < 2 {
+		return 1, fmt.Errorf("unexpected answer to uname: %q", string(probe))
+	}
+	blueprintCmd := ""
+	if len(lines) > 2 && strings.TrimSpace(lines[2]) != "" {
+		blueprintCmd = handlerskg.ShellQuote(strings.TrimSpace(lines[2]))
+	}
+
+	binary := ""
+	if blueprintCmd == "" {
+		goos, goarch := remotePlatform(strings.TrimSpace(lines[0]), strings.TrimSpace(lines[1]))
+		if goos != runtime.GOOS || goarch != runtime.GOARCH {
+			return 1, fmt.Errorf("blueprint is not installed there, and this binary is built for %s/%s, not %s/%s", runtime.GOOS, runtime.GOARCH, goos, goarch)
+		}
+		if binary, err = os.Executable(); err != nil {
+			return 1, fmt.Errorf("cannot find this binary to copy: %w", err)
+		}
+		blueprintCmd = "./" + remoteBinary
+	}
+
+	// Copy the files, replacing those of the previous run
+	dir := handlerskg.ShellQuote(bundle.dir)
+	upload := sshCommand(target, "rm -rf "+dir+" && mkdir -p "+dir+" && tar -xmf - -C "+dir, false)
+	stdin, err := upload.StdinPipe()
+	if err != nil {
+		return 1, err
+	}
+	upload.Stderr = os.Stderr
+	if err := upload.Start(); err != nil {
+		return 1, fmt.Errorf("cannot copy the blueprint: %w", err)
+	}
+	writeErr := bundle.writeTar(stdin, binary)
+	_ = stdin.Close()
+	if err := errors.Join(writeErr, upload.Wait()); err != nil {
+		return 1, fmt.Errorf("cannot copy the blueprint: %w", err)
+	}
+
+	words := []string{"cd", dir, "&&", blueprintCmd, "apply"}
+	for _, bp := range bundle.blueprints {
+		words = append(words, handlerskg.ShellQuote(bp))
+	}
+	for _, arg := range args {
+		words = append(words, handlerskg.ShellQuote(arg))
+	}
+	run := sshCommand(target, strings.Join(words, " "), ui.IsTerminal(os.Stdin))
+	run.Stdin = os.Stdin
+	run.Stdout = os.Stdout
+	run.Stderr = os.Stderr
+	code := 0
+	if err := run.Run(); err != nil {
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) || exitErr.ExitCode() == 255 {
+			return 1, fmt.Errorf("ssh failed: %w", err)
+		}
+		code = exitErr.ExitCode()
+	}
+
+	if err := saveTargetStatus(target, "cd "+dir+" && "+blueprintCmd); err != nil {
+		fmt.Printf("%s\n", ui.FormatDim(fmt.Sprintf("Could not record the status of %s: %v", target, err)))
+	}
+	return code, nil
+}
+
+// targetStatusPath returns where the status of target is kept on this
+// machine.
+func targetStatusPath(target string) (string, error) {
+	blueprintDir, err := getBlueprintDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(blueprintDir, "hosts", target, "status.json"), nil
+}
+
+// saveTargetStatus copies the status of target to targetStatusPath, as
+// blueprint there prints it whatever state backend it uses. blueprintCmd runs
+// blueprint on the target; an older one without --output falls back to
+// copying its status.json.
+func saveTargetStatus(target, blueprintCmd string) error {
+	data, err := sshCommand(target, blueprintCmd+" status --output json 2>/dev/null || cat ~/.blueprint/status.json", false).Output()
+	if err != nil {
+		return err
+	}
+	path, err := targetStatusPath(target)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), internal.DirectoryPermission); err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, internal.FilePermission)
+}
@@ -0,0 +1,101 @@
+package engine
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseTargets(t *testing.T) {
+	targets, err := ParseTargets("deploy@web1, deploy@web2,deploy@web1,root@[::1]")
+	if err != nil {
+		t.Fatalf("ParseTargets() error = %v", err)
+	}
+	want := []string{"deploy@web1", "deploy@web2", "root@[::1]"}
+	if !reflect.DeepEqual(targets, want) {
+		t.Errorf("ParseTargets() = %v, want %v", targets, want)
+	}
+
+	for _, value := range []string{"", "-oProxyCommand=sh", "deploy@web1;rm"} {
+		if _, err := ParseTargets(value); err == nil {
+			t.Errorf("ParseTargets(%q) error = nil, want an error", value)
+		}
+	}
+}
+
+func TestApplyRemote(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	dir := t.TempDir()
+	files := map[string]string{
+		"setup.bp": "include common.bp\n" +
+			"decrypt secrets/key.enc to: ~/.key\n" +
+			"decrypt ~/elsewhere.enc to: ~/.other\n",
+		"common.bp":       "mkdir ~/work\n",
+		"secrets/key.enc": "encrypted",
+		"unrelated.txt":   "not referenced",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The target is a directory standing in for the home of the SSH user,
+	// where blueprint is a script recording how it was called
+	remoteHome := t.TempDir()
+	bin := t.TempDir()
+	script := "#!/bin/sh\n" +
+		"if [ \"$1\" = status ]; then echo '{\"packages\":[]}'; exit 0; fi\n" +
+		"echo \"$PWD $*\" > \"$HOME/called\"\n" +
+		"exit 2\n"
+	if err := os.WriteFile(filepath.Join(bin, "blueprint"), []byte(script), 0o755); err != nil { // #nosec G306 -- test script
+		t.Fatal(err)
+	}
+	orig := sshCommand
+	sshCommand = func(target, remoteCmd string, tty bool) *exec.Cmd {
+		cmd := exec.Command("sh", "-c", remoteCmd)
+		cmd.Dir = remoteHome
+		cmd.Env = append(os.Environ(), "HOME="+remoteHome, "PATH="+bin+":"+os.Getenv("PATH"))
+		return cmd
+	}
+	t.Cleanup(func() { sshCommand = orig })
+
+	code := ApplyRemote([]string{filepath.Join(dir, "setup.bp")}, []string{"deploy@web1"}, []string{"--yes"}, nil)
+	if code != 2 {
+		t.Errorf("ApplyRemote() = %d, want the exit code of the remote apply, 2", code)
+	}
+
+	called, err := os.ReadFile(filepath.Join(remoteHome, "called"))
+	if err != nil {
+		t.Fatalf("blueprint was not run on the target: %v", err)
+	}
+	fields := strings.Fields(string(called))
+	if len(fields) != 4 || !strings.Contains(fields[0], "/.blueprint/remote/") || strings.Join(fields[1:], " ") != "apply setup.bp --yes" {
+		t.Fatalf("remote call = %q, want apply setup.bp --yes in the remote directory", called)
+	}
+	remoteDir := fields[0]
+	for _, name := range []string{"setup.bp", "common.bp", "secrets/key.enc"} {
+		if _, err := os.Stat(filepath.Join(remoteDir, name)); err != nil {
+			t.Errorf("%s was not copied: %v", name, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(remoteDir, "unrelated.txt")); err == nil {
+		t.Error("unrelated.txt was copied, want only the files the blueprint references")
+	}
+
+	path, err := targetStatusPath("deploy@web1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, err := os.ReadFile(path); err != nil || !strings.Contains(string(data), "packages") {
+		t.Errorf("status of the target = %q, %v; want a copy of its status", data, err)
+	}
+}
@@ -20,6 +20,7 @@ import (
 // output is used only for single-file mode ("" → stdout, path → file).
 func Render(file, tmplPath, output string, preferSSH bool, cliVars map[string]string) {
 	rules := loadRulesForRender(file, preferSSH)
+	cliVars = mustMachineVars(cliVars)
 	if err := renderer.RenderWithRules(rules, tmplPath, output, preferSSH, cliVars, true); err != nil {
 		fmt.Fprintf(os.Stderr, "error: %v\n", err)
 		os.Exit(1)
@@ -39,6 +40,7 @@ func RenderWithRules(rules []parser.Rule, tmplPath, output string, preferSSH boo
 // Exits 0 when all are identical, 1 when any differ.
 func Check(file, tmplPath, against string, preferSSH bool, cliVars map[string]string) {
 	rules := loadRulesForRender(file, preferSSH)
+	cliVars = mustMachineVars(cliVars)
 
 	originalTmplPath := tmplPath // preserve for the "Run to fix" hint
 	localTmpl, tmplRoot, cleanup, err := renderer.ResolveTemplatePath(tmplPath, preferSSH)
@@ -101,6 +103,7 @@ func Check(file, tmplPath, against string, preferSSH bool, cliVars map[string]st
 // Get extracts a single value from a blueprint and prints it to stdout.
 func Get(file, action, key string, preferSSH bool, cliVars map[string]string) {
 	rules := loadRulesForRender(file, preferSSH)
+	cliVars = mustMachineVars(cliVars)
 	data := renderer.BuildTemplateData(rules, cliVars)
 	val, err := data.Get(action, key)
 	if err != nil {
@@ -158,6 +161,17 @@ func isDir(path string) bool {
 	return err == nil && info.IsDir()
 }
 
+// mustMachineVars layers cliVars over the machine's vars.toml files, exiting
+// when one cannot be read.
+func mustMachineVars(cliVars map[string]string) map[string]string {
+	vars, err := withMachineVars(cliVars)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", ui.FormatError(err.Error()))
+		os.Exit(1)
+	}
+	return vars
+}
+
 // loadRulesForRender resolves and parses a blueprint, exiting on any error.
 func loadRulesForRender(file string, preferSSH bool) []parser.Rule {
 	if preferSSH {
@@ -0,0 +1,371 @@
+package engine
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/elpic/blueprint/internal"
+	handlerskg "github.com/elpic/blueprint/internal/handlers"
+	"github.com/elpic/blueprint/internal/parser"
+	"github.com/elpic/blueprint/internal/ui/timeutil"
+)
+
+// applyReport is what `blueprint apply --report` writes: every rule the run
+// went through with its result, the rules it skipped, plus the cleanup it
+// did and held back.
+type applyReport struct {
+	Blueprint string
+	OS        string
+	Started   time.Time
+	Finished  time.Time
+	Rules     []reportRule
+	Skipped   []skippedRule
+	Held      []heldRemoval
+	Grace     CleanupGrace
+}
+
+// reportRule is one executed rule and its execution record.
+type reportRule struct {
+	rule   parser.Rule
+	record ExecutionRecord
+}
+
+// ReportFormat returns the report format written for path, chosen by its
+// extension, or an error when the extension is not one blueprint can write.
+func ReportFormat(path string) (string, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".md", ".markdown":
+		return "markdown", nil
+	case ".html", ".htm":
+		return "html", nil
+	}
+	return "", fmt.Errorf("unsupported report format %q: use a .md or .html file", filepath.Ext(path))
+}
+
+// executionOrder returns rules in the order executeRules runs and records
+// them: dependency order, grouped into waves.
+func executionOrder(rules []parser.Rule) ([]parser.Rule, error) {
+	sorted, err := resolveDependencies(rules)
+	if err != nil {
+		return nil, err
+	}
+	var ordered []parser.Rule
+	for _, wave := range groupIntoWaves(sorted) {
+		ordered = append(ordered, wave...)
+	}
+	return ordered, nil
+}
+
+// newApplyReport pairs the rules of a run with the records executeRules
+// returned for them.
+func newApplyReport(blueprint, osName string, started time.Time, rules []parser.Rule, records []ExecutionRecord, held []heldRemoval, grace CleanupGrace) (*applyReport, error) {
+	ordered, err := runRules(rules, records)
+	if err != nil {
+		return nil, err
+	}
+	if len(ordered) != len(records) {
+		return nil, fmt.Errorf("%d rules but %d execution records", len(ordered), len(records))
+	}
+	report := &applyReport{
+		Blueprint: blueprint,
+		OS:        osName,
+		Started:   started,
+		Finished:  time.Now(),
+		Held:      held,
+		Grace:     grace,
+	}
+	for i, rule := range ordered {
+		report.Rules = append(report.Rules, reportRule{rule: rule, record: records[i]})
+	}
+	return report, nil
+}
+
+// writeApplyReport renders report in the format matching path's extension
+// and writes it to path.
+func writeApplyReport(path string, report *applyReport) error {
+	format, err := ReportFormat(path)
+	if err != nil {
+		return err
+	}
+	var out []byte
+	if format == "html" {
+		out, err = report.html()
+	} else {
+		out = report.markdown()
+	}
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, out, internal.FilePermission)
+}
+
+// action returns the action a rule runs, resolving the action behind an
+// auto-uninstall rule.
+func (r reportRule) action() string {
+	if r.cleanup() {
+		return handlerskg.DetectRuleType(r.rule)
+	}
+	return r.rule.Action
+}
+
+// cleanup reports whether the rule uninstalled a resource removed from the blueprint.
+func (r reportRule) cleanup() bool {
+	return r.rule.Action == "uninstall"
+}
+
+// result describes the outcome of the rule in a word or two.
+func (r reportRule) result() string {
+	switch {
+	case r.record.Status == "error":
+		return "failed"
+	case r.record.Status == statusNotAttempted:
+		return statusNotAttempted
+	case r.record.Status == statusSkipped:
+		return statusSkipped
+	case r.record.Output == "already installed" || r.record.Output == "not installed":
+		return "unchanged"
+	case r.cleanup():
+		return "removed"
+	}
+	return "applied"
+}
+
+// duration formats how long the rule ran, empty when it did not run.
+func (r reportRule) duration() string {
+	if r.record.DurationMs <= 0 {
+		return ""
+	}
+	return fmt.Sprintf("%.1fs", float64(r.record.DurationMs)/1000)
+}
+
+// details is the output and error of the rule, shown collapsed in the report.
+// The output of a sensitive rule is replaced by a placeholder.
+func (r reportRule) details() string {
+	record := r.record.redacted()
+	var parts []string
+	if record.Error != "" {
+		parts = append(parts, "error: "+record.Error)
+	}
+	if record.Hint != "" {
+		parts = append(parts, "hint: "+record.Hint)
+	}
+	if out := record.Output; out != "" && r.result() != "unchanged" {
+		parts = append(parts, out)
+	}
+	return strings.Join(parts, "\n\n")
+}
+
+// counts returns how many rules ended with each result, in display order.
+func (a *applyReport) counts() []string {
+	n := map[string]int{}
+	for _, r := range a.Rules {
+		n[r.result()]++
+	}
+	var counts []string
+	for _, result := range []string{"applied", "removed", "unchanged", "failed", statusSkipped, statusNotAttempted} {
+		if n[result] > 0 {
+			counts = append(counts, fmt.Sprintf("%d %s", n[result], result))
+		}
+	}
+	if len(counts) == 0 {
+		return []string{"no rules ran"}
+	}
+	return counts
+}
+
+// skippedLine describes a rule the run left out and why.
+func skippedLine(s skippedRule) string {
+	return fmt.Sprintf("%s %s (%s)", s.rule.Action, handlerskg.RuleSummary(s.rule), s.reason)
+}
+
+// heldLine describes a removal held back by the cleanup grace period.
+func (a *applyReport) heldLine(h heldRemoval) string {
+	progress := fmt.Sprintf("missing for %d of %d applies", h.pending.Applies, a.Grace.Applies)
+	if a.Grace.Age > 0 {
+		progress = "missing since " + h.pending.MissingSince
+	}
+	return fmt.Sprintf("%s %s (%s)", h.pending.Action, handlerskg.RuleSummary(h.rule), progress)
+}
+
+// markdown renders the report as Markdown. Outputs are wrapped in <details>
+// so they stay collapsed where the report is attached, such as an issue.
+func (a *applyReport) markdown() []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "# Blueprint apply report\n\n")
+	fmt.Fprintf(&b, "- **Blueprint:** `%s`\n", a.Blueprint)
+	fmt.Fprintf(&b, "- **OS:** %s\n", a.OS)
+	fmt.Fprintf(&b, "- **Started:** %s\n", a.Started.Format("2006-01-02 15:04:05 MST"))
+	fmt.Fprintf(&b, "- **Duration:** %s\n", timeutil.Duration(a.Finished.Sub(a.Started)))
+	fmt.Fprintf(&b, "- **Result:** %s\n", strings.Join(a.counts(), ", "))
+
+	var rules, cleanups []reportRule
+	for _, r := range a.Rules {
+		if r.cleanup() {
+			cleanups = append(cleanups, r)
+		} else {
+			rules = append(rules, r)
+		}
+	}
+
+	writeTable := func(title string, rows []reportRule) {
+		if len(rows) == 0 {
+			return
+		}
+		fmt.Fprintf(&b, "\n## %s\n\n", title)
+		fmt.Fprintf(&b, "| # | Action | Rule | Result | Duration |\n")
+		fmt.Fprintf(&b, "|---|--------|------|--------|----------|\n")
+		for i, r := range rows {
+			fmt.Fprintf(&b, "| %d | %s | %s | %s | %s |\n",
+				i+1, r.action(), markdownCell(handlerskg.RuleSummary(r.rule)), r.result(), r.duration())
+		}
+	}
+	writeTable("Rules", rules)
+	writeTable("Cleanup", cleanups)
+
+	if len(a.Skipped) > 0 {
+		fmt.Fprintf(&b, "\n## Skipped\n\n")
+		for _, s := range a.Skipped {
+			fmt.Fprintf(&b, "- %s\n", skippedLine(s))
+		}
+	}
+
+	if len(a.Held) > 0 {
+		fmt.Fprintf(&b, "\n## Kept by the cleanup grace period (%s)\n\n", a.Grace)
+		for _, h := range a.Held {
+			fmt.Fprintf(&b, "- %s\n", a.heldLine(h))
+		}
+	}
+
+	var outputs []reportRule
+	for _, r := range a.Rules {
+		if r.details() != "" {
+			outputs = append(outputs, r)
+		}
+	}
+	if len(outputs) > 0 {
+		fmt.Fprintf(&b, "\n## Output\n")
+		for _, r := range outputs {
+			fmt.Fprintf(&b, "\n<details>\n<summary>%s %s — %s</summary>\n\n",
+				r.action(), template.HTMLEscapeString(handlerskg.RuleSummary(r.rule)), r.result())
+			fence := "```"
+			for strings.Contains(r.details(), fence) {
+				fence += "`"
+			}
+			fmt.Fprintf(&b, "%s\n%s\n%s\n\n</details>\n", fence, r.details(), fence)
+		}
+	}
+	return b.Bytes()
+}
+
+// markdownCell escapes text for a Markdown table cell.
+func markdownCell(s string) string {
+	s = strings.ReplaceAll(s, "|", `\|`)
+	return strings.ReplaceAll(s, "\n", " ")
+}
+
+// reportHTML is the page `blueprint apply --report out.html` writes. It has
+// no external assets so the file can be attached or mailed as is.
+var reportHTML = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Blueprint apply report</title>
+<style>
+body { font-family: -apple-system, BlinkMacSystemFont, "Segoe UI", sans-serif; margin: 2em auto; max-width: 60em; color: #24292f; }
+table { border-collapse: collapse; width: 100%; margin-bottom: 1em; }
+th, td { border: 1px solid #d0d7de; padding: 4px 8px; text-align: left; vertical-align: top; }
+th { background: #f6f8fa; }
+pre { background: #f6f8fa; padding: 8px; overflow-x: auto; white-space: pre-wrap; margin: 4px 0; }
+.failed { color: #cf222e; font-weight: bold; }
+.removed { color: #9a6700; }
+.unchanged, .skipped, .not-attempted { color: #57606a; }
+</style>
+</head>
+<body>
+<h1>Blueprint apply report</h1>
+<ul>
+<li><strong>Blueprint:</strong> <code>{{.Blueprint}}</code></li>
+<li><strong>OS:</strong> {{.OS}}</li>
+<li><strong>Started:</strong> {{.Started}}</li>
+<li><strong>Duration:</strong> {{.Duration}}</li>
+<li><strong>Result:</strong> {{.Result}}</li>
+</ul>
+{{range .Sections}}{{if .Rows}}
+<h2>{{.Title}}</h2>
+<table>
+<tr><th>#</th><th>Action</th><th>Rule</th><th>Result</th><th>Duration</th></tr>
+{{range $i, $r := .Rows}}<tr>
+<td>{{$r.Number}}</td><td>{{$r.Action}}</td>
+<td>{{$r.Summary}}{{if $r.Details}}<details><summary>output</summary><pre>{{$r.Details}}</pre></details>{{end}}</td>
+<td class="{{$r.Class}}">{{$r.Result}}</td><td>{{$r.Duration}}</td>
+</tr>
+{{end}}</table>
+{{end}}{{end}}
+{{if .Skipped}}<h2>Skipped</h2>
+<ul>
+{{range .Skipped}}<li>{{.}}</li>
+{{end}}</ul>
+{{end}}{{if .Held}}<h2>Kept by the cleanup grace period ({{.Grace}})</h2>
+<ul>
+{{range .Held}}<li>{{.}}</li>
+{{end}}</ul>
+{{end}}</body>
+</html>
+`))
+
+// html renders the report as a standalone HTML page with outputs collapsed
+// in <details> elements.
+func (a *applyReport) html() ([]byte, error) {
+	type row struct {
+		Number                                   int
+		Action, Summary, Result, Class, Duration string
+		Details                                  string
+	}
+	type section struct {
+		Title string
+		Rows  []row
+	}
+	sections := []section{{Title: "Rules"}, {Title: "Cleanup"}}
+	for _, r := range a.Rules {
+		s := &sections[0]
+		if r.cleanup() {
+			s = &sections[1]
+		}
+		s.Rows = append(s.Rows, row{
+			Number:   len(s.Rows) + 1,
+			Action:   r.action(),
+			Summary:  handlerskg.RuleSummary(r.rule),
+			Result:   r.result(),
+			Class:    strings.ReplaceAll(r.result(), " ", "-"),
+			Duration: r.duration(),
+			Details:  r.details(),
+		})
+	}
+	var skipped []string
+	for _, s := range a.Skipped {
+		skipped = append(skipped, skippedLine(s))
+	}
+	var held []string
+	for _, h := range a.Held {
+		held = append(held, a.heldLine(h))
+	}
+
+	var b bytes.Buffer
+	err := reportHTML.Execute(&b, map[string]any{
+		"Blueprint": a.Blueprint,
+		"OS":        a.OS,
+		"Started":   a.Started.Format("2006-01-02 15:04:05 MST"),
+		"Duration":  timeutil.Duration(a.Finished.Sub(a.Started)),
+		"Result":    strings.Join(a.counts(), ", "),
+		"Sections":  sections,
+		"Skipped":   skipped,
+		"Held":      held,
+		"Grace":     a.Grace.String(),
+	})
+	return b.Bytes(), err
+}
@@ -0,0 +1,94 @@
+package engine
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/elpic/blueprint/internal/parser"
+)
+
+func testApplyReport(t *testing.T) *applyReport {
+	t.Helper()
+	rules := []parser.Rule{
+		{Action: "mkdir", Mkdir: "~/code"},
+		{Action: "run", RunCommand: "make | tee log"},
+		{Action: "uninstall", Mkdir: "~/old"},
+	}
+	records := []ExecutionRecord{
+		{Status: "success", Output: "already installed"},
+		{Status: "error", DurationMs: 1500, Output: "build output", Error: "exit status 2"},
+		{Status: "success", DurationMs: 20, Output: "removed ~/old"},
+	}
+	started := time.Date(2026, 10, 1, 9, 0, 0, 0, time.UTC)
+	report, err := newApplyReport("setup.bp", "linux", started, rules, records, nil, CleanupGrace{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	report.Skipped = []skippedRule{{rule: parser.Rule{Action: "mkdir", Mkdir: "~/Library/Fonts"}, reason: "on: [mac] does not include linux"}}
+	return report
+}
+
+func TestReportFormat(t *testing.T) {
+	for path, want := range map[string]string{"out.md": "markdown", "OUT.Markdown": "markdown", "r.html": "html", "r.htm": "html"} {
+		if got, err := ReportFormat(path); err != nil || got != want {
+			t.Errorf("ReportFormat(%q) = %q, %v; want %q", path, got, err, want)
+		}
+	}
+	if _, err := ReportFormat("report.txt"); err == nil {
+		t.Error("ReportFormat(report.txt) should fail")
+	}
+}
+
+func TestApplyReportMarkdown(t *testing.T) {
+	md := string(testApplyReport(t).markdown())
+
+	for _, want := range []string{
+		"- **Blueprint:** `setup.bp`",
+		"- **Result:** 1 removed, 1 unchanged, 1 failed",
+		"| 1 | mkdir | ~/code | unchanged |  |",
+		`| 2 | run | make \| tee log | failed | 1.5s |`,
+		"## Cleanup",
+		"| 1 | mkdir | ~/old | removed | 0.0s |",
+		"<summary>run make | tee log — failed</summary>",
+		"error: exit status 2\n\nbuild output",
+		"## Skipped\n\n- mkdir ~/Library/Fonts (on: [mac] does not include linux)",
+	} {
+		if !strings.Contains(md, want) {
+			t.Errorf("markdown report is missing %q:\n%s", want, md)
+		}
+	}
+	if strings.Contains(md, "already installed") {
+		t.Errorf("unchanged rules should not have their output listed:\n%s", md)
+	}
+}
+
+func TestWriteApplyReportHTML(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "report.html")
+	report := testApplyReport(t)
+	report.Rules[1].record.Output = "<script>alert(1)</script>"
+	if err := writeApplyReport(path, report); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	page := string(data)
+	for _, want := range []string{
+		"<title>Blueprint apply report</title>",
+		`<td class="failed">failed</td>`,
+		"<details><summary>output</summary>",
+		"&lt;script&gt;",
+		"<h2>Cleanup</h2>",
+	} {
+		if !strings.Contains(page, want) {
+			t.Errorf("html report is missing %q", want)
+		}
+	}
+	if strings.Contains(page, "<script>") {
+		t.Error("rule output was not escaped")
+	}
+}
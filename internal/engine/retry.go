@@ -0,0 +1,64 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/elpic/blueprint/internal/logging"
+	"github.com/elpic/blueprint/internal/parser"
+)
+
+// errRuleTimedOut is wrapped by the error of an attempt that ran past the
+// rule's timeout:.
+var errRuleTimedOut = errors.New("timed out")
+
+// retryBackoff is the wait before the first retry; it doubles for each retry
+// after that, up to maxRetryBackoff. Tests shorten it.
+var retryBackoff = 2 * time.Second
+
+const maxRetryBackoff = time.Minute
+
+// runWithPolicy runs fn, the Up or Down of rule's handler, under the rule's
+// timeout: and retries:. A failed attempt is retried after an exponential
+// backoff. An attempt that times out is abandoned, not retried: its command
+// may still be running, and a second one would race it.
+func runWithPolicy(rule parser.Rule, fn func() (string, error)) (string, error) {
+	output, err := runWithTimeout(rule.Timeout, fn)
+	delay := retryBackoff
+	for attempt := 1; attempt <= rule.Retries && err != nil && !errors.Is(err, errRuleTimedOut); attempt++ {
+		logging.Debugf("%s failed (%v), retry %d/%d in %s", rule.Action, err, attempt, rule.Retries, delay)
+		time.Sleep(delay)
+		delay = min(delay*2, maxRetryBackoff)
+		output, err = runWithTimeout(rule.Timeout, fn)
+	}
+	return output, err
+}
+
+// runWithTimeout runs fn, giving up on it once timeout has passed. A zero
+// timeout waits for fn however long it takes.
+func runWithTimeout(timeout time.Duration, fn func() (string, error)) (string, error) {
+	if timeout <= 0 {
+		return fn()
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	type result struct {
+		output string
+		err    error
+	}
+	done := make(chan result, 1)
+	go func() {
+		output, err := fn()
+		done <- result{output, err}
+	}()
+
+	select {
+	case r := <-done:
+		return r.output, r.err
+	case <-ctx.Done():
+		return "", fmt.Errorf("%w after %s", errRuleTimedOut, timeout)
+	}
+}
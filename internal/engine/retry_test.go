@@ -0,0 +1,60 @@
+package engine
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/elpic/blueprint/internal/parser"
+)
+
+func TestRunWithPolicyRetriesFailures(t *testing.T) {
+	orig := retryBackoff
+	retryBackoff = time.Millisecond
+	defer func() { retryBackoff = orig }()
+
+	attempts := 0
+	output, err := runWithPolicy(parser.Rule{Action: "clone", Retries: 3}, func() (string, error) {
+		attempts++
+		if attempts < 3 {
+			return "", errors.New("connection reset")
+		}
+		return "cloned", nil
+	})
+	if err != nil || output != "cloned" {
+		t.Fatalf("runWithPolicy() = %q, %v, want success on the third attempt", output, err)
+	}
+	if attempts != 3 {
+		t.Errorf("attempts = %d, want 3", attempts)
+	}
+
+	attempts = 0
+	if _, err := runWithPolicy(parser.Rule{Action: "clone", Retries: 1}, func() (string, error) {
+		attempts++
+		return "", errors.New("connection reset")
+	}); err == nil || attempts != 2 {
+		t.Errorf("runWithPolicy() = %v after %d attempts, want an error after 2", err, attempts)
+	}
+}
+
+func TestRunWithPolicyTimeout(t *testing.T) {
+	orig := retryBackoff
+	retryBackoff = time.Millisecond
+	defer func() { retryBackoff = orig }()
+
+	release := make(chan struct{})
+	defer close(release)
+	var attempts atomic.Int32
+	_, err := runWithPolicy(parser.Rule{Action: "clone", Timeout: 20 * time.Millisecond, Retries: 2}, func() (string, error) {
+		attempts.Add(1)
+		<-release
+		return "", nil
+	})
+	if !errors.Is(err, errRuleTimedOut) {
+		t.Fatalf("runWithPolicy() error = %v, want a timeout", err)
+	}
+	if n := attempts.Load(); n != 1 {
+		t.Errorf("attempts = %d, want 1: a timed-out attempt is not retried", n)
+	}
+}
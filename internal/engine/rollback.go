@@ -0,0 +1,284 @@
+package engine
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	handlerskg "github.com/elpic/blueprint/internal/handlers"
+	"github.com/elpic/blueprint/internal/parser"
+	"github.com/elpic/blueprint/internal/prompt"
+	"github.com/elpic/blueprint/internal/ui"
+)
+
+// RollbackRCFiles restores the shell rc files blueprint appended to, or only
+// those in paths, from the backups taken before their first change. With
+// dryRun it only reports what would be done. It returns 1 when a file could
+// not be restored.
+func RollbackRCFiles(paths []string, dryRun bool) int {
+	status, err := loadStatus()
+	if os.IsNotExist(err) {
+		fmt.Printf("%s\n", ui.FormatInfo("No status found. Run 'blueprint apply' to create one."))
+		return 0
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", ui.FormatError(fmt.Sprintf("Error reading status: %v", err)))
+		return 1
+	}
+
+	results := handlerskg.RollbackRCFiles(&status, paths, dryRun)
+	if len(results) == 0 {
+		fmt.Printf("%s\n", ui.FormatInfo("No shell rc files to restore"))
+		return 0
+	}
+
+	rows := make([][]string, 0, len(results))
+	exit := 0
+	for _, r := range results {
+		switch {
+		case r.Err != nil:
+			rows = append(rows, []string{ui.AbbreviateHome(r.Path), ui.FormatError(r.Err.Error())})
+			exit = 1
+		case dryRun:
+			rows = append(rows, []string{ui.AbbreviateHome(r.Path), ui.FormatInfo(r.Detail + " (dry run)")})
+		default:
+			rows = append(rows, []string{ui.AbbreviateHome(r.Path), ui.FormatSuccess(r.Detail)})
+		}
+	}
+	for _, line := range ui.AlignColumns(rows) {
+		fmt.Printf("  %s\n", line)
+	}
+	if dryRun {
+		return exit
+	}
+
+	if err := storeStatus(status); err != nil {
+		fmt.Printf("%s\n", ui.FormatError(fmt.Sprintf("Error writing status: %v", err)))
+		return 1
+	}
+	return exit
+}
+
+// rollbackPrompt is the confirmation asked before rolling a run back; a
+// variable so tests can answer it.
+var rollbackPrompt = prompt.Confirm
+
+// rollbackStep is a rule of the run being rolled back, in the order it is
+// undone.
+type rollbackStep struct {
+	record ExecutionRecord
+	src    *blueprintSource // nil when the rule is no longer in its blueprint
+	rule   parser.Rule      // the uninstall rule undoing it
+	skip   string           // why the rule is not undone, if it is not
+}
+
+// RollbackRun undoes what run runNumber changed: the rules it applied
+// successfully have their uninstall run, most recent first, as the
+// blueprints now declare them. A run number of 0 means the latest run. Rules
+// that cannot be undone, such as a run without undo:, and rules no longer in
+// their blueprint are skipped with a warning. With dryRun it only lists what
+// would be undone. It returns 1 when a rule could not be undone.
+func RollbackRun(runNumber int, dryRun, preferSSH bool) int {
+	if runNumber == 0 {
+		latest, err := getLatestRunNumber()
+		if err != nil {
+			fmt.Printf("%s\n", ui.FormatError("No history found"))
+			return 1
+		}
+		runNumber = latest
+	}
+	records, err := loadRunRecords(runNumber)
+	if err != nil {
+		fmt.Printf("%s\n", ui.FormatError(fmt.Sprintf("No history found for run %d", runNumber)))
+		return 1
+	}
+
+	osName := getOSName()
+	var changed []ExecutionRecord
+	var blueprints []string
+	seen := map[string]bool{}
+	for _, r := range records {
+		if r.Status != "success" || !r.Changed || r.Command == "" {
+			continue
+		}
+		if r.OS != osName {
+			fmt.Printf("%s\n", ui.FormatError(fmt.Sprintf("Run %d ran on %s; roll it back there", runNumber, r.OS)))
+			return 1
+		}
+		changed = append(changed, r)
+		if !seen[r.Blueprint] {
+			seen[r.Blueprint] = true
+			blueprints = append(blueprints, r.Blueprint)
+		}
+	}
+	if len(changed) == 0 {
+		fmt.Printf("%s\n", ui.FormatInfo(fmt.Sprintf("Run %d changed nothing: nothing to roll back", runNumber)))
+		return 0
+	}
+
+	sources, cleanup, err := loadBlueprints(blueprints, dryRun, preferSSH, nil)
+	defer cleanup()
+	if err != nil {
+		fmt.Printf("%s\n", ui.FormatError(fmt.Sprintf("Error: %v", err)))
+		return 1
+	}
+	steps := rollbackSteps(changed, sources)
+
+	fmt.Printf("\n%s\n", ui.FormatHighlight(fmt.Sprintf("=== Rollback of run %d ===", runNumber)))
+	printRollbackSteps(steps)
+
+	var undo []rollbackStep
+	for _, s := range steps {
+		if s.skip == "" {
+			undo = append(undo, s)
+		}
+	}
+	if len(undo) == 0 {
+		fmt.Printf("\n%s\n", ui.FormatInfo("Nothing can be rolled back."))
+		return 0
+	}
+	if dryRun {
+		return 0
+	}
+	ok, err := rollbackPrompt(fmt.Sprintf("Undo %d rules of run %d?", len(undo), runNumber), false)
+	if err != nil || !ok {
+		fmt.Printf("%s\n", ui.FormatInfo("Nothing undone."))
+		return 0
+	}
+
+	var rules []parser.Rule
+	for _, s := range undo {
+		rules = append(rules, s.rule)
+	}
+	if err := promptForSudoPasswordWithOS(rules, osName); err != nil {
+		fmt.Printf("%s\n", ui.FormatError(fmt.Sprintf("Error prompting for sudo password: %v", err)))
+		return 1
+	}
+	defer clearSudoCache()
+
+	newRun, err := getNextRunNumber()
+	if err != nil {
+		newRun = 0
+	}
+	exit := 0
+	var history []ExecutionRecord
+	for _, batch := range rollbackBatches(undo) {
+		src := batch[0].src
+		var batchRules []parser.Rule
+		for _, s := range batch {
+			batchRules = append(batchRules, s.rule)
+		}
+		fmt.Printf("\n%s\n", ui.FormatHighlight(fmt.Sprintf("Rolling back %s", src.file)))
+		records := executeRules(batchRules, src.file, osName, filepath.Dir(src.path), newRun)
+		for _, r := range records {
+			if r.Status == "error" {
+				exit = 1
+			}
+		}
+		if err := saveStatus(batchRules, records, src.file, "", osName); err != nil {
+			fmt.Printf("Warning: Failed to save status: %v\n", err)
+		}
+		history = append(history, records...)
+	}
+	if err := saveHistory(newRun, history); err != nil {
+		fmt.Printf("Warning: Failed to save history: %v\n", err)
+	}
+	return exit
+}
+
+// rollbackSteps pairs the changed records of a run with the rules of
+// sources that produced them, most recent first, and turns each into the
+// uninstall rule undoing it. A rule can only be matched while its blueprint
+// still declares it with the same command.
+func rollbackSteps(changed []ExecutionRecord, sources []blueprintSource) []rollbackStep {
+	type ruleAt struct {
+		src  *blueprintSource
+		rule parser.Rule
+	}
+	byCommand := map[string]ruleAt{}
+	for i := range sources {
+		src := &sources[i]
+		for _, rule := range filterRulesByOS(src.rules) {
+			handler := handlerskg.NewHandler(rule, filepath.Dir(src.path), nil)
+			if handler == nil {
+				continue
+			}
+			key := src.file + "\x00" + handler.GetCommand()
+			if _, taken := byCommand[key]; !taken {
+				byCommand[key] = ruleAt{src: src, rule: rule}
+			}
+		}
+	}
+
+	steps := make([]rollbackStep, 0, len(changed))
+	for i := len(changed) - 1; i >= 0; i-- {
+		record := changed[i]
+		step := rollbackStep{record: record}
+		found, ok := byCommand[record.Blueprint+"\x00"+record.Command]
+		switch {
+		case !ok:
+			step.skip = "no longer in " + ui.AbbreviateHome(record.Blueprint)
+		case found.rule.Action == "uninstall":
+			step.skip = "the run removed it; apply the blueprint to bring it back"
+		default:
+			step.src = found.src
+			step.rule = found.rule
+			step.rule.Action = "uninstall"
+			if handlerskg.NewHandler(step.rule, "", nil) == nil {
+				step.skip = "its action cannot be uninstalled"
+			} else if r, ok := handlerskg.NewHandler(found.rule, filepath.Dir(found.src.path), nil).(handlerskg.Reverser); ok {
+				step.skip = r.Irreversible()
+			}
+		}
+		steps = append(steps, step)
+	}
+	chainRollbackSteps(steps)
+	return steps
+}
+
+// chainRollbackSteps makes each rule to undo depend on the one undone before
+// it, in place of the dependencies it was applied with, so the undos run one
+// at a time in reverse order.
+func chainRollbackSteps(steps []rollbackStep) {
+	var prev *parser.Rule
+	for i := range steps {
+		if steps[i].skip != "" {
+			continue
+		}
+		steps[i].rule.After = nil
+		if prev != nil && prev.ID != "" {
+			steps[i].rule.After = []string{prev.ID}
+		} else if prev != nil {
+			steps[i].rule.After = []string{handlerskg.RuleKey(*prev)}
+		}
+		prev = &steps[i].rule
+	}
+}
+
+// rollbackBatches splits steps into runs of consecutive steps of the same
+// blueprint, which are undone together.
+func rollbackBatches(steps []rollbackStep) [][]rollbackStep {
+	var batches [][]rollbackStep
+	for i, s := range steps {
+		if i == 0 || s.src != steps[i-1].src {
+			batches = append(batches, nil)
+		}
+		batches[len(batches)-1] = append(batches[len(batches)-1], s)
+	}
+	return batches
+}
+
+// printRollbackSteps lists what a rollback undoes and what it skips, and why.
+func printRollbackSteps(steps []rollbackStep) {
+	rows := make([][]string, 0, len(steps))
+	for _, s := range steps {
+		if s.skip != "" {
+			rows = append(rows, []string{ui.FormatDim("skip"), s.record.Command, ui.FormatError("warning: " + s.skip)})
+			continue
+		}
+		rows = append(rows, []string{ui.FormatInfo("undo"), s.record.Command})
+	}
+	for _, line := range ui.AlignColumns(rows) {
+		fmt.Printf("  %s\n", line)
+	}
+}
@@ -0,0 +1,110 @@
+package engine
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	handlerskg "github.com/elpic/blueprint/internal/handlers"
+	"github.com/elpic/blueprint/internal/parser"
+)
+
+// commandOf returns the command history records for rule.
+func commandOf(t *testing.T, rule parser.Rule) string {
+	t.Helper()
+	handler := handlerskg.NewHandler(rule, "", nil)
+	if handler == nil {
+		t.Fatalf("no handler for %+v", rule)
+	}
+	return handler.GetCommand()
+}
+
+func TestRollbackStepsReverseTheRun(t *testing.T) {
+	src := blueprintSource{file: "/tmp/setup.bp", path: "/tmp/setup.bp", rules: []parser.Rule{
+		{Action: "mkdir", Mkdir: "~/a", After: []string{"b"}},
+		{Action: "run", RunCommand: "make setup"},
+		{Action: "run", RunCommand: "make link", RunUndo: "make unlink", ID: "link"},
+		{Action: "mkdir", Mkdir: "~/b", ID: "b"},
+	}}
+	var changed []ExecutionRecord
+	for _, rule := range src.rules {
+		changed = append(changed, ExecutionRecord{Blueprint: src.file, Command: commandOf(t, rule), Status: "success", Changed: true})
+	}
+	changed = append(changed, ExecutionRecord{Blueprint: src.file, Command: "mkdir -p ~/gone", Status: "success", Changed: true})
+
+	steps := rollbackSteps(changed, []blueprintSource{src})
+	if len(steps) != 5 {
+		t.Fatalf("rollbackSteps() = %d steps, want 5", len(steps))
+	}
+	wantSkip := []string{"no longer in", "", "", "no undo command", ""}
+	for i, want := range wantSkip {
+		if !strings.HasPrefix(steps[i].skip, want) || (want == "") != (steps[i].skip == "") {
+			t.Errorf("step %d (%s) skip = %q, want %q", i, steps[i].record.Command, steps[i].skip, want)
+		}
+	}
+	if steps[1].rule.Mkdir != "~/b" || steps[1].rule.Action != "uninstall" {
+		t.Errorf("first rule undone = %+v, want the uninstall of ~/b", steps[1].rule)
+	}
+	// Each undo waits for the one before it, not for what it was applied after
+	if len(steps[1].rule.After) != 0 || strings.Join(steps[2].rule.After, ",") != "b" || strings.Join(steps[4].rule.After, ",") != "link" {
+		t.Errorf("undos are not chained in order: %v, %v, %v", steps[1].rule.After, steps[2].rule.After, steps[4].rule.After)
+	}
+}
+
+func TestRollbackRunUndoesTheLatestRun(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	file := filepath.Join(home, "setup.bp")
+	writeTestFile(t, file, "mkdir ~/projects\nmkdir ~/notes\n")
+
+	rules, err := parser.ParseFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	osName := getOSName()
+	var records []ExecutionRecord
+	for _, rule := range rules {
+		if err := os.MkdirAll(expandHomedir(rule.Mkdir), 0750); err != nil {
+			t.Fatal(err)
+		}
+		records = append(records, ExecutionRecord{Blueprint: file, OS: osName, Command: commandOf(t, rule), Status: "success", Changed: true})
+	}
+	run, err := getNextRunNumber()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := saveHistory(run, records); err != nil {
+		t.Fatal(err)
+	}
+	if err := saveStatus(rules, records, file, "", osName); err != nil {
+		t.Fatal(err)
+	}
+
+	orig := rollbackPrompt
+	defer func() { rollbackPrompt = orig }()
+	rollbackPrompt = func(string, bool) (bool, error) { return true, nil }
+
+	if code := RollbackRun(0, true, false); code != 0 {
+		t.Fatalf("RollbackRun(dry run) = %d, want 0", code)
+	}
+	if !fileExists(filepath.Join(home, "projects")) {
+		t.Fatal("a dry run removed ~/projects")
+	}
+
+	if code := RollbackRun(0, false, false); code != 0 {
+		t.Fatalf("RollbackRun() = %d, want 0", code)
+	}
+	for _, dir := range []string{"projects", "notes"} {
+		if fileExists(filepath.Join(home, dir)) {
+			t.Errorf("~/%s is still there after the rollback", dir)
+		}
+	}
+	if got := loadCurrentStatus(); len(got.Mkdirs) != 0 {
+		t.Errorf("status still records %+v", got.Mkdirs)
+	}
+	undone, err := loadRunRecords(run + 1)
+	if err != nil || len(undone) != 2 || !strings.Contains(undone[0].Command, "notes") {
+		t.Errorf("rollback run records = %+v, %v; want ~/notes removed first", undone, err)
+	}
+}
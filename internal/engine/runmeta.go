@@ -0,0 +1,198 @@
+package engine
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/elpic/blueprint/internal"
+	"github.com/elpic/blueprint/internal/ui"
+	"github.com/elpic/blueprint/internal/ui/timeutil"
+)
+
+// runMetadataName is the file in history/<run>/ describing the run as a
+// whole, whatever the state backend: which blueprints at which revision, who
+// ran them where and how, and how it ended. The records of its rules, with
+// their durations and exit statuses, are in the state store.
+const runMetadataName = "run.json"
+
+// runBlueprint is a blueprint applied by a run.
+type runBlueprint struct {
+	Path string `json:"path"`          // as given on the command line: a file or git URL
+	SHA  string `json:"sha,omitempty"` // commit of a git blueprint
+}
+
+// runMetadata describes a run, as history shows it above the rule outputs.
+type runMetadata struct {
+	Run        int            `json:"run"`
+	StartedAt  string         `json:"started_at"`
+	DurationMs int64          `json:"duration_ms"`
+	Blueprints []runBlueprint `json:"blueprints"`
+	OS         string         `json:"os"`
+	User       string         `json:"user,omitempty"`
+	Host       string         `json:"host,omitempty"`
+	Workspace  string         `json:"workspace,omitempty"`
+	Flags      []string       `json:"flags,omitempty"` // the skip and only flags the run was narrowed with
+	Rules      int            `json:"rules"`
+	Failed     int            `json:"failed,omitempty"`
+	Skipped    int            `json:"skipped,omitempty"`
+	ExitCode   int            `json:"exit_code"`
+}
+
+// runFlags returns the command-line flags that changed which rules a run
+// applied or what it recorded, as they were given.
+func runFlags(opts RunOptions) []string {
+	var flags []string
+	if opts.SkipGroup != "" {
+		flags = append(flags, "--skip-group "+opts.SkipGroup)
+	}
+	if opts.SkipID != "" {
+		flags = append(flags, "--skip-id "+opts.SkipID)
+	}
+	switch {
+	case opts.OnlyID != "" && opts.OnlyDeps:
+		flags = append(flags, "--only-id "+opts.OnlyID)
+	case opts.OnlyID != "":
+		flags = append(flags, "--only "+opts.OnlyID)
+	}
+	if opts.OnlyGroup != "" {
+		flags = append(flags, "--only-group "+opts.OnlyGroup)
+	}
+	if opts.SkipDecrypt {
+		flags = append(flags, "--skip-decrypt")
+	}
+	if opts.NoStatus {
+		flags = append(flags, "--no-status")
+	}
+	return flags
+}
+
+// newRunMetadata describes run runNumber of sources, started at startedAt
+// and ended now with exitCode.
+func newRunMetadata(runNumber int, sources []blueprintSource, osName string, startedAt time.Time, records []ExecutionRecord, skipped int, flags []string, exitCode int) runMetadata {
+	meta := runMetadata{
+		Run:        runNumber,
+		StartedAt:  timeutil.Format(startedAt),
+		DurationMs: time.Since(startedAt).Milliseconds(),
+		OS:         osName,
+		Flags:      flags,
+		Rules:      len(records),
+		Skipped:    skipped,
+		ExitCode:   exitCode,
+	}
+	for _, src := range sources {
+		meta.Blueprints = append(meta.Blueprints, runBlueprint{Path: src.file, SHA: src.sha})
+	}
+	for _, r := range records {
+		if r.Status == "error" {
+			meta.Failed++
+		}
+	}
+	if u, err := user.Current(); err == nil {
+		meta.User = u.Username
+	}
+	if host, err := os.Hostname(); err == nil {
+		meta.Host = host
+	}
+	if name, err := currentWorkspace(); err == nil && name != defaultWorkspace {
+		meta.Workspace = name
+	}
+	return meta
+}
+
+// saveRunMetadata writes meta to history/<run>/run.json.
+func saveRunMetadata(meta runMetadata) error {
+	historyDir, err := getHistoryDir()
+	if err != nil {
+		return err
+	}
+	runDir := filepath.Join(historyDir, strconv.Itoa(meta.Run))
+	if err := os.MkdirAll(runDir, internal.DirectoryPermission); err != nil {
+		return fmt.Errorf("failed to create history directory: %w", err)
+	}
+	data, err := json.MarshalIndent(meta, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal run metadata: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(runDir, runMetadataName), data, internal.FilePermission); err != nil {
+		return fmt.Errorf("failed to write run metadata: %w", err)
+	}
+	return nil
+}
+
+// loadRunMetadata reads the metadata of the run kept in runDir. Runs saved
+// before it was recorded have none, and the error satisfies os.IsNotExist.
+func loadRunMetadata(runDir string) (*runMetadata, error) {
+	data, err := readBlueprintFile(filepath.Join(runDir, runMetadataName))
+	if err != nil {
+		return nil, err
+	}
+	var meta runMetadata
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", runMetadataName, err)
+	}
+	return &meta, nil
+}
+
+// printRunMetadata prints meta under the header of history.
+func printRunMetadata(meta *runMetadata) {
+	rows := [][]string{}
+	for i, bp := range meta.Blueprints {
+		label := ""
+		if i == 0 {
+			label = "Blueprint:"
+		}
+		value := ui.AbbreviateHome(bp.Path)
+		if sha := bp.SHA; sha != "" {
+			if len(sha) > 8 {
+				sha = sha[:8]
+			}
+			value += " @ " + sha
+		}
+		rows = append(rows, []string{label, value})
+	}
+
+	ran := timeutil.Display(meta.StartedAt) + " for " + timeutil.Milliseconds(meta.DurationMs)
+	var who []string
+	if meta.User != "" {
+		who = append(who, "by "+meta.User)
+	}
+	if meta.Host != "" {
+		who = append(who, "on "+meta.Host)
+	}
+	if len(who) > 0 {
+		ran += ", " + strings.Join(who, " ")
+	}
+	ran += " (" + meta.OS + ")"
+	rows = append(rows, []string{"Ran:", ran})
+
+	if meta.Workspace != "" {
+		rows = append(rows, []string{"Workspace:", meta.Workspace})
+	}
+	if len(meta.Flags) > 0 {
+		rows = append(rows, []string{"Flags:", strings.Join(meta.Flags, " ")})
+	}
+
+	result := fmt.Sprintf("exit %d, %d rules", meta.ExitCode, meta.Rules)
+	if meta.Failed > 0 {
+		result += fmt.Sprintf(", %d failed", meta.Failed)
+	}
+	if meta.Skipped > 0 {
+		result += fmt.Sprintf(", %d skipped", meta.Skipped)
+	}
+	rows = append(rows, []string{"Result:", result})
+
+	lines := ui.AlignColumns(rows)
+	for i, line := range lines {
+		if i == len(lines)-1 && meta.ExitCode != 0 {
+			fmt.Printf("%s\n", ui.FormatError(line))
+			continue
+		}
+		fmt.Printf("%s\n", ui.FormatDim(line))
+	}
+}
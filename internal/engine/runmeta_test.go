@@ -0,0 +1,59 @@
+package engine
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestRunFlags(t *testing.T) {
+	got := runFlags(RunOptions{SkipGroup: "dev", OnlyID: "neovim", OnlyDeps: true, SkipDecrypt: true})
+	want := []string{"--skip-group dev", "--only-id neovim", "--skip-decrypt"}
+	if !slices.Equal(got, want) {
+		t.Errorf("runFlags() = %v, want %v", got, want)
+	}
+	if got := runFlags(RunOptions{OnlyID: "neovim", NoStatus: true}); !slices.Equal(got, []string{"--only neovim", "--no-status"}) {
+		t.Errorf("runFlags(--only) = %v", got)
+	}
+	if got := runFlags(RunOptions{}); got != nil {
+		t.Errorf("runFlags() without flags = %v, want none", got)
+	}
+}
+
+func TestRunMetadataRoundTrip(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	sources := []blueprintSource{
+		{file: "/tmp/setup.bp"},
+		{file: "https://github.com/me/dotfiles.git", sha: "0123456789abcdef"},
+	}
+	records := []ExecutionRecord{
+		{Command: "install git", Status: "success"},
+		{Command: "install vim", Status: "error", ExitCode: 100},
+	}
+	meta := newRunMetadata(3, sources, "linux", time.Now().Add(-2*time.Second), records, 1, []string{"--skip-group dev"}, 1)
+	if meta.Rules != 2 || meta.Failed != 1 || meta.Skipped != 1 || meta.DurationMs < 2000 {
+		t.Errorf("newRunMetadata() = %+v", meta)
+	}
+	if err := saveRunMetadata(meta); err != nil {
+		t.Fatalf("saveRunMetadata() error = %v", err)
+	}
+
+	historyDir, err := getHistoryDir()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := loadRunMetadata(filepath.Join(historyDir, "3"))
+	if err != nil {
+		t.Fatalf("loadRunMetadata() error = %v", err)
+	}
+	if len(got.Blueprints) != 2 || got.Blueprints[1].SHA != "0123456789abcdef" || got.ExitCode != 1 || got.Flags[0] != "--skip-group dev" {
+		t.Errorf("loadRunMetadata() = %+v, want what was saved", got)
+	}
+
+	if _, err := loadRunMetadata(filepath.Join(historyDir, "1")); !os.IsNotExist(err) {
+		t.Errorf("loadRunMetadata() of a run without metadata error = %v, want a not-exist error", err)
+	}
+}
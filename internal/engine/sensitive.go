@@ -0,0 +1,31 @@
+package engine
+
+// sensitivePlaceholder stands in for the output and error of a rule marked
+// sensitive: true wherever they would be stored or shown.
+const sensitivePlaceholder = "[sensitive output hidden]"
+
+// showSensitive is set by --show-sensitive. It only affects the terminal:
+// history and reports never get the output of a sensitive rule.
+var showSensitive bool
+
+// SetShowSensitive controls whether the terminal shows the output of rules
+// marked sensitive: true.
+func SetShowSensitive(show bool) {
+	showSensitive = show
+}
+
+// redacted returns the record with its output and error replaced by
+// sensitivePlaceholder when it belongs to a sensitive rule. The record kept in
+// memory stays intact, since handlers read it to update the status.
+func (r ExecutionRecord) redacted() ExecutionRecord {
+	if !r.Sensitive {
+		return r
+	}
+	if r.Output != "" {
+		r.Output = sensitivePlaceholder
+	}
+	if r.Error != "" {
+		r.Error = sensitivePlaceholder
+	}
+	return r
+}
@@ -0,0 +1,62 @@
+package engine
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	handlerskg "github.com/elpic/blueprint/internal/handlers"
+	"github.com/elpic/blueprint/internal/parser"
+)
+
+func TestExecutionRecordRedacted(t *testing.T) {
+	record := ExecutionRecord{Command: "deploy", Status: "error", Output: "token=abc", Error: "exit status 1: token=abc"}
+
+	if got := record.redacted(); !reflect.DeepEqual(got, record) {
+		t.Errorf("redacted() changed a record that is not sensitive: %+v", got)
+	}
+
+	record.Sensitive = true
+	got := record.redacted()
+	if got.Output != sensitivePlaceholder || got.Error != sensitivePlaceholder {
+		t.Errorf("redacted() = %+v, want the placeholder for output and error", got)
+	}
+	if got.Command != "deploy" || got.Status != "error" {
+		t.Errorf("redacted() = %+v, want command and status kept", got)
+	}
+	if record.Output != "token=abc" {
+		t.Error("redacted() must not change the original record")
+	}
+}
+
+func TestExecuteOneRuleHidesSensitiveOutput(t *testing.T) {
+	rule := parser.Rule{Action: "run", RunCommand: "printf 'token-%s' 123 >&2; exit 3", Sensitive: true}
+
+	for _, show := range []bool{false, true} {
+		SetShowSensitive(show)
+		res := executeOneRule(rule, 0, "[1/1]", "/tmp/test.bp", "linux", t.TempDir(), &handlerskg.Status{}, nil, nil)
+		if res.record.Status != "error" || !res.record.Sensitive {
+			t.Fatalf("record = %+v, want a failed sensitive record", res.record)
+		}
+		if leaked := strings.Contains(res.output, "token-123"); leaked != show {
+			t.Errorf("show-sensitive %v: terminal output = %q", show, res.output)
+		}
+		if !show && !strings.Contains(res.output, sensitivePlaceholder) {
+			t.Errorf("terminal output = %q, want the placeholder", res.output)
+		}
+	}
+	SetShowSensitive(false)
+}
+
+func TestApplyReportRedactsSensitiveRules(t *testing.T) {
+	rules := []parser.Rule{{Action: "run", RunCommand: "print-token", Sensitive: true}}
+	records := []ExecutionRecord{{Status: "success", Output: "token-123", Sensitive: true}}
+	report, err := newApplyReport("setup.bp", "linux", time.Now(), rules, records, nil, CleanupGrace{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if md := string(report.markdown()); strings.Contains(md, "token-123") || !strings.Contains(md, sensitivePlaceholder) {
+		t.Errorf("report should only hold the placeholder:\n%s", md)
+	}
+}
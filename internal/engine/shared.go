@@ -0,0 +1,82 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// SharedBlueprintDir is where an administrator installs blueprints for every
+// user of the machine. Each user applies them into their own ~/.blueprint
+// state, so status, history and cleanup stay per user.
+var SharedBlueprintDir = "/etc/blueprint"
+
+// ResolveSharedBlueprint returns the path of the shared blueprint name:
+// <dir>/<name>.bp, or <dir>/<name>/setup.bp for a blueprint split across
+// files. Shared blueprints run with the rights of whoever applies them, so
+// one that other users could change is refused.
+func ResolveSharedBlueprint(name string) (string, error) {
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+		return "", fmt.Errorf("invalid shared blueprint name %q", name)
+	}
+	candidates := []string{
+		filepath.Join(SharedBlueprintDir, name+".bp"),
+		filepath.Join(SharedBlueprintDir, name, "setup.bp"),
+	}
+	for _, path := range candidates {
+		info, err := os.Stat(path)
+		if err != nil || info.IsDir() {
+			continue
+		}
+		for _, p := range []string{path, filepath.Dir(path)} {
+			if err := checkNotShared(p); err != nil {
+				return "", err
+			}
+		}
+		return path, nil
+	}
+
+	msg := fmt.Sprintf("shared blueprint %q not found in %s", name, SharedBlueprintDir)
+	if names := SharedBlueprints(); len(names) > 0 {
+		msg += " (available: " + strings.Join(names, ", ") + ")"
+	}
+	return "", errors.New(msg)
+}
+
+// checkNotShared refuses a shared blueprint file or directory that users
+// other than its owner can write to.
+func checkNotShared(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if info.Mode().Perm()&0o022 != 0 {
+		return fmt.Errorf("%s is writable by other users; run: sudo chmod go-w %s", path, path)
+	}
+	return nil
+}
+
+// SharedBlueprints returns the names of the blueprints in SharedBlueprintDir,
+// sorted.
+func SharedBlueprints() []string {
+	entries, err := os.ReadDir(SharedBlueprintDir)
+	if err != nil {
+		return nil
+	}
+	var names []string
+	for _, e := range entries {
+		switch {
+		case !e.IsDir() && strings.HasSuffix(e.Name(), ".bp"):
+			names = append(names, strings.TrimSuffix(e.Name(), ".bp"))
+		case e.IsDir():
+			if _, err := os.Stat(filepath.Join(SharedBlueprintDir, e.Name(), "setup.bp")); err == nil {
+				names = append(names, e.Name())
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,61 @@
+package engine
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func useSharedDir(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.Chmod(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	old := SharedBlueprintDir
+	SharedBlueprintDir = dir
+	t.Cleanup(func() { SharedBlueprintDir = old })
+	return dir
+}
+
+func TestResolveSharedBlueprint(t *testing.T) {
+	dir := useSharedDir(t)
+	writeTestFile(t, filepath.Join(dir, "base.bp"), "install git\n")
+	writeTestFile(t, filepath.Join(dir, "work", "setup.bp"), "include tools.bp\n")
+	if err := os.Chmod(filepath.Join(dir, "work"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, err := ResolveSharedBlueprint("base"); err != nil || got != filepath.Join(dir, "base.bp") {
+		t.Errorf("ResolveSharedBlueprint(base) = %q, %v", got, err)
+	}
+	if got, err := ResolveSharedBlueprint("work"); err != nil || got != filepath.Join(dir, "work", "setup.bp") {
+		t.Errorf("ResolveSharedBlueprint(work) = %q, %v", got, err)
+	}
+	if names := SharedBlueprints(); strings.Join(names, ",") != "base,work" {
+		t.Errorf("SharedBlueprints() = %v", names)
+	}
+
+	_, err := ResolveSharedBlueprint("missing")
+	if err == nil || !strings.Contains(err.Error(), "available: base, work") {
+		t.Errorf("ResolveSharedBlueprint(missing) error = %v, want the available names", err)
+	}
+	for _, name := range []string{"", "..", "../etc/passwd", "work/setup"} {
+		if _, err := ResolveSharedBlueprint(name); err == nil {
+			t.Errorf("ResolveSharedBlueprint(%q) should fail", name)
+		}
+	}
+}
+
+func TestResolveSharedBlueprintRefusesWritable(t *testing.T) {
+	dir := useSharedDir(t)
+	path := filepath.Join(dir, "base.bp")
+	writeTestFile(t, path, "install git\n")
+	if err := os.Chmod(path, 0o666); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ResolveSharedBlueprint("base"); err == nil || !strings.Contains(err.Error(), "writable by other users") {
+		t.Errorf("ResolveSharedBlueprint() error = %v, want it refused", err)
+	}
+}
@@ -0,0 +1,135 @@
+package engine
+
+import (
+	"fmt"
+	"strings"
+
+	handlerskg "github.com/elpic/blueprint/internal/handlers"
+	"github.com/elpic/blueprint/internal/parser"
+	"github.com/elpic/blueprint/internal/ui"
+	"github.com/elpic/blueprint/internal/ui/timeutil"
+)
+
+// skippedRule is a rule of the blueprint that a run leaves out before
+// executing anything, and why.
+type skippedRule struct {
+	rule   parser.Rule
+	reason string
+}
+
+// osSkipReason returns why the on: or arch: filter of rule keeps it off a
+// machine running currentOS on currentArch, or "" when the rule applies.
+func osSkipReason(rule parser.Rule, currentOS, currentArch string) string {
+	if !matchesArch(rule, currentArch) {
+		return fmt.Sprintf("arch: [%s] does not include %s", strings.Join(rule.ArchList, ", "), currentArch)
+	}
+	if len(rule.OSList) == 0 {
+		return ""
+	}
+	for _, os := range rule.OSList {
+		if strings.TrimSpace(os) == currentOS {
+			return ""
+		}
+	}
+	return fmt.Sprintf("on: [%s] does not include %s", strings.Join(rule.OSList, ", "), currentOS)
+}
+
+// osSkippedRules returns the rules filterRulesFor drops, with the filter
+// that drops each.
+func osSkippedRules(rules []parser.Rule, currentOS, currentArch string) []skippedRule {
+	var skipped []skippedRule
+	for _, rule := range rules {
+		if reason := osSkipReason(rule, currentOS, currentArch); reason != "" {
+			skipped = append(skipped, skippedRule{rule: rule, reason: reason})
+		}
+	}
+	return skipped
+}
+
+// onlySkipReasons returns, for each of rules, why --only, --only-id or
+// --only-group leaves it out of the run, "" for the rules they select, or nil
+// when none of them is given. With withDeps the rules the selected ones run
+// after are selected too, transitively, so a single rule or group runs as it
+// would in a full apply.
+func onlySkipReasons(rules []parser.Rule, onlyID, onlyGroup string, withDeps bool) []string {
+	if onlyID == "" && onlyGroup == "" {
+		return nil
+	}
+	var flags []string
+	if onlyID != "" {
+		flag := "--only "
+		if withDeps {
+			flag = "--only-id "
+		}
+		flags = append(flags, flag+onlyID)
+	}
+	if onlyGroup != "" {
+		flags = append(flags, "--only-group "+onlyGroup)
+	}
+	reason := strings.Join(flags, " ")
+
+	reasons := make([]string, len(rules))
+	for i := range reasons {
+		reasons[i] = reason
+	}
+	graph := newDependencyGraph(rules)
+	for i, rule := range rules {
+		if !(onlyID != "" && ruleMatchesRef(rule, onlyID)) && !(onlyGroup != "" && rule.Group == onlyGroup) {
+			continue
+		}
+		reasons[i] = ""
+		if withDeps {
+			for _, dep := range graph.transitiveDependencies(i) {
+				reasons[dep] = ""
+			}
+		}
+	}
+	return reasons
+}
+
+// flagSkipReason returns which of the --skip-group, --skip-id and
+// --skip-decrypt flags leaves rule out of the run, or "" when none does.
+func flagSkipReason(rule parser.Rule, skipGroup, skipID string, skipDecrypt bool) string {
+	switch {
+	case skipGroup != "" && rule.Group == skipGroup:
+		return "--skip-group " + skipGroup
+	case skipID != "" && ruleMatchesRef(rule, skipID):
+		return "--skip-id " + skipID
+	case skipDecrypt && rule.Action == "decrypt":
+		return "--skip-decrypt"
+	}
+	return ""
+}
+
+// skippedRecords returns the history records of the skipped rules, so
+// the run's history shows what a run left out as well as what it ran.
+func skippedRecords(skipped []skippedRule, blueprint, osName string) []ExecutionRecord {
+	records := make([]ExecutionRecord, 0, len(skipped))
+	for _, s := range skipped {
+		records = append(records, ExecutionRecord{
+			Timestamp: timeutil.Now(),
+			Blueprint: blueprint,
+			OS:        osName,
+			Command:   s.rule.Action + " " + handlerskg.RuleSummary(s.rule),
+			Status:    statusSkipped,
+			Error:     "skipped: " + s.reason,
+			Group:     s.rule.Group,
+		})
+	}
+	return records
+}
+
+// displaySkippedRules lists the rules a run leaves out and why.
+func displaySkippedRules(skipped []skippedRule) {
+	if len(skipped) == 0 {
+		return
+	}
+	fmt.Println(ui.FormatDim(fmt.Sprintf("─── Skipped (%d) ───", len(skipped))) + "\n")
+	for _, s := range skipped {
+		fmt.Printf("  %s %s %s\n",
+			ui.FormatDim("○"),
+			ui.FormatInfo(fmt.Sprintf("%s %s", s.rule.Action, handlerskg.RuleSummary(s.rule))),
+			ui.FormatDim("("+s.reason+")"))
+	}
+	fmt.Println()
+}
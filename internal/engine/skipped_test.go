@@ -0,0 +1,119 @@
+package engine
+
+import (
+	"slices"
+	"testing"
+
+	handlerskg "github.com/elpic/blueprint/internal/handlers"
+	"github.com/elpic/blueprint/internal/parser"
+)
+
+func TestOSSkippedRules(t *testing.T) {
+	rules := []parser.Rule{
+		{Action: "install", ID: "any"},
+		{Action: "install", ID: "linux", OSList: []string{"linux"}},
+		{Action: "install", ID: "mac", OSList: []string{"mac"}},
+		{Action: "install", ID: "arm", ArchList: []string{"arm64"}},
+	}
+
+	got := osSkippedRules(rules, "linux", "amd64")
+	want := map[string]string{
+		"mac": "on: [mac] does not include linux",
+		"arm": "arch: [arm64] does not include amd64",
+	}
+	if len(got) != len(want) {
+		t.Fatalf("osSkippedRules() = %+v, want %d rules", got, len(want))
+	}
+	for _, s := range got {
+		if s.reason != want[s.rule.ID] {
+			t.Errorf("reason for %s = %q, want %q", s.rule.ID, s.reason, want[s.rule.ID])
+		}
+	}
+	if kept := filterRulesFor(rules, "linux", "amd64"); len(kept)+len(got) != len(rules) {
+		t.Errorf("filterRulesFor() kept %d rules and %d were skipped, want %d in all", len(kept), len(got), len(rules))
+	}
+}
+
+func TestFlagSkipReason(t *testing.T) {
+	rule := parser.Rule{Action: "decrypt", ID: "secrets", Group: "work"}
+	tests := []struct {
+		name              string
+		skipGroup, skipID string
+		skipDecrypt       bool
+		want              string
+	}{
+		{"no flags", "", "", false, ""},
+		{"skip group", "work", "", false, "--skip-group work"},
+		{"skip other group", "home", "", false, ""},
+		{"skip id", "", "secrets", false, "--skip-id secrets"},
+		{"skip decrypt", "", "", true, "--skip-decrypt"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := flagSkipReason(rule, tt.skipGroup, tt.skipID, tt.skipDecrypt); got != tt.want {
+				t.Errorf("flagSkipReason() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOnlySkipReasons(t *testing.T) {
+	rules := []parser.Rule{
+		{Action: "install", Packages: []parser.Package{{Name: "git"}}},
+		{Action: "clone", ID: "dotfiles", After: []string{"git"}, Group: "dotfiles"},
+		{Action: "run", ID: "link", After: []string{"dotfiles"}, Group: "dotfiles"},
+		{Action: "mkdir", Mkdir: "~/work", Group: "work"},
+		{Action: "run", ID: "bootstrap", After: []string{"link"}},
+	}
+	selected := func(reasons []string) []int {
+		var kept []int
+		for i, r := range reasons {
+			if r == "" {
+				kept = append(kept, i)
+			}
+		}
+		return kept
+	}
+	tests := []struct {
+		name              string
+		onlyID, onlyGroup string
+		withDeps          bool
+		want              []int
+		reason            string
+	}{
+		{"only", "bootstrap", "", false, []int{4}, "--only bootstrap"},
+		{"only-id with dependencies", "bootstrap", "", true, []int{0, 1, 2, 4}, "--only-id bootstrap"},
+		{"only-group with dependencies", "", "dotfiles", true, []int{0, 1, 2}, "--only-group dotfiles"},
+		{"only-id by address", "mkdir.~/work", "", true, []int{3}, "--only-id mkdir.~/work"},
+		{"no match", "missing", "", true, nil, "--only-id missing"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handlerskg.SetRuleAddresses(rules)
+			reasons := onlySkipReasons(rules, tt.onlyID, tt.onlyGroup, tt.withDeps)
+			if got := selected(reasons); !slices.Equal(got, tt.want) {
+				t.Errorf("selected rules = %v, want %v", got, tt.want)
+			}
+			for _, r := range reasons {
+				if r != "" && r != tt.reason {
+					t.Errorf("reason = %q, want %q", r, tt.reason)
+				}
+			}
+		})
+	}
+	if reasons := onlySkipReasons(rules, "", "", false); reasons != nil {
+		t.Errorf("onlySkipReasons() without only flags = %v, want nil", reasons)
+	}
+}
+
+func TestSkippedRecords(t *testing.T) {
+	skipped := []skippedRule{{rule: parser.Rule{Action: "mkdir", Mkdir: "~/work", Group: "work"}, reason: "--skip-group work"}}
+	records := skippedRecords(skipped, "setup.bp", "linux")
+	if len(records) != 1 {
+		t.Fatalf("skippedRecords() returned %d records, want 1", len(records))
+	}
+	r := records[0]
+	if r.Status != statusSkipped || r.Error != "skipped: --skip-group work" || r.Command != "mkdir ~/work" || r.Group != "work" {
+		t.Errorf("skippedRecords() = %+v", r)
+	}
+}
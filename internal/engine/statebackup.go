@@ -0,0 +1,352 @@
+package engine
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/elpic/blueprint/internal"
+	"github.com/elpic/blueprint/internal/prompt"
+	"github.com/elpic/blueprint/internal/ui"
+)
+
+// stateFiles are the entries of ~/.blueprint a state backup holds: the status,
+// the run history with its per-run output manifests, state.db when the
+// SQLite backend keeps it, the cached plans, and the selected workspace and
+// the state of the other workspaces.
+// Everything else is left out on purpose. Cloned repos are fetched again by
+// the next apply, logs and temporary files (such as staged sudoers files)
+// are not state, and blueprint never stores passwords or decrypted files
+// there, so the archive holds no secrets.
+var stateFiles = []string{"status.json", "history.json", "run_number", "plans.json", "history", stateDBName, workspaceFile, workspacesDir}
+
+// maxStateFileSize bounds each file read from a backup, so a corrupt or
+// crafted archive cannot fill the disk on restore.
+const maxStateFileSize = 256 << 20
+
+// stateBackupPrefix starts the name of every state backup archive.
+const stateBackupPrefix = "blueprint-state-"
+
+// isStateFile reports whether name, a slash-separated path relative to
+// ~/.blueprint, is or is inside one of stateFiles.
+func isStateFile(name string) bool {
+	top, _, _ := strings.Cut(name, "/")
+	for _, f := range stateFiles {
+		if top == f {
+			return true
+		}
+	}
+	return false
+}
+
+// writeStateBackup archives the state files of blueprintDir into a new
+// gzip-compressed tarball in destDir and returns its path. The archive is
+// written under a temporary name and renamed once complete, so a backup
+// interrupted half way never looks like a good one.
+func writeStateBackup(blueprintDir, destDir string, now time.Time) (string, error) {
+	if err := os.MkdirAll(destDir, internal.DirectoryPermission); err != nil {
+		return "", fmt.Errorf("failed to create backup directory: %w", err)
+	}
+	base := filepath.Join(destDir, stateBackupPrefix+now.Format("20060102-150405"))
+	path := base + ".tar.gz"
+	// Never replace an archive, such as one being restored in the same second
+	for n := 1; ; n++ {
+		if _, err := os.Lstat(path); os.IsNotExist(err) {
+			break
+		}
+		path = fmt.Sprintf("%s-%d.tar.gz", base, n)
+	}
+
+	tmp, err := os.CreateTemp(destDir, ".blueprint-state-*.tmp")
+	if err != nil {
+		return "", fmt.Errorf("failed to create backup: %w", err)
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+
+	gz := gzip.NewWriter(tmp)
+	tw := tar.NewWriter(gz)
+	for _, name := range stateFiles {
+		if err := addStateEntry(tw, blueprintDir, name); err != nil {
+			_ = tmp.Close()
+			return "", err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		_ = tmp.Close()
+		return "", fmt.Errorf("failed to write backup: %w", err)
+	}
+	if err := gz.Close(); err != nil {
+		_ = tmp.Close()
+		return "", fmt.Errorf("failed to write backup: %w", err)
+	}
+	if err := tmp.Chmod(internal.FilePermission); err != nil {
+		_ = tmp.Close()
+		return "", fmt.Errorf("failed to write backup: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return "", fmt.Errorf("failed to write backup: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return "", fmt.Errorf("failed to write backup: %w", err)
+	}
+	return path, nil
+}
+
+// sqliteSidecars are the files SQLite keeps next to state.db while it is
+// open. A snapshot of state.db already holds what they do, and restoring
+// them next to another database would corrupt it, so backups leave them out.
+var sqliteSidecars = []string{stateDBName + "-wal", stateDBName + "-shm", stateDBName + "-journal"}
+
+// addStateEntry adds blueprintDir/name to the archive, recursing into
+// directories. Missing entries are skipped (a new install has no history
+// yet) and so is anything that is not a regular file or directory. Each
+// state.db is archived as a snapshot, as another run may be writing to it.
+func addStateEntry(tw *tar.Writer, blueprintDir, name string) error {
+	return filepath.WalkDir(filepath.Join(blueprintDir, name), func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				return nil
+			}
+			return fmt.Errorf("failed to read %s: %w", path, err)
+		}
+		if !d.IsDir() && (!d.Type().IsRegular() || slices.Contains(sqliteSidecars, d.Name())) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", path, err)
+		}
+		src := path
+		// Builds without cgo cannot open state.db and copy it as it is
+		if d.Name() == stateDBName && !d.IsDir() && sqliteSupported {
+			if src, err = snapshotStateDB(blueprintDir, path); err != nil {
+				return err
+			}
+			defer func() { _ = os.Remove(src) }()
+			if info, err = os.Stat(src); err != nil {
+				return fmt.Errorf("failed to read %s: %w", src, err)
+			}
+		}
+		rel, err := filepath.Rel(blueprintDir, path)
+		if err != nil {
+			return err
+		}
+		header, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return fmt.Errorf("failed to archive %s: %w", path, err)
+		}
+		header.Name = filepath.ToSlash(rel)
+		if d.IsDir() {
+			header.Name += "/"
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			return fmt.Errorf("failed to write backup: %w", err)
+		}
+		if d.IsDir() {
+			return nil
+		}
+		f, err := os.Open(src) // #nosec G304 -- src is inside ~/.blueprint
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", path, err)
+		}
+		defer func() { _ = f.Close() }()
+		if _, err := io.Copy(tw, f); err != nil {
+			return fmt.Errorf("failed to archive %s: %w", path, err)
+		}
+		return nil
+	})
+}
+
+// snapshotStateDB writes a consistent copy of the SQLite database at path to
+// a new temporary file in blueprintDir and returns its name.
+func snapshotStateDB(blueprintDir, path string) (string, error) {
+	tmp, err := os.CreateTemp(blueprintDir, ".state-snapshot-*.db")
+	if err != nil {
+		return "", fmt.Errorf("failed to snapshot %s: %w", path, err)
+	}
+	_ = tmp.Close()
+	if err := snapshotSQLiteDB(path, tmp.Name()); err != nil {
+		_ = os.Remove(tmp.Name())
+		return "", err
+	}
+	return tmp.Name(), nil
+}
+
+// extractStateBackup unpacks archive into stageDir, rejecting entries that
+// are not state files, escape the directory or are neither files nor
+// directories. It returns the top-level state files the archive holds.
+func extractStateBackup(archive, stageDir string) ([]string, error) {
+	f, err := os.Open(archive) // #nosec G304 -- archive is a user-supplied backup path
+	if err != nil {
+		return nil, fmt.Errorf("failed to open backup: %w", err)
+	}
+	defer func() { _ = f.Close() }()
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, fmt.Errorf("not a blueprint state backup: %w", err)
+	}
+	defer func() { _ = gz.Close() }()
+
+	found := map[string]bool{}
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("not a blueprint state backup: %w", err)
+		}
+
+		name := strings.TrimSuffix(header.Name, "/")
+		if name == "" || strings.HasPrefix(name, "/") || name != filepath.ToSlash(filepath.Clean(name)) || strings.HasPrefix(name, "..") {
+			return nil, fmt.Errorf("backup has an invalid entry %q", header.Name)
+		}
+		if !isStateFile(name) {
+			return nil, fmt.Errorf("backup has an unexpected entry %q", header.Name)
+		}
+		target := filepath.Join(stageDir, filepath.FromSlash(name))
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, internal.DirectoryPermission); err != nil {
+				return nil, fmt.Errorf("failed to restore %s: %w", name, err)
+			}
+		case tar.TypeReg:
+			if header.Size > maxStateFileSize {
+				return nil, fmt.Errorf("backup entry %q is too large", header.Name)
+			}
+			if err := os.MkdirAll(filepath.Dir(target), internal.DirectoryPermission); err != nil {
+				return nil, fmt.Errorf("failed to restore %s: %w", name, err)
+			}
+			out, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, internal.FilePermission) // #nosec G304 -- target is checked to be inside stageDir
+			if err != nil {
+				return nil, fmt.Errorf("failed to restore %s: %w", name, err)
+			}
+			_, err = io.Copy(out, io.LimitReader(tr, maxStateFileSize))
+			if closeErr := out.Close(); err == nil {
+				err = closeErr
+			}
+			if err != nil {
+				return nil, fmt.Errorf("failed to restore %s: %w", name, err)
+			}
+		default:
+			return nil, fmt.Errorf("backup entry %q is not a regular file or directory", header.Name)
+		}
+
+		top, _, _ := strings.Cut(name, "/")
+		found[top] = true
+	}
+
+	var restored []string
+	for _, name := range stateFiles {
+		if found[name] {
+			restored = append(restored, name)
+		}
+	}
+	if len(restored) == 0 {
+		return nil, fmt.Errorf("backup holds no blueprint state")
+	}
+	return restored, nil
+}
+
+// restoreStateBackup replaces the state files of blueprintDir with the ones
+// in archive. The archive is unpacked and checked in full before anything
+// in blueprintDir is touched. State files the archive lacks are left as they
+// are.
+func restoreStateBackup(archive, blueprintDir string) ([]string, error) {
+	stageDir, err := os.MkdirTemp(blueprintDir, ".restore-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to prepare restore: %w", err)
+	}
+	defer func() { _ = os.RemoveAll(stageDir) }()
+
+	restored, err := extractStateBackup(archive, stageDir)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range restored {
+		dest := filepath.Join(blueprintDir, name)
+		if err := os.RemoveAll(dest); err != nil {
+			return nil, fmt.Errorf("failed to replace %s: %w", name, err)
+		}
+		// The log of the database replaced must not be applied to the restored one
+		if name == stateDBName {
+			for _, sidecar := range sqliteSidecars {
+				if err := os.Remove(filepath.Join(blueprintDir, sidecar)); err != nil && !os.IsNotExist(err) {
+					return nil, fmt.Errorf("failed to replace %s: %w", name, err)
+				}
+			}
+		}
+		if err := os.Rename(filepath.Join(stageDir, name), dest); err != nil {
+			return nil, fmt.Errorf("failed to replace %s: %w", name, err)
+		}
+	}
+	return restored, nil
+}
+
+// BackupState writes an archive of the state in ~/.blueprint to destDir.
+// It is what the state-backup rule's crontab entry runs.
+func BackupState(destDir string) int {
+	blueprintDir, err := getBlueprintDir()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", ui.FormatError(err.Error()))
+		return 1
+	}
+	home, _ := os.UserHomeDir()
+	path, err := writeStateBackup(blueprintDir, internal.ExpandHome(destDir, home), time.Now())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", ui.FormatError(fmt.Sprintf("State backup failed: %v", err)))
+		return 1
+	}
+	fmt.Println(ui.FormatSuccess("State backed up to " + ui.AbbreviateHome(path)))
+	return 0
+}
+
+// restorePrompt is the confirmation asked before restoring; a variable so
+// tests can answer it.
+var restorePrompt = prompt.Confirm
+
+// RestoreState replaces the state in ~/.blueprint with a backup written by
+// BackupState, after confirmation. The current state is backed up next to
+// the archive first, so a restore of the wrong archive can be undone.
+func RestoreState(archive string) int {
+	blueprintDir, err := getBlueprintDir()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", ui.FormatError(err.Error()))
+		return 1
+	}
+	if _, err := os.Stat(archive); err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", ui.FormatError(fmt.Sprintf("Backup not found: %s", archive)))
+		return 1
+	}
+
+	ok, err := restorePrompt(fmt.Sprintf("Replace the state in %s with %s?", ui.AbbreviateHome(blueprintDir), ui.AbbreviateHome(archive)), false)
+	if err != nil || !ok {
+		fmt.Println(ui.FormatDim("Restore cancelled"))
+		return 1
+	}
+
+	safety, err := writeStateBackup(blueprintDir, filepath.Dir(archive), time.Now())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", ui.FormatError(fmt.Sprintf("Could not back up the current state, nothing restored: %v", err)))
+		return 1
+	}
+	fmt.Println(ui.FormatDim("Current state backed up to " + ui.AbbreviateHome(safety)))
+
+	restored, err := restoreStateBackup(archive, blueprintDir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", ui.FormatError(fmt.Sprintf("Restore failed: %v", err)))
+		return 1
+	}
+	fmt.Println(ui.FormatSuccess("Restored " + strings.Join(restored, ", ")))
+	return 0
+}
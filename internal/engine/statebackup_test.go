@@ -0,0 +1,99 @@
+package engine
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeTestFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStateBackupRoundTrip(t *testing.T) {
+	state := t.TempDir()
+	dest := filepath.Join(t.TempDir(), "backups")
+	writeTestFile(t, filepath.Join(state, "status.json"), `{"packages":[]}`)
+	writeTestFile(t, filepath.Join(state, "history", "3", "1.output"), "done")
+	writeTestFile(t, filepath.Join(state, "schedule.log"), "log")
+	writeTestFile(t, filepath.Join(state, "repos", "github.com", "u", "r", "setup.bp"), "clone")
+
+	now := time.Date(2026, 10, 1, 9, 0, 0, 0, time.UTC)
+	archive, err := writeStateBackup(state, dest, now)
+	if err != nil {
+		t.Fatalf("writeStateBackup() error: %v", err)
+	}
+	if filepath.Base(archive) != "blueprint-state-20261001-090000.tar.gz" {
+		t.Errorf("archive name = %s", filepath.Base(archive))
+	}
+
+	// A second backup in the same second must not replace the first
+	second, err := writeStateBackup(state, dest, now)
+	if err != nil || second == archive {
+		t.Fatalf("second backup = %s, %v; want a new archive", second, err)
+	}
+
+	writeTestFile(t, filepath.Join(state, "status.json"), `{"broken"`)
+	if err := os.RemoveAll(filepath.Join(state, "history")); err != nil {
+		t.Fatal(err)
+	}
+
+	restored, err := restoreStateBackup(archive, state)
+	if err != nil {
+		t.Fatalf("restoreStateBackup() error: %v", err)
+	}
+	if strings.Join(restored, ",") != "status.json,history" {
+		t.Errorf("restored = %v, want status.json and history", restored)
+	}
+	if data, _ := os.ReadFile(filepath.Join(state, "status.json")); string(data) != `{"packages":[]}` {
+		t.Errorf("status.json = %s", data)
+	}
+	if data, _ := os.ReadFile(filepath.Join(state, "history", "3", "1.output")); string(data) != "done" {
+		t.Errorf("history output = %q", data)
+	}
+	// Files that are not state are neither archived nor touched by a restore
+	if _, err := os.Stat(filepath.Join(state, "repos", "github.com", "u", "r", "setup.bp")); err != nil {
+		t.Errorf("repos should be left alone: %v", err)
+	}
+}
+
+func TestRestoreStateBackupRejectsUnexpectedEntries(t *testing.T) {
+	for _, name := range []string{"../status.json", "repos/evil", "/etc/passwd", "history/../../x"} {
+		t.Run(name, func(t *testing.T) {
+			state := t.TempDir()
+			writeTestFile(t, filepath.Join(state, "status.json"), "original")
+
+			archive := filepath.Join(t.TempDir(), "bad.tar.gz")
+			f, err := os.Create(archive)
+			if err != nil {
+				t.Fatal(err)
+			}
+			gz := gzip.NewWriter(f)
+			tw := tar.NewWriter(gz)
+			_ = tw.WriteHeader(&tar.Header{Name: "status.json", Mode: 0o600, Size: 3, Typeflag: tar.TypeReg})
+			_, _ = tw.Write([]byte("new"))
+			_ = tw.WriteHeader(&tar.Header{Name: name, Mode: 0o600, Size: 1, Typeflag: tar.TypeReg})
+			_, _ = tw.Write([]byte("x"))
+			_ = tw.Close()
+			_ = gz.Close()
+			_ = f.Close()
+
+			if _, err := restoreStateBackup(archive, state); err == nil {
+				t.Fatal("restoreStateBackup() should reject the archive")
+			}
+			if data, _ := os.ReadFile(filepath.Join(state, "status.json")); string(data) != "original" {
+				t.Errorf("a rejected archive must not change the state, status.json = %q", data)
+			}
+		})
+	}
+}
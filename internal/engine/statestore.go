@@ -0,0 +1,98 @@
+package engine
+
+import (
+	handlerskg "github.com/elpic/blueprint/internal/handlers"
+)
+
+// Where status and history are kept, set with backend in the [state] section
+// of ~/.blueprint/config.
+const (
+	// stateBackendJSON keeps status in status.json and each run's history in
+	// history/<run>/manifest.json, listed in history/index.jsonl.
+	stateBackendJSON = "json"
+	// stateBackendSQLite keeps both in ~/.blueprint/state.db, written in
+	// transactions, so concurrent runs cannot lose each other's updates.
+	stateBackendSQLite = "sqlite"
+)
+
+// StateStore persists what blueprint records between runs: the status of the
+// applied rules and the history of each run. The rule outputs of a run are
+// kept as files under history/<run>/ whatever the backend.
+type StateStore interface {
+	// LoadStatus returns the recorded status. When none has been recorded
+	// yet the error satisfies os.IsNotExist.
+	LoadStatus() (handlerskg.Status, error)
+	// SaveStatus replaces the recorded status.
+	SaveStatus(status handlerskg.Status) error
+	// UpdateStatus applies update to the recorded status, an empty one when
+	// there is none, and saves the result unless update fails.
+	UpdateStatus(update func(*handlerskg.Status) error) error
+	// SaveRun records the records of a run, replacing any saved before
+	// under the same number.
+	SaveRun(runNumber int, records []ExecutionRecord) error
+	// ListRuns returns a summary of every recorded run, in run order.
+	ListRuns() ([]historyIndexEntry, error)
+	// LoadRun returns the records of a run. When the run was not recorded
+	// the error satisfies os.IsNotExist.
+	LoadRun(runNumber int) ([]ExecutionRecord, error)
+	// NextRunNumber allocates the number of a new run. Concurrent callers,
+	// in this process or others, never get the same number.
+	NextRunNumber() (int, error)
+	// DeleteRuns forgets the records of the given runs. Their outputs under
+	// history/<run>/ are left to the caller.
+	DeleteRuns(runNumbers []int) error
+	// Close releases the store.
+	Close() error
+}
+
+func init() {
+	handlerskg.CurrentStatus = loadCurrentStatus
+}
+
+// openStateStore opens the store of the current workspace (see getStateDir)
+// with the backend the user configuration selects, the JSON files unless
+// [state] says otherwise. Callers close it when done.
+func openStateStore() (StateStore, error) {
+	cfg, err := loadConfig()
+	if err != nil {
+		return nil, err
+	}
+	stateDir, err := getStateDir()
+	if err != nil {
+		return nil, err
+	}
+	if cfg.StateBackend == stateBackendSQLite {
+		return openSQLiteStateStore(stateDir)
+	}
+	return &jsonStateStore{dir: stateDir}, nil
+}
+
+// loadStatus returns the recorded status from the configured store.
+func loadStatus() (handlerskg.Status, error) {
+	store, err := openStateStore()
+	if err != nil {
+		return handlerskg.Status{}, err
+	}
+	defer func() { _ = store.Close() }()
+	return store.LoadStatus()
+}
+
+// storeStatus replaces the recorded status in the configured store.
+func storeStatus(status handlerskg.Status) error {
+	store, err := openStateStore()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = store.Close() }()
+	return store.SaveStatus(status)
+}
+
+// updateStatus applies update to the recorded status in the configured store.
+func updateStatus(update func(*handlerskg.Status) error) error {
+	store, err := openStateStore()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = store.Close() }()
+	return store.UpdateStatus(update)
+}
@@ -0,0 +1,7 @@
+//go:build cgo
+
+package engine
+
+// sqliteSupported reports whether this build can open state.db: the SQLite
+// driver needs cgo.
+const sqliteSupported = true
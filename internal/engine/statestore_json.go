@@ -0,0 +1,330 @@
+package engine
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/elpic/blueprint/internal"
+	handlerskg "github.com/elpic/blueprint/internal/handlers"
+	"github.com/elpic/blueprint/internal/ui"
+)
+
+// jsonStateStore keeps status and history as JSON files in the blueprint
+// directory: status.json and, per run, history/<run>/manifest.json listed in
+// history/index.jsonl.
+type jsonStateStore struct {
+	dir string
+}
+
+func (s *jsonStateStore) statusPath() string {
+	return filepath.Join(s.dir, "status.json")
+}
+
+// historyDir returns the history directory, creating it if needed.
+func (s *jsonStateStore) historyDir() (string, error) {
+	historyDir := filepath.Join(s.dir, "history")
+	if err := os.MkdirAll(historyDir, internal.DirectoryPermission); err != nil {
+		return "", fmt.Errorf("failed to create history directory: %w", err)
+	}
+	return historyDir, nil
+}
+
+func (s *jsonStateStore) LoadStatus() (handlerskg.Status, error) {
+	var status handlerskg.Status
+	data, err := readBlueprintFile(s.statusPath())
+	if err != nil {
+		return status, err
+	}
+	if err := handlerskg.UnmarshalStatus(data, &status); err != nil {
+		return handlerskg.Status{}, err
+	}
+	return status, nil
+}
+
+func (s *jsonStateStore) SaveStatus(status handlerskg.Status) error {
+	return writeStatusFile(s.statusPath(), status)
+}
+
+// UpdateStatus reads status.json, applies update and writes it back. A file
+// that cannot be read is set aside and replaced; one from a newer blueprint is
+// left alone and its error returned.
+func (s *jsonStateStore) UpdateStatus(update func(*handlerskg.Status) error) error {
+	statusPath := s.statusPath()
+	var status handlerskg.Status
+	if data, err := readBlueprintFile(statusPath); err == nil {
+		if err := handlerskg.UnmarshalStatus(data, &status); err != nil {
+			var schemaErr *handlerskg.StatusSchemaError
+			if errors.As(err, &schemaErr) {
+				return err
+			}
+			setAsideStatusFile(statusPath, data, err)
+			status = handlerskg.Status{}
+		}
+	}
+	if err := update(&status); err != nil {
+		return err
+	}
+	return writeStatusFile(statusPath, status)
+}
+
+// writeStatusFile writes status to statusPath atomically: to a temporary
+// file in the same directory that then replaces it, so a crash or a full disk
+// mid-write leaves the previous status.json whole rather than truncated.
+func writeStatusFile(statusPath string, status handlerskg.Status) error {
+	data, err := handlerskg.MarshalStatus(status)
+	if err != nil {
+		return fmt.Errorf("failed to marshal status: %w", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(statusPath), ".status-*.json")
+	if err != nil {
+		return fmt.Errorf("failed to write status file: %w", err)
+	}
+	defer os.Remove(tmp.Name()) //nolint:errcheck // gone after the rename
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("failed to write status file: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("failed to write status file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write status file: %w", err)
+	}
+	if err := os.Chmod(tmp.Name(), internal.FilePermission); err != nil {
+		return fmt.Errorf("failed to write status file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), statusPath); err != nil {
+		return fmt.Errorf("failed to write status file: %w", err)
+	}
+	return nil
+}
+
+// setAsideStatusFile keeps a copy of a status.json that cannot be read next
+// to it, as status.json.bad, before it is replaced, and warns about it: its
+// entries are what auto-uninstall works from.
+func setAsideStatusFile(statusPath string, data []byte, parseErr error) {
+	bad := statusPath + ".bad"
+	if err := os.WriteFile(bad, data, internal.FilePermission); err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", ui.FormatError(fmt.Sprintf("Warning: %s cannot be read (%v) and could not be copied aside: %v", statusPath, parseErr, err)))
+		return
+	}
+	fmt.Fprintf(os.Stderr, "%s\n", ui.FormatError(fmt.Sprintf("Warning: %s cannot be read (%v); starting a new one, the old one is kept as %s", statusPath, parseErr, bad)))
+}
+
+// SaveRun writes the records of a run to its manifest and appends the run to
+// the history index.
+func (s *jsonStateStore) SaveRun(runNumber int, records []ExecutionRecord) error {
+	historyDir, err := s.historyDir()
+	if err != nil {
+		return err
+	}
+	runDir := filepath.Join(historyDir, fmt.Sprintf("%d", runNumber))
+	if err := os.MkdirAll(runDir, internal.DirectoryPermission); err != nil {
+		return fmt.Errorf("failed to create history directory: %w", err)
+	}
+	if err := writeHistoryManifest(filepath.Join(runDir, historyManifestName), records); err != nil {
+		return err
+	}
+	return appendHistoryIndex(historyDir, indexEntryFor(runNumber, records))
+}
+
+// writeHistoryManifest writes records to path through a temporary file, so
+// readers see either the whole manifest or none.
+func writeHistoryManifest(path string, records []ExecutionRecord) error {
+	data, err := json.MarshalIndent(records, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal history: %w", err)
+	}
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, internal.FilePermission); err != nil {
+		return fmt.Errorf("failed to write history file: %w", err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		_ = os.Remove(tmpPath)
+		return fmt.Errorf("failed to write history file: %w", err)
+	}
+	return nil
+}
+
+// appendHistoryIndex adds entry as one line to history/index.jsonl. The line
+// is written in a single O_APPEND write, so concurrent runs do not interleave.
+func appendHistoryIndex(historyDir string, entry historyIndexEntry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to marshal history index: %w", err)
+	}
+	f, err := os.OpenFile(filepath.Join(historyDir, historyIndexName), os.O_APPEND|os.O_CREATE|os.O_WRONLY, internal.FilePermission) // #nosec G304 -- index under ~/.blueprint/history
+	if err != nil {
+		return fmt.Errorf("failed to open history index: %w", err)
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("failed to write history index: %w", err)
+	}
+	return f.Close()
+}
+
+// ListRuns returns the runs listed in history/index.jsonl in run order, the
+// last line winning when a run was saved twice. Lines that do not parse, such
+// as one cut short by a crash, are skipped.
+func (s *jsonStateStore) ListRuns() ([]historyIndexEntry, error) {
+	if err := s.migrateLegacyHistory(); err != nil {
+		return nil, err
+	}
+	historyDir, err := s.historyDir()
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(filepath.Join(historyDir, historyIndexName)) // #nosec G304 -- index under ~/.blueprint/history
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+
+	byRun := map[int]historyIndexEntry{}
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var entry historyIndexEntry
+		if json.Unmarshal(scanner.Bytes(), &entry) != nil {
+			continue
+		}
+		byRun[entry.Run] = entry
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read history index: %w", err)
+	}
+
+	entries := make([]historyIndexEntry, 0, len(byRun))
+	for _, entry := range byRun {
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Run < entries[j].Run })
+	return entries, nil
+}
+
+// LoadRun returns the records in the run's manifest.
+func (s *jsonStateStore) LoadRun(runNumber int) ([]ExecutionRecord, error) {
+	if err := s.migrateLegacyHistory(); err != nil {
+		return nil, err
+	}
+	historyDir, err := s.historyDir()
+	if err != nil {
+		return nil, err
+	}
+	data, err := readBlueprintFile(filepath.Join(historyDir, fmt.Sprintf("%d", runNumber), historyManifestName))
+	if err != nil {
+		return nil, err
+	}
+	var records []ExecutionRecord
+	if err := json.Unmarshal(data, &records); err != nil {
+		return nil, fmt.Errorf("failed to parse history of run %d: %w", runNumber, err)
+	}
+	return records, nil
+}
+
+// DeleteRuns removes the manifests of the runs and rewrites the history
+// index without them, through a temporary file as the manifests are.
+func (s *jsonStateStore) DeleteRuns(runNumbers []int) error {
+	historyDir, err := s.historyDir()
+	if err != nil {
+		return err
+	}
+	drop := map[int]bool{}
+	for _, run := range runNumbers {
+		drop[run] = true
+		manifest := filepath.Join(historyDir, fmt.Sprintf("%d", run), historyManifestName)
+		if err := os.Remove(manifest); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove history of run %d: %w", run, err)
+		}
+	}
+
+	indexPath := filepath.Join(historyDir, historyIndexName)
+	data, err := readBlueprintFile(indexPath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read history index: %w", err)
+	}
+	var kept bytes.Buffer
+	for _, line := range bytes.SplitAfter(data, []byte("\n")) {
+		var entry historyIndexEntry
+		if json.Unmarshal(line, &entry) != nil || drop[entry.Run] {
+			continue
+		}
+		kept.Write(bytes.TrimRight(line, "\n"))
+		kept.WriteByte('\n')
+	}
+	tmpPath := indexPath + ".tmp"
+	if err := os.WriteFile(tmpPath, kept.Bytes(), internal.FilePermission); err != nil {
+		return fmt.Errorf("failed to write history index: %w", err)
+	}
+	if err := os.Rename(tmpPath, indexPath); err != nil {
+		_ = os.Remove(tmpPath)
+		return fmt.Errorf("failed to write history index: %w", err)
+	}
+	return nil
+}
+
+// NextRunNumber increments the counter in run_number while holding
+// run_number.lock, so two runs starting together cannot read the same value.
+func (s *jsonStateStore) NextRunNumber() (int, error) {
+	runNumberFile := filepath.Join(s.dir, "run_number")
+	var runNumber int
+	err := withFileLock(runNumberFile+".lock", func() error {
+		if data, err := readBlueprintFile(runNumberFile); err == nil {
+			_, _ = fmt.Sscanf(string(data), "%d", &runNumber)
+		}
+		runNumber++
+		return os.WriteFile(runNumberFile, []byte(fmt.Sprintf("%d", runNumber)), internal.FilePermission)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return runNumber, nil
+}
+
+func (s *jsonStateStore) Close() error {
+	return nil
+}
+
+// migrateLegacyHistory moves history.json, which held the latest run's
+// records, into that run's manifest and the index. The latest run is the one
+// in run_number, so this runs before a new run takes its number.
+func (s *jsonStateStore) migrateLegacyHistory() error {
+	legacyPath := filepath.Join(s.dir, "history.json")
+	data, err := readBlueprintFile(legacyPath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var records []ExecutionRecord
+	if err := json.Unmarshal(data, &records); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", legacyPath, err)
+	}
+
+	runNumber := 0
+	if raw, err := readBlueprintFile(filepath.Join(s.dir, "run_number")); err == nil {
+		_, _ = fmt.Sscanf(string(raw), "%d", &runNumber)
+	}
+	if runNumber > 0 && len(records) > 0 {
+		manifest := filepath.Join(s.dir, "history", fmt.Sprintf("%d", runNumber), historyManifestName)
+		if _, err := os.Stat(manifest); os.IsNotExist(err) {
+			if err := s.SaveRun(runNumber, historyRecords(records)); err != nil {
+				return err
+			}
+		}
+	}
+	return os.Remove(legacyPath)
+}
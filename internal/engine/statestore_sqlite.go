@@ -0,0 +1,361 @@
+package engine
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	_ "github.com/mattn/go-sqlite3" // registers the sqlite3 driver
+
+	"github.com/elpic/blueprint/internal"
+	handlerskg "github.com/elpic/blueprint/internal/handlers"
+)
+
+// stateDBName is the database of the SQLite backend, in the blueprint
+// directory.
+const stateDBName = "state.db"
+
+// sqliteSchema creates the tables of state.db. The status is one row holding
+// the same JSON as status.json, so it goes through the same schema
+// migrations; history is a row per run, summarized as in the JSON index, and
+// a row per record. The last run number is a row of counters.
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS status (
+	id   INTEGER PRIMARY KEY CHECK (id = 1),
+	data TEXT NOT NULL
+);
+CREATE TABLE IF NOT EXISTS runs (
+	run        INTEGER PRIMARY KEY,
+	timestamp  TEXT NOT NULL,
+	blueprints TEXT NOT NULL,
+	os         TEXT NOT NULL,
+	rules      INTEGER NOT NULL,
+	failed     INTEGER NOT NULL
+);
+CREATE TABLE IF NOT EXISTS records (
+	run  INTEGER NOT NULL,
+	idx  INTEGER NOT NULL,
+	data TEXT NOT NULL,
+	PRIMARY KEY (run, idx)
+);
+CREATE TABLE IF NOT EXISTS counters (
+	name  TEXT PRIMARY KEY,
+	value INTEGER NOT NULL
+);
+`
+
+// sqliteStateStore keeps status and history in state.db. Every write is a
+// transaction that takes the write lock up front, so concurrent runs wait
+// for each other instead of overwriting each other's changes.
+type sqliteStateStore struct {
+	db   *sql.DB
+	path string
+}
+
+// openSQLiteStateStore opens state.db in dir, creating it if needed. A new
+// database starts with the status and history of the JSON backend, so
+// switching backends keeps what was recorded.
+func openSQLiteStateStore(dir string) (*sqliteStateStore, error) {
+	path := filepath.Join(dir, stateDBName)
+	_, statErr := os.Stat(path)
+	created := os.IsNotExist(statErr)
+
+	db, err := sql.Open("sqlite3", "file:"+path+"?_busy_timeout=5000&_journal_mode=WAL&_txlock=immediate")
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	if err := os.Chmod(path, internal.FilePermission); err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("failed to open %s: %w", path, err)
+	}
+
+	s := &sqliteStateStore{db: db, path: path}
+	if created {
+		if err := s.importJSON(&jsonStateStore{dir: dir}); err != nil {
+			_ = db.Close()
+			for _, suffix := range []string{"", "-wal", "-shm"} {
+				_ = os.Remove(path + suffix)
+			}
+			return nil, fmt.Errorf("failed to import status and history into %s: %w", path, err)
+		}
+	}
+	return s, nil
+}
+
+// importJSON copies the status and history recorded by from.
+func (s *sqliteStateStore) importJSON(from *jsonStateStore) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	status, err := from.LoadStatus()
+	switch {
+	case err == nil:
+		if err := putStatus(tx, status); err != nil {
+			return err
+		}
+	case !os.IsNotExist(err):
+		return err
+	}
+
+	runs, err := from.ListRuns()
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	for _, run := range runs {
+		records, err := from.LoadRun(run.Run)
+		if err != nil {
+			// Runs saved before manifests only have their outputs
+			continue
+		}
+		if err := putRun(tx, run.Run, records); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// queryer is what reading the status needs, from the database or a
+// transaction.
+type queryer interface {
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+// getStatus reads the status row. Without one the error satisfies
+// os.IsNotExist.
+func (s *sqliteStateStore) getStatus(q queryer) (handlerskg.Status, error) {
+	var status handlerskg.Status
+	var data string
+	err := q.QueryRow(`SELECT data FROM status WHERE id = 1`).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return status, &fs.PathError{Op: "read status", Path: s.path, Err: fs.ErrNotExist}
+	}
+	if err != nil {
+		return status, fmt.Errorf("failed to read status: %w", err)
+	}
+	if err := handlerskg.UnmarshalStatus([]byte(data), &status); err != nil {
+		return handlerskg.Status{}, err
+	}
+	return status, nil
+}
+
+// putStatus replaces the status row.
+func putStatus(tx *sql.Tx, status handlerskg.Status) error {
+	data, err := handlerskg.MarshalStatus(status)
+	if err != nil {
+		return fmt.Errorf("failed to marshal status: %w", err)
+	}
+	if _, err := tx.Exec(`INSERT OR REPLACE INTO status (id, data) VALUES (1, ?)`, string(data)); err != nil {
+		return fmt.Errorf("failed to write status: %w", err)
+	}
+	return nil
+}
+
+func (s *sqliteStateStore) LoadStatus() (handlerskg.Status, error) {
+	return s.getStatus(s.db)
+}
+
+func (s *sqliteStateStore) SaveStatus(status handlerskg.Status) error {
+	return s.UpdateStatus(func(current *handlerskg.Status) error {
+		*current = status
+		return nil
+	})
+}
+
+// UpdateStatus reads, updates and writes the status in one transaction.
+func (s *sqliteStateStore) UpdateStatus(update func(*handlerskg.Status) error) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to write status: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	status, err := s.getStatus(tx)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := update(&status); err != nil {
+		return err
+	}
+	if err := putStatus(tx, status); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *sqliteStateStore) SaveRun(runNumber int, records []ExecutionRecord) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to write history: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+	if err := putRun(tx, runNumber, records); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// putRun replaces the summary and records of a run.
+func putRun(tx *sql.Tx, runNumber int, records []ExecutionRecord) error {
+	entry := indexEntryFor(runNumber, records)
+	blueprints, err := json.Marshal(entry.Blueprints)
+	if err != nil {
+		return fmt.Errorf("failed to marshal history: %w", err)
+	}
+	if _, err := tx.Exec(`DELETE FROM records WHERE run = ?`, runNumber); err != nil {
+		return fmt.Errorf("failed to write history: %w", err)
+	}
+	if _, err := tx.Exec(`INSERT OR REPLACE INTO runs (run, timestamp, blueprints, os, rules, failed) VALUES (?, ?, ?, ?, ?, ?)`,
+		entry.Run, entry.Timestamp, string(blueprints), entry.OS, entry.Rules, entry.Failed); err != nil {
+		return fmt.Errorf("failed to write history: %w", err)
+	}
+	for i, record := range records {
+		data, err := json.Marshal(record)
+		if err != nil {
+			return fmt.Errorf("failed to marshal history: %w", err)
+		}
+		if _, err := tx.Exec(`INSERT INTO records (run, idx, data) VALUES (?, ?, ?)`, runNumber, i, string(data)); err != nil {
+			return fmt.Errorf("failed to write history: %w", err)
+		}
+	}
+	return nil
+}
+
+func (s *sqliteStateStore) ListRuns() ([]historyIndexEntry, error) {
+	rows, err := s.db.Query(`SELECT run, timestamp, blueprints, os, rules, failed FROM runs ORDER BY run`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read history: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	var entries []historyIndexEntry
+	for rows.Next() {
+		var entry historyIndexEntry
+		var blueprints string
+		if err := rows.Scan(&entry.Run, &entry.Timestamp, &blueprints, &entry.OS, &entry.Rules, &entry.Failed); err != nil {
+			return nil, fmt.Errorf("failed to read history: %w", err)
+		}
+		_ = json.Unmarshal([]byte(blueprints), &entry.Blueprints)
+		entries = append(entries, entry)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read history: %w", err)
+	}
+	return entries, nil
+}
+
+func (s *sqliteStateStore) LoadRun(runNumber int) ([]ExecutionRecord, error) {
+	var exists bool
+	if err := s.db.QueryRow(`SELECT EXISTS (SELECT 1 FROM runs WHERE run = ?)`, runNumber).Scan(&exists); err != nil {
+		return nil, fmt.Errorf("failed to read history of run %d: %w", runNumber, err)
+	}
+	if !exists {
+		return nil, &fs.PathError{Op: "read history", Path: fmt.Sprintf("run %d", runNumber), Err: fs.ErrNotExist}
+	}
+
+	rows, err := s.db.Query(`SELECT data FROM records WHERE run = ? ORDER BY idx`, runNumber)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read history of run %d: %w", runNumber, err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	records := []ExecutionRecord{}
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, fmt.Errorf("failed to read history of run %d: %w", runNumber, err)
+		}
+		var record ExecutionRecord
+		if err := json.Unmarshal([]byte(data), &record); err != nil {
+			return nil, fmt.Errorf("failed to parse history of run %d: %w", runNumber, err)
+		}
+		records = append(records, record)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read history of run %d: %w", runNumber, err)
+	}
+	return records, nil
+}
+
+// NextRunNumber increments the run counter in a transaction, which holds the
+// write lock, so concurrent runs get distinct numbers. The counter starts
+// from run_number, or the last recorded run, and run_number is kept in step
+// for a switch back to the JSON backend.
+func (s *sqliteStateStore) NextRunNumber() (int, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to allocate a run number: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var runNumber int
+	err = tx.QueryRow(`SELECT value FROM counters WHERE name = 'run'`).Scan(&runNumber)
+	if errors.Is(err, sql.ErrNoRows) {
+		err = tx.QueryRow(`SELECT COALESCE(MAX(run), 0) FROM runs`).Scan(&runNumber)
+		runNumberFile := filepath.Join(filepath.Dir(s.path), "run_number")
+		if data, readErr := readBlueprintFile(runNumberFile); readErr == nil {
+			var fromFile int
+			_, _ = fmt.Sscanf(string(data), "%d", &fromFile)
+			runNumber = max(runNumber, fromFile)
+		}
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to allocate a run number: %w", err)
+	}
+	runNumber++
+	if _, err := tx.Exec(`INSERT OR REPLACE INTO counters (name, value) VALUES ('run', ?)`, runNumber); err != nil {
+		return 0, fmt.Errorf("failed to allocate a run number: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to allocate a run number: %w", err)
+	}
+	_ = os.WriteFile(filepath.Join(filepath.Dir(s.path), "run_number"), []byte(fmt.Sprintf("%d", runNumber)), internal.FilePermission)
+	return runNumber, nil
+}
+
+func (s *sqliteStateStore) DeleteRuns(runNumbers []int) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to remove history: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+	for _, run := range runNumbers {
+		if _, err := tx.Exec(`DELETE FROM records WHERE run = ?`, run); err != nil {
+			return fmt.Errorf("failed to remove history of run %d: %w", run, err)
+		}
+		if _, err := tx.Exec(`DELETE FROM runs WHERE run = ?`, run); err != nil {
+			return fmt.Errorf("failed to remove history of run %d: %w", run, err)
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *sqliteStateStore) Close() error {
+	return s.db.Close()
+}
+
+// snapshotSQLiteDB writes a copy of the database at src to dst, which must
+// not exist or be empty. VACUUM INTO reads the whole database, write-ahead
+// log included, in one transaction, so the copy is consistent even while
+// another run is writing to src.
+func snapshotSQLiteDB(src, dst string) error {
+	db, err := sql.Open("sqlite3", "file:"+src+"?_busy_timeout=5000")
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", src, err)
+	}
+	defer func() { _ = db.Close() }()
+	if _, err := db.Exec(`VACUUM INTO ?`, dst); err != nil {
+		return fmt.Errorf("failed to snapshot %s: %w", src, err)
+	}
+	return nil
+}
@@ -0,0 +1,218 @@
+//go:build cgo
+
+package engine
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	handlerskg "github.com/elpic/blueprint/internal/handlers"
+)
+
+func TestSQLiteStateStore(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	dir, err := getBlueprintDir()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// What the JSON backend recorded is imported into a new state.db
+	js := &jsonStateStore{dir: dir}
+	if err := js.SaveStatus(handlerskg.Status{Packages: []handlerskg.PackageStatus{{Name: "git", Blueprint: "/tmp/a.bp", OS: "linux"}}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := js.SaveRun(3, []ExecutionRecord{{Timestamp: "2025-05-01T10:00:00Z", Blueprint: "/tmp/a.bp", Command: "install git", Status: "success"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	store, err := openSQLiteStateStore(dir)
+	if err != nil {
+		t.Fatalf("openSQLiteStateStore() error = %v", err)
+	}
+	status, err := store.LoadStatus()
+	if err != nil || len(status.Packages) != 1 || status.Packages[0].Name != "git" {
+		t.Errorf("LoadStatus() = %+v, %v; want the imported git package", status, err)
+	}
+	runs, err := store.ListRuns()
+	if err != nil || len(runs) != 1 || runs[0].Run != 3 || runs[0].Blueprints[0] != "/tmp/a.bp" {
+		t.Errorf("ListRuns() = %+v, %v; want the imported run 3", runs, err)
+	}
+
+	if err := store.UpdateStatus(func(s *handlerskg.Status) error {
+		s.Packages = append(s.Packages, handlerskg.PackageStatus{Name: "vim", Blueprint: "/tmp/a.bp", OS: "linux"})
+		return nil
+	}); err != nil {
+		t.Fatalf("UpdateStatus() error = %v", err)
+	}
+	records := []ExecutionRecord{
+		{Timestamp: "2025-05-02T10:00:00Z", Blueprint: "/tmp/a.bp", Command: "install vim", Status: "success"},
+		{Timestamp: "2025-05-02T10:00:01Z", Blueprint: "/tmp/b.bp", Command: "install curl", Status: "error"},
+	}
+	if err := store.SaveRun(4, records); err != nil {
+		t.Fatalf("SaveRun() error = %v", err)
+	}
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// A second open finds what was written and imports nothing again
+	store, err = openSQLiteStateStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = store.Close() }()
+	if status, err := store.LoadStatus(); err != nil || len(status.Packages) != 2 {
+		t.Errorf("LoadStatus() = %+v, %v; want git and vim", status, err)
+	}
+	got, err := store.LoadRun(4)
+	if err != nil || len(got) != 2 || got[1].Command != "install curl" {
+		t.Errorf("LoadRun(4) = %+v, %v; want the two records in order", got, err)
+	}
+	if runs, _ := store.ListRuns(); len(runs) != 2 || runs[1].Failed != 1 || len(runs[1].Blueprints) != 2 {
+		t.Errorf("ListRuns() = %+v, want runs 3 and 4, one failure in 4", runs)
+	}
+	if _, err := store.LoadRun(9); !os.IsNotExist(err) {
+		t.Errorf("LoadRun(9) error = %v, want a not-exist error", err)
+	}
+
+	if err := store.DeleteRuns([]int{3}); err != nil {
+		t.Fatalf("DeleteRuns() error = %v", err)
+	}
+	if _, err := store.LoadRun(3); !os.IsNotExist(err) {
+		t.Errorf("LoadRun(3) after DeleteRuns error = %v, want a not-exist error", err)
+	}
+
+	// status.json is left as it was
+	if status, err := js.LoadStatus(); err != nil || len(status.Packages) != 1 {
+		t.Errorf("status.json = %+v, %v; want it untouched", status, err)
+	}
+}
+
+func TestSQLiteNextRunNumberConcurrent(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	dir, err := getBlueprintDir()
+	if err != nil {
+		t.Fatal(err)
+	}
+	store, err := openSQLiteStateStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = store.Close() }()
+	assertDistinctRunNumbers(t, store.NextRunNumber)
+
+	// The counter carries on from run_number in a new database
+	other := filepath.Join(dir, "workspaces", "other")
+	writeTestFile(t, filepath.Join(other, "run_number"), "41")
+	store2, err := openSQLiteStateStore(other)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = store2.Close() }()
+	if num, err := store2.NextRunNumber(); err != nil || num != 42 {
+		t.Errorf("NextRunNumber() = %d, %v; want 42 after run_number 41", num, err)
+	}
+}
+
+func TestOpenStateStoreFromConfig(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	writeTestFile(t, filepath.Join(home, ".blueprint", "config"), "[state]\nbackend = sqlite\n")
+
+	if _, err := loadStatus(); !os.IsNotExist(err) {
+		t.Fatalf("loadStatus() error = %v, want a not-exist error before any apply", err)
+	}
+	if err := saveStatus(nil, nil, "/tmp/test.bp", "abc123", "linux"); err != nil {
+		t.Fatalf("saveStatus() error = %v", err)
+	}
+	if status := loadCurrentStatus(); status.BlueprintSHA != "abc123" {
+		t.Errorf("loadCurrentStatus() = %+v, want the saved status", status)
+	}
+	if _, err := os.Stat(filepath.Join(home, ".blueprint", stateDBName)); err != nil {
+		t.Errorf("state.db was not created: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(home, ".blueprint", "status.json")); !os.IsNotExist(err) {
+		t.Errorf("status.json was written with the sqlite backend: %v", err)
+	}
+}
+
+func TestStateBackupSnapshotsSQLite(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	dir, err := getBlueprintDir()
+	if err != nil {
+		t.Fatal(err)
+	}
+	store, err := openSQLiteStateStore(dir)
+	if err != nil {
+		t.Fatalf("openSQLiteStateStore() error = %v", err)
+	}
+	defer func() { _ = store.Close() }()
+	git := handlerskg.PackageStatus{Name: "git", Blueprint: "/tmp/a.bp", OS: "linux"}
+	if err := store.SaveStatus(handlerskg.Status{Packages: []handlerskg.PackageStatus{git}}); err != nil {
+		t.Fatal(err)
+	}
+
+	// The status is still in the write-ahead log of the open database
+	archive, err := writeStateBackup(dir, t.TempDir(), time.Now())
+	if err != nil {
+		t.Fatalf("writeStateBackup() error: %v", err)
+	}
+	f, err := os.Open(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = f.Close() }()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for tr := tar.NewReader(gz); ; {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, header.Name)
+	}
+	if !slices.Contains(names, stateDBName) {
+		t.Errorf("archive holds %v, want %s", names, stateDBName)
+	}
+	for _, sidecar := range sqliteSidecars {
+		if slices.Contains(names, sidecar) {
+			t.Errorf("archive holds %s, which SQLite only keeps while state.db is open", sidecar)
+		}
+	}
+
+	vim := handlerskg.PackageStatus{Name: "vim", Blueprint: "/tmp/a.bp", OS: "linux"}
+	if err := store.SaveStatus(handlerskg.Status{Packages: []handlerskg.PackageStatus{git, vim}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+	writeTestFile(t, filepath.Join(dir, stateDBName+"-wal"), "stale")
+
+	if _, err := restoreStateBackup(archive, dir); err != nil {
+		t.Fatalf("restoreStateBackup() error: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, stateDBName+"-wal")); !os.IsNotExist(err) {
+		t.Errorf("restore left the write-ahead log of the replaced database: %v", err)
+	}
+	store, err = openSQLiteStateStore(dir)
+	if err != nil {
+		t.Fatalf("openSQLiteStateStore() after restore error = %v", err)
+	}
+	if status, err := store.LoadStatus(); err != nil || len(status.Packages) != 1 || status.Packages[0].Name != "git" {
+		t.Errorf("LoadStatus() after restore = %+v, %v; want only git", status, err)
+	}
+}
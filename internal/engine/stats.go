@@ -0,0 +1,282 @@
+package engine
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/elpic/blueprint/internal"
+	handlerskg "github.com/elpic/blueprint/internal/handlers"
+	"github.com/elpic/blueprint/internal/parser"
+	"github.com/elpic/blueprint/internal/ui"
+	"github.com/elpic/blueprint/internal/ui/timeutil"
+)
+
+// Usage stats are opt-in ([stats] enabled = true in ~/.blueprint/config) and
+// never leave the machine: each apply adds its rules to
+// ~/.blueprint/stats.json, which `blueprint stats` summarizes so authors can
+// spot the rules of their blueprints that are slow or keep failing.
+
+const statsFileName = "stats.json"
+
+// usageStats is the content of ~/.blueprint/stats.json.
+type usageStats struct {
+	Since   string         `json:"since"` // first run counted
+	Runs    int            `json:"runs"`
+	Actions map[string]int `json:"actions"` // rules run per action
+	Rules   []ruleStats    `json:"rules"`
+}
+
+// ruleStats counts the runs of one rule of one blueprint.
+type ruleStats struct {
+	Action    string `json:"action"`
+	Rule      string `json:"rule"` // the rule's summary, e.g. its packages or path
+	Blueprint string `json:"blueprint"`
+	Runs      int    `json:"runs"`
+	Unchanged int    `json:"unchanged"` // runs that found nothing to do
+	Failures  int    `json:"failures"`
+	Flaps     int    `json:"flaps,omitempty"` // runs that changed something again with nothing edited
+	TotalMs   int64  `json:"total_ms"`        // time spent in the runs that did something
+	LastRun   string `json:"last_run"`
+}
+
+// averageMs is the average duration of the runs that did something.
+func (r ruleStats) averageMs() int64 {
+	if worked := r.Runs - r.Unchanged; worked > 0 {
+		return r.TotalMs / int64(worked)
+	}
+	return 0
+}
+
+// failureRate is the share of runs that failed, from 0 to 1.
+func (r ruleStats) failureRate() float64 {
+	if r.Runs == 0 {
+		return 0
+	}
+	return float64(r.Failures) / float64(r.Runs)
+}
+
+// statsPath returns the path of ~/.blueprint/stats.json.
+func statsPath() (string, error) {
+	blueprintDir, err := getBlueprintDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(blueprintDir, statsFileName), nil
+}
+
+// loadUsageStats reads the stats file; a missing file is empty stats.
+func loadUsageStats() (usageStats, error) {
+	stats := usageStats{Actions: map[string]int{}}
+	path, err := statsPath()
+	if err != nil {
+		return stats, err
+	}
+	data, err := readBlueprintFile(path)
+	if os.IsNotExist(err) {
+		return stats, nil
+	}
+	if err != nil {
+		return stats, err
+	}
+	if err := json.Unmarshal(data, &stats); err != nil {
+		return stats, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	if stats.Actions == nil {
+		stats.Actions = map[string]int{}
+	}
+	return stats, nil
+}
+
+// recordUsageStats adds the rules of a run, paired with the records
+// executeRules returned for them, to the stats file. Rules that were skipped
+// or never attempted are not counted.
+func recordUsageStats(rules []parser.Rule, records []ExecutionRecord) error {
+	ordered, err := runRules(rules, records)
+	if err != nil {
+		return err
+	}
+	if len(ordered) != len(records) {
+		return fmt.Errorf("%d rules but %d execution records", len(ordered), len(records))
+	}
+
+	stats, err := loadUsageStats()
+	if err != nil {
+		return err
+	}
+	now := timeutil.Now()
+	if stats.Since == "" {
+		stats.Since = now
+	}
+	stats.Runs++
+
+	index := map[[3]string]int{}
+	for i, r := range stats.Rules {
+		index[[3]string{r.Action, r.Rule, r.Blueprint}] = i
+	}
+	for i, rule := range ordered {
+		r := reportRule{rule: rule, record: records[i]}
+		result := r.result()
+		if result == statusSkipped || result == statusNotAttempted {
+			continue
+		}
+		action := r.action()
+		stats.Actions[action]++
+
+		key := [3]string{action, handlerskg.RuleSummary(rule), r.record.Blueprint}
+		idx, ok := index[key]
+		if !ok {
+			stats.Rules = append(stats.Rules, ruleStats{Action: key[0], Rule: key[1], Blueprint: key[2]})
+			idx = len(stats.Rules) - 1
+			index[key] = idx
+		}
+		entry := &stats.Rules[idx]
+		entry.Runs++
+		entry.LastRun = now
+		if r.record.Flapping {
+			entry.Flaps++
+		}
+		switch result {
+		case "unchanged":
+			entry.Unchanged++
+		case "failed":
+			entry.Failures++
+			entry.TotalMs += r.record.DurationMs
+		default:
+			entry.TotalMs += r.record.DurationMs
+		}
+	}
+
+	return writeUsageStats(stats)
+}
+
+// writeUsageStats replaces the stats file through a temporary file.
+func writeUsageStats(stats usageStats) error {
+	path, err := statsPath()
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(stats, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal stats: %w", err)
+	}
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, internal.FilePermission); err != nil {
+		return fmt.Errorf("failed to write stats: %w", err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		_ = os.Remove(tmpPath)
+		return fmt.Errorf("failed to write stats: %w", err)
+	}
+	return nil
+}
+
+// statsEnabled reports whether [stats] enabled = true is set. A config that
+// does not parse leaves stats off; apply reports that error itself.
+func statsEnabled() bool {
+	cfg, err := loadConfig()
+	return err == nil && cfg.Stats
+}
+
+// PrintStats summarizes the usage stats: the rule types used, the slowest
+// rules on average and the rules that fail most often, topN of each.
+func PrintStats(topN int) {
+	stats, err := loadUsageStats()
+	if err != nil {
+		fmt.Printf("%s\n", ui.FormatError(fmt.Sprintf("Error: %v", err)))
+		return
+	}
+	if jsonOutput {
+		if stats.Rules == nil {
+			stats.Rules = []ruleStats{}
+		}
+		_ = printJSON(os.Stdout, stats)
+		return
+	}
+	if stats.Runs == 0 {
+		if statsEnabled() {
+			fmt.Printf("%s\n", ui.FormatInfo("No stats yet. They are collected on the next 'blueprint apply'."))
+		} else {
+			fmt.Printf("%s\n", ui.FormatInfo("Usage stats are off. Add this to ~/.blueprint/config to collect them on apply:\n\n  [stats]\n  enabled = true\n\nThey are kept in ~/.blueprint/stats.json and never sent anywhere."))
+		}
+		return
+	}
+	if topN <= 0 {
+		topN = 10
+	}
+
+	fmt.Printf("\n%s\n", ui.FormatHighlight(fmt.Sprintf("=== Usage Stats: %d runs since %s ===", stats.Runs, stats.Since)))
+
+	type actionCount struct {
+		name  string
+		count int
+	}
+	var actions []actionCount
+	for name, count := range stats.Actions {
+		actions = append(actions, actionCount{name, count})
+	}
+	sort.Slice(actions, func(i, j int) bool {
+		if actions[i].count != actions[j].count {
+			return actions[i].count > actions[j].count
+		}
+		return actions[i].name < actions[j].name
+	})
+	fmt.Printf("\n%s\n", ui.FormatHighlight("Rule types:"))
+	for _, a := range actions {
+		fmt.Printf("  %-16s %d\n", a.name, a.count)
+	}
+
+	slow := make([]ruleStats, 0, len(stats.Rules))
+	for _, r := range stats.Rules {
+		if r.averageMs() > 0 {
+			slow = append(slow, r)
+		}
+	}
+	sort.SliceStable(slow, func(i, j int) bool { return slow[i].averageMs() > slow[j].averageMs() })
+	if len(slow) > 0 {
+		fmt.Printf("\n%s\n", ui.FormatHighlight("Slowest rules (average):"))
+		for _, r := range slow[:min(topN, len(slow))] {
+			fmt.Printf("  %s  %s %s\n",
+				ui.FormatHighlight(fmt.Sprintf("%6.1fs", float64(r.averageMs())/1000)),
+				ui.FormatInfo(r.Action+" "+r.Rule),
+				ui.FormatDim(fmt.Sprintf("(%d runs, %s)", r.Runs, ui.AbbreviateHome(r.Blueprint))))
+		}
+	}
+
+	var flaky []ruleStats
+	for _, r := range stats.Rules {
+		if r.Failures > 0 {
+			flaky = append(flaky, r)
+		}
+	}
+	sort.SliceStable(flaky, func(i, j int) bool { return flaky[i].failureRate() > flaky[j].failureRate() })
+	if len(flaky) > 0 {
+		fmt.Printf("\n%s\n", ui.FormatHighlight("Failing rules:"))
+		for _, r := range flaky[:min(topN, len(flaky))] {
+			fmt.Printf("  %s  %s %s\n",
+				ui.FormatError(fmt.Sprintf("%5.0f%%", r.failureRate()*100)),
+				ui.FormatInfo(r.Action+" "+r.Rule),
+				ui.FormatDim(fmt.Sprintf("(%d of %d runs failed, %s)", r.Failures, r.Runs, ui.AbbreviateHome(r.Blueprint))))
+		}
+	}
+
+	var flapping []ruleStats
+	for _, r := range stats.Rules {
+		if r.Flaps > 0 {
+			flapping = append(flapping, r)
+		}
+	}
+	sort.SliceStable(flapping, func(i, j int) bool { return flapping[i].Flaps > flapping[j].Flaps })
+	if len(flapping) > 0 {
+		fmt.Printf("\n%s\n", ui.FormatHighlight("Non-convergent rules:"))
+		for _, r := range flapping[:min(topN, len(flapping))] {
+			fmt.Printf("  %s  %s %s\n",
+				ui.FormatError(fmt.Sprintf("%5dx", r.Flaps)),
+				ui.FormatInfo(r.Action+" "+r.Rule),
+				ui.FormatDim(fmt.Sprintf("(changed again with nothing edited in %d of %d runs, %s)", r.Flaps, r.Runs, ui.AbbreviateHome(r.Blueprint))))
+		}
+	}
+	fmt.Printf("\n")
+}
@@ -0,0 +1,67 @@
+package engine
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/elpic/blueprint/internal/parser"
+)
+
+func TestRecordUsageStats(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	if err := os.MkdirAll(filepath.Join(home, ".blueprint"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	rules := []parser.Rule{
+		{Action: "install", Packages: []parser.Package{{Name: "git"}}},
+		{Action: "run", RunCommand: "make setup"},
+	}
+	runs := [][]ExecutionRecord{
+		{
+			{Blueprint: "/tmp/setup.bp", Status: "success", DurationMs: 4000},
+			{Blueprint: "/tmp/setup.bp", Status: "error", DurationMs: 1000},
+		},
+		{
+			{Blueprint: "/tmp/setup.bp", Status: "success", Output: "already installed", DurationMs: 5},
+			{Blueprint: "/tmp/setup.bp", Status: "success", DurationMs: 3000},
+		},
+	}
+	for _, records := range runs {
+		if err := recordUsageStats(rules, records); err != nil {
+			t.Fatalf("recordUsageStats() error: %v", err)
+		}
+	}
+
+	stats, err := loadUsageStats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Runs != 2 || stats.Since == "" {
+		t.Errorf("runs = %d since %q, want 2 runs with a start", stats.Runs, stats.Since)
+	}
+	if stats.Actions["install"] != 2 || stats.Actions["run"] != 2 {
+		t.Errorf("actions = %v, want 2 install and 2 run", stats.Actions)
+	}
+	if len(stats.Rules) != 2 {
+		t.Fatalf("rules = %+v, want 2", stats.Rules)
+	}
+	for _, r := range stats.Rules {
+		switch r.Action {
+		case "install":
+			if r.Runs != 2 || r.Unchanged != 1 || r.averageMs() != 4000 {
+				t.Errorf("install stats = %+v, want 2 runs, 1 unchanged, 4000ms average", r)
+			}
+		case "run":
+			if r.Failures != 1 || r.failureRate() != 0.5 || r.averageMs() != 2000 {
+				t.Errorf("run stats = %+v, want 1 of 2 runs failed, 2000ms average", r)
+			}
+		}
+	}
+
+	if err := recordUsageStats(rules, runs[0][:1]); err == nil {
+		t.Error("recordUsageStats() with a missing record should fail")
+	}
+}
@@ -1,7 +1,6 @@
 package engine
 
 import (
-	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -13,41 +12,9 @@ import (
 	handlerskg "github.com/elpic/blueprint/internal/handlers"
 	"github.com/elpic/blueprint/internal/parser"
 	"github.com/elpic/blueprint/internal/ui"
+	"github.com/elpic/blueprint/internal/ui/timeutil"
 )
 
-func getHistoryPath() (string, error) {
-	homeDir, err := os.UserHomeDir()
-	if err != nil {
-		return "", fmt.Errorf("failed to get home directory: %w", err)
-	}
-
-	blueprintDir := filepath.Join(homeDir, ".blueprint")
-
-	// Create directory if it doesn't exist
-	if err := os.MkdirAll(blueprintDir, internal.DirectoryPermission); err != nil {
-		return "", fmt.Errorf("failed to create .blueprint directory: %w", err)
-	}
-
-	return filepath.Join(blueprintDir, "history.json"), nil
-}
-
-// getStatusPath returns the path to the status file in ~/.blueprint/
-func getStatusPath() (string, error) {
-	homeDir, err := os.UserHomeDir()
-	if err != nil {
-		return "", fmt.Errorf("failed to get home directory: %w", err)
-	}
-
-	blueprintDir := filepath.Join(homeDir, ".blueprint")
-
-	// Create directory if it doesn't exist
-	if err := os.MkdirAll(blueprintDir, internal.DirectoryPermission); err != nil {
-		return "", fmt.Errorf("failed to create .blueprint directory: %w", err)
-	}
-
-	return filepath.Join(blueprintDir, "status.json"), nil
-}
-
 // validateBlueprintPath validates that a file path is within the blueprint directory
 // This prevents path traversal attacks
 func validateBlueprintPath(filePath string) error {
@@ -67,9 +34,10 @@ func validateBlueprintPath(filePath string) error {
 		return fmt.Errorf("invalid file path: %w", err)
 	}
 
-	// Ensure the file path is within the blueprint directory
-	relPath, err := filepath.Rel(blueprintDirAbs, filePathAbs)
-	if err != nil || strings.HasPrefix(relPath, "..") {
+	// Ensure the file path is within the blueprint directory. HasPathPrefix
+	// compares whole path elements, ignoring case and separator style on
+	// Windows, and a path on another drive never matches.
+	if !internal.HasPathPrefix(filePathAbs, blueprintDirAbs) {
 		return fmt.Errorf("path traversal attempt detected: %s", filePath)
 	}
 
@@ -84,69 +52,36 @@ func readBlueprintFile(filePath string) ([]byte, error) {
 	return os.ReadFile(filePath)
 }
 
-// saveHistory saves execution records to ~/.blueprint/history.json.
-// Only the latest run's records are kept — full output for all runs is
-// already persisted in ~/.blueprint/history/<run>/<rule>.output files.
-func saveHistory(records []ExecutionRecord) error {
-	if len(records) == 0 {
-		return nil
-	}
-
-	historyPath, err := getHistoryPath()
-	if err != nil {
-		return err
-	}
-
-	// Strip output — it's already in per-run .output files
-	for i := range records {
-		records[i].Output = ""
-	}
-
-	// Overwrite with only the latest run's records
-	data, err := json.MarshalIndent(records, "", "  ")
-	if err != nil {
-		return fmt.Errorf("failed to marshal history: %w", err)
-	}
-
-	if err := os.WriteFile(historyPath, data, internal.FilePermission); err != nil {
-		return fmt.Errorf("failed to write history file: %w", err)
-	}
-
-	return nil
-}
-
-// saveStatus saves the current status of installed packages and clones to ~/.blueprint/status.json
-// loadCurrentStatus reads and returns the current status from disk.
-// Returns an empty Status if the file doesn't exist or can't be parsed.
+// loadCurrentStatus returns the recorded status. Returns an empty Status if
+// there is none or it can't be read.
 func loadCurrentStatus() handlerskg.Status {
-	var status handlerskg.Status
-	statusPath, err := getStatusPath()
-	if err != nil {
-		return status
-	}
-	data, err := readBlueprintFile(statusPath)
-	if err != nil {
-		return status
-	}
-	_ = json.Unmarshal(data, &status)
+	status, _ := loadStatus()
 	return status
 }
 
+// saveStatus records the installed packages, clones and other resources of
+// the rules in the state store
 func saveStatus(rules []parser.Rule, records []ExecutionRecord, blueprint string, blueprintSHA string, osName string) error {
-	statusPath, err := getStatusPath()
-	if err != nil {
-		return err
-	}
-
 	// Normalize blueprint identifier for consistent storage and comparison
 	// Handles both local file paths and git URLs (SSH/HTTPS → canonical form)
 	blueprint = normalizeBlueprint(blueprint)
 
-	// Load existing status
-	var status handlerskg.Status
-	if data, err := readBlueprintFile(statusPath); err == nil {
-		_ = json.Unmarshal(data, &status)
-	}
+	return updateStatus(func(status *handlerskg.Status) error {
+		updateStatusForRun(status, rules, records, blueprint, blueprintSHA, osName)
+		return nil
+	})
+}
+
+// updateStatusForRun records what rules did in status.
+func updateStatusForRun(status *handlerskg.Status, rules []parser.Rule, records []ExecutionRecord, blueprint, blueprintSHA, osName string) {
+	// Entries of the other machines sharing this home directory are kept as
+	// they are
+	machine := machineID()
+	mine, others := status.SplitByMachine(machine)
+	*status = mine
+
+	// Carry entries recorded under a renamed rule's old identity over to the new one
+	handlerskg.MigrateAliases(status, rules, blueprint, osName)
 
 	// Record the SHA of the blueprint repo at apply time so doctor can check
 	// orphans against the exact version that was applied.
@@ -178,23 +113,17 @@ func saveStatus(rules []parser.Rule, records []ExecutionRecord, blueprint string
 		}
 
 		// Let the handler update status
-		if err := handler.UpdateStatus(&status, handlerRecords, blueprint, osName); err != nil {
+		if err := handler.UpdateStatus(status, handlerRecords, blueprint, osName); err != nil {
 			// Log but don't fail on status update errors
 			fmt.Fprintf(os.Stderr, "Warning: failed to update status for rule %v: %v\n", rule.Action, err)
 		}
 	}
 
-	// Write status to file
-	data, err := json.MarshalIndent(status, "", "  ")
-	if err != nil {
-		return fmt.Errorf("failed to marshal status: %w", err)
-	}
+	// Record the shell rc files handlers appended to, with their backups
+	handlerskg.RecordRCEdits(status, blueprint, osName)
 
-	if err := os.WriteFile(statusPath, data, internal.FilePermission); err != nil {
-		return fmt.Errorf("failed to write status file: %w", err)
-	}
-
-	return nil
+	handlerskg.StampMachine(status, blueprint, osName, machine)
+	status.AppendEntries(others)
 }
 
 // getAutoUninstallRules compares status with current rules and generates uninstall rules for removed resources
@@ -202,23 +131,25 @@ func saveStatus(rules []parser.Rule, records []ExecutionRecord, blueprint string
 func getAutoUninstallRules(currentRules []parser.Rule, blueprintFile string, osName string) []parser.Rule {
 	var autoUninstallRules []parser.Rule
 
-	// Load status file to check for removed resources
-	statusPath, err := getStatusPath()
-	if err != nil {
+	// Load status to check for removed resources
+	status, err := loadStatus()
+	if os.IsNotExist(err) {
+		// No status yet, nothing to uninstall
 		return autoUninstallRules
 	}
-
-	statusData, err := readBlueprintFile(statusPath)
 	if err != nil {
-		// No status file yet, nothing to uninstall
+		// Without the status there is nothing to compare against: say so
+		// rather than silently leaving removed rules installed
+		fmt.Fprintf(os.Stderr, "%s\n", ui.FormatError(fmt.Sprintf("Warning: the status cannot be read (%v); removed rules are not uninstalled", err)))
 		return autoUninstallRules
 	}
 
-	var status handlerskg.Status
-	if err := json.Unmarshal(statusData, &status); err != nil {
-		// Invalid status file, can't process
-		return autoUninstallRules
-	}
+	// Only what this machine installed is removed here; other machines
+	// sharing the home directory clean up after themselves
+	status, _ = status.SplitByMachine(machineID())
+
+	// Entries recorded under a renamed rule's old identity are not removals
+	handlerskg.MigrateAliases(&status, currentRules, blueprintFile, osName)
 
 	// Get all status provider handlers from the factory (single place where handlers are instantiated)
 	handlers := handlerskg.GetStatusProviderHandlers()
@@ -261,22 +192,14 @@ func PrintDiff(blueprintFile string, preferSSH bool) {
 
 	currentOS := getOSName()
 	// Interpolate ${VAR_NAME} references before filtering and display.
-	vars := resolveVarMap(rules, nil)
+	vars := resolveVarMap(rules, machineVars(nil))
 	for i, r := range rules {
 		rules[i] = interpolateRule(r, vars)
 	}
 	desiredRules := filterRulesByOS(rules)
 
-	statusPath, err := getStatusPath()
-	if err != nil {
-		fmt.Printf("%s\n", ui.FormatError("Error getting status path"))
-		return
-	}
-
-	var status handlerskg.Status
-	if data, err := readBlueprintFile(statusPath); err == nil {
-		_ = json.Unmarshal(data, &status)
-	}
+	status := loadCurrentStatus()
+	handlerskg.MigrateAliases(&status, desiredRules, blueprintFile, currentOS)
 
 	// Removals: resources in status but no longer in the blueprint
 	removeRules := getAutoUninstallRules(desiredRules, blueprintFile, currentOS)
@@ -338,28 +261,51 @@ func PrintDiff(blueprintFile string, preferSSH bool) {
 }
 
 func PrintStatus() {
-	statusPath, err := getStatusPath()
+	header := "=== Blueprint Status ==="
+	if name, err := currentWorkspace(); err == nil && name != defaultWorkspace {
+		header = "=== Blueprint Status: workspace " + name + " ==="
+	}
+	printStatus(loadStatus, "No status found. Run 'blueprint apply' to create one.", header)
+}
+
+// PrintTargetStatus displays the status of a machine applied with
+// apply --target, as recorded after its last run.
+func PrintTargetStatus(target string) {
+	statusPath, err := targetStatusPath(target)
 	if err != nil {
 		fmt.Printf("%s\n", ui.FormatError("Error getting status path"))
 		return
 	}
+	store := &jsonStateStore{dir: filepath.Dir(statusPath)}
+	printStatus(store.LoadStatus, fmt.Sprintf("No status recorded for %s. Run 'blueprint apply <file.bp> --target %s' to record it.", target, target), "=== Blueprint Status: "+target+" ===")
+}
 
-	// Read status file
-	data, err := readBlueprintFile(statusPath)
+// printStatus displays the status load returns under header, or missing when
+// there is none.
+func printStatus(load func() (handlerskg.Status, error), missing, header string) {
+	status, err := load()
+	if os.IsNotExist(err) {
+		if jsonOutput {
+			_ = printJSON(os.Stdout, handlerskg.Status{})
+			return
+		}
+		fmt.Printf("%s\n", ui.FormatInfo(missing))
+		return
+	}
 	if err != nil {
-		fmt.Printf("%s\n", ui.FormatInfo("No status file found. Run 'blueprint apply' to create one."))
+		fmt.Printf("%s\n", ui.FormatError(fmt.Sprintf("Error reading status: %v", err)))
 		return
 	}
 
-	// Parse status
-	var status handlerskg.Status
-	if err := json.Unmarshal(data, &status); err != nil {
-		fmt.Printf("%s\n", ui.FormatError("Error parsing status file"))
+	if jsonOutput {
+		if err := printJSON(os.Stdout, status); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		}
 		return
 	}
 
 	// Display header
-	fmt.Printf("\n%s\n", ui.FormatHighlight("=== Blueprint Status ==="))
+	fmt.Printf("\n%s\n", ui.FormatHighlight(header))
 
 	// Use handler factory to display status from all handler types
 	// Each handler knows how to display its own status data
@@ -385,20 +331,17 @@ func PrintStatus() {
 // PrintSlow displays the slowest rule executions from history.
 // topN limits the results (default 10). If lastOnly is true, only the latest run is shown.
 func PrintSlow(topN int) {
-	historyPath, err := getHistoryPath()
+	latestRun, err := getLatestRunNumber()
 	if err != nil {
-		fmt.Printf("%s\n", ui.FormatError("Error getting history path"))
+		fmt.Printf("%s\n", ui.FormatInfo("No history found. Run 'blueprint apply' to create one."))
 		return
 	}
-
-	data, err := readBlueprintFile(historyPath)
-	if err != nil {
+	records, err := loadRunRecords(latestRun)
+	if os.IsNotExist(err) {
 		fmt.Printf("%s\n", ui.FormatInfo("No history found. Run 'blueprint apply' to create one."))
 		return
 	}
-
-	var records []ExecutionRecord
-	if err := json.Unmarshal(data, &records); err != nil {
+	if err != nil {
 		fmt.Printf("%s\n", ui.FormatError("Error parsing history file"))
 		return
 	}
@@ -444,40 +387,36 @@ func PrintSlow(topN int) {
 	fmt.Printf("\n")
 }
 
-// getNextRunNumber returns the next run number and increments the counter
+// getNextRunNumber allocates the number of a new run from the configured
+// store.
 func getNextRunNumber() (int, error) {
-	blueprintDir, err := getBlueprintDir()
+	stateDir, err := getStateDir()
 	if err != nil {
 		return 0, err
 	}
 
-	runNumberFile := filepath.Join(blueprintDir, "run_number")
-
-	// Read current run number
-	var runNumber int
-	if data, err := readBlueprintFile(runNumberFile); err == nil {
-		_, _ = fmt.Sscanf(string(data), "%d", &runNumber)
+	// history.json belongs to the run in run_number; move it to that run's
+	// manifest before the counter moves on
+	if err := (&jsonStateStore{dir: stateDir}).migrateLegacyHistory(); err != nil {
+		fmt.Printf("Warning: Failed to migrate history.json: %v\n", err)
 	}
 
-	// Increment for next run
-	runNumber++
-
-	// Write back
-	if err := os.WriteFile(runNumberFile, []byte(fmt.Sprintf("%d", runNumber)), internal.FilePermission); err != nil {
+	store, err := openStateStore()
+	if err != nil {
 		return 0, err
 	}
-
-	return runNumber, nil
+	defer func() { _ = store.Close() }()
+	return store.NextRunNumber()
 }
 
 // saveRuleOutput saves the output of a rule execution to history
 func saveRuleOutput(runNumber, ruleIndex int, output, stderr string) error {
-	blueprintDir, err := getBlueprintDir()
+	stateDir, err := getStateDir()
 	if err != nil {
 		return err
 	}
 
-	historyDir := filepath.Join(blueprintDir, "history", fmt.Sprintf("%d", runNumber))
+	historyDir := filepath.Join(stateDir, "history", fmt.Sprintf("%d", runNumber))
 	if err := os.MkdirAll(historyDir, internal.DirectoryPermission); err != nil {
 		return err
 	}
@@ -490,12 +429,12 @@ func saveRuleOutput(runNumber, ruleIndex int, output, stderr string) error {
 
 // getLatestRunNumber returns the latest run number from the history directory
 func getLatestRunNumber() (int, error) {
-	blueprintDir, err := getBlueprintDir()
+	stateDir, err := getStateDir()
 	if err != nil {
 		return 0, err
 	}
 
-	historyBaseDir := filepath.Join(blueprintDir, "history")
+	historyBaseDir := filepath.Join(stateDir, "history")
 	entries, err := os.ReadDir(historyBaseDir)
 	if err != nil {
 		return 0, fmt.Errorf("no history found")
@@ -519,45 +458,63 @@ func getLatestRunNumber() (int, error) {
 	return latestRun, nil
 }
 
-// filterHistoryRecords filters records by timestamp prefix and blueprint name substring.
-func filterHistoryRecords(records []ExecutionRecord, since, blueprintFilter string) []ExecutionRecord {
-	if since == "" && blueprintFilter == "" {
+// filterHistoryRecords filters records by timestamp prefix, blueprint name
+// substring and exact group name. The prefix is matched against the local
+// time of each record, so a run just after midnight is on the day it was for
+// the user whatever time zone it was recorded in.
+func filterHistoryRecords(records []ExecutionRecord, since, blueprintFilter, group string) []ExecutionRecord {
+	if since == "" && blueprintFilter == "" && group == "" {
 		return records
 	}
 	var filtered []ExecutionRecord
 	for _, r := range records {
-		if since != "" && !strings.HasPrefix(r.Timestamp, since) {
+		if since != "" && !strings.HasPrefix(localTimestamp(r.Timestamp), since) {
 			continue
 		}
 		if blueprintFilter != "" && !strings.Contains(r.Blueprint, blueprintFilter) {
 			continue
 		}
+		if group != "" && r.Group != group {
+			continue
+		}
 		filtered = append(filtered, r)
 	}
 	return filtered
 }
 
-// loadHistoryRecords loads and optionally filters the history.json records.
-// since is a time prefix (e.g. "2025-05", "2025-05-01"); blueprintFilter filters by blueprint name substring.
-func loadHistoryRecords(since, blueprintFilter string) ([]ExecutionRecord, error) {
-	historyPath, err := getHistoryPath()
+// localTimestamp returns a stored timestamp in local time, in the RFC 3339
+// layout --since prefixes are written in, or ts itself when it does not parse.
+func localTimestamp(ts string) string {
+	t, err := timeutil.Parse(ts)
 	if err != nil {
-		return nil, err
+		return ts
 	}
-	data, err := readBlueprintFile(historyPath)
+	return timeutil.Format(t.Local())
+}
+
+// loadHistoryRecords loads the records of every run in the history index
+// and optionally filters them.
+// since is a time prefix (e.g. "2025-05", "2025-05-01"); blueprintFilter filters by blueprint name substring;
+// group keeps only the rules of that group.
+func loadHistoryRecords(since, blueprintFilter, group string) ([]ExecutionRecord, error) {
+	runs, err := readHistoryIndex()
 	if err != nil {
 		return nil, err
 	}
 	var records []ExecutionRecord
-	if err := json.Unmarshal(data, &records); err != nil {
-		return nil, err
+	for _, run := range runs {
+		runRecords, err := loadRunRecords(run.Run)
+		if err != nil {
+			continue
+		}
+		records = append(records, runRecords...)
 	}
-	return filterHistoryRecords(records, since, blueprintFilter), nil
+	return filterHistoryRecords(records, since, blueprintFilter, group), nil
 }
 
 // PrintHistoryStats prints aggregate stats from history, optionally filtered.
-func PrintHistoryStats(since, blueprintFilter string) {
-	records, err := loadHistoryRecords(since, blueprintFilter)
+func PrintHistoryStats(since, blueprintFilter, group string) {
+	records, err := loadHistoryRecords(since, blueprintFilter, group)
 	if err != nil {
 		fmt.Printf("%s\n", ui.FormatInfo("No history found. Run 'blueprint apply' to create one."))
 		return
@@ -567,13 +524,18 @@ func PrintHistoryStats(since, blueprintFilter string) {
 		return
 	}
 	total := len(records)
-	var succeeded, failed int
+	var succeeded, failed, skipped, notAttempted int
 	var totalMs int64
 	blueprints := map[string]int{}
 	for _, r := range records {
-		if r.Status == "success" {
+		switch r.Status {
+		case "success":
 			succeeded++
-		} else {
+		case statusSkipped:
+			skipped++
+		case statusNotAttempted:
+			notAttempted++
+		default:
 			failed++
 		}
 		totalMs += r.DurationMs
@@ -581,13 +543,31 @@ func PrintHistoryStats(since, blueprintFilter string) {
 			blueprints[r.Blueprint]++
 		}
 	}
+	if jsonOutput {
+		_ = printJSON(os.Stdout, historyStats{
+			Total:           total,
+			Succeeded:       succeeded,
+			Failed:          failed,
+			Skipped:         skipped,
+			NotAttempted:    notAttempted,
+			TotalDurationMs: totalMs,
+			Blueprints:      blueprints,
+		})
+		return
+	}
 	fmt.Printf("\n%s\n", ui.FormatHighlight("=== HISTORY STATS ==="))
 	fmt.Printf("  Total rules run : %d\n", total)
 	fmt.Printf("  Succeeded       : %d\n", succeeded)
 	fmt.Printf("  Failed          : %d\n", failed)
+	if skipped > 0 {
+		fmt.Printf("  Skipped         : %d\n", skipped)
+	}
+	if notAttempted > 0 {
+		fmt.Printf("  Not attempted   : %d\n", notAttempted)
+	}
 	if totalMs > 0 {
-		fmt.Printf("  Total duration  : %.1fs\n", float64(totalMs)/1000)
-		fmt.Printf("  Avg duration    : %.1fs\n", float64(totalMs)/float64(total)/1000)
+		fmt.Printf("  Total duration  : %s\n", timeutil.Milliseconds(totalMs))
+		fmt.Printf("  Avg duration    : %s\n", timeutil.Milliseconds(totalMs/int64(total)))
 	}
 	if len(blueprints) > 0 {
 		fmt.Printf("\n%s\n", ui.FormatHighlight("  Blueprints:"))
@@ -607,28 +587,60 @@ func PrintHistoryStats(since, blueprintFilter string) {
 	fmt.Printf("\n")
 }
 
+// historyStats is what history --stats prints with --output json.
+type historyStats struct {
+	Total           int            `json:"total"`
+	Succeeded       int            `json:"succeeded"`
+	Failed          int            `json:"failed"`
+	Skipped         int            `json:"skipped"`
+	NotAttempted    int            `json:"not_attempted"`
+	TotalDurationMs int64          `json:"total_duration_ms"`
+	Blueprints      map[string]int `json:"blueprints"`
+}
+
+// historyStep is a rule of a run as history prints it with --output json.
+// Command, status, duration and group are only known for the latest run.
+type historyStep struct {
+	Number     int    `json:"number"`
+	Command    string `json:"command,omitempty"`
+	Status     string `json:"status,omitempty"`
+	Group      string `json:"group,omitempty"`
+	DurationMs int64  `json:"duration_ms,omitempty"`
+	ExitCode   int    `json:"exit_code,omitempty"`
+	Stdout     string `json:"stdout"`
+	Stderr     string `json:"stderr"`
+}
+
+// historyRun is what history prints with --output json.
+type historyRun struct {
+	Run      int           `json:"run"`
+	Metadata *runMetadata  `json:"metadata,omitempty"`
+	Steps    []historyStep `json:"steps"`
+}
+
 // PrintHistory displays the history of a specific run
 // If runNumber is 0, displays the latest run
 // If stepNumber is >= 0, displays only that specific step
 // since and blueprintFilter are optional filters applied to the run listing.
-func PrintHistory(runNumber int, stepNumber int, since, blueprintFilter string) {
-	blueprintDir, err := getBlueprintDir()
+// group, when set, shows only the rules of that group.
+func PrintHistory(runNumber int, stepNumber int, since, blueprintFilter, group string) {
+	stateDir, err := getStateDir()
 	if err != nil {
-		fmt.Printf("%s\n", ui.FormatError(fmt.Sprintf("Failed to get blueprint directory: %v", err)))
+		fmt.Printf("%s\n", ui.FormatError(fmt.Sprintf("Error reading history: %v", err)))
 		return
 	}
 
 	// If runNumber is 0, get the latest run
+	latestRun, latestErr := getLatestRunNumber()
 	if runNumber == 0 {
-		var err error
-		runNumber, err = getLatestRunNumber()
-		if err != nil {
+		if latestErr != nil {
 			fmt.Printf("%s\n", ui.FormatError("No history found"))
 			return
 		}
+		runNumber = latestRun
 	}
 
-	historyDir := filepath.Join(blueprintDir, "history", fmt.Sprintf("%d", runNumber))
+	historyDir := filepath.Join(stateDir, "history", fmt.Sprintf("%d", runNumber))
 
 	// Check if history directory exists
 	if _, err := os.Stat(historyDir); os.IsNotExist(err) {
@@ -636,18 +648,32 @@ func PrintHistory(runNumber int, stepNumber int, since, blueprintFilter string)
 		return
 	}
 
-	// Load durations from history.json (best-effort, keyed by 1-based rule index)
+	// Load durations and groups from the run's manifest (best-effort, keyed
+	// by 1-based rule index). Runs saved before manifests have none.
 	durations := map[int]int64{}
-	if data, err := readBlueprintFile(filepath.Join(blueprintDir, "history.json")); err == nil {
-		var recs []ExecutionRecord
-		if json.Unmarshal(data, &recs) == nil {
-			for idx, r := range recs {
-				durations[idx+1] = r.DurationMs
-			}
-		}
+	groups := map[int]string{}
+	latest := map[int]ExecutionRecord{}
+	recs, manifestErr := loadRunRecords(runNumber)
+	for idx, r := range recs {
+		durations[idx+1] = r.DurationMs
+		groups[idx+1] = r.Group
+		latest[idx+1] = r.redacted()
+	}
+	// Runs saved before run.json was written have no metadata
+	meta, _ := loadRunMetadata(historyDir)
+	if group != "" && manifestErr != nil {
+		fmt.Printf("%s\n", ui.FormatError(fmt.Sprintf("--group needs the rule groups of run %d, which were not kept", runNumber)))
+		return
 	}
 
-	fmt.Printf("\n%s\n", ui.FormatHighlight(fmt.Sprintf("=== RUN %d HISTORY ===", runNumber)))
+	if !jsonOutput {
+		fmt.Printf("\n%s\n", ui.FormatHighlight(fmt.Sprintf("=== RUN %d HISTORY ===", runNumber)))
+		if meta != nil {
+			printRunMetadata(meta)
+		} else if len(recs) > 0 && recs[0].Timestamp != "" {
+			fmt.Printf("%s\n", ui.FormatDim("Ran "+timeutil.Display(recs[0].Timestamp)))
+		}
+	}
 
 	// List all output files
 	entries, err := os.ReadDir(historyDir)
@@ -656,7 +682,8 @@ func PrintHistory(runNumber int, stepNumber int, since, blueprintFilter string)
 		return
 	}
 
-	if len(entries) == 0 {
+	steps := []historyStep{}
+	if len(entries) == 0 && !jsonOutput {
 		fmt.Printf("%s\n", ui.FormatInfo("No rule outputs recorded for this run"))
 		return
 	}
@@ -679,6 +706,9 @@ func PrintHistory(runNumber int, stepNumber int, since, blueprintFilter string)
 			if stepNumber >= 0 && ruleNumInt != stepNumber {
 				continue
 			}
+			if group != "" && groups[ruleNumInt] != group {
+				continue
+			}
 
 			outputPath := filepath.Join(historyDir, entry.Name())
 
@@ -689,24 +719,34 @@ func PrintHistory(runNumber int, stepNumber int, since, blueprintFilter string)
 
 			durationStr := ""
 			if ms, ok := durations[ruleNumInt]; ok && ms > 0 {
-				durationStr = fmt.Sprintf(" %s", ui.FormatDim(fmt.Sprintf("[%.1fs]", float64(ms)/1000)))
+				durationStr = fmt.Sprintf(" %s", ui.FormatDim("["+timeutil.Milliseconds(ms)+"]"))
 			}
-			fmt.Printf("\n%s\n", ui.FormatHighlight(fmt.Sprintf("Rule #%s:%s", ruleNum, durationStr)))
-
-			// Parse stdout and stderr sections
-			contentStr := string(content)
-			parts := strings.Split(contentStr, "\n=== STDERR ===\n")
-
-			stdout := ""
-			stderr := ""
-
-			if len(parts) >= 1 {
-				stdout = strings.TrimPrefix(parts[0], "=== STDOUT ===\n")
-				stdout = strings.TrimSpace(stdout)
+			groupStr := ""
+			if g := groups[ruleNumInt]; g != "" {
+				groupStr = " " + ui.FormatDim("("+g+")")
+			}
+			exitStr := ""
+			if code := latest[ruleNumInt].ExitCode; code != 0 {
+				exitStr = " " + ui.FormatError(fmt.Sprintf("exit %d", code))
+			}
+			if !jsonOutput {
+				fmt.Printf("\n%s\n", ui.FormatHighlight(fmt.Sprintf("Rule #%s:%s%s%s", ruleNum, groupStr, durationStr, exitStr)))
 			}
 
-			if len(parts) >= 2 {
-				stderr = strings.TrimSpace(parts[1])
+			stdout, stderr := splitRuleOutput(string(content))
+
+			if jsonOutput {
+				steps = append(steps, historyStep{
+					Number:     ruleNumInt,
+					Command:    latest[ruleNumInt].Command,
+					Status:     latest[ruleNumInt].Status,
+					Group:      groups[ruleNumInt],
+					DurationMs: durations[ruleNumInt],
+					ExitCode:   latest[ruleNumInt].ExitCode,
+					Stdout:     stdout,
+					Stderr:     stderr,
+				})
+				continue
 			}
 
 			// Show stdout if not empty (with separator line instead of header)
@@ -730,5 +770,9 @@ func PrintHistory(runNumber int, stepNumber int, since, blueprintFilter string)
 		}
 	}
 
+	if jsonOutput {
+		_ = printJSON(os.Stdout, historyRun{Run: runNumber, Metadata: meta, Steps: steps})
+		return
+	}
 	fmt.Printf("\n")
 }
@@ -3,7 +3,11 @@ package engine
 import (
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/elpic/blueprint/internal/parser"
 )
@@ -37,6 +41,11 @@ func TestValidateBlueprintPath(t *testing.T) {
 			filePath:  "/etc/passwd",
 			wantError: true,
 		},
+		{
+			name:      "sibling directory sharing the name prefix",
+			filePath:  filepath.Join(homeDir, ".blueprint-other", "status.json"),
+			wantError: true,
+		},
 	}
 
 	for _, tt := range tests {
@@ -103,6 +112,7 @@ func TestReadBlueprintFile(t *testing.T) {
 
 // TestSaveHistory tests the saveHistory function
 func TestSaveHistory(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
 	tests := []struct {
 		name      string
 		records   []ExecutionRecord
@@ -140,7 +150,7 @@ func TestSaveHistory(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			err := saveHistory(tt.records)
+			err := saveHistory(1, tt.records)
 			if (err != nil) != tt.wantError {
 				t.Errorf("saveHistory() error = %v, wantError %v", err, tt.wantError)
 			}
@@ -239,6 +249,43 @@ func TestGetNextRunNumber(t *testing.T) {
 	}
 }
 
+// assertDistinctRunNumbers calls next from several goroutines at once and
+// fails unless they get the numbers 1 to n.
+func assertDistinctRunNumbers(t *testing.T, next func() (int, error)) {
+	t.Helper()
+	const n = 20
+	got := make([]int, n)
+	var wg sync.WaitGroup
+	for i := range got {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			num, err := next()
+			if err != nil {
+				t.Errorf("NextRunNumber() error = %v", err)
+			}
+			got[i] = num
+		}()
+	}
+	wg.Wait()
+	slices.Sort(got)
+	for i, num := range got {
+		if num != i+1 {
+			t.Fatalf("concurrent NextRunNumber() = %v, want 1 to %d once each", got, n)
+		}
+	}
+}
+
+func TestJSONNextRunNumberConcurrent(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	dir, err := getBlueprintDir()
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := &jsonStateStore{dir: dir}
+	assertDistinctRunNumbers(t, store.NextRunNumber)
+}
+
 // TestGetLatestRunNumber tests the getLatestRunNumber function
 func TestGetLatestRunNumber(t *testing.T) {
 	// With no history, should return 0
@@ -261,44 +308,111 @@ func TestLoadHistoryRecords(t *testing.T) {
 	}
 
 	t.Run("no filter returns all", func(t *testing.T) {
-		got := filterHistoryRecords(records, "", "")
+		got := filterHistoryRecords(records, "", "", "")
 		if len(got) != 4 {
 			t.Errorf("want 4 records, got %d", len(got))
 		}
 	})
 
 	t.Run("since month filter", func(t *testing.T) {
-		got := filterHistoryRecords(records, "2025-05", "")
+		got := filterHistoryRecords(records, "2025-05", "", "")
 		if len(got) != 2 {
 			t.Errorf("want 2 records, got %d", len(got))
 		}
 	})
 
 	t.Run("since year filter", func(t *testing.T) {
-		got := filterHistoryRecords(records, "2025", "")
+		got := filterHistoryRecords(records, "2025", "", "")
 		if len(got) != 3 {
 			t.Errorf("want 3 records, got %d", len(got))
 		}
 	})
 
 	t.Run("blueprint filter", func(t *testing.T) {
-		got := filterHistoryRecords(records, "", "dotfiles")
+		got := filterHistoryRecords(records, "", "dotfiles", "")
 		if len(got) != 2 {
 			t.Errorf("want 2 records, got %d", len(got))
 		}
 	})
 
 	t.Run("combined filter", func(t *testing.T) {
-		got := filterHistoryRecords(records, "2025-05", "dotfiles")
+		got := filterHistoryRecords(records, "2025-05", "dotfiles", "")
 		if len(got) != 2 {
 			t.Errorf("want 2 records, got %d", len(got))
 		}
 	})
 
+	t.Run("group filter", func(t *testing.T) {
+		grouped := append([]ExecutionRecord{{Timestamp: "2025-05-03T10:00:00Z", Blueprint: "dotfiles.bp", Status: "success", Group: "vim"}}, records...)
+		got := filterHistoryRecords(grouped, "", "", "vim")
+		if len(got) != 1 || got[0].Group != "vim" {
+			t.Errorf("want the 1 vim record, got %v", got)
+		}
+	})
+
+	t.Run("since matches the local day", func(t *testing.T) {
+		orig := time.Local
+		defer func() { time.Local = orig }()
+		time.Local = time.FixedZone("UTC+2", 2*60*60)
+		late := []ExecutionRecord{{Timestamp: "2025-04-30T23:30:00Z", Blueprint: "dotfiles.bp"}}
+		if got := filterHistoryRecords(late, "2025-05-01", "", ""); len(got) != 1 {
+			t.Errorf("want the record of 01:30 local time on May 1, got %v", got)
+		}
+	})
+
 	t.Run("no matches returns empty", func(t *testing.T) {
-		got := filterHistoryRecords(records, "2099", "")
+		got := filterHistoryRecords(records, "2099", "", "")
 		if len(got) != 0 {
 			t.Errorf("want 0 records, got %d", len(got))
 		}
 	})
 }
+
+// getStatusPath returns the path of status.json in ~/.blueprint, creating
+// the directory, for tests that write one directly.
+func getStatusPath() (string, error) {
+	blueprintDir, err := getBlueprintDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(blueprintDir, "status.json"), nil
+}
+
+func TestSaveStatusUnreadableFile(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	statusPath, err := getStatusPath()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A file cut short mid-write is kept aside and a new one started
+	truncated := []byte(`{"packages": [{"name": "cu`)
+	if err := os.WriteFile(statusPath, truncated, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := saveStatus(nil, nil, "/tmp/test.bp", "", "linux"); err != nil {
+		t.Fatalf("saveStatus() error = %v", err)
+	}
+	if kept, err := os.ReadFile(statusPath + ".bad"); err != nil || string(kept) != string(truncated) {
+		t.Errorf("status.json.bad = %q, %v; want the unreadable file", kept, err)
+	}
+	data, err := os.ReadFile(statusPath)
+	if err != nil || !strings.Contains(string(data), `"schema_version": 1`) {
+		t.Errorf("status.json = %q, %v; want a new file with the schema version", data, err)
+	}
+	if entries, _ := filepath.Glob(filepath.Join(filepath.Dir(statusPath), ".status-*")); len(entries) != 0 {
+		t.Errorf("temporary files left behind: %v", entries)
+	}
+
+	// A file from a newer blueprint is left alone
+	newer := []byte(`{"schema_version": 99, "packages": []}`)
+	if err := os.WriteFile(statusPath, newer, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := saveStatus(nil, nil, "/tmp/test.bp", "", "linux"); err == nil {
+		t.Error("saveStatus() error = nil over a status file with a newer schema")
+	}
+	if data, _ := os.ReadFile(statusPath); string(data) != string(newer) {
+		t.Errorf("status.json = %q, want it unchanged", data)
+	}
+}
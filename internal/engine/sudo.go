@@ -0,0 +1,190 @@
+package engine
+
+import (
+	"errors"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	handlerskg "github.com/elpic/blueprint/internal/handlers"
+	"github.com/elpic/blueprint/internal/parser"
+)
+
+// noSudo is set by --no-sudo: blueprint never asks for the sudo password,
+// and rules that need sudo for a command sudoers does not allow without a
+// password fail instead of running.
+var noSudo bool
+
+// SetNoSudo controls whether rules needing elevation fail instead of
+// prompting for the sudo password.
+func SetNoSudo(on bool) {
+	noSudo = on
+}
+
+var privilegeOnce sync.Once
+
+// privilegeTool returns the tool commands needing root run with: the one
+// [privilege] of ~/.blueprint/config sets, or else the first of sudo, doas
+// and run0 installed. The config is read once per process.
+func privilegeTool() string {
+	privilegeOnce.Do(func() {
+		if cfg, err := loadConfig(); err == nil {
+			_ = handlerskg.SetPrivilegeTool(cfg.PrivilegeTool)
+		}
+	})
+	return handlerskg.PrivilegeTool()
+}
+
+// privilegeWithoutPassword reports whether the privilege tool runs commands
+// as root without asking for a password, as `sudo -n true` tells for sudo.
+// Defined as a var to allow stubbing in tests.
+var privilegeWithoutPassword = func() bool {
+	tool := privilegeTool()
+	return exec.Command(tool, handlerskg.PrivilegeNonInteractive(tool), "true").Run() == nil // #nosec G204 -- one of the known privilege tools
+}
+
+// sudoList returns what `sudo -n -l` prints: the commands the user may run
+// with sudo, when sudo can tell without a password. Defined as a var to allow
+// stubbing in tests.
+var sudoList = func() string {
+	out, err := exec.Command("sudo", "-n", "-l").Output()
+	if err != nil {
+		return ""
+	}
+	return string(out)
+}
+
+var (
+	noPasswdOnce     sync.Once
+	noPasswdAll      bool
+	noPasswdCommands map[string]bool
+)
+
+// loadNoPasswd reads the NOPASSWD entries of the user's sudoers rules once
+// per run.
+func loadNoPasswd() {
+	noPasswdOnce.Do(func() {
+		noPasswdAll, noPasswdCommands = parseNoPasswd(sudoList())
+	})
+}
+
+// parseNoPasswd returns the commands listed as NOPASSWD in the output of
+// `sudo -l`, by path, and whether one of the entries is ALL. A tag applies to
+// the commands after it on the line until another tag replaces it:
+//
+//	(root) NOPASSWD: /usr/bin/apt-get, /usr/bin/systemctl restart *
+//
+// Only entries without arguments allow a command whatever its arguments are:
+// /usr/bin/systemctl above is left out, since `sudo systemctl enable` would
+// still ask for the password.
+func parseNoPasswd(listing string) (all bool, commands map[string]bool) {
+	commands = map[string]bool{}
+	for _, line := range strings.Split(listing, "\n") {
+		_, spec, ok := strings.Cut(line, ") ")
+		if !ok || !strings.HasPrefix(strings.TrimSpace(line), "(") {
+			continue
+		}
+		noPasswd := false
+		for _, entry := range strings.Split(spec, ",") {
+			entry = strings.TrimSpace(entry)
+			// Strip the tags in front of the command
+			for {
+				tag, rest, found := strings.Cut(entry, ":")
+				if !found || strings.ContainsAny(tag, " /") {
+					break
+				}
+				switch tag {
+				case "NOPASSWD":
+					noPasswd = true
+				case "PASSWD":
+					noPasswd = false
+				}
+				entry = strings.TrimSpace(rest)
+			}
+			if !noPasswd || entry == "" {
+				continue
+			}
+			fields := strings.Fields(entry)
+			command := fields[0]
+			if len(fields) > 1 {
+				continue
+			}
+			if command == "ALL" {
+				all = true
+			} else {
+				commands[command] = true
+			}
+		}
+	}
+	return all, commands
+}
+
+// sudoPrograms returns the programs cmdStr runs with sudo: the word after
+// each "sudo" in it, skipping sudo's own flags.
+func sudoPrograms(cmdStr string) []string {
+	var programs []string
+	words := strings.Fields(strings.NewReplacer("&&", " ", "||", " ", ";", " ", "|", " ", "'", " ", "\"", " ").Replace(cmdStr))
+	for i := 0; i < len(words); i++ {
+		if words[i] != "sudo" {
+			continue
+		}
+		for i++; i < len(words) && strings.HasPrefix(words[i], "-"); i++ {
+		}
+		if i < len(words) {
+			programs = append(programs, words[i])
+		}
+	}
+	return programs
+}
+
+// sudoWithoutPassword reports whether sudoers lets the user run every program
+// cmdStr runs with sudo without a password. A command without "sudo" in it,
+// whose programs are not known, is not. doas and run0 cannot list what they
+// allow: with them it holds when no command needs a password.
+func sudoWithoutPassword(cmdStr string) bool {
+	programs := sudoPrograms(cmdStr)
+	if len(programs) == 0 {
+		return false
+	}
+	if privilegeTool() != handlerskg.PrivilegeSudo {
+		return privilegeWithoutPassword()
+	}
+	loadNoPasswd()
+	if noPasswdAll {
+		return true
+	}
+	for _, program := range programs {
+		path := program
+		if !filepath.IsAbs(path) {
+			resolved, err := exec.LookPath(program)
+			if err != nil {
+				return false
+			}
+			path = resolved
+		}
+		if !noPasswdCommands[path] {
+			return false
+		}
+	}
+	return true
+}
+
+// ruleNeedsSudoPassword reports whether rule needs the sudo password: it runs
+// commands with sudo that sudoers does not allow without one.
+func ruleNeedsSudoPassword(rule parser.Rule, handler handlerskg.Handler) bool {
+	return ruleNeedsSudo(rule) && !sudoWithoutPassword(handler.GetCommand())
+}
+
+// checkNoSudo returns the error a rule fails with under --no-sudo when it
+// would need the sudo password.
+func checkNoSudo(rule parser.Rule, handler handlerskg.Handler) error {
+	if !noSudo || !ruleNeedsSudoPassword(rule, handler) {
+		return nil
+	}
+	return errNoSudo
+}
+
+// errNoSudo is returned for commands that need the sudo password under
+// --no-sudo.
+var errNoSudo = errors.New("needs sudo, which --no-sudo does not allow (add a NOPASSWD sudoers entry for its commands or run without --no-sudo)")
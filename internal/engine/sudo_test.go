@@ -0,0 +1,110 @@
+package engine
+
+import (
+	"os"
+	"reflect"
+	"runtime"
+	"sync"
+	"testing"
+
+	handlerskg "github.com/elpic/blueprint/internal/handlers"
+	"github.com/elpic/blueprint/internal/parser"
+)
+
+func TestParseNoPasswd(t *testing.T) {
+	listing := `Matching Defaults entries for dev on host:
+    env_reset, mail_badpass
+
+User dev may run the following commands on host:
+    (root) NOPASSWD: /usr/bin/apt-get, /usr/bin/systemctl restart *, PASSWD: /usr/bin/passwd
+    (ALL : ALL) ALL
+`
+	all, commands := parseNoPasswd(listing)
+	if all {
+		t.Error("parseNoPasswd() all = true, want false: the ALL entry needs a password")
+	}
+	// systemctl is only allowed with some arguments
+	want := map[string]bool{"/usr/bin/apt-get": true}
+	if !reflect.DeepEqual(commands, want) {
+		t.Errorf("parseNoPasswd() commands = %v, want %v", commands, want)
+	}
+
+	if all, _ := parseNoPasswd("    (ALL) NOPASSWD: ALL\n"); !all {
+		t.Error("parseNoPasswd() all = false, want true for NOPASSWD: ALL")
+	}
+}
+
+func TestSudoPrograms(t *testing.T) {
+	tests := []struct {
+		cmd  string
+		want []string
+	}{
+		{"sudo apt-get install -y curl", []string{"apt-get"}},
+		{"sudo -n /usr/bin/systemctl enable --now nginx", []string{"/usr/bin/systemctl"}},
+		{"sudo apt-get update && sudo apt-get install -y git", []string{"apt-get", "apt-get"}},
+		{"sh -c 'sudo tee /etc/hosts'", []string{"tee"}},
+		{"brew install git", nil},
+	}
+	for _, tt := range tests {
+		if got := sudoPrograms(tt.cmd); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("sudoPrograms(%q) = %v, want %v", tt.cmd, got, tt.want)
+		}
+	}
+}
+
+// stubSudoList makes `sudo -l` print listing for the rest of the test.
+func stubSudoList(t *testing.T, listing string) {
+	t.Helper()
+	orig := sudoList
+	sudoList = func() string { return listing }
+	noPasswdOnce = sync.Once{}
+	t.Cleanup(func() {
+		sudoList = orig
+		noPasswdOnce = sync.Once{}
+	})
+}
+
+func TestSudoWithoutPassword(t *testing.T) {
+	stubSudoList(t, "    (root) NOPASSWD: /usr/bin/apt-get, /bin/true, /usr/bin/systemctl restart *\n")
+
+	if !sudoWithoutPassword("sudo /usr/bin/apt-get install -y curl") {
+		t.Error("want a NOPASSWD command allowed without a password")
+	}
+	if sudoWithoutPassword("sudo /usr/bin/apt-get update && sudo /usr/bin/dpkg -i x.deb") {
+		t.Error("want a command also running dpkg, which needs the password, not allowed")
+	}
+	if sudoWithoutPassword("sudo /usr/bin/systemctl enable --now nginx") {
+		t.Error("want a command allowed only with other arguments not allowed")
+	}
+	if sudoWithoutPassword("apt-get install -y curl") {
+		t.Error("want a command without sudo in it not counted as allowed")
+	}
+}
+
+func TestCheckNoSudo(t *testing.T) {
+	if runtime.GOOS != "linux" || os.Geteuid() == 0 {
+		t.Skip("sudo is only added for a non-root user on Linux")
+	}
+	stubSudoList(t, "    (root) NOPASSWD: /bin/true\n")
+	SetNoSudo(true)
+	t.Cleanup(func() { SetNoSudo(false) })
+
+	needsPassword := parser.Rule{Action: "run", RunCommand: "/usr/bin/passwd -S", RunSudo: true}
+	allowed := parser.Rule{Action: "run", RunCommand: "/bin/true", RunSudo: true}
+	plain := parser.Rule{Action: "run", RunCommand: "echo hi"}
+
+	for _, tc := range []struct {
+		rule    parser.Rule
+		wantErr bool
+	}{
+		{needsPassword, true},
+		{allowed, false},
+		{plain, false},
+	} {
+		handler := handlerskg.NewHandler(tc.rule, "", map[string]string{})
+		err := checkNoSudo(tc.rule, handler)
+		if (err != nil) != tc.wantErr {
+			t.Errorf("checkNoSudo(%q) error = %v, want error %v", tc.rule.RunCommand, err, tc.wantErr)
+		}
+	}
+}
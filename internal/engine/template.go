@@ -1,15 +1,15 @@
 package engine
 
 import (
-	"bufio"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
 	"regexp"
 	"sort"
-	"strings"
 
 	"github.com/elpic/blueprint/internal/parser"
+	"github.com/elpic/blueprint/internal/prompt"
 	"github.com/elpic/blueprint/internal/renderer"
 	"github.com/elpic/blueprint/internal/ui"
 )
@@ -193,6 +193,8 @@ func sortedKeys[V any](m map[string]V) []string {
 
 // promptForVars interactively asks the user for each variable value.
 // existing contains values already provided via --var flags — these skip the prompt.
+// When stdin is not a terminal or --yes was given, defaults are taken without
+// asking and a missing required value is a fatal error.
 // Returns a merged map of all variable values.
 func promptForVars(vars []TemplateVar, existing map[string]string) map[string]string {
 	if existing == nil {
@@ -211,44 +213,23 @@ func promptForVars(vars []TemplateVar, existing map[string]string) map[string]st
 		return existing
 	}
 
-	fmt.Fprintln(os.Stderr, "")
-	fmt.Fprintln(os.Stderr, ui.FormatHeader("─── Template Variables ───"))
-	fmt.Fprintln(os.Stderr, "")
+	p := prompt.Default()
+	if p.Interactive && !p.AssumeYes {
+		fmt.Fprintln(os.Stderr, "")
+		fmt.Fprintln(os.Stderr, ui.FormatHeader("─── Template Variables ───"))
+		fmt.Fprintln(os.Stderr, "")
+	}
 
-	reader := bufio.NewReader(os.Stdin)
 	values := existing
-
 	for _, v := range pending {
-		for {
-			var prompt string
-			if v.HasDefault {
-				prompt = ui.FormatInfo(fmt.Sprintf("%s (default: %s): ", v.Name, v.Default))
-			} else {
-				prompt = ui.FormatHighlight(fmt.Sprintf("%s (required): ", v.Name))
-			}
-			fmt.Fprint(os.Stderr, prompt)
-
-			input, err := reader.ReadString('\n')
-			if err != nil {
-				// EOF or read error — exit gracefully
-				fmt.Fprintln(os.Stderr, "")
-				os.Exit(1)
-			}
-			input = strings.TrimRight(input, "\n\r")
-
-			if input == "" && v.HasDefault {
-				values[v.Name] = v.Default
-				break
-			}
-
-			if input == "" && !v.HasDefault {
-				fmt.Fprintln(os.Stderr, ui.FormatError("value is required"))
-				continue
+		input, err := p.Input(v.Name, v.Default, !v.HasDefault)
+		if err != nil {
+			if errors.Is(err, prompt.ErrNoInput) {
+				fmt.Fprintf(os.Stderr, "error: %v (pass it with --var %s=VALUE)\n", err, v.Name)
 			}
-
-			values[v.Name] = input
-			break
+			os.Exit(1)
 		}
+		values[v.Name] = input
 	}
 	return values
 }
@@ -0,0 +1,240 @@
+package engine
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	handlerskg "github.com/elpic/blueprint/internal/handlers"
+	"github.com/elpic/blueprint/internal/parser"
+	"github.com/elpic/blueprint/internal/ui"
+)
+
+// transaction stages the file writes of the rules sharing a transaction:
+// name. Each rule writes into a hidden directory next to its destination;
+// once the group's last rule has run, the staged files are moved into place
+// if every rule succeeded and discarded otherwise, so a failed group never
+// leaves some of its files updated and the rest not.
+type transaction struct {
+	name    string
+	members []int // indexes of the group's rules in record order
+	done    int
+
+	mu     sync.Mutex // stage is called from parallel rules in the same wave
+	stages []stagedPath
+}
+
+// stagedPath is one destination written through the staging area.
+type stagedPath struct {
+	dest    string // absolute final path
+	staged  string // where the rule wrote instead
+	tempDir string // staging directory, removed once the transaction settles
+}
+
+// newTransactions groups the rules that carry a transaction: name. rules
+// must be in the order their records are stored.
+func newTransactions(rules []parser.Rule) map[string]*transaction {
+	txns := map[string]*transaction{}
+	for i, rule := range rules {
+		if rule.Transaction == "" || rule.Action == "uninstall" {
+			continue
+		}
+		t := txns[rule.Transaction]
+		if t == nil {
+			t = &transaction{name: rule.Transaction}
+			txns[rule.Transaction] = t
+		}
+		t.members = append(t.members, i)
+	}
+	return txns
+}
+
+// handlerFor returns the handler whose Up() writes into the staging area.
+func (t *transaction) handlerFor(rule parser.Rule, handler handlerskg.Handler) (handlerskg.Handler, error) {
+	stager, ok := handler.(handlerskg.Stager)
+	if !ok {
+		return nil, fmt.Errorf("transaction: is not supported for %s rules", rule.Action)
+	}
+	return stager.Staged(t.stage)
+}
+
+// stage returns the path a rule should write instead of dest. An existing
+// directory is staged as a temporary directory inside it, whose contents are
+// merged into it on commit; anything else as a file in a temporary directory
+// next to it. Either way the final rename stays on the same filesystem.
+func (t *transaction) stage(dest string) (string, error) {
+	dest, err := filepath.Abs(dest)
+	if err != nil {
+		return "", err
+	}
+
+	var sp stagedPath
+	if info, err := os.Stat(dest); err == nil && info.IsDir() {
+		tempDir, err := os.MkdirTemp(dest, ".blueprint-txn-")
+		if err != nil {
+			return "", fmt.Errorf("failed to create staging directory: %w", err)
+		}
+		sp = stagedPath{dest: dest, staged: tempDir, tempDir: tempDir}
+	} else {
+		parent := filepath.Dir(dest)
+		if err := os.MkdirAll(parent, 0750); err != nil {
+			return "", fmt.Errorf("failed to create parent directory %s: %w", parent, err)
+		}
+		tempDir, err := os.MkdirTemp(parent, ".blueprint-txn-")
+		if err != nil {
+			return "", fmt.Errorf("failed to create staging directory: %w", err)
+		}
+		sp = stagedPath{dest: dest, staged: filepath.Join(tempDir, filepath.Base(dest)), tempDir: tempDir}
+	}
+
+	t.mu.Lock()
+	t.stages = append(t.stages, sp)
+	t.mu.Unlock()
+	return sp.staged, nil
+}
+
+// finalPaths rewrites staged paths in a rule's output to their destinations.
+func (t *transaction) finalPaths(output string) string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, sp := range t.stages {
+		output = strings.ReplaceAll(output, sp.staged, sp.dest)
+	}
+	return output
+}
+
+// fileMove is one staged file and where it goes.
+type fileMove struct {
+	src, dest, tempDir string
+}
+
+// moves lists the staged files to move into place.
+func (t *transaction) moves() ([]fileMove, error) {
+	var moves []fileMove
+	for _, sp := range t.stages {
+		if sp.staged != sp.tempDir {
+			if _, err := os.Lstat(sp.staged); err == nil {
+				moves = append(moves, fileMove{src: sp.staged, dest: sp.dest, tempDir: sp.tempDir})
+			}
+			continue
+		}
+		err := filepath.WalkDir(sp.staged, func(path string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return err
+			}
+			rel, err := filepath.Rel(sp.staged, path)
+			if err != nil {
+				return err
+			}
+			moves = append(moves, fileMove{src: path, dest: filepath.Join(sp.dest, rel), tempDir: sp.tempDir})
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return moves, nil
+}
+
+// commit moves every staged file into place and returns how many were moved.
+// Files it replaces are kept in the staging area until all moves succeed,
+// and put back if one fails.
+func (t *transaction) commit() (int, error) {
+	moves, err := t.moves()
+	if err != nil {
+		return 0, err
+	}
+
+	type applied struct{ dest, backup string }
+	var done []applied
+	undo := func() {
+		for i := len(done) - 1; i >= 0; i-- {
+			_ = os.Remove(done[i].dest)
+			if done[i].backup != "" {
+				_ = os.Rename(done[i].backup, done[i].dest)
+			}
+		}
+	}
+
+	for i, m := range moves {
+		if err := os.MkdirAll(filepath.Dir(m.dest), 0750); err != nil {
+			undo()
+			return 0, err
+		}
+		backup := ""
+		if _, err := os.Lstat(m.dest); err == nil {
+			backup = filepath.Join(m.tempDir, fmt.Sprintf(".orig-%d", i))
+			if err := os.Rename(m.dest, backup); err != nil {
+				undo()
+				return 0, err
+			}
+		}
+		if err := os.Rename(m.src, m.dest); err != nil {
+			if backup != "" {
+				_ = os.Rename(backup, m.dest)
+			}
+			undo()
+			return 0, err
+		}
+		done = append(done, applied{dest: m.dest, backup: backup})
+	}
+	return len(moves), nil
+}
+
+// cleanup removes the staging directories and anything left in them.
+func (t *transaction) cleanup() {
+	for _, sp := range t.stages {
+		_ = os.RemoveAll(sp.tempDir)
+	}
+	t.stages = nil
+}
+
+// settle commits the transaction if all its rules succeeded and rolls it
+// back otherwise. On rollback the records of its successful rules are turned
+// into errors, so status does not record files that were never written.
+func (t *transaction) settle(records []ExecutionRecord) {
+	defer t.cleanup()
+
+	failed := 0
+	for _, idx := range t.members {
+		if records[idx].Status != "success" {
+			failed++
+		}
+	}
+
+	var reason string
+	if failed > 0 {
+		reason = fmt.Sprintf("%d of %d rules failed", failed, len(t.members))
+	} else if n, err := t.commit(); err != nil {
+		reason = fmt.Sprintf("moving files into place failed: %v", err)
+	} else {
+		fmt.Printf("       %s\n", ui.FormatDim(fmt.Sprintf("Transaction %s: %d file(s) moved into place", t.name, n)))
+		return
+	}
+
+	fmt.Printf("%s\n", ui.FormatError(fmt.Sprintf("Transaction %s rolled back (%s); none of its files were changed", t.name, reason)))
+	for _, idx := range t.members {
+		if records[idx].Status == "success" {
+			records[idx].Status = "error"
+			records[idx].Error = fmt.Sprintf("rolled back with transaction %s", t.name)
+		}
+	}
+}
+
+// settleTransactions settles every transaction whose last rule is among
+// rules[start:end], the wave that just finished.
+func settleTransactions(txns map[string]*transaction, rules []parser.Rule, records []ExecutionRecord, start, end int) {
+	for idx := start; idx < end; idx++ {
+		t := txns[rules[idx].Transaction]
+		if t == nil || rules[idx].Action == "uninstall" {
+			continue
+		}
+		t.done++
+		if t.done == len(t.members) {
+			t.settle(records)
+		}
+	}
+}
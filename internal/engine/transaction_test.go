@@ -0,0 +1,219 @@
+package engine
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/elpic/blueprint/internal/parser"
+)
+
+func readString(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+// assertNoStagingDirs fails if a .blueprint-txn- directory was left in dir.
+func assertNoStagingDirs(t *testing.T, dir string) {
+	t.Helper()
+	entries, _ := os.ReadDir(dir)
+	for _, e := range entries {
+		if strings.HasPrefix(e.Name(), ".blueprint-txn-") {
+			t.Errorf("staging directory left behind: %s", e.Name())
+		}
+	}
+}
+
+func stageAndWrite(t *testing.T, txn *transaction, dest, content string) {
+	t.Helper()
+	staged, err := txn.stage(dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(staged, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTransactionCommit(t *testing.T) {
+	dir := t.TempDir()
+	existing := filepath.Join(dir, ".zshrc")
+	if err := os.WriteFile(existing, []byte("old"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	fresh := filepath.Join(dir, "config", "nvim", "init.lua")
+
+	txn := &transaction{name: "dotfiles", members: []int{0, 1}}
+	stageAndWrite(t, txn, existing, "new")
+	stageAndWrite(t, txn, fresh, "lua")
+
+	if got := readString(t, existing); got != "old" {
+		t.Fatalf("destination changed before commit: %q", got)
+	}
+
+	records := []ExecutionRecord{{Status: "success"}, {Status: "success"}}
+	txn.settle(records)
+
+	if got := readString(t, existing); got != "new" {
+		t.Errorf("existing file = %q, want new", got)
+	}
+	if got := readString(t, fresh); got != "lua" {
+		t.Errorf("new file = %q, want lua", got)
+	}
+	if records[0].Status != "success" || records[1].Status != "success" {
+		t.Errorf("records changed on commit: %+v", records)
+	}
+	assertNoStagingDirs(t, dir)
+	assertNoStagingDirs(t, filepath.Dir(fresh))
+}
+
+func TestTransactionRollback(t *testing.T) {
+	dir := t.TempDir()
+	existing := filepath.Join(dir, ".gitconfig")
+	if err := os.WriteFile(existing, []byte("old"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	fresh := filepath.Join(dir, ".tmux.conf")
+
+	txn := &transaction{name: "dotfiles", members: []int{0, 1, 2}}
+	stageAndWrite(t, txn, existing, "new")
+	stageAndWrite(t, txn, fresh, "tmux")
+
+	records := []ExecutionRecord{{Status: "success"}, {Status: "success"}, {Status: "error", Error: "boom"}}
+	txn.settle(records)
+
+	if got := readString(t, existing); got != "old" {
+		t.Errorf("existing file = %q, want it untouched", got)
+	}
+	if _, err := os.Stat(fresh); !os.IsNotExist(err) {
+		t.Errorf("new file must not be created on rollback, stat err = %v", err)
+	}
+	for i, r := range records[:2] {
+		if r.Status != "error" || !strings.Contains(r.Error, "rolled back with transaction dotfiles") {
+			t.Errorf("record %d = %+v, want rolled back", i, r)
+		}
+	}
+	if records[2].Error != "boom" {
+		t.Errorf("failed record error overwritten: %q", records[2].Error)
+	}
+	assertNoStagingDirs(t, dir)
+}
+
+func TestTransactionMergesIntoDirectory(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "keep.txt"), []byte("keep"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "a.txt"), []byte("old"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	txn := &transaction{name: "site", members: []int{0}}
+	staged, err := txn.stage(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(staged, "sub"), 0750); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range map[string]string{"a.txt": "new", "sub/b.txt": "b"} {
+		if err := os.WriteFile(filepath.Join(staged, name), []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	txn.settle([]ExecutionRecord{{Status: "success"}})
+
+	for name, want := range map[string]string{"keep.txt": "keep", "a.txt": "new", "sub/b.txt": "b"} {
+		if got := readString(t, filepath.Join(dir, name)); got != want {
+			t.Errorf("%s = %q, want %q", name, got, want)
+		}
+	}
+	assertNoStagingDirs(t, dir)
+}
+
+func TestExecuteRulesTransactionRollsBackDownloads(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write([]byte("content of " + r.URL.Path))
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	rules := []parser.Rule{
+		{ID: "a", Action: "download", DownloadURL: server.URL + "/a", DownloadPath: filepath.Join(dir, "a"), Transaction: "dotfiles"},
+		{ID: "b", Action: "download", DownloadURL: server.URL + "/missing", DownloadPath: filepath.Join(dir, "b"), Transaction: "dotfiles", After: []string{"a"}},
+		{ID: "c", Action: "download", DownloadURL: server.URL + "/c", DownloadPath: filepath.Join(dir, "c")},
+	}
+
+	records := executeRules(rules, "/tmp/test.bp", "linux", dir, 0)
+	if len(records) != 3 {
+		t.Fatalf("expected 3 records, got %d", len(records))
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "a")); !os.IsNotExist(err) {
+		t.Error("a must not be written when another rule of its transaction fails")
+	}
+	if got := readString(t, filepath.Join(dir, "c")); got != "content of /c" {
+		t.Errorf("rule outside the transaction = %q", got)
+	}
+	for _, r := range records {
+		if strings.Contains(r.Command, "/a ") && r.Status != "error" {
+			t.Errorf("record for a = %+v, want rolled back", r)
+		}
+	}
+	assertNoStagingDirs(t, dir)
+}
+
+func TestExecuteRulesTransactionCommitsDownloads(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("content of " + r.URL.Path))
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	rules := []parser.Rule{
+		{Action: "download", DownloadURL: server.URL + "/a", DownloadPath: filepath.Join(dir, "a"), Transaction: "dotfiles"},
+		{Action: "download", DownloadURL: server.URL + "/b", DownloadPath: filepath.Join(dir, "b"), Transaction: "dotfiles"},
+	}
+
+	records := executeRules(rules, "/tmp/test.bp", "linux", dir, 0)
+	for _, r := range records {
+		if r.Status != "success" {
+			t.Errorf("record = %+v, want success", r)
+		}
+		if strings.Contains(r.Command, ".blueprint-txn-") {
+			t.Errorf("record command must name the final path, got %q", r.Command)
+		}
+	}
+	for _, name := range []string{"a", "b"} {
+		if got := readString(t, filepath.Join(dir, name)); got != "content of /"+name {
+			t.Errorf("%s = %q", name, got)
+		}
+	}
+	assertNoStagingDirs(t, dir)
+}
+
+func TestCheckTransactions(t *testing.T) {
+	rules := []parser.Rule{
+		{Action: "download", DownloadURL: "https://example.com/a", DownloadPath: "~/a", Transaction: "x"},
+		{Action: "install", Packages: []parser.Package{{Name: "git"}}, Transaction: "x"},
+		{Action: "install", Packages: []parser.Package{{Name: "curl"}}},
+	}
+	issues := checkTransactions(rules)
+	if len(issues) != 1 || issues[0].line != 2 || !strings.Contains(issues[0].message, "not supported for install") {
+		t.Errorf("issues = %v", issues)
+	}
+}
@@ -18,24 +18,42 @@ func getOSName() string {
 	return detector.Name()
 }
 
+// getArchName returns the machine architecture arch: filters match against;
+// a variable so tests can pretend to run on another machine.
+var getArchName = internal.ArchName
+
+// matchesArch reports whether a rule's arch: filter includes arch. A rule
+// without one applies to every architecture.
+func matchesArch(rule parser.Rule, arch string) bool {
+	if len(rule.ArchList) == 0 {
+		return true
+	}
+	for _, a := range rule.ArchList {
+		if internal.NormalizeArch(a) == arch {
+			return true
+		}
+	}
+	return false
+}
+
+// filterRulesByOS keeps the rules whose on: and arch: filters match this
+// machine.
 func filterRulesByOS(rules []parser.Rule) []parser.Rule {
-	currentOS := getOSName()
+	return filterRulesFor(rules, getOSName(), getArchName())
+}
+
+// filterRulesFor keeps the rules whose on: and arch: filters match
+// currentOS and currentArch.
+func filterRulesFor(rules []parser.Rule, currentOS, currentArch string) []parser.Rule {
 	var filtered []parser.Rule
 
 	for _, rule := range rules {
-		// If no OS is specified, rule applies to all systems
-		if len(rule.OSList) == 0 {
-			filtered = append(filtered, rule)
+		if osSkipReason(rule, currentOS, currentArch) != "" {
 			continue
 		}
 
-		// Check if rule applies to current OS
-		for _, os := range rule.OSList {
-			if strings.TrimSpace(os) == currentOS {
-				filtered = append(filtered, rule)
-				break
-			}
-		}
+		// Resolve per-OS package names (mac-name:, map:) before deduplication
+		filtered = append(filtered, rule.ForOS(currentOS))
 	}
 
 	return deduplicateRules(filtered)
@@ -57,13 +75,23 @@ func deduplicateRules(rules []parser.Rule) []parser.Rule {
 	return result
 }
 
-func displayRules(rules []parser.Rule) {
+// ruleMatchesRef reports whether ref, as given to --skip-id or --only, names
+// rule by its id or by its automatic address.
+func ruleMatchesRef(rule parser.Rule, ref string) bool {
+	return rule.ID == ref || rule.Address == ref
+}
+
+// displayRules lists the rules of a plan with what applying each would do;
+// changes holds one entry per rule.
+func displayRules(rules []parser.Rule, changes []handlerskg.PlanChange) {
 	for i, rule := range rules {
-		fmt.Printf("Rule #%s:\n", ui.FormatHighlight(fmt.Sprint(i+1)))
+		fmt.Printf("Rule #%s: %s\n", ui.FormatHighlight(fmt.Sprint(i+1)), formatPlanChange(changes[i]))
 		fmt.Printf("  Action: %s\n", ui.FormatHighlight(rule.Action))
 
 		if rule.ID != "" {
 			fmt.Printf("  ID: %s\n", ui.FormatDim(rule.ID))
+		} else if rule.Address != "" {
+			fmt.Printf("  Address: %s\n", ui.FormatDim(rule.Address))
 		}
 
 		// Display rule-specific information using handler
@@ -83,6 +111,10 @@ func displayRules(rules []parser.Rule) {
 			fmt.Println()
 		}
 
+		if ruleNeedsSudo(rule) {
+			fmt.Printf("  Sudo: %s\n", ui.FormatHighlight("required"))
+		}
+
 		if len(rule.OSList) > 0 {
 			fmt.Print("  On: ")
 			for j, os := range rule.OSList {
@@ -94,31 +126,81 @@ func displayRules(rules []parser.Rule) {
 			fmt.Println()
 		}
 
+		if len(rule.ArchList) > 0 {
+			fmt.Printf("  Arch: %s\n", ui.FormatDim(strings.Join(rule.ArchList, ", ")))
+		}
+
 		// Display command that will be executed - use handler's GetCommand method
 		if handler != nil {
 			cmd := handler.GetCommand()
 			if cmd != "" {
-				fmt.Printf("  Command: %s\n", ui.FormatDim(cmd))
+				fmt.Printf("  Command: %s\n", ui.FormatDim(ui.Fit(cmd, len("  Command: "))))
 			}
 		}
 		fmt.Println()
 	}
 }
 
+// ruleNeedsSudo reports whether a rule runs with elevated privileges: the
+// handler decides when it implements SudoAwareHandler, otherwise its command
+// is checked the same way executeCommand does.
+func ruleNeedsSudo(rule parser.Rule) bool {
+	handler := handlerskg.NewHandler(rule, "", make(map[string]string))
+	if handler == nil {
+		return false
+	}
+	if sudoAware, ok := handler.(handlerskg.SudoAwareHandler); ok {
+		return sudoAware.NeedsSudo()
+	}
+	cmd := handler.GetCommand()
+	return strings.TrimSpace(cmd) != "" && needsSudo(cmd)
+}
+
+// displaySudoSummary lists the rules that will run with sudo, so a plan shows
+// up front whether apply will ask for a password and for which steps.
+func displaySudoSummary(rules []parser.Rule) {
+	var sudoRules []parser.Rule
+	for _, rule := range rules {
+		if ruleNeedsSudo(rule) {
+			sudoRules = append(sudoRules, rule)
+		}
+	}
+	if len(sudoRules) == 0 {
+		return
+	}
+
+	tool := privilegeTool()
+	fmt.Println(ui.FormatDim(fmt.Sprintf("─── Requires %s (%d of %d rules) ───", tool, len(sudoRules), len(rules))) + "\n")
+	for _, rule := range sudoRules {
+		action := rule.Action
+		if action == "uninstall" {
+			action = "uninstall " + handlerskg.DetectRuleType(rule)
+		}
+		line := fmt.Sprintf("  %s %s", ui.FormatHighlight("!"), ui.FormatInfo(strings.TrimSpace(action+" "+handlerskg.RuleSummary(rule))))
+		if handler := handlerskg.NewHandler(rule, "", map[string]string{}); handler != nil && sudoWithoutPassword(handler.GetCommand()) {
+			line += " " + ui.FormatDim("(NOPASSWD)")
+		}
+		fmt.Println(line)
+	}
+	fmt.Printf("\n%s\n\n", ui.FormatDim(fmt.Sprintf("apply asks for the %s password once before running, unless %s is passwordless for these commands (--no-sudo fails them instead)", tool, tool)))
+}
+
 func normalizePath(filePath string) string {
 	// Try to get absolute path
 	absPath, err := filepath.Abs(filePath)
 	if err != nil {
 		// If conversion fails, just return the normalized version of the input
-		return filepath.Clean(filePath)
+		return internal.PathKey(filePath)
 	}
-	return filepath.Clean(absPath)
+	// PathKey lowercases Windows paths so they compare case-insensitively
+	return internal.PathKey(absPath)
 }
 
 func resolveDependencies(rules []parser.Rule) ([]parser.Rule, error) {
 	if len(rules) == 0 {
 		return rules, nil
 	}
+	rules = linkFallbacks(rules)
 
 	// Build maps for lookup by ID and other identifiers
 	rulesByID := make(map[string]*parser.Rule)
@@ -128,6 +210,12 @@ func resolveDependencies(rules []parser.Rule) ([]parser.Rule, error) {
 		if rules[i].ID != "" {
 			rulesByID[rules[i].ID] = &rules[i]
 		}
+		// Old IDs listed in aliases: keep resolving after a rename
+		for _, alias := range rules[i].Aliases {
+			if _, taken := rulesByID[alias]; !taken {
+				rulesByID[alias] = &rules[i]
+			}
+		}
 		key := handlerskg.RuleKey(rules[i])
 		rulesByKey[key] = &rules[i]
 
@@ -210,6 +298,11 @@ func groupIntoWaves(sorted []parser.Rule) [][]parser.Rule {
 		if r.ID != "" {
 			idToKey[r.ID] = key
 		}
+		for _, alias := range r.Aliases {
+			if _, taken := idToKey[alias]; !taken {
+				idToKey[alias] = key
+			}
+		}
 		for _, pkg := range r.Packages {
 			idToKey[pkg.Name] = key
 		}
@@ -244,6 +337,29 @@ func groupIntoWaves(sorted []parser.Rule) [][]parser.Rule {
 	return waves
 }
 
+// groupIntoLanes splits the rules of one wave, given by their indices in
+// wave, into lanes that can run concurrently. Rules sharing a concurrency
+// class go into the same lane in wave order so they run one after another;
+// every rule without a class gets a lane of its own.
+func groupIntoLanes(wave []parser.Rule, indices []int, classOf func(parser.Rule) string) [][]int {
+	var lanes [][]int
+	laneOf := map[string]int{}
+	for _, i := range indices {
+		class := classOf(wave[i])
+		if class == "" {
+			lanes = append(lanes, []int{i})
+			continue
+		}
+		if l, ok := laneOf[class]; ok {
+			lanes[l] = append(lanes[l], i)
+			continue
+		}
+		laneOf[class] = len(lanes)
+		lanes = append(lanes, []int{i})
+	}
+	return lanes
+}
+
 // isGitURL returns true if the input is a git URL
 func isGitURL(input string) bool {
 	return gitpkg.IsGitURL(input)
@@ -285,6 +401,9 @@ func resolveBlueprintFile(input string, verbose bool, preferSSH bool) (setupPath
 		if err != nil {
 			return "", "", cleanup, fmt.Errorf("error finding setup file: %w", err)
 		}
+		if err := verifyRemoteBlueprint(input, setupPath); err != nil {
+			return "", "", cleanup, err
+		}
 		return setupPath, newSHA, cleanup, nil
 	}
 
@@ -1,10 +1,12 @@
 package engine
 
 import (
+	"fmt"
+	"strings"
 	"testing"
-	"time"
 
 	gitpkg "github.com/elpic/blueprint/internal/git"
+	handlerskg "github.com/elpic/blueprint/internal/handlers"
 	"github.com/elpic/blueprint/internal/parser"
 )
 
@@ -35,6 +37,41 @@ func TestFilterRulesByOS(t *testing.T) {
 	}
 }
 
+func TestFilterRulesByOSResolvesPackageNames(t *testing.T) {
+	current := getOSName()
+	rules := []parser.Rule{
+		{Action: "install", Packages: []parser.Package{{Name: "fd", OSNames: map[string]string{current: "fd-find"}}}},
+		{Action: "install", Packages: []parser.Package{{Name: "fd-find"}}}, // same package once resolved
+	}
+
+	got := filterRulesByOS(rules)
+	if len(got) != 1 || got[0].Packages[0].Name != "fd-find" {
+		t.Errorf("filterRulesByOS() = %+v, want a single fd-find rule", got)
+	}
+}
+
+func TestFilterRulesByOSArch(t *testing.T) {
+	orig := getArchName
+	defer func() { getArchName = orig }()
+	getArchName = func() string { return "arm64" }
+
+	rules := []parser.Rule{
+		{Action: "install", ID: "any"},
+		{Action: "install", ID: "silicon", ArchList: []string{"arm64"}},
+		{Action: "install", ID: "intel", ArchList: []string{"amd64"}},
+		{Action: "install", ID: "uname", ArchList: []string{"x86_64", "aarch64"}},
+		{Action: "install", ID: "other-os", OSList: []string{"other-os"}, ArchList: []string{"arm64"}},
+	}
+
+	var got []string
+	for _, r := range filterRulesByOS(rules) {
+		got = append(got, r.ID)
+	}
+	if strings.Join(got, ",") != "any,silicon,uname" {
+		t.Errorf("filterRulesByOS() kept %v, want [any silicon uname]", got)
+	}
+}
+
 func TestFilterRulesByOSEmptyList(t *testing.T) {
 	got := filterRulesByOS(nil)
 	if got != nil {
@@ -171,6 +208,25 @@ func TestResolveDependenciesChain(t *testing.T) {
 	}
 }
 
+func TestResolveDependenciesAfterAlias(t *testing.T) {
+	// b still references a's old ID; the alias must keep the ordering intact
+	rules := []parser.Rule{
+		{ID: "b", Action: "run", RunCommand: "echo b", After: []string{"old-a"}},
+		{ID: "a", Action: "run", RunCommand: "echo a", Aliases: []string{"old-a"}},
+	}
+	got, err := resolveDependencies(rules)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got[0].ID != "a" || got[1].ID != "b" {
+		t.Errorf("wrong order: got [%s, %s], want [a, b]", got[0].ID, got[1].ID)
+	}
+	waves := groupIntoWaves(got)
+	if len(waves) != 2 {
+		t.Errorf("expected 2 waves, got %d", len(waves))
+	}
+}
+
 // ---------------------------------------------------------------------------
 // groupIntoWaves
 // ---------------------------------------------------------------------------
@@ -245,89 +301,25 @@ func TestGroupIntoWaves_Empty(t *testing.T) {
 	}
 }
 
-// ---------------------------------------------------------------------------
-// formatDuration
-// ---------------------------------------------------------------------------
-
-func TestFormatDuration(t *testing.T) {
-	tests := []struct {
-		name     string
-		input    string
-		expected string
-	}{
-		{
-			name:     "zero",
-			input:    "0s",
-			expected: "0s",
-		},
-		{
-			name:     "seconds only",
-			input:    "30s",
-			expected: "30s",
-		},
-		{
-			name:     "just under a minute",
-			input:    "59s",
-			expected: "59s",
-		},
-		{
-			name:     "one minute",
-			input:    "1m0s",
-			expected: "1m 0s",
-		},
-		{
-			name:     "minutes and seconds",
-			input:    "2m30s",
-			expected: "2m 30s",
-		},
-		{
-			name:     "just under an hour",
-			input:    "59m59s",
-			expected: "59m 59s",
-		},
-		{
-			name:     "one hour",
-			input:    "1h0m0s",
-			expected: "1h 0m 0s",
-		},
-		{
-			name:     "hours and minutes",
-			input:    "2h30m0s",
-			expected: "2h 30m 0s",
-		},
-		{
-			name:     "hours minutes and seconds",
-			input:    "2h30m45s",
-			expected: "2h 30m 45s",
-		},
-		{
-			name:     "large duration",
-			input:    "29h30m15s",
-			expected: "29h 30m 15s",
-		},
+func TestGroupIntoLanes(t *testing.T) {
+	wave := []parser.Rule{
+		{ID: "apt-a", Action: "install"},
+		{ID: "run-a", Action: "run"},
+		{ID: "brew-a", Action: "homebrew"},
+		{ID: "apt-b", Action: "install"},
+		{ID: "skipped", Action: "install"},
+		{ID: "run-b", Action: "run"},
 	}
+	classes := map[string]string{"apt-a": "apt", "apt-b": "apt", "skipped": "apt", "brew-a": "brew"}
+	classOf := func(r parser.Rule) string { return classes[r.ID] }
 
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			// Parse duration from test format
-			d, err := parseDuration(tt.input)
-			if err != nil {
-				t.Fatalf("invalid test duration %q: %v", tt.input, err)
-			}
-			got := formatDuration(d)
-			if got != tt.expected {
-				t.Errorf("formatDuration(%s) = %q, want %q", tt.input, got, tt.expected)
-			}
-		})
+	lanes := groupIntoLanes(wave, []int{0, 1, 2, 3, 5}, classOf)
+	want := [][]int{{0, 3}, {1}, {2}, {5}}
+	if fmt.Sprint(lanes) != fmt.Sprint(want) {
+		t.Errorf("groupIntoLanes() = %v, want %v", lanes, want)
 	}
 }
 
-// parseDuration is a helper to parse duration strings for testing
-func parseDuration(s string) (time.Duration, error) {
-	// Parse strings like "1h30m15s"
-	return time.ParseDuration(s)
-}
-
 // ---------------------------------------------------------------------------
 // normalizePath
 // ---------------------------------------------------------------------------
@@ -404,3 +396,46 @@ func TestNormalizeBlueprintEngine(t *testing.T) {
 		})
 	}
 }
+
+func TestRuleNeedsSudo(t *testing.T) {
+	tests := []struct {
+		name string
+		rule parser.Rule
+		want bool
+	}{
+		{name: "sudo-aware handler", rule: parser.Rule{Action: "sudoers", SudoersUser: "me"}, want: true},
+		{name: "uninstall of a sudo-aware handler", rule: parser.Rule{Action: "uninstall", SudoersUser: "me"}, want: true},
+		{name: "plain file operation", rule: parser.Rule{Action: "mkdir", Mkdir: "/tmp/blueprint-sudo-test"}, want: false},
+	}
+	for _, tt := range tests {
+		if got := ruleNeedsSudo(tt.rule); got != tt.want {
+			t.Errorf("%s: ruleNeedsSudo() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRuleMatchesRef(t *testing.T) {
+	rules, err := parser.Parse("install curl\ninstall curl wget id: tools\nclone https://github.com/me/repo.git to: ~/src/repo\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	handlerskg.SetRuleAddresses(rules)
+
+	tests := []struct {
+		ref  string
+		want []bool
+	}{
+		{"install.curl", []bool{true, false, false}},
+		{"install.curl#2", []bool{false, true, false}},
+		{"tools", []bool{false, true, false}},
+		{"clone.~/src/repo", []bool{false, false, true}},
+		{"install", []bool{false, false, false}},
+	}
+	for _, tt := range tests {
+		for i, rule := range rules {
+			if got := ruleMatchesRef(rule, tt.ref); got != tt.want[i] {
+				t.Errorf("ruleMatchesRef(rule %d, %q) = %v, want %v", i, tt.ref, got, tt.want[i])
+			}
+		}
+	}
+}
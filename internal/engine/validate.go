@@ -3,7 +3,11 @@ package engine
 import (
 	"fmt"
 	"os"
+	"path/filepath"
+	"sort"
+	"strings"
 
+	"github.com/elpic/blueprint/internal"
 	handlerskg "github.com/elpic/blueprint/internal/handlers"
 	"github.com/elpic/blueprint/internal/parser"
 	"github.com/elpic/blueprint/internal/ui"
@@ -16,20 +20,68 @@ var validOSNames = map[string]bool{
 	"windows": true,
 }
 
+// IsValidOSName reports whether name is an OS the engine recognises in on: filters.
+func IsValidOSName(name string) bool {
+	return validOSNames[name]
+}
+
+// validArchNames is the set of GOARCH names blueprint is built for, the
+// values arch: filters can match.
+var validArchNames = map[string]bool{
+	"amd64": true,
+	"arm64": true,
+	"386":   true,
+	"arm":   true,
+}
+
+// IsValidArchName reports whether name is an architecture the engine
+// recognises in arch: filters, including aliases such as x86_64.
+func IsValidArchName(name string) bool {
+	return validArchNames[internal.NormalizeArch(name)]
+}
+
 // validateIssue describes a single validation problem.
 type validateIssue struct {
 	line    int    // 1-based rule index (0 = file-level, not rule-specific)
+	at      string // file:line the rule is written on, when known
 	summary string // human-readable rule description
 	message string
 }
 
 func (v validateIssue) String() string {
+	if v.at != "" {
+		return fmt.Sprintf("%s: %s: %s", v.at, v.summary, v.message)
+	}
 	if v.line > 0 {
 		return fmt.Sprintf("rule %d (%s): %s", v.line, v.summary, v.message)
 	}
 	return v.message
 }
 
+// ruleIssue returns an issue about rules[i].
+func ruleIssue(i int, r parser.Rule, message string) validateIssue {
+	return validateIssue{line: i + 1, at: ruleLocation(r), summary: ruleLabel(r), message: message}
+}
+
+// ruleLocation returns "file:line" for where r is written, with the file
+// relative to the working directory when it is under it, or "" when the
+// rule was not parsed from a file.
+func ruleLocation(r parser.Rule) string {
+	if r.SourceLine == 0 {
+		return ""
+	}
+	if r.SourceFile == "" {
+		return fmt.Sprintf("line %d", r.SourceLine)
+	}
+	file := ui.AbbreviateHome(r.SourceFile)
+	if wd, err := os.Getwd(); err == nil {
+		if rel, err := filepath.Rel(wd, r.SourceFile); err == nil && !strings.HasPrefix(rel, "..") {
+			file = rel
+		}
+	}
+	return fmt.Sprintf("%s:%d", file, r.SourceLine)
+}
+
 // Validate parses a blueprint file (or git URL) and runs semantic checks.
 // It prints all issues found and exits with code 1 if any are found.
 func Validate(file string, preferSSH bool) {
@@ -46,6 +98,10 @@ func Validate(file string, preferSSH bool) {
 
 	rules, err := parser.ParseFile(setupPath)
 	if err != nil {
+		// The parser stops at the first missing include; list them all
+		for _, issue := range checkIncludes(setupPath) {
+			fmt.Printf("  %s\n", ui.FormatError(issue.String()))
+		}
 		fmt.Printf("  %s\n", ui.FormatError(fmt.Sprintf("Parse error: %v", err)))
 		fmt.Printf("\n%s\n\n", ui.FormatError("Validation failed."))
 		os.Exit(1)
@@ -54,6 +110,14 @@ func Validate(file string, preferSSH bool) {
 	fmt.Printf("  %s\n", ui.FormatSuccess(fmt.Sprintf("parsed %d rules", len(rules))))
 
 	issues := semanticCheck(rules)
+	if !strictAttributes {
+		for _, issue := range checkAttributes(rules) {
+			fmt.Printf("  Warning: %s\n", issue.String())
+		}
+	}
+	for _, issue := range checkMissingFiles(rules, filepath.Dir(setupPath)) {
+		fmt.Printf("  Warning: %s\n", issue.String())
+	}
 
 	if len(issues) == 0 {
 		fmt.Printf("\n%s\n\n", ui.FormatSuccess("No issues found."))
@@ -73,54 +137,285 @@ func Validate(file string, preferSSH bool) {
 	os.Exit(1)
 }
 
-// semanticCheck runs all semantic validations on a parsed rule set.
+// semanticCheck runs all semantic validations on a parsed rule set and
+// returns the issues in the order of the rules they are about.
 func semanticCheck(rules []parser.Rule) []validateIssue {
 	var issues []validateIssue
+	issues = append(issues, checkActions(rules)...)
+	issues = append(issues, checkDuplicateIDs(rules)...)
 	issues = append(issues, checkAfterReferences(rules)...)
+	issues = append(issues, checkFallbacks(rules)...)
+	issues = append(issues, checkCycles(rules)...)
 	issues = append(issues, checkOSFilters(rules)...)
+	issues = append(issues, checkTransactions(rules)...)
+	issues = append(issues, checkShells(rules)...)
+	issues = append(issues, checkHandlers(rules)...)
+	if strictAttributes {
+		issues = append(issues, checkAttributes(rules)...)
+	}
+	sort.SliceStable(issues, func(a, b int) bool { return issues[a].line < issues[b].line })
 	return issues
 }
 
-// checkAfterReferences flags after: entries that don't resolve to any rule id:
-// or primary resource key in the rule set.
-func checkAfterReferences(rules []parser.Rule) []validateIssue {
-	// Build the set of resolvable keys: all rule IDs and all primary resource keys.
-	keys := map[string]bool{}
-	for _, r := range rules {
+// checkActions flags rules whose action has no handler, such as uninstall
+// rules that name nothing to remove.
+func checkActions(rules []parser.Rule) []validateIssue {
+	var issues []validateIssue
+	for i, r := range rules {
+		action := r.Action
+		if action == "uninstall" {
+			action = handlerskg.DetectRuleType(r)
+		}
+		if handlerskg.GetAction(action) == nil {
+			issues = append(issues, ruleIssue(i, r, fmt.Sprintf("unknown action %q", r.Action)))
+		}
+	}
+	return issues
+}
+
+// checkDuplicateIDs flags rules that reuse the id: of an earlier rule; after:
+// references to it would only ever reach one of them.
+func checkDuplicateIDs(rules []parser.Rule) []validateIssue {
+	first := map[string]int{}
+	var issues []validateIssue
+	for i, r := range rules {
+		if r.ID == "" {
+			continue
+		}
+		j, seen := first[r.ID]
+		if !seen {
+			first[r.ID] = i
+			continue
+		}
+		where := fmt.Sprintf("rule %d", j+1)
+		if at := ruleLocation(rules[j]); at != "" {
+			where = at
+		}
+		issues = append(issues, ruleIssue(i, r, fmt.Sprintf("duplicate id %q (first used at %s)", r.ID, where)))
+	}
+	return issues
+}
+
+// dependencyIndex maps every name an after: entry can use to the index of
+// the rule it resolves to, the way resolveDependencies resolves them: ids
+// and aliases first, then resource keys and package names.
+func dependencyIndex(rules []parser.Rule) map[string]int {
+	byKey := map[string]int{}
+	for i, r := range rules {
+		byKey[handlerskg.RuleKey(r)] = i
+		for _, pkg := range r.Packages {
+			byKey[pkg.Name] = i
+		}
+	}
+	byID := map[string]int{}
+	for i, r := range rules {
+		for _, alias := range r.Aliases {
+			if _, taken := byID[alias]; !taken {
+				byID[alias] = i
+			}
+		}
+	}
+	for i, r := range rules {
 		if r.ID != "" {
-			keys[r.ID] = true
+			byID[r.ID] = i
 		}
-		if k := primaryKey(r); k != "" {
-			keys[k] = true
+	}
+	for name, i := range byID {
+		byKey[name] = i
+	}
+	delete(byKey, "")
+	return byKey
+}
+
+// checkCycles flags after: chains that lead back to the rule they start
+// from, reporting each cycle once at its first rule. The order fallbacks
+// impose (see linkFallbacks) counts as after: entries.
+func checkCycles(rules []parser.Rule) []validateIssue {
+	rules = linkFallbacks(rules)
+	index := dependencyIndex(rules)
+	const (
+		unvisited = iota
+		visiting
+		done
+	)
+	state := make([]int, len(rules))
+	var path []int
+	var issues []validateIssue
+
+	var visit func(i int)
+	visit = func(i int) {
+		state[i] = visiting
+		path = append(path, i)
+		for _, dep := range rules[i].After {
+			j, ok := index[dep]
+			if !ok {
+				continue
+			}
+			switch state[j] {
+			case unvisited:
+				visit(j)
+			case visiting:
+				start := 0
+				for path[start] != j {
+					start++
+				}
+				cycle := path[start:]
+				first := j
+				labels := make([]string, 0, len(cycle)+1)
+				for _, k := range cycle {
+					labels = append(labels, ruleLabel(rules[k]))
+					first = min(first, k)
+				}
+				labels = append(labels, ruleLabel(rules[j]))
+				issues = append(issues, ruleIssue(first, rules[first],
+					"circular dependency: "+strings.Join(labels, " -> ")))
+			}
+		}
+		path = path[:len(path)-1]
+		state[i] = done
+	}
+	for i := range rules {
+		if state[i] == unvisited {
+			visit(i)
+		}
+	}
+	return issues
+}
+
+// checkTransactions flags transaction: on rules whose handler cannot stage
+// its writes (only file-writing actions such as download, decrypt and render).
+func checkTransactions(rules []parser.Rule) []validateIssue {
+	var issues []validateIssue
+	for i, r := range rules {
+		if r.Transaction == "" {
+			continue
+		}
+		if _, ok := handlerskg.NewHandler(r, "", nil).(handlerskg.Stager); !ok {
+			issues = append(issues, ruleIssue(i, r, fmt.Sprintf("transaction: is not supported for %s rules", r.Action)))
+		}
+	}
+	return issues
+}
+
+// checkShells flags shell: values that name no supported shell and shell: on
+// actions that run no user commands.
+func checkShells(rules []parser.Rule) []validateIssue {
+	var issues []validateIssue
+	for i, r := range rules {
+		if r.Shell == "" {
+			continue
+		}
+		var message string
+		if !handlerskg.IsCommandShell(r.Shell) {
+			message = fmt.Sprintf("unknown shell %q (use %s)", r.Shell, strings.Join(handlerskg.CommandShellNames(), ", "))
+		} else if !acceptsAttr(r, "shell") {
+			message = fmt.Sprintf("shell: is not supported for %s rules", r.Action)
+		}
+		if message != "" {
+			issues = append(issues, ruleIssue(i, r, message))
+		}
+	}
+	return issues
+}
+
+// checkHandlers flags rules whose handler finds their configuration invalid,
+// such as a malformed URL or permission string.
+func checkHandlers(rules []parser.Rule) []validateIssue {
+	var issues []validateIssue
+	for i, r := range rules {
+		handler := handlerskg.NewHandler(r, "", nil)
+		if handler == nil {
+			continue
+		}
+		if err := handlerskg.ValidateRule(handler); err != nil {
+			issues = append(issues, ruleIssue(i, r, err.Error()))
 		}
 	}
+	return issues
+}
 
+// acceptsAttr reports whether the action of r lists attr among its attributes.
+func acceptsAttr(r parser.Rule, attr string) bool {
+	action := r.Action
+	if action == "uninstall" {
+		action = handlerskg.DetectRuleType(r)
+	}
+	def := handlerskg.GetAction(action)
+	if def == nil {
+		return false
+	}
+	for _, a := range def.Meta.Attrs {
+		if a.Name == attr {
+			return true
+		}
+	}
+	return false
+}
+
+// checkAfterReferences flags after: entries that don't resolve to any rule id:
+// or resource key in the rule set.
+func checkAfterReferences(rules []parser.Rule) []validateIssue {
+	index := dependencyIndex(rules)
 	var issues []validateIssue
 	for i, r := range rules {
 		for _, dep := range r.After {
-			if !keys[dep] {
-				issues = append(issues, validateIssue{
-					line:    i + 1,
-					summary: ruleLabel(r),
-					message: fmt.Sprintf("after: %q does not match any rule id or resource", dep),
-				})
+			if _, ok := index[dep]; !ok {
+				issues = append(issues, ruleIssue(i, r, fmt.Sprintf("after: %q does not match any rule id or resource", dep)))
 			}
 		}
 	}
 	return issues
 }
 
-// checkOSFilters flags os: values that are not recognised OS names.
+// checkFallbacks flags on-failure: entries that name no rule or the rule
+// itself, and rules named as the fallback of more than one rule, which would
+// only ever back up the first.
+func checkFallbacks(rules []parser.Rule) []validateIssue {
+	index := dependencyIndex(rules)
+	backs := map[int]int{}
+	var issues []validateIssue
+	for i, r := range rules {
+		if r.OnFailure == "" {
+			continue
+		}
+		f, ok := index[r.OnFailure]
+		switch {
+		case !ok:
+			issues = append(issues, ruleIssue(i, r, fmt.Sprintf("on-failure: %q does not match any rule id or resource", r.OnFailure)))
+			continue
+		case f == i:
+			issues = append(issues, ruleIssue(i, r, "on-failure: names the rule itself"))
+			continue
+		}
+		if p, taken := backs[f]; taken {
+			issues = append(issues, ruleIssue(i, r, fmt.Sprintf("on-failure: %q is already the fallback of %s", r.OnFailure, ruleLabel(rules[p]))))
+			continue
+		}
+		backs[f] = i
+	}
+	return issues
+}
+
+// checkOSFilters flags os: values and per-OS package name overrides that are
+// not recognised OS names, and arch: values that are not known architectures.
 func checkOSFilters(rules []parser.Rule) []validateIssue {
 	var issues []validateIssue
 	for i, r := range rules {
 		for _, osName := range r.OSList {
 			if !validOSNames[osName] {
-				issues = append(issues, validateIssue{
-					line:    i + 1,
-					summary: ruleLabel(r),
-					message: fmt.Sprintf("unknown os filter %q (valid: mac, linux, windows)", osName),
-				})
+				issues = append(issues, ruleIssue(i, r, fmt.Sprintf("unknown os filter %q (valid: mac, linux, windows)", osName)))
+			}
+		}
+		for _, arch := range r.ArchList {
+			if !IsValidArchName(arch) {
+				issues = append(issues, ruleIssue(i, r, fmt.Sprintf("unknown arch filter %q (valid: arm64, amd64)", arch)))
+			}
+		}
+		for _, pkg := range r.Packages {
+			for _, osName := range sortedKeys(pkg.OSNames) {
+				if !validOSNames[osName] {
+					issues = append(issues, ruleIssue(i, r, fmt.Sprintf("unknown os %q in package name override for %s (valid: mac, linux, windows)", osName, pkg.Name)))
+				}
 			}
 		}
 	}
@@ -1,9 +1,13 @@
 package engine
 
 import (
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/elpic/blueprint/internal/parser"
+	"github.com/elpic/blueprint/internal/ui"
 )
 
 func TestSemanticCheck_Clean(t *testing.T) {
@@ -61,6 +65,16 @@ func TestCheckOSFilters_Valid(t *testing.T) {
 	}
 }
 
+func TestCheckOSFilters_PackageNameOverride(t *testing.T) {
+	rules := []parser.Rule{
+		{Action: "install", Packages: []parser.Package{{Name: "fd", OSNames: map[string]string{"linux": "fd-find", "ubuntu": "fd"}}}},
+	}
+	issues := checkOSFilters(rules)
+	if len(issues) != 1 || !strings.Contains(issues[0].message, `"ubuntu"`) {
+		t.Errorf("expected one issue for ubuntu, got %v", issues)
+	}
+}
+
 func TestCheckOSFilters_Invalid(t *testing.T) {
 	rules := []parser.Rule{
 		{Action: "install", Packages: []parser.Package{{Name: "git"}}, OSList: []string{"darwin"}},
@@ -74,6 +88,17 @@ func TestCheckOSFilters_Invalid(t *testing.T) {
 	}
 }
 
+func TestCheckOSFilters_Arch(t *testing.T) {
+	rules := []parser.Rule{
+		{Action: "install", Packages: []parser.Package{{Name: "git"}}, ArchList: []string{"arm64", "x86_64"}},
+		{Action: "install", Packages: []parser.Package{{Name: "vim"}}, ArchList: []string{"m1"}},
+	}
+	issues := checkOSFilters(rules)
+	if len(issues) != 1 || issues[0].line != 2 || !strings.Contains(issues[0].message, `unknown arch filter "m1"`) {
+		t.Errorf("expected one issue for m1 on rule 2, got %v", issues)
+	}
+}
+
 func TestCheckOSFilters_NoFilter(t *testing.T) {
 	// No OSList means applies to all OSes — not an error.
 	rules := []parser.Rule{
@@ -110,8 +135,176 @@ func TestValidateIssueString(t *testing.T) {
 		t.Errorf("got %q, want %q", got, want)
 	}
 
+	located := validateIssue{line: 3, at: "setup.bp:12", summary: "install git", message: "some problem"}
+	if got := located.String(); got != "setup.bp:12: install git: some problem" {
+		t.Errorf("got %q, want %q", got, "setup.bp:12: install git: some problem")
+	}
+
 	fileLevelIssue := validateIssue{line: 0, message: "file-level problem"}
 	if got := fileLevelIssue.String(); got != "file-level problem" {
 		t.Errorf("got %q, want %q", got, "file-level problem")
 	}
 }
+
+func TestCheckShells(t *testing.T) {
+	rules := []parser.Rule{
+		{Action: "run", RunCommand: "echo hi", Shell: "fish"},
+		{Action: "run", RunCommand: "echo hi", Shell: "csh"},
+		{Action: "mkdir", Mkdir: "/tmp/foo", Shell: "bash"},
+		{Action: "asdf", AsdfPackages: []string{"nodejs@20"}, Shell: "zsh"},
+	}
+	issues := checkShells(rules)
+	if len(issues) != 2 {
+		t.Fatalf("expected 2 issues, got %d: %v", len(issues), issues)
+	}
+	if issues[0].line != 2 || !strings.Contains(issues[0].message, `unknown shell "csh"`) {
+		t.Errorf("unexpected issue: %v", issues[0])
+	}
+	if issues[1].line != 3 || !strings.Contains(issues[1].message, "not supported for mkdir") {
+		t.Errorf("unexpected issue: %v", issues[1])
+	}
+}
+
+func TestCheckDuplicateIDs(t *testing.T) {
+	rules := []parser.Rule{
+		{ID: "base", Action: "install", Packages: []parser.Package{{Name: "git"}}, SourceFile: "/nonexistent/setup.bp", SourceLine: 2},
+		{ID: "other", Action: "mkdir", Mkdir: "/tmp/foo"},
+		{ID: "base", Action: "install", Packages: []parser.Package{{Name: "curl"}}},
+	}
+	issues := checkDuplicateIDs(rules)
+	if len(issues) != 1 {
+		t.Fatalf("expected 1 issue, got %d: %v", len(issues), issues)
+	}
+	if issues[0].line != 3 || !strings.Contains(issues[0].message, `duplicate id "base" (first used at /nonexistent/setup.bp:2)`) {
+		t.Errorf("unexpected issue: %v", issues[0])
+	}
+}
+
+func TestCheckCycles(t *testing.T) {
+	rules := []parser.Rule{
+		{ID: "a", Action: "mkdir", Mkdir: "/tmp/a", After: []string{"c"}},
+		{ID: "b", Action: "mkdir", Mkdir: "/tmp/b", After: []string{"a"}},
+		{ID: "c", Action: "mkdir", Mkdir: "/tmp/c", After: []string{"b"}},
+		{Action: "install", Packages: []parser.Package{{Name: "git"}}, After: []string{"git"}},
+		{ID: "d", Action: "mkdir", Mkdir: "/tmp/d", After: []string{"a", "missing"}},
+	}
+	issues := checkCycles(rules)
+	if len(issues) != 2 {
+		t.Fatalf("expected 2 issues, got %d: %v", len(issues), issues)
+	}
+	if issues[0].line != 1 || issues[0].message != "circular dependency: a -> c -> b -> a" {
+		t.Errorf("unexpected issue: %v", issues[0])
+	}
+	if issues[1].line != 4 || issues[1].message != "circular dependency: install git -> install git" {
+		t.Errorf("unexpected issue: %v", issues[1])
+	}
+}
+
+func TestCheckFallbacks(t *testing.T) {
+	rules := []parser.Rule{
+		{ID: "nvim", Action: "install", Packages: []parser.Package{{Name: "neovim"}}, OnFailure: "nvim-src"},
+		{ID: "nvim-src", Action: "mkdir", Mkdir: "/tmp/nvim"},
+		{ID: "vim", Action: "install", Packages: []parser.Package{{Name: "vim"}}, OnFailure: "nvim-src"},
+		{ID: "tmux", Action: "install", Packages: []parser.Package{{Name: "tmux"}}, OnFailure: "missing"},
+		{ID: "self", Action: "mkdir", Mkdir: "/tmp/self", OnFailure: "self"},
+	}
+	issues := checkFallbacks(rules)
+	want := []string{
+		`on-failure: "nvim-src" is already the fallback of nvim`,
+		`on-failure: "missing" does not match any rule id or resource`,
+		"on-failure: names the rule itself",
+	}
+	if len(issues) != len(want) {
+		t.Fatalf("expected %d issues, got %v", len(want), issues)
+	}
+	for i, message := range want {
+		if issues[i].message != message {
+			t.Errorf("issue %d = %q, want %q", i, issues[i].message, message)
+		}
+	}
+
+	// A fallback that runs after a rule that runs after its primary
+	cycle := []parser.Rule{
+		{ID: "a", Action: "mkdir", Mkdir: "/tmp/a", OnFailure: "c"},
+		{ID: "b", Action: "mkdir", Mkdir: "/tmp/b", After: []string{"a"}},
+		{ID: "c", Action: "mkdir", Mkdir: "/tmp/c", After: []string{"b"}},
+	}
+	if issues := checkCycles(cycle); len(issues) != 1 {
+		t.Errorf("checkCycles() = %v, want the cycle through the fallback", issues)
+	}
+}
+
+func TestCheckAfterReferences_ByPackageNameAndAlias(t *testing.T) {
+	rules := []parser.Rule{
+		{ID: "tools", Aliases: []string{"base"}, Action: "install", Packages: []parser.Package{{Name: "git"}, {Name: "curl"}}},
+		{Action: "mkdir", Mkdir: "/tmp/foo", After: []string{"curl", "base"}},
+	}
+	if issues := checkAfterReferences(rules); len(issues) != 0 {
+		t.Errorf("expected no issues, got %v", issues)
+	}
+}
+
+func TestCheckActions(t *testing.T) {
+	rules := []parser.Rule{
+		{Action: "mkdir", Mkdir: "/tmp/foo"},
+		{Action: "bogus"},
+		{Action: "uninstall"},
+	}
+	issues := checkActions(rules)
+	if len(issues) != 2 || issues[0].line != 2 || issues[1].line != 3 {
+		t.Fatalf("unexpected issues: %v", issues)
+	}
+	if issues[0].message != `unknown action "bogus"` {
+		t.Errorf("unexpected issue: %v", issues[0])
+	}
+}
+
+func TestSemanticCheck_LineNumbers(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "setup.bp")
+	content := "# tools\nmkdir /tmp/a id: a after: b\n\nmkdir /tmp/b id: b after: a\nmkdir /tmp/c id: c on: [darwin]\nmkdir /tmp/d id: c\n"
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	rules, err := parser.ParseFile(path)
+	if err != nil {
+		t.Fatalf("ParseFile() error: %v", err)
+	}
+
+	var got []string
+	for _, issue := range semanticCheck(rules) {
+		got = append(got, issue.String())
+	}
+	loc := ui.AbbreviateHome(path)
+	if wd, err := os.Getwd(); err == nil {
+		if rel, err := filepath.Rel(wd, path); err == nil && !strings.HasPrefix(rel, "..") {
+			loc = rel
+		}
+	}
+	want := []string{
+		loc + `:2: a: circular dependency: a -> b -> a`,
+		loc + `:5: c: unknown os filter "darwin" (valid: mac, linux, windows)`,
+		loc + `:6: c: duplicate id "c" (first used at ` + loc + `:5)`,
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("semanticCheck() =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestCheckHandlers(t *testing.T) {
+	rules := []parser.Rule{
+		{Action: "download", DownloadURL: "https://example.com/tool", DownloadPath: "/tmp/tool"},
+		{Action: "download", DownloadURL: "example.com/tool", DownloadPath: "/tmp/tool"},
+		{Action: "asdf", AsdfPackages: []string{"nodejs"}},
+	}
+	issues := checkHandlers(rules)
+	if len(issues) != 2 {
+		t.Fatalf("checkHandlers() = %v, want 2 issues", issues)
+	}
+	if issues[0].line != 2 || !strings.Contains(issues[0].message, `invalid URL "example.com/tool"`) {
+		t.Errorf("issues[0] = %+v", issues[0])
+	}
+	if issues[1].line != 3 || !strings.Contains(issues[1].message, "want plugin@version") {
+		t.Errorf("issues[1] = %+v", issues[1])
+	}
+}
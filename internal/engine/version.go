@@ -0,0 +1,87 @@
+package engine
+
+import (
+	"encoding/json"
+	"fmt"
+	"runtime"
+	"runtime/debug"
+
+	handlerskg "github.com/elpic/blueprint/internal/handlers"
+)
+
+// Build metadata of the running binary. main sets these from the values
+// stamped in with -ldflags before it runs any command.
+var (
+	Version   = "dev"
+	Commit    = "none"
+	BuildDate = "unknown"
+)
+
+// BuildInfo describes the running binary, as reported by `blueprint version`.
+type BuildInfo struct {
+	Version   string        `json:"version"`
+	Commit    string        `json:"commit"`
+	BuildDate string        `json:"build_date"`
+	GoVersion string        `json:"go_version"`
+	OS        string        `json:"os"`
+	Arch      string        `json:"arch"`
+	Features  BuildFeatures `json:"features"`
+}
+
+// BuildFeatures lists what the binary can do, so a blueprint or a bug report
+// can tell which actions are available.
+type BuildFeatures struct {
+	Handlers []string `json:"handlers"` // actions compiled in, in registration order
+	Plugins  bool     `json:"plugins"`  // whether external action plugins can be loaded
+}
+
+// readBuildInfo is debug.ReadBuildInfo, replaceable in tests.
+var readBuildInfo = debug.ReadBuildInfo
+
+// CurrentBuildInfo returns the build metadata of the running binary. Builds
+// without -ldflags (go build, go install) fall back to the VCS revision Go
+// records in the binary.
+func CurrentBuildInfo() BuildInfo {
+	info := BuildInfo{
+		Version:   Version,
+		Commit:    Commit,
+		BuildDate: BuildDate,
+		GoVersion: runtime.Version(),
+		OS:        runtime.GOOS,
+		Arch:      runtime.GOARCH,
+		Features:  BuildFeatures{Handlers: []string{}},
+	}
+	if info.Commit == "none" {
+		if bi, ok := readBuildInfo(); ok {
+			for _, s := range bi.Settings {
+				if s.Key == "vcs.revision" && s.Value != "" {
+					info.Commit = s.Value
+					if len(info.Commit) > 7 {
+						info.Commit = info.Commit[:7]
+					}
+				}
+			}
+		}
+	}
+	for _, def := range handlerskg.DocumentedActions() {
+		info.Features.Handlers = append(info.Features.Handlers, def.Name)
+	}
+	return info
+}
+
+// PrintVersion prints the build metadata, as JSON when asJSON is set.
+func PrintVersion(asJSON bool) int {
+	info := CurrentBuildInfo()
+	if asJSON {
+		out, err := json.MarshalIndent(info, "", "  ")
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return 1
+		}
+		fmt.Println(string(out))
+		return 0
+	}
+	fmt.Printf("Version: %s\nCommit:  %s\nBuilt:   %s\nGo:      %s (%s/%s)\n",
+		info.Version, info.Commit, info.BuildDate, info.GoVersion, info.OS, info.Arch)
+	return 0
+}
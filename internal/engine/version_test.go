@@ -0,0 +1,46 @@
+package engine
+
+import (
+	"runtime"
+	"runtime/debug"
+	"testing"
+)
+
+func TestCurrentBuildInfo(t *testing.T) {
+	defer func(v, c, d string) { Version, Commit, BuildDate = v, c, d }(Version, Commit, BuildDate)
+	Version, Commit, BuildDate = "v1.4.0", "abc1234", "2026-10-01T09:00:00Z"
+
+	info := CurrentBuildInfo()
+	if info.Version != "v1.4.0" || info.Commit != "abc1234" || info.BuildDate != "2026-10-01T09:00:00Z" {
+		t.Errorf("CurrentBuildInfo() = %+v, want the stamped values", info)
+	}
+	if info.GoVersion != runtime.Version() || info.OS != runtime.GOOS || info.Arch != runtime.GOARCH {
+		t.Errorf("CurrentBuildInfo() = %+v, want the Go runtime's version and platform", info)
+	}
+	if info.Features.Plugins {
+		t.Error("plugins are not supported")
+	}
+	found := false
+	for _, name := range info.Features.Handlers {
+		if name == "uninstall" {
+			t.Error("the internal uninstall action should not be listed")
+		}
+		found = found || name == "install"
+	}
+	if !found {
+		t.Errorf("Handlers = %v, want install listed", info.Features.Handlers)
+	}
+}
+
+func TestCurrentBuildInfoFallsBackToVCSRevision(t *testing.T) {
+	defer func(c string) { Commit = c }(Commit)
+	defer func(f func() (*debug.BuildInfo, bool)) { readBuildInfo = f }(readBuildInfo)
+	Commit = "none"
+	readBuildInfo = func() (*debug.BuildInfo, bool) {
+		return &debug.BuildInfo{Settings: []debug.BuildSetting{{Key: "vcs.revision", Value: "0123456789abcdef"}}}, true
+	}
+
+	if got := CurrentBuildInfo().Commit; got != "0123456" {
+		t.Errorf("Commit = %q, want the short VCS revision", got)
+	}
+}
@@ -0,0 +1,214 @@
+package engine
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/elpic/blueprint/internal"
+	"github.com/elpic/blueprint/internal/ui"
+)
+
+// A workspace is a separate set of state on one machine: its own status,
+// history and run counter, so the same blueprint can be applied as "work"
+// and as "experimental" without one's auto-uninstall removing what the other
+// installed. The default workspace keeps its state in ~/.blueprint as before;
+// any other one in ~/.blueprint/workspaces/<name>. The configuration, caches,
+// repositories and trash stay shared.
+
+const (
+	// defaultWorkspace is the workspace used until another one is selected.
+	defaultWorkspace = "default"
+	// WorkspaceEnv selects a workspace for one command, over the one selected
+	// with `blueprint workspace select`.
+	WorkspaceEnv = "BLUEPRINT_WORKSPACE"
+	// workspaceFile records the selected workspace in ~/.blueprint.
+	workspaceFile = "workspace"
+	// workspacesDir holds the state of the workspaces other than the default.
+	workspacesDir = "workspaces"
+)
+
+// workspaceName matches a valid workspace name, which is also its directory.
+var workspaceName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// validateWorkspaceName rejects names that cannot be a directory name.
+func validateWorkspaceName(name string) error {
+	if !workspaceName.MatchString(name) {
+		return fmt.Errorf("invalid workspace name %q: use letters, digits, '.', '_' and '-'", name)
+	}
+	return nil
+}
+
+// currentWorkspace returns the workspace commands work in: the one in
+// $BLUEPRINT_WORKSPACE, else the selected one, else the default.
+func currentWorkspace() (string, error) {
+	if name := os.Getenv(WorkspaceEnv); name != "" {
+		if err := validateWorkspaceName(name); err != nil {
+			return "", fmt.Errorf("%s: %w", WorkspaceEnv, err)
+		}
+		return name, nil
+	}
+	blueprintDir, err := getBlueprintDir()
+	if err != nil {
+		return "", err
+	}
+	data, err := readBlueprintFile(filepath.Join(blueprintDir, workspaceFile))
+	if os.IsNotExist(err) {
+		return defaultWorkspace, nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read the selected workspace: %w", err)
+	}
+	name := strings.TrimSpace(string(data))
+	if name == "" {
+		return defaultWorkspace, nil
+	}
+	if err := validateWorkspaceName(name); err != nil {
+		return "", err
+	}
+	return name, nil
+}
+
+// workspaceDir returns the directory holding the state of workspace name.
+func workspaceDir(blueprintDir, name string) string {
+	if name == defaultWorkspace {
+		return blueprintDir
+	}
+	return filepath.Join(blueprintDir, workspacesDir, name)
+}
+
+// getStateDir returns the directory of the current workspace's status,
+// history and run counter. A workspace that was never created is an error,
+// so a mistyped name does not start an empty state.
+func getStateDir() (string, error) {
+	blueprintDir, err := getBlueprintDir()
+	if err != nil {
+		return "", err
+	}
+	name, err := currentWorkspace()
+	if err != nil {
+		return "", err
+	}
+	dir := workspaceDir(blueprintDir, name)
+	if _, err := os.Stat(dir); err != nil {
+		return "", fmt.Errorf("workspace %q does not exist; create it with 'blueprint workspace new %s'", name, name)
+	}
+	return dir, nil
+}
+
+// printWorkspaceLine names the current workspace under the plan and apply
+// headers, unless it is the default.
+func printWorkspaceLine() {
+	if name, err := currentWorkspace(); err == nil && name != defaultWorkspace {
+		fmt.Printf("Workspace: %s\n\n", ui.FormatHighlight(name))
+	}
+}
+
+// listWorkspaces returns the default workspace and the created ones, sorted.
+func listWorkspaces(blueprintDir string) ([]string, error) {
+	names := []string{defaultWorkspace}
+	entries, err := os.ReadDir(filepath.Join(blueprintDir, workspacesDir))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to list workspaces: %w", err)
+	}
+	for _, e := range entries {
+		if e.IsDir() && workspaceName.MatchString(e.Name()) && e.Name() != defaultWorkspace {
+			names = append(names, e.Name())
+		}
+	}
+	sort.Strings(names[1:])
+	return names, nil
+}
+
+// selectWorkspace records name as the selected workspace.
+func selectWorkspace(blueprintDir, name string) error {
+	if err := os.WriteFile(filepath.Join(blueprintDir, workspaceFile), []byte(name+"\n"), internal.FilePermission); err != nil {
+		return fmt.Errorf("failed to select workspace: %w", err)
+	}
+	return nil
+}
+
+// WorkspaceNew creates workspace name, with no status or history yet, and
+// selects it. It returns 1 when the name is invalid or taken.
+func WorkspaceNew(name string) int {
+	if err := validateWorkspaceName(name); err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", ui.FormatError(err.Error()))
+		return 1
+	}
+	blueprintDir, err := getBlueprintDir()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", ui.FormatError(err.Error()))
+		return 1
+	}
+	dir := workspaceDir(blueprintDir, name)
+	if _, err := os.Stat(dir); err == nil {
+		fmt.Fprintf(os.Stderr, "%s\n", ui.FormatError(fmt.Sprintf("Workspace %q already exists; switch to it with 'blueprint workspace select %s'", name, name)))
+		return 1
+	}
+	if err := os.MkdirAll(dir, internal.DirectoryPermission); err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", ui.FormatError(fmt.Sprintf("Failed to create workspace %q: %v", name, err)))
+		return 1
+	}
+	if err := selectWorkspace(blueprintDir, name); err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", ui.FormatError(err.Error()))
+		return 1
+	}
+	fmt.Printf("%s\n", ui.FormatSuccess(fmt.Sprintf("Created and selected workspace %q", name)))
+	return 0
+}
+
+// WorkspaceSelect selects an existing workspace for the commands that follow.
+func WorkspaceSelect(name string) int {
+	if err := validateWorkspaceName(name); err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", ui.FormatError(err.Error()))
+		return 1
+	}
+	blueprintDir, err := getBlueprintDir()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", ui.FormatError(err.Error()))
+		return 1
+	}
+	if _, err := os.Stat(workspaceDir(blueprintDir, name)); err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", ui.FormatError(fmt.Sprintf("Workspace %q does not exist; create it with 'blueprint workspace new %s'", name, name)))
+		return 1
+	}
+	if err := selectWorkspace(blueprintDir, name); err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", ui.FormatError(err.Error()))
+		return 1
+	}
+	fmt.Printf("%s\n", ui.FormatSuccess(fmt.Sprintf("Selected workspace %q", name)))
+	if env := os.Getenv(WorkspaceEnv); env != "" && env != name {
+		fmt.Printf("%s\n", ui.FormatDim(fmt.Sprintf("%s=%s still overrides it in this shell", WorkspaceEnv, env)))
+	}
+	return 0
+}
+
+// WorkspaceList lists the workspaces, marking the current one with "*".
+func WorkspaceList() int {
+	blueprintDir, err := getBlueprintDir()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", ui.FormatError(err.Error()))
+		return 1
+	}
+	names, err := listWorkspaces(blueprintDir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", ui.FormatError(err.Error()))
+		return 1
+	}
+	current, err := currentWorkspace()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", ui.FormatError(err.Error()))
+		return 1
+	}
+	for _, name := range names {
+		if name == current {
+			fmt.Printf("* %s\n", ui.FormatHighlight(name))
+		} else {
+			fmt.Printf("  %s\n", name)
+		}
+	}
+	return 0
+}
@@ -0,0 +1,78 @@
+package engine
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestWorkspacesKeepSeparateState(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv(WorkspaceEnv, "")
+	blueprintDir := filepath.Join(home, ".blueprint")
+
+	if name, err := currentWorkspace(); err != nil || name != defaultWorkspace {
+		t.Fatalf("currentWorkspace() = %q, %v; want the default", name, err)
+	}
+	if err := saveStatus(nil, nil, "/tmp/test.bp", "default-sha", "linux"); err != nil {
+		t.Fatal(err)
+	}
+	if err := saveHistory(1, []ExecutionRecord{{Command: "cmd", Status: "success"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	if code := WorkspaceNew("work"); code != 0 {
+		t.Fatalf("WorkspaceNew() = %d", code)
+	}
+	if code := WorkspaceNew("work"); code != 1 {
+		t.Errorf("WorkspaceNew() of an existing workspace = %d, want 1", code)
+	}
+	if name, _ := currentWorkspace(); name != "work" {
+		t.Fatalf("currentWorkspace() after new = %q, want work", name)
+	}
+	if _, err := loadStatus(); !os.IsNotExist(err) {
+		t.Errorf("loadStatus() in a new workspace error = %v, want no status yet", err)
+	}
+	if runs, _ := readHistoryIndex(); len(runs) != 0 {
+		t.Errorf("history of a new workspace = %+v, want none", runs)
+	}
+	if n, err := getNextRunNumber(); err != nil || n != 1 {
+		t.Errorf("getNextRunNumber() in a new workspace = %d, %v; want 1", n, err)
+	}
+	if err := saveStatus(nil, nil, "/tmp/test.bp", "work-sha", "linux"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(blueprintDir, workspacesDir, "work", "status.json")); err != nil {
+		t.Errorf("status of work not in its directory: %v", err)
+	}
+
+	// The default workspace still has its own status
+	if code := WorkspaceSelect(defaultWorkspace); code != 0 {
+		t.Fatalf("WorkspaceSelect() = %d", code)
+	}
+	if status := loadCurrentStatus(); status.BlueprintSHA != "default-sha" {
+		t.Errorf("default status = %+v, want default-sha", status)
+	}
+	t.Setenv(WorkspaceEnv, "work")
+	if status := loadCurrentStatus(); status.BlueprintSHA != "work-sha" {
+		t.Errorf("status with %s=work = %+v, want work-sha", WorkspaceEnv, status)
+	}
+
+	if code := WorkspaceSelect("missing"); code != 1 {
+		t.Errorf("WorkspaceSelect() of a missing workspace = %d, want 1", code)
+	}
+	t.Setenv(WorkspaceEnv, "missing")
+	if _, err := loadStatus(); err == nil || os.IsNotExist(err) {
+		t.Errorf("loadStatus() in a missing workspace error = %v, want it named", err)
+	}
+	t.Setenv(WorkspaceEnv, "../escape")
+	if _, err := currentWorkspace(); err == nil {
+		t.Error("currentWorkspace() accepted ../escape")
+	}
+
+	if names, err := listWorkspaces(blueprintDir); err != nil || !slices.Equal(names, []string{defaultWorkspace, "work"}) {
+		t.Errorf("listWorkspaces() = %v, %v", names, err)
+	}
+}
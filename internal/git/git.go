@@ -12,6 +12,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/elpic/blueprint/internal"
 	"github.com/go-git/go-git/v5"
 	"github.com/go-git/go-git/v5/config"
 	"github.com/go-git/go-git/v5/plumbing"
@@ -386,6 +387,37 @@ func LocalSHAWithError(path string) (string, error) {
 	return gitSHA(path)
 }
 
+// OriginURL returns the URL of the origin remote of the repository at path,
+// or "" when path is not a repository or it has no origin.
+func OriginURL(path string) string {
+	repo, err := git.PlainOpen(path)
+	if err != nil {
+		return ""
+	}
+	remote, err := repo.Remote("origin")
+	if err != nil || len(remote.Config().URLs) == 0 {
+		return ""
+	}
+	return remote.Config().URLs[0]
+}
+
+// SameRepository reports whether two URLs name the same repository, whatever
+// their form: shorthand, SSH or HTTPS, with or without the .git suffix.
+func SameRepository(a, b string) bool {
+	return sameRepositoryKey(a) == sameRepositoryKey(b)
+}
+
+func sameRepositoryKey(url string) string {
+	url = ExpandShorthand(url)
+	if rest, ok := strings.CutPrefix(url, "ssh://"); ok {
+		if _, hostPath, found := strings.Cut(rest, "@"); found {
+			rest = hostPath
+		}
+		url = "https://" + rest
+	}
+	return strings.TrimSuffix(NormalizeGitURL(url), "/")
+}
+
 // RemoteHeadSHA returns the SHA of the remote HEAD (or branch tip) for the given URL and branch.
 // Returns empty string if the check fails (network unavailable, auth issue, etc.).
 func RemoteHeadSHA(url, branch string) string {
@@ -518,6 +550,8 @@ func remoteRefWithError(url, ref string) (string, error) {
 
 // CloneOrUpdateRepository clones a repository to a specific path or updates it if already exists.
 // Tries go-git first; falls back to the system git binary if go-git fails (e.g. SSH agent issues).
+// Safe to call from parallel rules: the destination is locked against overlapping
+// operations, network access is bounded per host, and transient failures are retried.
 // Returns: (oldSHA, newSHA, status_message, error)
 // status_message can be: "Cloned", "Updated", "Already up to date"
 func CloneOrUpdateRepository(url, path, branch string) (string, string, string, error) {
@@ -525,14 +559,40 @@ func CloneOrUpdateRepository(url, path, branch string) (string, string, string,
 	url = ExpandShorthand(url)
 
 	// Expand home directory
-	if strings.HasPrefix(path, "~/") {
+	if internal.HasHomePrefix(path) {
 		homeDir, err := os.UserHomeDir()
 		if err != nil {
 			return "", "", "", fmt.Errorf("failed to get home directory: %w", err)
 		}
-		path = filepath.Join(homeDir, path[2:])
+		path = internal.ExpandHome(path, homeDir)
 	}
 
+	unlock := lockDestination(path)
+	defer unlock()
+	return cloneOrUpdateLocked(url, path, branch)
+}
+
+// cloneOrUpdateLocked runs cloneOrUpdate through the host pool with retries.
+// The caller must hold the destination lock for path.
+func cloneOrUpdateLocked(url, path, branch string) (string, string, string, error) {
+	_, statErr := os.Stat(path)
+	existed := statErr == nil
+
+	var oldSHA, newSHA, status string
+	err := withPoolAndRetry(url, func() {
+		if !existed {
+			_ = os.RemoveAll(path) // drop the partial clone before retrying
+		}
+	}, func() error {
+		var opErr error
+		oldSHA, newSHA, status, opErr = cloneOrUpdate(url, path, branch)
+		return opErr
+	})
+	return oldSHA, newSHA, status, err
+}
+
+// cloneOrUpdate does the actual clone or fetch+reset for an expanded path.
+func cloneOrUpdate(url, path, branch string) (string, string, string, error) {
 	// Ensure parent directory exists
 	if err := os.MkdirAll(filepath.Dir(path), 0750); err != nil {
 		return "", "", "", fmt.Errorf("failed to create parent directory: %w", err)
@@ -599,8 +659,7 @@ func CloneOrUpdateRepository(url, path, branch string) (string, string, string,
 			defer fetchCancel()
 			fetchCmd := exec.CommandContext(fetchCtx, "git", fetchArgs...) // #nosec G204
 			fetchCmd.Stdout = io.Discard
-			fetchCmd.Stderr = os.Stderr
-			if fetchErr := fetchCmd.Run(); fetchErr != nil {
+			if fetchErr := runGitCommand(fetchCtx, fetchCmd); fetchErr != nil {
 				return oldSHA, "", "", fmt.Errorf("failed to fetch: %w", fetchErr)
 			}
 		}
@@ -688,8 +747,7 @@ func CloneOrUpdateRepository(url, path, branch string) (string, string, string,
 		defer cloneCancel()
 		cloneCmd := exec.CommandContext(cloneCtx, "git", args...) // #nosec G204
 		cloneCmd.Stdout = io.Discard
-		cloneCmd.Stderr = os.Stderr
-		if err := cloneCmd.Run(); err != nil {
+		if err := runGitCommand(cloneCtx, cloneCmd); err != nil {
 			return "", "", "", fmt.Errorf("failed to clone: %w", err)
 		}
 	} else {
@@ -919,12 +977,12 @@ func cloneOrUpdateRepositoryTwoStageImpl(url, targetPath, branch string) (string
 
 	// Expand target path
 	expandedTargetPath := targetPath
-	if strings.HasPrefix(targetPath, "~/") {
+	if internal.HasHomePrefix(targetPath) {
 		homeDir, err := os.UserHomeDir()
 		if err != nil {
 			return "", "", "", fmt.Errorf("failed to get home directory: %w", err)
 		}
-		expandedTargetPath = filepath.Join(homeDir, targetPath[2:])
+		expandedTargetPath = internal.ExpandHome(targetPath, homeDir)
 	}
 
 	// Check if target exists and get its current state
@@ -967,7 +1025,10 @@ func cloneOrUpdateRepositoryTwoStageImpl(url, targetPath, branch string) (string
 
 	// Copy from storage to target if needed
 	if needsUpdate {
-		if err := copyRepositoryContents(storagePath, expandedTargetPath); err != nil {
+		unlock := lockDestination(expandedTargetPath)
+		err := copyRepositoryContents(storagePath, expandedTargetPath)
+		unlock()
+		if err != nil {
 			return oldStorageSHA, newStorageSHA, "", fmt.Errorf("failed to copy to target: %w", err)
 		}
 	}
@@ -996,25 +1057,31 @@ func cloneOrUpdateRepositoryTwoStageImpl(url, targetPath, branch string) (string
 func CloneOrUpdateRepositoryDirect(url, targetPath, branch string) (string, string, string, error) {
 	// Expand tilde
 	expanded := targetPath
-	if strings.HasPrefix(targetPath, "~/") {
+	if internal.HasHomePrefix(targetPath) {
 		homeDir, err := os.UserHomeDir()
 		if err != nil {
 			return "", "", "", fmt.Errorf("failed to get home directory: %w", err)
 		}
-		expanded = filepath.Join(homeDir, targetPath[2:])
+		expanded = internal.ExpandHome(targetPath, homeDir)
 	}
 
 	if err := os.MkdirAll(filepath.Dir(expanded), 0o750); err != nil {
 		return "", "", "", fmt.Errorf("failed to create parent directory: %w", err)
 	}
 
+	// Hold the destination for the whole check/remove/clone sequence so a
+	// parallel rule can't observe the directory half-removed.
+	unlock := lockDestination(expanded)
+	defer unlock()
+	url = ExpandShorthand(url)
+
 	info, err := os.Stat(expanded)
 	exists := err == nil && info.IsDir()
 
 	if !exists {
-		// Fresh clone — delegate to CloneOrUpdateRepository which handles
-		// SSH/HTTPS fallback and go-git vs system git negotiation.
-		old, new, status, cloneErr := CloneOrUpdateRepository(url, expanded, branch)
+		// Fresh clone — cloneOrUpdateLocked handles SSH/HTTPS fallback and
+		// go-git vs system git negotiation.
+		old, new, status, cloneErr := cloneOrUpdateLocked(url, expanded, branch)
 		return old, new, status, cloneErr
 	}
 
@@ -1025,10 +1092,10 @@ func CloneOrUpdateRepositoryDirect(url, targetPath, branch string) (string, stri
 		if err := os.RemoveAll(expanded); err != nil {
 			return "", "", "", fmt.Errorf("failed to remove incomplete clone at %s: %w", expanded, err)
 		}
-		old, new, status, cloneErr := CloneOrUpdateRepository(url, expanded, branch)
+		old, new, status, cloneErr := cloneOrUpdateLocked(url, expanded, branch)
 		return old, new, status, cloneErr
 	}
 
 	// Directory already exists with .git — fetch and reset instead of re-clone.
-	return CloneOrUpdateRepository(url, expanded, branch)
+	return cloneOrUpdateLocked(url, expanded, branch)
 }
@@ -0,0 +1,244 @@
+package git
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Rules in the same wave run in parallel, so several clone/dotfiles rules can
+// hit the network at once. This file bounds how many git operations talk to a
+// single host concurrently, retries transient failures, and serializes work
+// on overlapping destination paths.
+
+// maxPerHost returns how many git network operations may run against the same
+// host at once. Reads BLUEPRINT_GIT_MAX_PER_HOST; defaults to 4.
+func maxPerHost() int {
+	if s := os.Getenv("BLUEPRINT_GIT_MAX_PER_HOST"); s != "" {
+		if n, err := strconv.Atoi(s); err == nil && n > 0 {
+			return n
+		}
+	}
+	return 4
+}
+
+// gitRetries returns how many times a failed clone/update is retried.
+// Reads BLUEPRINT_GIT_RETRIES; defaults to 2 (three attempts in total).
+func gitRetries() int {
+	if s := os.Getenv("BLUEPRINT_GIT_RETRIES"); s != "" {
+		if n, err := strconv.Atoi(s); err == nil && n >= 0 {
+			return n
+		}
+	}
+	return 2
+}
+
+// retryBackoff is the delay before retry attempt n (1-based).
+// Made as a variable for test stubbing.
+var retryBackoff = func(attempt int) time.Duration {
+	return time.Duration(attempt) * time.Second
+}
+
+var (
+	hostSlotsMu sync.Mutex
+	hostSlots   = map[string]chan struct{}{}
+)
+
+// acquireHost blocks until a connection slot for url's host is free and
+// returns the function that releases it.
+func acquireHost(url string) func() {
+	host := hostOf(url)
+	hostSlotsMu.Lock()
+	slots, ok := hostSlots[host]
+	if !ok {
+		slots = make(chan struct{}, maxPerHost())
+		hostSlots[host] = slots
+	}
+	hostSlotsMu.Unlock()
+
+	slots <- struct{}{}
+	return func() { <-slots }
+}
+
+// hostOf extracts the host name from an HTTPS, git://, ssh:// or scp-style
+// (git@host:org/repo) URL. Unknown forms are returned unchanged so they still
+// get a pool of their own.
+func hostOf(url string) string {
+	rest := url
+	if idx := strings.Index(rest, "://"); idx >= 0 {
+		rest = rest[idx+3:]
+	} else if at := strings.Index(rest, "@"); at >= 0 && strings.Contains(rest[at:], ":") {
+		// scp-style: user@host:path
+		rest = rest[at+1:]
+		if colon := strings.Index(rest, ":"); colon >= 0 {
+			return strings.ToLower(rest[:colon])
+		}
+	}
+	if at := strings.Index(rest, "@"); at >= 0 && at < strings.IndexAny(rest+"/", "/") {
+		rest = rest[at+1:] // strip user info
+	}
+	if end := strings.IndexAny(rest, "/:"); end >= 0 {
+		rest = rest[:end]
+	}
+	return strings.ToLower(rest)
+}
+
+var (
+	destMu     sync.Mutex
+	destCond   = sync.NewCond(&destMu)
+	destLocked = map[string]bool{}
+)
+
+// lockDestination blocks until no other git operation is working on path or on
+// a path nested inside/around it, then claims path and returns the function that
+// releases it. Two rules cloning into ~/src and ~/src/tool would otherwise race
+// on the same files.
+func lockDestination(path string) func() {
+	path = filepath.Clean(path)
+	destMu.Lock()
+	for overlapsLocked(path) {
+		destCond.Wait()
+	}
+	destLocked[path] = true
+	destMu.Unlock()
+
+	return func() {
+		destMu.Lock()
+		delete(destLocked, path)
+		destMu.Unlock()
+		destCond.Broadcast()
+	}
+}
+
+// overlapsLocked reports whether path equals, contains, or is contained by a
+// currently locked destination. Caller must hold destMu.
+func overlapsLocked(path string) bool {
+	for locked := range destLocked {
+		if pathsOverlap(path, locked) {
+			return true
+		}
+	}
+	return false
+}
+
+func pathsOverlap(a, b string) bool {
+	if a == b {
+		return true
+	}
+	sep := string(filepath.Separator)
+	return strings.HasPrefix(a, strings.TrimSuffix(b, sep)+sep) ||
+		strings.HasPrefix(b, strings.TrimSuffix(a, sep)+sep)
+}
+
+// transientErrnos are the socket errors of a connection that dropped or
+// could not be made.
+var transientErrnos = []syscall.Errno{
+	syscall.ECONNRESET,
+	syscall.ECONNREFUSED,
+	syscall.ECONNABORTED,
+	syscall.ETIMEDOUT,
+	syscall.EHOSTUNREACH,
+	syscall.ENETUNREACH,
+	syscall.EPIPE,
+}
+
+// transientMessages are the parts of git and network error messages that
+// mean the remote could not be reached for now, not that the clone is wrong.
+var transientMessages = []string{
+	"connection reset",
+	"connection refused",
+	"connection timed out",
+	"timed out",
+	"timeout",
+	"could not resolve host",
+	"temporary failure in name resolution",
+	"network is unreachable",
+	"no route to host",
+	"broken pipe",
+	"unexpected eof",
+	"early eof",
+	"the remote end hung up unexpectedly",
+	"returned error: 429",
+	"returned error: 500",
+	"returned error: 502",
+	"returned error: 503",
+	"returned error: 504",
+}
+
+// isRetryable reports whether a git failure is worth retrying: a timeout or
+// a dropped or refused connection. Anything else, such as a bad URL, missing
+// credentials or an unknown branch, will fail the same way every time.
+func isRetryable(err error) bool {
+	if err == nil {
+		return false
+	}
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		return true
+	}
+	if errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+	for _, errno := range transientErrnos {
+		if errors.Is(err, errno) {
+			return true
+		}
+	}
+	msg := strings.ToLower(err.Error())
+	for _, m := range transientMessages {
+		if strings.Contains(msg, m) {
+			return true
+		}
+	}
+	return false
+}
+
+// runGitCommand runs a git command whose context is ctx, showing its stderr
+// as it goes and keeping it in the returned error, so isRetryable can see
+// why it failed.
+func runGitCommand(ctx context.Context, cmd *exec.Cmd) error {
+	var stderr bytes.Buffer
+	cmd.Stderr = io.MultiWriter(os.Stderr, &stderr)
+	err := cmd.Run()
+	if err == nil {
+		return nil
+	}
+	if ctx.Err() != nil {
+		return fmt.Errorf("%w: %w", ctx.Err(), err)
+	}
+	if msg := strings.TrimSpace(stderr.String()); msg != "" {
+		return fmt.Errorf("%w: %s", err, msg)
+	}
+	return err
+}
+
+// withPoolAndRetry runs op against url's host pool, retrying transient
+// failures with a growing backoff. cleanup is called before each retry so a
+// partial clone does not poison the next attempt.
+func withPoolAndRetry(url string, cleanup func(), op func() error) error {
+	retries := gitRetries()
+	var err error
+	for attempt := 0; ; attempt++ {
+		release := acquireHost(url)
+		err = op()
+		release()
+		if err == nil || attempt >= retries || !isRetryable(err) {
+			return err
+		}
+		if cleanup != nil {
+			cleanup()
+		}
+		time.Sleep(retryBackoff(attempt + 1))
+	}
+}
@@ -0,0 +1,178 @@
+package git
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5/plumbing/transport"
+)
+
+func TestHostOf(t *testing.T) {
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{"https://github.com/user/repo.git", "github.com"},
+		{"https://GitHub.com/user/repo@main", "github.com"},
+		{"https://token@gitlab.com/group/project", "gitlab.com"},
+		{"git@github.com:user/repo.git", "github.com"},
+		{"ssh://git@codeberg.org:22/user/repo", "codeberg.org"},
+		{"git://example.com/repo.git", "example.com"},
+	}
+	for _, tt := range tests {
+		if got := hostOf(tt.url); got != tt.want {
+			t.Errorf("hostOf(%q) = %q, want %q", tt.url, got, tt.want)
+		}
+	}
+}
+
+func TestPathsOverlap(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		{"/home/u/src", "/home/u/src", true},
+		{"/home/u/src", "/home/u/src/tool", true},
+		{"/home/u/src/tool", "/home/u/src", true},
+		{"/home/u/src", "/home/u/src2", false},
+		{"/home/u/a", "/home/u/b", false},
+	}
+	for _, tt := range tests {
+		if got := pathsOverlap(tt.a, tt.b); got != tt.want {
+			t.Errorf("pathsOverlap(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestLockDestinationSerializesOverlappingPaths(t *testing.T) {
+	unlock := lockDestination("/tmp/bp-pool-test/src")
+
+	acquired := make(chan struct{})
+	go func() {
+		release := lockDestination("/tmp/bp-pool-test/src/nested")
+		close(acquired)
+		release()
+	}()
+
+	select {
+	case <-acquired:
+		t.Fatal("nested path was locked while its parent was held")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// An unrelated path must not wait.
+	unrelated := lockDestination("/tmp/bp-pool-test/other")
+	unrelated()
+
+	unlock()
+	select {
+	case <-acquired:
+	case <-time.After(time.Second):
+		t.Fatal("nested path was never locked after parent was released")
+	}
+}
+
+func TestAcquireHostBoundsConcurrency(t *testing.T) {
+	t.Setenv("BLUEPRINT_GIT_MAX_PER_HOST", "2")
+	url := fmt.Sprintf("https://pool-test-%d.example.com/repo", time.Now().UnixNano())
+
+	var active, peak int32
+	var wg sync.WaitGroup
+	for i := 0; i < 6; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			release := acquireHost(url)
+			n := atomic.AddInt32(&active, 1)
+			for {
+				p := atomic.LoadInt32(&peak)
+				if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+					break
+				}
+			}
+			time.Sleep(10 * time.Millisecond)
+			atomic.AddInt32(&active, -1)
+			release()
+		}()
+	}
+	wg.Wait()
+
+	if peak > 2 {
+		t.Errorf("peak concurrency = %d, want <= 2", peak)
+	}
+}
+
+func TestWithPoolAndRetry(t *testing.T) {
+	origBackoff := retryBackoff
+	retryBackoff = func(int) time.Duration { return 0 }
+	defer func() { retryBackoff = origBackoff }()
+
+	t.Run("retries transient errors", func(t *testing.T) {
+		t.Setenv("BLUEPRINT_GIT_RETRIES", "2")
+		calls, cleanups := 0, 0
+		err := withPoolAndRetry("https://example.com/r", func() { cleanups++ }, func() error {
+			calls++
+			if calls < 3 {
+				return errors.New("connection reset by peer")
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if calls != 3 || cleanups != 2 {
+			t.Errorf("calls = %d, cleanups = %d; want 3, 2", calls, cleanups)
+		}
+	})
+
+	t.Run("gives up after retries", func(t *testing.T) {
+		t.Setenv("BLUEPRINT_GIT_RETRIES", "1")
+		calls := 0
+		err := withPoolAndRetry("https://example.com/r", nil, func() error {
+			calls++
+			return errors.New("timeout")
+		})
+		if err == nil || calls != 2 {
+			t.Errorf("err = %v, calls = %d; want error after 2 calls", err, calls)
+		}
+	})
+
+	t.Run("retries dropped connections", func(t *testing.T) {
+		t.Setenv("BLUEPRINT_GIT_RETRIES", "1")
+		calls := 0
+		err := withPoolAndRetry("https://example.com/r", nil, func() error {
+			calls++
+			return fmt.Errorf("fetch: %w", syscall.ECONNRESET)
+		})
+		if err == nil || calls != 2 {
+			t.Errorf("err = %v, calls = %d; want error after 2 calls", err, calls)
+		}
+	})
+
+	t.Run("does not retry other errors", func(t *testing.T) {
+		calls := 0
+		err := withPoolAndRetry("https://example.com/r", nil, func() error {
+			calls++
+			return errors.New("failed to clone: exit status 128: fatal: Remote branch nope not found in upstream origin")
+		})
+		if err == nil || calls != 1 {
+			t.Errorf("err = %v, calls = %d; want error after 1 call", err, calls)
+		}
+	})
+
+	t.Run("does not retry auth failures", func(t *testing.T) {
+		calls := 0
+		err := withPoolAndRetry("https://example.com/r", nil, func() error {
+			calls++
+			return fmt.Errorf("clone: %w", transport.ErrAuthenticationRequired)
+		})
+		if err == nil || calls != 1 {
+			t.Errorf("err = %v, calls = %d; want error after 1 call", err, calls)
+		}
+	})
+}
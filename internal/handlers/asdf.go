@@ -16,6 +16,7 @@ import (
 
 	"github.com/elpic/blueprint/internal/parser"
 	"github.com/elpic/blueprint/internal/ui"
+	"github.com/elpic/blueprint/internal/ui/timeutil"
 )
 
 // asdfVersionCache stores the fetched asdf version to avoid multiple API calls
@@ -39,7 +40,7 @@ var asdfInstalledCheck = func() bool {
 		}
 	}
 	// Fall back to PATH lookup (covers ~/.asdf/bin/asdf etc.)
-	_, err := exec.LookPath("asdf")
+	_, err := cachedLookPath("asdf")
 	return err == nil
 }
 
@@ -47,6 +48,18 @@ func init() {
 	RegisterAction(ActionDef{
 		Name:   "asdf",
 		Prefix: "asdf",
+		Meta: ActionMeta{
+			Summary: "Install asdf plugins and tool versions.",
+			Usage:   "asdf <plugin@version>... [shell: <shell>] [jobs: <n>]",
+			Attrs:   []AttrMeta{shellAttr, jobsAttr},
+			Examples: []string{
+				"asdf nodejs@20.11.0 ruby@3.3.0",
+				"asdf nodejs@20.11.0 shell: fish",
+				"asdf nodejs@20.11.0 python@3.12.2 golang@1.22.1 jobs: 3",
+			},
+			OS:  []string{"mac", "linux"},
+			Doc: "asdf.md",
+		},
 		NewHandler: func(rule parser.Rule, basePath string, passwordCache map[string]string) Handler {
 			return NewAsdfHandler(rule, basePath)
 		},
@@ -115,8 +128,8 @@ func (h *AsdfHandler) Up() (string, error) {
 		needsInstall = true
 	} else {
 		// If asdf is installed, check if we need to update it
-		// Get the latest version available once
-		version, err := getLatestAsdfVersion()
+		// Get the pinned or latest version available once
+		version, err := asdfTargetVersion()
 		if err == nil {
 			latestVersion = version
 			// Get currently installed version
@@ -143,6 +156,7 @@ func (h *AsdfHandler) Up() (string, error) {
 
 	// Install plugins and versions, skipping any already installed.
 	var allCmds [][]string
+	pkgCmds := make(map[string][][]string, len(h.Rule.AsdfPackages))
 
 	for _, pkg := range h.Rule.AsdfPackages {
 		parts := strings.Split(pkg, "@")
@@ -167,20 +181,24 @@ func (h *AsdfHandler) Up() (string, error) {
 		}
 
 		// Skip plugin add if plugin is already present
+		var cmds [][]string
 		if !isAsdfPluginInstalled(plugin) {
-			allCmds = append(allCmds, []string{"plugin", "add", plugin})
+			cmds = append(cmds, []string{"plugin", "add", plugin})
 		}
-		allCmds = append(allCmds, []string{"install", plugin, version})
+		cmds = append(cmds, []string{"install", plugin, version})
+		pkgCmds[pkg] = cmds
+		allCmds = append(allCmds, cmds...)
 	}
 
-	// Execute each command directly (no shell) to avoid slow bash startup on zsh systems
 	bin := asdfBin()
+	if h.Rule.Jobs > 0 {
+		return h.upPerPackage(bin, pkgCmds)
+	}
+
+	// Execute each command directly (no shell) to avoid slow bash startup on zsh systems
 	for _, args := range allCmds {
-		cmd := exec.Command(bin, args...)
-		cmd.Stdin = nil
-		output, err := cmd.CombinedOutput()
-		if err != nil {
-			return fmt.Sprintf("Installation output:\n%s", string(output)), fmt.Errorf("failed to run asdf %s: %w", strings.Join(args, " "), err)
+		if output, err := runAsdf(bin, args); err != nil {
+			return fmt.Sprintf("Installation output:\n%s", output), err
 		}
 	}
 
@@ -193,8 +211,49 @@ func (h *AsdfHandler) Up() (string, error) {
 	return "installed asdf and plugins", nil
 }
 
+// upPerPackage runs the commands of each package on its own for jobs:, so a
+// version that fails to build does not fail the others. Versions of one
+// plugin still install one after another, as they share the plugin.
+func (h *AsdfHandler) upPerPackage(bin string, pkgCmds map[string][][]string) (string, error) {
+	locks := make(map[string]*sync.Mutex)
+	for _, pkg := range h.Rule.AsdfPackages {
+		locks[asdfPlugin(pkg)] = &sync.Mutex{}
+	}
+	return runTargets(h.Rule.AsdfPackages, h.Rule.Jobs, func(pkg string) error {
+		lock := locks[asdfPlugin(pkg)]
+		lock.Lock()
+		defer lock.Unlock()
+		for _, args := range pkgCmds[pkg] {
+			if output, err := runAsdf(bin, args); err != nil {
+				return fmt.Errorf("%w\n%s", err, strings.TrimSpace(output))
+			}
+		}
+		return nil
+	})
+}
+
+// asdfPlugin returns the plugin of a plugin@version package.
+func asdfPlugin(pkg string) string {
+	plugin, _, _ := strings.Cut(pkg, "@")
+	return strings.TrimSpace(plugin)
+}
+
+// runAsdf runs asdf directly (no shell) to avoid slow bash startup on zsh
+// systems, and returns its combined output. Var for test stubbing.
+var runAsdf = func(bin string, args []string) (string, error) {
+	cmd := exec.Command(bin, args...) // #nosec G204 -- plugin and version are validated
+	cmd.Stdin = nil
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return string(output), fmt.Errorf("failed to run asdf %s: %w", strings.Join(args, " "), err)
+	}
+	return string(output), nil
+}
+
 // Down uninstalls asdf packages and optionally asdf itself
 func (h *AsdfHandler) Down() (string, error) {
+	shell := ruleShell(h.Rule)
+
 	// Uninstall each version
 	for _, pkg := range h.Rule.AsdfPackages {
 		parts := strings.Split(pkg, "@")
@@ -212,12 +271,12 @@ func (h *AsdfHandler) Down() (string, error) {
 
 		// Uninstall version
 		uninstallCmd := fmt.Sprintf("asdf uninstall %s %s", plugin, version)
-		_ = exec.Command("sh", "-c", uninstallCmd).Run() // Continue even if uninstall fails
+		_ = shellExec(shell, uninstallCmd).Run() // Continue even if uninstall fails
 
 		// Check if there are any other versions of this plugin installed
 		// Only remove the plugin if no other versions exist
-		checkCmd := fmt.Sprintf(". ~/.bashrc 2>/dev/null || true && asdf list %s 2>/dev/null | grep -v '^ ' | wc -l", plugin)
-		output, err := exec.Command("sh", "-c", checkCmd).Output()
+		checkCmd := withShellRC(shell, fmt.Sprintf("asdf list %s 2>/dev/null | grep -v '^ ' | wc -l", plugin))
+		output, err := shellExec(shell, checkCmd).Output()
 		if err == nil {
 			// Count of installed versions (excluding system version)
 			versionCount := 0
@@ -225,16 +284,16 @@ func (h *AsdfHandler) Down() (string, error) {
 
 			// If no other versions exist, remove the plugin
 			if versionCount == 0 {
-				removeCmd := fmt.Sprintf(". ~/.bashrc 2>/dev/null || true && asdf plugin remove %s 2>/dev/null || true", plugin)
-				_ = exec.Command("sh", "-c", removeCmd).Run() // Continue even if remove fails
+				removeCmd := withShellRC(shell, fmt.Sprintf("asdf plugin remove %s 2>/dev/null || true", plugin))
+				_ = shellExec(shell, removeCmd).Run() // Continue even if remove fails
 			}
 		}
 	}
 
 	// Only uninstall asdf completely if there are no more plugins installed
 	// Check if asdf has any plugins left
-	checkPluginsCmd := `. ~/.bashrc 2>/dev/null || true && asdf plugin list 2>/dev/null | wc -l`
-	output, err := exec.Command("sh", "-c", checkPluginsCmd).Output()
+	checkPluginsCmd := withShellRC(shell, "asdf plugin list 2>/dev/null | wc -l")
+	output, err := shellExec(shell, checkPluginsCmd).Output()
 	pluginCount := 0
 	if err == nil {
 		_, _ = fmt.Sscanf(strings.TrimSpace(string(output)), "%d", &pluginCount)
@@ -254,7 +313,8 @@ func (h *AsdfHandler) Down() (string, error) {
 // getInstalledAsdfVersion returns the currently installed asdf version
 func (h *AsdfHandler) getInstalledAsdfVersion() (string, error) {
 	// Try to get version from asdf
-	cmd := exec.Command("sh", "-c", ". ~/.bashrc 2>/dev/null || true && asdf --version")
+	shell := ruleShell(h.Rule)
+	cmd := shellExec(shell, withShellRC(shell, "asdf --version"))
 	output, err := cmd.Output()
 	if err != nil {
 		return "", fmt.Errorf("failed to get asdf version: %w", err)
@@ -339,9 +399,10 @@ func (h *AsdfHandler) installAsdfLinuxWithVersion(version string) error {
 		return fmt.Errorf("failed to detect system architecture: %w", err)
 	}
 
-	// If version is empty, fetch the latest release version from GitHub API
+	// If version is empty, use the pinned release or fetch the latest from
+	// the GitHub API
 	if version == "" {
-		fetchedVersion, err := getLatestAsdfVersion()
+		fetchedVersion, err := asdfTargetVersion()
 		if err != nil {
 			return fmt.Errorf("failed to get latest asdf version: %w", err)
 		}
@@ -365,6 +426,9 @@ func (h *AsdfHandler) installAsdfLinuxWithVersion(version string) error {
 	if _, err := executeCommandWithCache(downloadCmd); err != nil {
 		return fmt.Errorf("failed to download asdf binary: %w", err)
 	}
+	if err := verifyFileSHA256(asdfTarPath, remoteInstallPolicy.AsdfSHA256); err != nil {
+		return fmt.Errorf("asdf release v%s does not match its pinned checksum: %w", version, err)
+	}
 
 	// Extract tar.gz to temp directory
 	extractCmd := fmt.Sprintf("tar -xzf %s -C %s", asdfTarPath, tmpDir)
@@ -500,10 +564,16 @@ func (h *AsdfHandler) UpdateStatus(status *Status, records []ExecutionRecord, bl
 			}
 		}
 
-		if commandExecuted {
+		// With jobs:, a failed rule may still have installed some packages
+		packages := h.Rule.AsdfPackages
+		if !commandExecuted {
+			packages = succeededTargets(h.GetCommand(), records, packages)
+		}
+
+		if len(packages) > 0 {
 			// Store individual asdf packages/plugins in dedicated status
 			// Just add entries for each package (don't remove, to allow multiple versions per plugin)
-			for _, pkg := range h.Rule.AsdfPackages {
+			for _, pkg := range packages {
 				parts := strings.Split(pkg, "@")
 				if len(parts) == 2 {
 					plugin := strings.TrimSpace(parts[0])
@@ -524,7 +594,7 @@ func (h *AsdfHandler) UpdateStatus(status *Status, records []ExecutionRecord, bl
 						status.Asdfs = append(status.Asdfs, AsdfStatus{
 							Plugin:      plugin,
 							Version:     version,
-							InstalledAt: time.Now().Format(time.RFC3339),
+							InstalledAt: timeutil.Now(),
 							Blueprint:   blueprint,
 							OS:          osName,
 						})
@@ -583,30 +653,18 @@ func (h *AsdfHandler) DisplayStatusFromStatus(status *Status) {
 
 	// Display asdf installation header if there are any asdf entries
 	if len(status.Asdfs) > 0 {
-		fmt.Printf("\n%s\n", ui.FormatHighlight("ASDF Version Manager:"))
 
-		// Group packages by their installation date (usually all at once)
 		// Display each installed plugin/version
+		rows := make([]statusRow, 0, len(status.Asdfs))
 		for _, asdf := range status.Asdfs {
-			// Parse timestamp for display
-			t, err := time.Parse(time.RFC3339, asdf.InstalledAt)
-			var timeStr string
-			if err == nil {
-				timeStr = t.Format("2006-01-02 15:04:05")
-			} else {
-				timeStr = asdf.InstalledAt
-			}
-
-			// Display plugin@version format
-			pluginVersion := fmt.Sprintf("%s@%s", asdf.Plugin, asdf.Version)
-			fmt.Printf("  %s %s (%s) [%s, %s]\n",
-				ui.FormatSuccess("●"),
-				ui.FormatInfo(pluginVersion),
-				ui.FormatDim(timeStr),
-				ui.FormatDim(asdf.OS),
-				ui.FormatDim(abbreviateBlueprintPath(asdf.Blueprint)),
-			)
+			rows = append(rows, statusRow{
+				name:    fmt.Sprintf("%s@%s", asdf.Plugin, asdf.Version),
+				details: []string{timeutil.Display(asdf.InstalledAt)},
+				tags:    []string{asdf.OS, abbreviateBlueprintPath(asdf.Blueprint)},
+				entry:   &asdf,
+			})
 		}
+		printStatusSection("ASDF Version Manager:", rows)
 	}
 }
 
@@ -811,6 +869,15 @@ func getSystemArchitecture() (string, error) {
 	}
 }
 
+// asdfTargetVersion returns the asdf release to install: the one pinned in
+// the policy, or else the latest.
+func asdfTargetVersion() (string, error) {
+	if v := remoteInstallPolicy.AsdfVersion; v != "" {
+		return strings.TrimPrefix(v, "v"), nil
+	}
+	return getLatestAsdfVersion()
+}
+
 // getLatestAsdfVersion fetches the latest asdf version from GitHub API
 func getLatestAsdfVersion() (string, error) {
 	// Check cache first to avoid repeated API calls
@@ -5,18 +5,33 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
-	"time"
 
 	"github.com/elpic/blueprint/internal"
 	cryptopkg "github.com/elpic/blueprint/internal/crypto"
 	"github.com/elpic/blueprint/internal/parser"
 	"github.com/elpic/blueprint/internal/ui"
+	"github.com/elpic/blueprint/internal/ui/timeutil"
 )
 
 func init() {
 	RegisterAction(ActionDef{
 		Name:   "authorized_keys",
 		Prefix: "authorized_keys",
+		Meta: ActionMeta{
+			Summary: "Add public keys to ~/.ssh/authorized_keys.",
+			Usage:   "authorized_keys file: <path> | authorized_keys encrypted: <file.enc> [password-id: <id>]",
+			Attrs: []AttrMeta{
+				{Name: "file", Type: "path", Description: "File holding the keys (file: or encrypted: is required)"},
+				{Name: "encrypted", Type: "path", Description: "Encrypted file holding the keys"},
+				{Name: "password-id", Type: "string", Description: "Password used for decryption, prompted once per id"},
+			},
+			Examples: []string{
+				"authorized_keys file: keys/laptop.pub",
+				"authorized_keys encrypted: keys/team.enc password-id: team",
+			},
+			OS:  []string{"mac", "linux"},
+			Doc: "authorized-keys.md",
+		},
 		NewHandler: func(rule parser.Rule, basePath string, passwordCache map[string]string) Handler {
 			return NewAuthorizedKeysHandler(rule, basePath, passwordCache)
 		},
@@ -246,7 +261,7 @@ func (h *AuthorizedKeysHandler) UpdateStatus(status *Status, records []Execution
 			status.AuthorizedKeys = removeAuthorizedKeysStatus(status.AuthorizedKeys, source, blueprint, osName)
 			status.AuthorizedKeys = append(status.AuthorizedKeys, AuthorizedKeysStatus{
 				Source:    source,
-				AddedAt:   time.Now().Format(time.RFC3339),
+				AddedAt:   timeutil.Now(),
 				Blueprint: blueprint,
 				OS:        osName,
 			})
@@ -266,12 +281,12 @@ func (h *AuthorizedKeysHandler) DisplayInfo() {
 	}
 
 	if h.Rule.AuthorizedKeysEncrypted != "" {
-		fmt.Printf("  %s\n", formatFunc(fmt.Sprintf("Encrypted: %s", h.Rule.AuthorizedKeysEncrypted)))
+		printInfo(formatFunc, "Encrypted", h.Rule.AuthorizedKeysEncrypted)
 		if h.Rule.AuthorizedKeysPasswordID != "" {
-			fmt.Printf("  %s\n", formatFunc(fmt.Sprintf("Password ID: %s", h.Rule.AuthorizedKeysPasswordID)))
+			printInfo(formatFunc, "Password ID", h.Rule.AuthorizedKeysPasswordID)
 		}
 	} else {
-		fmt.Printf("  %s\n", formatFunc(fmt.Sprintf("File: %s", h.Rule.AuthorizedKeysFile)))
+		printInfo(formatFunc, "File", h.Rule.AuthorizedKeysFile)
 	}
 }
 
@@ -420,22 +435,14 @@ func (h *AuthorizedKeysHandler) DisplayStatusFromStatus(status *Status) {
 		return
 	}
 
-	fmt.Printf("\n%s\n", ui.FormatHighlight("Authorized Keys:"))
+	rows := make([]statusRow, 0, len(status.AuthorizedKeys))
 	for _, ak := range status.AuthorizedKeys {
-		t, err := time.Parse(time.RFC3339, ak.AddedAt)
-		var timeStr string
-		if err == nil {
-			timeStr = t.Format("2006-01-02 15:04:05")
-		} else {
-			timeStr = ak.AddedAt
-		}
-
-		fmt.Printf("  %s %s (%s) [%s, %s]\n",
-			ui.FormatSuccess("●"),
-			ui.FormatInfo(ak.Source),
-			ui.FormatDim(timeStr),
-			ui.FormatDim(ak.OS),
-			ui.FormatDim(abbreviateBlueprintPath(ak.Blueprint)),
-		)
-	}
+		rows = append(rows, statusRow{
+			name:    ak.Source,
+			details: []string{timeutil.Display(ak.AddedAt)},
+			tags:    []string{ak.OS, abbreviateBlueprintPath(ak.Blueprint)},
+			entry:   &ak,
+		})
+	}
+	printStatusSection("Authorized Keys:", rows)
 }
@@ -0,0 +1,311 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/elpic/blueprint/internal/parser"
+	"github.com/elpic/blueprint/internal/ui"
+	"github.com/elpic/blueprint/internal/ui/timeutil"
+)
+
+func init() {
+	RegisterAction(ActionDef{
+		Name:   "autostart",
+		Prefix: "autostart ",
+		Meta: ActionMeta{
+			Summary: "Start a program at login, with an XDG autostart entry (Linux) or a LaunchAgent (macOS).",
+			Usage:   "autostart <name> exec: <command>",
+			Attrs: []AttrMeta{
+				{Name: "exec", Type: "string", Required: true, Description: "Command run at login, with its arguments"},
+			},
+			Examples: []string{
+				"autostart \"Syncthing\" exec: syncthing serve --no-browser",
+				"autostart redshift exec: redshift-gtk on: [linux]",
+			},
+			OS:  []string{"mac", "linux"},
+			Doc: "autostart.md",
+		},
+		NewHandler: func(rule parser.Rule, basePath string, passwordCache map[string]string) Handler {
+			return NewAutostartHandler(rule, basePath)
+		},
+		RuleKey: func(rule parser.Rule) string {
+			return "autostart-" + parser.AutostartSlug(rule.AutostartName)
+		},
+		Detect: func(rule parser.Rule) bool {
+			return rule.AutostartName != ""
+		},
+		Summary: func(rule parser.Rule) string {
+			return rule.AutostartName
+		},
+		OrphanIndex: func(rule parser.Rule, index func(string)) {
+			index(rule.AutostartName)
+		},
+		Verify: func(e StatusEntry) bool {
+			return pathExists(expandPath(e.(*AutostartStatus).Path))
+		},
+		ShellExport: func(rule parser.Rule, _, osName string) []string {
+			path := shellHome(autostartPath(rule.AutostartName, osName))
+			return []string{
+				fmt.Sprintf("mkdir -p \"$(dirname %s)\"", path),
+				fmt.Sprintf("printf '%%s' %s > %s", shellQ(autostartContent(rule, osName)), path),
+			}
+		},
+	})
+}
+
+// AutostartHandler starts a program at login: it writes an XDG autostart
+// .desktop file in ~/.config/autostart on Linux and a LaunchAgent plist in
+// ~/Library/LaunchAgents on macOS. Files are named after the rule so that
+// entries installed otherwise are never overwritten.
+type AutostartHandler struct {
+	BaseHandler
+}
+
+// NewAutostartHandler creates a new autostart handler
+func NewAutostartHandler(rule parser.Rule, basePath string) *AutostartHandler {
+	return &AutostartHandler{
+		BaseHandler: BaseHandler{
+			Rule:     rule,
+			BasePath: basePath,
+		},
+	}
+}
+
+// autostartLabel returns the launchd label of the login item name.
+func autostartLabel(name string) string {
+	return "com.blueprint.autostart." + parser.AutostartSlug(name)
+}
+
+// autostartPath returns where the login item name is written on osName,
+// starting with ~.
+func autostartPath(name, osName string) string {
+	if osName == "mac" {
+		return "~/Library/LaunchAgents/" + autostartLabel(name) + ".plist"
+	}
+	return "~/.config/autostart/blueprint-" + parser.AutostartSlug(name) + ".desktop"
+}
+
+// autostartContent returns the file that starts rule's command at login on
+// osName.
+func autostartContent(rule parser.Rule, osName string) string {
+	if osName == "mac" {
+		return fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+	<key>Label</key>
+	<string>%s</string>
+	<key>ProgramArguments</key>
+	<array>
+		<string>/bin/sh</string>
+		<string>-c</string>
+		<string>%s</string>
+	</array>
+	<key>RunAtLoad</key>
+	<true/>
+</dict>
+</plist>
+`, xmlEscape(autostartLabel(rule.AutostartName)), xmlEscape(rule.AutostartExec))
+	}
+	return fmt.Sprintf(`[Desktop Entry]
+Type=Application
+Name=%s
+Exec=%s
+X-GNOME-Autostart-enabled=true
+Comment=Installed by blueprint
+`, rule.AutostartName, rule.AutostartExec)
+}
+
+// xmlEscape escapes s for the text of an XML element.
+func xmlEscape(s string) string {
+	var b bytes.Buffer
+	_ = xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+// path returns the file this rule writes, expanded.
+func (h *AutostartHandler) path() string {
+	return expandPath(autostartPath(h.Rule.AutostartName, getOSName()))
+}
+
+// checkOS fails on systems without XDG autostart or launchd support.
+func (h *AutostartHandler) checkOS() error {
+	if osName := getOSName(); osName != "mac" && osName != "linux" {
+		return fmt.Errorf("autostart is not supported on %s", osName)
+	}
+	return nil
+}
+
+// Up writes the login item
+func (h *AutostartHandler) Up() (string, error) {
+	if err := h.checkOS(); err != nil {
+		return "", err
+	}
+	path := h.path()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil { // #nosec G301 -- standard per-user directories
+		return "", fmt.Errorf("failed to create %s: %w", filepath.Dir(path), err)
+	}
+	if err := os.WriteFile(path, []byte(autostartContent(h.Rule, getOSName())), 0o644); err != nil { // #nosec G306 -- login items are read by the session
+		return "", fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return fmt.Sprintf("%s starts at login (%s)", h.Rule.AutostartName, ui.AbbreviateHome(path)), nil
+}
+
+// Down removes the login item
+func (h *AutostartHandler) Down() (string, error) {
+	if err := h.checkOS(); err != nil {
+		return "", err
+	}
+	path := h.path()
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return "", fmt.Errorf("failed to remove %s: %w", path, err)
+	}
+	return fmt.Sprintf("%s no longer starts at login", h.Rule.AutostartName), nil
+}
+
+// IsSatisfied reports whether the login item is already written as the rule
+// would write it
+func (h *AutostartHandler) IsSatisfied() (bool, error) {
+	data, err := os.ReadFile(h.path()) // #nosec G304 -- path derived from the rule's name
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return string(data) == autostartContent(h.Rule, getOSName()), nil
+}
+
+// GetCommand returns a description of what the rule does to the file
+func (h *AutostartHandler) GetCommand() string {
+	path := autostartPath(h.Rule.AutostartName, getOSName())
+	if h.Rule.Action == "uninstall" {
+		return "rm -f " + path
+	}
+	return "write " + path
+}
+
+// UpdateStatus records the login item, or removes the one removed
+func (h *AutostartHandler) UpdateStatus(status *Status, records []ExecutionRecord, blueprint string, osName string) error {
+	blueprint = normalizeBlueprint(blueprint)
+
+	if _, ok := commandSuccessfullyExecuted(h.GetCommand(), records); !ok {
+		return nil
+	}
+	status.Autostarts = removeAutostartStatus(status.Autostarts, h.Rule.AutostartName, blueprint, osName)
+	if h.Rule.Action == "autostart" {
+		status.Autostarts = append(status.Autostarts, AutostartStatus{
+			Name:        h.Rule.AutostartName,
+			Exec:        h.Rule.AutostartExec,
+			Path:        autostartPath(h.Rule.AutostartName, osName),
+			InstalledAt: timeutil.Now(),
+			Blueprint:   blueprint,
+			OS:          osName,
+		})
+	}
+	return nil
+}
+
+// GetDependencyKey returns the unique key for this rule in dependency resolution
+func (h *AutostartHandler) GetDependencyKey() string {
+	return getDependencyKey(h.Rule, "autostart-"+parser.AutostartSlug(h.Rule.AutostartName))
+}
+
+// GetDisplayDetails returns the login item to display during execution
+func (h *AutostartHandler) GetDisplayDetails(isUninstall bool) string {
+	return h.Rule.AutostartName
+}
+
+// DisplayInfo displays handler-specific information
+func (h *AutostartHandler) DisplayInfo() {
+	formatFunc := ui.FormatInfo
+	if h.Rule.Action == "uninstall" {
+		formatFunc = ui.FormatDim
+	}
+
+	printInfo(formatFunc, "Login item", h.Rule.AutostartName)
+	if h.Rule.AutostartExec != "" {
+		printInfo(formatFunc, "Exec", h.Rule.AutostartExec)
+	}
+}
+
+// DisplayStatusFromStatus displays autostart handler status from Status object
+func (h *AutostartHandler) DisplayStatusFromStatus(status *Status) {
+	if status == nil || len(status.Autostarts) == 0 {
+		return
+	}
+
+	rows := make([]statusRow, 0, len(status.Autostarts))
+	for _, a := range status.Autostarts {
+		rows = append(rows, statusRow{
+			name:    a.Name,
+			details: []string{a.Exec, timeutil.Display(a.InstalledAt)},
+			tags:    []string{a.OS, abbreviateBlueprintPath(a.Blueprint)},
+			entry:   &a,
+		})
+	}
+	printStatusSection("Login Items:", rows)
+}
+
+// GetState returns handler-specific state as key-value pairs
+func (h *AutostartHandler) GetState(isUninstall bool) map[string]string {
+	return map[string]string{
+		"summary": h.GetDisplayDetails(isUninstall),
+		"name":    h.Rule.AutostartName,
+		"exec":    h.Rule.AutostartExec,
+	}
+}
+
+// FindUninstallRules compares autostart status against current rules and
+// returns rules that remove the login items no longer in the blueprint
+func (h *AutostartHandler) FindUninstallRules(status *Status, currentRules []parser.Rule, blueprintFile, osName string) []parser.Rule {
+	normalizedBlueprint := normalizeBlueprint(blueprintFile)
+
+	current := make(map[string]bool)
+	for _, rule := range currentRules {
+		if rule.Action == "autostart" {
+			current[rule.AutostartName] = true
+		}
+	}
+
+	var rules []parser.Rule
+	for _, a := range status.Autostarts {
+		if normalizeBlueprint(a.Blueprint) == normalizedBlueprint && a.OS == osName && !current[a.Name] {
+			rules = append(rules, parser.Rule{
+				Action:        "uninstall",
+				AutostartName: a.Name,
+				OSList:        []string{osName},
+			})
+		}
+	}
+	return rules
+}
+
+// IsInstalled returns true if the login item is in status with the same command.
+func (h *AutostartHandler) IsInstalled(status *Status, blueprintFile, osName string) bool {
+	return h.PlanChange(status, blueprintFile, osName) == PlanNoOp
+}
+
+// PlanChange reports an update when the login item is recorded with
+// another command.
+func (h *AutostartHandler) PlanChange(status *Status, blueprintFile, osName string) PlanChange {
+	normalizedBlueprint := normalizeBlueprint(blueprintFile)
+	for _, a := range status.Autostarts {
+		if a.Name == h.Rule.AutostartName && normalizeBlueprint(a.Blueprint) == normalizedBlueprint && a.OS == osName {
+			if strings.TrimSpace(a.Exec) == strings.TrimSpace(h.Rule.AutostartExec) {
+				return PlanNoOp
+			}
+			return PlanUpdate
+		}
+	}
+	return PlanCreate
+}
+
+func removeAutostartStatus(sl []AutostartStatus, name, blueprint, osName string) []AutostartStatus {
+	return removeStatusEntry[AutostartStatus, *AutostartStatus](sl, name, blueprint, osName)
+}
@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/elpic/blueprint/internal/parser"
+)
+
+// stubAutostartHome points the home directory at a temporary one and stubs
+// the OS.
+func stubAutostartHome(t *testing.T, osName string) string {
+	t.Helper()
+	origHome, origOS := homeDir, getOSName
+	t.Cleanup(func() { homeDir, getOSName = origHome, origOS })
+
+	home := t.TempDir()
+	homeDir = &mockHomeDirProvider{homeDir: home}
+	getOSName = func() string { return osName }
+	return home
+}
+
+func TestAutostartHandlerLinux(t *testing.T) {
+	home := stubAutostartHome(t, "linux")
+
+	rule := parser.Rule{Action: "autostart", AutostartName: "Syncthing", AutostartExec: "syncthing serve --no-browser"}
+	h := NewAutostartHandler(rule, "")
+	if _, err := h.Up(); err != nil {
+		t.Fatalf("Up() error: %v", err)
+	}
+	path := filepath.Join(home, ".config", "autostart", "blueprint-syncthing.desktop")
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "Name=Syncthing\nExec=syncthing serve --no-browser\n") {
+		t.Errorf("desktop file = %q", data)
+	}
+	if ok, _ := h.IsSatisfied(); !ok {
+		t.Error("IsSatisfied() = false after Up")
+	}
+
+	status := &Status{}
+	records := []ExecutionRecord{{Command: h.GetCommand(), Status: "success"}}
+	if err := h.UpdateStatus(status, records, "/tmp/setup.bp", "linux"); err != nil {
+		t.Fatal(err)
+	}
+	if len(status.Autostarts) != 1 || status.Autostarts[0].Path != "~/.config/autostart/blueprint-syncthing.desktop" {
+		t.Fatalf("status autostarts = %+v", status.Autostarts)
+	}
+	if !h.IsInstalled(status, "/tmp/setup.bp", "linux") {
+		t.Error("IsInstalled() = false after UpdateStatus")
+	}
+	changed := NewAutostartHandler(parser.Rule{Action: "autostart", AutostartName: "Syncthing", AutostartExec: "syncthing"}, "")
+	if got := changed.PlanChange(status, "/tmp/setup.bp", "linux"); got != PlanUpdate {
+		t.Errorf("PlanChange() with another exec = %q, want update", got)
+	}
+
+	// Removing the rule from the blueprint removes the file
+	uninstall := h.FindUninstallRules(status, nil, "/tmp/setup.bp", "linux")
+	if len(uninstall) != 1 || uninstall[0].AutostartName != "Syncthing" {
+		t.Fatalf("FindUninstallRules() = %+v", uninstall)
+	}
+	down := NewAutostartHandler(uninstall[0], "")
+	if _, err := down.Down(); err != nil {
+		t.Fatalf("Down() error: %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("desktop file still there after Down: %v", err)
+	}
+	records = []ExecutionRecord{{Command: down.GetCommand(), Status: "success"}}
+	if err := down.UpdateStatus(status, records, "/tmp/setup.bp", "linux"); err != nil {
+		t.Fatal(err)
+	}
+	if len(status.Autostarts) != 0 {
+		t.Errorf("status autostarts after uninstall = %+v", status.Autostarts)
+	}
+}
+
+func TestAutostartHandlerMac(t *testing.T) {
+	home := stubAutostartHome(t, "mac")
+
+	h := NewAutostartHandler(parser.Rule{Action: "autostart", AutostartName: "Backup & Sync", AutostartExec: "open -a 'Backup & Sync'"}, "")
+	if _, err := h.Up(); err != nil {
+		t.Fatalf("Up() error: %v", err)
+	}
+	data, err := os.ReadFile(filepath.Join(home, "Library", "LaunchAgents", "com.blueprint.autostart.backup-sync.plist"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"<string>com.blueprint.autostart.backup-sync</string>",
+		"<string>open -a &#39;Backup &amp; Sync&#39;</string>",
+		"<key>RunAtLoad</key>",
+	} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("plist does not contain %q:\n%s", want, data)
+		}
+	}
+}
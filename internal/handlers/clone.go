@@ -2,18 +2,41 @@ package handlers
 
 import (
 	"fmt"
-	"time"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 
 	gitpkg "github.com/elpic/blueprint/internal/git"
 	"github.com/elpic/blueprint/internal/parser"
 	"github.com/elpic/blueprint/internal/platform"
+	"github.com/elpic/blueprint/internal/prompt"
 	"github.com/elpic/blueprint/internal/ui"
+	"github.com/elpic/blueprint/internal/ui/timeutil"
 )
 
 func init() {
 	RegisterAction(ActionDef{
 		Name:   "clone",
 		Prefix: "clone ",
+		Meta: ActionMeta{
+			Summary: "Clone a git repository and keep it up to date.",
+			Usage:   "clone <url> to: <path> [branch: <branch>] [workdir: true] [apply: true|<file>] [replace: true]",
+			Attrs: []AttrMeta{
+				{Name: "to", Type: "path", Required: true, Description: "Destination path"},
+				{Name: "branch", Type: "string", Description: "Git branch to check out (default: the remote's default branch)"},
+				{Name: "workdir", Type: "bool", Default: "false", Description: "true keeps .git for a working copy"},
+				{Name: "apply", Type: "path", Description: "Blueprint in the repository to apply after cloning; true means " + parser.DefaultCloneBlueprint},
+				{Name: "replace", Type: "bool", Default: "false", Description: "true replaces what is at the destination when it is not a clone of this repository"},
+			},
+			Examples: []string{
+				"clone https://github.com/ohmyzsh/ohmyzsh.git to: ~/.oh-my-zsh",
+				"clone git@github.com:user/notes.git to: ~/notes branch: main workdir: true",
+				"clone https://github.com/user/dotfiles.git to: ~/dotfiles apply: true",
+			},
+			OS:  []string{"mac", "linux"},
+			Doc: "clone.md",
+		},
 		NewHandler: func(rule parser.Rule, basePath string, passwordCache map[string]string) Handler {
 			return NewCloneHandler(rule, basePath, platform.NewContainer())
 		},
@@ -29,6 +52,22 @@ func init() {
 		OrphanIndex: func(rule parser.Rule, index func(string)) {
 			index(rule.ClonePath)
 		},
+		Verify: func(e StatusEntry) bool {
+			return pathExists(filepath.Join(expandPath(e.(*CloneStatus).Path), ".git"))
+		},
+		Refresh: func(entries []StatusEntry) []string {
+			var changes []string
+			for _, e := range entries {
+				c := e.(*CloneStatus)
+				sha := localSHA(expandPath(c.Path))
+				if sha == "" || sha == c.SHA {
+					continue
+				}
+				changes = append(changes, fmt.Sprintf("%s: %s → %s", c.Path, shortSHA(c.SHA), shortSHA(sha)))
+				c.SHA = sha
+			}
+			return changes
+		},
 		ShellExport: func(rule parser.Rule, _, _ string) []string {
 			path := shellHome(rule.ClonePath)
 			branchFlag := ""
@@ -76,6 +115,10 @@ var remoteHeadSHA = func(url, branch string) string {
 	return gitpkg.RemoteHeadSHA(url, branch)
 }
 
+// remoteHeadSHAWithError is remoteHeadSHA, with the error when the remote
+// cannot be asked. Var for test stubbing.
+var remoteHeadSHAWithError = gitpkg.RemoteHeadSHAWithError
+
 // CloneHandler handles git repository cloning and cleanup
 type CloneHandler struct {
 	BaseHandler
@@ -103,6 +146,10 @@ func NewCloneHandlerLegacy(rule parser.Rule, basePath string) *CloneHandler {
 // Otherwise the default two-stage approach is used: clone to clean storage then
 // copy files without .git, preventing accidental pollution of the target.
 func (h *CloneHandler) Up() (string, error) {
+	if err := h.checkDestination(); err != nil {
+		return "", err
+	}
+
 	var oldSHA, newSHA, status string
 	var err error
 	if h.Rule.CloneWorkdir {
@@ -157,6 +204,146 @@ func (h *CloneHandler) Up() (string, error) {
 	}
 }
 
+// destinationConflict describes what is at the clone destination when it is
+// something the clone would overwrite: a file, a clone of another repository,
+// or a directory that is not a repository and that blueprint did not clone
+// there. It returns "" when the destination is missing, empty, or already a
+// clone of the rule's repository.
+func (h *CloneHandler) destinationConflict() string {
+	path := expandPath(h.Rule.ClonePath)
+	info, err := os.Stat(path)
+	if err != nil {
+		return ""
+	}
+	if !info.IsDir() {
+		return "is a file"
+	}
+	entries, err := os.ReadDir(path)
+	if err != nil || len(entries) == 0 {
+		return ""
+	}
+	contents := describeEntries(entries)
+
+	if pathExists(filepath.Join(path, ".git")) {
+		origin := gitpkg.OriginURL(path)
+		switch {
+		case origin == "":
+			return "is a git repository without an origin remote (" + contents + ")"
+		case !gitpkg.SameRepository(origin, h.Rule.CloneURL):
+			return "is a clone of " + origin
+		}
+		return ""
+	}
+	// Two-stage clones leave no .git in the destination: a directory status
+	// records a clone of this repository at was put there by a previous run
+	if h.clonedHere() {
+		return ""
+	}
+	return "is not a git repository (" + contents + ")"
+}
+
+// clonedHere reports whether status records a clone of the rule's repository
+// at its destination.
+func (h *CloneHandler) clonedHere() bool {
+	path := expandPath(h.Rule.ClonePath)
+	for _, c := range CurrentStatus().Clones {
+		if expandPath(c.Path) == path && gitpkg.SameRepository(c.URL, h.Rule.CloneURL) {
+			return true
+		}
+	}
+	return false
+}
+
+// describeEntries lists the first few entries of a directory, directories
+// with a trailing slash.
+func describeEntries(entries []os.DirEntry) string {
+	const shown = 5
+	var names []string
+	for i, entry := range entries {
+		if i == shown {
+			names = append(names, fmt.Sprintf("and %d more", len(entries)-shown))
+			break
+		}
+		name := entry.Name()
+		if entry.IsDir() {
+			name += "/"
+		}
+		names = append(names, name)
+	}
+	return "contains " + strings.Join(names, ", ")
+}
+
+// checkDestination makes sure the clone does not overwrite or reset something
+// that is not its repository. When the destination holds something else it is
+// removed if the rule has replace: true or the user agrees to replace it at
+// the terminal; otherwise the rule fails saying what is there.
+func (h *CloneHandler) checkDestination() error {
+	conflict := h.destinationConflict()
+	if conflict == "" {
+		return nil
+	}
+	path := expandPath(h.Rule.ClonePath)
+	if !h.Rule.CloneReplace && !confirmReplace(fmt.Sprintf("%s %s. Replace it with a clone of %s?", h.Rule.ClonePath, conflict, h.Rule.CloneURL)) {
+		return fmt.Errorf("%s %s; add replace: true to the rule to replace it", h.Rule.ClonePath, conflict)
+	}
+	if err := os.RemoveAll(path); err != nil {
+		return fmt.Errorf("failed to remove %s: %w", h.Rule.ClonePath, err)
+	}
+	return nil
+}
+
+// askAbove runs ask, which asks the user a question, with the status line of
+// the apply cleared. Set by the engine while it shows the line.
+var askAbove = func(ask func()) { ask() }
+
+// SetAskAbove sets how questions asked while rules run make room on the
+// terminal; nil asks them directly.
+func SetAskAbove(fn func(ask func())) {
+	if fn == nil {
+		fn = func(ask func()) { ask() }
+	}
+	askAbove = fn
+}
+
+// confirmMu keeps rules running at once from asking at the same time.
+var confirmMu sync.Mutex
+
+// confirmReplace asks whether to replace what is at a clone destination. Only
+// an answer typed at the terminal replaces it: --yes and a stdin that is not
+// a terminal keep it. Defined as a var to allow stubbing in tests.
+var confirmReplace = func(question string) bool {
+	p := prompt.Default()
+	if p.AssumeYes || !p.Interactive {
+		return false
+	}
+	confirmMu.Lock()
+	defer confirmMu.Unlock()
+	var ok bool
+	askAbove(func() {
+		answer, err := p.Confirm(question, false)
+		ok = err == nil && answer
+	})
+	return ok
+}
+
+// FollowUpRules returns the rules of the blueprint apply: names inside the
+// clone, which the engine applies after it. A repository without that file
+// has none.
+func (h *CloneHandler) FollowUpRules() ([]parser.Rule, error) {
+	if h.Rule.CloneApply == "" {
+		return nil, nil
+	}
+	path := filepath.Join(expandPath(h.Rule.ClonePath), h.Rule.CloneApply)
+	if !pathExists(path) {
+		return nil, nil
+	}
+	rules, err := parser.ParseFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", h.Rule.CloneApply, err)
+	}
+	return rules, nil
+}
+
 // Down removes the cloned repository
 func (h *CloneHandler) Down() (string, error) {
 	clonePath := h.Container.SystemProvider().Filesystem().ExpandPath(h.Rule.ClonePath)
@@ -200,6 +387,12 @@ func (h *CloneHandler) UpdateStatus(status *Status, records []ExecutionRecord, b
 
 		if commandExecuted {
 			cloneSHA := extractSHAFromOutput(record.Output)
+			// A clone apply skipped as already satisfied printed no SHA
+			if cloneSHA == "" {
+				if repoPath, err := h.repositoryPath(); err == nil {
+					cloneSHA = gitpkg.LocalSHA(repoPath)
+				}
+			}
 			// Remove existing entry if present
 			status.Clones = removeCloneStatus(status.Clones, h.Rule.ClonePath, blueprint, osName)
 			// Add new entry
@@ -207,7 +400,7 @@ func (h *CloneHandler) UpdateStatus(status *Status, records []ExecutionRecord, b
 				URL:       h.Rule.CloneURL,
 				Path:      h.Rule.ClonePath,
 				SHA:       cloneSHA,
-				ClonedAt:  time.Now().Format(time.RFC3339),
+				ClonedAt:  timeutil.Now(),
 				Blueprint: blueprint,
 				OS:        osName,
 			})
@@ -231,10 +424,10 @@ func (h *CloneHandler) DisplayInfo() {
 		formatFunc = ui.FormatDim
 	}
 
-	fmt.Printf("  %s\n", formatFunc(fmt.Sprintf("URL: %s", h.Rule.CloneURL)))
-	fmt.Printf("  %s\n", formatFunc(fmt.Sprintf("Path: %s", h.Rule.ClonePath)))
+	printInfo(formatFunc, "URL", h.Rule.CloneURL)
+	printInfo(formatFunc, "Path", h.Rule.ClonePath)
 	if h.Rule.Branch != "" {
-		fmt.Printf("  %s\n", formatFunc(fmt.Sprintf("Branch: %s", h.Rule.Branch)))
+		printInfo(formatFunc, "Branch", h.Rule.Branch)
 	}
 }
 
@@ -256,29 +449,17 @@ func (h *CloneHandler) DisplayStatus(clones []CloneStatus) {
 		return
 	}
 
-	fmt.Printf("\n%s\n", ui.FormatHighlight("Cloned Repositories:"))
+	rows := make([]statusRow, 0, len(regularClones))
 	for _, clone := range regularClones {
-		// Parse timestamp for display
-		t, err := time.Parse(time.RFC3339, clone.ClonedAt)
-		var timeStr string
-		if err == nil {
-			timeStr = t.Format("2006-01-02 15:04:05")
-		} else {
-			timeStr = clone.ClonedAt
-		}
-
-		fmt.Printf("  %s %s (%s) [%s, %s]\n",
-			ui.FormatSuccess("●"),
-			ui.FormatInfo(clone.Path),
-			ui.FormatDim(timeStr),
-			ui.FormatDim(clone.OS),
-			ui.FormatDim(abbreviateBlueprintPath(clone.Blueprint)),
-		)
-		fmt.Printf("     %s %s\n",
-			ui.FormatDim("URL:"),
-			ui.FormatInfo(clone.URL),
-		)
+		rows = append(rows, statusRow{
+			name:    clone.Path,
+			details: []string{timeutil.Display(clone.ClonedAt)},
+			tags:    []string{clone.OS, abbreviateBlueprintPath(clone.Blueprint)},
+			entry:   &clone,
+			sub:     [][2]string{{"URL", clone.URL}},
+		})
 	}
+	printStatusSection("Cloned Repositories:", rows)
 }
 
 // DisplayStatusFromStatus displays clone handler status from Status object
@@ -396,3 +577,39 @@ func (h *CloneHandler) IsInstalled(status *Status, blueprintFile, osName string)
 	}
 	return false
 }
+
+// IsSatisfied reports whether the destination is a clone of the rule's
+// repository, already checked out at the commit the remote branch points
+// to, so there is nothing to fetch. A destination holding something else is
+// left to Up, which replaces it or fails saying what is there.
+func (h *CloneHandler) IsSatisfied() (bool, error) {
+	if !h.Container.SystemProvider().Filesystem().Exists(expandPath(h.Rule.ClonePath)) {
+		return false, nil
+	}
+	if h.destinationConflict() != "" {
+		return false, nil
+	}
+	repoPath, err := h.repositoryPath()
+	if err != nil {
+		return false, err
+	}
+	local := localSHA(repoPath)
+	if local == "" {
+		return false, nil
+	}
+	remote, err := remoteHeadSHAWithError(h.Rule.CloneURL, h.Rule.Branch)
+	if err != nil {
+		return false, err
+	}
+	return local == remote, nil
+}
+
+// repositoryPath returns where the git repository of the clone lives: the
+// target itself for workdir clones, the storage copy otherwise, as two-stage
+// clones only copy its files out to the target.
+func (h *CloneHandler) repositoryPath() (string, error) {
+	if h.Rule.CloneWorkdir {
+		return expandPath(h.Rule.ClonePath), nil
+	}
+	return gitpkg.RepositoryStoragePath(h.Rule.CloneURL, h.Rule.Branch)
+}
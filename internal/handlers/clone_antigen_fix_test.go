@@ -18,12 +18,14 @@ func TestAntigenZshPollutionFix(t *testing.T) {
 	origRemote := remoteHeadSHA
 	origTwoStage := gitpkg.CloneOrUpdateRepositoryTwoStage
 	origCleanSHA := gitpkg.GetCleanRepositorySHA
+	origStatus := CurrentStatus
 
 	defer func() {
 		localSHA = origLocal
 		remoteHeadSHA = origRemote
 		gitpkg.CloneOrUpdateRepositoryTwoStage = origTwoStage
 		gitpkg.GetCleanRepositorySHA = origCleanSHA
+		CurrentStatus = origStatus
 	}()
 
 	t.Run("Oh-My-Zsh clone preserves antigen.zsh file", func(t *testing.T) {
@@ -85,6 +87,11 @@ source ~/.oh-my-zsh/lib/theme-and-appearance.zsh
 		localSHA = func(string) string { return testSHA }
 		remoteHeadSHA = func(string, string) string { return testSHA }
 		gitpkg.GetCleanRepositorySHA = func(url, branch string) string { return testSHA }
+		// Status records the clone of rule #10, which antigen.zsh was
+		// downloaded into afterwards
+		CurrentStatus = func() Status {
+			return Status{Clones: []CloneStatus{{URL: ohMyZshRule.CloneURL, Path: ohMyZshPath, SHA: testSHA}}}
+		}
 
 		// First clone execution
 		output, err := handler.Up()
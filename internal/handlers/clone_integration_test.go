@@ -17,12 +17,14 @@ func TestCloneRepositoryPollutionFix(t *testing.T) {
 	origRemote := remoteHeadSHA
 	origTwoStage := gitpkg.CloneOrUpdateRepositoryTwoStage
 	origCleanSHA := gitpkg.GetCleanRepositorySHA
+	origStatus := CurrentStatus
 
 	defer func() {
 		localSHA = origLocal
 		remoteHeadSHA = origRemote
 		gitpkg.CloneOrUpdateRepositoryTwoStage = origTwoStage
 		gitpkg.GetCleanRepositorySHA = origCleanSHA
+		CurrentStatus = origStatus
 	}()
 
 	t.Run("User files survive repository clone operations", func(t *testing.T) {
@@ -80,6 +82,10 @@ func TestCloneRepositoryPollutionFix(t *testing.T) {
 		localSHA = func(string) string { return testSHA }
 		remoteHeadSHA = func(string, string) string { return testSHA }
 		gitpkg.GetCleanRepositorySHA = func(url, branch string) string { return testSHA }
+		// Status records the clone that created the target
+		CurrentStatus = func() Status {
+			return Status{Clones: []CloneStatus{{URL: rule.CloneURL, Path: targetPath, SHA: testSHA}}}
+		}
 
 		// Execute clone operation
 		output, err := handler.Up()
@@ -9,6 +9,9 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+
 	"github.com/elpic/blueprint/internal/parser"
 )
 
@@ -524,3 +527,175 @@ func TestCloneHandlerGetDependencyKey(t *testing.T) {
 		})
 	}
 }
+
+func TestCloneRefreshUpdatesSHA(t *testing.T) {
+	orig := localSHA
+	defer func() { localSHA = orig }()
+	localSHA = func(path string) string {
+		if path == "/tmp/moved" {
+			return "bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb"
+		}
+		return "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"
+	}
+
+	clones := []CloneStatus{
+		{Path: "/tmp/same", SHA: "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"},
+		{Path: "/tmp/moved", SHA: "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"},
+	}
+	changes := GetAction("clone").Refresh([]StatusEntry{&clones[0], &clones[1]})
+	if len(changes) != 1 || changes[0] != "/tmp/moved: aaaaaaaa → bbbbbbbb" {
+		t.Errorf("Refresh() = %v", changes)
+	}
+	if clones[1].SHA != "bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb" || clones[0].SHA != "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa" {
+		t.Errorf("clones = %+v, want only the moved clone's SHA updated", clones)
+	}
+}
+
+func TestCloneCheckDestination(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	orig := confirmReplace
+	t.Cleanup(func() { confirmReplace = orig })
+	asked := 0
+	confirmReplace = func(string) bool {
+		asked++
+		return false
+	}
+
+	dir := t.TempDir()
+	notes := filepath.Join(dir, "notes")
+	if err := os.MkdirAll(filepath.Join(notes, "drafts"), 0o750); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(notes, "todo.txt"), []byte("keep me"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	other := filepath.Join(dir, "other")
+	repo, err := git.PlainInit(other, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.CreateRemote(&config.RemoteConfig{Name: "origin", URLs: []string{"git@github.com:user/other.git"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	rule := func(path string, replace bool) parser.Rule {
+		return parser.Rule{Action: "clone", CloneURL: "https://github.com/user/notes.git", ClonePath: path, CloneReplace: replace}
+	}
+
+	// A directory of files blueprint did not clone is kept
+	err = NewCloneHandlerLegacy(rule(notes, false), "").checkDestination()
+	if err == nil || !strings.Contains(err.Error(), "is not a git repository (contains drafts/, todo.txt)") || !strings.Contains(err.Error(), "replace: true") {
+		t.Errorf("checkDestination() error = %v, want what is there and a hint about replace: true", err)
+	}
+	if !pathExists(filepath.Join(notes, "todo.txt")) {
+		t.Error("checkDestination() removed the destination without replace: true")
+	}
+	if asked != 1 {
+		t.Errorf("confirmReplace called %d times, want 1", asked)
+	}
+
+	// So is one status records a clone of the repository at another path
+	origStatus := CurrentStatus
+	t.Cleanup(func() { CurrentStatus = origStatus })
+	status := Status{Clones: []CloneStatus{{URL: "https://github.com/user/notes.git", Path: filepath.Join(dir, "elsewhere")}}}
+	CurrentStatus = func() Status { return status }
+	if err := NewCloneHandlerLegacy(rule(notes, false), "").checkDestination(); err == nil {
+		t.Error("checkDestination() took a directory for the clone of another path")
+	}
+
+	// A two-stage clone status records at the destination is ours
+	status.Clones = append(status.Clones, CloneStatus{URL: "git@github.com:user/notes.git", Path: notes})
+	if err := NewCloneHandlerLegacy(rule(notes, false), "").checkDestination(); err != nil {
+		t.Errorf("checkDestination() error = %v for the destination of a recorded clone", err)
+	}
+	CurrentStatus = origStatus
+
+	// A clone of another repository is kept too
+	err = NewCloneHandlerLegacy(rule(other, false), "").checkDestination()
+	if err == nil || !strings.Contains(err.Error(), "is a clone of git@github.com:user/other.git") {
+		t.Errorf("checkDestination() error = %v, want the other repository named", err)
+	}
+
+	// A clone of the same repository, in another URL form, is not a conflict
+	same := NewCloneHandlerLegacy(rule(other, false), "")
+	same.Rule.CloneURL = "https://github.com/User/other"
+	if err := same.checkDestination(); err != nil {
+		t.Errorf("checkDestination() error = %v for a clone of the same repository", err)
+	}
+
+	// Missing and empty destinations are free
+	empty := filepath.Join(dir, "empty")
+	_ = os.Mkdir(empty, 0o750)
+	for _, path := range []string{filepath.Join(dir, "missing"), empty} {
+		if err := NewCloneHandlerLegacy(rule(path, false), "").checkDestination(); err != nil {
+			t.Errorf("checkDestination(%s) error = %v, want nil", path, err)
+		}
+	}
+
+	// replace: true removes it without asking
+	asked = 0
+	if err := NewCloneHandlerLegacy(rule(notes, true), "").checkDestination(); err != nil {
+		t.Fatalf("checkDestination() with replace: true error = %v", err)
+	}
+	if pathExists(notes) || asked != 0 {
+		t.Errorf("replace: true left the destination (exists: %v) or asked (%d times)", pathExists(notes), asked)
+	}
+}
+
+func TestCloneIsSatisfied(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	origLocal, origRemote := localSHA, remoteHeadSHAWithError
+	t.Cleanup(func() { localSHA, remoteHeadSHAWithError = origLocal, origRemote })
+	localSHA = func(string) string { return "abc123" }
+	remoteSHA := "abc123"
+	remoteHeadSHAWithError = func(string, string) (string, error) { return remoteSHA, nil }
+
+	dir := t.TempDir()
+	clone := func(name, origin string) string {
+		path := filepath.Join(dir, name)
+		repo, err := git.PlainInit(path, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := repo.CreateRemote(&config.RemoteConfig{Name: "origin", URLs: []string{origin}}); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	notes := clone("notes", "git@github.com:user/notes.git")
+	other := clone("other", "git@github.com:user/other.git")
+	files := filepath.Join(dir, "files")
+	if err := os.MkdirAll(files, 0o750); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(files, "todo.txt"), []byte("keep me"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	satisfied := func(path string, workdir bool) bool {
+		t.Helper()
+		rule := parser.Rule{Action: "clone", CloneURL: "https://github.com/user/notes.git", ClonePath: path, CloneWorkdir: workdir}
+		ok, err := NewCloneHandlerLegacy(rule, "").IsSatisfied()
+		if err != nil {
+			t.Fatalf("IsSatisfied(%s) error: %v", path, err)
+		}
+		return ok
+	}
+
+	if !satisfied(notes, true) {
+		t.Error("IsSatisfied() = false for a clone of the repository at the remote commit")
+	}
+	if satisfied(other, true) {
+		t.Error("IsSatisfied() = true for a clone of another repository")
+	}
+	if satisfied(files, false) {
+		t.Error("IsSatisfied() = true for a directory blueprint did not clone")
+	}
+	if satisfied(filepath.Join(dir, "missing"), true) {
+		t.Error("IsSatisfied() = true for a missing destination")
+	}
+	remoteSHA = "def456"
+	if satisfied(notes, true) {
+		t.Error("IsSatisfied() = true behind the remote commit")
+	}
+}
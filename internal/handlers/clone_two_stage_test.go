@@ -64,8 +64,18 @@ func TestCloneTwoStageApproach(t *testing.T) {
 			// Simulate successful clone but preserve existing files
 			return "", testSHA, "Cloned", nil
 		}
+		// The repository is in storage, and in status, from the clone that
+		// created the target
+		originalGetCleanSHA := gitpkg.GetCleanRepositorySHA
+		gitpkg.GetCleanRepositorySHA = func(url, branch string) string { return testSHA }
+		originalStatus := CurrentStatus
+		CurrentStatus = func() Status {
+			return Status{Clones: []CloneStatus{{URL: rule.CloneURL, Path: targetPath, SHA: testSHA}}}
+		}
 		defer func() {
 			gitpkg.CloneOrUpdateRepositoryTwoStage = originalCloneFunc
+			gitpkg.GetCleanRepositorySHA = originalGetCleanSHA
+			CurrentStatus = originalStatus
 		}()
 
 		// Execute clone
@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+
+	"github.com/elpic/blueprint/internal/parser"
+)
+
+// commandShells maps the shells user commands can run in to the arguments
+// that make each one run a script given as the last argument.
+var commandShells = map[string][]string{
+	"sh":   {"sh", "-c"},
+	"bash": {"bash", "-c"},
+	"zsh":  {"zsh", "-c"},
+	"fish": {"fish", "-c"},
+	"pwsh": {"pwsh", "-NoLogo", "-NoProfile", "-NonInteractive", "-Command"},
+}
+
+// shellRCFiles is the startup snippet each shell runs before commands that
+// need tools set up in the user's shell configuration (asdf shims, PATH).
+var shellRCFiles = map[string]string{
+	"sh":   ". ~/.bashrc 2>/dev/null || true && ",
+	"bash": ". ~/.bashrc 2>/dev/null || true && ",
+	"zsh":  ". ~/.zshrc 2>/dev/null || true && ",
+	"fish": "source ~/.config/fish/config.fish 2>/dev/null; ",
+	"pwsh": "if (Test-Path $PROFILE) { . $PROFILE }; ",
+}
+
+// shellAttr is accepted by actions that run commands written by the user or
+// that load the user's shell configuration.
+var shellAttr = AttrMeta{
+	Name:        "shell",
+	Type:        "string",
+	Default:     "sh",
+	Description: "Shell the commands run in: sh, bash, zsh, fish or pwsh; defaults to $BLUEPRINT_SHELL",
+}
+
+// CommandShellNames returns the shells accepted by shell: and BLUEPRINT_SHELL.
+func CommandShellNames() []string {
+	names := make([]string, 0, len(commandShells))
+	for name := range commandShells {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// IsCommandShell reports whether name is a shell commands can run in.
+func IsCommandShell(name string) bool {
+	_, ok := commandShells[name]
+	return ok
+}
+
+// DefaultCommandShell returns the shell used by rules without shell:, taken
+// from BLUEPRINT_SHELL and falling back to sh.
+func DefaultCommandShell() string {
+	if name := os.Getenv("BLUEPRINT_SHELL"); IsCommandShell(name) {
+		return name
+	}
+	return "sh"
+}
+
+// ruleShell returns the shell rule's commands run in.
+func ruleShell(rule parser.Rule) string {
+	if rule.Shell != "" {
+		return rule.Shell
+	}
+	return DefaultCommandShell()
+}
+
+// shellExec returns a command running script in shell. An unknown shell is
+// run as "<shell> -c", which is what most shells accept.
+func shellExec(shell, script string) *exec.Cmd {
+	args, ok := commandShells[shell]
+	if !ok {
+		args = []string{shell, "-c"}
+	}
+	return exec.Command(args[0], append(args[1:], script)...) // #nosec G204 -- user-supplied command from blueprint
+}
+
+// withShellRC prefixes script with the snippet that loads shell's startup
+// file, so commands installed through it are found.
+func withShellRC(shell, script string) string {
+	return shellRCFiles[shell] + script
+}
+
+// shellExportCommand wraps cmd for an exported script when the rule sets a
+// shell other than sh, which exported scripts are written for.
+func shellExportCommand(rule parser.Rule, cmd string) string {
+	args, ok := commandShells[rule.Shell]
+	if !ok || rule.Shell == "sh" {
+		return cmd
+	}
+	return fmt.Sprintf("%s %s", strings.Join(args, " "), shellQ(cmd))
+}
@@ -0,0 +1,48 @@
+package handlers
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/elpic/blueprint/internal/parser"
+)
+
+func TestDefaultCommandShell(t *testing.T) {
+	t.Setenv("BLUEPRINT_SHELL", "")
+	if got := DefaultCommandShell(); got != "sh" {
+		t.Errorf("DefaultCommandShell() = %q, want sh", got)
+	}
+	t.Setenv("BLUEPRINT_SHELL", "zsh")
+	if got := DefaultCommandShell(); got != "zsh" {
+		t.Errorf("DefaultCommandShell() = %q, want zsh", got)
+	}
+	t.Setenv("BLUEPRINT_SHELL", "csh")
+	if got := DefaultCommandShell(); got != "sh" {
+		t.Errorf("DefaultCommandShell() = %q, want an unknown shell to fall back to sh", got)
+	}
+	if got := ruleShell(parser.Rule{Shell: "fish"}); got != "fish" {
+		t.Errorf("ruleShell() = %q, want the rule's shell to win", got)
+	}
+}
+
+func TestShellExec(t *testing.T) {
+	cmd := shellExec("pwsh", "Write-Output hi")
+	if got := strings.Join(cmd.Args, " "); got != "pwsh -NoLogo -NoProfile -NonInteractive -Command Write-Output hi" {
+		t.Errorf("shellExec(pwsh) args = %q", got)
+	}
+	if got := withShellRC("fish", "asdf --version"); got != "source ~/.config/fish/config.fish 2>/dev/null; asdf --version" {
+		t.Errorf("withShellRC(fish) = %q", got)
+	}
+}
+
+func TestRunShellExport(t *testing.T) {
+	def := GetAction("run")
+	got := def.ShellExport(parser.Rule{Action: "run", RunCommand: "set -Ux EDITOR nvim", Shell: "fish"}, "bash", "")
+	if len(got) != 1 || got[0] != `fish -c "set -Ux EDITOR nvim"` {
+		t.Errorf("ShellExport() = %q", got)
+	}
+	got = def.ShellExport(parser.Rule{Action: "run", RunCommand: "echo hi", Shell: "sh"}, "bash", "")
+	if len(got) != 1 || got[0] != "echo hi" {
+		t.Errorf("ShellExport() = %q, want sh commands left as they are", got)
+	}
+}
@@ -5,17 +5,31 @@ import (
 	"github.com/elpic/blueprint/internal"
 	"os"
 	"path/filepath"
-	"time"
 
 	cryptopkg "github.com/elpic/blueprint/internal/crypto"
 	"github.com/elpic/blueprint/internal/parser"
 	"github.com/elpic/blueprint/internal/ui"
+	"github.com/elpic/blueprint/internal/ui/timeutil"
 )
 
 func init() {
 	RegisterAction(ActionDef{
 		Name:   "decrypt",
 		Prefix: "decrypt ",
+		Meta: ActionMeta{
+			Summary: "Decrypt a file encrypted with blueprint encrypt to a path.",
+			Usage:   "decrypt <file.enc> to: <path> [password-id: <id>] [group: <name>]",
+			Attrs: []AttrMeta{
+				{Name: "to", Type: "path", Required: true, Description: "Destination path"},
+				{Name: "password-id", Type: "string", Description: "Password used for decryption, prompted once per id"},
+				transactionAttr,
+			},
+			Examples: []string{
+				"decrypt secrets/ssh_key.enc to: ~/.ssh/id_ed25519 password-id: personal",
+			},
+			OS:  []string{"mac", "linux"},
+			Doc: "decrypt.md",
+		},
 		NewHandler: func(rule parser.Rule, basePath string, passwordCache map[string]string) Handler {
 			return NewDecryptHandler(rule, basePath, passwordCache)
 		},
@@ -31,6 +45,9 @@ func init() {
 		OrphanIndex: func(rule parser.Rule, index func(string)) {
 			index(rule.DecryptPath)
 		},
+		Verify: func(e StatusEntry) bool {
+			return pathExists(expandPath(e.(*DecryptStatus).DestPath))
+		},
 	})
 }
 
@@ -99,6 +116,17 @@ func (h *DecryptHandler) Up() (string, error) {
 	return fmt.Sprintf("Decrypted to %s", destPath), nil
 }
 
+// Staged returns a copy of the handler that decrypts to the staged path.
+func (h *DecryptHandler) Staged(stage func(dest string) (string, error)) (Handler, error) {
+	staged, err := stage(expandPath(h.Rule.DecryptPath))
+	if err != nil {
+		return nil, err
+	}
+	c := *h
+	c.Rule.DecryptPath = staged
+	return &c, nil
+}
+
 // Down removes the decrypted file
 func (h *DecryptHandler) Down() (string, error) {
 	destPath := expandPath(h.Rule.DecryptPath)
@@ -141,7 +169,7 @@ func (h *DecryptHandler) UpdateStatus(status *Status, records []ExecutionRecord,
 			status.Decrypts = append(status.Decrypts, DecryptStatus{
 				SourceFile:  h.Rule.DecryptFile,
 				DestPath:    h.Rule.DecryptPath,
-				DecryptedAt: time.Now().Format(time.RFC3339),
+				DecryptedAt: timeutil.Now(),
 				Blueprint:   blueprint,
 				OS:          osName,
 			})
@@ -165,13 +193,13 @@ func (h *DecryptHandler) DisplayInfo() {
 		formatFunc = ui.FormatDim
 	}
 
-	fmt.Printf("  %s\n", formatFunc(fmt.Sprintf("File: %s", h.Rule.DecryptFile)))
-	fmt.Printf("  %s\n", formatFunc(fmt.Sprintf("Path: %s", h.Rule.DecryptPath)))
+	printInfo(formatFunc, "File", h.Rule.DecryptFile)
+	printInfo(formatFunc, "Path", h.Rule.DecryptPath)
 	if h.Rule.Group != "" {
-		fmt.Printf("  %s\n", formatFunc(fmt.Sprintf("Group: %s", h.Rule.Group)))
+		printInfo(formatFunc, "Group", h.Rule.Group)
 	}
 	if h.Rule.DecryptPasswordID != "" {
-		fmt.Printf("  %s\n", formatFunc(fmt.Sprintf("Password ID: %s", h.Rule.DecryptPasswordID)))
+		printInfo(formatFunc, "Password ID", h.Rule.DecryptPasswordID)
 	}
 }
 
@@ -211,29 +239,17 @@ func (h *DecryptHandler) DisplayStatus(decrypts []DecryptStatus) {
 		return
 	}
 
-	fmt.Printf("\n%s\n", ui.FormatHighlight("Decrypted Files:"))
+	rows := make([]statusRow, 0, len(decrypts))
 	for _, decrypt := range decrypts {
-		// Parse timestamp for display
-		t, err := time.Parse(time.RFC3339, decrypt.DecryptedAt)
-		var timeStr string
-		if err == nil {
-			timeStr = t.Format("2006-01-02 15:04:05")
-		} else {
-			timeStr = decrypt.DecryptedAt
-		}
-
-		fmt.Printf("  %s %s (%s) [%s, %s]\n",
-			ui.FormatSuccess("●"),
-			ui.FormatInfo(decrypt.DestPath),
-			ui.FormatDim(timeStr),
-			ui.FormatDim(decrypt.OS),
-			ui.FormatDim(abbreviateBlueprintPath(decrypt.Blueprint)),
-		)
-		fmt.Printf("     %s %s\n",
-			ui.FormatDim("From:"),
-			ui.FormatInfo(decrypt.SourceFile),
-		)
+		rows = append(rows, statusRow{
+			name:    decrypt.DestPath,
+			details: []string{timeutil.Display(decrypt.DecryptedAt)},
+			tags:    []string{decrypt.OS, abbreviateBlueprintPath(decrypt.Blueprint)},
+			entry:   &decrypt,
+			sub:     [][2]string{{"From", decrypt.SourceFile}},
+		})
 	}
+	printStatusSection("Decrypted Files:", rows)
 }
 
 // DisplayStatusFromStatus displays decrypt handler status from Status object
@@ -0,0 +1,742 @@
+package handlers
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/elpic/blueprint/internal/parser"
+	"github.com/elpic/blueprint/internal/ui"
+	"github.com/elpic/blueprint/internal/ui/timeutil"
+)
+
+func init() {
+	RegisterAction(ActionDef{
+		Name:   "devcert",
+		Prefix: "devcert ",
+		Meta: ActionMeta{
+			Summary: "Create a locally trusted TLS certificate for development.",
+			Usage:   "devcert <host>... [via: mkcert|builtin] [cert: <path>] [key: <path>]",
+			Attrs: []AttrMeta{
+				{Name: "via", Type: "string", Default: "mkcert", Description: "mkcert, or builtin for blueprint's own CA"},
+				{Name: "cert", Type: "path", Default: "~/.blueprint/certs/<host>.pem", Description: "Where the certificate is written"},
+				{Name: "key", Type: "path", Default: "~/.blueprint/certs/<host>-key.pem", Description: "Where the private key is written"},
+			},
+			Examples: []string{
+				"devcert myapp.local *.myapp.local",
+				"devcert api.test 127.0.0.1 via: builtin cert: ~/code/api/certs/dev.pem key: ~/code/api/certs/dev-key.pem",
+			},
+			OS:  []string{"mac", "linux"},
+			Doc: "devcert.md",
+		},
+		NewHandler: func(rule parser.Rule, basePath string, passwordCache map[string]string) Handler {
+			sudoPassword := ""
+			if passwordCache != nil {
+				sudoPassword = passwordCache["sudo"]
+			}
+			return NewDevcertHandlerWithPassword(rule, basePath, sudoPassword)
+		},
+		RuleKey: func(rule parser.Rule) string {
+			if len(rule.DevcertNames) > 0 {
+				return rule.DevcertNames[0]
+			}
+			return "devcert"
+		},
+		Detect: func(rule parser.Rule) bool {
+			return len(rule.DevcertNames) > 0
+		},
+		Summary: func(rule parser.Rule) string {
+			return strings.Join(rule.DevcertNames, ", ")
+		},
+		OrphanIndex: func(rule parser.Rule, index func(string)) {
+			if len(rule.DevcertNames) > 0 {
+				index(rule.DevcertNames[0])
+			}
+		},
+		Verify: func(e StatusEntry) bool {
+			s := e.(*DevcertStatus)
+			return pathExists(s.Cert) && pathExists(s.Key)
+		},
+		ShellExport: func(rule parser.Rule, _, _ string) []string {
+			h := NewDevcertHandler(rule, "")
+			var lines []string
+			if h.via() == "builtin" {
+				lines = append(lines, "# via: builtin uses blueprint's own CA; the script uses mkcert instead")
+			}
+			return append(lines,
+				fmt.Sprintf("mkdir -p %s %s", shellQ(filepath.Dir(h.certPath())), shellQ(filepath.Dir(h.keyPath()))),
+				"mkcert -install",
+				fmt.Sprintf("mkcert -cert-file %s -key-file %s %s", shellQ(h.certPath()), shellQ(h.keyPath()), shellQuoteAll(rule.DevcertNames)),
+			)
+		},
+	})
+}
+
+// devcertRenewBefore is how long before expiry a certificate is replaced.
+const devcertRenewBefore = 30 * 24 * time.Hour
+
+// devcertLeafLifetime stays within the 825 days macOS accepts for TLS
+// server certificates.
+const devcertLeafLifetime = 825 * 24 * time.Hour
+
+// devcertCAName is the common name of the builtin CA, and its nickname in
+// browser certificate databases.
+const devcertCAName = "blueprint development CA"
+
+// DevcertHandler creates TLS certificates for local development that the
+// system and browsers trust, with mkcert or with a CA of its own.
+type DevcertHandler struct {
+	BaseHandler
+	sudoPassword string
+}
+
+// mkcertInstallMutex prevents concurrent mkcert installation attempts
+var mkcertInstallMutex = &sync.Mutex{}
+
+// NewDevcertHandler creates a new devcert handler
+func NewDevcertHandler(rule parser.Rule, basePath string) *DevcertHandler {
+	return &DevcertHandler{
+		BaseHandler: BaseHandler{
+			Rule:     rule,
+			BasePath: basePath,
+		},
+	}
+}
+
+// NewDevcertHandlerWithPassword creates a new devcert handler with a cached sudo password.
+func NewDevcertHandlerWithPassword(rule parser.Rule, basePath, sudoPassword string) *DevcertHandler {
+	h := NewDevcertHandler(rule, basePath)
+	h.sudoPassword = sudoPassword
+	return h
+}
+
+// devcertExec runs a command for the devcert handler and returns its output.
+// A leading "sudo" runs the rest with the cached password.
+var devcertExec = func(sudoPassword string, args ...string) (string, error) {
+	var cmd *exec.Cmd
+	if args[0] == "sudo" {
+		cmd = sudoCommand(sudoPassword, args[1:]...)
+	} else {
+		cmd = exec.Command(args[0], args[1:]...) // #nosec G204 -- fixed tools, host names and paths passed as args
+	}
+	out, err := cmd.CombinedOutput()
+	return string(out), err
+}
+
+// isToolInstalled reports whether name is on PATH.
+var isToolInstalled = func(name string) bool {
+	_, err := cachedLookPath(name)
+	return err == nil
+}
+
+// devcertCADir is where the builtin CA's certificate and key are kept.
+var devcertCADir = func() string {
+	return expandPath("~/.blueprint/devcert")
+}
+
+// nssDatabases returns the browser certificate databases of this user:
+// Chrome's on Linux and every Firefox profile.
+var nssDatabases = func() []string {
+	var dirs []string
+	if getOSName() == "linux" {
+		dirs = append(dirs, expandPath("~/.pki/nssdb"))
+	}
+	for _, pattern := range []string{
+		"~/.mozilla/firefox/*",
+		"~/Library/Application Support/Firefox/Profiles/*",
+	} {
+		matches, _ := filepath.Glob(expandPath(pattern))
+		for _, m := range matches {
+			if pathExists(filepath.Join(m, "cert9.db")) {
+				dirs = append(dirs, m)
+			}
+		}
+	}
+	return dirs
+}
+
+// via returns how the certificate is made, mkcert unless via: says otherwise.
+func (h *DevcertHandler) via() string {
+	if h.Rule.DevcertVia != "" {
+		return h.Rule.DevcertVia
+	}
+	return "mkcert"
+}
+
+// devcertFileName turns a host name into a file name; "*" becomes
+// "_wildcard" as mkcert names them.
+func devcertFileName(name string) string {
+	return strings.ReplaceAll(name, "*", "_wildcard")
+}
+
+// certPath returns where the certificate is written.
+func (h *DevcertHandler) certPath() string {
+	if h.Rule.DevcertCert != "" {
+		return expandPath(h.Rule.DevcertCert)
+	}
+	return expandPath(filepath.Join("~/.blueprint/certs", devcertFileName(h.Rule.DevcertNames[0])+".pem"))
+}
+
+// keyPath returns where the private key is written.
+func (h *DevcertHandler) keyPath() string {
+	if h.Rule.DevcertKey != "" {
+		return expandPath(h.Rule.DevcertKey)
+	}
+	return expandPath(filepath.Join("~/.blueprint/certs", devcertFileName(h.Rule.DevcertNames[0])+"-key.pem"))
+}
+
+// readPEMCert parses the first certificate in the PEM file at path.
+func readPEMCert(path string) (*x509.Certificate, error) {
+	data, err := os.ReadFile(path) // #nosec G304 -- certificate path from the blueprint
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, fmt.Errorf("%s does not hold a PEM certificate", path)
+	}
+	return x509.ParseCertificate(block.Bytes)
+}
+
+// certCovers reports whether cert is valid for every one of names for
+// longer than devcertRenewBefore from now.
+func certCovers(cert *x509.Certificate, names []string, now time.Time) bool {
+	if now.Add(devcertRenewBefore).After(cert.NotAfter) {
+		return false
+	}
+	for _, name := range names {
+		if ip := net.ParseIP(name); ip != nil {
+			if !slices.ContainsFunc(cert.IPAddresses, ip.Equal) {
+				return false
+			}
+		} else if !slices.Contains(cert.DNSNames, name) {
+			return false
+		}
+	}
+	return true
+}
+
+// upToDate reports whether the certificate on disk covers the rule's names,
+// is not about to expire and, for ca, was signed by it.
+func (h *DevcertHandler) upToDate(ca *x509.Certificate, now time.Time) bool {
+	if !pathExists(h.keyPath()) {
+		return false
+	}
+	cert, err := readPEMCert(h.certPath())
+	if err != nil || !certCovers(cert, h.Rule.DevcertNames, now) {
+		return false
+	}
+	return ca == nil || cert.CheckSignatureFrom(ca) == nil
+}
+
+// Up creates the certificate unless an up-to-date one is already in place,
+// making sure the CA that signs it is trusted.
+func (h *DevcertHandler) Up() (string, error) {
+	for _, path := range []string{h.certPath(), h.keyPath()} {
+		if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+			return "", fmt.Errorf("failed to create %s: %w", filepath.Dir(path), err)
+		}
+	}
+	if h.via() == "builtin" {
+		return h.upBuiltin(time.Now())
+	}
+	return h.upMkcert(time.Now())
+}
+
+// ensureMkcertInstalled installs mkcert, and the NSS tools it uses for
+// browser trust stores, when mkcert is missing.
+func (h *DevcertHandler) ensureMkcertInstalled() error {
+	if isToolInstalled("mkcert") {
+		return nil
+	}
+
+	mkcertInstallMutex.Lock()
+	defer mkcertInstallMutex.Unlock()
+
+	if isToolInstalled("mkcert") {
+		return nil
+	}
+	var cmd string
+	switch {
+	case getOSName() == "mac":
+		cmd = brewCmd() + " install mkcert nss"
+	case repoFamily() == "apt":
+		cmd = "sudo apt-get install -y mkcert libnss3-tools"
+	default:
+		return fmt.Errorf("mkcert is not installed and cannot be installed automatically here; install it or use via: builtin")
+	}
+	if _, err := executeCommandWithCache(cmd); err != nil {
+		return fmt.Errorf("failed to install mkcert: %w", err)
+	}
+	return nil
+}
+
+// upMkcert trusts mkcert's CA and has mkcert issue the certificate.
+func (h *DevcertHandler) upMkcert(now time.Time) (string, error) {
+	if h.upToDate(nil, now) {
+		return fmt.Sprintf("certificate for %s is up to date", strings.Join(h.Rule.DevcertNames, ", ")), nil
+	}
+	if err := h.ensureMkcertInstalled(); err != nil {
+		return "", err
+	}
+	// mkcert -install runs sudo itself; validate the cached password first so
+	// it does not prompt
+	if h.sudoPassword != "" {
+		_, _ = devcertExec(h.sudoPassword, "sudo", "-v")
+	}
+	if out, err := devcertExec(h.sudoPassword, "mkcert", "-install"); err != nil {
+		return "", fmt.Errorf("mkcert -install failed: %w\n%s", err, out)
+	}
+	args := append([]string{"mkcert", "-cert-file", h.certPath(), "-key-file", h.keyPath()}, h.Rule.DevcertNames...)
+	if out, err := devcertExec(h.sudoPassword, args...); err != nil {
+		return "", fmt.Errorf("mkcert failed: %w\n%s", err, out)
+	}
+	return fmt.Sprintf("created %s for %s", ui.AbbreviateHome(h.certPath()), strings.Join(h.Rule.DevcertNames, ", ")), nil
+}
+
+// upBuiltin creates blueprint's CA if needed, trusts it and issues the
+// certificate with it.
+func (h *DevcertHandler) upBuiltin(now time.Time) (string, error) {
+	ca, caKey, err := loadOrCreateDevCA(devcertCADir(), now)
+	if err != nil {
+		return "", err
+	}
+	if err := h.trustCA(); err != nil {
+		return "", err
+	}
+	if h.upToDate(ca, now) {
+		return fmt.Sprintf("certificate for %s is up to date", strings.Join(h.Rule.DevcertNames, ", ")), nil
+	}
+	certPEM, keyPEM, err := issueDevCert(ca, caKey, h.Rule.DevcertNames, now)
+	if err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(h.keyPath(), keyPEM, 0o600); err != nil {
+		return "", fmt.Errorf("failed to write key: %w", err)
+	}
+	if err := os.WriteFile(h.certPath(), certPEM, 0o644); err != nil { // #nosec G306 -- certificates are public
+		return "", fmt.Errorf("failed to write certificate: %w", err)
+	}
+	return fmt.Sprintf("created %s for %s", ui.AbbreviateHome(h.certPath()), strings.Join(h.Rule.DevcertNames, ", ")), nil
+}
+
+// newSerial returns a random certificate serial number.
+func newSerial() (*big.Int, error) {
+	return rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+}
+
+// pemEncode encodes der as a PEM block of type typ.
+func pemEncode(typ string, der []byte) []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: der})
+}
+
+// loadOrCreateDevCA returns the builtin CA kept in dir, creating it there
+// the first time. Its key never leaves dir.
+func loadOrCreateDevCA(dir string, now time.Time) (*x509.Certificate, *ecdsa.PrivateKey, error) {
+	certPath, keyPath := filepath.Join(dir, "rootCA.pem"), filepath.Join(dir, "rootCA-key.pem")
+	if cert, err := readPEMCert(certPath); err == nil {
+		data, err := os.ReadFile(keyPath) // #nosec G304 -- fixed path under ~/.blueprint
+		if err != nil {
+			return nil, nil, fmt.Errorf("CA key missing: %w", err)
+		}
+		block, _ := pem.Decode(data)
+		if block == nil {
+			return nil, nil, fmt.Errorf("%s does not hold a PEM key", keyPath)
+		}
+		key, err := x509.ParseECPrivateKey(block.Bytes)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to parse CA key: %w", err)
+		}
+		return cert, key, nil
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	serial, err := newSerial()
+	if err != nil {
+		return nil, nil, err
+	}
+	host, _ := os.Hostname()
+	tmpl := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: devcertCAName, OrganizationalUnit: []string{host}},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.AddDate(10, 0, 0),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLenZero:        true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create CA: %w", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, nil, err
+	}
+	if err := os.WriteFile(keyPath, pemEncode("EC PRIVATE KEY", keyDER), 0o600); err != nil {
+		return nil, nil, fmt.Errorf("failed to write CA key: %w", err)
+	}
+	if err := os.WriteFile(certPath, pemEncode("CERTIFICATE", der), 0o644); err != nil { // #nosec G306 -- certificates are public
+		return nil, nil, fmt.Errorf("failed to write CA: %w", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	return cert, key, err
+}
+
+// issueDevCert signs a server certificate for names with the CA and returns
+// it and its private key, PEM-encoded.
+func issueDevCert(ca *x509.Certificate, caKey *ecdsa.PrivateKey, names []string, now time.Time) ([]byte, []byte, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	serial, err := newSerial()
+	if err != nil {
+		return nil, nil, err
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: names[0], Organization: []string{"blueprint development certificate"}},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.Add(devcertLeafLifetime),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	for _, name := range names {
+		if ip := net.ParseIP(name); ip != nil {
+			tmpl.IPAddresses = append(tmpl.IPAddresses, ip)
+		} else {
+			tmpl.DNSNames = append(tmpl.DNSNames, name)
+		}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca, &key.PublicKey, caKey)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to sign certificate: %w", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	return pemEncode("CERTIFICATE", der), pemEncode("EC PRIVATE KEY", keyDER), nil
+}
+
+// systemAnchor returns where the builtin CA goes in the system trust store
+// on Linux and the command that rebuilds the store, or "" when the distro
+// family is unknown.
+func systemAnchor() (string, string) {
+	switch repoFamily() {
+	case "apt":
+		return "/usr/local/share/ca-certificates/blueprint-devcert.crt", "update-ca-certificates"
+	case "dnf":
+		return "/etc/pki/ca-trust/source/anchors/blueprint-devcert.pem", "update-ca-trust"
+	}
+	return "", ""
+}
+
+// trustCA adds the builtin CA to the system trust store and to the browser
+// certificate databases found, skipping stores that already have it.
+func (h *DevcertHandler) trustCA() error {
+	caPath := filepath.Join(devcertCADir(), "rootCA.pem")
+	caPEM, err := os.ReadFile(caPath) // #nosec G304 -- fixed path under ~/.blueprint
+	if err != nil {
+		return err
+	}
+
+	switch getOSName() {
+	case "mac":
+		if _, err := devcertExec(h.sudoPassword, "security", "verify-cert", "-c", caPath); err != nil {
+			if out, err := devcertExec(h.sudoPassword, "sudo", "security", "add-trusted-cert", "-d", "-r", "trustRoot",
+				"-k", "/Library/Keychains/System.keychain", caPath); err != nil {
+				return fmt.Errorf("failed to trust the CA in the System keychain: %w\n%s", err, out)
+			}
+		}
+	case "linux":
+		anchor, update := systemAnchor()
+		if anchor == "" {
+			return fmt.Errorf("cannot add the CA to this distribution's trust store; use via: mkcert")
+		}
+		if fileContent(anchor) != string(caPEM) {
+			if err := writeRootFile(anchor, string(caPEM), h.sudoPassword); err != nil {
+				return fmt.Errorf("failed to install the CA: %w", err)
+			}
+			if out, err := devcertExec(h.sudoPassword, "sudo", update); err != nil {
+				return fmt.Errorf("%s failed: %w\n%s", update, err, out)
+			}
+		}
+	}
+
+	// Browsers keep their own stores; they are only updated when certutil
+	// is available, as mkcert does
+	if !isToolInstalled("certutil") {
+		return nil
+	}
+	for _, db := range nssDatabases() {
+		if _, err := devcertExec("", "certutil", "-L", "-d", "sql:"+db, "-n", devcertCAName); err == nil {
+			continue
+		}
+		if out, err := devcertExec("", "certutil", "-A", "-d", "sql:"+db, "-t", "C,,", "-n", devcertCAName, "-i", caPath); err != nil {
+			return fmt.Errorf("failed to add the CA to %s: %w\n%s", db, err, out)
+		}
+	}
+	return nil
+}
+
+// untrustCA removes the builtin CA from every trust store and deletes it.
+func (h *DevcertHandler) untrustCA() error {
+	caPath := filepath.Join(devcertCADir(), "rootCA.pem")
+	var errs []error
+	switch getOSName() {
+	case "mac":
+		if out, err := devcertExec(h.sudoPassword, "sudo", "security", "remove-trusted-cert", "-d", caPath); err != nil {
+			errs = append(errs, fmt.Errorf("failed to untrust the CA: %w\n%s", err, out))
+		}
+		_, _ = devcertExec(h.sudoPassword, "sudo", "security", "delete-certificate", "-c", devcertCAName, "/Library/Keychains/System.keychain")
+	case "linux":
+		if anchor, update := systemAnchor(); anchor != "" && fileContent(anchor) != "" {
+			if err := removeRootFiles(h.sudoPassword, anchor); err != nil {
+				errs = append(errs, err)
+			} else if out, err := devcertExec(h.sudoPassword, "sudo", update); err != nil {
+				errs = append(errs, fmt.Errorf("%s failed: %w\n%s", update, err, out))
+			}
+		}
+	}
+	if isToolInstalled("certutil") {
+		for _, db := range nssDatabases() {
+			_, _ = devcertExec("", "certutil", "-D", "-d", "sql:"+db, "-n", devcertCAName)
+		}
+	}
+	if len(errs) == 0 {
+		if err := os.RemoveAll(devcertCADir()); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Down deletes the certificate and key, and the builtin CA when the last
+// certificate it signed is removed. mkcert's CA is left trusted: other
+// certificates made with mkcert outside blueprint may rely on it.
+func (h *DevcertHandler) Down() (string, error) {
+	for _, path := range []string{h.certPath(), h.keyPath()} {
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return "", fmt.Errorf("failed to remove %s: %w", path, err)
+		}
+	}
+	if h.Rule.DevcertDropCA {
+		if err := h.untrustCA(); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("removed %s and blueprint's development CA", ui.AbbreviateHome(h.certPath())), nil
+	}
+	return "removed " + ui.AbbreviateHome(h.certPath()), nil
+}
+
+// GetCommand returns the command that represents this rule
+func (h *DevcertHandler) GetCommand() string {
+	if len(h.Rule.DevcertNames) == 0 {
+		return ""
+	}
+	if h.Rule.Action == "uninstall" {
+		return fmt.Sprintf("rm -f %s %s", h.certPath(), h.keyPath())
+	}
+	return fmt.Sprintf("devcert %s via: %s", strings.Join(h.Rule.DevcertNames, " "), h.via())
+}
+
+// UpdateStatus records the certificate, or removes it after an uninstall
+func (h *DevcertHandler) UpdateStatus(status *Status, records []ExecutionRecord, blueprint string, osName string) error {
+	if len(h.Rule.DevcertNames) == 0 {
+		return nil
+	}
+	blueprint = normalizeBlueprint(blueprint)
+	name := h.Rule.DevcertNames[0]
+
+	switch h.Rule.Action {
+	case "devcert":
+		if _, ok := commandSuccessfullyExecuted(h.GetCommand(), records); !ok {
+			return nil
+		}
+		expires := ""
+		if cert, err := readPEMCert(h.certPath()); err == nil {
+			expires = timeutil.Format(cert.NotAfter)
+		}
+		status.Devcerts = removeDevcertStatus(status.Devcerts, name, blueprint, osName)
+		status.Devcerts = append(status.Devcerts, DevcertStatus{
+			Name:        name,
+			Names:       h.Rule.DevcertNames,
+			Via:         h.via(),
+			Cert:        h.certPath(),
+			Key:         h.keyPath(),
+			ExpiresAt:   expires,
+			InstalledAt: timeutil.Now(),
+			Blueprint:   blueprint,
+			OS:          osName,
+		})
+	case "uninstall":
+		status.Devcerts = removeDevcertStatus(status.Devcerts, name, blueprint, osName)
+	}
+	return nil
+}
+
+// NeedsSudo returns true because trusting a CA changes the system trust store
+func (h *DevcertHandler) NeedsSudo() bool {
+	return h.Rule.Action != "uninstall" || h.Rule.DevcertDropCA
+}
+
+// GetDependencyKey returns the unique key for this rule in dependency resolution
+func (h *DevcertHandler) GetDependencyKey() string {
+	fallback := "devcert"
+	if len(h.Rule.DevcertNames) > 0 {
+		fallback = h.Rule.DevcertNames[0]
+	}
+	return getDependencyKey(h.Rule, fallback)
+}
+
+// GetDisplayDetails returns the host names to display during execution
+func (h *DevcertHandler) GetDisplayDetails(isUninstall bool) string {
+	return strings.Join(h.Rule.DevcertNames, ", ")
+}
+
+// DisplayInfo displays handler-specific information
+func (h *DevcertHandler) DisplayInfo() {
+	formatFunc := ui.FormatInfo
+	if h.Rule.Action == "uninstall" {
+		formatFunc = ui.FormatDim
+	}
+	fmt.Printf("  %s\n", formatFunc(fmt.Sprintf("Hosts: [%s]", strings.Join(h.Rule.DevcertNames, ", "))))
+	fmt.Printf("  %s\n", formatFunc(fmt.Sprintf("Certificate: %s (via %s)", ui.AbbreviateHome(h.certPath()), h.via())))
+}
+
+// DisplayStatusFromStatus displays devcert handler status from Status object
+func (h *DevcertHandler) DisplayStatusFromStatus(status *Status) {
+	if status == nil || status.Devcerts == nil {
+		return
+	}
+	h.DisplayStatus(status.Devcerts)
+}
+
+// DisplayStatus displays development certificate status information
+func (h *DevcertHandler) DisplayStatus(certs []DevcertStatus) {
+	if len(certs) == 0 {
+		return
+	}
+
+	rows := make([]statusRow, 0, len(certs))
+	for _, c := range certs {
+		details := []string{ui.AbbreviateHome(c.Cert), "via " + c.Via}
+		if c.ExpiresAt != "" {
+			details = append(details, "expires "+timeutil.Display(c.ExpiresAt))
+		}
+		rows = append(rows, statusRow{
+			name:    strings.Join(c.Names, ", "),
+			details: details,
+			tags:    []string{c.OS, abbreviateBlueprintPath(c.Blueprint)},
+			entry:   &c,
+		})
+	}
+	printStatusSection("Development Certificates:", rows)
+}
+
+// GetState returns handler-specific state as key-value pairs
+func (h *DevcertHandler) GetState(isUninstall bool) map[string]string {
+	hosts := h.GetDisplayDetails(isUninstall)
+	return map[string]string{
+		"summary": hosts,
+		"hosts":   hosts,
+		"cert":    h.certPath(),
+		"via":     h.via(),
+	}
+}
+
+// FindUninstallRules returns an uninstall rule for each certificate recorded
+// for blueprintFile that no current rule creates. The rule removing the last
+// builtin certificate on this machine also removes the builtin CA.
+func (h *DevcertHandler) FindUninstallRules(status *Status, currentRules []parser.Rule, blueprintFile, osName string) []parser.Rule {
+	normalizedBlueprint := normalizeBlueprint(blueprintFile)
+
+	current := make(map[string]bool)
+	for _, rule := range currentRules {
+		if rule.Action == "devcert" && len(rule.DevcertNames) > 0 {
+			current[rule.DevcertNames[0]] = true
+		}
+	}
+
+	var rules []parser.Rule
+	builtinKept := 0
+	lastBuiltin := -1
+	for _, c := range status.Devcerts {
+		if c.OS != osName {
+			continue
+		}
+		if normalizeBlueprint(c.Blueprint) != normalizedBlueprint || current[c.Name] {
+			if c.Via == "builtin" {
+				builtinKept++
+			}
+			continue
+		}
+		if c.Via == "builtin" {
+			lastBuiltin = len(rules)
+		}
+		rules = append(rules, parser.Rule{
+			Action:       "uninstall",
+			DevcertNames: c.Names,
+			DevcertVia:   c.Via,
+			DevcertCert:  c.Cert,
+			DevcertKey:   c.Key,
+			OSList:       []string{osName},
+		})
+	}
+	if builtinKept == 0 && lastBuiltin >= 0 {
+		rules[lastBuiltin].DevcertDropCA = true
+	}
+	return rules
+}
+
+// IsInstalled returns true if the certificate is recorded in status and its
+// files still match the rule.
+func (h *DevcertHandler) IsInstalled(status *Status, blueprintFile, osName string) bool {
+	if len(h.Rule.DevcertNames) == 0 {
+		return false
+	}
+	normalizedBlueprint := normalizeBlueprint(blueprintFile)
+	for _, c := range status.Devcerts {
+		if c.Name == h.Rule.DevcertNames[0] && normalizeBlueprint(c.Blueprint) == normalizedBlueprint && c.OS == osName {
+			return slices.Equal(c.Names, h.Rule.DevcertNames) && c.Via == h.via() && c.Cert == h.certPath() &&
+				h.upToDate(nil, time.Now())
+		}
+	}
+	return false
+}
+
+// shellQuoteAll quotes each of words for a shell command line.
+func shellQuoteAll(words []string) string {
+	quoted := make([]string, len(words))
+	for i, w := range words {
+		quoted[i] = shellQ(w)
+	}
+	return strings.Join(quoted, " ")
+}
+
+func removeDevcertStatus(sl []DevcertStatus, name, blueprint, osName string) []DevcertStatus {
+	return removeStatusEntry[DevcertStatus, *DevcertStatus](sl, name, blueprint, osName)
+}
@@ -0,0 +1,233 @@
+package handlers
+
+import (
+	"crypto/x509"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/elpic/blueprint/internal/parser"
+)
+
+// stubDevcert points the builtin CA at a temp dir, fakes a Debian system
+// and records the commands run and root files written.
+func stubDevcert(t *testing.T) (dir string, ran *[]string, written map[string]string) {
+	t.Helper()
+	dir = t.TempDir()
+	stubRepoSystem(t, map[string]string{"ID": "debian"}, map[string]string{})
+	origExec, origCADir, origTool, origOS := devcertExec, devcertCADir, isToolInstalled, getOSName
+	t.Cleanup(func() {
+		devcertExec, devcertCADir, isToolInstalled, getOSName = origExec, origCADir, origTool, origOS
+	})
+
+	getOSName = func() string { return "linux" }
+	devcertCADir = func() string { return filepath.Join(dir, "ca") }
+	isToolInstalled = func(string) bool { return false }
+	var cmds []string
+	devcertExec = func(_ string, args ...string) (string, error) {
+		cmds = append(cmds, strings.Join(args, " "))
+		return "", nil
+	}
+	written = map[string]string{}
+	writeRootFile = func(path, content, _ string) error {
+		written[path] = content
+		return nil
+	}
+	return dir, &cmds, written
+}
+
+func TestDevcertBuiltinUp(t *testing.T) {
+	dir, ran, written := stubDevcert(t)
+	rule := parser.Rule{
+		Action:       "devcert",
+		DevcertNames: []string{"myapp.local", "*.myapp.local", "127.0.0.1"},
+		DevcertVia:   "builtin",
+		DevcertCert:  filepath.Join(dir, "certs", "dev.pem"),
+		DevcertKey:   filepath.Join(dir, "certs", "dev-key.pem"),
+	}
+
+	if _, err := NewDevcertHandler(rule, "").Up(); err != nil {
+		t.Fatalf("Up() error: %v", err)
+	}
+
+	ca, err := readPEMCert(filepath.Join(dir, "ca", "rootCA.pem"))
+	if err != nil || !ca.IsCA {
+		t.Fatalf("CA not created: %v", err)
+	}
+	cert, err := readPEMCert(rule.DevcertCert)
+	if err != nil {
+		t.Fatalf("certificate not written: %v", err)
+	}
+	if err := cert.CheckSignatureFrom(ca); err != nil {
+		t.Errorf("certificate not signed by the CA: %v", err)
+	}
+	if !certCovers(cert, rule.DevcertNames, time.Now()) {
+		t.Errorf("certificate covers %v %v, want %v", cert.DNSNames, cert.IPAddresses, rule.DevcertNames)
+	}
+	if len(cert.ExtKeyUsage) != 1 || cert.ExtKeyUsage[0] != x509.ExtKeyUsageServerAuth {
+		t.Errorf("ExtKeyUsage = %v, want server auth", cert.ExtKeyUsage)
+	}
+	if info, err := os.Stat(rule.DevcertKey); err != nil || info.Mode().Perm() != 0o600 {
+		t.Errorf("key mode = %v (%v), want 0600", info, err)
+	}
+
+	anchor := "/usr/local/share/ca-certificates/blueprint-devcert.crt"
+	if !strings.Contains(written[anchor], "BEGIN CERTIFICATE") {
+		t.Errorf("CA not installed at %s: %v", anchor, written)
+	}
+	if strings.Join(*ran, ";") != "sudo update-ca-certificates" {
+		t.Errorf("ran %v", *ran)
+	}
+
+	// A second run keeps the certificate and the CA
+	before, _ := os.ReadFile(rule.DevcertCert)
+	out, err := NewDevcertHandler(rule, "").Up()
+	if err != nil {
+		t.Fatalf("second Up() error: %v", err)
+	}
+	after, _ := os.ReadFile(rule.DevcertCert)
+	if !strings.Contains(out, "up to date") || string(before) != string(after) {
+		t.Errorf("second Up() = %q, certificate replaced: %v", out, string(before) != string(after))
+	}
+}
+
+func TestDevcertBuiltinRenewsForNewNames(t *testing.T) {
+	dir, _, _ := stubDevcert(t)
+	rule := parser.Rule{
+		Action:       "devcert",
+		DevcertNames: []string{"a.test"},
+		DevcertVia:   "builtin",
+		DevcertCert:  filepath.Join(dir, "a.pem"),
+		DevcertKey:   filepath.Join(dir, "a-key.pem"),
+	}
+	if _, err := NewDevcertHandler(rule, "").Up(); err != nil {
+		t.Fatalf("Up() error: %v", err)
+	}
+
+	rule.DevcertNames = append(rule.DevcertNames, "b.test")
+	if _, err := NewDevcertHandler(rule, "").Up(); err != nil {
+		t.Fatalf("Up() error: %v", err)
+	}
+	cert, err := readPEMCert(rule.DevcertCert)
+	if err != nil || !certCovers(cert, rule.DevcertNames, time.Now()) {
+		t.Errorf("certificate not reissued for %v: %v", rule.DevcertNames, err)
+	}
+}
+
+func TestCertCoversExpiry(t *testing.T) {
+	ca, key, err := loadOrCreateDevCA(t.TempDir(), time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPEM, _, err := issueDevCert(ca, key, []string{"x.test"}, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "x.pem")
+	if err := os.WriteFile(path, certPEM, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cert, err := readPEMCert(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !certCovers(cert, []string{"x.test"}, time.Now()) {
+		t.Error("fresh certificate should be covered")
+	}
+	if certCovers(cert, []string{"y.test"}, time.Now()) {
+		t.Error("certificate should not cover another host")
+	}
+	if certCovers(cert, []string{"x.test"}, time.Now().Add(devcertLeafLifetime-devcertRenewBefore/2)) {
+		t.Error("certificate about to expire should be renewed")
+	}
+}
+
+func TestDevcertMkcertUp(t *testing.T) {
+	dir, ran, _ := stubDevcert(t)
+	isToolInstalled = func(name string) bool { return name == "mkcert" }
+	rule := parser.Rule{
+		Action:       "devcert",
+		DevcertNames: []string{"myapp.local"},
+		DevcertCert:  filepath.Join(dir, "c.pem"),
+		DevcertKey:   filepath.Join(dir, "k.pem"),
+	}
+
+	if _, err := NewDevcertHandler(rule, "").Up(); err != nil {
+		t.Fatalf("Up() error: %v", err)
+	}
+	want := "mkcert -install;mkcert -cert-file " + rule.DevcertCert + " -key-file " + rule.DevcertKey + " myapp.local"
+	if strings.Join(*ran, ";") != want {
+		t.Errorf("ran %v, want %q", *ran, want)
+	}
+}
+
+func TestDevcertDown(t *testing.T) {
+	dir, ran, _ := stubDevcert(t)
+	rule := parser.Rule{
+		Action:       "devcert",
+		DevcertNames: []string{"myapp.local"},
+		DevcertVia:   "builtin",
+		DevcertCert:  filepath.Join(dir, "c.pem"),
+		DevcertKey:   filepath.Join(dir, "k.pem"),
+	}
+	if _, err := NewDevcertHandler(rule, "").Up(); err != nil {
+		t.Fatalf("Up() error: %v", err)
+	}
+	*ran = nil
+
+	rule.Action = "uninstall"
+	if _, err := NewDevcertHandler(rule, "").Down(); err != nil {
+		t.Fatalf("Down() error: %v", err)
+	}
+	if pathExists(rule.DevcertCert) || pathExists(rule.DevcertKey) {
+		t.Error("certificate and key should be removed")
+	}
+	if !pathExists(filepath.Join(dir, "ca", "rootCA.pem")) {
+		t.Error("CA should be kept without DevcertDropCA")
+	}
+
+	rule.DevcertDropCA = true
+	if _, err := NewDevcertHandler(rule, "").Down(); err != nil {
+		t.Fatalf("Down() error: %v", err)
+	}
+	if pathExists(filepath.Join(dir, "ca")) {
+		t.Error("CA should be deleted with DevcertDropCA")
+	}
+}
+
+func TestDevcertFindUninstallRules(t *testing.T) {
+	status := &Status{Devcerts: []DevcertStatus{
+		{Name: "a.test", Names: []string{"a.test"}, Via: "builtin", Blueprint: "/bp", OS: "linux"},
+		{Name: "b.test", Names: []string{"b.test"}, Via: "builtin", Blueprint: "/bp", OS: "linux"},
+		{Name: "c.test", Names: []string{"c.test"}, Via: "mkcert", Blueprint: "/bp", OS: "linux"},
+	}}
+	h := NewDevcertHandler(parser.Rule{}, "")
+
+	current := []parser.Rule{{Action: "devcert", DevcertNames: []string{"a.test"}, DevcertVia: "builtin"}}
+	rules := h.FindUninstallRules(status, current, "/bp", "linux")
+	if len(rules) != 2 {
+		t.Fatalf("got %d rules, want 2", len(rules))
+	}
+	for _, r := range rules {
+		if r.DevcertDropCA {
+			t.Errorf("%v drops the CA while a.test still uses it", r.DevcertNames)
+		}
+	}
+
+	rules = h.FindUninstallRules(status, nil, "/bp", "linux")
+	dropped := 0
+	for _, r := range rules {
+		if r.DevcertDropCA {
+			dropped++
+			if r.DevcertVia != "builtin" {
+				t.Errorf("mkcert rule %v drops the builtin CA", r.DevcertNames)
+			}
+		}
+	}
+	if len(rules) != 3 || dropped != 1 {
+		t.Errorf("got %d rules, %d dropping the CA; want 3 and 1", len(rules), dropped)
+	}
+}
@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/elpic/blueprint/internal/ui"
+	"github.com/elpic/blueprint/internal/ui/timeutil"
+)
+
+// statusRow is one resource in a `blueprint status` section.
+type statusRow struct {
+	name    string      // the resource, shown highlighted
+	suffix  string      // shown dimmed right after name, e.g. " @ abc1234"
+	details []string    // shown in parentheses, e.g. when it was installed
+	tags    []string    // shown in brackets, e.g. OS and blueprint
+	sub     [][2]string // label and value lines printed beneath the row
+	entry   StatusEntry // when set, its age and last verification follow details
+}
+
+// now is the clock status ages are measured against, a variable for testability.
+var now = time.Now
+
+// ageDetails returns how long ago e was applied and, once `blueprint status
+// --check` has found it present, when that last happened, so resources left
+// over from blueprints no longer in use stand out.
+func ageDetails(e StatusEntry) []string {
+	var details []string
+	if applied, err := timeutil.Parse(e.GetAppliedAt()); err == nil {
+		details = append(details, "applied "+timeutil.DaysAgo(applied, now()))
+	}
+	if verified := e.GetVerifiedAt(); verified != "" {
+		details = append(details, "verified "+timeutil.Display(verified))
+	}
+	return details
+}
+
+// printStatusSection prints a status section: its title, then one line per
+// row with names, details and tags aligned in columns. Home paths are shown
+// as ~ and long names are shortened so each line fits the terminal.
+func printStatusSection(title string, rows []statusRow) {
+	fmt.Printf("\n%s\n", ui.FormatHighlight(title))
+
+	marker := ui.FormatSuccess("●")
+	details := make([]string, len(rows))
+	tags := make([]string, len(rows))
+	var detailsWidth, tagsWidth int
+	for i, row := range rows {
+		if row.entry != nil {
+			row.details = append(row.details, ageDetails(row.entry)...)
+		}
+		details[i] = "(" + strings.Join(row.details, ", ") + ")"
+		tags[i] = "[" + strings.Join(row.tags, ", ") + "]"
+		detailsWidth = max(detailsWidth, lipgloss.Width(details[i]))
+		tagsWidth = max(tagsWidth, lipgloss.Width(tags[i]))
+	}
+
+	cells := make([][]string, len(rows))
+	for i, row := range rows {
+		// indent, marker, the other columns and the gaps between them
+		used := 2 + lipgloss.Width(marker) + 2 + lipgloss.Width(row.suffix) + 2 + detailsWidth + 2 + tagsWidth
+		cells[i] = []string{
+			marker,
+			ui.FormatInfo(ui.Fit(ui.AbbreviateHome(row.name), used)) + ui.FormatDim(row.suffix),
+			ui.FormatDim(details[i]),
+			ui.FormatDim(tags[i]),
+		}
+	}
+
+	for i, line := range ui.AlignColumns(cells) {
+		fmt.Printf("  %s\n", line)
+		for _, sub := range rows[i].sub {
+			label := sub[0] + ":"
+			fmt.Printf("     %s %s\n",
+				ui.FormatDim(label),
+				ui.FormatInfo(ui.Fit(ui.AbbreviateHome(sub[1]), 5+lipgloss.Width(label)+1)),
+			)
+		}
+	}
+}
+
+// printInfo prints one "Label: value" line of a DisplayInfo block, with a
+// home path shown as ~ and a long value shortened to fit the terminal.
+func printInfo(format func(string) string, label, value string) {
+	label += ": "
+	fmt.Printf("  %s\n", format(label+ui.Fit(ui.AbbreviateHome(value), 2+lipgloss.Width(label))))
+}
@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/elpic/blueprint/internal/ui"
+)
+
+func captureStatusSection(title string, rows []statusRow) string {
+	old := os.Stdout
+	r, w, _ := os.Pipe()
+	os.Stdout = w
+
+	printStatusSection(title, rows)
+
+	_ = w.Close()
+	os.Stdout = old
+
+	var buf bytes.Buffer
+	_, _ = io.Copy(&buf, r)
+	return buf.String()
+}
+
+func TestPrintStatusSectionFitsNarrowTerminal(t *testing.T) {
+	orig := ui.TerminalWidth
+	defer func() { ui.TerminalWidth = orig }()
+	ui.TerminalWidth = func() int { return 80 }
+
+	rows := []statusRow{
+		{name: "git", details: []string{"2024-03-01 10:20:30"}, tags: []string{"linux", "setup.bp"}},
+		{
+			name:    "https://github.com/someone/a-repository-with-a-really-long-name-for-testing.git",
+			details: []string{"2024-03-01 10:20:30"},
+			tags:    []string{"linux", "setup.bp"},
+			sub:     [][2]string{{"URL", "https://github.com/someone/another-repository-with-a-really-long-name-that-wraps.git"}},
+		},
+	}
+	out := captureStatusSection("Things:", rows)
+
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("got %d lines, want title, two rows and a sub line:\n%s", len(lines), out)
+	}
+	for _, line := range lines {
+		if w := lipgloss.Width(line); w > 80 {
+			t.Errorf("line is %d columns wide, want at most 80: %q", w, line)
+		}
+	}
+	// Details start in the same column on both rows
+	col := func(s string) int { return lipgloss.Width(s[:strings.Index(s, "(2024")]) }
+	if col(lines[1]) != col(lines[2]) {
+		t.Errorf("details are not aligned:\n%s\n%s", lines[1], lines[2])
+	}
+	if !strings.Contains(lines[2], ui.Ellipsis) || !strings.Contains(lines[3], ui.Ellipsis) {
+		t.Errorf("long name and URL were not shortened:\n%s", out)
+	}
+}
+
+func TestAgeDetails(t *testing.T) {
+	orig := now
+	defer func() { now = orig }()
+	now = func() time.Time { return time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC) }
+
+	tests := []struct {
+		entry StatusEntry
+		want  string
+	}{
+		{&MkdirStatus{CreatedAt: "2026-10-01T08:00:00Z"}, "applied today"},
+		{&MkdirStatus{CreatedAt: "2026-09-30T08:00:00Z"}, "applied 1 day ago"},
+		{
+			&MkdirStatus{CreatedAt: "2026-06-03T12:00:00Z", VerifiedAt: "2026-09-28T09:30:00Z"},
+			"applied 120 days ago, verified 2026-09-28 09:30:00",
+		},
+		{&MkdirStatus{CreatedAt: "not a time"}, ""},
+	}
+	for _, tt := range tests {
+		if got := strings.Join(ageDetails(tt.entry), ", "); got != tt.want {
+			t.Errorf("ageDetails() = %q, want %q", got, tt.want)
+		}
+	}
+}
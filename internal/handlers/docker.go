@@ -0,0 +1,302 @@
+package handlers
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+	"sync"
+
+	"github.com/elpic/blueprint/internal/parser"
+	"github.com/elpic/blueprint/internal/ui"
+	"github.com/elpic/blueprint/internal/ui/timeutil"
+)
+
+func init() {
+	RegisterAction(ActionDef{
+		Name:   "docker",
+		Prefix: "docker ",
+		Meta: ActionMeta{
+			Summary: "Pull Docker images, installing Docker first when it is missing.",
+			Usage:   "docker [pull] <image[:tag]>... [jobs: <n>]",
+			Attrs:   []AttrMeta{jobsAttr},
+			Examples: []string{
+				"docker postgres:16 redis:7",
+				"docker pull ghcr.io/acme/devbox:latest",
+			},
+			OS:  []string{"mac", "linux"},
+			Doc: "docker.md",
+		},
+		NewHandler: func(rule parser.Rule, basePath string, passwordCache map[string]string) Handler {
+			return NewDockerHandler(rule, basePath)
+		},
+		RuleKey: func(rule parser.Rule) string {
+			if len(rule.DockerImages) > 0 {
+				return "docker-" + rule.DockerImages[0]
+			}
+			return "docker"
+		},
+		Detect: func(rule parser.Rule) bool {
+			return len(rule.DockerImages) > 0
+		},
+		Summary: func(rule parser.Rule) string {
+			return strings.Join(rule.DockerImages, ", ")
+		},
+		OrphanIndex: func(rule parser.Rule, index func(string)) {
+			for _, image := range rule.DockerImages {
+				index(image)
+			}
+		},
+		Verify: func(e StatusEntry) bool {
+			return dockerImagePresent(e.(*DockerImageStatus).Image)
+		},
+		ShellExport: func(rule parser.Rule, _, _ string) []string {
+			var lines []string
+			for _, image := range rule.DockerImages {
+				lines = append(lines, "docker pull "+shellQ(image))
+			}
+			return lines
+		},
+	})
+}
+
+// DockerHandler pulls Docker images and removes the ones dropped from the
+// blueprint. Containers are left to the user: an image a container still
+// uses is not removed.
+type DockerHandler struct {
+	BaseHandler
+}
+
+// dockerInstallMutex prevents concurrent Docker installation attempts
+var dockerInstallMutex = &sync.Mutex{}
+
+// dockerInstalledCheck returns true if the docker CLI is on the PATH.
+// Defined as a var to allow stubbing in tests.
+var dockerInstalledCheck = func() bool {
+	_, err := cachedLookPath("docker")
+	return err == nil
+}
+
+// dockerImagePresent returns true if the image is in the local image store.
+// Defined as a var to allow stubbing in tests.
+var dockerImagePresent = func(image string) bool {
+	cmd := exec.Command("docker", "image", "inspect", image) // #nosec G204 -- images are validated by the parser
+	return cmd.Run() == nil
+}
+
+// NewDockerHandler creates a new docker handler
+func NewDockerHandler(rule parser.Rule, basePath string) *DockerHandler {
+	return &DockerHandler{
+		BaseHandler: BaseHandler{
+			Rule:     rule,
+			BasePath: basePath,
+		},
+	}
+}
+
+// Up pulls the images, installing Docker first when it is missing
+func (h *DockerHandler) Up() (string, error) {
+	targetOS := getOSName()
+	if targetOS != "mac" && targetOS != "linux" {
+		return "", fmt.Errorf("docker is not supported on %s", targetOS)
+	}
+
+	if err := h.ensureDockerInstalled(targetOS); err != nil {
+		return "", fmt.Errorf("failed to ensure docker is installed: %w", err)
+	}
+
+	if h.Rule.Jobs > 0 {
+		return runTargets(h.Rule.DockerImages, h.Rule.Jobs, func(image string) error {
+			_, err := executeCommandWithCache("docker pull " + image)
+			return err
+		})
+	}
+	return executeCommandWithCache(h.buildCommand())
+}
+
+// Down removes the images
+func (h *DockerHandler) Down() (string, error) {
+	return executeCommandWithCache(h.buildUninstallCommand())
+}
+
+// GetCommand returns the actual command(s) that will be executed
+func (h *DockerHandler) GetCommand() string {
+	if h.Rule.Action == "uninstall" {
+		return h.buildUninstallCommand()
+	}
+	return h.buildCommand()
+}
+
+// ensureDockerInstalled installs Docker Desktop with Homebrew on macOS and
+// Docker Engine with the get.docker.com script on Linux.
+func (h *DockerHandler) ensureDockerInstalled(osName string) error {
+	if dockerInstalledCheck() {
+		return nil
+	}
+
+	dockerInstallMutex.Lock()
+	defer dockerInstallMutex.Unlock()
+
+	// Double-check after acquiring lock
+	if dockerInstalledCheck() {
+		return nil
+	}
+
+	installCmd := brewCmd() + " install --cask docker"
+	if osName == "linux" {
+		if err := checkRemoteScriptAllowed("installing Docker", "https://get.docker.com"); err != nil {
+			return err
+		}
+		installCmd = "curl -fsSL https://get.docker.com | sudo sh"
+	}
+	if _, err := executeCommandWithCache(installCmd); err != nil {
+		return fmt.Errorf("failed to install docker: %w", err)
+	}
+	return nil
+}
+
+// buildCommand builds the pull command for the images
+func (h *DockerHandler) buildCommand() string {
+	parts := make([]string, len(h.Rule.DockerImages))
+	for i, image := range h.Rule.DockerImages {
+		parts[i] = "docker pull " + image
+	}
+	return strings.Join(parts, " && ")
+}
+
+// buildUninstallCommand builds the command removing the images
+func (h *DockerHandler) buildUninstallCommand() string {
+	return "docker image rm " + strings.Join(h.Rule.DockerImages, " ")
+}
+
+// UpdateStatus records the pulled images, or removes the ones removed
+func (h *DockerHandler) UpdateStatus(status *Status, records []ExecutionRecord, blueprint string, osName string) error {
+	blueprint = normalizeBlueprint(blueprint)
+
+	for _, image := range succeededTargets(h.GetCommand(), records, h.Rule.DockerImages) {
+		status.DockerImages = removeDockerImageStatus(status.DockerImages, image, blueprint, osName)
+		if h.Rule.Action == "docker" {
+			status.DockerImages = append(status.DockerImages, DockerImageStatus{
+				Image:     image,
+				PulledAt:  timeutil.Now(),
+				Blueprint: blueprint,
+				OS:        osName,
+			})
+		}
+	}
+	return nil
+}
+
+// NeedsSudo returns true on Linux when Docker still has to be installed;
+// pulling and removing images goes through the Docker daemon.
+func (h *DockerHandler) NeedsSudo() bool {
+	return h.Rule.Action == "docker" && getOSName() == "linux" && !dockerInstalledCheck()
+}
+
+// GetDependencyKey returns the unique key for this rule in dependency resolution
+func (h *DockerHandler) GetDependencyKey() string {
+	fallback := "docker"
+	if len(h.Rule.DockerImages) > 0 {
+		fallback = "docker-" + h.Rule.DockerImages[0]
+	}
+	return getDependencyKey(h.Rule, fallback)
+}
+
+// GetDisplayDetails returns the images to display during execution
+func (h *DockerHandler) GetDisplayDetails(isUninstall bool) string {
+	return strings.Join(h.Rule.DockerImages, ", ")
+}
+
+// DisplayInfo displays handler-specific information
+func (h *DockerHandler) DisplayInfo() {
+	formatFunc := ui.FormatInfo
+	if h.Rule.Action == "uninstall" {
+		formatFunc = ui.FormatDim
+	}
+	fmt.Printf("  %s\n", formatFunc(fmt.Sprintf("Images: [%s]", strings.Join(h.Rule.DockerImages, ", "))))
+}
+
+// DisplayStatusFromStatus displays docker handler status from Status object
+func (h *DockerHandler) DisplayStatusFromStatus(status *Status) {
+	if status == nil || len(status.DockerImages) == 0 {
+		return
+	}
+
+	rows := make([]statusRow, 0, len(status.DockerImages))
+	for _, d := range status.DockerImages {
+		rows = append(rows, statusRow{
+			name:    d.Image,
+			details: []string{timeutil.Display(d.PulledAt)},
+			tags:    []string{d.OS, abbreviateBlueprintPath(d.Blueprint)},
+			entry:   &d,
+		})
+	}
+	printStatusSection("Docker Images:", rows)
+}
+
+// GetState returns handler-specific state as key-value pairs
+func (h *DockerHandler) GetState(isUninstall bool) map[string]string {
+	images := h.GetDisplayDetails(isUninstall)
+	return map[string]string{
+		"summary": images,
+		"images":  images,
+	}
+}
+
+// FindUninstallRules compares docker status against current rules and
+// returns a rule removing the images no longer in the blueprint
+func (h *DockerHandler) FindUninstallRules(status *Status, currentRules []parser.Rule, blueprintFile, osName string) []parser.Rule {
+	normalizedBlueprint := normalizeBlueprint(blueprintFile)
+
+	current := make(map[string]bool)
+	for _, rule := range currentRules {
+		if rule.Action == "docker" {
+			for _, image := range rule.DockerImages {
+				current[image] = true
+			}
+		}
+	}
+
+	var images []string
+	for _, d := range status.DockerImages {
+		if normalizeBlueprint(d.Blueprint) == normalizedBlueprint && d.OS == osName && !current[d.Image] {
+			images = append(images, d.Image)
+		}
+	}
+	if len(images) == 0 {
+		return nil
+	}
+	return []parser.Rule{{
+		Action:       "uninstall",
+		DockerImages: images,
+		OSList:       []string{osName},
+	}}
+}
+
+// IsInstalled returns true if all images in this rule are already in status.
+func (h *DockerHandler) IsInstalled(status *Status, blueprintFile, osName string) bool {
+	return h.recordedImages(status, blueprintFile, osName) == len(h.Rule.DockerImages)
+}
+
+// PlanChange reports an update when only some of the images are recorded.
+func (h *DockerHandler) PlanChange(status *Status, blueprintFile, osName string) PlanChange {
+	return planChangeOf(h.recordedImages(status, blueprintFile, osName), 0, len(h.Rule.DockerImages))
+}
+
+// recordedImages counts the images of this rule recorded in status.
+func (h *DockerHandler) recordedImages(status *Status, blueprintFile, osName string) int {
+	normalizedBlueprint := normalizeBlueprint(blueprintFile)
+	found := 0
+	for _, image := range h.Rule.DockerImages {
+		for _, d := range status.DockerImages {
+			if d.Image == image && normalizeBlueprint(d.Blueprint) == normalizedBlueprint && d.OS == osName {
+				found++
+				break
+			}
+		}
+	}
+	return found
+}
+
+func removeDockerImageStatus(sl []DockerImageStatus, image, blueprint, osName string) []DockerImageStatus {
+	return removeStatusEntry[DockerImageStatus, *DockerImageStatus](sl, image, blueprint, osName)
+}
@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"testing"
+
+	"github.com/elpic/blueprint/internal/parser"
+)
+
+// stubDockerSystem stubs the OS, the docker lookup and the command executor,
+// recording the commands run.
+func stubDockerSystem(t *testing.T, osName string, installed bool) *[]string {
+	t.Helper()
+	origOS, origExec, origInstalled := getOSName, commandExecutor, dockerInstalledCheck
+	t.Cleanup(func() { getOSName, commandExecutor, dockerInstalledCheck = origOS, origExec, origInstalled })
+
+	getOSName = func() string { return osName }
+	dockerInstalledCheck = func() bool { return installed }
+	var ran []string
+	commandExecutor = &customMockExecutor{executeFunc: func(cmd string) (string, error) {
+		ran = append(ran, cmd)
+		return "", nil
+	}}
+	return &ran
+}
+
+func TestDockerHandlerUpAndStatus(t *testing.T) {
+	ran := stubDockerSystem(t, "linux", true)
+
+	rule := parser.Rule{Action: "docker", DockerImages: []string{"postgres:16", "redis"}}
+	h := NewDockerHandler(rule, "")
+	if _, err := h.Up(); err != nil {
+		t.Fatalf("Up() error: %v", err)
+	}
+	if len(*ran) != 1 || (*ran)[0] != "docker pull postgres:16 && docker pull redis" {
+		t.Errorf("ran %q", *ran)
+	}
+	if h.NeedsSudo() {
+		t.Error("pulling with docker installed should not need sudo")
+	}
+
+	status := &Status{}
+	records := []ExecutionRecord{{Command: h.GetCommand(), Status: "success"}}
+	if err := h.UpdateStatus(status, records, "/tmp/setup.bp", "linux"); err != nil {
+		t.Fatal(err)
+	}
+	if len(status.DockerImages) != 2 || status.DockerImages[0].Image != "postgres:16" {
+		t.Fatalf("status docker images = %+v", status.DockerImages)
+	}
+	if !h.IsInstalled(status, "/tmp/setup.bp", "linux") {
+		t.Error("IsInstalled() = false after UpdateStatus")
+	}
+
+	// Dropping an image from the blueprint removes it
+	current := []parser.Rule{{Action: "docker", DockerImages: []string{"postgres:16"}}}
+	uninstall := h.FindUninstallRules(status, current, "/tmp/setup.bp", "linux")
+	if len(uninstall) != 1 || len(uninstall[0].DockerImages) != 1 || uninstall[0].DockerImages[0] != "redis" {
+		t.Fatalf("FindUninstallRules() = %+v", uninstall)
+	}
+	down := NewDockerHandler(uninstall[0], "")
+	if down.GetCommand() != "docker image rm redis" {
+		t.Errorf("uninstall command = %q", down.GetCommand())
+	}
+	records = []ExecutionRecord{{Command: down.GetCommand(), Status: "success"}}
+	if err := down.UpdateStatus(status, records, "/tmp/setup.bp", "linux"); err != nil {
+		t.Fatal(err)
+	}
+	if len(status.DockerImages) != 1 || status.DockerImages[0].Image != "postgres:16" {
+		t.Errorf("status docker images after uninstall = %+v", status.DockerImages)
+	}
+}
+
+func TestDockerHandlerInstallsDocker(t *testing.T) {
+	ran := stubDockerSystem(t, "mac", false)
+
+	h := NewDockerHandler(parser.Rule{Action: "docker", DockerImages: []string{"redis"}}, "")
+	if _, err := h.Up(); err != nil {
+		t.Fatalf("Up() error: %v", err)
+	}
+	if len(*ran) != 2 || (*ran)[0] != brewCmd()+" install --cask docker" || (*ran)[1] != "docker pull redis" {
+		t.Errorf("ran %q", *ran)
+	}
+
+	stubDockerSystem(t, "linux", false)
+	if !h.NeedsSudo() {
+		t.Error("installing docker on linux needs sudo")
+	}
+}
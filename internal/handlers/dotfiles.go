@@ -5,17 +5,31 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
-	"time"
 
+	"github.com/elpic/blueprint/internal"
 	gitpkg "github.com/elpic/blueprint/internal/git"
 	"github.com/elpic/blueprint/internal/parser"
 	"github.com/elpic/blueprint/internal/ui"
+	"github.com/elpic/blueprint/internal/ui/timeutil"
 )
 
 func init() {
 	RegisterAction(ActionDef{
 		Name:   "dotfiles",
 		Prefix: "dotfiles ",
+		Meta: ActionMeta{
+			Summary: "Clone a dotfiles repository and symlink its entries into $HOME.",
+			Usage:   "dotfiles <url> [branch: <branch>] [skip: [entry, ...]]",
+			Attrs: []AttrMeta{
+				{Name: "branch", Type: "string", Description: "Git branch to check out (default: the remote's default branch)"},
+				{Name: "skip", Type: "list", Description: "Top-level entries not to symlink, e.g. [README.md]"},
+			},
+			Examples: []string{
+				"dotfiles https://github.com/user/dotfiles skip: [README.md, install.sh]",
+			},
+			OS:  []string{"mac", "linux"},
+			Doc: "dotfiles.md",
+		},
 		NewHandler: func(rule parser.Rule, basePath string, passwordCache map[string]string) Handler {
 			return NewDotfilesHandler(rule, basePath)
 		},
@@ -31,6 +45,9 @@ func init() {
 		OrphanIndex: func(rule parser.Rule, index func(string)) {
 			index(rule.DotfilesURL)
 		},
+		Verify: func(e StatusEntry) bool {
+			return pathExists(expandPath(e.(*DotfilesStatus).Path))
+		},
 		AlwaysRunUp: true,
 		ShellExport: func(rule parser.Rule, _, _ string) []string {
 			clonePath := rule.DotfilesPath
@@ -436,7 +453,7 @@ func (h *DotfilesHandler) UpdateStatus(status *Status, records []ExecutionRecord
 				Branch:    h.Rule.DotfilesBranch,
 				SHA:       currentSHA,
 				Links:     links,
-				ClonedAt:  time.Now().Format(time.RFC3339),
+				ClonedAt:  timeutil.Now(),
 				Blueprint: blueprint,
 				OS:        osName,
 			})
@@ -478,10 +495,10 @@ func (h *DotfilesHandler) DisplayInfo() {
 		formatFunc = ui.FormatDim
 	}
 
-	fmt.Printf("  %s\n", formatFunc(fmt.Sprintf("URL: %s", h.Rule.DotfilesURL)))
-	fmt.Printf("  %s\n", formatFunc(fmt.Sprintf("Path: %s", h.Rule.DotfilesPath)))
+	printInfo(formatFunc, "URL", h.Rule.DotfilesURL)
+	printInfo(formatFunc, "Path", h.Rule.DotfilesPath)
 	if h.Rule.DotfilesBranch != "" {
-		fmt.Printf("  %s\n", formatFunc(fmt.Sprintf("Branch: %s", h.Rule.DotfilesBranch)))
+		printInfo(formatFunc, "Branch", h.Rule.DotfilesBranch)
 	}
 }
 
@@ -491,37 +508,24 @@ func (h *DotfilesHandler) DisplayStatusFromStatus(status *Status) {
 		return
 	}
 
-	fmt.Printf("\n%s\n", ui.FormatHighlight("Dotfiles:"))
+	rows := make([]statusRow, 0, len(status.Dotfiles))
 	for _, d := range status.Dotfiles {
-		t, err := time.Parse(time.RFC3339, d.ClonedAt)
-		var timeStr string
-		if err == nil {
-			timeStr = t.Format("2006-01-02 15:04:05")
-		} else {
-			timeStr = d.ClonedAt
-		}
-
 		// Show SHA (abbreviated to 7 chars) if available
 		shaStr := ""
 		if d.SHA != "" {
-			if len(d.SHA) >= 7 {
-				shaStr = fmt.Sprintf(" @ %s", d.SHA[:7])
-			} else {
-				shaStr = fmt.Sprintf(" @ %s", d.SHA)
-			}
+			shaStr = " @ " + d.SHA[:min(len(d.SHA), 7)]
 		}
 
-		fmt.Printf("  %s %s%s (%s) [%s, %s]\n",
-			ui.FormatSuccess("●"),
-			ui.FormatInfo(d.URL),
-			ui.FormatDim(shaStr),
-			ui.FormatDim(timeStr),
-			ui.FormatDim(d.OS),
-			ui.FormatDim(abbreviateBlueprintPath(d.Blueprint)),
-		)
-		fmt.Printf("     %s %s\n", ui.FormatDim("Path:"), ui.FormatInfo(d.Path))
-		fmt.Printf("     %s %d links\n", ui.FormatDim("Links:"), len(d.Links))
+		rows = append(rows, statusRow{
+			name:    d.URL,
+			suffix:  shaStr,
+			details: []string{timeutil.Display(d.ClonedAt)},
+			tags:    []string{d.OS, abbreviateBlueprintPath(d.Blueprint)},
+			entry:   &d,
+			sub:     [][2]string{{"Path", d.Path}, {"Links", fmt.Sprintf("%d links", len(d.Links))}},
+		})
 	}
+	printStatusSection("Dotfiles:", rows)
 }
 
 // FindUninstallRules compares dotfiles status against current rules and returns uninstall rules
@@ -581,7 +585,7 @@ func DotfilesLinksForDiff(h *DotfilesHandler, homeDirOverride ...string) []strin
 	}
 
 	abbrev := func(p string) string {
-		if strings.HasPrefix(p, homeDir) {
+		if internal.HasPathPrefix(p, homeDir) {
 			return "~" + p[len(homeDir):]
 		}
 		return p
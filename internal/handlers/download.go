@@ -11,12 +11,28 @@ import (
 
 	"github.com/elpic/blueprint/internal/parser"
 	"github.com/elpic/blueprint/internal/ui"
+	"github.com/elpic/blueprint/internal/ui/timeutil"
 )
 
 func init() {
 	RegisterAction(ActionDef{
 		Name:   "download",
 		Prefix: "download ",
+		Meta: ActionMeta{
+			Summary: "Download a file from a URL.",
+			Usage:   "download <url> to: <path> [overwrite: true] [permissions: <octal>]",
+			Attrs: []AttrMeta{
+				{Name: "to", Type: "path", Required: true, Description: "Destination path"},
+				{Name: "overwrite", Type: "bool", Default: "false", Description: "true re-downloads on every apply"},
+				{Name: "permissions", Type: "octal", Description: "Octal permissions, e.g. 755"},
+				transactionAttr,
+			},
+			Examples: []string{
+				"download https://example.com/tool to: ~/.local/bin/tool permissions: 755",
+			},
+			OS:  []string{"mac", "linux"},
+			Doc: "download.md",
+		},
 		NewHandler: func(rule parser.Rule, basePath string, passwordCache map[string]string) Handler {
 			return NewDownloadHandler(rule, basePath)
 		},
@@ -32,6 +48,9 @@ func init() {
 		OrphanIndex: func(rule parser.Rule, index func(string)) {
 			index(rule.DownloadPath)
 		},
+		Verify: func(e StatusEntry) bool {
+			return pathExists(expandPath(e.(*DownloadStatus).Path))
+		},
 		ShellExport: func(rule parser.Rule, _, _ string) []string {
 			path := shellHome(rule.DownloadPath)
 			dir := shellHome(filepath.Dir(strings.Replace(rule.DownloadPath, "~/", "", 1)))
@@ -144,6 +163,24 @@ func (h *DownloadHandler) Up() (string, error) {
 	return msg, nil
 }
 
+// Staged returns a copy of the handler that downloads to the staged path.
+// An existing file without overwrite: is left alone, so nothing is staged.
+func (h *DownloadHandler) Staged(stage func(dest string) (string, error)) (Handler, error) {
+	destPath := expandPath(h.Rule.DownloadPath)
+	if !h.Rule.DownloadOverwrite {
+		if _, err := os.Stat(destPath); err == nil {
+			return h, nil
+		}
+	}
+	staged, err := stage(destPath)
+	if err != nil {
+		return nil, err
+	}
+	c := *h
+	c.Rule.DownloadPath = staged
+	return &c, nil
+}
+
 // Down removes the downloaded file
 func (h *DownloadHandler) Down() (string, error) {
 	destPath := expandPath(h.Rule.DownloadPath)
@@ -203,7 +240,7 @@ func (h *DownloadHandler) UpdateStatus(status *Status, records []ExecutionRecord
 			status.Downloads = append(status.Downloads, DownloadStatus{
 				URL:          h.Rule.DownloadURL,
 				Path:         h.Rule.DownloadPath,
-				DownloadedAt: time.Now().Format(time.RFC3339),
+				DownloadedAt: timeutil.Now(),
 				Blueprint:    blueprint,
 				OS:           osName,
 			})
@@ -225,10 +262,10 @@ func (h *DownloadHandler) DisplayInfo() {
 		formatFunc = ui.FormatDim
 	}
 
-	fmt.Printf("  %s\n", formatFunc(fmt.Sprintf("URL: %s", h.Rule.DownloadURL)))
-	fmt.Printf("  %s\n", formatFunc(fmt.Sprintf("Destination: %s", h.Rule.DownloadPath)))
+	printInfo(formatFunc, "URL", h.Rule.DownloadURL)
+	printInfo(formatFunc, "Destination", h.Rule.DownloadPath)
 	if h.Rule.DownloadPerms != "" {
-		fmt.Printf("  %s\n", formatFunc(fmt.Sprintf("Permissions: %s", h.Rule.DownloadPerms)))
+		printInfo(formatFunc, "Permissions", h.Rule.DownloadPerms)
 	}
 }
 
@@ -300,22 +337,14 @@ func (h *DownloadHandler) DisplayStatusFromStatus(status *Status) {
 		return
 	}
 
-	fmt.Printf("\n%s\n", ui.FormatHighlight("Downloaded Files:"))
+	rows := make([]statusRow, 0, len(status.Downloads))
 	for _, dl := range status.Downloads {
-		t, err := time.Parse(time.RFC3339, dl.DownloadedAt)
-		var timeStr string
-		if err == nil {
-			timeStr = t.Format("2006-01-02 15:04:05")
-		} else {
-			timeStr = dl.DownloadedAt
-		}
-
-		fmt.Printf("  %s %s (%s) [%s, %s]\n",
-			ui.FormatSuccess("●"),
-			ui.FormatInfo(dl.Path),
-			ui.FormatDim(timeStr),
-			ui.FormatDim(dl.OS),
-			ui.FormatDim(abbreviateBlueprintPath(dl.Blueprint)),
-		)
+		rows = append(rows, statusRow{
+			name:    dl.Path,
+			details: []string{timeutil.Display(dl.DownloadedAt)},
+			tags:    []string{dl.OS, abbreviateBlueprintPath(dl.Blueprint)},
+			entry:   &dl,
+		})
 	}
+	printStatusSection("Downloaded Files:", rows)
 }
@@ -15,6 +15,11 @@ func shellHome(path string) string {
 	return `"` + path + `"`
 }
 
+// ShellQuote quotes s as one word for sh, zsh and fish, in single quotes.
+func ShellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
 // shellQ quotes a string for shell safety.
 func shellQ(s string) string {
 	if s == "" {
@@ -45,7 +45,7 @@ func TestExportInstall_Linux(t *testing.T) {
 	}
 	lines := shellExport(t, "install", rule, "bash", "linux")
 	joined := strings.Join(lines, "\n")
-	if !strings.Contains(joined, "dpkg -s vim") {
+	if !strings.Contains(joined, "dpkg-query -W -f='${Status}' vim") {
 		t.Error("expected dpkg check for vim")
 	}
 	if !strings.Contains(joined, "sudo apt-get install -y vim") {
@@ -63,7 +63,7 @@ func TestExportInstall_SnapPackages(t *testing.T) {
 	}
 	lines := shellExport(t, "install", rule, "bash", "linux")
 	joined := strings.Join(lines, "\n")
-	if !strings.Contains(joined, "dpkg -s vim") {
+	if !strings.Contains(joined, "dpkg-query -W -f='${Status}' vim") {
 		t.Error("expected dpkg check for vim")
 	}
 	if !strings.Contains(joined, "snap list code") {
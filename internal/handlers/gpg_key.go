@@ -1,14 +1,17 @@
 package handlers
 
 import (
+	"bytes"
+	"encoding/hex"
 	"fmt"
 	"os"
 	"os/exec"
 	"strings"
-	"time"
 
+	"github.com/ProtonMail/go-crypto/openpgp"
 	"github.com/elpic/blueprint/internal/parser"
 	"github.com/elpic/blueprint/internal/ui"
+	"github.com/elpic/blueprint/internal/ui/timeutil"
 )
 
 func init() {
@@ -16,6 +19,20 @@ func init() {
 	RegisterAction(ActionDef{
 		Name:   "gpg_key",
 		Prefix: "gpg_key ",
+		Meta: ActionMeta{
+			Summary: "Add a GPG key and the APT repository it signs (older form of repo).",
+			Usage:   "gpg_key <key-url> keyring: <name> deb-url: <repo-url> [fingerprint: <fpr>]",
+			Attrs: []AttrMeta{
+				{Name: "keyring", Type: "string", Required: true, Description: "Keyring name under /etc/apt/keyrings"},
+				{Name: "deb-url", Type: "string", Required: true, Description: "APT repository URL signed by the key"},
+				fingerprintAttr,
+			},
+			Examples: []string{
+				"gpg_key https://download.docker.com/linux/ubuntu/gpg keyring: docker deb-url: https://download.docker.com/linux/ubuntu",
+			},
+			OS:  []string{"linux"},
+			Doc: "gpg-key.md",
+		},
 		NewHandler: func(rule parser.Rule, basePath string, passwordCache map[string]string) Handler {
 			sudoPassword := ""
 			if passwordCache != nil {
@@ -35,19 +52,47 @@ func init() {
 		OrphanIndex: func(rule parser.Rule, index func(string)) {
 			index(rule.GPGKeyring)
 		},
+		Verify: func(e StatusEntry) bool {
+			return pathExists(NewGPGKeyHandler(parser.Rule{GPGKeyring: e.(*GPGKeyStatus).Keyring}, "").keyringPath())
+		},
 		ShellExport: func(rule parser.Rule, _, _ string) []string {
 			keyring := rule.GPGKeyring
-			return []string{
-				"sudo install -m 0755 -d /etc/apt/keyrings",
-				fmt.Sprintf("curl -fsSL %s | sudo tee /etc/apt/keyrings/%s.asc > /dev/null", shellQ(rule.GPGKeyURL), keyring),
-				fmt.Sprintf("sudo chmod go+r /etc/apt/keyrings/%s.asc", keyring),
+			lines := []string{"sudo install -m 0755 -d /etc/apt/keyrings"}
+			lines = append(lines, exportKeyLines(rule.GPGKeyURL, fmt.Sprintf("/etc/apt/keyrings/%s.asc", keyring), rule.GPGKeyFingerprint)...)
+			return append(lines,
 				fmt.Sprintf(`echo "deb [arch=$(dpkg --print-architecture) signed-by=/etc/apt/keyrings/%s.asc] %s" | sudo tee /etc/apt/sources.list.d/%s.list > /dev/null`, keyring, rule.GPGDebURL, keyring),
 				"sudo apt-get update",
-			}
+			)
 		},
 	})
 }
 
+// fingerprintAttr is the fingerprint: attribute of the rules that install a key.
+var fingerprintAttr = AttrMeta{
+	Name:        "fingerprint",
+	Type:        "string",
+	Description: "Fingerprint the downloaded key must have; the rule fails instead of installing any other key",
+}
+
+// exportKeyLines returns the shell lines that download the key at url to
+// path, checking its fingerprint with gpg first when one is pinned.
+func exportKeyLines(url, path, fingerprint string) []string {
+	if fingerprint == "" {
+		return []string{
+			fmt.Sprintf("curl -fsSL %s | sudo tee %s > /dev/null", shellQ(url), path),
+			fmt.Sprintf("sudo chmod go+r %s", path),
+		}
+	}
+	tmp := "/tmp/blueprint-" + strings.TrimSuffix(path[strings.LastIndex(path, "/")+1:], ".asc") + ".key"
+	return []string{
+		fmt.Sprintf("curl -fsSL %s -o %s", shellQ(url), tmp),
+		fmt.Sprintf(`gpg --show-keys --with-colons %s | grep -q ':%s:$' || { echo %s >&2; exit 1; }`,
+			tmp, fingerprint, shellQ("key at "+url+" does not have fingerprint "+fingerprint)),
+		fmt.Sprintf("sudo install -m 0644 %s %s", tmp, path),
+		fmt.Sprintf("rm -f %s", tmp),
+	}
+}
+
 // GPGKeyHandler handles GPG key addition and repository management
 type GPGKeyHandler struct {
 	BaseHandler
@@ -75,16 +120,9 @@ func NewGPGKeyHandlerWithPassword(rule parser.Rule, basePath, sudoPassword strin
 	}
 }
 
-// sudoCommand returns a sudo command that injects the cached password via stdin
-// when available, falling back to plain sudo otherwise.
+// sudoCommand returns a command running args as root, see sudoCommand.
 func (h *GPGKeyHandler) sudoCommand(args ...string) *exec.Cmd {
-	if h.sudoPassword != "" {
-		allArgs := append([]string{"-S"}, args...)
-		cmd := exec.Command("sudo", allArgs...) // #nosec G204
-		cmd.Stdin = strings.NewReader(h.sudoPassword + "\n")
-		return cmd
-	}
-	return exec.Command("sudo", args...) // #nosec G204
+	return sudoCommand(h.sudoPassword, args...)
 }
 
 // keyringPath returns the path where the ASCII-armored key is stored.
@@ -137,6 +175,9 @@ func (h *GPGKeyHandler) Up() (string, error) {
 	repoExists := isRepoConfigured(debURL)
 
 	if keyExists && repoExists {
+		if err := verifyKeyFingerprint(keyringPath, h.Rule.GPGKeyFingerprint); err != nil {
+			return "", fmt.Errorf("installed key %s: %w", keyringPath, err)
+		}
 		return fmt.Sprintf("already configured: %s", h.Rule.GPGKeyring), nil
 	}
 
@@ -147,7 +188,11 @@ func (h *GPGKeyHandler) Up() (string, error) {
 		return "", fmt.Errorf("failed to create keyrings directory: %w\n%s", err, mkdirOut)
 	}
 
-	if !keyExists {
+	if keyExists {
+		if err := verifyKeyFingerprint(keyringPath, h.Rule.GPGKeyFingerprint); err != nil {
+			return "", fmt.Errorf("installed key %s: %w", keyringPath, err)
+		}
+	} else {
 		// Download the ASCII-armored key directly — APT 1.4+ reads .asc natively,
 		// so we can skip gpg --dearmor entirely.
 		if err := h.downloadKey(h.Rule.GPGKeyURL, keyringPath); err != nil {
@@ -188,9 +233,58 @@ func (h *GPGKeyHandler) Up() (string, error) {
 	return fmt.Sprintf("added GPG key %s and repository %s", h.Rule.GPGKeyring, debURL), nil
 }
 
+// keyFingerprints returns the fingerprints of the primary keys in an
+// ASCII-armored or binary OpenPGP key file, as upper-case hex.
+func keyFingerprints(data []byte) ([]string, error) {
+	entities, err := openpgp.ReadArmoredKeyRing(bytes.NewReader(data))
+	if err != nil {
+		if entities, err = openpgp.ReadKeyRing(bytes.NewReader(data)); err != nil {
+			return nil, fmt.Errorf("not an OpenPGP key: %w", err)
+		}
+	}
+	fprs := make([]string, 0, len(entities))
+	for _, e := range entities {
+		fprs = append(fprs, strings.ToUpper(hex.EncodeToString(e.PrimaryKey.Fingerprint)))
+	}
+	return fprs, nil
+}
+
+// verifyKeyFingerprint checks that the key file at path holds the key with
+// fingerprint want, so a compromised key URL cannot get another key trusted
+// by the package manager. An empty want skips the check.
+func verifyKeyFingerprint(path, want string) error {
+	if want == "" {
+		return nil
+	}
+	data, err := os.ReadFile(path) // #nosec G304 -- path is a downloaded key or a fixed keyring location
+	if err != nil {
+		return fmt.Errorf("cannot read key to check its fingerprint: %w", err)
+	}
+	return checkKeyFingerprint(data, want)
+}
+
+// checkKeyFingerprint is verifyKeyFingerprint for key data already read.
+func checkKeyFingerprint(data []byte, want string) error {
+	if want == "" {
+		return nil
+	}
+	fprs, err := keyFingerprints(data)
+	if err != nil {
+		return err
+	}
+	for _, fpr := range fprs {
+		if fpr == want {
+			return nil
+		}
+	}
+	return fmt.Errorf("key fingerprint %s does not match the pinned fingerprint %s", strings.Join(fprs, ", "), want)
+}
+
 // downloadKey fetches a GPG key from url and writes it (as-is) to destPath via sudo tee.
 // Storing the raw .asc avoids gpg --dearmor; APT 1.4+ reads ASCII-armored keys directly.
-var downloadKey = func(url, destPath, sudoPassword string) error {
+// When fingerprint is set the key is checked before it is installed, and
+// nothing is written to destPath if it does not match.
+var downloadKey = func(url, destPath, fingerprint, sudoPassword string) error {
 	// First download to a temp file to avoid piping directly into sudo, which
 	// complicates password injection (sudo -S reads password from stdin, leaving
 	// no clean way to also feed the key data through the same stdin).
@@ -207,23 +301,19 @@ var downloadKey = func(url, destPath, sudoPassword string) error {
 	if err != nil {
 		return fmt.Errorf("curl failed: %w\n%s", err, curlOut)
 	}
+	if err := verifyKeyFingerprint(tmpPath, fingerprint); err != nil {
+		return err
+	}
 
 	// sudo [-S] cp <tmpPath> <destPath>
-	var cpCmd *exec.Cmd
-	if sudoPassword != "" {
-		cpCmd = exec.Command("sudo", "-S", "cp", tmpPath, destPath) // #nosec G204
-		cpCmd.Stdin = strings.NewReader(sudoPassword + "\n")
-	} else {
-		cpCmd = exec.Command("sudo", "cp", tmpPath, destPath) // #nosec G204
-	}
-	if cpOut, err := cpCmd.CombinedOutput(); err != nil {
+	if cpOut, err := sudoCommand(sudoPassword, "cp", tmpPath, destPath).CombinedOutput(); err != nil {
 		return fmt.Errorf("sudo cp failed: %w\n%s", err, cpOut)
 	}
 	return nil
 }
 
 func (h *GPGKeyHandler) downloadKey(url, destPath string) error {
-	return downloadKey(url, destPath, h.sudoPassword)
+	return downloadKey(url, destPath, h.Rule.GPGKeyFingerprint, h.sudoPassword)
 }
 
 // Down removes the GPG key and repository
@@ -266,12 +356,13 @@ func (h *GPGKeyHandler) UpdateStatus(status *Status, records []ExecutionRecord,
 		if isKeyringInstalled(h.keyringPath()) {
 			status.GPGKeys = removeGPGKeyStatus(status.GPGKeys, h.Rule.GPGKeyring, blueprint, osName)
 			status.GPGKeys = append(status.GPGKeys, GPGKeyStatus{
-				Keyring:   h.Rule.GPGKeyring,
-				URL:       h.Rule.GPGKeyURL,
-				DebURL:    h.Rule.GPGDebURL,
-				AddedAt:   time.Now().Format(time.RFC3339),
-				Blueprint: blueprint,
-				OS:        osName,
+				Keyring:     h.Rule.GPGKeyring,
+				URL:         h.Rule.GPGKeyURL,
+				DebURL:      h.Rule.GPGDebURL,
+				Fingerprint: h.Rule.GPGKeyFingerprint,
+				AddedAt:     timeutil.Now(),
+				Blueprint:   blueprint,
+				OS:          osName,
 			})
 		}
 	} else if h.Rule.Action == "uninstall" && DetectRuleType(h.Rule) == "gpg_key" {
@@ -286,6 +377,11 @@ func (h *GPGKeyHandler) NeedsSudo() bool {
 	return true
 }
 
+// ConcurrencyClass returns "apt" because installing a key runs apt-get update
+func (h *GPGKeyHandler) ConcurrencyClass() string {
+	return "apt"
+}
+
 // DisplayInfo displays handler-specific information
 func (h *GPGKeyHandler) DisplayInfo() {
 	formatFunc := ui.FormatInfo
@@ -293,9 +389,9 @@ func (h *GPGKeyHandler) DisplayInfo() {
 		formatFunc = ui.FormatDim
 	}
 
-	fmt.Printf("  %s\n", formatFunc(fmt.Sprintf("Keyring: %s", h.Rule.GPGKeyring)))
-	fmt.Printf("  %s\n", formatFunc(fmt.Sprintf("Repository: %s", h.Rule.GPGDebURL)))
-	fmt.Printf("  %s\n", formatFunc(fmt.Sprintf("Key URL: %s", h.Rule.GPGKeyURL)))
+	printInfo(formatFunc, "Keyring", h.Rule.GPGKeyring)
+	printInfo(formatFunc, "Repository", h.Rule.GPGDebURL)
+	printInfo(formatFunc, "Key URL", h.Rule.GPGKeyURL)
 }
 
 // DisplayStatus displays GPG key status information
@@ -304,24 +400,16 @@ func (h *GPGKeyHandler) DisplayStatus(keys []GPGKeyStatus) {
 		return
 	}
 
-	fmt.Printf("\n%s\n", ui.FormatHighlight("GPG Keys:"))
+	rows := make([]statusRow, 0, len(keys))
 	for _, key := range keys {
-		t, err := time.Parse(time.RFC3339, key.AddedAt)
-		var timeStr string
-		if err == nil {
-			timeStr = t.Format("2006-01-02 15:04:05")
-		} else {
-			timeStr = key.AddedAt
-		}
-
-		fmt.Printf("  %s %s (%s) [%s, %s]\n",
-			ui.FormatSuccess("●"),
-			ui.FormatInfo(key.Keyring),
-			ui.FormatDim(timeStr),
-			ui.FormatDim(key.OS),
-			ui.FormatDim(abbreviateBlueprintPath(key.Blueprint)),
-		)
+		rows = append(rows, statusRow{
+			name:    key.Keyring,
+			details: []string{timeutil.Display(key.AddedAt)},
+			tags:    []string{key.OS, abbreviateBlueprintPath(key.Blueprint)},
+			entry:   &key,
+		})
 	}
+	printStatusSection("GPG Keys:", rows)
 }
 
 // DisplayStatusFromStatus displays GPG key handler status from Status object
@@ -359,6 +447,10 @@ func (h *GPGKeyHandler) FindUninstallRules(status *Status, currentRules []parser
 		if rule.Action == "gpg_key" && rule.GPGKeyring != "" {
 			currentGPGKeys[rule.GPGKeyring] = true
 		}
+		// A repo rule of the same name takes over the key (see RepoHandler.keyPath)
+		if rule.Action == "repo" && rule.RepoName != "" {
+			currentGPGKeys[rule.RepoName] = true
+		}
 	}
 
 	var rules []parser.Rule
@@ -33,7 +33,7 @@ func TestGPGKeyDownloadKeyURLPassedAsArgument(t *testing.T) {
 	original := downloadKey
 	defer func() { downloadKey = original }()
 
-	downloadKey = func(url, destPath, sudoPassword string) error {
+	downloadKey = func(url, destPath, _, sudoPassword string) error {
 		capturedURL = url
 		return nil
 	}
@@ -85,7 +85,7 @@ func TestGPGKeyGetCommandDoesNotExecShellInjection(t *testing.T) {
 	// Stub downloadKey so it succeeds without running curl.
 	origDL := downloadKey
 	defer func() { downloadKey = origDL }()
-	downloadKey = func(url, destPath, sudoPassword string) error { return nil }
+	downloadKey = func(url, destPath, _, sudoPassword string) error { return nil }
 
 	_, _ = handler.Up()
 
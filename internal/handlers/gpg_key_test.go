@@ -2,11 +2,16 @@ package handlers
 
 import (
 	"bytes"
+	"encoding/hex"
 	"io"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
 	"github.com/elpic/blueprint/internal/parser"
 )
 
@@ -779,3 +784,61 @@ func TestGPGKeyHandlerGetDependencyKey(t *testing.T) {
 		})
 	}
 }
+
+// testArmoredKey returns a new ASCII-armored public key and its fingerprint.
+func testArmoredKey(t *testing.T) (string, string) {
+	t.Helper()
+	entity, err := openpgp.NewEntity("Repo", "", "repo@example.com", &packet.Config{Algorithm: packet.PubKeyAlgoEdDSA})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	w, err := armor.Encode(&buf, openpgp.PublicKeyType, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := entity.Serialize(w); err != nil {
+		t.Fatal(err)
+	}
+	_ = w.Close()
+	return buf.String(), strings.ToUpper(hex.EncodeToString(entity.PrimaryKey.Fingerprint))
+}
+
+func TestVerifyKeyFingerprint(t *testing.T) {
+	key, fpr := testArmoredKey(t)
+	path := filepath.Join(t.TempDir(), "key.asc")
+	if err := os.WriteFile(path, []byte(key), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := verifyKeyFingerprint(path, fpr); err != nil {
+		t.Errorf("verifyKeyFingerprint() with the key's fingerprint = %v", err)
+	}
+	if err := verifyKeyFingerprint(path, ""); err != nil {
+		t.Errorf("verifyKeyFingerprint() without a pinned fingerprint = %v", err)
+	}
+	other := strings.Repeat("A", 40)
+	if err := verifyKeyFingerprint(path, other); err == nil || !strings.Contains(err.Error(), fpr) {
+		t.Errorf("verifyKeyFingerprint() with another fingerprint = %v, want a mismatch naming %s", err, fpr)
+	}
+	if err := checkKeyFingerprint([]byte("<html>not found</html>"), other); err == nil {
+		t.Error("checkKeyFingerprint() should reject data that is not a key")
+	}
+}
+
+func TestExportKeyLinesChecksFingerprint(t *testing.T) {
+	fpr := strings.Repeat("AB", 20)
+	script := strings.Join(exportKeyLines("https://example.com/key", "/etc/apt/keyrings/docker.asc", fpr), "\n")
+	for _, want := range []string{
+		`curl -fsSL "https://example.com/key" -o /tmp/blueprint-docker.key`,
+		"gpg --show-keys --with-colons /tmp/blueprint-docker.key | grep -q ':" + fpr + ":$' || {",
+		"sudo install -m 0644 /tmp/blueprint-docker.key /etc/apt/keyrings/docker.asc",
+	} {
+		if !strings.Contains(script, want) {
+			t.Errorf("export missing %q:\n%s", want, script)
+		}
+	}
+	if strings.Contains(strings.Join(exportKeyLines("https://example.com/key", "/etc/apt/keyrings/docker.asc", ""), "\n"), "gpg") {
+		t.Error("export should not check a fingerprint that is not pinned")
+	}
+}
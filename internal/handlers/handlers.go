@@ -1,14 +1,17 @@
 package handlers
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
 	"regexp"
 	"strings"
 
+	"github.com/elpic/blueprint/internal"
 	gitpkg "github.com/elpic/blueprint/internal/git"
 	"github.com/elpic/blueprint/internal/parser"
 	"github.com/elpic/blueprint/internal/platform"
+	"github.com/elpic/blueprint/internal/ui"
 )
 
 // ExecutionRecord represents a single command execution
@@ -25,19 +28,24 @@ type ExecutionRecord struct {
 // PackageStatus tracks an installed package
 type PackageStatus struct {
 	Name        string `json:"name"`
+	Version     string `json:"version,omitempty"` // installed version reported by the package manager, when known
 	InstalledAt string `json:"installed_at"`
 	Blueprint   string `json:"blueprint"`
 	OS          string `json:"os"`
+	Machine     string `json:"machine,omitempty"`     // machine the entry was recorded on, see OnMachine
+	VerifiedAt  string `json:"verified_at,omitempty"` // last time status --check found it present
 }
 
 // CloneStatus tracks a cloned repository
 type CloneStatus struct {
-	URL       string `json:"url"`
-	Path      string `json:"path"`
-	SHA       string `json:"sha"`
-	ClonedAt  string `json:"cloned_at"`
-	Blueprint string `json:"blueprint"`
-	OS        string `json:"os"`
+	URL        string `json:"url"`
+	Path       string `json:"path"`
+	SHA        string `json:"sha"`
+	ClonedAt   string `json:"cloned_at"`
+	Blueprint  string `json:"blueprint"`
+	OS         string `json:"os"`
+	Machine    string `json:"machine,omitempty"`     // machine the entry was recorded on, see OnMachine
+	VerifiedAt string `json:"verified_at,omitempty"` // last time status --check found it present
 }
 
 // DecryptStatus tracks a decrypted file
@@ -47,33 +55,56 @@ type DecryptStatus struct {
 	DecryptedAt string `json:"decrypted_at"`
 	Blueprint   string `json:"blueprint"`
 	OS          string `json:"os"`
+	Machine     string `json:"machine,omitempty"`     // machine the entry was recorded on, see OnMachine
+	VerifiedAt  string `json:"verified_at,omitempty"` // last time status --check found it present
 }
 
 // MkdirStatus tracks a created directory
 type MkdirStatus struct {
-	Path      string `json:"path"`
-	CreatedAt string `json:"created_at"`
-	Blueprint string `json:"blueprint"`
-	OS        string `json:"os"`
+	Path       string `json:"path"`
+	CreatedAt  string `json:"created_at"`
+	Blueprint  string `json:"blueprint"`
+	OS         string `json:"os"`
+	Machine    string `json:"machine,omitempty"`     // machine the entry was recorded on, see OnMachine
+	VerifiedAt string `json:"verified_at,omitempty"` // last time status --check found it present
 }
 
 // KnownHostsStatus tracks an SSH known host entry
 type KnownHostsStatus struct {
-	Host      string `json:"host"`
-	KeyType   string `json:"key_type"`
-	AddedAt   string `json:"added_at"`
-	Blueprint string `json:"blueprint"`
-	OS        string `json:"os"`
+	Host       string `json:"host"`
+	KeyType    string `json:"key_type"`
+	AddedAt    string `json:"added_at"`
+	Blueprint  string `json:"blueprint"`
+	OS         string `json:"os"`
+	Machine    string `json:"machine,omitempty"`     // machine the entry was recorded on, see OnMachine
+	VerifiedAt string `json:"verified_at,omitempty"` // last time status --check found it present
 }
 
 // GPGKeyStatus tracks an added GPG key and repository
 type GPGKeyStatus struct {
-	Keyring   string `json:"keyring"`
-	URL       string `json:"url"`
-	DebURL    string `json:"deb_url"`
-	AddedAt   string `json:"added_at"`
-	Blueprint string `json:"blueprint"`
-	OS        string `json:"os"`
+	Keyring     string `json:"keyring"`
+	URL         string `json:"url"`
+	DebURL      string `json:"deb_url"`
+	Fingerprint string `json:"fingerprint,omitempty"` // pinned with fingerprint:, checked by refresh-keys
+	AddedAt     string `json:"added_at"`
+	Blueprint   string `json:"blueprint"`
+	OS          string `json:"os"`
+	Machine     string `json:"machine,omitempty"`     // machine the entry was recorded on, see OnMachine
+	VerifiedAt  string `json:"verified_at,omitempty"` // last time status --check found it present
+}
+
+// RepoStatus tracks a configured package repository
+type RepoStatus struct {
+	Name        string `json:"name"`
+	Type        string `json:"type"`
+	URL         string `json:"url"`
+	KeyURL      string `json:"key_url"`
+	Fingerprint string `json:"fingerprint,omitempty"` // pinned with fingerprint:, checked by refresh-keys
+	AddedAt     string `json:"added_at"`
+	Blueprint   string `json:"blueprint"`
+	OS          string `json:"os"`
+	Machine     string `json:"machine,omitempty"`     // machine the entry was recorded on, see OnMachine
+	VerifiedAt  string `json:"verified_at,omitempty"` // last time status --check found it present
 }
 
 // AsdfStatus tracks installed asdf plugins/versions
@@ -83,6 +114,8 @@ type AsdfStatus struct {
 	InstalledAt string `json:"installed_at"`
 	Blueprint   string `json:"blueprint"`
 	OS          string `json:"os"`
+	Machine     string `json:"machine,omitempty"`     // machine the entry was recorded on, see OnMachine
+	VerifiedAt  string `json:"verified_at,omitempty"` // last time status --check found it present
 }
 
 // MiseStatus tracks installed mise tools/versions
@@ -92,14 +125,18 @@ type MiseStatus struct {
 	InstalledAt string `json:"installed_at"`
 	Blueprint   string `json:"blueprint"`
 	OS          string `json:"os"`
+	Machine     string `json:"machine,omitempty"`     // machine the entry was recorded on, see OnMachine
+	VerifiedAt  string `json:"verified_at,omitempty"` // last time status --check found it present
 }
 
 // SudoersStatus tracks a sudoers entry added for a user
 type SudoersStatus struct {
-	User      string `json:"user"`
-	AddedAt   string `json:"added_at"`
-	Blueprint string `json:"blueprint"`
-	OS        string `json:"os"`
+	User       string `json:"user"`
+	AddedAt    string `json:"added_at"`
+	Blueprint  string `json:"blueprint"`
+	OS         string `json:"os"`
+	Machine    string `json:"machine,omitempty"`     // machine the entry was recorded on, see OnMachine
+	VerifiedAt string `json:"verified_at,omitempty"` // last time status --check found it present
 }
 
 // ScheduleStatus tracks a crontab schedule entry
@@ -109,6 +146,19 @@ type ScheduleStatus struct {
 	InstalledAt string `json:"installed_at"`
 	Blueprint   string `json:"blueprint"`
 	OS          string `json:"os"`
+	Machine     string `json:"machine,omitempty"`     // machine the entry was recorded on, see OnMachine
+	VerifiedAt  string `json:"verified_at,omitempty"` // last time status --check found it present
+}
+
+// StateBackupStatus tracks the crontab entry that backs up ~/.blueprint
+type StateBackupStatus struct {
+	Every       string `json:"every"`
+	To          string `json:"to"`
+	InstalledAt string `json:"installed_at"`
+	Blueprint   string `json:"blueprint"`
+	OS          string `json:"os"`
+	Machine     string `json:"machine,omitempty"`     // machine the entry was recorded on, see OnMachine
+	VerifiedAt  string `json:"verified_at,omitempty"` // last time status --check found it present
 }
 
 // HomebrewStatus tracks installed homebrew formulas
@@ -118,6 +168,8 @@ type HomebrewStatus struct {
 	InstalledAt string `json:"installed_at"`
 	Blueprint   string `json:"blueprint"`
 	OS          string `json:"os"`
+	Machine     string `json:"machine,omitempty"`     // machine the entry was recorded on, see OnMachine
+	VerifiedAt  string `json:"verified_at,omitempty"` // last time status --check found it present
 }
 
 // OllamaStatus tracks installed ollama models
@@ -126,6 +178,82 @@ type OllamaStatus struct {
 	InstalledAt string `json:"installed_at"`
 	Blueprint   string `json:"blueprint"`
 	OS          string `json:"os"`
+	Machine     string `json:"machine,omitempty"`     // machine the entry was recorded on, see OnMachine
+	VerifiedAt  string `json:"verified_at,omitempty"` // last time status --check found it present
+}
+
+// MasStatus tracks a Mac App Store app installed with mas
+type MasStatus struct {
+	App         string `json:"app"`  // as written in the rule: an ID or a name
+	ID          string `json:"id"`   // App Store ID
+	Name        string `json:"name"` // app name reported by mas
+	InstalledAt string `json:"installed_at"`
+	Blueprint   string `json:"blueprint"`
+	OS          string `json:"os"`
+	Machine     string `json:"machine,omitempty"`     // machine the entry was recorded on, see OnMachine
+	VerifiedAt  string `json:"verified_at,omitempty"` // last time status --check found it present
+}
+
+// DevcertStatus tracks a development certificate created by a devcert rule
+type DevcertStatus struct {
+	Name        string   `json:"name"` // first host name, the rule's key
+	Names       []string `json:"names"`
+	Via         string   `json:"via"` // mkcert or builtin
+	Cert        string   `json:"cert"`
+	Key         string   `json:"key"`
+	ExpiresAt   string   `json:"expires_at,omitempty"`
+	InstalledAt string   `json:"installed_at"`
+	Blueprint   string   `json:"blueprint"`
+	OS          string   `json:"os"`
+	Machine     string   `json:"machine,omitempty"`     // machine the entry was recorded on, see OnMachine
+	VerifiedAt  string   `json:"verified_at,omitempty"` // last time status --check found it present
+}
+
+// PPAStatus tracks a Launchpad PPA added by a ppa rule
+type PPAStatus struct {
+	PPA         string `json:"ppa"` // owner/name
+	Fingerprint string `json:"fingerprint"`
+	Suite       string `json:"suite"`
+	AddedAt     string `json:"added_at"`
+	Blueprint   string `json:"blueprint"`
+	OS          string `json:"os"`
+	Machine     string `json:"machine,omitempty"`     // machine the entry was recorded on, see OnMachine
+	VerifiedAt  string `json:"verified_at,omitempty"` // last time status --check found it present
+}
+
+// ServiceStatus tracks a systemd unit or launchd service a service rule
+// enabled or started
+type ServiceStatus struct {
+	Name        string `json:"name"`
+	State       string `json:"state"` // enabled or started
+	Scope       string `json:"scope"` // system or user
+	InstalledAt string `json:"installed_at"`
+	Blueprint   string `json:"blueprint"`
+	OS          string `json:"os"`
+	Machine     string `json:"machine,omitempty"`     // machine the entry was recorded on, see OnMachine
+	VerifiedAt  string `json:"verified_at,omitempty"` // last time status --check found it present
+}
+
+// DockerImageStatus tracks an image a docker rule pulled
+type DockerImageStatus struct {
+	Image      string `json:"image"` // as written in the rule, e.g. postgres:16
+	PulledAt   string `json:"pulled_at"`
+	Blueprint  string `json:"blueprint"`
+	OS         string `json:"os"`
+	Machine    string `json:"machine,omitempty"`     // machine the entry was recorded on, see OnMachine
+	VerifiedAt string `json:"verified_at,omitempty"` // last time status --check found it present
+}
+
+// AutostartStatus tracks a login item an autostart rule wrote
+type AutostartStatus struct {
+	Name        string `json:"name"`
+	Exec        string `json:"exec"`
+	Path        string `json:"path"` // the .desktop file or LaunchAgent plist written
+	InstalledAt string `json:"installed_at"`
+	Blueprint   string `json:"blueprint"`
+	OS          string `json:"os"`
+	Machine     string `json:"machine,omitempty"`     // machine the entry was recorded on, see OnMachine
+	VerifiedAt  string `json:"verified_at,omitempty"` // last time status --check found it present
 }
 
 // DownloadStatus tracks a downloaded file
@@ -135,25 +263,33 @@ type DownloadStatus struct {
 	DownloadedAt string `json:"downloaded_at"`
 	Blueprint    string `json:"blueprint"`
 	OS           string `json:"os"`
+	Machine      string `json:"machine,omitempty"`     // machine the entry was recorded on, see OnMachine
+	VerifiedAt   string `json:"verified_at,omitempty"` // last time status --check found it present
 }
 
 // RunStatus tracks an executed run/run-sh command
 type RunStatus struct {
-	Action    string `json:"action"`  // "run" or "run-sh"
-	Command   string `json:"command"` // The run command or script URL
-	UndoCmd   string `json:"undo_cmd,omitempty"`
-	Sudo      bool   `json:"sudo,omitempty"` // Whether sudo was used
-	RanAt     string `json:"ran_at"`
-	Blueprint string `json:"blueprint"`
-	OS        string `json:"os"`
+	Action     string `json:"action"`  // "run" or "run-sh"
+	Command    string `json:"command"` // The run command or script URL
+	UndoCmd    string `json:"undo_cmd,omitempty"`
+	Sudo       bool   `json:"sudo,omitempty"`      // Whether sudo was used
+	CleanEnv   bool   `json:"clean_env,omitempty"` // Whether the command ran with a minimal environment
+	Creates    string `json:"creates,omitempty"`   // Path the command creates (creates:); the rule runs again once it is gone
+	RanAt      string `json:"ran_at"`
+	Blueprint  string `json:"blueprint"`
+	OS         string `json:"os"`
+	Machine    string `json:"machine,omitempty"`     // machine the entry was recorded on, see OnMachine
+	VerifiedAt string `json:"verified_at,omitempty"` // last time status --check found it present
 }
 
 // AuthorizedKeysStatus tracks an added authorized key
 type AuthorizedKeysStatus struct {
-	Source    string `json:"source"`
-	AddedAt   string `json:"added_at"`
-	Blueprint string `json:"blueprint"`
-	OS        string `json:"os"`
+	Source     string `json:"source"`
+	AddedAt    string `json:"added_at"`
+	Blueprint  string `json:"blueprint"`
+	OS         string `json:"os"`
+	Machine    string `json:"machine,omitempty"`     // machine the entry was recorded on, see OnMachine
+	VerifiedAt string `json:"verified_at,omitempty"` // last time status --check found it present
 }
 
 // ShellStatus tracks a shell change
@@ -164,18 +300,22 @@ type ShellStatus struct {
 	ChangedAt     string `json:"changed_at"`
 	Blueprint     string `json:"blueprint"`
 	OS            string `json:"os"`
+	Machine       string `json:"machine,omitempty"`     // machine the entry was recorded on, see OnMachine
+	VerifiedAt    string `json:"verified_at,omitempty"` // last time status --check found it present
 }
 
 // DotfilesStatus tracks a managed dotfiles repository
 type DotfilesStatus struct {
-	URL       string   `json:"url"`
-	Path      string   `json:"path"`
-	Branch    string   `json:"branch,omitempty"`
-	SHA       string   `json:"sha"`   // SHA of the cloned repository
-	Links     []string `json:"links"` // symlink targets created (e.g. ["/home/user/.zshrc"])
-	ClonedAt  string   `json:"cloned_at"`
-	Blueprint string   `json:"blueprint"`
-	OS        string   `json:"os"`
+	URL        string   `json:"url"`
+	Path       string   `json:"path"`
+	Branch     string   `json:"branch,omitempty"`
+	SHA        string   `json:"sha"`   // SHA of the cloned repository
+	Links      []string `json:"links"` // symlink targets created (e.g. ["/home/user/.zshrc"])
+	ClonedAt   string   `json:"cloned_at"`
+	Blueprint  string   `json:"blueprint"`
+	OS         string   `json:"os"`
+	Machine    string   `json:"machine,omitempty"`     // machine the entry was recorded on, see OnMachine
+	VerifiedAt string   `json:"verified_at,omitempty"` // last time status --check found it present
 }
 
 // StatusEntry is implemented by every *Status struct so that cross-cutting
@@ -185,118 +325,335 @@ type StatusEntry interface {
 	GetBlueprint() string
 	SetBlueprint(string)
 	GetResourceKey() string // the identity used for dedup/orphan checks (name, path, command, etc.)
+	SetResourceKey(string)  // rewrites the identity, used when a rule is renamed via aliases:
 	GetOS() string
-	GetAction() string // the action name this entry belongs to (e.g. "install", "run", "asdf")
+	GetMachine() string // machine the entry was recorded on, see OnMachine
+	SetMachine(string)
+	GetAction() string     // the action name this entry belongs to (e.g. "install", "run", "asdf")
+	GetAppliedAt() string  // RFC3339 time the resource was last applied (installed, cloned, ran, ...)
+	GetVerifiedAt() string // RFC3339 time `blueprint status --check` last found the resource present
+	SetVerifiedAt(string)
 }
 
 // StatusEntry implementations for all status structs.
 // Each struct implements GetBlueprint, SetBlueprint, GetOS (identical across all),
 // plus GetResourceKey which is the type-specific identity field.
 
-func (v *PackageStatus) GetBlueprint() string   { return v.Blueprint }
-func (v *PackageStatus) SetBlueprint(s string)  { v.Blueprint = s }
-func (v *PackageStatus) GetResourceKey() string { return v.Name }
-func (v *PackageStatus) GetOS() string          { return v.OS }
-func (v *PackageStatus) GetAction() string      { return "install" }
-
-func (v *CloneStatus) GetBlueprint() string   { return v.Blueprint }
-func (v *CloneStatus) SetBlueprint(s string)  { v.Blueprint = s }
-func (v *CloneStatus) GetResourceKey() string { return v.Path }
-func (v *CloneStatus) GetOS() string          { return v.OS }
-func (v *CloneStatus) GetAction() string      { return "clone" }
-
-func (v *DecryptStatus) GetBlueprint() string   { return v.Blueprint }
-func (v *DecryptStatus) SetBlueprint(s string)  { v.Blueprint = s }
-func (v *DecryptStatus) GetResourceKey() string { return v.DestPath }
-func (v *DecryptStatus) GetOS() string          { return v.OS }
-func (v *DecryptStatus) GetAction() string      { return "decrypt" }
-
-func (v *MkdirStatus) GetBlueprint() string   { return v.Blueprint }
-func (v *MkdirStatus) SetBlueprint(s string)  { v.Blueprint = s }
-func (v *MkdirStatus) GetResourceKey() string { return v.Path }
-func (v *MkdirStatus) GetOS() string          { return v.OS }
-func (v *MkdirStatus) GetAction() string      { return "mkdir" }
-
-func (v *KnownHostsStatus) GetBlueprint() string   { return v.Blueprint }
-func (v *KnownHostsStatus) SetBlueprint(s string)  { v.Blueprint = s }
-func (v *KnownHostsStatus) GetResourceKey() string { return v.Host }
-func (v *KnownHostsStatus) GetOS() string          { return v.OS }
-func (v *KnownHostsStatus) GetAction() string      { return "known_hosts" }
-
-func (v *GPGKeyStatus) GetBlueprint() string   { return v.Blueprint }
-func (v *GPGKeyStatus) SetBlueprint(s string)  { v.Blueprint = s }
-func (v *GPGKeyStatus) GetResourceKey() string { return v.Keyring }
-func (v *GPGKeyStatus) GetOS() string          { return v.OS }
-func (v *GPGKeyStatus) GetAction() string      { return "gpg_key" }
-
-func (v *AsdfStatus) GetBlueprint() string   { return v.Blueprint }
-func (v *AsdfStatus) SetBlueprint(s string)  { v.Blueprint = s }
-func (v *AsdfStatus) GetResourceKey() string { return v.Plugin + "\x00" + v.Version }
-func (v *AsdfStatus) GetOS() string          { return v.OS }
-func (v *AsdfStatus) GetAction() string      { return "asdf" }
-
-func (v *MiseStatus) GetBlueprint() string   { return v.Blueprint }
-func (v *MiseStatus) SetBlueprint(s string)  { v.Blueprint = s }
-func (v *MiseStatus) GetResourceKey() string { return v.Tool + "\x00" + v.Version }
-func (v *MiseStatus) GetOS() string          { return v.OS }
-func (v *MiseStatus) GetAction() string      { return "mise" }
-
-func (v *SudoersStatus) GetBlueprint() string   { return v.Blueprint }
-func (v *SudoersStatus) SetBlueprint(s string)  { v.Blueprint = s }
-func (v *SudoersStatus) GetResourceKey() string { return v.User }
-func (v *SudoersStatus) GetOS() string          { return v.OS }
-func (v *SudoersStatus) GetAction() string      { return "sudoers" }
-
-func (v *HomebrewStatus) GetBlueprint() string   { return v.Blueprint }
-func (v *HomebrewStatus) SetBlueprint(s string)  { v.Blueprint = s }
-func (v *HomebrewStatus) GetResourceKey() string { return v.Formula }
-func (v *HomebrewStatus) GetOS() string          { return v.OS }
-func (v *HomebrewStatus) GetAction() string      { return "homebrew" }
-
-func (v *OllamaStatus) GetBlueprint() string   { return v.Blueprint }
-func (v *OllamaStatus) SetBlueprint(s string)  { v.Blueprint = s }
-func (v *OllamaStatus) GetResourceKey() string { return v.Model }
-func (v *OllamaStatus) GetOS() string          { return v.OS }
-func (v *OllamaStatus) GetAction() string      { return "ollama" }
-
-func (v *DownloadStatus) GetBlueprint() string   { return v.Blueprint }
-func (v *DownloadStatus) SetBlueprint(s string)  { v.Blueprint = s }
-func (v *DownloadStatus) GetResourceKey() string { return v.Path }
-func (v *DownloadStatus) GetOS() string          { return v.OS }
-func (v *DownloadStatus) GetAction() string      { return "download" }
-
-func (v *RunStatus) GetBlueprint() string   { return v.Blueprint }
-func (v *RunStatus) SetBlueprint(s string)  { v.Blueprint = s }
-func (v *RunStatus) GetResourceKey() string { return v.Command }
-func (v *RunStatus) GetOS() string          { return v.OS }
-func (v *RunStatus) GetAction() string      { return v.Action }
-
-func (v *DotfilesStatus) GetBlueprint() string   { return v.Blueprint }
-func (v *DotfilesStatus) SetBlueprint(s string)  { v.Blueprint = s }
-func (v *DotfilesStatus) GetResourceKey() string { return v.URL }
-func (v *DotfilesStatus) GetOS() string          { return v.OS }
-func (v *DotfilesStatus) GetAction() string      { return "dotfiles" }
-
-func (v *ScheduleStatus) GetBlueprint() string   { return v.Blueprint }
-func (v *ScheduleStatus) SetBlueprint(s string)  { v.Blueprint = s }
-func (v *ScheduleStatus) GetResourceKey() string { return v.Source }
-func (v *ScheduleStatus) GetOS() string          { return v.OS }
-func (v *ScheduleStatus) GetAction() string      { return "schedule" }
-
-func (v *AuthorizedKeysStatus) GetBlueprint() string   { return v.Blueprint }
-func (v *AuthorizedKeysStatus) SetBlueprint(s string)  { v.Blueprint = s }
-func (v *AuthorizedKeysStatus) GetResourceKey() string { return v.Source }
-func (v *AuthorizedKeysStatus) GetOS() string          { return v.OS }
-func (v *AuthorizedKeysStatus) GetAction() string      { return "authorized_keys" }
-
-func (v *ShellStatus) GetBlueprint() string   { return v.Blueprint }
-func (v *ShellStatus) SetBlueprint(s string)  { v.Blueprint = s }
-func (v *ShellStatus) GetResourceKey() string { return v.User }
-func (v *ShellStatus) GetOS() string          { return v.OS }
-func (v *ShellStatus) GetAction() string      { return "shell" }
+func (v *PackageStatus) GetBlueprint() string    { return v.Blueprint }
+func (v *PackageStatus) SetBlueprint(s string)   { v.Blueprint = s }
+func (v *PackageStatus) GetResourceKey() string  { return v.Name }
+func (v *PackageStatus) SetResourceKey(s string) { v.Name = s }
+func (v *PackageStatus) GetOS() string           { return v.OS }
+func (v *PackageStatus) GetMachine() string      { return v.Machine }
+func (v *PackageStatus) SetMachine(s string)     { v.Machine = s }
+func (v *PackageStatus) GetAction() string       { return "install" }
+func (v *PackageStatus) GetAppliedAt() string    { return v.InstalledAt }
+func (v *PackageStatus) GetVerifiedAt() string   { return v.VerifiedAt }
+func (v *PackageStatus) SetVerifiedAt(s string)  { v.VerifiedAt = s }
+
+func (v *CloneStatus) GetBlueprint() string    { return v.Blueprint }
+func (v *CloneStatus) SetBlueprint(s string)   { v.Blueprint = s }
+func (v *CloneStatus) GetResourceKey() string  { return v.Path }
+func (v *CloneStatus) SetResourceKey(s string) { v.Path = s }
+func (v *CloneStatus) GetOS() string           { return v.OS }
+func (v *CloneStatus) GetMachine() string      { return v.Machine }
+func (v *CloneStatus) SetMachine(s string)     { v.Machine = s }
+func (v *CloneStatus) GetAction() string       { return "clone" }
+func (v *CloneStatus) GetAppliedAt() string    { return v.ClonedAt }
+func (v *CloneStatus) GetVerifiedAt() string   { return v.VerifiedAt }
+func (v *CloneStatus) SetVerifiedAt(s string)  { v.VerifiedAt = s }
+
+func (v *DecryptStatus) GetBlueprint() string    { return v.Blueprint }
+func (v *DecryptStatus) SetBlueprint(s string)   { v.Blueprint = s }
+func (v *DecryptStatus) GetResourceKey() string  { return v.DestPath }
+func (v *DecryptStatus) SetResourceKey(s string) { v.DestPath = s }
+func (v *DecryptStatus) GetOS() string           { return v.OS }
+func (v *DecryptStatus) GetMachine() string      { return v.Machine }
+func (v *DecryptStatus) SetMachine(s string)     { v.Machine = s }
+func (v *DecryptStatus) GetAction() string       { return "decrypt" }
+func (v *DecryptStatus) GetAppliedAt() string    { return v.DecryptedAt }
+func (v *DecryptStatus) GetVerifiedAt() string   { return v.VerifiedAt }
+func (v *DecryptStatus) SetVerifiedAt(s string)  { v.VerifiedAt = s }
+
+func (v *MkdirStatus) GetBlueprint() string    { return v.Blueprint }
+func (v *MkdirStatus) SetBlueprint(s string)   { v.Blueprint = s }
+func (v *MkdirStatus) GetResourceKey() string  { return v.Path }
+func (v *MkdirStatus) SetResourceKey(s string) { v.Path = s }
+func (v *MkdirStatus) GetOS() string           { return v.OS }
+func (v *MkdirStatus) GetMachine() string      { return v.Machine }
+func (v *MkdirStatus) SetMachine(s string)     { v.Machine = s }
+func (v *MkdirStatus) GetAction() string       { return "mkdir" }
+func (v *MkdirStatus) GetAppliedAt() string    { return v.CreatedAt }
+func (v *MkdirStatus) GetVerifiedAt() string   { return v.VerifiedAt }
+func (v *MkdirStatus) SetVerifiedAt(s string)  { v.VerifiedAt = s }
+
+func (v *KnownHostsStatus) GetBlueprint() string    { return v.Blueprint }
+func (v *KnownHostsStatus) SetBlueprint(s string)   { v.Blueprint = s }
+func (v *KnownHostsStatus) GetResourceKey() string  { return v.Host }
+func (v *KnownHostsStatus) SetResourceKey(s string) { v.Host = s }
+func (v *KnownHostsStatus) GetOS() string           { return v.OS }
+func (v *KnownHostsStatus) GetMachine() string      { return v.Machine }
+func (v *KnownHostsStatus) SetMachine(s string)     { v.Machine = s }
+func (v *KnownHostsStatus) GetAction() string       { return "known_hosts" }
+func (v *KnownHostsStatus) GetAppliedAt() string    { return v.AddedAt }
+func (v *KnownHostsStatus) GetVerifiedAt() string   { return v.VerifiedAt }
+func (v *KnownHostsStatus) SetVerifiedAt(s string)  { v.VerifiedAt = s }
+
+func (v *GPGKeyStatus) GetBlueprint() string    { return v.Blueprint }
+func (v *GPGKeyStatus) SetBlueprint(s string)   { v.Blueprint = s }
+func (v *GPGKeyStatus) GetResourceKey() string  { return v.Keyring }
+func (v *GPGKeyStatus) SetResourceKey(s string) { v.Keyring = s }
+func (v *GPGKeyStatus) GetOS() string           { return v.OS }
+func (v *GPGKeyStatus) GetMachine() string      { return v.Machine }
+func (v *GPGKeyStatus) SetMachine(s string)     { v.Machine = s }
+func (v *GPGKeyStatus) GetAction() string       { return "gpg_key" }
+func (v *GPGKeyStatus) GetAppliedAt() string    { return v.AddedAt }
+func (v *GPGKeyStatus) GetVerifiedAt() string   { return v.VerifiedAt }
+func (v *GPGKeyStatus) SetVerifiedAt(s string)  { v.VerifiedAt = s }
+
+func (v *RepoStatus) GetBlueprint() string    { return v.Blueprint }
+func (v *RepoStatus) SetBlueprint(s string)   { v.Blueprint = s }
+func (v *RepoStatus) GetResourceKey() string  { return v.Name }
+func (v *RepoStatus) SetResourceKey(s string) { v.Name = s }
+func (v *RepoStatus) GetOS() string           { return v.OS }
+func (v *RepoStatus) GetMachine() string      { return v.Machine }
+func (v *RepoStatus) SetMachine(s string)     { v.Machine = s }
+func (v *RepoStatus) GetAction() string       { return "repo" }
+func (v *RepoStatus) GetAppliedAt() string    { return v.AddedAt }
+func (v *RepoStatus) GetVerifiedAt() string   { return v.VerifiedAt }
+func (v *RepoStatus) SetVerifiedAt(s string)  { v.VerifiedAt = s }
+
+func (v *AsdfStatus) GetBlueprint() string    { return v.Blueprint }
+func (v *AsdfStatus) SetBlueprint(s string)   { v.Blueprint = s }
+func (v *AsdfStatus) GetResourceKey() string  { return v.Plugin + "\x00" + v.Version }
+func (v *AsdfStatus) SetResourceKey(s string) { v.Plugin, v.Version, _ = strings.Cut(s, "\x00") }
+func (v *AsdfStatus) GetOS() string           { return v.OS }
+func (v *AsdfStatus) GetMachine() string      { return v.Machine }
+func (v *AsdfStatus) SetMachine(s string)     { v.Machine = s }
+func (v *AsdfStatus) GetAction() string       { return "asdf" }
+func (v *AsdfStatus) GetAppliedAt() string    { return v.InstalledAt }
+func (v *AsdfStatus) GetVerifiedAt() string   { return v.VerifiedAt }
+func (v *AsdfStatus) SetVerifiedAt(s string)  { v.VerifiedAt = s }
+
+func (v *MiseStatus) GetBlueprint() string    { return v.Blueprint }
+func (v *MiseStatus) SetBlueprint(s string)   { v.Blueprint = s }
+func (v *MiseStatus) GetResourceKey() string  { return v.Tool + "\x00" + v.Version }
+func (v *MiseStatus) SetResourceKey(s string) { v.Tool, v.Version, _ = strings.Cut(s, "\x00") }
+func (v *MiseStatus) GetOS() string           { return v.OS }
+func (v *MiseStatus) GetMachine() string      { return v.Machine }
+func (v *MiseStatus) SetMachine(s string)     { v.Machine = s }
+func (v *MiseStatus) GetAction() string       { return "mise" }
+func (v *MiseStatus) GetAppliedAt() string    { return v.InstalledAt }
+func (v *MiseStatus) GetVerifiedAt() string   { return v.VerifiedAt }
+func (v *MiseStatus) SetVerifiedAt(s string)  { v.VerifiedAt = s }
+
+func (v *SudoersStatus) GetBlueprint() string    { return v.Blueprint }
+func (v *SudoersStatus) SetBlueprint(s string)   { v.Blueprint = s }
+func (v *SudoersStatus) GetResourceKey() string  { return v.User }
+func (v *SudoersStatus) SetResourceKey(s string) { v.User = s }
+func (v *SudoersStatus) GetOS() string           { return v.OS }
+func (v *SudoersStatus) GetMachine() string      { return v.Machine }
+func (v *SudoersStatus) SetMachine(s string)     { v.Machine = s }
+func (v *SudoersStatus) GetAction() string       { return "sudoers" }
+func (v *SudoersStatus) GetAppliedAt() string    { return v.AddedAt }
+func (v *SudoersStatus) GetVerifiedAt() string   { return v.VerifiedAt }
+func (v *SudoersStatus) SetVerifiedAt(s string)  { v.VerifiedAt = s }
+
+func (v *HomebrewStatus) GetBlueprint() string    { return v.Blueprint }
+func (v *HomebrewStatus) SetBlueprint(s string)   { v.Blueprint = s }
+func (v *HomebrewStatus) GetResourceKey() string  { return v.Formula }
+func (v *HomebrewStatus) SetResourceKey(s string) { v.Formula = s }
+func (v *HomebrewStatus) GetOS() string           { return v.OS }
+func (v *HomebrewStatus) GetMachine() string      { return v.Machine }
+func (v *HomebrewStatus) SetMachine(s string)     { v.Machine = s }
+func (v *HomebrewStatus) GetAction() string       { return "homebrew" }
+func (v *HomebrewStatus) GetAppliedAt() string    { return v.InstalledAt }
+func (v *HomebrewStatus) GetVerifiedAt() string   { return v.VerifiedAt }
+func (v *HomebrewStatus) SetVerifiedAt(s string)  { v.VerifiedAt = s }
+
+func (v *OllamaStatus) GetBlueprint() string    { return v.Blueprint }
+func (v *OllamaStatus) SetBlueprint(s string)   { v.Blueprint = s }
+func (v *OllamaStatus) GetResourceKey() string  { return v.Model }
+func (v *OllamaStatus) SetResourceKey(s string) { v.Model = s }
+func (v *OllamaStatus) GetOS() string           { return v.OS }
+func (v *OllamaStatus) GetMachine() string      { return v.Machine }
+func (v *OllamaStatus) SetMachine(s string)     { v.Machine = s }
+func (v *OllamaStatus) GetAction() string       { return "ollama" }
+func (v *OllamaStatus) GetAppliedAt() string    { return v.InstalledAt }
+func (v *OllamaStatus) GetVerifiedAt() string   { return v.VerifiedAt }
+func (v *OllamaStatus) SetVerifiedAt(s string)  { v.VerifiedAt = s }
+
+func (v *MasStatus) GetBlueprint() string    { return v.Blueprint }
+func (v *MasStatus) SetBlueprint(s string)   { v.Blueprint = s }
+func (v *MasStatus) GetResourceKey() string  { return v.App }
+func (v *MasStatus) SetResourceKey(s string) { v.App = s }
+func (v *MasStatus) GetOS() string           { return v.OS }
+func (v *MasStatus) GetMachine() string      { return v.Machine }
+func (v *MasStatus) SetMachine(s string)     { v.Machine = s }
+func (v *MasStatus) GetAction() string       { return "mas" }
+func (v *MasStatus) GetAppliedAt() string    { return v.InstalledAt }
+func (v *MasStatus) GetVerifiedAt() string   { return v.VerifiedAt }
+func (v *MasStatus) SetVerifiedAt(s string)  { v.VerifiedAt = s }
+
+func (v *DevcertStatus) GetBlueprint() string    { return v.Blueprint }
+func (v *DevcertStatus) SetBlueprint(s string)   { v.Blueprint = s }
+func (v *DevcertStatus) GetResourceKey() string  { return v.Name }
+func (v *DevcertStatus) SetResourceKey(s string) { v.Name = s }
+func (v *DevcertStatus) GetOS() string           { return v.OS }
+func (v *DevcertStatus) GetMachine() string      { return v.Machine }
+func (v *DevcertStatus) SetMachine(s string)     { v.Machine = s }
+func (v *DevcertStatus) GetAction() string       { return "devcert" }
+func (v *DevcertStatus) GetAppliedAt() string    { return v.InstalledAt }
+func (v *DevcertStatus) GetVerifiedAt() string   { return v.VerifiedAt }
+func (v *DevcertStatus) SetVerifiedAt(s string)  { v.VerifiedAt = s }
+
+func (v *PPAStatus) GetBlueprint() string    { return v.Blueprint }
+func (v *PPAStatus) SetBlueprint(s string)   { v.Blueprint = s }
+func (v *PPAStatus) GetResourceKey() string  { return v.PPA }
+func (v *PPAStatus) SetResourceKey(s string) { v.PPA = s }
+func (v *PPAStatus) GetOS() string           { return v.OS }
+func (v *PPAStatus) GetMachine() string      { return v.Machine }
+func (v *PPAStatus) SetMachine(s string)     { v.Machine = s }
+func (v *PPAStatus) GetAction() string       { return "ppa" }
+func (v *PPAStatus) GetAppliedAt() string    { return v.AddedAt }
+func (v *PPAStatus) GetVerifiedAt() string   { return v.VerifiedAt }
+func (v *PPAStatus) SetVerifiedAt(s string)  { v.VerifiedAt = s }
+
+func (v *ServiceStatus) GetBlueprint() string    { return v.Blueprint }
+func (v *ServiceStatus) SetBlueprint(s string)   { v.Blueprint = s }
+func (v *ServiceStatus) GetResourceKey() string  { return v.Name }
+func (v *ServiceStatus) SetResourceKey(s string) { v.Name = s }
+func (v *ServiceStatus) GetOS() string           { return v.OS }
+func (v *ServiceStatus) GetMachine() string      { return v.Machine }
+func (v *ServiceStatus) SetMachine(s string)     { v.Machine = s }
+func (v *ServiceStatus) GetAction() string       { return "service" }
+func (v *ServiceStatus) GetAppliedAt() string    { return v.InstalledAt }
+func (v *ServiceStatus) GetVerifiedAt() string   { return v.VerifiedAt }
+func (v *ServiceStatus) SetVerifiedAt(s string)  { v.VerifiedAt = s }
+
+func (v *DockerImageStatus) GetBlueprint() string    { return v.Blueprint }
+func (v *DockerImageStatus) SetBlueprint(s string)   { v.Blueprint = s }
+func (v *DockerImageStatus) GetResourceKey() string  { return v.Image }
+func (v *DockerImageStatus) SetResourceKey(s string) { v.Image = s }
+func (v *DockerImageStatus) GetOS() string           { return v.OS }
+func (v *DockerImageStatus) GetMachine() string      { return v.Machine }
+func (v *DockerImageStatus) SetMachine(s string)     { v.Machine = s }
+func (v *DockerImageStatus) GetAction() string       { return "docker" }
+func (v *DockerImageStatus) GetAppliedAt() string    { return v.PulledAt }
+func (v *DockerImageStatus) GetVerifiedAt() string   { return v.VerifiedAt }
+func (v *DockerImageStatus) SetVerifiedAt(s string)  { v.VerifiedAt = s }
+
+func (v *AutostartStatus) GetBlueprint() string    { return v.Blueprint }
+func (v *AutostartStatus) SetBlueprint(s string)   { v.Blueprint = s }
+func (v *AutostartStatus) GetResourceKey() string  { return v.Name }
+func (v *AutostartStatus) SetResourceKey(s string) { v.Name = s }
+func (v *AutostartStatus) GetOS() string           { return v.OS }
+func (v *AutostartStatus) GetMachine() string      { return v.Machine }
+func (v *AutostartStatus) SetMachine(s string)     { v.Machine = s }
+func (v *AutostartStatus) GetAction() string       { return "autostart" }
+func (v *AutostartStatus) GetAppliedAt() string    { return v.InstalledAt }
+func (v *AutostartStatus) GetVerifiedAt() string   { return v.VerifiedAt }
+func (v *AutostartStatus) SetVerifiedAt(s string)  { v.VerifiedAt = s }
+
+func (v *DownloadStatus) GetBlueprint() string    { return v.Blueprint }
+func (v *DownloadStatus) SetBlueprint(s string)   { v.Blueprint = s }
+func (v *DownloadStatus) GetResourceKey() string  { return v.Path }
+func (v *DownloadStatus) SetResourceKey(s string) { v.Path = s }
+func (v *DownloadStatus) GetOS() string           { return v.OS }
+func (v *DownloadStatus) GetMachine() string      { return v.Machine }
+func (v *DownloadStatus) SetMachine(s string)     { v.Machine = s }
+func (v *DownloadStatus) GetAction() string       { return "download" }
+func (v *DownloadStatus) GetAppliedAt() string    { return v.DownloadedAt }
+func (v *DownloadStatus) GetVerifiedAt() string   { return v.VerifiedAt }
+func (v *DownloadStatus) SetVerifiedAt(s string)  { v.VerifiedAt = s }
+
+func (v *RunStatus) GetBlueprint() string    { return v.Blueprint }
+func (v *RunStatus) SetBlueprint(s string)   { v.Blueprint = s }
+func (v *RunStatus) GetResourceKey() string  { return v.Command }
+func (v *RunStatus) SetResourceKey(s string) { v.Command = s }
+func (v *RunStatus) GetOS() string           { return v.OS }
+func (v *RunStatus) GetMachine() string      { return v.Machine }
+func (v *RunStatus) SetMachine(s string)     { v.Machine = s }
+func (v *RunStatus) GetAction() string       { return v.Action }
+func (v *RunStatus) GetAppliedAt() string    { return v.RanAt }
+func (v *RunStatus) GetVerifiedAt() string   { return v.VerifiedAt }
+func (v *RunStatus) SetVerifiedAt(s string)  { v.VerifiedAt = s }
+
+func (v *DotfilesStatus) GetBlueprint() string    { return v.Blueprint }
+func (v *DotfilesStatus) SetBlueprint(s string)   { v.Blueprint = s }
+func (v *DotfilesStatus) GetResourceKey() string  { return v.URL }
+func (v *DotfilesStatus) SetResourceKey(s string) { v.URL = s }
+func (v *DotfilesStatus) GetOS() string           { return v.OS }
+func (v *DotfilesStatus) GetMachine() string      { return v.Machine }
+func (v *DotfilesStatus) SetMachine(s string)     { v.Machine = s }
+func (v *DotfilesStatus) GetAction() string       { return "dotfiles" }
+func (v *DotfilesStatus) GetAppliedAt() string    { return v.ClonedAt }
+func (v *DotfilesStatus) GetVerifiedAt() string   { return v.VerifiedAt }
+func (v *DotfilesStatus) SetVerifiedAt(s string)  { v.VerifiedAt = s }
+
+func (v *ScheduleStatus) GetBlueprint() string    { return v.Blueprint }
+func (v *ScheduleStatus) SetBlueprint(s string)   { v.Blueprint = s }
+func (v *ScheduleStatus) GetResourceKey() string  { return v.Source }
+func (v *ScheduleStatus) SetResourceKey(s string) { v.Source = s }
+func (v *ScheduleStatus) GetOS() string           { return v.OS }
+func (v *ScheduleStatus) GetMachine() string      { return v.Machine }
+func (v *ScheduleStatus) SetMachine(s string)     { v.Machine = s }
+func (v *ScheduleStatus) GetAction() string       { return "schedule" }
+func (v *ScheduleStatus) GetAppliedAt() string    { return v.InstalledAt }
+func (v *ScheduleStatus) GetVerifiedAt() string   { return v.VerifiedAt }
+func (v *ScheduleStatus) SetVerifiedAt(s string)  { v.VerifiedAt = s }
+
+func (v *StateBackupStatus) GetBlueprint() string    { return v.Blueprint }
+func (v *StateBackupStatus) SetBlueprint(s string)   { v.Blueprint = s }
+func (v *StateBackupStatus) GetResourceKey() string  { return v.To }
+func (v *StateBackupStatus) SetResourceKey(s string) { v.To = s }
+func (v *StateBackupStatus) GetOS() string           { return v.OS }
+func (v *StateBackupStatus) GetMachine() string      { return v.Machine }
+func (v *StateBackupStatus) SetMachine(s string)     { v.Machine = s }
+func (v *StateBackupStatus) GetAction() string       { return "state-backup" }
+func (v *StateBackupStatus) GetAppliedAt() string    { return v.InstalledAt }
+func (v *StateBackupStatus) GetVerifiedAt() string   { return v.VerifiedAt }
+func (v *StateBackupStatus) SetVerifiedAt(s string)  { v.VerifiedAt = s }
+
+func (v *AuthorizedKeysStatus) GetBlueprint() string    { return v.Blueprint }
+func (v *AuthorizedKeysStatus) SetBlueprint(s string)   { v.Blueprint = s }
+func (v *AuthorizedKeysStatus) GetResourceKey() string  { return v.Source }
+func (v *AuthorizedKeysStatus) SetResourceKey(s string) { v.Source = s }
+func (v *AuthorizedKeysStatus) GetOS() string           { return v.OS }
+func (v *AuthorizedKeysStatus) GetMachine() string      { return v.Machine }
+func (v *AuthorizedKeysStatus) SetMachine(s string)     { v.Machine = s }
+func (v *AuthorizedKeysStatus) GetAction() string       { return "authorized_keys" }
+func (v *AuthorizedKeysStatus) GetAppliedAt() string    { return v.AddedAt }
+func (v *AuthorizedKeysStatus) GetVerifiedAt() string   { return v.VerifiedAt }
+func (v *AuthorizedKeysStatus) SetVerifiedAt(s string)  { v.VerifiedAt = s }
+
+func (v *ShellStatus) GetBlueprint() string    { return v.Blueprint }
+func (v *ShellStatus) SetBlueprint(s string)   { v.Blueprint = s }
+func (v *ShellStatus) GetResourceKey() string  { return v.User }
+func (v *ShellStatus) SetResourceKey(s string) { v.User = s }
+func (v *ShellStatus) GetOS() string           { return v.OS }
+func (v *ShellStatus) GetMachine() string      { return v.Machine }
+func (v *ShellStatus) SetMachine(s string)     { v.Machine = s }
+func (v *ShellStatus) GetAction() string       { return "shell" }
+func (v *ShellStatus) GetAppliedAt() string    { return v.ChangedAt }
+func (v *ShellStatus) GetVerifiedAt() string   { return v.VerifiedAt }
+func (v *ShellStatus) SetVerifiedAt(s string)  { v.VerifiedAt = s }
+
+// PendingRemoval tracks a resource that is missing from its blueprint but is
+// kept installed until the cleanup grace period has passed.
+type PendingRemoval struct {
+	Action       string `json:"action"`
+	Resource     string `json:"resource"`
+	Blueprint    string `json:"blueprint"`
+	OS           string `json:"os"`
+	Machine      string `json:"machine,omitempty"` // machine the entry was recorded on, see OnMachine
+	MissingSince string `json:"missing_since"`     // first apply that found it missing (RFC 3339)
+	Applies      int    `json:"applies"`           // consecutive applies that found it missing
+}
 
 // Status represents the current blueprint state
 type Status struct {
+	SchemaVersion  int                    `json:"schema_version"`          // layout version, see StatusSchemaVersion
 	BlueprintSHA   string                 `json:"blueprint_sha,omitempty"` // git SHA of the blueprint repo at last apply
 	Packages       []PackageStatus        `json:"packages"`
 	Clones         []CloneStatus          `json:"clones"`
@@ -304,17 +661,31 @@ type Status struct {
 	Mkdirs         []MkdirStatus          `json:"mkdirs"`
 	KnownHosts     []KnownHostsStatus     `json:"known_hosts"`
 	GPGKeys        []GPGKeyStatus         `json:"gpg_keys"`
+	Repos          []RepoStatus           `json:"repos"`
 	Asdfs          []AsdfStatus           `json:"asdfs"`
 	Mises          []MiseStatus           `json:"mises"`
 	Sudoers        []SudoersStatus        `json:"sudoers"`
 	Brews          []HomebrewStatus       `json:"brews"`
 	Ollamas        []OllamaStatus         `json:"ollamas"`
+	MasApps        []MasStatus            `json:"mas_apps,omitempty"`
+	Devcerts       []DevcertStatus        `json:"devcerts,omitempty"`
+	PPAs           []PPAStatus            `json:"ppas,omitempty"`
+	Services       []ServiceStatus        `json:"services,omitempty"`
+	DockerImages   []DockerImageStatus    `json:"docker_images,omitempty"`
+	Autostarts     []AutostartStatus      `json:"autostarts,omitempty"`
+	RCFiles        []RCFileStatus         `json:"rc_files,omitempty"`
 	Downloads      []DownloadStatus       `json:"downloads"`
 	Runs           []RunStatus            `json:"runs"`
 	Dotfiles       []DotfilesStatus       `json:"dotfiles"`
 	Schedules      []ScheduleStatus       `json:"schedules"`
+	StateBackups   []StateBackupStatus    `json:"state_backups,omitempty"`
 	Shells         []ShellStatus          `json:"shells"`
 	AuthorizedKeys []AuthorizedKeysStatus `json:"authorized_keys"`
+
+	// PendingRemovals are resources held back from auto-uninstall by the
+	// cleanup grace period. They are not status entries of their own: each
+	// one refers to an entry above.
+	PendingRemovals []PendingRemoval `json:"pending_removals,omitempty"`
 }
 
 // AllEntries returns all status entries across every typed slice as a flat
@@ -340,6 +711,9 @@ func (s *Status) AllEntries() []StatusEntry {
 	for i := range s.GPGKeys {
 		entries = append(entries, &s.GPGKeys[i])
 	}
+	for i := range s.Repos {
+		entries = append(entries, &s.Repos[i])
+	}
 	for i := range s.Asdfs {
 		entries = append(entries, &s.Asdfs[i])
 	}
@@ -355,6 +729,24 @@ func (s *Status) AllEntries() []StatusEntry {
 	for i := range s.Ollamas {
 		entries = append(entries, &s.Ollamas[i])
 	}
+	for i := range s.MasApps {
+		entries = append(entries, &s.MasApps[i])
+	}
+	for i := range s.Devcerts {
+		entries = append(entries, &s.Devcerts[i])
+	}
+	for i := range s.PPAs {
+		entries = append(entries, &s.PPAs[i])
+	}
+	for i := range s.Services {
+		entries = append(entries, &s.Services[i])
+	}
+	for i := range s.DockerImages {
+		entries = append(entries, &s.DockerImages[i])
+	}
+	for i := range s.Autostarts {
+		entries = append(entries, &s.Autostarts[i])
+	}
 	for i := range s.Downloads {
 		entries = append(entries, &s.Downloads[i])
 	}
@@ -367,6 +759,9 @@ func (s *Status) AllEntries() []StatusEntry {
 	for i := range s.Schedules {
 		entries = append(entries, &s.Schedules[i])
 	}
+	for i := range s.StateBackups {
+		entries = append(entries, &s.StateBackups[i])
+	}
 	for i := range s.Shells {
 		entries = append(entries, &s.Shells[i])
 	}
@@ -401,6 +796,11 @@ type Handler interface {
 	// IsInstalled returns true if every resource managed by this rule already has
 	// a matching entry in status for the given blueprint file and OS.
 	IsInstalled(status *Status, blueprintFile, osName string) bool
+
+	// IsSatisfied checks the system itself, not status, for whether the
+	// rule's desired state already holds, so apply can skip running Up.
+	// Handlers that cannot tell return false and Up runs as before.
+	IsSatisfied() (bool, error)
 }
 
 // RecordAware is an optional interface that handlers can implement to receive
@@ -409,6 +809,15 @@ type RecordAware interface {
 	SetCurrentRecords(records []ExecutionRecord)
 }
 
+// FollowUpProvider is an optional interface for handlers whose rule, once in
+// place, describes more rules to apply: a clone rule with apply: returns the
+// rules of the blueprint inside the repository it cloned. The engine calls it
+// after Up() succeeds or finds the rule already satisfied, checks the rules
+// and appends them to the run. An error fails the rule.
+type FollowUpProvider interface {
+	FollowUpRules() ([]parser.Rule, error)
+}
+
 // SudoAwareHandler is an optional interface that handlers can implement
 // to specify their own sudo requirements. If a handler implements this,
 // the engine will use this method instead of the global needsSudo function.
@@ -418,6 +827,44 @@ type SudoAwareHandler interface {
 	NeedsSudo() bool
 }
 
+// ConcurrencyClassProvider is an optional interface for handlers whose rules
+// contend for a lock shared across the system, such as apt's dpkg lock or
+// Homebrew's. Rules in the same wave that report the same class are run one
+// after another in wave order; rules of different classes, and rules of
+// handlers that do not implement it, still run concurrently.
+type ConcurrencyClassProvider interface {
+	// ConcurrencyClass returns the name of the lock this rule takes, e.g.
+	// "apt" or "brew", or "" when it can run alongside anything.
+	ConcurrencyClass() string
+}
+
+// ConcurrencyClass returns the concurrency class of handler, or "" when the
+// handler does not declare one.
+func ConcurrencyClass(handler Handler) string {
+	if cp, ok := handler.(ConcurrencyClassProvider); ok {
+		return cp.ConcurrencyClass()
+	}
+	return ""
+}
+
+// Stager is an optional interface for handlers whose Up() only writes files.
+// Only their rules may join a transaction: group, whose writes are staged and
+// moved into place once every rule in the group has succeeded.
+type Stager interface {
+	// Staged returns a handler whose Up() writes to stage(dest) instead of each
+	// destination path it would write, with ~ already expanded in dest. The
+	// handler itself may be returned when Up() would not write anything.
+	Staged(stage func(dest string) (string, error)) (Handler, error)
+}
+
+// Reverser is an optional interface for handlers whose Down() cannot always
+// undo what Up() did. Rollback skips their rules with a warning instead of
+// reporting an undo that did nothing.
+type Reverser interface {
+	// Irreversible returns why Down() cannot undo the rule, or "" when it can.
+	Irreversible() string
+}
+
 // KeyProvider is an optional interface that handlers can implement
 // to specify how they should be identified in dependency resolution.
 // If a handler implements this, the engine will use GetDependencyKey()
@@ -502,6 +949,36 @@ func RuleKey(rule parser.Rule) string {
 	return rule.Action
 }
 
+// RuleAddress returns the automatic address of a rule: its action and resource
+// key, such as install.curl or clone.~/src/repo, so a rule without an id: can
+// still be named on the command line. A rule whose action has no resource key
+// is addressed by its action alone.
+func RuleAddress(rule parser.Rule) string {
+	key := rule.Action
+	if def := GetAction(rule.Action); def != nil && def.RuleKey != nil {
+		key = strings.TrimPrefix(def.RuleKey(rule), rule.Action+":")
+	}
+	if key == "" || key == rule.Action {
+		return rule.Action
+	}
+	return rule.Action + "." + key
+}
+
+// SetRuleAddresses sets the Address of every rule to its RuleAddress. When
+// several rules share an address, the second and later ones in file order
+// get "#2", "#3" and so on, so each address names one rule.
+func SetRuleAddresses(rules []parser.Rule) {
+	seen := make(map[string]int, len(rules))
+	for i := range rules {
+		addr := RuleAddress(rules[i])
+		seen[addr]++
+		if n := seen[addr]; n > 1 {
+			addr = fmt.Sprintf("%s#%d", addr, n)
+		}
+		rules[i].Address = addr
+	}
+}
+
 // GetFallbackDependencyKey returns the handler-specific fallback key when rule.ID is not present.
 // Handlers can override this method to provide their own key logic.
 // Default implementation returns the action name as fallback.
@@ -509,6 +986,12 @@ func (h *BaseHandler) GetFallbackDependencyKey() string {
 	return h.Rule.Action
 }
 
+// IsSatisfied is the default for handlers that cannot check the system:
+// it reports false so the rule always runs.
+func (h *BaseHandler) IsSatisfied() (bool, error) {
+	return false, nil
+}
+
 // DetectRuleType determines the actual rule type based on the rule's content.
 // This is used for "uninstall" actions where the original action is lost.
 func DetectRuleType(rule parser.Rule) string {
@@ -558,13 +1041,15 @@ func GetStatusProviderHandlers() []Handler {
 
 // Shared utility functions for status management
 
-// normalizePath normalizes a file path to an absolute path for consistent comparison
+// normalizePath normalizes a file path to an absolute path for consistent
+// comparison. On Windows the result is lowercased with backslashes only, as
+// the filesystem ignores case.
 func normalizePath(filePath string) string {
 	absPath, err := filepath.Abs(filePath)
 	if err != nil {
-		return filepath.Clean(filePath)
+		return internal.PathKey(filePath)
 	}
-	return filepath.Clean(absPath)
+	return internal.PathKey(absPath)
 }
 
 // NormalizeBlueprint is the exported form of normalizeBlueprint, exposed so
@@ -635,29 +1120,96 @@ func (s *Status) FilterEntries(keep func(StatusEntry) bool) {
 	s.Mkdirs = filterSlice[MkdirStatus, *MkdirStatus](s.Mkdirs, keep)
 	s.KnownHosts = filterSlice[KnownHostsStatus, *KnownHostsStatus](s.KnownHosts, keep)
 	s.GPGKeys = filterSlice[GPGKeyStatus, *GPGKeyStatus](s.GPGKeys, keep)
+	s.Repos = filterSlice[RepoStatus, *RepoStatus](s.Repos, keep)
 	s.Asdfs = filterSlice[AsdfStatus, *AsdfStatus](s.Asdfs, keep)
 	s.Mises = filterSlice[MiseStatus, *MiseStatus](s.Mises, keep)
 	s.Sudoers = filterSlice[SudoersStatus, *SudoersStatus](s.Sudoers, keep)
 	s.Brews = filterSlice[HomebrewStatus, *HomebrewStatus](s.Brews, keep)
 	s.Ollamas = filterSlice[OllamaStatus, *OllamaStatus](s.Ollamas, keep)
+	s.MasApps = filterSlice[MasStatus, *MasStatus](s.MasApps, keep)
+	s.Devcerts = filterSlice[DevcertStatus, *DevcertStatus](s.Devcerts, keep)
+	s.PPAs = filterSlice[PPAStatus, *PPAStatus](s.PPAs, keep)
+	s.Services = filterSlice[ServiceStatus, *ServiceStatus](s.Services, keep)
+	s.DockerImages = filterSlice[DockerImageStatus, *DockerImageStatus](s.DockerImages, keep)
+	s.Autostarts = filterSlice[AutostartStatus, *AutostartStatus](s.Autostarts, keep)
 	s.Downloads = filterSlice[DownloadStatus, *DownloadStatus](s.Downloads, keep)
 	s.Runs = filterSlice[RunStatus, *RunStatus](s.Runs, keep)
 	s.Dotfiles = filterSlice[DotfilesStatus, *DotfilesStatus](s.Dotfiles, keep)
 	s.Schedules = filterSlice[ScheduleStatus, *ScheduleStatus](s.Schedules, keep)
+	s.StateBackups = filterSlice[StateBackupStatus, *StateBackupStatus](s.StateBackups, keep)
 	s.Shells = filterSlice[ShellStatus, *ShellStatus](s.Shells, keep)
 	s.AuthorizedKeys = filterSlice[AuthorizedKeysStatus, *AuthorizedKeysStatus](s.AuthorizedKeys, keep)
 }
 
+// AppendEntries appends the entries of every status slice of other to s.
+func (s *Status) AppendEntries(other Status) {
+	s.Packages = append(s.Packages, other.Packages...)
+	s.Clones = append(s.Clones, other.Clones...)
+	s.Decrypts = append(s.Decrypts, other.Decrypts...)
+	s.Mkdirs = append(s.Mkdirs, other.Mkdirs...)
+	s.KnownHosts = append(s.KnownHosts, other.KnownHosts...)
+	s.GPGKeys = append(s.GPGKeys, other.GPGKeys...)
+	s.Repos = append(s.Repos, other.Repos...)
+	s.Asdfs = append(s.Asdfs, other.Asdfs...)
+	s.Mises = append(s.Mises, other.Mises...)
+	s.Sudoers = append(s.Sudoers, other.Sudoers...)
+	s.Brews = append(s.Brews, other.Brews...)
+	s.Ollamas = append(s.Ollamas, other.Ollamas...)
+	s.MasApps = append(s.MasApps, other.MasApps...)
+	s.Devcerts = append(s.Devcerts, other.Devcerts...)
+	s.PPAs = append(s.PPAs, other.PPAs...)
+	s.Services = append(s.Services, other.Services...)
+	s.DockerImages = append(s.DockerImages, other.DockerImages...)
+	s.Autostarts = append(s.Autostarts, other.Autostarts...)
+	s.Downloads = append(s.Downloads, other.Downloads...)
+	s.Runs = append(s.Runs, other.Runs...)
+	s.Dotfiles = append(s.Dotfiles, other.Dotfiles...)
+	s.Schedules = append(s.Schedules, other.Schedules...)
+	s.StateBackups = append(s.StateBackups, other.StateBackups...)
+	s.Shells = append(s.Shells, other.Shells...)
+	s.AuthorizedKeys = append(s.AuthorizedKeys, other.AuthorizedKeys...)
+}
+
+// OnMachine reports whether e was recorded on machine. Entries written
+// before machines were recorded belong to every machine, until an apply on
+// one of them records them again.
+func OnMachine(e StatusEntry, machine string) bool {
+	return e.GetMachine() == "" || e.GetMachine() == machine
+}
+
+// SplitByMachine returns the entries of s recorded on machine (see
+// OnMachine) and those of other machines, so that an apply on one of the
+// machines sharing a home directory neither sees nor changes what the others
+// installed. mine keeps the fields of s that are not entries.
+func (s Status) SplitByMachine(machine string) (mine, others Status) {
+	mine, others = s, s
+	mine.FilterEntries(func(e StatusEntry) bool { return OnMachine(e, machine) })
+	others.FilterEntries(func(e StatusEntry) bool { return !OnMachine(e, machine) })
+	return mine, others
+}
+
+// StampMachine records machine on the entries of blueprint on osName that
+// have none: the ones an apply on it has just written, and older ones it
+// now takes over.
+func StampMachine(s *Status, blueprint, osName, machine string) {
+	blueprint = normalizeBlueprint(blueprint)
+	for _, e := range s.AllEntries() {
+		if e.GetMachine() == "" && e.GetOS() == osName && normalizeBlueprint(e.GetBlueprint()) == blueprint {
+			e.SetMachine(machine)
+		}
+	}
+}
+
 // DeduplicateStatus removes duplicate entries from each status slice.
 // An entry is a duplicate when two records have the same resource key, OS, and
 // blueprint after normalization — this happens when the same blueprint was applied
 // twice using different URL forms (e.g. "https:/host/repo.git" and "https://host/repo").
 // The last occurrence (most recent apply) is kept; earlier duplicates are removed.
 func DeduplicateStatus(s *Status) {
-	// Build a set of pointers for the last occurrence of each (resource, os, blueprint) key.
+	// Build a set of pointers for the last occurrence of each (resource, os, machine, blueprint) key.
 	lastSeen := map[string]StatusEntry{}
 	for _, e := range s.AllEntries() {
-		key := e.GetResourceKey() + "\x00" + e.GetOS() + "\x00" + normalizeBlueprint(e.GetBlueprint())
+		key := e.GetResourceKey() + "\x00" + e.GetOS() + "\x00" + e.GetMachine() + "\x00" + normalizeBlueprint(e.GetBlueprint())
 		lastSeen[key] = e
 	}
 	keepSet := map[StatusEntry]bool{}
@@ -667,6 +1219,73 @@ func DeduplicateStatus(s *Status) {
 	s.FilterEntries(func(e StatusEntry) bool { return keepSet[e] })
 }
 
+// MigrateAliases rewrites status entries recorded under a rule's old identity
+// (listed in its aliases:) to the rule's current identity, so that renaming a
+// resource does not show up as "removed + added" and trigger an uninstall
+// followed by a reinstall of the same thing.
+//
+// Aliases are paired, in order, with the rule's resources that have no status
+// entry yet for this blueprint and OS. An alias that still names a resource of
+// some current rule is ignored. Returns the number of entries migrated.
+func MigrateAliases(s *Status, rules []parser.Rule, blueprint, osName string) int {
+	normalizedBlueprint := normalizeBlueprint(blueprint)
+
+	// Resource keys still claimed by the blueprint, per action.
+	current := map[string]map[string]bool{}
+	for _, rule := range rules {
+		def := GetAction(rule.Action)
+		if def == nil || def.OrphanIndex == nil {
+			continue
+		}
+		if current[rule.Action] == nil {
+			current[rule.Action] = map[string]bool{}
+		}
+		def.OrphanIndex(rule, func(key string) { current[rule.Action][key] = true })
+	}
+
+	migrated := 0
+	for _, rule := range rules {
+		if len(rule.Aliases) == 0 {
+			continue
+		}
+		def := GetAction(rule.Action)
+		if def == nil || def.OrphanIndex == nil || def.OrphanCheckExcluded {
+			continue
+		}
+
+		owned := map[string]StatusEntry{}
+		for _, e := range s.AllEntries() {
+			if e.GetAction() == rule.Action && e.GetOS() == osName &&
+				normalizeBlueprint(e.GetBlueprint()) == normalizedBlueprint {
+				owned[e.GetResourceKey()] = e
+			}
+		}
+
+		var targets []string
+		def.OrphanIndex(rule, func(key string) {
+			if key != "" && owned[key] == nil {
+				targets = append(targets, key)
+			}
+		})
+
+		for _, alias := range rule.Aliases {
+			if len(targets) == 0 {
+				break
+			}
+			e, ok := owned[alias]
+			if !ok || current[rule.Action][alias] {
+				continue
+			}
+			e.SetResourceKey(targets[0])
+			delete(owned, alias)
+			owned[targets[0]] = e
+			targets = targets[1:]
+			migrated++
+		}
+	}
+	return migrated
+}
+
 func commandSuccessfullyExecuted(cmd string, records []ExecutionRecord) (*ExecutionRecord, bool) {
 	var resultRecord *ExecutionRecord
 	commandExecuted := false
@@ -729,6 +1348,9 @@ func removeKnownHostsStatus(sl []KnownHostsStatus, key, bp, os string) []KnownHo
 func removeGPGKeyStatus(sl []GPGKeyStatus, key, bp, os string) []GPGKeyStatus {
 	return removeStatusEntry[GPGKeyStatus, *GPGKeyStatus](sl, key, bp, os)
 }
+func removeRepoStatus(sl []RepoStatus, key, bp, os string) []RepoStatus {
+	return removeStatusEntry[RepoStatus, *RepoStatus](sl, key, bp, os)
+}
 func removeRunStatus(sl []RunStatus, key, bp, os string) []RunStatus {
 	return removeStatusEntry[RunStatus, *RunStatus](sl, key, bp, os)
 }
@@ -741,16 +1363,20 @@ func removeDownloadStatus(sl []DownloadStatus, key, bp, os string) []DownloadSta
 func removeAuthorizedKeysStatus(sl []AuthorizedKeysStatus, key, bp, os string) []AuthorizedKeysStatus {
 	return removeStatusEntry[AuthorizedKeysStatus, *AuthorizedKeysStatus](sl, key, bp, os)
 }
+func removeStateBackupStatus(sl []StateBackupStatus, key, bp, os string) []StateBackupStatus {
+	return removeStatusEntry[StateBackupStatus, *StateBackupStatus](sl, key, bp, os)
+}
 func removeShellStatus(sl []ShellStatus, key, bp, os string) []ShellStatus {
 	return removeStatusEntry[ShellStatus, *ShellStatus](sl, key, bp, os)
 }
 
 // abbreviateBlueprintPath shortens blueprint paths for display
 // Shows relative paths for blueprints in the repo, full paths for external ones
+// with the home directory abbreviated to ~
 func abbreviateBlueprintPath(path string) string {
 	// Try to get the current working directory
 	cwd, err := os.Getwd()
-	if err == nil && strings.HasPrefix(path, cwd) {
+	if err == nil && internal.HasPathPrefix(path, cwd) {
 		// Path is within the repo, show relative path
 		relPath, err := filepath.Rel(cwd, path)
 		if err == nil {
@@ -758,5 +1384,5 @@ func abbreviateBlueprintPath(path string) string {
 		}
 	}
 	// Path is outside the repo or error getting cwd, show full path
-	return path
+	return ui.AbbreviateHome(path)
 }
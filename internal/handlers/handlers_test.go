@@ -1553,3 +1553,146 @@ func TestAllEntriesCoversAllSlices(t *testing.T) {
 			remaining)
 	}
 }
+
+func TestMigrateAliases(t *testing.T) {
+	bp := "/tmp/setup.bp"
+
+	t.Run("renamed package is migrated", func(t *testing.T) {
+		status := &Status{Packages: []PackageStatus{
+			{Name: "fd", Blueprint: bp, OS: "linux"},
+			{Name: "git", Blueprint: bp, OS: "linux"},
+		}}
+		rules := []parser.Rule{
+			{Action: "install", Packages: []parser.Package{{Name: "fd-find"}}, Aliases: []string{"fd"}},
+			{Action: "install", Packages: []parser.Package{{Name: "git"}}},
+		}
+		if n := MigrateAliases(status, rules, bp, "linux"); n != 1 {
+			t.Fatalf("MigrateAliases() = %d, want 1", n)
+		}
+		if status.Packages[0].Name != "fd-find" {
+			t.Errorf("Packages[0].Name = %q, want fd-find", status.Packages[0].Name)
+		}
+		if status.Packages[1].Name != "git" {
+			t.Errorf("Packages[1].Name = %q, want git (untouched)", status.Packages[1].Name)
+		}
+	})
+
+	t.Run("other blueprint or OS is untouched", func(t *testing.T) {
+		status := &Status{Mkdirs: []MkdirStatus{
+			{Path: "~/src", Blueprint: "/tmp/other.bp", OS: "linux"},
+			{Path: "~/src", Blueprint: bp, OS: "mac"},
+		}}
+		rules := []parser.Rule{{Action: "mkdir", Mkdir: "~/code", Aliases: []string{"~/src"}}}
+		if n := MigrateAliases(status, rules, bp, "linux"); n != 0 {
+			t.Errorf("MigrateAliases() = %d, want 0", n)
+		}
+	})
+
+	t.Run("alias still used by another rule is ignored", func(t *testing.T) {
+		status := &Status{Packages: []PackageStatus{{Name: "vim", Blueprint: bp, OS: "linux"}}}
+		rules := []parser.Rule{
+			{Action: "install", Packages: []parser.Package{{Name: "neovim"}}, Aliases: []string{"vim"}},
+			{Action: "install", Packages: []parser.Package{{Name: "vim"}}},
+		}
+		if n := MigrateAliases(status, rules, bp, "linux"); n != 0 {
+			t.Errorf("MigrateAliases() = %d, want 0", n)
+		}
+		if status.Packages[0].Name != "vim" {
+			t.Errorf("Packages[0].Name = %q, want vim", status.Packages[0].Name)
+		}
+	})
+
+	t.Run("already recorded target is not overwritten", func(t *testing.T) {
+		status := &Status{Clones: []CloneStatus{
+			{Path: "~/old", Blueprint: bp, OS: "linux"},
+			{Path: "~/new", Blueprint: bp, OS: "linux"},
+		}}
+		rules := []parser.Rule{{Action: "clone", ClonePath: "~/new", Aliases: []string{"~/old"}}}
+		if n := MigrateAliases(status, rules, bp, "linux"); n != 0 {
+			t.Errorf("MigrateAliases() = %d, want 0", n)
+		}
+	})
+}
+
+func TestConcurrencyClass(t *testing.T) {
+	tests := []struct {
+		manager, targetOS, want string
+	}{
+		{"", "linux", "apt"},
+		{"apt-get", "linux", "apt"},
+		{"", "mac", "brew"},
+		{"brew", "linux", "brew"},
+		{"snap", "linux", "snap"},
+	}
+	for _, tt := range tests {
+		if got := packageManagerClass(tt.manager, tt.targetOS); got != tt.want {
+			t.Errorf("packageManagerClass(%q, %q) = %q, want %q", tt.manager, tt.targetOS, got, tt.want)
+		}
+	}
+
+	if got := ConcurrencyClass(NewHomebrewHandler(parser.Rule{HomebrewPackages: []string{"git"}}, "")); got != "brew" {
+		t.Errorf("homebrew class = %q, want brew", got)
+	}
+	if got := ConcurrencyClass(NewRunHandler(parser.Rule{RunCommand: "true"}, "")); got != "" {
+		t.Errorf("run class = %q, want none", got)
+	}
+}
+
+func TestSetRuleAddresses(t *testing.T) {
+	rules := []parser.Rule{
+		{Action: "install", Packages: []parser.Package{{Name: "curl"}, {Name: "wget"}}},
+		{Action: "clone", CloneURL: "https://github.com/me/repo.git", ClonePath: "~/src/repo"},
+		{Action: "install", Packages: []parser.Package{{Name: "curl"}}, ID: "curl-again"},
+		{Action: "asdf", AsdfPackages: []string{"nodejs@20"}},
+		{Action: "var", VarName: "WORK"},
+		{Action: "install", Packages: []parser.Package{{Name: "curl"}}},
+	}
+	SetRuleAddresses(rules)
+
+	want := []string{"install.curl", "clone.~/src/repo", "install.curl#2", "asdf", "var.WORK", "install.curl#3"}
+	for i, rule := range rules {
+		if rule.Address != want[i] {
+			t.Errorf("rule %d address = %q, want %q", i, rule.Address, want[i])
+		}
+	}
+}
+
+func TestSplitByMachine(t *testing.T) {
+	bp := "/tmp/setup.bp"
+	status := Status{
+		Mkdirs: []MkdirStatus{
+			{Path: "/a", Blueprint: bp, OS: "linux", Machine: "laptop"},
+			{Path: "/b", Blueprint: bp, OS: "linux", Machine: "desktop"},
+			{Path: "/c", Blueprint: bp, OS: "linux"},
+			{Path: "/d", Blueprint: bp, OS: "mac"},
+		},
+		PendingRemovals: []PendingRemoval{{Machine: "desktop"}},
+	}
+
+	mine, others := status.SplitByMachine("laptop")
+	if len(mine.Mkdirs) != 3 || len(others.Mkdirs) != 1 || others.Mkdirs[0].Path != "/b" {
+		t.Fatalf("mine = %+v, others = %+v", mine.Mkdirs, others.Mkdirs)
+	}
+	if len(mine.PendingRemovals) != 1 {
+		t.Errorf("SplitByMachine() dropped the fields that are not entries")
+	}
+
+	StampMachine(&mine, bp, "linux", "laptop")
+	for _, m := range mine.Mkdirs {
+		want := "laptop"
+		if m.OS == "mac" {
+			want = ""
+		}
+		if m.Machine != want {
+			t.Errorf("%s recorded on %q, want %q", m.Path, m.Machine, want)
+		}
+	}
+
+	mine.AppendEntries(others)
+	if len(mine.Mkdirs) != 4 {
+		t.Errorf("AppendEntries() left %d entries, want 4", len(mine.Mkdirs))
+	}
+	if OnMachine(&others.Mkdirs[0], "laptop") || !OnMachine(&status.Mkdirs[2], "laptop") {
+		t.Error("OnMachine() should match the machine's and unrecorded entries only")
+	}
+}
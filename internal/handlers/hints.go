@@ -0,0 +1,55 @@
+package handlers
+
+import "regexp"
+
+// remediationHint maps a well-known failure signature to advice a user can
+// act on without knowing the underlying tool.
+type remediationHint struct {
+	pattern *regexp.Regexp
+	hint    string
+}
+
+// remediationHints is checked in order; the first matching signature wins.
+var remediationHints = []remediationHint{
+	{
+		pattern: regexp.MustCompile(`(?i)could not get lock /var/lib/(dpkg|apt)|unable to acquire the dpkg frontend lock|unable to lock the (administration|download) directory`),
+		hint:    "Another package manager (apt, unattended-upgrades or a software updater) holds the dpkg lock. Wait for it to finish, then re-run 'blueprint apply'.",
+	},
+	{
+		pattern: regexp.MustCompile(`(?i)dpkg was interrupted`),
+		hint:    "A previous package install was interrupted. Run 'sudo dpkg --configure -a', then re-run 'blueprint apply'.",
+	},
+	{
+		pattern: regexp.MustCompile(`(?i)is a shallow clone`),
+		hint:    "Homebrew's tap is a shallow clone. Run 'brew untap homebrew/core homebrew/cask' (brew then uses its JSON API) or 'git -C \"$(brew --repository homebrew/core)\" fetch --unshallow', then re-run 'blueprint apply'.",
+	},
+	{
+		pattern: regexp.MustCompile(`(?is)(ssh-keyscan|known_hosts).*(timed out|timeout|unknown error|no key returned)`),
+		hint:    "ssh-keyscan got no answer from the host. Check the hostname and that port 22 is reachable (e.g. 'nc -vz <host> 22'); some networks block outbound SSH. Where the host cannot be reached, add its key to the rule with pubkey:.",
+	},
+	{
+		pattern: regexp.MustCompile(`(?i)permission denied while trying to connect to the docker daemon`),
+		hint:    "Your user cannot reach the Docker daemon. Run 'sudo usermod -aG docker $USER', log out and back in, then re-run 'blueprint apply'.",
+	},
+	{
+		pattern: regexp.MustCompile(`(?i)cannot connect to the docker daemon`),
+		hint:    "The Docker daemon is not running. Start Docker Desktop (macOS) or run 'sudo systemctl start docker' (Linux), then re-run 'blueprint apply'.",
+	},
+	{
+		pattern: regexp.MustCompile(`(?is)(gpg|keyrings).*permission denied`),
+		hint:    "Writing the APT keyring needs root. Check that 'sudo -v' succeeds and that /etc/apt/keyrings is writable by root, then re-run 'blueprint apply'.",
+	},
+}
+
+// RemediationHint returns advice for a recognised failure, or "" when the
+// failure does not match any known signature. text should contain the error
+// message and any command output, since tools often explain the cause on
+// stdout/stderr rather than in the exit status.
+func RemediationHint(text string) string {
+	for _, h := range remediationHints {
+		if h.pattern.MatchString(text) {
+			return h.hint
+		}
+	}
+	return ""
+}
@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRemediationHint(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string // substring expected in the hint; "" means no hint
+	}{
+		{
+			name: "apt lock held",
+			text: "exit status 100\nE: Could not get lock /var/lib/dpkg/lock-frontend. It is held by process 1234 (unattended-upgr)",
+			want: "dpkg lock",
+		},
+		{
+			name: "apt frontend lock",
+			text: "E: Unable to acquire the dpkg frontend lock (/var/lib/dpkg/lock-frontend), is another process using it?",
+			want: "dpkg lock",
+		},
+		{
+			name: "dpkg interrupted",
+			text: "E: dpkg was interrupted, you must manually run 'sudo dpkg --configure -a' to correct the problem.",
+			want: "dpkg --configure -a",
+		},
+		{
+			name: "brew shallow clone",
+			text: "Error: homebrew-core is a shallow clone.",
+			want: "brew untap",
+		},
+		{
+			name: "docker socket permission",
+			text: "permission denied while trying to connect to the Docker daemon socket at unix:///var/run/docker.sock",
+			want: "usermod -aG docker",
+		},
+		{
+			name: "docker daemon down",
+			text: "Cannot connect to the Docker daemon at unix:///var/run/docker.sock. Is the docker daemon running?",
+			want: "daemon is not running",
+		},
+		{
+			name: "ssh-keyscan with no output",
+			text: "failed to add host to known_hosts - \nDetails:\nunknown error",
+			want: "port 22",
+		},
+		{
+			name: "ssh-keyscan on a filtered network",
+			text: "failed to add host to known_hosts: ssh-keyscan found no ed25519 key for git.internal (IPv4: no key returned; IPv6: timed out after 30s)",
+			want: "pubkey:",
+		},
+		{
+			name: "gpg dearmor permission denied",
+			text: "exit status 2\ngpg: can't create '/etc/apt/keyrings/docker.gpg': Permission denied",
+			want: "keyring needs root",
+		},
+		{
+			name: "unrecognised failure",
+			text: "command failed: exit status 1\nsomething else went wrong",
+			want: "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := RemediationHint(tt.text)
+			if tt.want == "" {
+				if got != "" {
+					t.Errorf("RemediationHint() = %q, want no hint", got)
+				}
+				return
+			}
+			if !strings.Contains(got, tt.want) {
+				t.Errorf("RemediationHint() = %q, want it to mention %q", got, tt.want)
+			}
+		})
+	}
+}
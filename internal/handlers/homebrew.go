@@ -7,16 +7,29 @@ import (
 	"path/filepath"
 	"strings"
 	"sync"
-	"time"
 
 	"github.com/elpic/blueprint/internal/parser"
 	"github.com/elpic/blueprint/internal/ui"
+	"github.com/elpic/blueprint/internal/ui/timeutil"
 )
 
 func init() {
 	RegisterAction(ActionDef{
 		Name:   "homebrew",
 		Prefix: "homebrew",
+		Meta: ActionMeta{
+			Summary: "Install Homebrew formulas and casks.",
+			Usage:   "homebrew <formula[@version]>... [cask: <cask>]",
+			Attrs: []AttrMeta{
+				{Name: "cask", Type: "string", Description: "Cask to install with brew install --cask"},
+			},
+			Examples: []string{
+				"homebrew jq ripgrep",
+				"homebrew cask: iterm2 on: [mac]",
+			},
+			OS:  []string{"mac", "linux"},
+			Doc: "homebrew.md",
+		},
 		NewHandler: func(rule parser.Rule, basePath string, passwordCache map[string]string) Handler {
 			return NewHomebrewHandler(rule, basePath)
 		},
@@ -40,6 +53,37 @@ func init() {
 				index(caskKey(cask))
 			}
 		},
+		Verify: func(e StatusEntry) bool {
+			brew := brewCmd()
+			if cask, ok := strings.CutPrefix(e.(*HomebrewStatus).Formula, "cask:"); ok {
+				return isBrewCaskInstalled(brew, cask)
+			}
+			name := formulaName(e.(*HomebrewStatus).Formula)
+			return isBrewFormulaInstalled(brew, name) || isBrewCaskInstalled(brew, name)
+		},
+		Refresh: func(entries []StatusEntry) []string {
+			formulas, casks, err := BrewInstalledVersions()
+			if err != nil {
+				return nil
+			}
+			var changes []string
+			for _, e := range entries {
+				b := e.(*HomebrewStatus)
+				v, ok := BrewVersion{}, false
+				if cask, isCask := strings.CutPrefix(b.Formula, "cask:"); isCask {
+					v, ok = casks[cask]
+				} else {
+					v, ok = formulas[formulaName(b.Formula)]
+				}
+				version := v.Installed
+				if !ok || version == b.Version {
+					continue
+				}
+				changes = append(changes, fmt.Sprintf("%s: %s → %s", b.Formula, versionOrNone(b.Version), version))
+				b.Version = version
+			}
+			return changes
+		},
 		ShellExport: func(rule parser.Rule, _, _ string) []string {
 			var lines []string
 			for _, f := range rule.HomebrewPackages {
@@ -174,30 +218,38 @@ func (h *HomebrewHandler) UpdateStatus(status *Status, records []ExecutionRecord
 			return nil // command failed or didn't run — don't update status
 		}
 
-		// Record each formula/cask as installed
+		// Record each formula/cask as installed, with the version brew
+		// reports; when brew cannot be asked the maps are nil
+		formulas, casks, _ := BrewInstalledVersions()
 		for _, formulaStr := range h.Rule.HomebrewPackages {
 			parts := strings.Split(formulaStr, "@")
 			formula := formulaName(parts[0])
 			version := "latest"
 			if len(parts) > 1 {
 				version = parts[1]
+			} else if v := formulas[formula].Installed; v != "" {
+				version = v
 			}
 			status.Brews = removeHomebrewStatus(status.Brews, formula, blueprint, osName)
 			status.Brews = append(status.Brews, HomebrewStatus{
 				Formula:     formula,
 				Version:     version,
-				InstalledAt: time.Now().Format(time.RFC3339),
+				InstalledAt: timeutil.Now(),
 				Blueprint:   blueprint,
 				OS:          osName,
 			})
 		}
 
 		for _, cask := range h.Rule.HomebrewCasks {
+			version := "cask"
+			if v := casks[cask].Installed; v != "" {
+				version = v
+			}
 			status.Brews = removeHomebrewStatus(status.Brews, caskKey(cask), blueprint, osName)
 			status.Brews = append(status.Brews, HomebrewStatus{
 				Formula:     caskKey(cask),
-				Version:     "cask",
-				InstalledAt: time.Now().Format(time.RFC3339),
+				Version:     version,
+				InstalledAt: timeutil.Now(),
 				Blueprint:   blueprint,
 				OS:          osName,
 			})
@@ -218,7 +270,7 @@ func (h *HomebrewHandler) UpdateStatus(status *Status, records []ExecutionRecord
 // ensureBrewShellConfig adds brew's shellenv to the user's shell config file
 // so brew binaries are available on PATH. Idempotent — checks for the line
 // before adding it.
-func ensureBrewShellConfig() (err error) {
+func ensureBrewShellConfig() error {
 	brewPath := brewCmd()
 
 	// Build the standard shellenv eval line. The brew binary is guaranteed
@@ -266,26 +318,9 @@ func ensureBrewShellConfig() (err error) {
 		return nil // already set up
 	}
 
-	// Append with a comment header.
-	f, err := os.OpenFile(configPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
-	if err != nil {
-		return fmt.Errorf("opening %s: %w", configPath, err)
-	}
-	defer func() {
-		if cerr := f.Close(); cerr != nil && err == nil {
-			err = cerr
-		}
-	}()
-
-	header := "\n# Homebrew PATH setup\n"
-	if _, err := f.WriteString(header); err != nil {
-		return fmt.Errorf("writing %s: %w", configPath, err)
-	}
-	if _, err := f.WriteString(shellEnvLine + "\n"); err != nil {
-		return fmt.Errorf("writing %s: %w", configPath, err)
-	}
-
-	return nil
+	// Append with a comment header; the file is backed up first so
+	// blueprint rollback --rc-files can restore it.
+	return appendRCFile(configPath, "\n# Homebrew PATH setup\n"+shellEnvLine+"\n")
 }
 
 // caskKey returns a storage key that distinguishes casks from formulas with the same name
@@ -303,17 +338,24 @@ func formulaName(s string) string {
 // realIsBrewFormulaInstalled checks if a formula is already installed.
 // Uses sh -c to support multi-word brew invocations (e.g. under Rosetta 2).
 var realIsBrewFormulaInstalled = func(brew, formula string) bool {
-	cmd := exec.Command("sh", "-c", fmt.Sprintf("%s list --versions %s", brew, formula))
-	cmd.Stdin = nil
-	return cmd.Run() == nil
+	return brewListSucceeds(fmt.Sprintf("%s list --versions %s", brew, formula))
 }
 
 // realIsBrewCaskInstalled checks if a cask is already installed.
 // Uses sh -c to support multi-word brew invocations (e.g. under Rosetta 2).
 var realIsBrewCaskInstalled = func(brew, cask string) bool {
-	cmd := exec.Command("sh", "-c", fmt.Sprintf("%s list --cask %s", brew, cask))
-	cmd.Stdin = nil
-	return cmd.Run() == nil
+	return brewListSucceeds(fmt.Sprintf("%s list --cask %s", brew, cask))
+}
+
+// brewListSucceeds runs a brew list query once per run and reports whether
+// it exited 0.
+func brewListSucceeds(query string) bool {
+	_, err := cachedRun(queryEntry, "cmd:"+query, func() (string, error) {
+		cmd := exec.Command("sh", "-c", query) // #nosec G204 -- brew path and package names from the blueprint
+		cmd.Stdin = nil
+		return "", cmd.Run()
+	})
+	return err == nil
 }
 
 // isBrewFormulaInstalled is overridable for testing.
@@ -338,7 +380,8 @@ func (h *HomebrewHandler) isHomebrewInstalled() bool {
 			return true
 		}
 	}
-	return exec.Command("which", "brew").Run() == nil
+	_, err := cachedLookPath("brew")
+	return err == nil
 }
 
 // ensureHomebrewInstalled ensures homebrew is installed on the system.
@@ -380,9 +423,7 @@ func (h *HomebrewHandler) ensureHomebrewInstalled() error {
 // installHomebrewMacOS installs homebrew on macOS using the official script
 func (h *HomebrewHandler) installHomebrewMacOS() error {
 	// Use the official Homebrew installation script
-	installCmd := `curl -fsSL https://raw.githubusercontent.com/Homebrew/install/HEAD/install.sh | bash`
-
-	if _, err := executeCommandWithCache(installCmd); err != nil {
+	if err := runHomebrewInstallScript(); err != nil {
 		return fmt.Errorf("failed to install homebrew on macOS: %w", err)
 	}
 
@@ -396,19 +437,29 @@ func (h *HomebrewHandler) installHomebrewMacOS() error {
 
 // installHomebrewLinux installs homebrew on Linux
 func (h *HomebrewHandler) installHomebrewLinux() error {
+	if err := checkRemoteScriptAllowed("installing Homebrew", homebrewInstallURL()); err != nil {
+		return err
+	}
+
 	// Homebrew on Linux requires some dependencies and a specific installation process
-	// First ensure we have git and curl
-	depCmd := "apt-get update && apt-get install -y git curl build-essential"
-	if _, err := executeCommandWithCache(fmt.Sprintf("sudo %s", depCmd)); err != nil {
+	// First ensure we have git and curl. apt-get update runs on its own so
+	// the run cache can share it with other rules.
+	installDeps := func(prefix string) error {
+		if _, err := executeCommandWithCache(prefix + "apt-get update"); err != nil {
+			return err
+		}
+		_, err := executeCommandWithCache(prefix + "apt-get install -y git curl build-essential")
+		return err
+	}
+	if err := installDeps("sudo "); err != nil {
 		// Try without sudo if it fails (user might have permissions)
-		if _, err := executeCommandWithCache(depCmd); err != nil {
+		if err := installDeps(""); err != nil {
 			return fmt.Errorf("failed to install homebrew dependencies: %w", err)
 		}
 	}
 
 	// Download and run Homebrew installation script
-	installCmd := `curl -fsSL https://raw.githubusercontent.com/Homebrew/install/HEAD/install.sh | bash`
-	if _, err := executeCommandWithCache(installCmd); err != nil {
+	if err := runHomebrewInstallScript(); err != nil {
 		return fmt.Errorf("failed to install homebrew on Linux: %w", err)
 	}
 
@@ -420,6 +471,41 @@ func (h *HomebrewHandler) installHomebrewLinux() error {
 	return nil
 }
 
+// homebrewInstallURL returns the URL of the Homebrew install script, at the
+// commit or tag pinned in the policy or at HEAD.
+func homebrewInstallURL() string {
+	ref := remoteInstallPolicy.HomebrewInstallRef
+	if ref == "" {
+		ref = "HEAD"
+	}
+	return "https://raw.githubusercontent.com/Homebrew/install/" + ref + "/install.sh"
+}
+
+// runHomebrewInstallScript downloads the Homebrew install script, checks it
+// against the pinned checksum when there is one and runs it. It runs without
+// prompts, as it did when piped into bash.
+func runHomebrewInstallScript() error {
+	url := homebrewInstallURL()
+	if err := checkRemoteScriptAllowed("installing Homebrew", url); err != nil {
+		return err
+	}
+	tmpDir, err := os.MkdirTemp("", "homebrew-install-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+	defer func() { _ = os.RemoveAll(tmpDir) }()
+
+	script := filepath.Join(tmpDir, "install.sh")
+	if _, err := executeCommandWithCache(fmt.Sprintf("curl -fsSL -o %s %s", shellQ(script), shellQ(url))); err != nil {
+		return fmt.Errorf("failed to download %s: %w", url, err)
+	}
+	if err := verifyFileSHA256(script, remoteInstallPolicy.HomebrewInstallSHA256); err != nil {
+		return fmt.Errorf("%s does not match its pinned checksum: %w", url, err)
+	}
+	_, err = executeCommandWithCache("NONINTERACTIVE=1 bash " + shellQ(script))
+	return err
+}
+
 // brewCmd returns the correct brew invocation for the current environment.
 // On Apple Silicon macs, if the current process is running under Rosetta 2,
 // sysctl.proc_translated returns 1. In that case we force ARM64 execution
@@ -555,6 +641,12 @@ func (h *HomebrewHandler) NeedsSudo() bool {
 	return len(h.Rule.HomebrewCasks) > 0
 }
 
+// ConcurrencyClass returns "brew": brew refuses to run while another brew
+// process holds its lock
+func (h *HomebrewHandler) ConcurrencyClass() string {
+	return "brew"
+}
+
 // GetDependencyKey returns the unique key for this rule in dependency resolution
 func (h *HomebrewHandler) GetDependencyKey() string {
 	fallback := "homebrew"
@@ -604,25 +696,16 @@ func (h *HomebrewHandler) DisplayStatus(brews []HomebrewStatus) {
 		return
 	}
 
-	fmt.Printf("\n%s\n", ui.FormatHighlight("Installed Homebrew Formulas:"))
+	rows := make([]statusRow, 0, len(brews))
 	for _, brew := range brews {
-		// Parse timestamp for display
-		t, err := time.Parse(time.RFC3339, brew.InstalledAt)
-		var timeStr string
-		if err == nil {
-			timeStr = t.Format("2006-01-02 15:04:05")
-		} else {
-			timeStr = brew.InstalledAt
-		}
-
-		fmt.Printf("  %s %s (%s) [%s, %s]\n",
-			ui.FormatSuccess("●"),
-			ui.FormatInfo(brew.Formula),
-			ui.FormatDim(timeStr),
-			ui.FormatDim(brew.OS),
-			ui.FormatDim(abbreviateBlueprintPath(brew.Blueprint)),
-		)
+		rows = append(rows, statusRow{
+			name:    brew.Formula,
+			details: []string{timeutil.Display(brew.InstalledAt)},
+			tags:    []string{brew.OS, abbreviateBlueprintPath(brew.Blueprint)},
+			entry:   &brew,
+		})
 	}
+	printStatusSection("Installed Homebrew Formulas:", rows)
 }
 
 // GetState returns handler-specific state as key-value pairs
@@ -2,13 +2,15 @@ package handlers
 
 import (
 	"fmt"
+	"sort"
 	"strings"
-	"time"
+	"sync"
 
 	internal "github.com/elpic/blueprint/internal"
 	"github.com/elpic/blueprint/internal/parser"
 	"github.com/elpic/blueprint/internal/platform"
 	"github.com/elpic/blueprint/internal/ui"
+	"github.com/elpic/blueprint/internal/ui/timeutil"
 )
 
 // InstallHandler handles package installation and uninstallation
@@ -20,6 +22,29 @@ func init() {
 	RegisterAction(ActionDef{
 		Name:   "install",
 		Prefix: "install ",
+		Meta: ActionMeta{
+			Summary: "Install packages with the system package manager (apt, dnf, yum, pacman, zypper or apk on Linux, brew on macOS).",
+			Usage:   "install <package>... [pm: <pm>] [stage: <stage>] [<os>-name: <name>] [map: [<os>[:<package>]=<name>, ...]] [jobs: <n>]",
+			Attrs: []AttrMeta{
+				{Name: "mac-name", Type: "string", Description: "Package name to install on macOS instead (single-package rules)"},
+				{Name: "linux-name", Type: "string", Description: "Package name to install on Linux instead (single-package rules)"},
+				{Name: "map", Type: "list", Description: "Per-OS package names as <os>=<name>, or <os>:<package>=<name> when installing several"},
+				{Name: "pm", Type: "string", Description: "Package manager to use instead of the detected one: apt, dnf, yum, pacman, zypper, apk, snap or brew"},
+				{Name: "package-manager", Type: "string", Description: "Long form of pm:"},
+				{Name: "stage", Type: "string", Description: "Container template stage (build, runtime)"},
+				jobsAttr,
+			},
+			Examples: []string{
+				"install git curl",
+				"install code pm: snap on: [linux]",
+				"install ripgrep pm: dnf on: [linux]",
+				"install wezterm linux-name: wezterm-nightly",
+				"install fd ripgrep map: [linux:fd=fd-find]",
+				"install jq htop tmux tree jobs: 1",
+			},
+			OS:  []string{"mac", "linux"},
+			Doc: "install.md",
+		},
 		NewHandler: func(rule parser.Rule, basePath string, passwordCache map[string]string) Handler {
 			return NewInstallHandler(rule, basePath, platform.NewContainer())
 		},
@@ -32,6 +57,24 @@ func init() {
 		Detect: func(rule parser.Rule) bool {
 			return len(rule.Packages) > 0
 		},
+		Refresh: func(entries []StatusEntry) []string {
+			// Versions are only recorded for brew and apt packages (see installedVersions)
+			versions, err := systemPackageVersions(getOSName())
+			if err != nil {
+				return nil
+			}
+			var changes []string
+			for _, e := range entries {
+				p := e.(*PackageStatus)
+				version, ok := versions[p.Name]
+				if !ok || p.Version == "" || version == p.Version {
+					continue
+				}
+				changes = append(changes, fmt.Sprintf("%s: %s → %s", p.Name, p.Version, version))
+				p.Version = version
+			}
+			return changes
+		},
 		Summary: func(rule parser.Rule) string {
 			names := make([]string, len(rule.Packages))
 			for i, p := range rule.Packages {
@@ -42,6 +85,9 @@ func init() {
 		OrphanIndex: func(rule parser.Rule, index func(string)) {
 			for _, pkg := range rule.Packages {
 				index(pkg.Name)
+				for _, name := range pkg.OSNames {
+					index(name)
+				}
 			}
 		},
 		ShellExport: func(rule parser.Rule, _, osName string) []string {
@@ -60,13 +106,19 @@ func init() {
 						fmt.Sprintf("  brew install %s", name),
 						"fi",
 					)
+				} else if pm, ok := lookupLinuxPackageManager(p.PackageManager); ok && pm.name != "apt" {
+					lines = append(lines,
+						fmt.Sprintf("if ! %s %s >/dev/null 2>&1; then", pm.query, name),
+						fmt.Sprintf("  sudo %s %s", pm.install, name),
+						"fi",
+					)
 				} else {
 					installName := name
 					if p.Version != "" && p.Version != "latest" {
 						installName += "=" + p.Version
 					}
 					lines = append(lines,
-						fmt.Sprintf("if ! dpkg -s %s >/dev/null 2>&1; then", name),
+						fmt.Sprintf("if ! dpkg-query -W -f='${Status}' %s 2>/dev/null | grep -q 'install ok installed'; then", name),
 						fmt.Sprintf("  sudo apt-get install -y %s", installName),
 						"fi",
 					)
@@ -83,6 +135,13 @@ func init() {
 			if len(rule.Packages) > 0 {
 				return rule.Packages[0].Name
 			}
+			// Keyed like the rule it undoes, so two uninstalls of one run
+			// do not collapse into one
+			if action := DetectRuleType(rule); action != "" && action != "uninstall" {
+				if def := GetAction(action); def != nil && def.RuleKey != nil {
+					return def.RuleKey(rule)
+				}
+			}
 			return "install"
 		},
 	})
@@ -106,6 +165,9 @@ func NewInstallHandlerLegacy(rule parser.Rule, basePath string) *InstallHandler
 
 // Up installs the packages
 func (h *InstallHandler) Up() (string, error) {
+	if h.Rule.Jobs > 0 && len(h.Rule.Packages) > 0 {
+		return h.upPerPackage()
+	}
 	cmd := h.buildCommand()
 	if cmd == "" {
 		return "", fmt.Errorf("unable to build install command")
@@ -114,6 +176,41 @@ func (h *InstallHandler) Up() (string, error) {
 	return executeCommandWithCache(cmd)
 }
 
+// upPerPackage installs the packages one by one for jobs:, so one package
+// that fails to install does not fail the others. Packages of one package
+// manager still install one after another, since the manager holds a lock
+// while it works; only packages of different managers install side by side.
+func (h *InstallHandler) upPerPackage() (string, error) {
+	targetOS := h.Container.SystemProvider().OS().Name()
+	system := h.systemClass(targetOS)
+
+	names := make([]string, len(h.Rule.Packages))
+	packages := make(map[string]parser.Package, len(h.Rule.Packages))
+	locks := make(map[string]*sync.Mutex)
+	for i, pkg := range h.Rule.Packages {
+		names[i] = pkg.Name
+		packages[pkg.Name] = pkg
+		locks[packageClass(pkg, targetOS, system)] = &sync.Mutex{}
+	}
+
+	return runTargets(names, h.Rule.Jobs, func(name string) error {
+		pkg := packages[name]
+		lock := locks[packageClass(pkg, targetOS, system)]
+		lock.Lock()
+		defer lock.Unlock()
+		manager := pkg.PackageManager
+		if manager == "" {
+			manager = "default"
+		}
+		cmd := h.buildInstallCommandForManager(manager, []string{name}, targetOS)
+		if cmd == "" {
+			return fmt.Errorf("unable to build install command")
+		}
+		_, err := executeCommandWithCache(cmd)
+		return err
+	})
+}
+
 // Down uninstalls the packages
 func (h *InstallHandler) Down() (string, error) {
 	// Convert install rule to uninstall command
@@ -145,19 +242,31 @@ func (h *InstallHandler) UpdateStatus(status *Status, records []ExecutionRecord,
 
 	switch h.Rule.Action {
 	case "install":
-		// Check if this rule's command was executed successfully
-		cmd := h.buildCommand()
-		_, commandExecuted := commandSuccessfullyExecuted(cmd, records)
+		// Record the packages this rule's command installed: all of them when
+		// it succeeded, and with jobs: the ones that did when it failed
+		names := make([]string, len(h.Rule.Packages))
+		for i, pkg := range h.Rule.Packages {
+			names[i] = pkg.Name
+		}
+		installed := make(map[string]bool)
+		for _, name := range succeededTargets(h.buildCommand(), records, names) {
+			installed[name] = true
+		}
 
-		if commandExecuted {
+		if len(installed) > 0 {
+			versions := h.installedVersions(osName)
 			// Add or update package status
 			for _, pkg := range h.Rule.Packages {
+				if !installed[pkg.Name] {
+					continue
+				}
 				// Remove existing entry if present
 				status.Packages = removePackageStatus(status.Packages, pkg.Name, blueprint, osName)
 				// Add new entry
 				status.Packages = append(status.Packages, PackageStatus{
 					Name:        pkg.Name,
-					InstalledAt: time.Now().Format(time.RFC3339),
+					Version:     systemVersion(pkg, osName, versions),
+					InstalledAt: timeutil.Now(),
 					Blueprint:   blueprint,
 					OS:          osName,
 				})
@@ -173,6 +282,44 @@ func (h *InstallHandler) UpdateStatus(status *Status, records []ExecutionRecord,
 	return nil
 }
 
+// installedVersions returns the versions of installed system packages, keyed by
+// name, so status records what was actually installed. Mac (one brew info
+// call) and Linux with apt (one dpkg-query call) are queried; elsewhere, or
+// if the query fails, the map is empty and versions are simply left
+// unrecorded.
+func (h *InstallHandler) installedVersions(osName string) map[string]string {
+	switch {
+	case osName == "mac":
+	case osName == "linux" && h.systemPackageManager().name == "apt":
+	default:
+		return nil
+	}
+	versions, err := systemPackageVersions(osName)
+	if err != nil {
+		return nil
+	}
+	return versions
+}
+
+// systemVersion returns pkg's version from versions when pkg is managed by
+// the system package manager installedVersions queried on osName: brew on
+// mac, apt on Linux.
+func systemVersion(pkg parser.Package, osName string, versions map[string]string) string {
+	switch pkg.PackageManager {
+	case "", "default":
+		return versions[pkg.Name]
+	case "apt", "apt-get":
+		if osName != "mac" {
+			return versions[pkg.Name]
+		}
+	case "brew", "homebrew":
+		if osName == "mac" {
+			return versions[pkg.Name]
+		}
+	}
+	return ""
+}
+
 // needsSudo checks if a command needs sudo by examining the command string.
 // This is used as a fallback for unknown systems or when package-manager specific
 // logic is not available.
@@ -194,6 +341,21 @@ func (h *InstallHandler) shouldAddSudo() bool {
 	return !osDetector.IsRoot()
 }
 
+// systemPackageManager returns the package manager of the running Linux distro.
+func (h *InstallHandler) systemPackageManager() linuxPackageManager {
+	return detectLinuxPackageManager(h.Container.SystemProvider())
+}
+
+// linuxPackageManagerFor returns the Linux package manager for a package's
+// pm: value, the running distro's for "default". ok is false for managers
+// the install rule has no commands for.
+func (h *InstallHandler) linuxPackageManagerFor(manager string) (linuxPackageManager, bool) {
+	if manager == "" || manager == "default" {
+		return h.systemPackageManager(), true
+	}
+	return lookupLinuxPackageManager(manager)
+}
+
 // getBrewCommand returns the appropriate brew command using dependency injection
 func (h *InstallHandler) getBrewCommand() string {
 	osDetector := h.Container.SystemProvider().OS()
@@ -237,10 +399,17 @@ func (h *InstallHandler) buildCommand() string {
 	// Group packages by package manager
 	packagesByManager := h.groupPackagesByManager()
 
+	// Sort the managers so the command is the same on every run
+	managers := make([]string, 0, len(packagesByManager))
+	for manager := range packagesByManager {
+		managers = append(managers, manager)
+	}
+	sort.Strings(managers)
+
 	// Build commands for each package manager
 	var commands []string
-	for manager, pkgList := range packagesByManager {
-		cmd := h.buildInstallCommandForManager(manager, pkgList, targetOS)
+	for _, manager := range managers {
+		cmd := h.buildInstallCommandForManager(manager, packagesByManager[manager], targetOS)
 		if cmd != "" {
 			commands = append(commands, cmd)
 		}
@@ -311,19 +480,22 @@ func (h *InstallHandler) buildInstallCommandForManager(manager string, pkgNames
 		return fmt.Sprintf("%s install %s", h.getBrewCommand(), pkgStr)
 
 	case "apt", "apt-get", "default":
-		// apt-get (Linux default)
 		if targetOS == "mac" {
 			// Fallback to brew on macOS if apt is specified — use dependency injection for brew command
 			return fmt.Sprintf("%s install %s", h.getBrewCommand(), pkgStr)
 		}
+		fallthrough
 
-		cmd := fmt.Sprintf("apt-get install -y %s", pkgStr)
-		if h.shouldAddSudo() {
-			cmd = fmt.Sprintf("sudo %s", cmd)
+	default:
+		// The detected Linux package manager, or the one named with pm:
+		if pm, ok := h.linuxPackageManagerFor(manager); ok {
+			cmd := fmt.Sprintf("%s %s", pm.install, pkgStr)
+			if h.shouldAddSudo() {
+				cmd = fmt.Sprintf("sudo %s", cmd)
+			}
+			return cmd
 		}
-		return cmd
 
-	default:
 		// Unknown package manager, try to use it directly
 		cmd := fmt.Sprintf("%s install %s", manager, pkgStr)
 		if h.shouldAddSudo() {
@@ -410,19 +582,22 @@ func (h *InstallHandler) buildUninstallCommandForManager(manager string, pkgName
 		return fmt.Sprintf("%s uninstall -y %s", h.getBrewCommand(), pkgStr)
 
 	case "apt", "apt-get", "default":
-		// apt-get (Linux default)
 		if targetOS == "mac" {
 			// Fallback to brew on macOS if apt is specified — use dependency injection for brew command
 			return fmt.Sprintf("%s uninstall -y %s", h.getBrewCommand(), pkgStr)
 		}
+		fallthrough
 
-		cmd := fmt.Sprintf("apt-get remove -y %s", pkgStr)
-		if h.shouldAddSudo() {
-			cmd = fmt.Sprintf("sudo %s", cmd)
+	default:
+		// The detected Linux package manager, or the one named with pm:
+		if pm, ok := h.linuxPackageManagerFor(manager); ok {
+			cmd := fmt.Sprintf("%s %s", pm.remove, pkgStr)
+			if h.shouldAddSudo() {
+				cmd = fmt.Sprintf("sudo %s", cmd)
+			}
+			return cmd
 		}
-		return cmd
 
-	default:
 		// Unknown package manager, try to use it directly
 		cmd := fmt.Sprintf("%s remove %s", manager, pkgStr)
 		if h.shouldAddSudo() {
@@ -439,6 +614,15 @@ var getOSName = func() string {
 	return detector.Name()
 }
 
+// SetOSName makes handlers see osName as the current OS until the returned
+// func restores the previous one. It is for tests, which must not depend on
+// the machine they run on.
+func SetOSName(osName string) (restore func()) {
+	orig := getOSName
+	getOSName = func() string { return osName }
+	return func() { getOSName = orig }
+}
+
 // DisplayInfo displays handler-specific information
 func (h *InstallHandler) DisplayInfo() {
 	if h.Rule.Action == "uninstall" {
@@ -467,11 +651,26 @@ func SetCommandExecutor(executor platform.CommandExecutor) {
 	commandExecutor = executor
 }
 
-// executeCommandWithCache executes a command using the injected command executor
+// GetCommandExecutor returns the executor set with SetCommandExecutor, so a
+// test that replaces it can put it back.
+func GetCommandExecutor() platform.CommandExecutor {
+	return commandExecutor
+}
+
+// executeCommandWithCache executes a command using the injected command
+// executor. Package index refreshes and read-only lookups are answered from
+// the run cache after their first run; any other command may change what is
+// installed, so it drops the cached lookups (see runcache.go).
 func executeCommandWithCache(cmd string) (string, error) {
 	if commandExecutor == nil {
 		return "", fmt.Errorf("command executor not initialized - missing dependency injection")
 	}
+	if kind, ok := commandCacheKind(cmd); ok {
+		return cachedRun(kind, "cmd:"+strings.TrimSpace(cmd), func() (string, error) {
+			return commandExecutor.Execute(cmd)
+		})
+	}
+	defer InvalidateRunCache(queryEntry)
 	return commandExecutor.Execute(cmd)
 }
 
@@ -481,25 +680,16 @@ func (h *InstallHandler) DisplayStatus(packages []PackageStatus) {
 		return
 	}
 
-	fmt.Printf("\n%s\n", ui.FormatHighlight("Installed Packages:"))
+	rows := make([]statusRow, 0, len(packages))
 	for _, pkg := range packages {
-		// Parse timestamp for display
-		t, err := time.Parse(time.RFC3339, pkg.InstalledAt)
-		var timeStr string
-		if err == nil {
-			timeStr = t.Format("2006-01-02 15:04:05")
-		} else {
-			timeStr = pkg.InstalledAt
-		}
-
-		fmt.Printf("  %s %s (%s) [%s, %s]\n",
-			ui.FormatSuccess("●"),
-			ui.FormatInfo(pkg.Name),
-			ui.FormatDim(timeStr),
-			ui.FormatDim(pkg.OS),
-			ui.FormatDim(abbreviateBlueprintPath(pkg.Blueprint)),
-		)
+		rows = append(rows, statusRow{
+			name:    pkg.Name,
+			details: []string{timeutil.Display(pkg.InstalledAt)},
+			tags:    []string{pkg.OS, abbreviateBlueprintPath(pkg.Blueprint)},
+			entry:   &pkg,
+		})
 	}
+	printStatusSection("Installed Packages:", rows)
 }
 
 // DisplayStatusFromStatus displays install handler status from Status object
@@ -599,6 +789,51 @@ func (h *InstallHandler) IsInstalled(status *Status, blueprintFile, osName strin
 	return true
 }
 
+// IsSatisfied reports whether every package is already installed, asking
+// the package manager that would install it. Packages pinned to a version
+// and managers blueprint has no query for are left to Up.
+func (h *InstallHandler) IsSatisfied() (bool, error) {
+	if len(h.Rule.Packages) == 0 {
+		return false, nil
+	}
+	targetOS := h.Container.SystemProvider().OS().Name()
+	for _, pkg := range h.Rule.Packages {
+		if pkg.Version != "" && pkg.Version != "latest" {
+			return false, nil
+		}
+		query, installed := h.packageQuery(pkg, targetOS)
+		if query == "" {
+			return false, nil
+		}
+		result, err := h.Container.SystemProvider().Process().Execute(query, platform.ExecuteOptions{})
+		if result == nil && err != nil {
+			return false, err
+		}
+		if result == nil || !result.Success || !strings.Contains(result.Stdout, installed) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// packageQuery returns the command that exits 0 when pkg is installed, or ""
+// when its package manager has none, and the text its output then contains.
+func (h *InstallHandler) packageQuery(pkg parser.Package, targetOS string) (query, installed string) {
+	switch pkg.PackageManager {
+	case "snap":
+		return "snap list " + pkg.Name, ""
+	case "homebrew", "brew":
+		return h.getBrewCommand() + " list --versions " + pkg.Name, ""
+	}
+	if targetOS == "mac" {
+		return h.getBrewCommand() + " list --versions " + pkg.Name, ""
+	}
+	if pm, ok := h.linuxPackageManagerFor(pkg.PackageManager); ok {
+		return pm.query + " " + pkg.Name, pm.installed
+	}
+	return "", ""
+}
+
 // NeedsSudo returns true if package installation/uninstallation requires sudo privileges.
 // This method uses package-manager aware logic consistent with shouldAddSudo().
 func (h *InstallHandler) NeedsSudo() bool {
@@ -618,7 +853,7 @@ func (h *InstallHandler) NeedsSudo() bool {
 		return false
 
 	case "linux":
-		// Linux package managers (apt, yum, snap) require sudo unless running as root
+		// Linux package managers (apt, dnf, pacman, snap, ...) require sudo unless running as root
 		return !osDetector.IsRoot()
 
 	default:
@@ -633,3 +868,55 @@ func (h *InstallHandler) NeedsSudo() bool {
 		return needsSudo(cmd)
 	}
 }
+
+// ConcurrencyClass returns the package manager whose lock this rule takes:
+// the distro's (such as "apt" or "dnf") for the system packages on Linux,
+// "brew" on macOS, otherwise the manager named on the first package. A rule
+// mixing managers reports the system one, since a system package manager's
+// lock is the one that fails on contention.
+func (h *InstallHandler) ConcurrencyClass() string {
+	targetOS := h.Container.SystemProvider().OS().Name()
+	system := h.systemClass(targetOS)
+	class := ""
+	for _, pkg := range h.Rule.Packages {
+		manager := packageClass(pkg, targetOS, system)
+		if manager == system {
+			return manager
+		}
+		if class == "" {
+			class = manager
+		}
+	}
+	return class
+}
+
+// systemClass returns the concurrency class of the system package manager.
+func (h *InstallHandler) systemClass(targetOS string) string {
+	if targetOS == "linux" {
+		return h.systemPackageManager().name
+	}
+	return packageManagerClass("default", targetOS)
+}
+
+// packageClass returns the concurrency class of the manager installing pkg,
+// given the class of the system package manager.
+func packageClass(pkg parser.Package, targetOS, system string) string {
+	if targetOS == "linux" && (pkg.PackageManager == "" || pkg.PackageManager == "default") {
+		return system
+	}
+	return packageManagerClass(pkg.PackageManager, targetOS)
+}
+
+// packageManagerClass maps a package's manager to its concurrency class.
+func packageManagerClass(manager, targetOS string) string {
+	switch manager {
+	case "", "default", "apt", "apt-get":
+		if targetOS == "mac" {
+			return "brew"
+		}
+		return "apt"
+	case "homebrew", "brew":
+		return "brew"
+	}
+	return manager
+}
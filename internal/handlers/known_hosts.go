@@ -1,23 +1,43 @@
 package handlers
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"github.com/elpic/blueprint/internal"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"regexp"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/elpic/blueprint/internal/parser"
 	"github.com/elpic/blueprint/internal/ui"
+	"github.com/elpic/blueprint/internal/ui/timeutil"
 )
 
 func init() {
 	RegisterAction(ActionDef{
 		Name:   "known_hosts",
 		Prefix: "known_hosts ",
+		Meta: ActionMeta{
+			Summary: "Add a host's SSH key to ~/.ssh/known_hosts.",
+			Usage:   "known_hosts <host> [key: <type>] [pubkey: <key>]",
+			Attrs: []AttrMeta{
+				{Name: "key", Type: "string", Description: "ssh-keyscan key type (ed25519, ecdsa, rsa); auto-detected when omitted"},
+				{Name: "pubkey", Type: "string", Description: "host key to add as is instead of scanning the host, e.g. \"ssh-ed25519 AAAA...\""},
+			},
+			Examples: []string{
+				"known_hosts github.com",
+				"known_hosts gitlab.com key: ed25519",
+				"known_hosts git.internal pubkey: ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIOMqqnkVzrm0SdG6UOoqKLsabgH5C9okWi0dh2l9GKJl",
+			},
+			OS:  []string{"mac", "linux"},
+			Doc: "known-hosts.md",
+		},
 		NewHandler: func(rule parser.Rule, basePath string, passwordCache map[string]string) Handler {
 			return NewKnownHostsHandler(rule, basePath)
 		},
@@ -33,19 +53,70 @@ func init() {
 		OrphanIndex: func(rule parser.Rule, index func(string)) {
 			index(rule.KnownHosts)
 		},
+		Verify: func(e StatusEntry) bool {
+			return knownHostPresent(e.(*KnownHostsStatus).Host)
+		},
 		ShellExport: func(rule parser.Rule, _, _ string) []string {
+			lines := []string{`mkdir -p "$HOME/.ssh" && chmod 700 "$HOME/.ssh"`}
+			if rule.KnownHostsPubkey != "" {
+				return append(lines, fmt.Sprintf(`printf '%%s\n' '%s %s' >> "$HOME/.ssh/known_hosts"`, rule.KnownHosts, rule.KnownHostsPubkey))
+			}
 			keyType := rule.KnownHostsKey
 			if keyType == "" {
 				keyType = "ed25519"
 			}
-			return []string{
-				`mkdir -p "$HOME/.ssh" && chmod 700 "$HOME/.ssh"`,
-				fmt.Sprintf(`ssh-keyscan -t %s %s >> "$HOME/.ssh/known_hosts" 2>/dev/null`, keyType, rule.KnownHosts),
-			}
+			return append(lines, fmt.Sprintf(`ssh-keyscan -T %d -t %s %s >> "$HOME/.ssh/known_hosts" 2>/dev/null`, keyscanTimeout, keyType, rule.KnownHosts))
 		},
 	})
 }
 
+// keyscanTimeout is the number of seconds ssh-keyscan waits for each
+// connection (-T), so a host behind a filtering firewall fails fast instead of
+// hanging for minutes.
+const keyscanTimeout = 5
+
+// keyscanDeadline bounds a whole ssh-keyscan run: a name that resolves to
+// many addresses gets keyscanTimeout for each of them.
+const keyscanDeadline = 30 * time.Second
+
+// keyscanFamilies are the address families tried in turn. IPv4 goes first,
+// as a broken IPv6 route is the usual reason a scan never gets an answer.
+var keyscanFamilies = []string{"-4", "-6"}
+
+// runKeyscan runs ssh-keyscan with args and returns what it printed on
+// stdout. A variable so tests can stub it.
+var runKeyscan = func(args ...string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), keyscanDeadline)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, "ssh-keyscan", args...).Output()
+	if ctx.Err() != nil {
+		return nil, fmt.Errorf("timed out after %s", keyscanDeadline)
+	}
+	return out, err
+}
+
+// scanHostKey returns the known_hosts lines ssh-keyscan prints for host,
+// trying IPv4 and then IPv6. ssh-keyscan exits 0 when it cannot connect,
+// so a scan that prints no key counts as failed too.
+func scanHostKey(host, keyType string) ([]byte, error) {
+	var failures []string
+	for _, family := range keyscanFamilies {
+		out, err := runKeyscan(family, "-T", strconv.Itoa(keyscanTimeout), "-t", keyType, host)
+		if err == nil && len(bytes.TrimSpace(out)) > 0 {
+			return out, nil
+		}
+		reason := "no key returned"
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && len(bytes.TrimSpace(exitErr.Stderr)) > 0 {
+			reason = strings.TrimSpace(string(exitErr.Stderr))
+		} else if err != nil {
+			reason = err.Error()
+		}
+		failures = append(failures, fmt.Sprintf("IPv%s: %s", strings.TrimPrefix(family, "-"), reason))
+	}
+	return nil, fmt.Errorf("ssh-keyscan found no %s key for %s (%s)", keyType, host, strings.Join(failures, "; "))
+}
+
 // KnownHostsHandler handles SSH known_hosts file management
 type KnownHostsHandler struct {
 	BaseHandler
@@ -73,16 +144,16 @@ func (h *KnownHostsHandler) Up() (string, error) {
 		return "", err
 	}
 
-	cmd := exec.Command("sh", "-c", h.GetCommand())
-	output, err := cmd.Output()
-
-	if err != nil {
-		// Collect error messages for each key type
-		errMsg := strings.TrimSpace(string(output))
-		if errMsg == "" {
-			errMsg = "unknown error"
+	// A key given with pubkey: is written as is, so hosts that cannot be
+	// reached from here (or should not be trusted on first use) still work
+	var output []byte
+	if h.Rule.KnownHostsPubkey != "" {
+		output = []byte(h.Rule.KnownHosts + " " + h.Rule.KnownHostsPubkey + "\n")
+	} else {
+		output, err = scanHostKey(h.Rule.KnownHosts, getKeyType(h))
+		if err != nil {
+			return "", fmt.Errorf("failed to add host to known_hosts: %w", err)
 		}
-		return "", fmt.Errorf("failed to add host to known_hosts - \nDetails:\n%s", errMsg)
 	}
 
 	// Append the scanned key to known_hosts
@@ -201,9 +272,13 @@ func (h *KnownHostsHandler) GetCommand() string {
 		return fmt.Sprintf(`sed -i.bak '/^%s[, ]/d' ~/.ssh/known_hosts && rm -f ~/.ssh/known_hosts.bak`, escapeForSed(h.Rule.KnownHosts))
 	}
 
+	if h.Rule.KnownHostsPubkey != "" {
+		return fmt.Sprintf("echo '%s %s' >> ~/.ssh/known_hosts", h.Rule.KnownHosts, h.Rule.KnownHostsPubkey)
+	}
+
 	// For known_hosts add action, return the ssh-keyscan command
 	keyType := getKeyType(h)
-	return fmt.Sprintf("ssh-keyscan -t %s %s", keyType, h.Rule.KnownHosts)
+	return fmt.Sprintf("ssh-keyscan -T %d -t %s %s", keyscanTimeout, keyType, h.Rule.KnownHosts)
 }
 
 // UpdateStatus updates the status after adding or removing a known host
@@ -217,10 +292,12 @@ func (h *KnownHostsHandler) UpdateStatus(status *Status, records []ExecutionReco
 		commandExecuted := false
 		var keyType string
 		for _, record := range records {
-			if record.Status == "success" && strings.Contains(record.Command, "ssh-keyscan") && strings.Contains(record.Command, h.Rule.KnownHosts) {
+			if record.Status == "success" && (strings.Contains(record.Command, "ssh-keyscan") || strings.Contains(record.Command, "known_hosts")) && strings.Contains(record.Command, h.Rule.KnownHosts) {
 				commandExecuted = true
-				// Extract key type from the command
-				if strings.Contains(record.Command, "ed25519") {
+				// Extract key type from the command, or from the pinned key
+				if h.Rule.KnownHostsPubkey != "" {
+					keyType = pubkeyType(h.Rule.KnownHostsPubkey)
+				} else if strings.Contains(record.Command, "ed25519") {
 					keyType = "ed25519"
 				} else if strings.Contains(record.Command, "ecdsa") {
 					keyType = "ecdsa"
@@ -238,7 +315,7 @@ func (h *KnownHostsHandler) UpdateStatus(status *Status, records []ExecutionReco
 			status.KnownHosts = append(status.KnownHosts, KnownHostsStatus{
 				Host:      h.Rule.KnownHosts,
 				KeyType:   keyType,
-				AddedAt:   time.Now().Format(time.RFC3339),
+				AddedAt:   timeutil.Now(),
 				Blueprint: blueprint,
 				OS:        osName,
 			})
@@ -251,6 +328,21 @@ func (h *KnownHostsHandler) UpdateStatus(status *Status, records []ExecutionReco
 	return nil
 }
 
+// pubkeyType returns the short key type of an SSH public key line, such as
+// ed25519 for "ssh-ed25519 AAAA...".
+func pubkeyType(pubkey string) string {
+	kind, _, _ := strings.Cut(pubkey, " ")
+	switch {
+	case strings.Contains(kind, "ed25519"):
+		return "ed25519"
+	case strings.Contains(kind, "ecdsa"):
+		return "ecdsa"
+	case strings.Contains(kind, "rsa"):
+		return "rsa"
+	}
+	return strings.TrimPrefix(kind, "ssh-")
+}
+
 func getKeyType(h *KnownHostsHandler) string {
 	keyType := "ed25519" // Default to ed25519
 
@@ -268,13 +360,18 @@ func (h *KnownHostsHandler) DisplayInfo() {
 		formatFunc = ui.FormatDim
 	}
 
-	fmt.Printf("  %s\n", formatFunc(fmt.Sprintf("Host: %s", h.Rule.KnownHosts)))
+	printInfo(formatFunc, "Host", h.Rule.KnownHosts)
+
+	if h.Rule.KnownHostsPubkey != "" {
+		printInfo(formatFunc, "Key Type", pubkeyType(h.Rule.KnownHostsPubkey)+" (pinned with pubkey:)")
+		return
+	}
 
 	keyTypeDisplay := h.Rule.KnownHostsKey
 	if keyTypeDisplay == "" {
 		keyTypeDisplay = "auto-detect (ed25519, ecdsa, rsa)"
 	}
-	fmt.Printf("  %s\n", formatFunc(fmt.Sprintf("Key Type: %s", keyTypeDisplay)))
+	printInfo(formatFunc, "Key Type", keyTypeDisplay)
 }
 
 // isValidHostname validates that a hostname is safe to use in shell commands
@@ -297,31 +394,21 @@ func (h *KnownHostsHandler) DisplayStatus(hosts []KnownHostsStatus) {
 		return
 	}
 
-	fmt.Printf("\n%s\n", ui.FormatHighlight("SSH Known Hosts:"))
+	rows := make([]statusRow, 0, len(hosts))
 	for _, kh := range hosts {
-		// Parse timestamp for display
-		t, err := time.Parse(time.RFC3339, kh.AddedAt)
-		var timeStr string
-		if err == nil {
-			timeStr = t.Format("2006-01-02 15:04:05")
-		} else {
-			timeStr = kh.AddedAt
-		}
-
 		keyTypeStr := kh.KeyType
 		if keyTypeStr == "" {
 			keyTypeStr = "unknown"
 		}
 
-		fmt.Printf("  %s %s (%s, %s) [%s, %s]\n",
-			ui.FormatSuccess("●"),
-			ui.FormatInfo(kh.Host),
-			ui.FormatDim(keyTypeStr),
-			ui.FormatDim(timeStr),
-			ui.FormatDim(kh.OS),
-			ui.FormatDim(abbreviateBlueprintPath(kh.Blueprint)),
-		)
+		rows = append(rows, statusRow{
+			name:    kh.Host,
+			details: []string{keyTypeStr, timeutil.Display(kh.AddedAt)},
+			tags:    []string{kh.OS, abbreviateBlueprintPath(kh.Blueprint)},
+			entry:   &kh,
+		})
 	}
+	printStatusSection("SSH Known Hosts:", rows)
 }
 
 // DisplayStatusFromStatus displays known hosts handler status from Status object
@@ -396,6 +483,37 @@ func (h *KnownHostsHandler) IsInstalled(status *Status, blueprintFile, osName st
 	}
 
 	// Verify the key is actually present in the file — status can be stale if the file was deleted.
+	return knownHostPresent(h.Rule.KnownHosts)
+}
+
+// IsSatisfied reports whether ~/.ssh/known_hosts already has the host, with
+// the pinned key when the rule gives one.
+func (h *KnownHostsHandler) IsSatisfied() (bool, error) {
+	if h.Rule.KnownHostsPubkey == "" {
+		return knownHostPresent(h.Rule.KnownHosts), nil
+	}
+	sshPath, err := sshDir(false)
+	if err != nil {
+		return false, err
+	}
+	data, err := os.ReadFile(filepath.Join(sshPath, "known_hosts"))
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	want := h.Rule.KnownHosts + " " + strings.TrimSpace(h.Rule.KnownHostsPubkey)
+	for _, line := range strings.Split(string(data), "\n") {
+		if strings.TrimSpace(line) == want {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// knownHostPresent reports whether ~/.ssh/known_hosts has a line for host.
+func knownHostPresent(host string) bool {
 	knownHostsPath, err := knownHostsFile(false)
 	if err != nil {
 		return false
@@ -405,7 +523,7 @@ func (h *KnownHostsHandler) IsInstalled(status *Status, blueprintFile, osName st
 		return false
 	}
 	for _, line := range strings.Split(string(data), "\n") {
-		if strings.HasPrefix(line, h.Rule.KnownHosts) {
+		if strings.HasPrefix(line, host) {
 			return true
 		}
 	}
@@ -2,8 +2,11 @@ package handlers
 
 import (
 	"bytes"
+	"fmt"
 	"io"
 	"os"
+	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
 
@@ -22,7 +25,7 @@ func TestKnownHostsHandlerGetCommand(t *testing.T) {
 				Action:     "known_hosts",
 				KnownHosts: "github.com",
 			},
-			expected: "ssh-keyscan -t ed25519 github.com",
+			expected: "ssh-keyscan -T 5 -t ed25519 github.com",
 		},
 		{
 			name: "add host with specific key type",
@@ -31,7 +34,7 @@ func TestKnownHostsHandlerGetCommand(t *testing.T) {
 				KnownHosts:    "example.com",
 				KnownHostsKey: "rsa",
 			},
-			expected: "ssh-keyscan -t rsa example.com",
+			expected: "ssh-keyscan -T 5 -t rsa example.com",
 		},
 		{
 			name: "uninstall - remove from known_hosts",
@@ -116,7 +119,7 @@ func TestKnownHostsHandlerUpdateStatus(t *testing.T) {
 			records: []ExecutionRecord{
 				{
 					Status:  "success",
-					Command: "ssh-keyscan -t ed25519 github.com",
+					Command: "ssh-keyscan -T 5 -t ed25519 github.com",
 					Output:  "Added github.com to known_hosts (key type: ed25519)",
 				},
 			},
@@ -154,7 +157,7 @@ func TestKnownHostsHandlerUpdateStatus(t *testing.T) {
 			records: []ExecutionRecord{
 				{
 					Status:  "error",
-					Command: "ssh-keyscan -t ed25519 github.com",
+					Command: "ssh-keyscan -T 5 -t ed25519 github.com",
 				},
 			},
 			initialStatus:   Status{},
@@ -294,3 +297,109 @@ func TestKnownHostsHandlerGetDependencyKey(t *testing.T) {
 		})
 	}
 }
+
+func TestScanHostKeyFallsBackToIPv6(t *testing.T) {
+	orig := runKeyscan
+	t.Cleanup(func() { runKeyscan = orig })
+
+	var calls [][]string
+	runKeyscan = func(args ...string) ([]byte, error) {
+		calls = append(calls, args)
+		if args[0] == "-4" {
+			return nil, nil // ssh-keyscan exits 0 without a key when it cannot connect
+		}
+		return []byte("git.internal ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIOMq\n"), nil
+	}
+	out, err := scanHostKey("git.internal", "ed25519")
+	if err != nil {
+		t.Fatalf("scanHostKey() error: %v", err)
+	}
+	if !strings.HasPrefix(string(out), "git.internal ssh-ed25519") {
+		t.Errorf("scanHostKey() = %q", out)
+	}
+	want := [][]string{
+		{"-4", "-T", "5", "-t", "ed25519", "git.internal"},
+		{"-6", "-T", "5", "-t", "ed25519", "git.internal"},
+	}
+	if !reflect.DeepEqual(calls, want) {
+		t.Errorf("ssh-keyscan calls = %v, want %v", calls, want)
+	}
+
+	runKeyscan = func(args ...string) ([]byte, error) {
+		return nil, fmt.Errorf("timed out after 30s")
+	}
+	_, err = scanHostKey("git.internal", "ed25519")
+	if err == nil || !strings.Contains(err.Error(), "IPv4: timed out") || !strings.Contains(err.Error(), "IPv6: timed out") {
+		t.Errorf("scanHostKey() error = %v, want both families reported", err)
+	}
+}
+
+func TestKnownHostsHandlerUpWithPubkey(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	orig := runKeyscan
+	t.Cleanup(func() { runKeyscan = orig })
+	runKeyscan = func(args ...string) ([]byte, error) {
+		t.Fatal("ssh-keyscan must not run when pubkey: is set")
+		return nil, nil
+	}
+
+	pubkey := "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIOMqqnkVzrm0SdG6UOoqKLsabgH5C9okWi0dh2l9GKJl"
+	handler := NewKnownHostsHandler(parser.Rule{Action: "known_hosts", KnownHosts: "git.internal", KnownHostsPubkey: pubkey}, "")
+	if _, err := handler.Up(); err != nil {
+		t.Fatalf("Up() error: %v", err)
+	}
+	if !knownHostPresent("git.internal") {
+		t.Error("host was not written to known_hosts")
+	}
+	if got := handler.GetCommand(); got != "echo 'git.internal "+pubkey+"' >> ~/.ssh/known_hosts" {
+		t.Errorf("GetCommand() = %q", got)
+	}
+
+	status := &Status{}
+	records := []ExecutionRecord{{Status: "success", Command: handler.GetCommand()}}
+	if err := handler.UpdateStatus(status, records, "/tmp/setup.bp", "linux"); err != nil {
+		t.Fatal(err)
+	}
+	if len(status.KnownHosts) != 1 || status.KnownHosts[0].KeyType != "ed25519" {
+		t.Errorf("status.KnownHosts = %+v, want one ed25519 entry", status.KnownHosts)
+	}
+}
+
+func TestKnownHostsHandlerIsSatisfied(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	pubkey := "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIOMqqnkVzrm0SdG6UOoqKLsabgH5C9okWi0dh2l9GKJl"
+	satisfied := func(host, key string) bool {
+		t.Helper()
+		ok, err := NewKnownHostsHandler(parser.Rule{Action: "known_hosts", KnownHosts: host, KnownHostsPubkey: key}, "").IsSatisfied()
+		if err != nil {
+			t.Fatalf("IsSatisfied(%s) error: %v", host, err)
+		}
+		return ok
+	}
+
+	if satisfied("github.com", "") || satisfied("git.internal", pubkey) {
+		t.Error("IsSatisfied() = true without a known_hosts file")
+	}
+
+	if err := os.MkdirAll(filepath.Join(home, ".ssh"), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	data := "github.com ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIOMqqnkVzrm0SdG6UOoqKLsabgH5C9okWi0dh2l9GKJl\n" +
+		"git.internal " + pubkey + "\n"
+	if err := os.WriteFile(filepath.Join(home, ".ssh", "known_hosts"), []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if !satisfied("github.com", "") {
+		t.Error("IsSatisfied() = false for a host in known_hosts")
+	}
+	if satisfied("gitlab.com", "") {
+		t.Error("IsSatisfied() = true for a host missing from known_hosts")
+	}
+	if !satisfied("git.internal", pubkey) {
+		t.Error("IsSatisfied() = false for a host with the pinned key")
+	}
+	if satisfied("git.internal", "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIFrotatedkeyrotatedkeyrotatedkeyrotatedkeyro") {
+		t.Error("IsSatisfied() = true for a host with another key than the pinned one")
+	}
+}
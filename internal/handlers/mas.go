@@ -0,0 +1,429 @@
+package handlers
+
+import (
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/elpic/blueprint/internal/parser"
+	"github.com/elpic/blueprint/internal/ui"
+	"github.com/elpic/blueprint/internal/ui/timeutil"
+)
+
+func init() {
+	RegisterAction(ActionDef{
+		Name:   "mas",
+		Prefix: "mas ",
+		Meta: ActionMeta{
+			Summary: "Install Mac App Store apps with mas.",
+			Usage:   "mas install <app-id|name>...",
+			Examples: []string{
+				"mas install 1295203466",
+				"mas install 497799835 Magnet on: [mac]",
+			},
+			OS:  []string{"mac"},
+			Doc: "mas.md",
+		},
+		NewHandler: func(rule parser.Rule, basePath string, passwordCache map[string]string) Handler {
+			return NewMasHandler(rule, basePath)
+		},
+		RuleKey: func(rule parser.Rule) string {
+			if len(rule.MasApps) > 0 {
+				return "mas-" + rule.MasApps[0]
+			}
+			return "mas"
+		},
+		Detect: func(rule parser.Rule) bool {
+			return len(rule.MasApps) > 0
+		},
+		Summary: func(rule parser.Rule) string {
+			return strings.Join(rule.MasApps, ", ")
+		},
+		OrphanIndex: func(rule parser.Rule, index func(string)) {
+			for _, app := range rule.MasApps {
+				index(app)
+			}
+		},
+		Verify: func(e StatusEntry) bool {
+			s := e.(*MasStatus)
+			installed, err := masInstalledApps()
+			if err != nil {
+				return false
+			}
+			_, ok := installed[s.ID]
+			return ok
+		},
+		ShellExport: func(rule parser.Rule, _, _ string) []string {
+			var lines []string
+			for _, app := range rule.MasApps {
+				if isMasID(app) {
+					lines = append(lines, "mas install "+app)
+				} else {
+					lines = append(lines, fmt.Sprintf(`mas install "$(mas search %s | awk -v name=%s '$2 == name { print $1; exit }')"`, shellQ(app), shellQ(app)))
+				}
+			}
+			return lines
+		},
+	})
+}
+
+// MasHandler installs and uninstalls Mac App Store apps with the mas CLI.
+type MasHandler struct {
+	BaseHandler
+}
+
+// masInstallMutex prevents concurrent mas installation attempts
+var masInstallMutex = &sync.Mutex{}
+
+// NewMasHandler creates a new mas handler
+func NewMasHandler(rule parser.Rule, basePath string) *MasHandler {
+	return &MasHandler{
+		BaseHandler: BaseHandler{
+			Rule:     rule,
+			BasePath: basePath,
+		},
+	}
+}
+
+// masOutput runs a read-only mas command and returns its output.
+var masOutput = func(args ...string) (string, error) {
+	out, err := exec.Command("mas", args...).CombinedOutput() // #nosec G204 -- fixed mas subcommands, app names passed as args
+	return string(out), err
+}
+
+// isMasInstalled reports whether the mas CLI is on PATH.
+var isMasInstalled = func() bool {
+	_, err := cachedLookPath("mas")
+	return err == nil
+}
+
+// isMasID reports whether app is a numeric App Store ID rather than a name.
+func isMasID(app string) bool {
+	_, err := strconv.ParseUint(app, 10, 64)
+	return err == nil
+}
+
+// parseMasApps parses the "<id>  <name>  (<version>)" lines printed by mas
+// list and mas search into a map of ID to name.
+func parseMasApps(out string) map[string]string {
+	apps := map[string]string{}
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || !isMasID(fields[0]) {
+			continue
+		}
+		name := fields[1:]
+		if last := name[len(name)-1]; strings.HasPrefix(last, "(") && strings.HasSuffix(last, ")") && len(name) > 1 {
+			name = name[:len(name)-1]
+		}
+		apps[fields[0]] = strings.Join(name, " ")
+	}
+	return apps
+}
+
+// masInstalledApps returns the App Store apps installed, by ID.
+func masInstalledApps() (map[string]string, error) {
+	out, err := masOutput("list")
+	if err != nil {
+		return nil, fmt.Errorf("mas list failed: %w\n%s", err, out)
+	}
+	return parseMasApps(out), nil
+}
+
+// resolveMasApp returns the App Store ID and name of app. A name must match
+// a search result exactly, ignoring case, so a similarly named app is never
+// installed instead.
+func resolveMasApp(app string) (string, string, error) {
+	if isMasID(app) {
+		return app, app, nil
+	}
+	out, err := masOutput("search", app)
+	if err != nil {
+		return "", "", fmt.Errorf("mas search %s failed: %w\n%s", app, err, out)
+	}
+	for id, name := range parseMasApps(out) {
+		if strings.EqualFold(name, app) {
+			return id, name, nil
+		}
+	}
+	return "", "", fmt.Errorf("no App Store app is named %q; use its numeric ID (see mas search %s)", app, app)
+}
+
+// checkMasSignedIn fails when mas reports that nobody is signed in to the App
+// Store. macOS 12 and later no longer let mas read the account, so anything
+// other than an explicit "not signed in" lets the install go ahead.
+func checkMasSignedIn() error {
+	out, err := masOutput("account")
+	if err != nil && strings.Contains(strings.ToLower(out), "not signed in") {
+		return fmt.Errorf("not signed in to the App Store: open the App Store app, sign in and apply again")
+	}
+	return nil
+}
+
+// ensureMasInstalled installs mas with Homebrew when it is missing.
+func (h *MasHandler) ensureMasInstalled() error {
+	if isMasInstalled() {
+		return nil
+	}
+
+	masInstallMutex.Lock()
+	defer masInstallMutex.Unlock()
+
+	if isMasInstalled() {
+		return nil
+	}
+	if _, err := executeCommandWithCache(brewCmd() + " install mas"); err != nil {
+		return fmt.Errorf("failed to install mas: %w", err)
+	}
+	return nil
+}
+
+// Up installs the apps that are not installed yet
+func (h *MasHandler) Up() (string, error) {
+	if targetOS := getOSName(); targetOS != "mac" {
+		return "", fmt.Errorf("mas is not supported on %s", targetOS)
+	}
+	if err := h.ensureMasInstalled(); err != nil {
+		return "", err
+	}
+	installed, err := masInstalledApps()
+	if err != nil {
+		return "", err
+	}
+
+	var done []string
+	signedIn := false
+	for _, app := range h.Rule.MasApps {
+		id, name, err := resolveMasApp(app)
+		if err != nil {
+			return "", err
+		}
+		if _, ok := installed[id]; ok {
+			done = append(done, fmt.Sprintf("%s already installed", app))
+			continue
+		}
+		if !signedIn {
+			if err := checkMasSignedIn(); err != nil {
+				return "", err
+			}
+			signedIn = true
+		}
+		if _, err := executeCommandWithCache("mas install " + id); err != nil {
+			return "", fmt.Errorf("failed to install %s: %w", app, err)
+		}
+		done = append(done, fmt.Sprintf("installed %s (%s)", name, id))
+	}
+	return strings.Join(done, "\n"), nil
+}
+
+// Down uninstalls the apps. mas uninstall needs sudo, and apps it cannot
+// remove have to be deleted from /Applications by hand.
+func (h *MasHandler) Down() (string, error) {
+	var done []string
+	for _, app := range h.Rule.MasApps {
+		id, _, err := resolveMasApp(app)
+		if err != nil {
+			return "", err
+		}
+		if _, err := executeCommandWithCache("sudo mas uninstall " + id); err != nil {
+			return "", fmt.Errorf("failed to uninstall %s (remove it from /Applications instead): %w", app, err)
+		}
+		done = append(done, "uninstalled "+app)
+	}
+	return strings.Join(done, "\n"), nil
+}
+
+// GetCommand returns the command that represents this rule
+func (h *MasHandler) GetCommand() string {
+	if len(h.Rule.MasApps) == 0 {
+		return ""
+	}
+	if h.Rule.Action == "uninstall" {
+		return "sudo mas uninstall " + strings.Join(h.Rule.MasApps, " ")
+	}
+	return "mas install " + strings.Join(h.Rule.MasApps, " ")
+}
+
+// UpdateStatus records the installed apps, or removes the uninstalled ones
+func (h *MasHandler) UpdateStatus(status *Status, records []ExecutionRecord, blueprint string, osName string) error {
+	blueprint = normalizeBlueprint(blueprint)
+
+	switch h.Rule.Action {
+	case "mas":
+		if _, ok := commandSuccessfullyExecuted(h.GetCommand(), records); !ok {
+			return nil
+		}
+		installed, _ := masInstalledApps()
+		for _, app := range h.Rule.MasApps {
+			id, name := app, app
+			if !isMasID(app) {
+				for appID, appName := range installed {
+					if strings.EqualFold(appName, app) {
+						id, name = appID, appName
+					}
+				}
+			} else if n, ok := installed[app]; ok {
+				name = n
+			}
+			status.MasApps = removeMasStatus(status.MasApps, app, blueprint, osName)
+			status.MasApps = append(status.MasApps, MasStatus{
+				App:         app,
+				ID:          id,
+				Name:        name,
+				InstalledAt: timeutil.Now(),
+				Blueprint:   blueprint,
+				OS:          osName,
+			})
+		}
+	case "uninstall":
+		// Apps removed from the blueprint are uninstalled by ID; the entry
+		// may be keyed by the name it was installed with
+		for _, app := range h.Rule.MasApps {
+			keys := []string{app}
+			for _, s := range status.MasApps {
+				if s.ID == app && s.App != app {
+					keys = append(keys, s.App)
+				}
+			}
+			for _, key := range keys {
+				status.MasApps = removeMasStatus(status.MasApps, key, blueprint, osName)
+			}
+		}
+	}
+
+	return nil
+}
+
+// NeedsSudo returns true for uninstalls, which mas runs as root
+func (h *MasHandler) NeedsSudo() bool {
+	return h.Rule.Action == "uninstall"
+}
+
+// ConcurrencyClass returns "mas" so App Store downloads are queued one at a time
+func (h *MasHandler) ConcurrencyClass() string {
+	return "mas"
+}
+
+// GetDependencyKey returns the unique key for this rule in dependency resolution
+func (h *MasHandler) GetDependencyKey() string {
+	fallback := "mas"
+	if len(h.Rule.MasApps) > 0 {
+		fallback = "mas-" + h.Rule.MasApps[0]
+	}
+	return getDependencyKey(h.Rule, fallback)
+}
+
+// GetDisplayDetails returns the apps to display during execution
+func (h *MasHandler) GetDisplayDetails(isUninstall bool) string {
+	return strings.Join(h.Rule.MasApps, ", ")
+}
+
+// DisplayInfo displays handler-specific information
+func (h *MasHandler) DisplayInfo() {
+	apps := fmt.Sprintf("Apps: [%s]", strings.Join(h.Rule.MasApps, ", "))
+	if h.Rule.Action == "uninstall" {
+		fmt.Printf("  %s\n", ui.FormatDim(apps))
+	} else {
+		fmt.Printf("  %s\n", ui.FormatInfo(apps))
+	}
+}
+
+// DisplayStatusFromStatus displays mas handler status from Status object
+func (h *MasHandler) DisplayStatusFromStatus(status *Status) {
+	if status == nil || status.MasApps == nil {
+		return
+	}
+	h.DisplayStatus(status.MasApps)
+}
+
+// DisplayStatus displays installed App Store app status information
+func (h *MasHandler) DisplayStatus(apps []MasStatus) {
+	if len(apps) == 0 {
+		return
+	}
+
+	rows := make([]statusRow, 0, len(apps))
+	for _, a := range apps {
+		name := a.Name
+		if a.ID != "" && a.ID != a.Name {
+			name = fmt.Sprintf("%s (%s)", a.Name, a.ID)
+		}
+		rows = append(rows, statusRow{
+			name:    name,
+			details: []string{timeutil.Display(a.InstalledAt)},
+			tags:    []string{a.OS, abbreviateBlueprintPath(a.Blueprint)},
+			entry:   &a,
+		})
+	}
+	printStatusSection("Installed App Store Apps:", rows)
+}
+
+// GetState returns handler-specific state as key-value pairs
+func (h *MasHandler) GetState(isUninstall bool) map[string]string {
+	apps := h.GetDisplayDetails(isUninstall)
+	return map[string]string{
+		"summary": apps,
+		"apps":    apps,
+	}
+}
+
+// FindUninstallRules compares mas status against current rules and returns
+// uninstall rules. Apps are uninstalled by the ID recorded at install, so an
+// app installed by name does not need to be searched for again.
+func (h *MasHandler) FindUninstallRules(status *Status, currentRules []parser.Rule, blueprintFile, osName string) []parser.Rule {
+	normalizedBlueprint := normalizeBlueprint(blueprintFile)
+
+	currentApps := make(map[string]bool)
+	for _, rule := range currentRules {
+		if rule.Action == "mas" {
+			for _, app := range rule.MasApps {
+				currentApps[app] = true
+			}
+		}
+	}
+
+	var appsToUninstall []string
+	for _, a := range status.MasApps {
+		if normalizeBlueprint(a.Blueprint) == normalizedBlueprint && a.OS == osName && !currentApps[a.App] {
+			if a.ID != "" {
+				appsToUninstall = append(appsToUninstall, a.ID)
+			} else {
+				appsToUninstall = append(appsToUninstall, a.App)
+			}
+		}
+	}
+
+	var rules []parser.Rule
+	if len(appsToUninstall) > 0 {
+		rules = append(rules, parser.Rule{
+			Action:  "uninstall",
+			MasApps: appsToUninstall,
+			OSList:  []string{osName},
+		})
+	}
+	return rules
+}
+
+// IsInstalled returns true if all apps in this rule are already in status.
+func (h *MasHandler) IsInstalled(status *Status, blueprintFile, osName string) bool {
+	normalizedBlueprint := normalizeBlueprint(blueprintFile)
+	for _, app := range h.Rule.MasApps {
+		found := false
+		for _, s := range status.MasApps {
+			if s.App == app && normalizeBlueprint(s.Blueprint) == normalizedBlueprint && s.OS == osName {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func removeMasStatus(sl []MasStatus, app, blueprint, osName string) []MasStatus {
+	return removeStatusEntry[MasStatus, *MasStatus](sl, app, blueprint, osName)
+}
@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/elpic/blueprint/internal/parser"
+)
+
+const masListOutput = `  497799835  Xcode                (15.4)
+ 1295203466  Microsoft Remote Desktop  (10.9.8)
+`
+
+// stubMas replaces the mas CLI with canned output for each subcommand and
+// records the commands run through the executor.
+func stubMas(t *testing.T, outputs map[string]string) *[]string {
+	t.Helper()
+	origOutput, origInstalled, origOS, origExecutor := masOutput, isMasInstalled, getOSName, commandExecutor
+	t.Cleanup(func() {
+		masOutput, isMasInstalled, getOSName, commandExecutor = origOutput, origInstalled, origOS, origExecutor
+	})
+
+	masOutput = func(args ...string) (string, error) {
+		out, ok := outputs[strings.Join(args, " ")]
+		if !ok {
+			return "unexpected command", errMasStub
+		}
+		if strings.Contains(out, "Not signed in") {
+			return out, errMasStub
+		}
+		return out, nil
+	}
+	isMasInstalled = func() bool { return true }
+	getOSName = func() string { return "mac" }
+	var ran []string
+	commandExecutor = &customMockExecutor{executeFunc: func(cmd string) (string, error) {
+		ran = append(ran, cmd)
+		return "", nil
+	}}
+	return &ran
+}
+
+var errMasStub = errors.New("exit status 1")
+
+func TestParseMasApps(t *testing.T) {
+	apps := parseMasApps(masListOutput)
+	if apps["497799835"] != "Xcode" || apps["1295203466"] != "Microsoft Remote Desktop" {
+		t.Errorf("parseMasApps() = %v", apps)
+	}
+}
+
+func TestMasHandlerUp(t *testing.T) {
+	ran := stubMas(t, map[string]string{
+		"list":          masListOutput,
+		"search magnet": "  441258766  Magnet  (2.14)\n  123456789  Magnet Pro  (1.0)\n",
+		"account":       "someone@example.com\n",
+	})
+
+	h := NewMasHandler(parser.Rule{Action: "mas", MasApps: []string{"497799835", "magnet"}}, "")
+	out, err := h.Up()
+	if err != nil {
+		t.Fatalf("Up() error: %v", err)
+	}
+	if strings.Join(*ran, ";") != "mas install 441258766" {
+		t.Errorf("ran %v, want only the missing app installed by ID", *ran)
+	}
+	if !strings.Contains(out, "497799835 already installed") {
+		t.Errorf("Up() output = %q", out)
+	}
+}
+
+func TestMasHandlerUpNotSignedIn(t *testing.T) {
+	ran := stubMas(t, map[string]string{
+		"list":    "",
+		"account": "Error: Not signed in\n",
+	})
+
+	_, err := NewMasHandler(parser.Rule{Action: "mas", MasApps: []string{"497799835"}}, "").Up()
+	if err == nil || !strings.Contains(err.Error(), "sign in") {
+		t.Errorf("Up() error = %v, want a sign-in error", err)
+	}
+	if len(*ran) != 0 {
+		t.Errorf("ran %v, want nothing installed", *ran)
+	}
+}
+
+func TestMasHandlerUnknownName(t *testing.T) {
+	stubMas(t, map[string]string{
+		"list":          "",
+		"search Magnet": "  123456789  Magnet Pro  (1.0)\n",
+	})
+
+	_, err := NewMasHandler(parser.Rule{Action: "mas", MasApps: []string{"Magnet"}}, "").Up()
+	if err == nil || !strings.Contains(err.Error(), "numeric ID") {
+		t.Errorf("Up() error = %v, want a name that only partly matches to be refused", err)
+	}
+}
+
+func TestMasHandlerStatusAndUninstall(t *testing.T) {
+	stubMas(t, map[string]string{"list": masListOutput})
+
+	rule := parser.Rule{Action: "mas", MasApps: []string{"xcode", "1295203466"}}
+	h := NewMasHandler(rule, "")
+	status := &Status{}
+	records := []ExecutionRecord{{Command: h.GetCommand(), Status: "success"}}
+	if err := h.UpdateStatus(status, records, "/tmp/setup.bp", "mac"); err != nil {
+		t.Fatal(err)
+	}
+	if len(status.MasApps) != 2 || status.MasApps[0].ID != "497799835" || status.MasApps[0].Name != "Xcode" {
+		t.Fatalf("status = %+v, want the name resolved to its ID", status.MasApps)
+	}
+	if !h.IsInstalled(status, "/tmp/setup.bp", "mac") {
+		t.Error("IsInstalled() = false after UpdateStatus")
+	}
+
+	uninstall := h.FindUninstallRules(status, []parser.Rule{{Action: "mas", MasApps: []string{"1295203466"}}}, "/tmp/setup.bp", "mac")
+	if len(uninstall) != 1 || strings.Join(uninstall[0].MasApps, ",") != "497799835" {
+		t.Fatalf("FindUninstallRules() = %+v, want Xcode by ID", uninstall)
+	}
+	down := NewMasHandler(uninstall[0], "")
+	if got := down.GetCommand(); got != "sudo mas uninstall 497799835" {
+		t.Errorf("GetCommand() = %q", got)
+	}
+	if err := down.UpdateStatus(status, nil, "/tmp/setup.bp", "mac"); err != nil {
+		t.Fatal(err)
+	}
+	if len(status.MasApps) != 1 || status.MasApps[0].App != "1295203466" {
+		t.Errorf("status after uninstall = %+v, want the entry keyed by name removed", status.MasApps)
+	}
+}
+
+func TestParseMasRuleInRegistry(t *testing.T) {
+	rule, err := parser.ParseMasRule("mas install 497799835 Magnet on: [mac]")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if DetectRuleType(*rule) != "mas" || RuleKey(*rule) != "mas-497799835" {
+		t.Errorf("DetectRuleType() = %q, RuleKey() = %q", DetectRuleType(*rule), RuleKey(*rule))
+	}
+}
@@ -7,10 +7,11 @@ import (
 	"path/filepath"
 	"runtime"
 	"strings"
-	"time"
 
+	"github.com/elpic/blueprint/internal"
 	"github.com/elpic/blueprint/internal/parser"
 	"github.com/elpic/blueprint/internal/ui"
+	"github.com/elpic/blueprint/internal/ui/timeutil"
 )
 
 // isMiseVersionInstalled returns true if the given tool@version is already installed.
@@ -30,7 +31,7 @@ var miseInstalledCheck = func() bool {
 			return true
 		}
 	}
-	_, err = exec.LookPath("mise")
+	_, err = cachedLookPath("mise")
 	return err == nil
 }
 
@@ -38,6 +39,21 @@ func init() {
 	RegisterAction(ActionDef{
 		Name:   "mise",
 		Prefix: "mise",
+		Meta: ActionMeta{
+			Summary: "Install tool versions with mise, globally or for a project.",
+			Usage:   "mise <tool@version>... [path: <dir>] [shell: <shell>]",
+			Attrs: []AttrMeta{
+				{Name: "path", Type: "path", Description: "Project directory for a local (non-global) install"},
+				shellAttr,
+			},
+			Examples: []string{
+				"mise node@20 python@3.12",
+				"mise go@1.22 path: ~/code/api",
+				"mise install ruby@3.3",
+			},
+			OS:  []string{"mac", "linux"},
+			Doc: "mise.md",
+		},
 		NewHandler: func(rule parser.Rule, basePath string, passwordCache map[string]string) Handler {
 			return NewMiseHandler(rule, basePath)
 		},
@@ -153,6 +169,9 @@ func (h *MiseHandler) installMiseLinux() error {
 		return fmt.Errorf("failed to create ~/.local/bin: %w", err)
 	}
 
+	if err := checkRemoteScriptAllowed("installing mise", "https://mise.run"); err != nil {
+		return err
+	}
 	installCmd := "curl https://mise.run | sh"
 	if _, err := executeCommandWithCache(installCmd); err != nil {
 		return fmt.Errorf("failed to install mise: %w", err)
@@ -183,15 +202,11 @@ func (h *MiseHandler) isGlobal() bool {
 
 // resolvedMisePath expands ~ in MisePath to the actual home directory
 func (h *MiseHandler) resolvedMisePath() (string, error) {
-	p := h.Rule.MisePath
-	if strings.HasPrefix(p, "~/") {
-		homeDir, err := os.UserHomeDir()
-		if err != nil {
-			return "", fmt.Errorf("failed to get home directory: %w", err)
-		}
-		p = filepath.Join(homeDir, p[2:])
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %w", err)
 	}
-	return p, nil
+	return internal.ExpandHome(h.Rule.MisePath, homeDir), nil
 }
 
 // Up installs mise (if not present) and then installs specified tool versions
@@ -259,9 +274,10 @@ func (h *MiseHandler) Up() (string, error) {
 	if len(allCmds) > 0 {
 		homeDir, _ := os.UserHomeDir()
 		localBin := filepath.Join(homeDir, ".local", "bin")
-		combinedCmd := strings.Join(allCmds, " && ")
-		fullCmd := fmt.Sprintf(`export PATH="%s:$PATH" && %s`, localBin, combinedCmd)
-		cmd := exec.Command("bash", "-c", fullCmd)
+		// PATH is set through the environment rather than the script so the
+		// commands work in any shell
+		cmd := shellExec(ruleShell(h.Rule), strings.Join(allCmds, " && "))
+		cmd.Env = append(os.Environ(), "PATH="+localBin+string(os.PathListSeparator)+os.Getenv("PATH"))
 		cmd.Stdin = nil
 
 		if !global {
@@ -321,7 +337,7 @@ func (h *MiseHandler) Down() (string, error) {
 			}
 			uninstallCmd = fmt.Sprintf("%s uninstall %s", miseBin, tool)
 		}
-		cmd := exec.Command("sh", "-c", uninstallCmd)
+		cmd := shellExec(ruleShell(h.Rule), uninstallCmd)
 		if projectPath != "" {
 			cmd.Dir = projectPath
 		}
@@ -331,7 +347,7 @@ func (h *MiseHandler) Down() (string, error) {
 	// Only auto-remove mise itself for global installs with no remaining tools
 	if h.isGlobal() {
 		checkCmd := fmt.Sprintf("%s ls 2>/dev/null | wc -l", miseBin)
-		output, err := exec.Command("sh", "-c", checkCmd).Output()
+		output, err := shellExec(ruleShell(h.Rule), checkCmd).Output()
 		if err == nil {
 			toolCount := 0
 			_, _ = fmt.Sscanf(strings.TrimSpace(string(output)), "%d", &toolCount)
@@ -405,7 +421,7 @@ func (h *MiseHandler) UpdateStatus(status *Status, records []ExecutionRecord, bl
 					status.Mises = append(status.Mises, MiseStatus{
 						Tool:        tool,
 						Version:     version,
-						InstalledAt: time.Now().Format(time.RFC3339),
+						InstalledAt: timeutil.Now(),
 						Blueprint:   blueprint,
 						OS:          osName,
 					})
@@ -461,26 +477,16 @@ func (h *MiseHandler) DisplayStatusFromStatus(status *Status) {
 	}
 
 	if len(status.Mises) > 0 {
-		fmt.Printf("\n%s\n", ui.FormatHighlight("Mise Version Manager:"))
-
+		rows := make([]statusRow, 0, len(status.Mises))
 		for _, mise := range status.Mises {
-			t, err := time.Parse(time.RFC3339, mise.InstalledAt)
-			var timeStr string
-			if err == nil {
-				timeStr = t.Format("2006-01-02 15:04:05")
-			} else {
-				timeStr = mise.InstalledAt
-			}
-
-			toolVersion := fmt.Sprintf("%s@%s", mise.Tool, mise.Version)
-			fmt.Printf("  %s %s (%s) [%s, %s]\n",
-				ui.FormatSuccess("●"),
-				ui.FormatInfo(toolVersion),
-				ui.FormatDim(timeStr),
-				ui.FormatDim(mise.OS),
-				ui.FormatDim(abbreviateBlueprintPath(mise.Blueprint)),
-			)
+			rows = append(rows, statusRow{
+				name:    fmt.Sprintf("%s@%s", mise.Tool, mise.Version),
+				details: []string{timeutil.Display(mise.InstalledAt)},
+				tags:    []string{mise.OS, abbreviateBlueprintPath(mise.Blueprint)},
+				entry:   &mise,
+			})
 		}
+		printStatusSection("Mise Version Manager:", rows)
 	}
 }
 
@@ -4,20 +4,33 @@ import (
 	"fmt"
 	"github.com/elpic/blueprint/internal"
 	"os"
-	"path/filepath"
 	"regexp"
 	"strings"
-	"time"
 
 	"github.com/elpic/blueprint/internal/parser"
 	"github.com/elpic/blueprint/internal/platform"
 	"github.com/elpic/blueprint/internal/ui"
+	"github.com/elpic/blueprint/internal/ui/timeutil"
 )
 
 func init() {
 	RegisterAction(ActionDef{
 		Name:   "mkdir",
 		Prefix: "mkdir ",
+		Meta: ActionMeta{
+			Summary: "Create a directory.",
+			Usage:   "mkdir <path> [permissions: <octal>]",
+			Attrs: []AttrMeta{
+				{Name: "permissions", Type: "octal", Description: "Octal permissions, e.g. 755"},
+				{Name: "perms", Type: "octal", Description: "Short form of permissions:"},
+			},
+			Examples: []string{
+				"mkdir ~/code",
+				"mkdir ~/.ssh permissions: 700",
+			},
+			OS:  []string{"mac", "linux"},
+			Doc: "mkdir.md",
+		},
 		NewHandler: func(rule parser.Rule, basePath string, passwordCache map[string]string) Handler {
 			return NewMkdirHandler(rule, basePath, platform.NewContainer())
 		},
@@ -33,6 +46,9 @@ func init() {
 		OrphanIndex: func(rule parser.Rule, index func(string)) {
 			index(rule.Mkdir)
 		},
+		Verify: func(e StatusEntry) bool {
+			return pathExists(expandPath(e.(*MkdirStatus).Path))
+		},
 		ShellExport: func(rule parser.Rule, _, _ string) []string {
 			path := shellHome(rule.Mkdir)
 			lines := []string{fmt.Sprintf("mkdir -p %s", path)}
@@ -161,20 +177,14 @@ func (h *MkdirHandler) UpdateStatus(status *Status, records []ExecutionRecord, b
 			// Add new entry
 			status.Mkdirs = append(status.Mkdirs, MkdirStatus{
 				Path:      h.Rule.Mkdir,
-				CreatedAt: time.Now().Format(time.RFC3339),
+				CreatedAt: timeutil.Now(),
 				Blueprint: blueprint,
 				OS:        osName,
 			})
 		}
 	} else if h.Rule.Action == "uninstall" && DetectRuleType(h.Rule) == "mkdir" {
 		// Check if mkdir was uninstalled successfully by checking if the directory no longer exists
-		expandedPath := h.Rule.Mkdir
-		if strings.HasPrefix(expandedPath, "~") {
-			homeDir, err := os.UserHomeDir()
-			if err == nil {
-				expandedPath = filepath.Join(homeDir, expandedPath[1:])
-			}
-		}
+		expandedPath := expandPath(h.Rule.Mkdir)
 
 		// If directory doesn't exist, remove from status
 		if _, err := os.Stat(expandedPath); os.IsNotExist(err) {
@@ -192,9 +202,9 @@ func (h *MkdirHandler) DisplayInfo() {
 		formatFunc = ui.FormatDim
 	}
 
-	fmt.Printf("  %s\n", formatFunc(fmt.Sprintf("Path: %s", h.Rule.Mkdir)))
+	printInfo(formatFunc, "Path", h.Rule.Mkdir)
 	if h.Rule.MkdirPerms != "" {
-		fmt.Printf("  %s\n", formatFunc(fmt.Sprintf("Permissions: %s", h.Rule.MkdirPerms)))
+		printInfo(formatFunc, "Permissions", h.Rule.MkdirPerms)
 	}
 }
 
@@ -238,25 +248,16 @@ func (h *MkdirHandler) DisplayStatus(mkdirs []MkdirStatus) {
 		return
 	}
 
-	fmt.Printf("\n%s\n", ui.FormatHighlight("Created Directories:"))
+	rows := make([]statusRow, 0, len(mkdirs))
 	for _, mkdir := range mkdirs {
-		// Parse timestamp for display
-		t, err := time.Parse(time.RFC3339, mkdir.CreatedAt)
-		var timeStr string
-		if err == nil {
-			timeStr = t.Format("2006-01-02 15:04:05")
-		} else {
-			timeStr = mkdir.CreatedAt
-		}
-
-		fmt.Printf("  %s %s (%s) [%s, %s]\n",
-			ui.FormatSuccess("●"),
-			ui.FormatInfo(mkdir.Path),
-			ui.FormatDim(timeStr),
-			ui.FormatDim(mkdir.OS),
-			ui.FormatDim(abbreviateBlueprintPath(mkdir.Blueprint)),
-		)
+		rows = append(rows, statusRow{
+			name:    mkdir.Path,
+			details: []string{timeutil.Display(mkdir.CreatedAt)},
+			tags:    []string{mkdir.OS, abbreviateBlueprintPath(mkdir.Blueprint)},
+			entry:   &mkdir,
+		})
 	}
+	printStatusSection("Created Directories:", rows)
 }
 
 // DisplayStatusFromStatus displays mkdir handler status from Status object
@@ -329,3 +330,24 @@ func (h *MkdirHandler) IsInstalled(status *Status, blueprintFile, osName string)
 	}
 	return false
 }
+
+// IsSatisfied reports whether the directory exists, with the permissions
+// the rule asks for when it sets any.
+func (h *MkdirHandler) IsSatisfied() (bool, error) {
+	info, err := os.Stat(expandPath(h.Rule.Mkdir))
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if !info.IsDir() {
+		return false, nil
+	}
+	if h.Rule.MkdirPerms != "" {
+		var octal int
+		_, _ = fmt.Sscanf(h.Rule.MkdirPerms, "%o", &octal)
+		return info.Mode().Perm() == os.FileMode(octal), nil
+	}
+	return true, nil
+}
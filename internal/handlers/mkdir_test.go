@@ -369,3 +369,51 @@ func TestMkdirHandlerGetDependencyKey(t *testing.T) {
 		})
 	}
 }
+
+func TestMkdirHandlerIsSatisfied(t *testing.T) {
+	tmpDir := t.TempDir()
+	existing := filepath.Join(tmpDir, "existing")
+	if err := os.Mkdir(existing, 0750); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		rule     parser.Rule
+		expected bool
+	}{
+		{
+			name:     "directory exists",
+			rule:     parser.Rule{Action: "mkdir", Mkdir: existing},
+			expected: true,
+		},
+		{
+			name:     "directory exists with matching permissions",
+			rule:     parser.Rule{Action: "mkdir", Mkdir: existing, MkdirPerms: "750"},
+			expected: true,
+		},
+		{
+			name:     "directory exists with other permissions",
+			rule:     parser.Rule{Action: "mkdir", Mkdir: existing, MkdirPerms: "700"},
+			expected: false,
+		},
+		{
+			name:     "directory missing",
+			rule:     parser.Rule{Action: "mkdir", Mkdir: filepath.Join(tmpDir, "missing")},
+			expected: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := NewMkdirHandlerLegacy(tt.rule, "")
+			got, err := handler.IsSatisfied()
+			if err != nil {
+				t.Fatalf("IsSatisfied() error: %v", err)
+			}
+			if got != tt.expected {
+				t.Errorf("IsSatisfied() = %v, want %v", got, tt.expected)
+			}
+		})
+	}
+}
@@ -5,16 +5,27 @@ import (
 	"os/exec"
 	"strings"
 	"sync"
-	"time"
 
 	"github.com/elpic/blueprint/internal/parser"
 	"github.com/elpic/blueprint/internal/ui"
+	"github.com/elpic/blueprint/internal/ui/timeutil"
 )
 
 func init() {
 	RegisterAction(ActionDef{
 		Name:   "ollama",
 		Prefix: "ollama",
+		Meta: ActionMeta{
+			Summary: "Pull local LLM models with Ollama.",
+			Usage:   "ollama <model>... [jobs: <n>]",
+			Attrs:   []AttrMeta{jobsAttr},
+			Examples: []string{
+				"ollama llama3 codellama:7b",
+				"ollama llama3 mistral phi3 gemma jobs: 2",
+			},
+			OS:  []string{"mac", "linux"},
+			Doc: "ollama.md",
+		},
 		NewHandler: func(rule parser.Rule, basePath string, passwordCache map[string]string) Handler {
 			return NewOllamaHandler(rule, basePath)
 		},
@@ -76,7 +87,13 @@ func (h *OllamaHandler) Up() (string, error) {
 		return "", fmt.Errorf("failed to ensure ollama is installed: %w", err)
 	}
 
-	// Then pull the models
+	// Then pull the models, each on its own with jobs:
+	if h.Rule.Jobs > 0 {
+		return runTargets(h.Rule.OllamaModels, h.Rule.Jobs, func(model string) error {
+			_, err := executeCommandWithCache("ollama pull " + model)
+			return err
+		})
+	}
 	cmd := h.buildCommand()
 	if cmd == "" {
 		return "", fmt.Errorf("unable to build install command")
@@ -112,17 +129,13 @@ func (h *OllamaHandler) UpdateStatus(status *Status, records []ExecutionRecord,
 
 	switch h.Rule.Action {
 	case "ollama":
-		cmd := h.buildCommand()
-		_, commandExecuted := commandSuccessfullyExecuted(cmd, records)
-		if !commandExecuted {
-			return nil // command failed or didn't run — don't update status
-		}
-
-		for _, model := range h.Rule.OllamaModels {
+		// Only the models that were pulled: with jobs:, a failed rule may
+		// still have pulled some of them
+		for _, model := range succeededTargets(h.buildCommand(), records, h.Rule.OllamaModels) {
 			status.Ollamas = removeOllamaStatus(status.Ollamas, model, blueprint, osName)
 			status.Ollamas = append(status.Ollamas, OllamaStatus{
 				Model:       model,
-				InstalledAt: time.Now().Format(time.RFC3339),
+				InstalledAt: timeutil.Now(),
 				Blueprint:   blueprint,
 				OS:          osName,
 			})
@@ -150,6 +163,9 @@ func (h *OllamaHandler) ensureOllamaInstalled() error {
 		return nil
 	}
 
+	if err := checkRemoteScriptAllowed("installing ollama", "https://ollama.com/install.sh"); err != nil {
+		return err
+	}
 	installCmd := "curl -fsSL https://ollama.com/install.sh | sh"
 	if _, err := executeCommandWithCache(installCmd); err != nil {
 		return fmt.Errorf("failed to install ollama: %w", err)
@@ -232,24 +248,16 @@ func (h *OllamaHandler) DisplayStatus(ollamas []OllamaStatus) {
 		return
 	}
 
-	fmt.Printf("\n%s\n", ui.FormatHighlight("Installed Ollama Models:"))
+	rows := make([]statusRow, 0, len(ollamas))
 	for _, o := range ollamas {
-		t, err := time.Parse(time.RFC3339, o.InstalledAt)
-		var timeStr string
-		if err == nil {
-			timeStr = t.Format("2006-01-02 15:04:05")
-		} else {
-			timeStr = o.InstalledAt
-		}
-
-		fmt.Printf("  %s %s (%s) [%s, %s]\n",
-			ui.FormatSuccess("●"),
-			ui.FormatInfo(o.Model),
-			ui.FormatDim(timeStr),
-			ui.FormatDim(o.OS),
-			ui.FormatDim(abbreviateBlueprintPath(o.Blueprint)),
-		)
+		rows = append(rows, statusRow{
+			name:    o.Model,
+			details: []string{timeutil.Display(o.InstalledAt)},
+			tags:    []string{o.OS, abbreviateBlueprintPath(o.Blueprint)},
+			entry:   &o,
+		})
 	}
+	printStatusSection("Installed Ollama Models:", rows)
 }
 
 // GetState returns handler-specific state as key-value pairs
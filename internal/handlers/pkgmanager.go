@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+
+	"github.com/elpic/blueprint/internal/platform"
+)
+
+// linuxPackageManager holds the commands the install rule runs for one
+// Linux package manager. Package names are appended to each of them.
+type linuxPackageManager struct {
+	name    string
+	install string
+	remove  string
+	query   string // exits 0 when the one package appended is installed
+	// installed, when set, must also appear in the output of query: dpkg
+	// knows removed packages too and only their status tells them apart.
+	installed string
+}
+
+var linuxPackageManagers = map[string]linuxPackageManager{
+	"apt":    {name: "apt", install: "apt-get install -y", remove: "apt-get remove -y", query: "dpkg-query -W -f=${Status}", installed: "install ok installed"},
+	"dnf":    {name: "dnf", install: "dnf install -y", remove: "dnf remove -y", query: "rpm -q"},
+	"yum":    {name: "yum", install: "yum install -y", remove: "yum remove -y", query: "rpm -q"},
+	"pacman": {name: "pacman", install: "pacman -S --noconfirm --needed", remove: "pacman -R --noconfirm", query: "pacman -Q"},
+	"zypper": {name: "zypper", install: "zypper --non-interactive install", remove: "zypper --non-interactive remove", query: "rpm -q"},
+	"apk":    {name: "apk", install: "apk add", remove: "apk del", query: "apk info -e"},
+}
+
+// distroPackageManagers maps the ID and ID_LIKE values of /etc/os-release to
+// the package manager of the distro.
+var distroPackageManagers = map[string]string{
+	"debian":   "apt",
+	"ubuntu":   "apt",
+	"fedora":   "dnf",
+	"rhel":     "dnf",
+	"centos":   "dnf",
+	"arch":     "pacman",
+	"opensuse": "zypper",
+	"suse":     "zypper",
+	"sles":     "zypper",
+	"alpine":   "apk",
+}
+
+// packageManagerBinaries is the order package managers are looked for on
+// PATH when /etc/os-release names no distro blueprint knows.
+var packageManagerBinaries = []struct{ binary, name string }{
+	{"apt-get", "apt"},
+	{"dnf", "dnf"},
+	{"yum", "yum"},
+	{"pacman", "pacman"},
+	{"zypper", "zypper"},
+	{"apk", "apk"},
+}
+
+// lookupLinuxPackageManager returns the entry for a package-manager: value,
+// accepting apt-get for apt.
+func lookupLinuxPackageManager(name string) (linuxPackageManager, bool) {
+	if name == "apt-get" {
+		name = "apt"
+	}
+	pm, ok := linuxPackageManagers[name]
+	return pm, ok
+}
+
+// detectLinuxPackageManager returns the package manager of the running
+// distro: the one its /etc/os-release ID or ID_LIKE names, else the first
+// one found on PATH, else apt. Distros of the Red Hat family that predate
+// dnf get yum.
+func detectLinuxPackageManager(system platform.SystemProvider) linuxPackageManager {
+	process := system.Process()
+	if data, err := system.Filesystem().ReadFile("/etc/os-release"); err == nil {
+		release := parseOSRelease(data)
+		for _, id := range strings.Fields(release["ID"] + " " + release["ID_LIKE"]) {
+			name, ok := distroPackageManagers[id]
+			if !ok {
+				continue
+			}
+			if name == "dnf" && !process.IsCommandAvailable("dnf") && process.IsCommandAvailable("yum") {
+				name = "yum"
+			}
+			return linuxPackageManagers[name]
+		}
+	}
+	for _, b := range packageManagerBinaries {
+		if process.IsCommandAvailable(b.binary) {
+			return linuxPackageManagers[b.name]
+		}
+	}
+	return linuxPackageManagers["apt"]
+}
+
+// parseOSRelease returns the key/value pairs of an os-release file.
+func parseOSRelease(data []byte) map[string]string {
+	values := map[string]string{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), "=")
+		if ok {
+			values[key] = strings.Trim(value, `"'`)
+		}
+	}
+	return values
+}
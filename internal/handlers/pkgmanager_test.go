@@ -0,0 +1,138 @@
+package handlers
+
+import (
+	"testing"
+
+	"github.com/elpic/blueprint/internal/parser"
+	"github.com/elpic/blueprint/internal/platform"
+	"github.com/elpic/blueprint/internal/platform/mocks"
+)
+
+// linuxSystem returns a mock Linux system with the given /etc/os-release
+// (none when empty) and only the listed commands on PATH.
+func linuxSystem(osRelease string, commands ...string) *mocks.MockSystemProvider {
+	system := mocks.NewMockSystemProvider().WithOS("linux")
+	if osRelease != "" {
+		system.WithFile("/etc/os-release", []byte(osRelease))
+	}
+	process := system.Process().(*mocks.MockProcessExecutor)
+	for _, b := range packageManagerBinaries {
+		process.WithCommandAvailable(b.binary, false)
+	}
+	for _, c := range commands {
+		process.WithCommandAvailable(c, true)
+	}
+	return system
+}
+
+func TestDetectLinuxPackageManager(t *testing.T) {
+	tests := []struct {
+		name      string
+		osRelease string
+		commands  []string
+		want      string
+	}{
+		{"debian", "ID=debian\n", nil, "apt"},
+		{"ubuntu via ID_LIKE", "ID=pop\nID_LIKE=\"ubuntu debian\"\n", nil, "apt"},
+		{"fedora", "ID=fedora\n", []string{"dnf"}, "dnf"},
+		{"rocky without dnf", "ID=\"rocky\"\nID_LIKE=\"rhel centos fedora\"\n", []string{"yum"}, "yum"},
+		{"arch", "ID=arch\n", nil, "pacman"},
+		{"opensuse", "ID=\"opensuse-tumbleweed\"\nID_LIKE=\"opensuse suse\"\n", nil, "zypper"},
+		{"alpine", "ID=alpine\n", nil, "apk"},
+		{"unknown distro found on PATH", "ID=something\n", []string{"pacman"}, "pacman"},
+		{"no os-release found on PATH", "", []string{"apk"}, "apk"},
+		{"nothing known", "", nil, "apt"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := detectLinuxPackageManager(linuxSystem(tt.osRelease, tt.commands...))
+			if got.name != tt.want {
+				t.Errorf("detectLinuxPackageManager() = %q, want %q", got.name, tt.want)
+			}
+		})
+	}
+}
+
+func TestInstallCommandUsesDetectedPackageManager(t *testing.T) {
+	tests := []struct {
+		name          string
+		osRelease     string
+		manager       string
+		wantInstall   string
+		wantUninstall string
+	}{
+		{"fedora", "ID=fedora\n", "", "sudo dnf install -y git", "sudo dnf remove -y git"},
+		{"arch", "ID=arch\n", "", "sudo pacman -S --noconfirm --needed git", "sudo pacman -R --noconfirm git"},
+		{"alpine", "ID=alpine\n", "", "sudo apk add git", "sudo apk del git"},
+		{"pm override", "ID=debian\n", "zypper", "sudo zypper --non-interactive install git", "sudo zypper --non-interactive remove git"},
+		{"explicit apt on fedora", "ID=fedora\n", "apt", "sudo apt-get install -y git", "sudo apt-get remove -y git"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			container := platform.NewTestContainer().WithSystemProvider(linuxSystem(tt.osRelease)).Build()
+			rule := parser.Rule{Action: "install", Packages: []parser.Package{{Name: "git", PackageManager: tt.manager}}}
+			h := NewInstallHandler(rule, "", container)
+			if got := h.buildCommand(); got != tt.wantInstall {
+				t.Errorf("buildCommand() = %q, want %q", got, tt.wantInstall)
+			}
+			if got := h.buildUninstallCommand(rule); got != tt.wantUninstall {
+				t.Errorf("buildUninstallCommand() = %q, want %q", got, tt.wantUninstall)
+			}
+		})
+	}
+}
+
+func TestInstallConcurrencyClassUsesDetectedPackageManager(t *testing.T) {
+	container := platform.NewTestContainer().WithSystemProvider(linuxSystem("ID=fedora\n", "dnf")).Build()
+	rule := parser.Rule{Action: "install", Packages: []parser.Package{{Name: "code", PackageManager: "snap"}, {Name: "git"}}}
+	if got := NewInstallHandler(rule, "", container).ConcurrencyClass(); got != "dnf" {
+		t.Errorf("ConcurrencyClass() = %q, want dnf", got)
+	}
+}
+
+func TestInstallIsSatisfied(t *testing.T) {
+	satisfied := func(system *mocks.MockSystemProvider, packages ...parser.Package) bool {
+		t.Helper()
+		container := platform.NewTestContainer().WithSystemProvider(system).Build()
+		ok, err := NewInstallHandler(parser.Rule{Action: "install", Packages: packages}, "", container).IsSatisfied()
+		if err != nil {
+			t.Fatalf("IsSatisfied() error: %v", err)
+		}
+		return ok
+	}
+	git, curl := parser.Package{Name: "git"}, parser.Package{Name: "curl"}
+	// debian answers the dpkg query of each package with its status; dpkg
+	// fails for a package it does not know, given as ""
+	debian := func(statuses map[string]string) *mocks.MockSystemProvider {
+		system := linuxSystem("ID=debian\n")
+		container := platform.NewTestContainer().WithSystemProvider(system).Build()
+		h := NewInstallHandler(parser.Rule{Action: "install"}, "", container)
+		for name, status := range statuses {
+			query, _ := h.packageQuery(parser.Package{Name: name}, "linux")
+			result := &platform.ExecuteResult{Success: true, Stdout: status}
+			if status == "" {
+				result = &platform.ExecuteResult{ExitCode: 1}
+			}
+			system.WithCommandResult(query, result)
+		}
+		return system
+	}
+
+	installed := debian(map[string]string{"git": "install ok installed", "curl": "install ok installed"})
+	if !satisfied(installed, git, curl) {
+		t.Error("IsSatisfied() = false with every package installed")
+	}
+	if satisfied(debian(map[string]string{"git": "install ok installed", "curl": ""}), git, curl) {
+		t.Error("IsSatisfied() = true with curl not installed")
+	}
+	if satisfied(debian(map[string]string{"git": "install ok installed", "curl": "deinstall ok config-files"}), git, curl) {
+		t.Error("IsSatisfied() = true with only the config files of curl left")
+	}
+
+	if satisfied(installed, parser.Package{Name: "git", Version: "2.44.0"}) {
+		t.Error("IsSatisfied() = true for a package pinned to a version")
+	}
+	if satisfied(installed) {
+		t.Error("IsSatisfied() = true for a rule without packages")
+	}
+}
@@ -0,0 +1,160 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// Package managers expose machine-readable output for installed-package
+// queries. Parsing it is far more reliable than scraping the human-readable
+// `brew list` / `apt list` text, whose format changes between releases and
+// mixes warnings into stdout.
+
+// brewInfoJSON is the subset of `brew info --json=v2` output blueprint reads.
+type brewInfoJSON struct {
+	Formulae []struct {
+		Name     string `json:"name"`
+		FullName string `json:"full_name"`
+		Versions struct {
+			Stable string `json:"stable"`
+		} `json:"versions"`
+		Revision  int `json:"revision"`
+		Installed []struct {
+			Version string `json:"version"`
+		} `json:"installed"`
+	} `json:"formulae"`
+	Casks []struct {
+		Token     string `json:"token"`
+		Version   string `json:"version"`
+		Installed string `json:"installed"`
+	} `json:"casks"`
+}
+
+// BrewVersion is the version of a formula or cask brew has installed and the
+// newest one it knows of.
+type BrewVersion struct {
+	Installed string
+	Current   string
+}
+
+// Outdated reports whether brew knows of a newer version than the installed
+// one. Casks that update themselves have no current version to compare.
+func (v BrewVersion) Outdated() bool {
+	return v.Current != "" && v.Current != "latest" && v.Current != v.Installed
+}
+
+// parseBrewInfoJSON parses `brew info --json=v2` output into installed formula
+// and cask versions keyed by name. Formulae are keyed by their short name (tap
+// prefix stripped) to match the keys used in status. When several versions of
+// a formula are installed the last one listed (the newest) wins. Entries that
+// are not installed are omitted.
+func parseBrewInfoJSON(data []byte) (formulas, casks map[string]BrewVersion, err error) {
+	var info brewInfoJSON
+	if err := json.Unmarshal(data, &info); err != nil {
+		return nil, nil, fmt.Errorf("parsing brew info JSON: %w", err)
+	}
+
+	formulas = make(map[string]BrewVersion)
+	for _, f := range info.Formulae {
+		if len(f.Installed) == 0 {
+			continue
+		}
+		name := f.Name
+		if name == "" {
+			name = formulaName(f.FullName)
+		}
+		// Installed versions carry the formula's revision, as in 2.44.0_1
+		current := f.Versions.Stable
+		if current != "" && f.Revision > 0 {
+			current += fmt.Sprintf("_%d", f.Revision)
+		}
+		formulas[name] = BrewVersion{Installed: f.Installed[len(f.Installed)-1].Version, Current: current}
+	}
+
+	casks = make(map[string]BrewVersion)
+	for _, c := range info.Casks {
+		if c.Installed == "" {
+			continue
+		}
+		casks[c.Token] = BrewVersion{Installed: c.Installed, Current: c.Version}
+	}
+	return formulas, casks, nil
+}
+
+// realBrewInstalledVersions runs `brew info --json=v2 --installed` once and
+// returns every installed formula and cask with its version.
+// Uses sh -c to support multi-word brew invocations (e.g. under Rosetta 2).
+func realBrewInstalledVersions(brew string) (map[string]BrewVersion, map[string]BrewVersion, error) {
+	out, err := exec.Command("sh", "-c", brew+" info --json=v2 --installed 2>/dev/null").Output()
+	if err != nil {
+		return nil, nil, fmt.Errorf("brew info failed: %w", err)
+	}
+	return parseBrewInfoJSON(out)
+}
+
+// brewInstalledVersions is overridable for testing.
+var brewInstalledVersions = realBrewInstalledVersions
+
+// BrewInstalledVersions returns the installed homebrew formulas and casks with
+// their installed and current versions, keyed by name. Exported for use by
+// the engine doctor checks.
+func BrewInstalledVersions() (formulas, casks map[string]BrewVersion, err error) {
+	return brewInstalledVersions(brewCmd())
+}
+
+// dpkgQueryFormat is the dpkg-query output format parsed by parseDpkgQuery:
+// one tab-separated "package, version, status" line per package.
+const dpkgQueryFormat = `${Package}\t${Version}\t${db:Status-Status}\n`
+
+// parseDpkgQuery parses dpkg-query output produced with dpkgQueryFormat into
+// installed package versions keyed by name. Packages in any state other than
+// "installed" (config-files, half-installed, ...) are omitted.
+func parseDpkgQuery(data []byte) map[string]string {
+	pkgs := make(map[string]string)
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Split(line, "\t")
+		if len(fields) != 3 || fields[2] != "installed" {
+			continue
+		}
+		// Multi-arch packages may be reported as "name:arch".
+		name, _, _ := strings.Cut(fields[0], ":")
+		pkgs[name] = fields[1]
+	}
+	return pkgs
+}
+
+// realDpkgInstalledVersions runs dpkg-query once and returns every installed
+// package with its version.
+func realDpkgInstalledVersions() (map[string]string, error) {
+	out, err := exec.Command("dpkg-query", "-W", "-f="+dpkgQueryFormat).Output()
+	if err != nil {
+		return nil, fmt.Errorf("dpkg-query failed: %w", err)
+	}
+	return parseDpkgQuery(out), nil
+}
+
+// dpkgInstalledVersions is overridable for testing.
+var dpkgInstalledVersions = realDpkgInstalledVersions
+
+// systemPackageVersions returns the installed versions of the packages of
+// the system package manager of osName, keyed by name: brew's formulas and
+// casks on mac, dpkg's packages elsewhere.
+func systemPackageVersions(osName string) (map[string]string, error) {
+	if osName != "mac" {
+		return dpkgInstalledVersions()
+	}
+	formulas, casks, err := BrewInstalledVersions()
+	if err != nil {
+		return nil, err
+	}
+	versions := make(map[string]string, len(formulas)+len(casks))
+	for name, v := range casks {
+		versions[name] = v.Installed
+	}
+	for name, v := range formulas {
+		versions[name] = v.Installed
+	}
+	return versions, nil
+}
@@ -0,0 +1,211 @@
+package handlers
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/elpic/blueprint/internal/parser"
+)
+
+func TestParseBrewInfoJSON(t *testing.T) {
+	data := []byte(`{
+		"formulae": [
+			{"name": "git", "full_name": "git", "versions": {"stable": "2.45.0"}, "revision": 0, "installed": [{"version": "2.44.0"}]},
+			{"name": "python@3.12", "full_name": "python@3.12", "versions": {"stable": "3.12.2"}, "installed": [{"version": "3.12.1"}, {"version": "3.12.2"}]},
+			{"name": "opencode", "full_name": "anomalyco/tap/opencode", "versions": {"stable": "0.5.1"}, "revision": 1, "installed": [{"version": "0.5.1_1"}]},
+			{"name": "wget", "full_name": "wget", "installed": []}
+		],
+		"casks": [
+			{"token": "wezterm", "version": "20240203", "installed": "20240203"},
+			{"token": "firefox", "version": "125.0", "installed": null}
+		]
+	}`)
+
+	formulas, casks, err := parseBrewInfoJSON(data)
+	if err != nil {
+		t.Fatalf("parseBrewInfoJSON() error: %v", err)
+	}
+
+	wantFormulas := map[string]BrewVersion{
+		"git":         {Installed: "2.44.0", Current: "2.45.0"},
+		"python@3.12": {Installed: "3.12.2", Current: "3.12.2"},
+		"opencode":    {Installed: "0.5.1_1", Current: "0.5.1_1"},
+	}
+	if len(formulas) != len(wantFormulas) {
+		t.Errorf("formulas = %v, want %v", formulas, wantFormulas)
+	}
+	for name, want := range wantFormulas {
+		if got := formulas[name]; got != want {
+			t.Errorf("formulas[%q] = %+v, want %+v", name, got, want)
+		}
+	}
+
+	if len(casks) != 1 || casks["wezterm"] != (BrewVersion{Installed: "20240203", Current: "20240203"}) {
+		t.Errorf("casks = %v, want only wezterm at 20240203", casks)
+	}
+}
+
+func TestBrewVersionOutdated(t *testing.T) {
+	for _, tt := range []struct {
+		version BrewVersion
+		want    bool
+	}{
+		{BrewVersion{Installed: "2.44.0", Current: "2.45.0"}, true},
+		{BrewVersion{Installed: "2.45.0", Current: "2.45.0"}, false},
+		{BrewVersion{Installed: "2.45.0"}, false},
+		{BrewVersion{Installed: "125.0", Current: "latest"}, false},
+	} {
+		if got := tt.version.Outdated(); got != tt.want {
+			t.Errorf("%+v.Outdated() = %v, want %v", tt.version, got, tt.want)
+		}
+	}
+}
+
+func TestParseBrewInfoJSONInvalid(t *testing.T) {
+	if _, _, err := parseBrewInfoJSON([]byte("Warning: brew is outdated")); err == nil {
+		t.Error("expected error for non-JSON output")
+	}
+}
+
+func TestParseDpkgQuery(t *testing.T) {
+	data := []byte("git\t1:2.43.0-1ubuntu7\tinstalled\n" +
+		"libc6:amd64\t2.39-0ubuntu8\tinstalled\n" +
+		"vim\t2:9.1.0016-1ubuntu7\tconfig-files\n" +
+		"malformed line\n")
+
+	got := parseDpkgQuery(data)
+	want := map[string]string{"git": "1:2.43.0-1ubuntu7", "libc6": "2.39-0ubuntu8"}
+	if len(got) != len(want) {
+		t.Errorf("parseDpkgQuery() = %v, want %v", got, want)
+	}
+	for name, v := range want {
+		if got[name] != v {
+			t.Errorf("parseDpkgQuery()[%q] = %q, want %q", name, got[name], v)
+		}
+	}
+}
+
+func TestInstallUpdateStatusRecordsAptVersion(t *testing.T) {
+	orig := dpkgInstalledVersions
+	defer func() { dpkgInstalledVersions = orig }()
+	dpkgInstalledVersions = func() (map[string]string, error) {
+		return map[string]string{"git": "1:2.43.0", "htop": "3.3.0"}, nil
+	}
+
+	rule := parser.Rule{
+		Action: "install",
+		Packages: []parser.Package{
+			{Name: "git"},
+			{Name: "htop", PackageManager: "snap"},
+		},
+	}
+	h := NewInstallHandlerLegacy(rule, "")
+	records := []ExecutionRecord{{Command: h.buildCommand(), Status: "success"}}
+
+	status := &Status{}
+	if err := h.UpdateStatus(status, records, "/tmp/test.bp", "linux"); err != nil {
+		t.Fatalf("UpdateStatus() error: %v", err)
+	}
+	if len(status.Packages) != 2 {
+		t.Fatalf("expected 2 packages in status, got %d", len(status.Packages))
+	}
+	for _, pkg := range status.Packages {
+		want := ""
+		if pkg.Name == "git" {
+			want = "1:2.43.0"
+		}
+		if pkg.Version != want {
+			t.Errorf("package %s version = %q, want %q", pkg.Name, pkg.Version, want)
+		}
+	}
+}
+
+func TestSystemVersionIgnoresOtherManagers(t *testing.T) {
+	versions := map[string]string{"htop": "3.3.0"}
+	for _, tt := range []struct {
+		manager, osName, want string
+	}{
+		{"", "linux", "3.3.0"},
+		{"apt", "linux", "3.3.0"},
+		{"snap", "linux", ""},
+		{"brew", "linux", ""},
+		{"", "mac", "3.3.0"},
+		{"brew", "mac", "3.3.0"},
+		{"apt", "mac", ""},
+	} {
+		pkg := parser.Package{Name: "htop", PackageManager: tt.manager}
+		if got := systemVersion(pkg, tt.osName, versions); got != tt.want {
+			t.Errorf("systemVersion(%q on %s) = %q, want %q", tt.manager, tt.osName, got, tt.want)
+		}
+	}
+}
+
+func TestInstallUpdateStatusRecordsBrewVersionOnMac(t *testing.T) {
+	orig := brewInstalledVersions
+	defer func() { brewInstalledVersions = orig }()
+	brewInstalledVersions = func(string) (map[string]BrewVersion, map[string]BrewVersion, error) {
+		return map[string]BrewVersion{"git": {Installed: "2.44.0", Current: "2.45.0"}},
+			map[string]BrewVersion{"wezterm": {Installed: "20240203"}}, nil
+	}
+
+	rule := parser.Rule{Action: "install", Packages: []parser.Package{{Name: "git"}, {Name: "wezterm"}}}
+	h := NewInstallHandlerLegacy(rule, "")
+	status := &Status{}
+	records := []ExecutionRecord{{Command: h.buildCommand(), Status: "success"}}
+	if err := h.UpdateStatus(status, records, "/tmp/test.bp", "mac"); err != nil {
+		t.Fatalf("UpdateStatus() error: %v", err)
+	}
+	want := map[string]string{"git": "2.44.0", "wezterm": "20240203"}
+	for _, pkg := range status.Packages {
+		if pkg.Version != want[pkg.Name] {
+			t.Errorf("package %s version = %q, want %q", pkg.Name, pkg.Version, want[pkg.Name])
+		}
+	}
+}
+
+func TestHomebrewUpdateStatusRecordsBrewVersions(t *testing.T) {
+	orig := brewInstalledVersions
+	defer func() { brewInstalledVersions = orig }()
+	brewInstalledVersions = func(string) (map[string]BrewVersion, map[string]BrewVersion, error) {
+		return map[string]BrewVersion{"git": {Installed: "2.44.0", Current: "2.45.0"}},
+			map[string]BrewVersion{"wezterm": {Installed: "20240203"}}, nil
+	}
+
+	rule := parser.Rule{Action: "homebrew", HomebrewPackages: []string{"git", "node@20", "jq"}, HomebrewCasks: []string{"wezterm"}}
+	h := NewHomebrewHandler(rule, "")
+	status := &Status{}
+	records := []ExecutionRecord{{Command: h.buildCommand(), Status: "success"}}
+	if err := h.UpdateStatus(status, records, "/tmp/test.bp", "mac"); err != nil {
+		t.Fatalf("UpdateStatus() error: %v", err)
+	}
+	// Pinned formulas keep their pin; brew not knowing a formula leaves "latest"
+	want := map[string]string{"git": "2.44.0", "node": "20", "jq": "latest", "cask:wezterm": "20240203"}
+	if len(status.Brews) != len(want) {
+		t.Fatalf("status.Brews = %+v, want %d entries", status.Brews, len(want))
+	}
+	for _, b := range status.Brews {
+		if b.Version != want[b.Formula] {
+			t.Errorf("%s version = %q, want %q", b.Formula, b.Version, want[b.Formula])
+		}
+	}
+}
+
+func TestInstallUpdateStatusIgnoresDpkgFailure(t *testing.T) {
+	orig := dpkgInstalledVersions
+	defer func() { dpkgInstalledVersions = orig }()
+	dpkgInstalledVersions = func() (map[string]string, error) {
+		return nil, errors.New("dpkg-query: not found")
+	}
+
+	rule := parser.Rule{Action: "install", Packages: []parser.Package{{Name: "git"}}}
+	h := NewInstallHandlerLegacy(rule, "")
+	records := []ExecutionRecord{{Command: h.buildCommand(), Status: "success"}}
+
+	status := &Status{}
+	if err := h.UpdateStatus(status, records, "/tmp/test.bp", "linux"); err != nil {
+		t.Fatalf("UpdateStatus() error: %v", err)
+	}
+	if len(status.Packages) != 1 || status.Packages[0].Version != "" {
+		t.Errorf("expected package recorded without version, got %+v", status.Packages)
+	}
+}
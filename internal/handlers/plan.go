@@ -0,0 +1,196 @@
+package handlers
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/elpic/blueprint/internal/parser"
+)
+
+// PlanChange is what applying a rule would do to its resources, as plan
+// shows it.
+type PlanChange string
+
+const (
+	PlanCreate PlanChange = "create" // none of the rule's resources exist yet
+	PlanUpdate PlanChange = "update" // some exist, or exist with other settings
+	PlanNoOp   PlanChange = "no-op"  // everything is in place
+	PlanDelete PlanChange = "delete" // an auto-uninstall removes the resource
+)
+
+// ChangePlanner is implemented by handlers that can tell a resource that is
+// outdated or partly in place from a missing one. Plan falls back to
+// IsInstalled for the others.
+type ChangePlanner interface {
+	PlanChange(status *Status, blueprintFile, osName string) PlanChange
+}
+
+// PlanRuleChange returns what applying rule would do, given the resources
+// status records for blueprintFile on osName.
+func PlanRuleChange(rule parser.Rule, status *Status, blueprintFile, osName string) PlanChange {
+	if rule.Action == "uninstall" {
+		return PlanDelete
+	}
+	// Rules that re-run on every apply always bring their resource up to date
+	if def := GetAction(rule.Action); def != nil && def.AlwaysRunUp {
+		return PlanUpdate
+	}
+	handler := NewHandler(rule, "", nil)
+	if handler == nil {
+		return PlanCreate
+	}
+	if planner, ok := handler.(ChangePlanner); ok {
+		return planner.PlanChange(status, blueprintFile, osName)
+	}
+	if handler.IsInstalled(status, blueprintFile, osName) {
+		return PlanNoOp
+	}
+	return PlanCreate
+}
+
+// planChangeOf returns the change for a rule of total resources of which
+// found are in place and outdated are recorded with other settings.
+func planChangeOf(found, outdated, total int) PlanChange {
+	switch {
+	case found == total:
+		return PlanNoOp
+	case found == 0 && outdated == 0:
+		return PlanCreate
+	}
+	return PlanUpdate
+}
+
+// countToolVersions counts the "tool@version" entries of pkgs that status
+// records with that version (found) or only with others (outdated);
+// recorded maps each tool to the versions recorded for it.
+func countToolVersions(pkgs []string, recorded map[string][]string) (found, outdated int) {
+	for _, pkg := range pkgs {
+		tool, version, _ := strings.Cut(pkg, "@")
+		versions := recorded[tool]
+		switch {
+		case slices.Contains(versions, version):
+			found++
+		case len(versions) > 0:
+			outdated++
+		}
+	}
+	return found, outdated
+}
+
+// PlanChange reports an update when only some of the packages are recorded,
+// or a pinned version differs from the one recorded.
+func (h *InstallHandler) PlanChange(status *Status, blueprintFile, osName string) PlanChange {
+	normalizedBlueprint := normalizeBlueprint(blueprintFile)
+	found, outdated := 0, 0
+	for _, pkg := range h.Rule.Packages {
+		for _, s := range status.Packages {
+			if s.Name != pkg.Name || normalizeBlueprint(s.Blueprint) != normalizedBlueprint || s.OS != osName {
+				continue
+			}
+			if pkg.Version != "" && s.Version != "" && s.Version != pkg.Version {
+				outdated++
+			} else {
+				found++
+			}
+			break
+		}
+	}
+	return planChangeOf(found, outdated, len(h.Rule.Packages))
+}
+
+// PlanChange reports an update when only some of the formulas and casks are
+// recorded or one of them is no longer installed.
+func (h *HomebrewHandler) PlanChange(status *Status, blueprintFile, osName string) PlanChange {
+	if h.IsInstalled(status, blueprintFile, osName) {
+		return PlanNoOp
+	}
+	normalizedBlueprint := normalizeBlueprint(blueprintFile)
+	for _, brew := range status.Brews {
+		if normalizeBlueprint(brew.Blueprint) != normalizedBlueprint || brew.OS != osName {
+			continue
+		}
+		for _, f := range h.Rule.HomebrewPackages {
+			if brew.Formula == formulaName(strings.Split(f, "@")[0]) {
+				return PlanUpdate
+			}
+		}
+		for _, c := range h.Rule.HomebrewCasks {
+			if brew.Formula == caskKey(c) {
+				return PlanUpdate
+			}
+		}
+	}
+	return PlanCreate
+}
+
+// PlanChange reports an update when a plugin is recorded with another
+// version or only some of the plugins are recorded.
+func (h *AsdfHandler) PlanChange(status *Status, blueprintFile, osName string) PlanChange {
+	normalizedBlueprint := normalizeBlueprint(blueprintFile)
+	recorded := map[string][]string{}
+	for _, s := range status.Asdfs {
+		if normalizeBlueprint(s.Blueprint) == normalizedBlueprint && s.OS == osName {
+			recorded[s.Plugin] = append(recorded[s.Plugin], s.Version)
+		}
+	}
+	found, outdated := countToolVersions(h.Rule.AsdfPackages, recorded)
+	return planChangeOf(found, outdated, len(h.Rule.AsdfPackages))
+}
+
+// PlanChange reports an update when a tool is recorded with another version
+// or only some of the tools are recorded.
+func (h *MiseHandler) PlanChange(status *Status, blueprintFile, osName string) PlanChange {
+	normalizedBlueprint := normalizeBlueprint(blueprintFile)
+	recorded := map[string][]string{}
+	for _, s := range status.Mises {
+		if normalizeBlueprint(s.Blueprint) == normalizedBlueprint && s.OS == osName {
+			recorded[s.Tool] = append(recorded[s.Tool], s.Version)
+		}
+	}
+	found, outdated := countToolVersions(h.Rule.MisePackages, recorded)
+	return planChangeOf(found, outdated, len(h.Rule.MisePackages))
+}
+
+// PlanChange reports an update when only some of the models are recorded.
+func (h *OllamaHandler) PlanChange(status *Status, blueprintFile, osName string) PlanChange {
+	normalizedBlueprint := normalizeBlueprint(blueprintFile)
+	found := 0
+	for _, model := range h.Rule.OllamaModels {
+		for _, s := range status.Ollamas {
+			if s.Model == model && normalizeBlueprint(s.Blueprint) == normalizedBlueprint && s.OS == osName {
+				found++
+				break
+			}
+		}
+	}
+	return planChangeOf(found, 0, len(h.Rule.OllamaModels))
+}
+
+// PlanChange reports an update when the source is scheduled at another time.
+func (h *ScheduleHandler) PlanChange(status *Status, blueprintFile, osName string) PlanChange {
+	if h.IsInstalled(status, blueprintFile, osName) {
+		return PlanNoOp
+	}
+	normalizedBlueprint := normalizeBlueprint(blueprintFile)
+	for _, s := range status.Schedules {
+		if s.Source == h.Rule.ScheduleSource && normalizeBlueprint(s.Blueprint) == normalizedBlueprint && s.OS == osName {
+			return PlanUpdate
+		}
+	}
+	return PlanCreate
+}
+
+// PlanChange reports an update when the backup runs at another interval or
+// to another destination.
+func (h *StateBackupHandler) PlanChange(status *Status, blueprintFile, osName string) PlanChange {
+	if h.IsInstalled(status, blueprintFile, osName) {
+		return PlanNoOp
+	}
+	normalizedBlueprint := normalizeBlueprint(blueprintFile)
+	for _, s := range status.StateBackups {
+		if normalizeBlueprint(s.Blueprint) == normalizedBlueprint && s.OS == osName {
+			return PlanUpdate
+		}
+	}
+	return PlanCreate
+}
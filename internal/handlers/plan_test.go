@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"testing"
+
+	"github.com/elpic/blueprint/internal/parser"
+)
+
+func TestPlanRuleChange(t *testing.T) {
+	status := &Status{
+		Packages: []PackageStatus{
+			{Name: "git", Blueprint: "setup.bp", OS: "linux"},
+			{Name: "node", Version: "18.0.0", Blueprint: "setup.bp", OS: "linux"},
+		},
+		Mkdirs:    []MkdirStatus{{Path: "~/code", Blueprint: "setup.bp", OS: "linux"}},
+		Asdfs:     []AsdfStatus{{Plugin: "nodejs", Version: "18.19.0", Blueprint: "setup.bp", OS: "linux"}},
+		Schedules: []ScheduleStatus{{CronExpr: "0 9 * * *", Source: "setup.bp", Blueprint: "setup.bp", OS: "linux"}},
+	}
+	pkgs := func(names ...string) []parser.Package {
+		var p []parser.Package
+		for _, n := range names {
+			p = append(p, parser.Package{Name: n})
+		}
+		return p
+	}
+
+	tests := []struct {
+		name string
+		rule parser.Rule
+		want PlanChange
+	}{
+		{"recorded package", parser.Rule{Action: "install", Packages: pkgs("git")}, PlanNoOp},
+		{"missing package", parser.Rule{Action: "install", Packages: pkgs("curl")}, PlanCreate},
+		{"some packages missing", parser.Rule{Action: "install", Packages: pkgs("git", "curl")}, PlanUpdate},
+		{"pinned version differs", parser.Rule{Action: "install", Packages: []parser.Package{{Name: "node", Version: "20.0.0"}}}, PlanUpdate},
+		{"other blueprint", parser.Rule{Action: "mkdir", Mkdir: "~/src"}, PlanCreate},
+		{"recorded directory", parser.Rule{Action: "mkdir", Mkdir: "~/code"}, PlanNoOp},
+		{"asdf version changed", parser.Rule{Action: "asdf", AsdfPackages: []string{"nodejs@20.11.0"}}, PlanUpdate},
+		{"asdf version recorded", parser.Rule{Action: "asdf", AsdfPackages: []string{"nodejs@18.19.0"}}, PlanNoOp},
+		{"asdf new plugin", parser.Rule{Action: "asdf", AsdfPackages: []string{"ruby@3.3.0"}}, PlanCreate},
+		{"auto-uninstall", parser.Rule{Action: "uninstall", Mkdir: "~/old"}, PlanDelete},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := PlanRuleChange(tt.rule, status, "setup.bp", "linux"); got != tt.want {
+				t.Errorf("PlanRuleChange() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,392 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/elpic/blueprint/internal/parser"
+	"github.com/elpic/blueprint/internal/ui"
+	"github.com/elpic/blueprint/internal/ui/timeutil"
+)
+
+func init() {
+	RegisterAction(ActionDef{
+		Name:   "ppa",
+		Prefix: "ppa ",
+		Meta: ActionMeta{
+			Summary: "Add a Launchpad PPA on Ubuntu.",
+			Usage:   "ppa ppa:<owner>/<name> [fingerprint: <fpr>]",
+			Attrs: []AttrMeta{
+				{Name: "fingerprint", Type: "string", Description: "Fingerprint of the PPA's signing key; looked up on Launchpad when omitted"},
+			},
+			Examples: []string{
+				"ppa ppa:neovim-ppa/unstable",
+				"ppa ppa:git-core/ppa on: [linux]",
+			},
+			OS:  []string{"linux"},
+			Doc: "ppa.md",
+		},
+		NewHandler: func(rule parser.Rule, basePath string, passwordCache map[string]string) Handler {
+			sudoPassword := ""
+			if passwordCache != nil {
+				sudoPassword = passwordCache["sudo"]
+			}
+			return NewPPAHandlerWithPassword(rule, basePath, sudoPassword)
+		},
+		RuleKey: func(rule parser.Rule) string {
+			return "ppa:" + rule.PPA
+		},
+		Detect: func(rule parser.Rule) bool {
+			return rule.PPA != ""
+		},
+		Summary: func(rule parser.Rule) string {
+			return "ppa:" + rule.PPA
+		},
+		OrphanIndex: func(rule parser.Rule, index func(string)) {
+			index(rule.PPA)
+		},
+		Verify: func(e StatusEntry) bool {
+			s := e.(*PPAStatus)
+			return pathExists(NewPPAHandler(parser.Rule{PPA: s.PPA}, "").sourcePath())
+		},
+		ShellExport: func(rule parser.Rule, _, osName string) []string {
+			if osName != "linux" {
+				return nil
+			}
+			return []string{
+				"sudo add-apt-repository -y " + shellQ("ppa:"+rule.PPA),
+			}
+		},
+	})
+}
+
+// PPAHandler adds a Launchpad PPA as a deb822 .sources file signed by the
+// PPA's key, which is fetched from the Ubuntu keyserver and checked against
+// the fingerprint Launchpad publishes for it. Like repo rules, the apt cache
+// is refreshed once per wave through RefreshPackageCaches.
+type PPAHandler struct {
+	BaseHandler
+	sudoPassword string
+}
+
+// NewPPAHandler creates a new ppa handler
+func NewPPAHandler(rule parser.Rule, basePath string) *PPAHandler {
+	return &PPAHandler{
+		BaseHandler: BaseHandler{
+			Rule:     rule,
+			BasePath: basePath,
+		},
+	}
+}
+
+// NewPPAHandlerWithPassword creates a new ppa handler with a cached sudo password
+func NewPPAHandlerWithPassword(rule parser.Rule, basePath, sudoPassword string) *PPAHandler {
+	h := NewPPAHandler(rule, basePath)
+	h.sudoPassword = sudoPassword
+	return h
+}
+
+// ppaSigningKeyFingerprint returns the fingerprint of the key a PPA is
+// signed with, as published by the Launchpad API.
+var ppaSigningKeyFingerprint = func(owner, name string) (string, error) {
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Get(fmt.Sprintf("https://api.launchpad.net/1.0/~%s/+archive/ubuntu/%s", owner, name))
+	if err != nil {
+		return "", fmt.Errorf("failed to look up ppa:%s/%s: %w", owner, name, err)
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return "", fmt.Errorf("ppa:%s/%s does not exist on Launchpad", owner, name)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("launchpad api returned status %d", resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("failed to read response body: %w", err)
+	}
+	var archive struct {
+		SigningKeyFingerprint string `json:"signing_key_fingerprint"`
+	}
+	if err := json.Unmarshal(body, &archive); err != nil {
+		return "", fmt.Errorf("failed to parse launchpad response: %w", err)
+	}
+	if archive.SigningKeyFingerprint == "" {
+		return "", fmt.Errorf("ppa:%s/%s has no signing key yet", owner, name)
+	}
+	return strings.ToUpper(archive.SigningKeyFingerprint), nil
+}
+
+// isUbuntu reports whether the running distro is Ubuntu or derived from it.
+func isUbuntu() bool {
+	release := readOSRelease()
+	for _, id := range strings.Fields(release["ID"] + " " + release["ID_LIKE"]) {
+		if id == "ubuntu" {
+			return true
+		}
+	}
+	return false
+}
+
+func (h *PPAHandler) owner() string {
+	owner, _, _ := strings.Cut(h.Rule.PPA, "/")
+	return owner
+}
+
+func (h *PPAHandler) name() string {
+	_, name, _ := strings.Cut(h.Rule.PPA, "/")
+	return name
+}
+
+// fileName is the base name of the PPA's key and source files.
+func (h *PPAHandler) fileName() string {
+	return "ppa-" + h.owner() + "-" + h.name()
+}
+
+func (h *PPAHandler) keyPath() string {
+	return fmt.Sprintf("/etc/apt/keyrings/%s.asc", h.fileName())
+}
+
+func (h *PPAHandler) sourcePath() string {
+	return fmt.Sprintf("/etc/apt/sources.list.d/%s.sources", h.fileName())
+}
+
+func (h *PPAHandler) uri() string {
+	return fmt.Sprintf("https://ppa.launchpadcontent.net/%s/%s/ubuntu", h.owner(), h.name())
+}
+
+// suite returns the Ubuntu codename; derivatives such as Mint set
+// UBUNTU_CODENAME to the release they are based on.
+func (h *PPAHandler) suite() string {
+	release := readOSRelease()
+	if codename := release["UBUNTU_CODENAME"]; codename != "" {
+		return codename
+	}
+	return release["VERSION_CODENAME"]
+}
+
+// aptSource returns the deb822 .sources file for the PPA.
+func (h *PPAHandler) aptSource(suite string) string {
+	return strings.Join([]string{
+		"Types: deb",
+		"URIs: " + h.uri(),
+		"Suites: " + suite,
+		"Components: main",
+		"Signed-By: " + h.keyPath(),
+	}, "\n") + "\n"
+}
+
+// Up writes the PPA's key and source file, leaving files that are already
+// up to date untouched, and schedules an apt cache refresh when anything
+// changed.
+func (h *PPAHandler) Up() (string, error) {
+	if targetOS := getOSName(); targetOS != "linux" {
+		return "", fmt.Errorf("ppa is not supported on %s", targetOS)
+	}
+	if !isUbuntu() {
+		return "", fmt.Errorf("ppa:%s needs Ubuntu or an Ubuntu derivative; use a repo rule on other distros", h.Rule.PPA)
+	}
+	suite := h.suite()
+	if suite == "" {
+		return "", fmt.Errorf("cannot detect the Ubuntu codename from /etc/os-release")
+	}
+
+	changed, err := h.ensureKey()
+	if err != nil {
+		return "", err
+	}
+	if source := h.aptSource(suite); fileContent(h.sourcePath()) != source {
+		if err := writeRootFile(h.sourcePath(), source, h.sudoPassword); err != nil {
+			return "", fmt.Errorf("failed to write %s: %w", h.sourcePath(), err)
+		}
+		changed = true
+	}
+
+	if !changed {
+		return fmt.Sprintf("already configured: ppa:%s", h.Rule.PPA), nil
+	}
+	requestCacheRefresh("apt", h.sudoPassword)
+	return fmt.Sprintf("added ppa:%s", h.Rule.PPA), nil
+}
+
+// ensureKey installs the PPA's signing key unless it is there already, and
+// reports whether it did. Launchpad is only asked for the fingerprint when
+// none is pinned and the key has to be downloaded.
+func (h *PPAHandler) ensureKey() (bool, error) {
+	path := h.keyPath()
+	if isKeyringInstalled(path) {
+		if err := checkKeyFingerprint([]byte(fileContent(path)), h.Rule.PPAFingerprint); err != nil {
+			return false, fmt.Errorf("installed key %s: %w", path, err)
+		}
+		return false, nil
+	}
+	fingerprint := h.Rule.PPAFingerprint
+	if fingerprint == "" {
+		var err error
+		if fingerprint, err = ppaSigningKeyFingerprint(h.owner(), h.name()); err != nil {
+			return false, err
+		}
+	}
+	keyURL := "https://keyserver.ubuntu.com/pks/lookup?op=get&search=0x" + fingerprint
+	if err := installKey(keyURL, path, fingerprint, h.sudoPassword); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Down removes the PPA's source file and key.
+func (h *PPAHandler) Down() (string, error) {
+	if err := removeRootFiles(h.sudoPassword, h.sourcePath(), h.keyPath()); err != nil {
+		return "", fmt.Errorf("failed to remove ppa:%s: %w", h.Rule.PPA, err)
+	}
+	requestCacheRefresh("apt", h.sudoPassword)
+	return fmt.Sprintf("removed ppa:%s", h.Rule.PPA), nil
+}
+
+// GetCommand returns the actual command(s) that will be executed
+func (h *PPAHandler) GetCommand() string {
+	if h.Rule.Action == "uninstall" {
+		return fmt.Sprintf("sudo rm -f %s %s", h.sourcePath(), h.keyPath())
+	}
+	return fmt.Sprintf("sudo install -m 0644 <ppa:%s> %s", h.Rule.PPA, h.sourcePath())
+}
+
+// UpdateStatus records the added PPA, or removes the deleted one
+func (h *PPAHandler) UpdateStatus(status *Status, records []ExecutionRecord, blueprint string, osName string) error {
+	blueprint = normalizeBlueprint(blueprint)
+
+	switch h.Rule.Action {
+	case "ppa":
+		if _, ok := commandSuccessfullyExecuted(h.GetCommand(), records); !ok {
+			return nil
+		}
+		status.PPAs = removePPAStatus(status.PPAs, h.Rule.PPA, blueprint, osName)
+		status.PPAs = append(status.PPAs, PPAStatus{
+			PPA:         h.Rule.PPA,
+			Fingerprint: h.Rule.PPAFingerprint,
+			Suite:       h.suite(),
+			AddedAt:     timeutil.Now(),
+			Blueprint:   blueprint,
+			OS:          osName,
+		})
+	case "uninstall":
+		status.PPAs = removePPAStatus(status.PPAs, h.Rule.PPA, blueprint, osName)
+	}
+
+	return nil
+}
+
+// NeedsSudo returns true because apt sources and keyrings are root-owned
+func (h *PPAHandler) NeedsSudo() bool {
+	return true
+}
+
+// ConcurrencyClass returns "apt", whose sources it rewrites
+func (h *PPAHandler) ConcurrencyClass() string {
+	return "apt"
+}
+
+// GetDependencyKey returns the unique key for this rule in dependency resolution
+func (h *PPAHandler) GetDependencyKey() string {
+	return getDependencyKey(h.Rule, "ppa:"+h.Rule.PPA)
+}
+
+// GetDisplayDetails returns the PPA to display during execution
+func (h *PPAHandler) GetDisplayDetails(isUninstall bool) string {
+	return "ppa:" + h.Rule.PPA
+}
+
+// DisplayInfo displays handler-specific information
+func (h *PPAHandler) DisplayInfo() {
+	formatFunc := ui.FormatInfo
+	if h.Rule.Action == "uninstall" {
+		formatFunc = ui.FormatDim
+	}
+
+	printInfo(formatFunc, "PPA", "ppa:"+h.Rule.PPA)
+	if h.Rule.PPAFingerprint != "" {
+		printInfo(formatFunc, "Fingerprint", h.Rule.PPAFingerprint)
+	}
+}
+
+// DisplayStatusFromStatus displays ppa handler status from Status object
+func (h *PPAHandler) DisplayStatusFromStatus(status *Status) {
+	if status == nil || status.PPAs == nil {
+		return
+	}
+	h.DisplayStatus(status.PPAs)
+}
+
+// DisplayStatus displays PPA status information
+func (h *PPAHandler) DisplayStatus(ppas []PPAStatus) {
+	if len(ppas) == 0 {
+		return
+	}
+
+	rows := make([]statusRow, 0, len(ppas))
+	for _, p := range ppas {
+		rows = append(rows, statusRow{
+			name:    "ppa:" + p.PPA,
+			details: []string{timeutil.Display(p.AddedAt)},
+			tags:    []string{p.Suite, p.OS, abbreviateBlueprintPath(p.Blueprint)},
+			entry:   &p,
+		})
+	}
+	printStatusSection("PPAs:", rows)
+}
+
+// GetState returns handler-specific state as key-value pairs
+func (h *PPAHandler) GetState(isUninstall bool) map[string]string {
+	return map[string]string{
+		"summary": h.GetDisplayDetails(isUninstall),
+		"ppa":     h.Rule.PPA,
+	}
+}
+
+// FindUninstallRules compares ppa status against current rules and returns uninstall rules
+func (h *PPAHandler) FindUninstallRules(status *Status, currentRules []parser.Rule, blueprintFile, osName string) []parser.Rule {
+	normalizedBlueprint := normalizeBlueprint(blueprintFile)
+
+	current := make(map[string]bool)
+	for _, rule := range currentRules {
+		if rule.Action == "ppa" && rule.PPA != "" {
+			current[rule.PPA] = true
+		}
+	}
+
+	var rules []parser.Rule
+	for _, p := range status.PPAs {
+		if normalizeBlueprint(p.Blueprint) == normalizedBlueprint && p.OS == osName && !current[p.PPA] {
+			rules = append(rules, parser.Rule{
+				Action: "uninstall",
+				PPA:    p.PPA,
+				OSList: []string{osName},
+			})
+		}
+	}
+	return rules
+}
+
+// IsInstalled returns true if the PPA is in status with the same pinned fingerprint.
+func (h *PPAHandler) IsInstalled(status *Status, blueprintFile, osName string) bool {
+	normalizedBlueprint := normalizeBlueprint(blueprintFile)
+	for _, p := range status.PPAs {
+		if p.PPA == h.Rule.PPA && normalizeBlueprint(p.Blueprint) == normalizedBlueprint && p.OS == osName &&
+			p.Fingerprint == h.Rule.PPAFingerprint {
+			return true
+		}
+	}
+	return false
+}
+
+func removePPAStatus(sl []PPAStatus, ppa, blueprint, osName string) []PPAStatus {
+	return removeStatusEntry[PPAStatus, *PPAStatus](sl, ppa, blueprint, osName)
+}
@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/elpic/blueprint/internal/parser"
+)
+
+// stubPPASystem stubs the repo system for Ubuntu noble and the Launchpad
+// fingerprint lookup, counting the lookups.
+func stubPPASystem(t *testing.T, release map[string]string, files map[string]string) *int {
+	t.Helper()
+	stubRepoSystem(t, release, files)
+	origOS, origLookup := getOSName, ppaSigningKeyFingerprint
+	t.Cleanup(func() { getOSName, ppaSigningKeyFingerprint = origOS, origLookup })
+
+	lookups := 0
+	getOSName = func() string { return "linux" }
+	ppaSigningKeyFingerprint = func(owner, name string) (string, error) {
+		lookups++
+		return "9DC858229FC7DD38854AE2D88D81803C0EBFCD88", nil
+	}
+	return &lookups
+}
+
+func TestPPAHandlerUp(t *testing.T) {
+	files := map[string]string{}
+	lookups := stubPPASystem(t, map[string]string{"ID": "ubuntu", "ID_LIKE": "debian", "VERSION_CODENAME": "noble", "UBUNTU_CODENAME": "noble"}, files)
+
+	h := NewPPAHandler(parser.Rule{Action: "ppa", PPA: "neovim-ppa/unstable"}, "")
+	out, err := h.Up()
+	if err != nil {
+		t.Fatalf("Up() error = %v", err)
+	}
+	if out != "added ppa:neovim-ppa/unstable" {
+		t.Errorf("Up() = %q", out)
+	}
+
+	want := "Types: deb\nURIs: https://ppa.launchpadcontent.net/neovim-ppa/unstable/ubuntu\nSuites: noble\nComponents: main\nSigned-By: /etc/apt/keyrings/ppa-neovim-ppa-unstable.asc\n"
+	if got := files["/etc/apt/sources.list.d/ppa-neovim-ppa-unstable.sources"]; got != want {
+		t.Errorf("sources file =\n%s\nwant\n%s", got, want)
+	}
+	if key := files["/etc/apt/keyrings/ppa-neovim-ppa-unstable.asc"]; !strings.Contains(key, "keyserver.ubuntu.com/pks/lookup?op=get&search=0x9DC858229FC7DD38854AE2D88D81803C0EBFCD88") {
+		t.Errorf("key = %q", key)
+	}
+	if _, ok := pendingRefreshes["apt"]; !ok {
+		t.Error("apt cache refresh was not requested")
+	}
+
+	pendingRefreshes = map[string]string{}
+	out, err = h.Up()
+	if err != nil || !strings.HasPrefix(out, "already configured") {
+		t.Errorf("second Up() = %q, %v", out, err)
+	}
+	if *lookups != 1 {
+		t.Errorf("Launchpad was asked %d times, want 1", *lookups)
+	}
+	if len(pendingRefreshes) != 0 {
+		t.Error("unchanged PPA should not refresh the cache")
+	}
+}
+
+func TestPPAHandlerUpUsesUbuntuCodenameOnDerivatives(t *testing.T) {
+	files := map[string]string{}
+	stubPPASystem(t, map[string]string{"ID": "linuxmint", "ID_LIKE": "ubuntu debian", "VERSION_CODENAME": "wilma", "UBUNTU_CODENAME": "noble"}, files)
+
+	if _, err := NewPPAHandler(parser.Rule{Action: "ppa", PPA: "git-core/ppa"}, "").Up(); err != nil {
+		t.Fatalf("Up() error = %v", err)
+	}
+	if got := files["/etc/apt/sources.list.d/ppa-git-core-ppa.sources"]; !strings.Contains(got, "Suites: noble\n") {
+		t.Errorf("sources file = %q", got)
+	}
+}
+
+func TestPPAHandlerUpRejectsOtherDistros(t *testing.T) {
+	files := map[string]string{}
+	stubPPASystem(t, map[string]string{"ID": "debian", "VERSION_CODENAME": "bookworm"}, files)
+
+	_, err := NewPPAHandler(parser.Rule{Action: "ppa", PPA: "git-core/ppa"}, "").Up()
+	if err == nil || !strings.Contains(err.Error(), "Ubuntu") {
+		t.Errorf("Up() error = %v, want an Ubuntu-only error", err)
+	}
+	if len(files) != 0 {
+		t.Errorf("files written on Debian: %v", files)
+	}
+}
+
+func TestPPAHandlerDown(t *testing.T) {
+	files := map[string]string{
+		"/etc/apt/sources.list.d/ppa-git-core-ppa.sources": "Types: deb\n",
+		"/etc/apt/keyrings/ppa-git-core-ppa.asc":           "key",
+	}
+	stubPPASystem(t, map[string]string{"ID": "ubuntu"}, files)
+
+	if _, err := NewPPAHandler(parser.Rule{Action: "uninstall", PPA: "git-core/ppa"}, "").Down(); err != nil {
+		t.Fatalf("Down() error = %v", err)
+	}
+	if len(files) != 0 {
+		t.Errorf("files left after Down(): %v", files)
+	}
+	if _, ok := pendingRefreshes["apt"]; !ok {
+		t.Error("apt cache refresh was not requested")
+	}
+}
+
+func TestPPAHandlerStatus(t *testing.T) {
+	stubPPASystem(t, map[string]string{"ID": "ubuntu", "VERSION_CODENAME": "noble"}, map[string]string{})
+
+	rule := parser.Rule{Action: "ppa", PPA: "neovim-ppa/unstable"}
+	h := NewPPAHandler(rule, "")
+	status := &Status{}
+	records := []ExecutionRecord{{Command: h.GetCommand(), Status: "success"}}
+	if err := h.UpdateStatus(status, records, "/tmp/setup.bp", "linux"); err != nil {
+		t.Fatalf("UpdateStatus() error = %v", err)
+	}
+	if len(status.PPAs) != 1 || status.PPAs[0].PPA != "neovim-ppa/unstable" || status.PPAs[0].Suite != "noble" {
+		t.Fatalf("status.PPAs = %+v", status.PPAs)
+	}
+	if !h.IsInstalled(status, "/tmp/setup.bp", "linux") {
+		t.Error("IsInstalled() = false after UpdateStatus")
+	}
+
+	uninstall := h.FindUninstallRules(status, nil, "/tmp/setup.bp", "linux")
+	if len(uninstall) != 1 || uninstall[0].PPA != "neovim-ppa/unstable" {
+		t.Fatalf("FindUninstallRules() = %+v", uninstall)
+	}
+	if len(h.FindUninstallRules(status, []parser.Rule{rule}, "/tmp/setup.bp", "linux")) != 0 {
+		t.Error("FindUninstallRules() should keep a PPA still in the blueprint")
+	}
+
+	u := NewPPAHandler(uninstall[0], "")
+	records = []ExecutionRecord{{Command: u.GetCommand(), Status: "success"}}
+	if err := u.UpdateStatus(status, records, "/tmp/setup.bp", "linux"); err != nil {
+		t.Fatalf("UpdateStatus() error = %v", err)
+	}
+	if len(status.PPAs) != 0 {
+		t.Errorf("status.PPAs after uninstall = %+v", status.PPAs)
+	}
+}
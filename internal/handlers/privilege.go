@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"fmt"
+	"os/exec"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// Commands that need root are written with sudo everywhere blueprint shows
+// them: handler commands, plans, history and exported scripts. They run with
+// the privilege tool of the machine, which is doas on Alpine and OpenBSD
+// style systems and may be run0 on systemd ones where sudo is not installed.
+
+// The privilege tools blueprint can run commands as root with.
+const (
+	PrivilegeSudo = "sudo"
+	PrivilegeDoas = "doas"
+	PrivilegeRun0 = "run0"
+)
+
+// PrivilegeTools lists the privilege tools in the order they are looked for.
+var PrivilegeTools = []string{PrivilegeSudo, PrivilegeDoas, PrivilegeRun0}
+
+var (
+	privilegeMu   sync.Mutex
+	privilegeTool string // set or detected; "" until first needed
+)
+
+// privilegeLookPath finds a privilege tool on PATH. Defined as a var to
+// allow stubbing in tests.
+var privilegeLookPath = exec.LookPath
+
+// SetPrivilegeTool sets the tool commands needing root run with. "" and
+// "auto" detect it: the first of PrivilegeTools installed, sudo when none is.
+func SetPrivilegeTool(name string) error {
+	if name == "auto" {
+		name = ""
+	}
+	if name != "" && !slices.Contains(PrivilegeTools, name) {
+		return fmt.Errorf("unknown privilege tool %q (want auto, %s)", name, strings.Join(PrivilegeTools, ", "))
+	}
+	privilegeMu.Lock()
+	defer privilegeMu.Unlock()
+	privilegeTool = name
+	return nil
+}
+
+// PrivilegeTool returns the tool commands needing root run with.
+func PrivilegeTool() string {
+	privilegeMu.Lock()
+	defer privilegeMu.Unlock()
+	if privilegeTool == "" {
+		privilegeTool = PrivilegeSudo
+		for _, tool := range PrivilegeTools {
+			if _, err := privilegeLookPath(tool); err == nil {
+				privilegeTool = tool
+				break
+			}
+		}
+	}
+	return privilegeTool
+}
+
+// PrivilegeNonInteractive returns the flag that makes tool fail rather than
+// ask for a password.
+func PrivilegeNonInteractive(tool string) string {
+	if tool == PrivilegeRun0 {
+		return "--no-ask-password"
+	}
+	return "-n"
+}
+
+// sudoWord matches sudo where a command of a shell string starts.
+var sudoWord = regexp.MustCompile(`(^|[\s;&|(])sudo(\s)`)
+
+// EscalateCommand returns the shell string cmd with the commands it runs with
+// sudo run with the privilege tool instead.
+func EscalateCommand(cmd string) string {
+	tool := PrivilegeTool()
+	if tool == PrivilegeSudo {
+		return cmd
+	}
+	return sudoWord.ReplaceAllString(cmd, "${1}"+tool+"${2}")
+}
+
+// sudoCommand returns a command running args as root with the privilege tool.
+// sudo gets the cached password via stdin when available; doas and run0 ask
+// on the terminal themselves, when they ask at all.
+func sudoCommand(sudoPassword string, args ...string) *exec.Cmd {
+	tool := PrivilegeTool()
+	if sudoPassword != "" && tool == PrivilegeSudo {
+		cmd := exec.Command("sudo", append([]string{"-S"}, args...)...) // #nosec G204
+		cmd.Stdin = strings.NewReader(sudoPassword + "\n")
+		return cmd
+	}
+	return exec.Command(tool, args...) // #nosec G204
+}
@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"errors"
+	"testing"
+)
+
+// usePrivilegeTools makes only the given tools appear installed.
+func usePrivilegeTools(t *testing.T, installed ...string) {
+	t.Helper()
+	orig := privilegeLookPath
+	t.Cleanup(func() {
+		privilegeLookPath = orig
+		_ = SetPrivilegeTool("")
+	})
+	privilegeLookPath = func(file string) (string, error) {
+		for _, tool := range installed {
+			if tool == file {
+				return "/usr/bin/" + file, nil
+			}
+		}
+		return "", errors.New("not found")
+	}
+	_ = SetPrivilegeTool("")
+}
+
+func TestPrivilegeToolDetection(t *testing.T) {
+	for _, tc := range []struct {
+		installed []string
+		want      string
+	}{
+		{[]string{"sudo", "doas"}, PrivilegeSudo},
+		{[]string{"doas"}, PrivilegeDoas},
+		{[]string{"run0"}, PrivilegeRun0},
+		{nil, PrivilegeSudo},
+	} {
+		usePrivilegeTools(t, tc.installed...)
+		if got := PrivilegeTool(); got != tc.want {
+			t.Errorf("PrivilegeTool() with %v installed = %q, want %q", tc.installed, got, tc.want)
+		}
+	}
+
+	usePrivilegeTools(t, "sudo")
+	if err := SetPrivilegeTool("doas"); err != nil {
+		t.Fatal(err)
+	}
+	if got := PrivilegeTool(); got != PrivilegeDoas {
+		t.Errorf("PrivilegeTool() = %q, want the configured doas", got)
+	}
+	if err := SetPrivilegeTool("su"); err == nil {
+		t.Error("SetPrivilegeTool(su) should fail")
+	}
+}
+
+func TestEscalateCommand(t *testing.T) {
+	usePrivilegeTools(t, "sudo")
+	cmd := "curl -fsSL https://example.com/key | sudo tee /etc/apt/keyrings/x.asc && sudo apt-get update"
+	if got := EscalateCommand(cmd); got != cmd {
+		t.Errorf("EscalateCommand() with sudo = %q, want it unchanged", got)
+	}
+
+	usePrivilegeTools(t, "doas")
+	want := "curl -fsSL https://example.com/key | doas tee /etc/apt/keyrings/x.asc && doas apt-get update"
+	if got := EscalateCommand(cmd); got != want {
+		t.Errorf("EscalateCommand() = %q, want %q", got, want)
+	}
+	if got := EscalateCommand("echo pseudo sudoers"); got != "echo pseudo sudoers" {
+		t.Errorf("EscalateCommand() rewrote words that are not sudo: %q", got)
+	}
+}
@@ -0,0 +1,214 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/elpic/blueprint/internal/ui/timeutil"
+)
+
+// RCFileStatus records a shell startup file (~/.bashrc, ~/.zshrc, ...) that
+// blueprint appended to, so blueprint rollback --rc-files can put it back.
+type RCFileStatus struct {
+	Path      string   `json:"path"`
+	Backup    string   `json:"backup,omitempty"` // copy from before blueprint first changed it; empty when the file did not exist
+	Checksum  string   `json:"checksum"`         // sha256 of the content blueprint last left
+	Added     []string `json:"added"`            // the blocks blueprint appended, in order
+	ChangedAt string   `json:"changed_at"`
+	Blueprint string   `json:"blueprint"`
+	OS        string   `json:"os"`
+}
+
+// rcBackupDir is where rc files are backed up before their first change.
+var rcBackupDir = func() string {
+	return expandPath("~/.blueprint/rc-backups")
+}
+
+// rcEdit is an append to an rc file not yet recorded in status.
+type rcEdit struct {
+	path     string
+	backup   string
+	checksum string
+	added    string
+}
+
+// pendingRCEdits holds the rc file appends made since the last RecordRCEdits
+// call; handlers make them during Up, before status is saved.
+var (
+	pendingRCMu    sync.Mutex
+	pendingRCEdits []rcEdit
+)
+
+// fileChecksum returns the hex sha256 of data.
+func fileChecksum(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// rcBackupPath returns where the pristine copy of path is kept. The name is
+// derived from path so every run finds the backup the first change made.
+func rcBackupPath(path string) string {
+	return filepath.Join(rcBackupDir(), fileChecksum([]byte(path))[:12]+"-"+strings.TrimPrefix(filepath.Base(path), "."))
+}
+
+// appendRCFile appends block to the rc file at path. Before blueprint first
+// changes the file its content is backed up, and the append is queued for
+// RecordRCEdits to store in status.
+func appendRCFile(path, block string) (err error) {
+	data, err := os.ReadFile(path) // #nosec G304 -- the user's own shell config file
+	existed := err == nil
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("reading %s: %w", path, err)
+	}
+
+	backup := ""
+	if existed {
+		backup = rcBackupPath(path)
+		// An earlier run already backed up the file before any change; keep that copy
+		if !pathExists(backup) {
+			if err := os.MkdirAll(rcBackupDir(), 0o700); err != nil {
+				return fmt.Errorf("backing up %s: %w", path, err)
+			}
+			if err := os.WriteFile(backup, data, 0o600); err != nil {
+				return fmt.Errorf("backing up %s: %w", path, err)
+			}
+		}
+	}
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600) // #nosec G304 -- the user's own shell config file
+	if err != nil {
+		return fmt.Errorf("opening %s: %w", path, err)
+	}
+	defer func() {
+		if cerr := f.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}()
+	if _, err := f.WriteString(block); err != nil {
+		return fmt.Errorf("writing %s: %w", path, err)
+	}
+
+	pendingRCMu.Lock()
+	pendingRCEdits = append(pendingRCEdits, rcEdit{
+		path:     path,
+		backup:   backup,
+		checksum: fileChecksum(append(data, block...)),
+		added:    block,
+	})
+	pendingRCMu.Unlock()
+	return nil
+}
+
+// RecordRCEdits stores the rc file appends made since the last call in
+// status. A file already recorded keeps its original backup.
+func RecordRCEdits(status *Status, blueprint, osName string) {
+	pendingRCMu.Lock()
+	edits := pendingRCEdits
+	pendingRCEdits = nil
+	pendingRCMu.Unlock()
+
+	blueprint = normalizeBlueprint(blueprint)
+	for _, e := range edits {
+		i := slices.IndexFunc(status.RCFiles, func(rc RCFileStatus) bool { return rc.Path == e.path })
+		if i < 0 {
+			status.RCFiles = append(status.RCFiles, RCFileStatus{Path: e.path, Backup: e.backup, Blueprint: blueprint, OS: osName})
+			i = len(status.RCFiles) - 1
+		}
+		rc := &status.RCFiles[i]
+		if e.backup != "" && e.backup != rc.Backup {
+			// The file was created by blueprint; the copy holds only its own lines
+			_ = os.Remove(e.backup)
+		}
+		rc.Checksum = e.checksum
+		rc.Added = append(rc.Added, e.added)
+		rc.ChangedAt = timeutil.Now()
+	}
+}
+
+// RCRollback is the outcome of restoring one rc file.
+type RCRollback struct {
+	Path   string
+	Detail string
+	Err    error
+}
+
+// RollbackRCFiles restores the rc files recorded in status, or only those in
+// paths when any are given. A file nobody touched since blueprint's last
+// change gets its backed up content back byte for byte; one edited since
+// only loses the blocks blueprint appended. Restored files leave status.
+func RollbackRCFiles(status *Status, paths []string, dryRun bool) []RCRollback {
+	wanted := make(map[string]bool, len(paths))
+	for _, p := range paths {
+		wanted[expandPath(p)] = true
+	}
+
+	var results []RCRollback
+	var kept []RCFileStatus
+	for _, rc := range status.RCFiles {
+		if len(wanted) > 0 && !wanted[rc.Path] {
+			kept = append(kept, rc)
+			continue
+		}
+		detail, err := rollbackRCFile(rc, dryRun)
+		results = append(results, RCRollback{Path: rc.Path, Detail: detail, Err: err})
+		if err != nil || dryRun {
+			kept = append(kept, rc)
+		}
+	}
+	status.RCFiles = kept
+	sort.Slice(results, func(i, j int) bool { return results[i].Path < results[j].Path })
+	return results
+}
+
+// rollbackRCFile restores one rc file and deletes its backup.
+func rollbackRCFile(rc RCFileStatus, dryRun bool) (string, error) {
+	data, err := os.ReadFile(rc.Path) // #nosec G304 -- path recorded in status by appendRCFile
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return "", err
+	}
+
+	untouched := fileChecksum(data) == rc.Checksum
+	var restored []byte
+	var detail string
+	switch {
+	case untouched && rc.Backup == "":
+		detail = "removed; it did not exist before"
+	case untouched:
+		if restored, err = os.ReadFile(rc.Backup); err != nil { // #nosec G304 -- backup path recorded in status
+			return "", fmt.Errorf("backup missing: %w", err)
+		}
+		detail = "restored from backup"
+	default:
+		content := string(data)
+		for i := len(rc.Added) - 1; i >= 0; i-- {
+			if idx := strings.LastIndex(content, rc.Added[i]); idx >= 0 {
+				content = content[:idx] + content[idx+len(rc.Added[i]):]
+			}
+		}
+		restored = []byte(content)
+		detail = "changed since; removed blueprint's lines and kept the rest"
+	}
+	if dryRun {
+		return detail, nil
+	}
+
+	if untouched && rc.Backup == "" {
+		if err := os.Remove(rc.Path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return "", err
+		}
+	} else if err := os.WriteFile(rc.Path, restored, 0o600); err != nil {
+		return "", err
+	}
+	if rc.Backup != "" {
+		_ = os.Remove(rc.Backup)
+	}
+	return detail, nil
+}
@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// stubRCBackups keeps rc backups in a temp dir and clears pending edits.
+func stubRCBackups(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	orig := rcBackupDir
+	t.Cleanup(func() {
+		rcBackupDir = orig
+		pendingRCEdits = nil
+	})
+	rcBackupDir = func() string { return filepath.Join(dir, "backups") }
+	pendingRCEdits = nil
+	return dir
+}
+
+func TestRollbackRCFileUntouched(t *testing.T) {
+	dir := stubRCBackups(t)
+	rc := filepath.Join(dir, ".zshrc")
+	original := "export EDITOR=vim\nalias ll='ls -l'" // no trailing newline
+	if err := os.WriteFile(rc, []byte(original), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := appendRCFile(rc, "\n# Homebrew PATH setup\neval \"$(brew shellenv)\"\n"); err != nil {
+		t.Fatalf("appendRCFile() error: %v", err)
+	}
+	status := &Status{}
+	RecordRCEdits(status, "/bp", "mac")
+	if len(status.RCFiles) != 1 || status.RCFiles[0].Backup == "" {
+		t.Fatalf("RCFiles = %+v, want one entry with a backup", status.RCFiles)
+	}
+
+	results := RollbackRCFiles(status, nil, false)
+	if len(results) != 1 || results[0].Err != nil {
+		t.Fatalf("RollbackRCFiles() = %+v", results)
+	}
+	if got, _ := os.ReadFile(rc); string(got) != original {
+		t.Errorf("restored %q, want %q", got, original)
+	}
+	if len(status.RCFiles) != 0 || pathExists(rcBackupPath(rc)) {
+		t.Error("restored file should leave status and its backup should be deleted")
+	}
+}
+
+func TestRollbackRCFileEditedSince(t *testing.T) {
+	dir := stubRCBackups(t)
+	rc := filepath.Join(dir, ".bashrc")
+	if err := os.WriteFile(rc, []byte("export A=1\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	block := "\n# Homebrew PATH setup\neval \"$(brew shellenv)\"\n"
+	if err := appendRCFile(rc, block); err != nil {
+		t.Fatal(err)
+	}
+	status := &Status{}
+	RecordRCEdits(status, "/bp", "linux")
+
+	f, _ := os.OpenFile(rc, os.O_APPEND|os.O_WRONLY, 0o600)
+	_, _ = f.WriteString("export B=2\n")
+	_ = f.Close()
+
+	results := RollbackRCFiles(status, []string{rc}, false)
+	if len(results) != 1 || results[0].Err != nil || !strings.Contains(results[0].Detail, "changed since") {
+		t.Fatalf("RollbackRCFiles() = %+v", results)
+	}
+	if got, _ := os.ReadFile(rc); string(got) != "export A=1\nexport B=2\n" {
+		t.Errorf("restored %q, want the user's lines kept", got)
+	}
+}
+
+func TestRollbackRCFileCreated(t *testing.T) {
+	dir := stubRCBackups(t)
+	rc := filepath.Join(dir, ".profile")
+	if err := appendRCFile(rc, "eval \"$(brew shellenv)\"\n"); err != nil {
+		t.Fatal(err)
+	}
+	// A second run appends to the file blueprint created; it is still removed
+	if err := appendRCFile(rc, "export X=1\n"); err != nil {
+		t.Fatal(err)
+	}
+	status := &Status{}
+	RecordRCEdits(status, "/bp", "linux")
+	if len(status.RCFiles) != 1 || status.RCFiles[0].Backup != "" || len(status.RCFiles[0].Added) != 2 {
+		t.Fatalf("RCFiles = %+v", status.RCFiles)
+	}
+
+	dry := RollbackRCFiles(status, nil, true)
+	if len(dry) != 1 || !pathExists(rc) || len(status.RCFiles) != 1 {
+		t.Fatalf("dry run changed something: %+v", dry)
+	}
+
+	if results := RollbackRCFiles(status, nil, false); len(results) != 1 || results[0].Err != nil {
+		t.Fatalf("RollbackRCFiles() = %+v", results)
+	}
+	if pathExists(rc) {
+		t.Error("file created by blueprint should be removed")
+	}
+}
@@ -0,0 +1,249 @@
+package handlers
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/elpic/blueprint/internal/parser"
+)
+
+// Outcomes of refreshing one key.
+const (
+	KeyUnchanged = "unchanged" // the published key is the installed one
+	KeyUpdated   = "updated"   // same key, new signatures or expiry
+	KeyRotated   = "rotated"   // the vendor publishes a different key now
+	KeyExpired   = "expired"   // the key has no valid signing key, even after refreshing
+	KeyFailed    = "failed"
+)
+
+// KeyRefresh is the outcome of re-downloading the key of a gpg_key or repo
+// rule and comparing it with the installed copy.
+type KeyRefresh struct {
+	Name    string // keyring or repository name
+	Action  string // "gpg_key" or "repo"
+	Path    string // installed key file
+	URL     string
+	Manager string // package manager whose cache the key invalidates
+	Result  string
+	Detail  string
+
+	fingerprint string // pinned by the rule, if any
+}
+
+// fetchKey downloads the key published at url.
+var fetchKey = func(url string) ([]byte, error) {
+	out, err := exec.Command("curl", "-fsSL", url).Output() // #nosec G204 -- URL comes from the user's own status file
+	if err != nil {
+		return nil, fmt.Errorf("curl failed: %w", err)
+	}
+	return out, nil
+}
+
+// keyExpired reports whether none of the keys in data can still sign
+// packages at now, because they expired or were revoked. apt rejects a
+// repository signed only by such keys.
+func keyExpired(data []byte, now time.Time) bool {
+	entities, err := openpgp.ReadArmoredKeyRing(bytes.NewReader(data))
+	if err != nil {
+		if entities, err = openpgp.ReadKeyRing(bytes.NewReader(data)); err != nil {
+			return false
+		}
+	}
+	for _, e := range entities {
+		if _, ok := e.SigningKey(now); ok {
+			return false
+		}
+	}
+	return len(entities) > 0
+}
+
+// sameFingerprints reports whether two keys hold the same primary keys.
+func sameFingerprints(a, b []byte) bool {
+	fa, errA := keyFingerprints(a)
+	fb, errB := keyFingerprints(b)
+	if errA != nil || errB != nil || len(fa) != len(fb) {
+		return false
+	}
+	sort.Strings(fa)
+	sort.Strings(fb)
+	for i := range fa {
+		if fa[i] != fb[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// keyRefreshTargets lists the keys gpg_key and repo rules installed for
+// osName. A dnf repository only has a key file of its own when its
+// fingerprint is pinned; otherwise dnf fetches the URL itself.
+func keyRefreshTargets(status *Status, osName string) []KeyRefresh {
+	var targets []KeyRefresh
+	seen := map[string]bool{}
+	add := func(t KeyRefresh) {
+		if t.URL == "" || seen[t.Path] {
+			return
+		}
+		seen[t.Path] = true
+		targets = append(targets, t)
+	}
+	for _, k := range status.GPGKeys {
+		if k.OS != osName {
+			continue
+		}
+		h := NewGPGKeyHandler(parser.Rule{GPGKeyring: k.Keyring}, "")
+		add(KeyRefresh{Name: k.Keyring, Action: "gpg_key", Path: h.keyringPath(), URL: k.URL, Manager: "apt", fingerprint: k.Fingerprint})
+	}
+	for _, r := range status.Repos {
+		if r.OS != osName {
+			continue
+		}
+		h := NewRepoHandler(parser.Rule{RepoName: r.Name}, "")
+		path := h.keyPath()
+		if r.Type == "dnf" {
+			if r.Fingerprint == "" {
+				continue
+			}
+			path = h.dnfKeyPath()
+		}
+		add(KeyRefresh{Name: r.Name, Action: "repo", Path: path, URL: r.KeyURL, Manager: r.Type, fingerprint: r.Fingerprint})
+	}
+	return targets
+}
+
+// RefreshKeys re-downloads the key of every gpg_key and repo rule recorded
+// in status for osName and compares it with the installed copy. A key the
+// vendor has re-published or rotated replaces the installed one unless
+// dryRun is set, and the package caches it feeds are marked for refresh
+// (see RefreshPackageCaches). A rotated key that no longer has the
+// fingerprint the rule pinned is never installed.
+func RefreshKeys(status *Status, osName string, dryRun bool, sudoPassword string, now time.Time) []KeyRefresh {
+	targets := keyRefreshTargets(status, osName)
+	for i := range targets {
+		t := &targets[i]
+		t.Result, t.Detail = refreshKey(t, dryRun, sudoPassword, now)
+		if !dryRun && (t.Result == KeyUpdated || t.Result == KeyRotated) {
+			requestCacheRefresh(t.Manager, sudoPassword)
+		}
+	}
+	return targets
+}
+
+// refreshKey refreshes one target and returns its result and a detail line.
+func refreshKey(t *KeyRefresh, dryRun bool, sudoPassword string, now time.Time) (string, string) {
+	installed := []byte(fileContent(t.Path))
+	if len(installed) == 0 {
+		return KeyFailed, fmt.Sprintf("%s is missing; run blueprint apply to install it", t.Path)
+	}
+	published, err := fetchKey(t.URL)
+	if err != nil {
+		return KeyFailed, err.Error()
+	}
+	if _, err := keyFingerprints(published); err != nil {
+		return KeyFailed, fmt.Sprintf("%s: %v", t.URL, err)
+	}
+	if bytes.Equal(published, installed) {
+		if keyExpired(installed, now) {
+			return KeyExpired, "the vendor has not published a new key yet"
+		}
+		return KeyUnchanged, ""
+	}
+	if err := checkKeyFingerprint(published, t.fingerprint); err != nil {
+		return KeyFailed, fmt.Sprintf("%v; update fingerprint: in the blueprint once the new key is confirmed", err)
+	}
+	if keyExpired(published, now) {
+		return KeyExpired, "the published key has expired too"
+	}
+
+	result, detail := KeyUpdated, "re-published with new signatures"
+	if !sameFingerprints(published, installed) {
+		fprs, _ := keyFingerprints(published)
+		result, detail = KeyRotated, "new key "+strings.Join(fprs, ", ")
+	}
+	if dryRun {
+		return result, detail
+	}
+	if err := writeRootFile(t.Path, string(published), sudoPassword); err != nil {
+		return KeyFailed, fmt.Sprintf("failed to write %s: %v", t.Path, err)
+	}
+	return result, detail
+}
+
+// refreshKeysLogPath returns the path to the scheduled key refresh log file
+func refreshKeysLogPath() string {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "~/.blueprint/refresh-keys.log"
+	}
+	return filepath.Join(homeDir, ".blueprint", "refresh-keys.log")
+}
+
+// refreshKeysCronLine returns the crontab line that runs refresh-keys every
+// period (daily, weekly or hourly).
+func refreshKeysCronLine(every string) string {
+	return fmt.Sprintf("@%s %s refresh-keys >> %s 2>&1", every, blueprintBinary(), refreshKeysLogPath())
+}
+
+// isRefreshKeysCronLine reports whether a crontab line runs refresh-keys.
+func isRefreshKeysCronLine(line string) bool {
+	return strings.Contains(line, " refresh-keys >> ")
+}
+
+// ScheduleKeyRefreshWithCrontab installs a crontab entry running
+// refresh-keys every period, replacing one installed before, using
+// injectable crontab functions. An empty every removes the entry.
+func ScheduleKeyRefreshWithCrontab(every string, readCron func() (string, error), writeCron func(string) error) (string, error) {
+	switch every {
+	case "", "daily", "weekly", "hourly":
+	default:
+		return "", fmt.Errorf("invalid schedule %q: use daily, weekly or hourly", every)
+	}
+	current, err := readCron()
+	if err != nil {
+		return "", fmt.Errorf("failed to read crontab: %w", err)
+	}
+
+	var kept []string
+	removed := false
+	for _, l := range strings.Split(strings.TrimRight(current, "\n"), "\n") {
+		if isRefreshKeysCronLine(l) {
+			removed = true
+			continue
+		}
+		if l != "" || len(kept) > 0 {
+			kept = append(kept, l)
+		}
+	}
+	var msg string
+	if every == "" {
+		if !removed {
+			return "no scheduled key refresh to remove", nil
+		}
+		msg = "Removed scheduled key refresh"
+	} else {
+		line := refreshKeysCronLine(every)
+		kept = append(kept, line)
+		msg = fmt.Sprintf("Scheduled key refresh: %s", line)
+	}
+	newContent := strings.Join(kept, "\n")
+	if newContent != "" {
+		newContent += "\n"
+	}
+	if err := writeCron(newContent); err != nil {
+		return "", err
+	}
+	return msg, nil
+}
+
+// ScheduleKeyRefresh installs, or with an empty every removes, the crontab
+// entry that runs refresh-keys.
+func ScheduleKeyRefresh(every string) (string, error) {
+	return ScheduleKeyRefreshWithCrontab(every, readCrontab, writeCrontab)
+}
@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+)
+
+func stubFetchKey(t *testing.T, published map[string]string) {
+	t.Helper()
+	orig := fetchKey
+	t.Cleanup(func() { fetchKey = orig })
+	fetchKey = func(url string) ([]byte, error) { return []byte(published[url]), nil }
+}
+
+func TestRefreshKeys(t *testing.T) {
+	oldKey, oldFpr := testArmoredKey(t)
+	newKey, newFpr := testArmoredKey(t)
+	files := map[string]string{
+		"/etc/apt/keyrings/same.asc":    oldKey,
+		"/etc/apt/keyrings/rotated.asc": oldKey,
+		"/etc/apt/keyrings/pinned.asc":  oldKey,
+	}
+	stubRepoSystem(t, nil, files)
+	stubFetchKey(t, map[string]string{
+		"https://example.com/same.asc":    oldKey,
+		"https://example.com/rotated.asc": newKey,
+		"https://example.com/pinned.asc":  newKey,
+	})
+
+	status := &Status{
+		GPGKeys: []GPGKeyStatus{
+			{Keyring: "same", URL: "https://example.com/same.asc", OS: "linux"},
+			{Keyring: "rotated", URL: "https://example.com/rotated.asc", OS: "linux"},
+			{Keyring: "other-os", URL: "https://example.com/same.asc", OS: "mac"},
+		},
+		Repos: []RepoStatus{
+			{Name: "pinned", Type: "apt", KeyURL: "https://example.com/pinned.asc", Fingerprint: oldFpr, OS: "linux"},
+			{Name: "missing", Type: "apt", KeyURL: "https://example.com/same.asc", OS: "linux"},
+			{Name: "dnf-unpinned", Type: "dnf", KeyURL: "https://example.com/same.asc", OS: "linux"},
+		},
+	}
+
+	results := RefreshKeys(status, "linux", false, "", time.Now())
+	got := map[string]KeyRefresh{}
+	for _, r := range results {
+		got[r.Name] = r
+	}
+	if len(results) != 4 {
+		t.Fatalf("RefreshKeys() returned %d results, want 4: %+v", len(results), results)
+	}
+	if got["same"].Result != KeyUnchanged {
+		t.Errorf("same = %+v, want unchanged", got["same"])
+	}
+	if got["rotated"].Result != KeyRotated || !strings.Contains(got["rotated"].Detail, newFpr) {
+		t.Errorf("rotated = %+v, want rotated to %s", got["rotated"], newFpr)
+	}
+	if files["/etc/apt/keyrings/rotated.asc"] != newKey {
+		t.Error("a rotated key should replace the installed one")
+	}
+	if got["pinned"].Result != KeyFailed || files["/etc/apt/keyrings/pinned.asc"] != oldKey {
+		t.Errorf("pinned = %+v, a key without the pinned fingerprint must not be installed", got["pinned"])
+	}
+	if got["missing"].Result != KeyFailed {
+		t.Errorf("missing = %+v, want failed", got["missing"])
+	}
+	if _, ok := pendingRefreshes["apt"]; !ok {
+		t.Error("a replaced key should schedule an apt cache refresh")
+	}
+}
+
+func TestRefreshKeysDryRun(t *testing.T) {
+	oldKey, _ := testArmoredKey(t)
+	newKey, _ := testArmoredKey(t)
+	files := map[string]string{"/etc/apt/keyrings/vendor.asc": oldKey}
+	stubRepoSystem(t, nil, files)
+	stubFetchKey(t, map[string]string{"https://example.com/vendor.asc": newKey})
+
+	status := &Status{GPGKeys: []GPGKeyStatus{{Keyring: "vendor", URL: "https://example.com/vendor.asc", OS: "linux"}}}
+	results := RefreshKeys(status, "linux", true, "", time.Now())
+	if len(results) != 1 || results[0].Result != KeyRotated {
+		t.Fatalf("RefreshKeys() = %+v, want rotated", results)
+	}
+	if files["/etc/apt/keyrings/vendor.asc"] != oldKey || len(pendingRefreshes) != 0 {
+		t.Error("a dry run must not replace keys or refresh caches")
+	}
+}
+
+func TestKeyExpired(t *testing.T) {
+	entity, err := openpgp.NewEntity("Repo", "", "repo@example.com", &packet.Config{Algorithm: packet.PubKeyAlgoEdDSA, KeyLifetimeSecs: 3600})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	w, err := armor.Encode(&buf, openpgp.PublicKeyType, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := entity.Serialize(w); err != nil {
+		t.Fatal(err)
+	}
+	_ = w.Close()
+
+	if keyExpired(buf.Bytes(), time.Now()) {
+		t.Error("keyExpired() = true for a key valid for another hour")
+	}
+	if !keyExpired(buf.Bytes(), time.Now().Add(2*time.Hour)) {
+		t.Error("keyExpired() = false after the key's lifetime")
+	}
+}
+
+func TestScheduleKeyRefreshWithCrontab(t *testing.T) {
+	crontab := "@daily other-job\n"
+	read := func() (string, error) { return crontab, nil }
+	write := func(s string) error { crontab = s; return nil }
+
+	if _, err := ScheduleKeyRefreshWithCrontab("daily", read, write); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ScheduleKeyRefreshWithCrontab("weekly", read, write); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Count(crontab, " refresh-keys >> ") != 1 || !strings.Contains(crontab, "@weekly ") || !strings.HasPrefix(crontab, "@daily other-job\n") {
+		t.Errorf("crontab = %q, want one weekly refresh-keys line after other-job", crontab)
+	}
+
+	if _, err := ScheduleKeyRefreshWithCrontab("", read, write); err != nil {
+		t.Fatal(err)
+	}
+	if crontab != "@daily other-job\n" {
+		t.Errorf("crontab after unschedule = %q", crontab)
+	}
+	if _, err := ScheduleKeyRefreshWithCrontab("monthly", read, write); err == nil {
+		t.Error("an unknown period should be rejected")
+	}
+}
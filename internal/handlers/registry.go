@@ -23,20 +23,102 @@ type SummaryFunc func(rule parser.Rule) string
 // Call index(key) for each key this rule contributes.
 type OrphanIndexFunc func(rule parser.Rule, index func(key string))
 
+// VerifyFunc reports whether the resource a status entry records is still
+// present on this machine. It is only called with entries of its own action.
+type VerifyFunc func(entry StatusEntry) bool
+
+// RefreshFunc updates the details recorded in status entries of its own
+// action (installed versions, commit SHAs) from this machine, and returns one
+// line describing each change it made.
+type RefreshFunc func(entries []StatusEntry) []string
+
 // ShellExportFunc returns shell commands for a rule. format is "bash" or "sh".
 // osName is "mac" or "linux". Returns nil to emit a skip comment.
 type ShellExportFunc func(rule parser.Rule, format, osName string) []string
 
+// AttrMeta documents one attribute keyword an action accepts.
+type AttrMeta struct {
+	Name        string // keyword without the colon, e.g. "to"
+	Type        string // string, bool, path, list, octal, cron, duration or int
+	Default     string // value used when the attribute is omitted; "" for none
+	Required    bool
+	Description string
+}
+
+// ActionMeta describes an action for `blueprint help-rules` and editor
+// tooling. Attrs lists the action's own attributes; CommonAttrs are accepted
+// by every action and are not repeated here.
+type ActionMeta struct {
+	Summary  string
+	Usage    string
+	Attrs    []AttrMeta
+	Examples []string
+	OS       []string // supported operating systems; nil means all of them
+	Doc      string   // page under docs/, "" when there is none
+}
+
+// docsBaseURL is where the per-action documentation pages are published.
+const docsBaseURL = "https://github.com/elpic/blueprint/blob/main/docs/"
+
+// DocURL returns the link to the action's documentation page, or "".
+func (m ActionMeta) DocURL() string {
+	if m.Doc == "" {
+		return ""
+	}
+	return docsBaseURL + m.Doc
+}
+
+// Keyword returns the attribute as written in a blueprint, e.g. "to:".
+func (a AttrMeta) Keyword() string {
+	return a.Name + ":"
+}
+
+// CommonAttrs are the attributes every rule accepts.
+var CommonAttrs = []AttrMeta{
+	{Name: "id", Type: "string", Description: "Unique name other rules can reference in after:"},
+	{Name: "after", Type: "list", Description: "Comma-separated ids or resources this rule runs after"},
+	{Name: "on", Type: "list", Description: "Operating systems the rule applies to, e.g. [mac, linux]"},
+	{Name: "arch", Type: "list", Description: "CPU architectures the rule applies to, e.g. [arm64] for Apple Silicon"},
+	{Name: "aliases", Type: "list", Description: "Previous ids or resource keys, so a rename is not an uninstall + install"},
+	{Name: "group", Type: "string", Description: "Group name, skippable with --skip-group; set for every rule of a group { } block"},
+	{Name: "sensitive", Type: "bool", Default: "false", Description: "true keeps the rule's output out of history and hides it in the terminal"},
+	{Name: "timeout", Type: "duration", Description: "Longest one attempt may run, e.g. 120s or 5m; the rule fails when it is exceeded"},
+	{Name: "retries", Type: "int", Default: "0", Description: "Times a failed attempt is retried, waiting 2s, 4s, 8s... in between"},
+	{Name: "on-failure", Type: "string", Description: "Id of a rule that runs only if this one fails, in its place"},
+	{Name: "expect-changed", Type: "bool", Description: "false flags the rule when it changes something again with nothing edited; true exempts it from --detect-flapping"},
+}
+
+// transactionAttr is accepted by actions whose handlers implement Stager.
+var transactionAttr = AttrMeta{
+	Name:        "transaction",
+	Type:        "string",
+	Description: "Group name; the group's files are moved into place only if all its rules succeed",
+}
+
+// jobsAttr is accepted by actions whose rules list several independent
+// targets, which their handlers can process one by one (see runTargets).
+var jobsAttr = AttrMeta{
+	Name:        "jobs",
+	Type:        "int",
+	Description: "Targets processed at once; each then succeeds or fails on its own instead of the rule as a whole",
+}
+
 // ActionDef captures everything the system needs to know about one action type.
 type ActionDef struct {
 	Name        string
 	Prefix      string // e.g. "install ", "clone ", "sudoers"
+	Meta        ActionMeta
 	NewHandler  HandlerFactory
 	RuleKey     RuleKeyFunc
 	Detect      DetectFunc
 	Summary     SummaryFunc
 	OrphanIndex OrphanIndexFunc
 	ShellExport ShellExportFunc
+	// Verify backs `blueprint status --check`. Entries of actions without it
+	// are reported as not verifiable and keep their verified time.
+	Verify VerifyFunc
+	// Refresh backs `blueprint apply --refresh-only`, together with Verify.
+	Refresh RefreshFunc
 	// OrphanCheckExcluded skips key-based orphan detection for this action.
 	// Set this when the status entry's resource key format cannot be matched
 	// against the keys produced by OrphanIndex (e.g. asdf/mise store
@@ -74,6 +156,9 @@ func RegisterAction(def ActionDef) {
 		if def.Summary == nil {
 			panic("registry: " + def.Name + " must have Summary")
 		}
+		if def.Meta.Summary == "" || def.Meta.Usage == "" {
+			panic("registry: " + def.Name + " must have Meta with Summary and Usage")
+		}
 	}
 	d := def
 	registryByName[def.Name] = &d
@@ -96,6 +181,18 @@ func AllActions() []*ActionDef {
 	return out
 }
 
+// DocumentedActions returns the actions users write in blueprints, in
+// registration order: everything except aliases and the internal uninstall.
+func DocumentedActions() []*ActionDef {
+	var out []*ActionDef
+	for _, def := range AllActions() {
+		if !def.IsAlias && def.Name != "uninstall" {
+			out = append(out, def)
+		}
+	}
+	return out
+}
+
 // RuleSummary returns a short human-readable description of the rule for diff/plan output.
 // It delegates to the registered Summary func for the rule's action. For "uninstall" rules
 // it resolves the underlying action type via DetectRuleType so the correct Summary is used.
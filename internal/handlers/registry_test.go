@@ -1,6 +1,8 @@
 package handlers
 
 import (
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/elpic/blueprint/internal/parser"
@@ -140,3 +142,52 @@ func TestRegistryGetStatusProviderHandlers(t *testing.T) {
 		t.Errorf("GetStatusProviderHandlers() returned %d handlers, want at least 15", len(handlers))
 	}
 }
+
+// TestRegistryMetadataMatchesParser keeps help-rules honest: every directive
+// the parser knows is documented, documented pages exist, attribute names do
+// not shadow the common ones, and every example parses to its own action.
+func TestRegistryMetadataMatchesParser(t *testing.T) {
+	documented := map[string]*ActionDef{}
+	for _, def := range DocumentedActions() {
+		documented[def.Name] = def
+	}
+	for _, name := range parser.Directives() {
+		if documented[name] == nil {
+			t.Errorf("parser directive %q has no documented action", name)
+		}
+	}
+
+	common := map[string]bool{}
+	for _, attr := range CommonAttrs {
+		common[attr.Name] = true
+	}
+	for name, def := range documented {
+		meta := def.Meta
+		if meta.Doc != "" {
+			if _, err := os.Stat(filepath.Join("..", "..", "docs", meta.Doc)); err != nil {
+				t.Errorf("%s: documentation page %s not found", name, meta.Doc)
+			}
+		}
+		for _, attr := range meta.Attrs {
+			if common[attr.Name] {
+				t.Errorf("%s: attribute %q duplicates a common attribute", name, attr.Name)
+			}
+			if attr.Type == "" || attr.Description == "" {
+				t.Errorf("%s: attribute %q needs a type and description", name, attr.Name)
+			}
+		}
+		if len(meta.Examples) == 0 {
+			t.Errorf("%s: no examples", name)
+		}
+		for _, example := range meta.Examples {
+			rules, err := parser.Parse(example)
+			if err != nil {
+				t.Errorf("%s: example %q does not parse: %v", name, example, err)
+				continue
+			}
+			if len(rules) != 1 || rules[0].Action != name {
+				t.Errorf("%s: example %q parsed to %+v", name, example, rules)
+			}
+		}
+	}
+}
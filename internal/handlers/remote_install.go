@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"fmt"
+	"os"
+)
+
+// RemoteInstallPolicy is how handlers treat installers fetched at run time.
+// The engine sets it from the [security] section of ~/.blueprint/config.
+type RemoteInstallPolicy struct {
+	// ForbidRemoteScripts refuses every install that runs a script downloaded
+	// at run time: run-sh rules and the installers of Homebrew, mise and ollama.
+	ForbidRemoteScripts bool
+	// AsdfVersion is the asdf release installed on Linux; empty is the latest.
+	AsdfVersion string
+	// AsdfSHA256 is the sha256 the asdf release archive must have.
+	AsdfSHA256 string
+	// HomebrewInstallRef is the commit or tag of Homebrew/install whose
+	// install.sh is run; empty is HEAD.
+	HomebrewInstallRef string
+	// HomebrewInstallSHA256 is the sha256 install.sh must have.
+	HomebrewInstallSHA256 string
+}
+
+// remoteInstallPolicy is the policy of the current run.
+var remoteInstallPolicy RemoteInstallPolicy
+
+// SetRemoteInstallPolicy sets how installers fetched at run time are checked.
+func SetRemoteInstallPolicy(policy RemoteInstallPolicy) {
+	remoteInstallPolicy = policy
+}
+
+// checkRemoteScriptAllowed returns an error when the policy forbids running
+// the script at url; what says what would run it.
+func checkRemoteScriptAllowed(what, url string) error {
+	if remoteInstallPolicy.ForbidRemoteScripts {
+		return fmt.Errorf("%s runs the script %s, which forbid-remote-scripts in ~/.blueprint/config does not allow", what, url)
+	}
+	return nil
+}
+
+// verifyFileSHA256 checks the file at path against the sha256 want, in
+// lowercase hex. An empty want passes.
+func verifyFileSHA256(path, want string) error {
+	if want == "" {
+		return nil
+	}
+	data, err := os.ReadFile(path) // #nosec G304 -- file blueprint just downloaded
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	if got := fileChecksum(data); got != want {
+		return fmt.Errorf("sha256 of %s is %s, want %s", path, got, want)
+	}
+	return nil
+}
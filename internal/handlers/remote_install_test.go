@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/elpic/blueprint/internal/parser"
+)
+
+func setTestRemoteInstallPolicy(t *testing.T, policy RemoteInstallPolicy) {
+	t.Helper()
+	orig := remoteInstallPolicy
+	t.Cleanup(func() { remoteInstallPolicy = orig })
+	SetRemoteInstallPolicy(policy)
+}
+
+func TestForbidRemoteScripts(t *testing.T) {
+	setTestRemoteInstallPolicy(t, RemoteInstallPolicy{ForbidRemoteScripts: true})
+
+	err := runHomebrewInstallScript()
+	if err == nil || !strings.Contains(err.Error(), "forbid-remote-scripts") {
+		t.Errorf("runHomebrewInstallScript() error = %v, want it forbidden", err)
+	}
+	h := NewRunShHandler(parser.Rule{Action: "run-sh", RunShURL: "https://example.com/install.sh"}, "")
+	if _, err := h.Up(); err == nil || !strings.Contains(err.Error(), "https://example.com/install.sh") {
+		t.Errorf("run-sh Up() error = %v, want it forbidden", err)
+	}
+}
+
+func TestHomebrewInstallURL(t *testing.T) {
+	setTestRemoteInstallPolicy(t, RemoteInstallPolicy{})
+	if got := homebrewInstallURL(); got != "https://raw.githubusercontent.com/Homebrew/install/HEAD/install.sh" {
+		t.Errorf("homebrewInstallURL() = %q", got)
+	}
+	setTestRemoteInstallPolicy(t, RemoteInstallPolicy{HomebrewInstallRef: "4.4.0"})
+	if got := homebrewInstallURL(); got != "https://raw.githubusercontent.com/Homebrew/install/4.4.0/install.sh" {
+		t.Errorf("homebrewInstallURL() pinned = %q", got)
+	}
+}
+
+func TestAsdfTargetVersionPinned(t *testing.T) {
+	setTestRemoteInstallPolicy(t, RemoteInstallPolicy{AsdfVersion: "v0.16.7"})
+	if got, err := asdfTargetVersion(); err != nil || got != "0.16.7" {
+		t.Errorf("asdfTargetVersion() = %q, %v; want the pinned 0.16.7", got, err)
+	}
+}
+
+func TestVerifyFileSHA256(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "install.sh")
+	if err := os.WriteFile(path, []byte("echo hi\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := verifyFileSHA256(path, ""); err != nil {
+		t.Errorf("no checksum should pass, got %v", err)
+	}
+	if err := verifyFileSHA256(path, fileChecksum([]byte("echo hi\n"))); err != nil {
+		t.Errorf("matching checksum error = %v", err)
+	}
+	if err := verifyFileSHA256(path, strings.Repeat("0", 64)); err == nil {
+		t.Error("expected a mismatching checksum to fail")
+	}
+}
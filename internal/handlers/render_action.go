@@ -15,6 +15,19 @@ func init() {
 	RegisterAction(ActionDef{
 		Name:   "render",
 		Prefix: "render ",
+		Meta: ActionMeta{
+			Summary: "Render a template file or directory with blueprint data.",
+			Usage:   "render <template> [output: <path>] [var: KEY=VALUE, ...]",
+			Attrs: []AttrMeta{
+				{Name: "output", Type: "path", Default: ".", Description: "Output destination"},
+				{Name: "var", Type: "list", Description: "KEY=VALUE overrides, comma-separated"},
+				transactionAttr,
+			},
+			Examples: []string{
+				"render templates/gitconfig.tmpl output: ~/.gitconfig var: EMAIL=me@example.com",
+			},
+			Doc: "render.md",
+		},
 		NewHandler: func(rule parser.Rule, basePath string, passwordCache map[string]string) Handler {
 			return NewRenderActionHandler(rule, basePath)
 		},
@@ -90,6 +103,26 @@ func (h *RenderActionHandler) Up() (string, error) {
 	return fmt.Sprintf("rendered templates from %s to %s", h.Rule.RenderTemplate, output), nil
 }
 
+// Staged returns a copy of the handler that renders into the staged output.
+func (h *RenderActionHandler) Staged(stage func(dest string) (string, error)) (Handler, error) {
+	output := h.Rule.RenderOutput
+	if output == "" {
+		output = "."
+	}
+	staged, err := stage(expandPath(output))
+	if err != nil {
+		return nil, err
+	}
+	c := *h
+	c.Rule.RenderOutput = staged
+	return &c, nil
+}
+
+// Irreversible reports that rendered files are not removed.
+func (h *RenderActionHandler) Irreversible() string {
+	return "rendered files are not removed"
+}
+
 // Down is a no-op — rendered files are not removed on cleanup.
 func (h *RenderActionHandler) Down() (string, error) {
 	return "render: nothing to undo", nil
@@ -114,12 +147,12 @@ func (h *RenderActionHandler) UpdateStatus(status *Status, records []ExecutionRe
 
 // DisplayInfo prints the template and output paths.
 func (h *RenderActionHandler) DisplayInfo() {
-	fmt.Printf("  %s\n", ui.FormatInfo(fmt.Sprintf("Template: %s", h.Rule.RenderTemplate)))
+	fmt.Printf("  %s\n", ui.FormatInfo("Template: "+ui.Fit(ui.AbbreviateHome(h.Rule.RenderTemplate), 12)))
 	out := h.Rule.RenderOutput
 	if out == "" {
 		out = "."
 	}
-	fmt.Printf("  %s\n", ui.FormatInfo(fmt.Sprintf("Output:   %s", out)))
+	fmt.Printf("  %s\n", ui.FormatInfo("Output:   "+ui.Fit(ui.AbbreviateHome(out), 12)))
 	for _, v := range h.Rule.RenderVars {
 		fmt.Printf("  %s\n", ui.FormatInfo(fmt.Sprintf("Var:      %s", v)))
 	}
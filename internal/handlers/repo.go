@@ -0,0 +1,618 @@
+package handlers
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/elpic/blueprint/internal/parser"
+	"github.com/elpic/blueprint/internal/ui"
+	"github.com/elpic/blueprint/internal/ui/timeutil"
+)
+
+func init() {
+	RegisterAction(ActionDef{
+		Name:   "repo",
+		Prefix: "repo ",
+		Meta: ActionMeta{
+			Summary: "Add a signed apt or dnf package repository.",
+			Usage:   "repo <name> url: <repo-url> key: <key-url> [type: apt|dnf] [suite: <suite>] [components: <c1, c2>] [fingerprint: <fpr>]",
+			Attrs: []AttrMeta{
+				{Name: "url", Type: "string", Required: true, Description: "Repository base URL"},
+				{Name: "key", Type: "string", Required: true, Description: "URL of the key the repository is signed with"},
+				{Name: "type", Type: "string", Description: "apt or dnf; detected from the distro family when omitted"},
+				{Name: "suite", Type: "string", Description: "apt suite; defaults to the distro codename"},
+				{Name: "components", Type: "list", Default: "main", Description: "Comma-separated apt components"},
+				fingerprintAttr,
+			},
+			Examples: []string{
+				"repo docker url: https://download.docker.com/linux/ubuntu key: https://download.docker.com/linux/ubuntu/gpg type: apt components: stable",
+				"repo vscode url: https://packages.microsoft.com/yumrepos/vscode key: https://packages.microsoft.com/keys/microsoft.asc type: dnf",
+			},
+			OS:  []string{"linux"},
+			Doc: "repo.md",
+		},
+		NewHandler: func(rule parser.Rule, basePath string, passwordCache map[string]string) Handler {
+			sudoPassword := ""
+			if passwordCache != nil {
+				sudoPassword = passwordCache["sudo"]
+			}
+			return NewRepoHandlerWithPassword(rule, basePath, sudoPassword)
+		},
+		RuleKey: func(rule parser.Rule) string {
+			return rule.RepoName
+		},
+		Detect: func(rule parser.Rule) bool {
+			return rule.RepoName != ""
+		},
+		Summary: func(rule parser.Rule) string {
+			return rule.RepoName
+		},
+		OrphanIndex: func(rule parser.Rule, index func(string)) {
+			index(rule.RepoName)
+		},
+		Verify: func(e StatusEntry) bool {
+			repo := e.(*RepoStatus)
+			return pathExists(NewRepoHandler(parser.Rule{RepoName: repo.Name}, "").sourcePath(repo.Type))
+		},
+		ShellExport: func(rule parser.Rule, _, osName string) []string {
+			if osName != "linux" {
+				return nil
+			}
+			h := NewRepoHandler(rule, "")
+			apt := []string{"sudo install -m 0755 -d /etc/apt/keyrings"}
+			apt = append(apt, exportKeyLines(rule.RepoKeyURL, h.keyPath(), rule.RepoKeyFingerprint)...)
+			apt = append(apt,
+				fmt.Sprintf(`printf '%%s\n' 'Types: deb' %s "Suites: %s" %s %s | sudo tee %s > /dev/null`,
+					shellQ("URIs: "+rule.RepoURL), h.exportSuite(), shellQ("Components: "+h.components()),
+					shellQ("Signed-By: "+h.keyPath()), h.aptSourcePath()),
+				"sudo apt-get update",
+			)
+			var dnf []string
+			if rule.RepoKeyFingerprint != "" {
+				dnf = exportKeyLines(rule.RepoKeyURL, h.dnfKeyPath(), rule.RepoKeyFingerprint)
+			}
+			dnf = append(dnf,
+				fmt.Sprintf(`printf '%%s\n' %s | sudo tee %s > /dev/null`, h.quotedDnfLines(), h.dnfRepoPath()),
+				"sudo dnf makecache",
+			)
+			switch rule.RepoType {
+			case "apt":
+				return apt
+			case "dnf":
+				return dnf
+			}
+			lines := []string{"if command -v apt-get >/dev/null 2>&1; then"}
+			for _, l := range apt {
+				lines = append(lines, "  "+l)
+			}
+			lines = append(lines, "else")
+			for _, l := range dnf {
+				lines = append(lines, "  "+l)
+			}
+			return append(lines, "fi")
+		},
+	})
+}
+
+// RepoHandler configures an apt (deb822 .sources) or dnf (.repo) package
+// repository and its signing key. The package cache is not refreshed per
+// rule: every repo changed in a wave is refreshed once by the engine through
+// RefreshPackageCaches before dependent rules run.
+type RepoHandler struct {
+	BaseHandler
+	sudoPassword string
+}
+
+// NewRepoHandler creates a new repo handler
+func NewRepoHandler(rule parser.Rule, basePath string) *RepoHandler {
+	return &RepoHandler{
+		BaseHandler: BaseHandler{
+			Rule:     rule,
+			BasePath: basePath,
+		},
+	}
+}
+
+// NewRepoHandlerWithPassword creates a new repo handler with a cached sudo password.
+func NewRepoHandlerWithPassword(rule parser.Rule, basePath, sudoPassword string) *RepoHandler {
+	h := NewRepoHandler(rule, basePath)
+	h.sudoPassword = sudoPassword
+	return h
+}
+
+// readOSRelease returns the key/value pairs of /etc/os-release.
+var readOSRelease = func() map[string]string {
+	data, err := os.ReadFile("/etc/os-release")
+	if err != nil {
+		return map[string]string{}
+	}
+	return parseOSRelease(data)
+}
+
+// repoFamily returns the package manager family of the running distro,
+// "apt" or "dnf", or "" when it cannot be told from /etc/os-release.
+func repoFamily() string {
+	release := readOSRelease()
+	for _, id := range strings.Fields(release["ID"] + " " + release["ID_LIKE"]) {
+		switch id {
+		case "debian", "ubuntu":
+			return "apt"
+		case "fedora", "rhel", "centos":
+			return "dnf"
+		}
+	}
+	return ""
+}
+
+// repoType returns the rule's type:, or the detected distro family.
+func (h *RepoHandler) repoType() string {
+	if h.Rule.RepoType != "" {
+		return h.Rule.RepoType
+	}
+	return repoFamily()
+}
+
+// keyPath returns where the ASCII-armored apt key is stored. It is the same
+// path gpg_key uses, so a gpg_key rule can be rewritten as a repo rule of
+// the same name without the key being removed and added again.
+func (h *RepoHandler) keyPath() string {
+	return fmt.Sprintf("/etc/apt/keyrings/%s.asc", h.Rule.RepoName)
+}
+
+func (h *RepoHandler) aptSourcePath() string {
+	return fmt.Sprintf("/etc/apt/sources.list.d/%s.sources", h.Rule.RepoName)
+}
+
+// legacySourcePath is the one-line sources file written by gpg_key.
+func (h *RepoHandler) legacySourcePath() string {
+	return fmt.Sprintf("/etc/apt/sources.list.d/%s.list", h.Rule.RepoName)
+}
+
+func (h *RepoHandler) dnfRepoPath() string {
+	return fmt.Sprintf("/etc/yum.repos.d/%s.repo", h.Rule.RepoName)
+}
+
+// dnfKeyPath is where the key of a dnf repository with a pinned fingerprint
+// is stored once checked, so dnf imports that copy instead of fetching the URL.
+func (h *RepoHandler) dnfKeyPath() string {
+	return fmt.Sprintf("/etc/pki/rpm-gpg/RPM-GPG-KEY-%s", h.Rule.RepoName)
+}
+
+// sourcePath returns the file the repository is configured in.
+func (h *RepoHandler) sourcePath(repoType string) string {
+	if repoType == "dnf" {
+		return h.dnfRepoPath()
+	}
+	return h.aptSourcePath()
+}
+
+func (h *RepoHandler) components() string {
+	if len(h.Rule.RepoComponents) == 0 {
+		return "main"
+	}
+	return strings.Join(h.Rule.RepoComponents, " ")
+}
+
+// suite returns the apt suite, defaulting to the distro codename.
+func (h *RepoHandler) suite() string {
+	if h.Rule.RepoSuite != "" {
+		return h.Rule.RepoSuite
+	}
+	release := readOSRelease()
+	if codename := release["VERSION_CODENAME"]; codename != "" {
+		return codename
+	}
+	return release["UBUNTU_CODENAME"]
+}
+
+// exportSuite is suite() for a shell script run on another machine.
+func (h *RepoHandler) exportSuite() string {
+	if h.Rule.RepoSuite != "" {
+		return h.Rule.RepoSuite
+	}
+	return "$(. /etc/os-release && echo \"$VERSION_CODENAME\")"
+}
+
+// aptSource returns the deb822 .sources file for the repository.
+func (h *RepoHandler) aptSource(suite string) string {
+	return strings.Join([]string{
+		"Types: deb",
+		"URIs: " + h.Rule.RepoURL,
+		"Suites: " + suite,
+		"Components: " + h.components(),
+		"Signed-By: " + h.keyPath(),
+	}, "\n") + "\n"
+}
+
+func (h *RepoHandler) dnfLines() []string {
+	gpgkey := h.Rule.RepoKeyURL
+	if h.Rule.RepoKeyFingerprint != "" {
+		gpgkey = "file://" + h.dnfKeyPath()
+	}
+	return []string{
+		"[" + h.Rule.RepoName + "]",
+		"name=" + h.Rule.RepoName,
+		"baseurl=" + h.Rule.RepoURL,
+		"enabled=1",
+		"gpgcheck=1",
+		"gpgkey=" + gpgkey,
+	}
+}
+
+// dnfRepo returns the .repo file for the repository.
+func (h *RepoHandler) dnfRepo() string {
+	return strings.Join(h.dnfLines(), "\n") + "\n"
+}
+
+func (h *RepoHandler) quotedDnfLines() string {
+	lines := h.dnfLines()
+	for i, l := range lines {
+		lines[i] = shellQ(l)
+	}
+	return strings.Join(lines, " ")
+}
+
+// fileContent returns the content of path, or "" when it cannot be read.
+var fileContent = func(path string) string {
+	data, err := os.ReadFile(path) // #nosec G304 -- path is a fixed repository config location
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+// writeRootFile writes content to a root-owned path via a temp file and
+// sudo install, avoiding shell redirection with elevated privileges.
+var writeRootFile = func(path, content, sudoPassword string) error {
+	tmp, err := os.CreateTemp("", "blueprint-repo-*")
+	if err != nil {
+		return fmt.Errorf("temp file: %w", err)
+	}
+	tmpPath := tmp.Name()
+	defer func() { _ = os.Remove(tmpPath) }()
+	if _, err := tmp.WriteString(content); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	_ = tmp.Close()
+	if out, err := sudoCommand(sudoPassword, "install", "-m", "0644", tmpPath, path).CombinedOutput(); err != nil {
+		return fmt.Errorf("%w\n%s", err, out)
+	}
+	return nil
+}
+
+// installKey downloads an ASCII-armored key to path, creating its directory,
+// and makes it readable by the package manager. A key that does not match
+// fingerprint, when set, is not installed.
+var installKey = func(url, path, fingerprint, sudoPassword string) error {
+	if out, err := sudoCommand(sudoPassword, "install", "-m", "0755", "-d", filepath.Dir(path)).CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to create keyrings directory: %w\n%s", err, out)
+	}
+	if err := downloadKey(url, path, fingerprint, sudoPassword); err != nil {
+		return fmt.Errorf("failed to download key: %w", err)
+	}
+	if out, err := sudoCommand(sudoPassword, "chmod", "go+r", path).CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to set key permissions: %w\n%s", err, out)
+	}
+	return nil
+}
+
+// removeRootFiles deletes root-owned files, ignoring ones that do not exist.
+var removeRootFiles = func(sudoPassword string, paths ...string) error {
+	args := append([]string{"rm", "-f"}, paths...)
+	if out, err := sudoCommand(sudoPassword, args...).CombinedOutput(); err != nil {
+		return fmt.Errorf("%w\n%s", err, out)
+	}
+	return nil
+}
+
+// Up writes the repository's key and source file, leaving files that are
+// already up to date untouched, and schedules a package cache refresh when
+// anything changed.
+func (h *RepoHandler) Up() (string, error) {
+	repoType := h.repoType()
+	if repoType == "" {
+		return "", fmt.Errorf("cannot detect the distro's package manager; set type: apt or type: dnf")
+	}
+
+	changed := false
+	switch repoType {
+	case "apt":
+		suite := h.suite()
+		if suite == "" {
+			return "", fmt.Errorf("cannot detect the distro codename; set suite:")
+		}
+		keyChanged, err := h.ensureKey(h.keyPath())
+		if err != nil {
+			return "", err
+		}
+		changed = changed || keyChanged
+		if source := h.aptSource(suite); fileContent(h.aptSourcePath()) != source {
+			if err := writeRootFile(h.aptSourcePath(), source, h.sudoPassword); err != nil {
+				return "", fmt.Errorf("failed to write %s: %w", h.aptSourcePath(), err)
+			}
+			changed = true
+		}
+		// A source left behind by gpg_key would list the repository twice
+		if strings.Contains(fileContent(h.legacySourcePath()), h.Rule.RepoURL) {
+			if err := removeRootFiles(h.sudoPassword, h.legacySourcePath()); err != nil {
+				return "", fmt.Errorf("failed to remove %s: %w", h.legacySourcePath(), err)
+			}
+			changed = true
+		}
+	case "dnf":
+		if h.Rule.RepoKeyFingerprint != "" {
+			keyChanged, err := h.ensureKey(h.dnfKeyPath())
+			if err != nil {
+				return "", err
+			}
+			changed = changed || keyChanged
+		}
+		if repo := h.dnfRepo(); fileContent(h.dnfRepoPath()) != repo {
+			if err := writeRootFile(h.dnfRepoPath(), repo, h.sudoPassword); err != nil {
+				return "", fmt.Errorf("failed to write %s: %w", h.dnfRepoPath(), err)
+			}
+			changed = true
+		}
+	}
+
+	if !changed {
+		return fmt.Sprintf("already configured: %s", h.Rule.RepoName), nil
+	}
+	requestCacheRefresh(repoType, h.sudoPassword)
+	return fmt.Sprintf("added %s repository %s", repoType, h.Rule.RepoName), nil
+}
+
+// ensureKey installs the repository key at path unless it is there already,
+// and reports whether it did. With a pinned fingerprint an installed key is
+// checked too, so a key swapped after the first apply is caught.
+func (h *RepoHandler) ensureKey(path string) (bool, error) {
+	if isKeyringInstalled(path) {
+		if err := checkKeyFingerprint([]byte(fileContent(path)), h.Rule.RepoKeyFingerprint); err != nil {
+			return false, fmt.Errorf("installed key %s: %w", path, err)
+		}
+		return false, nil
+	}
+	if err := installKey(h.Rule.RepoKeyURL, path, h.Rule.RepoKeyFingerprint, h.sudoPassword); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Down removes the repository's source file and key.
+func (h *RepoHandler) Down() (string, error) {
+	repoType := h.repoType()
+	paths := []string{h.dnfRepoPath(), h.dnfKeyPath()}
+	if repoType != "dnf" {
+		paths = []string{h.aptSourcePath(), h.keyPath()}
+	}
+	if err := removeRootFiles(h.sudoPassword, paths...); err != nil {
+		return "", fmt.Errorf("failed to remove repository %s: %w", h.Rule.RepoName, err)
+	}
+	if repoType != "" {
+		requestCacheRefresh(repoType, h.sudoPassword)
+	}
+	return fmt.Sprintf("removed repository %s", h.Rule.RepoName), nil
+}
+
+// GetCommand returns the actual command(s) that will be executed
+func (h *RepoHandler) GetCommand() string {
+	repoType := h.repoType()
+	if h.Rule.Action == "uninstall" {
+		if repoType == "dnf" {
+			return fmt.Sprintf("sudo rm -f %s %s", h.dnfRepoPath(), h.dnfKeyPath())
+		}
+		return fmt.Sprintf("sudo rm -f %s %s", h.aptSourcePath(), h.keyPath())
+	}
+	if repoType == "dnf" {
+		return fmt.Sprintf("sudo install -m 0644 <repo %s> %s", h.Rule.RepoURL, h.sourcePath(repoType))
+	}
+	return fmt.Sprintf("curl -fsSL %s | sudo tee %s && sudo install -m 0644 <repo %s> %s",
+		h.Rule.RepoKeyURL, h.keyPath(), h.Rule.RepoURL, h.sourcePath(repoType))
+}
+
+// UpdateStatus updates the status after adding or removing a repository
+func (h *RepoHandler) UpdateStatus(status *Status, records []ExecutionRecord, blueprint string, osName string) error {
+	blueprint = normalizeBlueprint(blueprint)
+
+	if h.Rule.Action == "repo" {
+		if _, ok := commandSuccessfullyExecuted(h.GetCommand(), records); !ok {
+			return nil
+		}
+		status.Repos = removeRepoStatus(status.Repos, h.Rule.RepoName, blueprint, osName)
+		status.Repos = append(status.Repos, RepoStatus{
+			Name:        h.Rule.RepoName,
+			Type:        h.repoType(),
+			URL:         h.Rule.RepoURL,
+			KeyURL:      h.Rule.RepoKeyURL,
+			Fingerprint: h.Rule.RepoKeyFingerprint,
+			AddedAt:     timeutil.Now(),
+			Blueprint:   blueprint,
+			OS:          osName,
+		})
+		// The repository now owns what a gpg_key rule of the same name set up
+		status.GPGKeys = removeGPGKeyStatus(status.GPGKeys, h.Rule.RepoName, blueprint, osName)
+	} else if h.Rule.Action == "uninstall" && DetectRuleType(h.Rule) == "repo" {
+		status.Repos = removeRepoStatus(status.Repos, h.Rule.RepoName, blueprint, osName)
+	}
+
+	return nil
+}
+
+// NeedsSudo returns true because repository files are root-owned
+func (h *RepoHandler) NeedsSudo() bool {
+	return true
+}
+
+// ConcurrencyClass returns the repository's package manager, whose sources
+// it rewrites
+func (h *RepoHandler) ConcurrencyClass() string {
+	return h.repoType()
+}
+
+// DisplayInfo displays handler-specific information
+func (h *RepoHandler) DisplayInfo() {
+	formatFunc := ui.FormatInfo
+	if h.Rule.Action == "uninstall" {
+		formatFunc = ui.FormatDim
+	}
+
+	printInfo(formatFunc, "Repository", h.Rule.RepoName)
+	if h.Rule.RepoURL != "" {
+		printInfo(formatFunc, "URL", h.Rule.RepoURL)
+	}
+	if h.Rule.RepoKeyURL != "" {
+		printInfo(formatFunc, "Key URL", h.Rule.RepoKeyURL)
+	}
+}
+
+// DisplayStatus displays repository status information
+func (h *RepoHandler) DisplayStatus(repos []RepoStatus) {
+	if len(repos) == 0 {
+		return
+	}
+
+	rows := make([]statusRow, 0, len(repos))
+	for _, repo := range repos {
+		rows = append(rows, statusRow{
+			name:    repo.Name,
+			details: []string{timeutil.Display(repo.AddedAt)},
+			tags:    []string{repo.Type, repo.OS, abbreviateBlueprintPath(repo.Blueprint)},
+			entry:   &repo,
+		})
+	}
+	printStatusSection("Repositories:", rows)
+}
+
+// DisplayStatusFromStatus displays repo handler status from Status object
+func (h *RepoHandler) DisplayStatusFromStatus(status *Status) {
+	if status == nil || status.Repos == nil {
+		return
+	}
+	h.DisplayStatus(status.Repos)
+}
+
+// GetDependencyKey returns the unique key for this rule in dependency resolution
+func (h *RepoHandler) GetDependencyKey() string {
+	return getDependencyKey(h.Rule, h.Rule.RepoName)
+}
+
+// GetDisplayDetails returns the repository name to display during execution
+func (h *RepoHandler) GetDisplayDetails(isUninstall bool) string {
+	return h.Rule.RepoName
+}
+
+// GetState returns handler-specific state as key-value pairs
+func (h *RepoHandler) GetState(isUninstall bool) map[string]string {
+	return map[string]string{
+		"summary": h.GetDisplayDetails(isUninstall),
+		"repo":    h.Rule.RepoName,
+		"url":     h.Rule.RepoURL,
+	}
+}
+
+// FindUninstallRules compares repo status against current rules and returns uninstall rules
+func (h *RepoHandler) FindUninstallRules(status *Status, currentRules []parser.Rule, blueprintFile, osName string) []parser.Rule {
+	normalizedBlueprint := normalizeBlueprint(blueprintFile)
+
+	current := make(map[string]bool)
+	for _, rule := range currentRules {
+		if rule.Action == "repo" && rule.RepoName != "" {
+			current[rule.RepoName] = true
+		}
+	}
+
+	var rules []parser.Rule
+	for _, repo := range status.Repos {
+		if normalizeBlueprint(repo.Blueprint) == normalizedBlueprint && repo.OS == osName && !current[repo.Name] {
+			rules = append(rules, parser.Rule{
+				Action:   "uninstall",
+				RepoName: repo.Name,
+				RepoType: repo.Type,
+				OSList:   []string{osName},
+			})
+		}
+	}
+	return rules
+}
+
+// IsInstalled returns true if the repository is in status with the same URL and key.
+func (h *RepoHandler) IsInstalled(status *Status, blueprintFile, osName string) bool {
+	normalizedBlueprint := normalizeBlueprint(blueprintFile)
+	for _, repo := range status.Repos {
+		if repo.Name == h.Rule.RepoName && normalizeBlueprint(repo.Blueprint) == normalizedBlueprint && repo.OS == osName &&
+			repo.URL == h.Rule.RepoURL && repo.KeyURL == h.Rule.RepoKeyURL {
+			return true
+		}
+	}
+	return false
+}
+
+// pendingRefreshes holds, per package manager, the sudo password to refresh
+// its cache with, for every cache a repo rule has changed since the last
+// RefreshPackageCaches call.
+var (
+	pendingRefreshMu sync.Mutex
+	pendingRefreshes = map[string]string{}
+)
+
+func requestCacheRefresh(repoType, sudoPassword string) {
+	// The package sources changed, so an apt-get update from earlier in the
+	// run no longer covers them
+	InvalidateRunCache(refreshEntry)
+	pendingRefreshMu.Lock()
+	defer pendingRefreshMu.Unlock()
+	if _, ok := pendingRefreshes[repoType]; !ok || sudoPassword != "" {
+		pendingRefreshes[repoType] = sudoPassword
+	}
+}
+
+// refreshCacheCommand returns the command that refreshes repoType's cache.
+func refreshCacheCommand(repoType string) []string {
+	if repoType == "dnf" {
+		return []string{"dnf", "makecache"}
+	}
+	return []string{"apt-get", "update"}
+}
+
+// runCacheRefresh runs a cache refresh command with sudo.
+var runCacheRefresh = func(sudoPassword string, args ...string) error {
+	if out, err := sudoCommand(sudoPassword, args...).CombinedOutput(); err != nil {
+		return fmt.Errorf("%w\n%s", err, out)
+	}
+	return nil
+}
+
+// PackageCacheRefresh is the outcome of refreshing one package manager's cache.
+type PackageCacheRefresh struct {
+	Manager string // "apt" or "dnf"
+	Err     error
+}
+
+// RefreshPackageCaches refreshes, once each, the package caches invalidated
+// by repo rules since the last call. The engine calls it after every wave so
+// that many repositories cost a single apt-get update, which still happens
+// before the rules that depend on them install anything.
+func RefreshPackageCaches() []PackageCacheRefresh {
+	pendingRefreshMu.Lock()
+	pending := pendingRefreshes
+	pendingRefreshes = map[string]string{}
+	pendingRefreshMu.Unlock()
+
+	managers := make([]string, 0, len(pending))
+	for manager := range pending {
+		managers = append(managers, manager)
+	}
+	sort.Strings(managers)
+
+	var results []PackageCacheRefresh
+	for _, manager := range managers {
+		err := runCacheRefresh(pending[manager], refreshCacheCommand(manager)...)
+		results = append(results, PackageCacheRefresh{Manager: manager, Err: err})
+	}
+	return results
+}
@@ -0,0 +1,222 @@
+package handlers
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/elpic/blueprint/internal/parser"
+)
+
+// stubRepoSystem replaces the filesystem and sudo hooks used by RepoHandler
+// with an in-memory set of root-owned files.
+func stubRepoSystem(t *testing.T, release map[string]string, files map[string]string) {
+	t.Helper()
+	origRelease, origExists, origContent := readOSRelease, isKeyringInstalled, fileContent
+	origKey, origWrite, origRemove := installKey, writeRootFile, removeRootFiles
+	t.Cleanup(func() {
+		readOSRelease, isKeyringInstalled, fileContent = origRelease, origExists, origContent
+		installKey, writeRootFile, removeRootFiles = origKey, origWrite, origRemove
+		pendingRefreshes = map[string]string{}
+	})
+
+	readOSRelease = func() map[string]string { return release }
+	isKeyringInstalled = func(path string) bool { _, ok := files[path]; return ok }
+	fileContent = func(path string) string { return files[path] }
+	installKey = func(url, path, _, _ string) error { files[path] = "key from " + url; return nil }
+	writeRootFile = func(path, content, _ string) error { files[path] = content; return nil }
+	removeRootFiles = func(_ string, paths ...string) error {
+		for _, p := range paths {
+			delete(files, p)
+		}
+		return nil
+	}
+}
+
+func TestRepoHandlerUpApt(t *testing.T) {
+	files := map[string]string{
+		"/etc/apt/sources.list.d/docker.list": "deb [signed-by=/etc/apt/keyrings/docker.asc] https://download.docker.com/linux/ubuntu * *\n",
+	}
+	stubRepoSystem(t, map[string]string{"ID": "ubuntu", "ID_LIKE": "debian", "VERSION_CODENAME": "noble"}, files)
+
+	h := NewRepoHandler(parser.Rule{
+		Action:         "repo",
+		RepoName:       "docker",
+		RepoURL:        "https://download.docker.com/linux/ubuntu",
+		RepoKeyURL:     "https://download.docker.com/linux/ubuntu/gpg",
+		RepoComponents: []string{"stable"},
+	}, "")
+
+	out, err := h.Up()
+	if err != nil {
+		t.Fatalf("Up() error = %v", err)
+	}
+	if !strings.Contains(out, "added apt repository docker") {
+		t.Errorf("Up() = %q", out)
+	}
+
+	want := "Types: deb\nURIs: https://download.docker.com/linux/ubuntu\nSuites: noble\nComponents: stable\nSigned-By: /etc/apt/keyrings/docker.asc\n"
+	if got := files["/etc/apt/sources.list.d/docker.sources"]; got != want {
+		t.Errorf("sources file =\n%s\nwant\n%s", got, want)
+	}
+	if _, ok := files["/etc/apt/keyrings/docker.asc"]; !ok {
+		t.Error("key was not installed")
+	}
+	if _, ok := files["/etc/apt/sources.list.d/docker.list"]; ok {
+		t.Error("the gpg_key sources file was not removed")
+	}
+	if _, ok := pendingRefreshes["apt"]; !ok {
+		t.Errorf("pending refreshes = %v, want apt", pendingRefreshes)
+	}
+
+	// A second run finds everything in place and requests no refresh
+	pendingRefreshes = map[string]string{}
+	out, err = h.Up()
+	if err != nil || !strings.Contains(out, "already configured") {
+		t.Errorf("second Up() = %q, %v", out, err)
+	}
+	if len(pendingRefreshes) != 0 {
+		t.Errorf("pending refreshes = %v, want none", pendingRefreshes)
+	}
+}
+
+func TestRepoHandlerUpDnf(t *testing.T) {
+	files := map[string]string{}
+	stubRepoSystem(t, map[string]string{"ID": "fedora"}, files)
+
+	h := NewRepoHandler(parser.Rule{
+		Action:     "repo",
+		RepoName:   "vscode",
+		RepoURL:    "https://packages.microsoft.com/yumrepos/vscode",
+		RepoKeyURL: "https://packages.microsoft.com/keys/microsoft.asc",
+	}, "")
+
+	if _, err := h.Up(); err != nil {
+		t.Fatalf("Up() error = %v", err)
+	}
+	repo := files["/etc/yum.repos.d/vscode.repo"]
+	for _, line := range []string{"[vscode]", "baseurl=https://packages.microsoft.com/yumrepos/vscode", "gpgcheck=1", "gpgkey=https://packages.microsoft.com/keys/microsoft.asc"} {
+		if !strings.Contains(repo, line+"\n") {
+			t.Errorf("repo file missing %q:\n%s", line, repo)
+		}
+	}
+	if _, ok := pendingRefreshes["dnf"]; !ok {
+		t.Errorf("pending refreshes = %v, want dnf", pendingRefreshes)
+	}
+}
+
+func TestRepoHandlerPinnedFingerprint(t *testing.T) {
+	key, fpr := testArmoredKey(t)
+
+	t.Run("dnf imports the checked key", func(t *testing.T) {
+		files := map[string]string{}
+		stubRepoSystem(t, map[string]string{"ID": "fedora"}, files)
+		var pinned string
+		installKey = func(url, path, fingerprint, _ string) error {
+			pinned = fingerprint
+			files[path] = key
+			return nil
+		}
+
+		h := NewRepoHandler(parser.Rule{Action: "repo", RepoName: "vscode", RepoURL: "https://x", RepoKeyURL: "https://x/key", RepoKeyFingerprint: fpr}, "")
+		if _, err := h.Up(); err != nil {
+			t.Fatalf("Up() error = %v", err)
+		}
+		if pinned != fpr {
+			t.Errorf("installKey() fingerprint = %q, want %q", pinned, fpr)
+		}
+		if repo := files["/etc/yum.repos.d/vscode.repo"]; !strings.Contains(repo, "gpgkey=file:///etc/pki/rpm-gpg/RPM-GPG-KEY-vscode\n") {
+			t.Errorf("repo file should point dnf at the checked key:\n%s", repo)
+		}
+	})
+
+	t.Run("an installed key that does not match fails", func(t *testing.T) {
+		files := map[string]string{"/etc/apt/keyrings/docker.asc": key}
+		stubRepoSystem(t, map[string]string{"ID": "ubuntu", "VERSION_CODENAME": "noble"}, files)
+
+		h := NewRepoHandler(parser.Rule{Action: "repo", RepoName: "docker", RepoURL: "https://x", RepoKeyURL: "https://x/key", RepoKeyFingerprint: strings.Repeat("0", 40)}, "")
+		if _, err := h.Up(); err == nil || !strings.Contains(err.Error(), "does not match") {
+			t.Errorf("Up() error = %v, want a fingerprint mismatch", err)
+		}
+		if _, ok := files["/etc/apt/sources.list.d/docker.sources"]; ok {
+			t.Error("the repository must not be configured when its key does not match")
+		}
+	})
+}
+
+func TestRepoHandlerUpUnknownDistro(t *testing.T) {
+	stubRepoSystem(t, map[string]string{"ID": "arch"}, map[string]string{})
+
+	h := NewRepoHandler(parser.Rule{Action: "repo", RepoName: "x", RepoURL: "https://x", RepoKeyURL: "https://x/key"}, "")
+	if _, err := h.Up(); err == nil || !strings.Contains(err.Error(), "type:") {
+		t.Errorf("Up() error = %v, want a hint to set type:", err)
+	}
+}
+
+func TestRefreshPackageCachesRunsOncePerManager(t *testing.T) {
+	orig := runCacheRefresh
+	defer func() { runCacheRefresh = orig }()
+	var ran []string
+	runCacheRefresh = func(_ string, args ...string) error {
+		ran = append(ran, strings.Join(args, " "))
+		return nil
+	}
+
+	requestCacheRefresh("apt", "")
+	requestCacheRefresh("apt", "secret")
+	requestCacheRefresh("dnf", "")
+
+	results := RefreshPackageCaches()
+	if len(results) != 2 || results[0].Manager != "apt" || results[1].Manager != "dnf" {
+		t.Errorf("RefreshPackageCaches() = %+v", results)
+	}
+	if strings.Join(ran, ";") != "apt-get update;dnf makecache" {
+		t.Errorf("ran %v", ran)
+	}
+	if results := RefreshPackageCaches(); len(results) != 0 {
+		t.Errorf("second RefreshPackageCaches() = %+v, want nothing", results)
+	}
+}
+
+func TestRepoHandlerStatus(t *testing.T) {
+	stubRepoSystem(t, map[string]string{"ID": "debian", "VERSION_CODENAME": "bookworm"}, map[string]string{})
+
+	rule := parser.Rule{Action: "repo", RepoName: "docker", RepoURL: "https://d", RepoKeyURL: "https://d/gpg"}
+	h := NewRepoHandler(rule, "")
+	status := &Status{GPGKeys: []GPGKeyStatus{{Keyring: "docker", Blueprint: "/bp", OS: "linux"}}}
+	records := []ExecutionRecord{{Status: "success", Command: h.GetCommand()}}
+
+	if err := h.UpdateStatus(status, records, "/bp", "linux"); err != nil {
+		t.Fatalf("UpdateStatus() error = %v", err)
+	}
+	if len(status.Repos) != 1 || status.Repos[0].Type != "apt" {
+		t.Fatalf("Repos = %+v", status.Repos)
+	}
+	if len(status.GPGKeys) != 0 {
+		t.Errorf("gpg_key entry of the same name was not taken over: %+v", status.GPGKeys)
+	}
+	if !h.IsInstalled(status, "/bp", "linux") {
+		t.Error("IsInstalled() = false after UpdateStatus")
+	}
+
+	moved := NewRepoHandler(parser.Rule{Action: "repo", RepoName: "docker", RepoURL: "https://mirror", RepoKeyURL: "https://d/gpg"}, "")
+	if moved.IsInstalled(status, "/bp", "linux") {
+		t.Error("IsInstalled() = true for a changed url:")
+	}
+
+	if got := h.FindUninstallRules(status, []parser.Rule{rule}, "/bp", "linux"); len(got) != 0 {
+		t.Errorf("FindUninstallRules() = %+v, want none", got)
+	}
+	got := h.FindUninstallRules(status, nil, "/bp", "linux")
+	if len(got) != 1 || got[0].RepoName != "docker" || DetectRuleType(got[0]) != "repo" {
+		t.Errorf("FindUninstallRules() = %+v", got)
+	}
+}
+
+func TestGPGKeyFindUninstallRulesKeepsKeyTakenOverByRepo(t *testing.T) {
+	status := &Status{GPGKeys: []GPGKeyStatus{{Keyring: "docker", Blueprint: "/bp", OS: "linux"}}}
+	current := []parser.Rule{{Action: "repo", RepoName: "docker"}}
+
+	if got := NewGPGKeyHandler(parser.Rule{}, "").FindUninstallRules(status, current, "/bp", "linux"); len(got) != 0 {
+		t.Errorf("FindUninstallRules() = %+v, want none", got)
+	}
+}
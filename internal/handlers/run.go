@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"bytes"
 	"fmt"
 	"io"
 	"net/http"
@@ -11,12 +12,36 @@ import (
 
 	"github.com/elpic/blueprint/internal/parser"
 	"github.com/elpic/blueprint/internal/ui"
+	"github.com/elpic/blueprint/internal/ui/timeutil"
 )
 
+// runAttrs are shared by run and run-sh.
+var runAttrs = []AttrMeta{
+	{Name: "unless", Type: "string", Description: "Skip when this command exits 0"},
+	{Name: "creates", Type: "path", Description: "Skip when this path exists; status tracks it, so deleting it makes the rule run again"},
+	{Name: "undo", Type: "string", Description: "Command run when the rule is removed from the blueprint"},
+	{Name: "sudo", Type: "bool", Default: "false", Description: "true runs the command with sudo"},
+	{Name: "clean-env", Type: "bool", Default: "false", Description: "true runs with a minimal environment instead of the caller's"},
+	shellAttr,
+}
+
 func init() {
 	RegisterAction(ActionDef{
 		Name:   "run",
 		Prefix: "run ",
+		Meta: ActionMeta{
+			Summary: "Run a shell command.",
+			Usage:   "run <command> [creates: <path>] [unless: <cmd>] [undo: <cmd>] [sudo: true] [clean-env: true] [shell: <shell>]",
+			Attrs:   runAttrs,
+			Examples: []string{
+				"run make install unless: test -f /usr/local/bin/tool",
+				`run "curl -fsSL https://sh.rustup.rs | sh -s -- -y" creates: ~/.cargo/bin/rustup`,
+				"run systemctl enable docker sudo: true undo: systemctl disable docker",
+				"run set -Ux EDITOR nvim shell: fish",
+			},
+			OS:  []string{"mac", "linux"},
+			Doc: "run.md",
+		},
 		NewHandler: func(rule parser.Rule, basePath string, passwordCache map[string]string) Handler {
 			return NewRunHandler(rule, basePath)
 		},
@@ -37,19 +62,32 @@ func init() {
 			if rule.RunSudo {
 				cmd = "sudo " + cmd
 			}
-			if rule.RunUnless != "" {
-				return []string{
-					fmt.Sprintf("if ! (%s) >/dev/null 2>&1; then", rule.RunUnless),
-					"  " + cmd,
-					"fi",
+			if rule.RunCleanEnv {
+				shell := "sh -c"
+				if args, ok := commandShells[rule.Shell]; ok {
+					shell = strings.Join(args, " ")
 				}
+				cmd = cleanEnvPrefix + " " + shell + " " + shellQ(cmd)
+			} else {
+				cmd = shellExportCommand(rule, cmd)
 			}
-			return []string{cmd}
+			return guardedExport(rule, cmd)
 		},
 	})
 	RegisterAction(ActionDef{
 		Name:   "run-sh",
 		Prefix: "run-sh ",
+		Meta: ActionMeta{
+			Summary: "Download a shell script and run it.",
+			Usage:   "run-sh <url> [creates: <path>] [unless: <cmd>] [undo: <cmd>] [sudo: true] [clean-env: true]",
+			Attrs:   runAttrs,
+			Examples: []string{
+				"run-sh https://sh.rustup.rs unless: which rustc",
+				"run-sh https://sh.rustup.rs creates: ~/.cargo/bin/rustup",
+			},
+			OS:  []string{"mac", "linux"},
+			Doc: "run-sh.md",
+		},
 		NewHandler: func(rule parser.Rule, basePath string, passwordCache map[string]string) Handler {
 			return NewRunShHandler(rule, basePath)
 		},
@@ -66,22 +104,143 @@ func init() {
 			index(rule.RunShURL)
 		},
 		ShellExport: func(rule parser.Rule, _, _ string) []string {
-			cmd := fmt.Sprintf("curl -fsSL %s | sh", shellQ(rule.RunShURL))
+			sh := "sh"
+			if rule.Shell != "" {
+				sh = rule.Shell
+			}
 			if rule.RunSudo {
-				cmd = fmt.Sprintf("curl -fsSL %s | sudo sh", shellQ(rule.RunShURL))
+				sh = "sudo " + sh
 			}
-			if rule.RunUnless != "" {
-				return []string{
-					fmt.Sprintf("if ! (%s) >/dev/null 2>&1; then", rule.RunUnless),
-					"  " + cmd,
-					"fi",
-				}
+			if rule.RunCleanEnv {
+				sh = cleanEnvPrefix + " " + sh
 			}
-			return []string{cmd}
+			cmd := fmt.Sprintf("curl -fsSL %s | %s", shellQ(rule.RunShURL), sh)
+			return guardedExport(rule, cmd)
 		},
 	})
 }
 
+// guardedExport wraps cmd in the shell equivalent of the rule's creates:
+// and unless: guards.
+func guardedExport(rule parser.Rule, cmd string) []string {
+	var conds []string
+	if rule.RunCreates != "" {
+		conds = append(conds, fmt.Sprintf("[ ! -e %s ]", shellHome(rule.RunCreates)))
+	}
+	if rule.RunUnless != "" {
+		conds = append(conds, fmt.Sprintf("! (%s) >/dev/null 2>&1", rule.RunUnless))
+	}
+	if len(conds) == 0 {
+		return []string{cmd}
+	}
+	return []string{
+		fmt.Sprintf("if %s; then", strings.Join(conds, " && ")),
+		"  " + cmd,
+		"fi",
+	}
+}
+
+// runSkipReason returns the output of a run or run-sh rule whose command need
+// not run: its creates: path exists or its unless: check passes. It returns
+// "" when the command should run.
+func runSkipReason(rule parser.Rule) string {
+	if rule.RunCreates != "" && pathExists(expandPath(rule.RunCreates)) {
+		return fmt.Sprintf("skipped (creates exists): %s", rule.RunCreates)
+	}
+	if rule.RunUnless != "" {
+		cmd := shellCommand(ruleShell(rule), rule.RunUnless, rule.RunCleanEnv)
+		if err := cmd.Run(); err == nil {
+			return fmt.Sprintf("skipped (unless check passed): %s", rule.RunUnless)
+		}
+	}
+	return ""
+}
+
+// runRecorded reports whether records show the rule's command ran, or was
+// skipped by one of its guards, so it belongs in status.
+func runRecorded(rule parser.Rule, cmd string, records []ExecutionRecord) bool {
+	if _, executed := commandSuccessfullyExecuted(cmd, records); executed {
+		return true
+	}
+	var skipMsgs []string
+	if rule.RunCreates != "" {
+		skipMsgs = append(skipMsgs, fmt.Sprintf("skipped (creates exists): %s", rule.RunCreates))
+	}
+	if rule.RunUnless != "" {
+		skipMsgs = append(skipMsgs, fmt.Sprintf("skipped (unless check passed): %s", rule.RunUnless))
+	}
+	for _, record := range records {
+		for _, msg := range skipMsgs {
+			if record.Status == "success" && strings.Contains(record.Output, msg) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// runArtifactPresent reports whether the creates: path of a status entry is
+// still there. Entries without one always are.
+func runArtifactPresent(r RunStatus) bool {
+	return r.Creates == "" || pathExists(expandPath(r.Creates))
+}
+
+// cleanEnvPath is the PATH given to clean-env commands: the standard system
+// directories only, so anything else must be referenced by absolute path.
+const cleanEnvPath = "/usr/local/bin:/usr/bin:/bin:/usr/sbin:/sbin"
+
+// cleanEnvLang is the locale given to clean-env commands.
+const cleanEnvLang = "C.UTF-8"
+
+// cleanEnvPrefix reproduces cleanEnvironment in exported shell scripts.
+const cleanEnvPrefix = `env -i PATH=` + cleanEnvPath + ` HOME="$HOME" LANG=` + cleanEnvLang
+
+// cleanEnvironment returns the minimal environment for clean-env rules:
+// PATH, HOME and LANG only. Nothing from the caller's shell leaks through.
+func cleanEnvironment() []string {
+	home, _ := os.UserHomeDir()
+	return []string{
+		"PATH=" + cleanEnvPath,
+		"HOME=" + home,
+		"LANG=" + cleanEnvLang,
+	}
+}
+
+// shellCommand builds a command running script in shell. With cleanEnv the
+// command gets cleanEnvironment() instead of inheriting blueprint's own
+// environment.
+func shellCommand(shell, script string, cleanEnv bool) *exec.Cmd {
+	cmd := shellExec(shell, script)
+	if cleanEnv {
+		cmd.Env = cleanEnvironment()
+	}
+	return cmd
+}
+
+// liveOutput receives the output of run commands as they print it, for the
+// status line of the apply in progress. Nil when there is none.
+var liveOutput io.Writer
+
+// SetLiveOutput sets where the output of run commands is copied while they
+// run; nil stops copying.
+func SetLiveOutput(w io.Writer) {
+	liveOutput = w
+}
+
+// combinedOutput runs cmd and returns its stdout and stderr together, like
+// cmd.CombinedOutput, copying them to liveOutput as they come.
+func combinedOutput(cmd *exec.Cmd) ([]byte, error) {
+	var out bytes.Buffer
+	var w io.Writer = &out
+	if liveOutput != nil {
+		w = io.MultiWriter(&out, liveOutput)
+	}
+	cmd.Stdout = w
+	cmd.Stderr = w
+	err := cmd.Run()
+	return out.Bytes(), err
+}
+
 // RunHandler handles executing arbitrary shell commands
 type RunHandler struct {
 	BaseHandler
@@ -99,26 +258,31 @@ func NewRunHandler(rule parser.Rule, basePath string) *RunHandler {
 
 // Up executes the shell command, optionally skipping if the unless check passes
 func (h *RunHandler) Up() (string, error) {
-	if h.Rule.RunUnless != "" {
-		cmd := exec.Command("sh", "-c", h.Rule.RunUnless) // #nosec G204 -- user-supplied unless check from blueprint
-		if err := cmd.Run(); err == nil {
-			return fmt.Sprintf("skipped (unless check passed): %s", h.Rule.RunUnless), nil
-		}
+	if reason := runSkipReason(h.Rule); reason != "" {
+		return reason, nil
 	}
 
 	runCmd := h.Rule.RunCommand
 	if h.Rule.RunSudo {
-		runCmd = "sudo " + runCmd
+		runCmd = PrivilegeTool() + " " + runCmd
 	}
 
-	cmd := exec.Command("sh", "-c", runCmd) // #nosec G204 -- user-supplied command from blueprint
-	out, err := cmd.CombinedOutput()
+	cmd := shellCommand(ruleShell(h.Rule), runCmd, h.Rule.RunCleanEnv)
+	out, err := combinedOutput(cmd)
 	if err != nil {
 		return "", fmt.Errorf("command failed: %w\n%s", err, string(out))
 	}
 	return strings.TrimSpace(string(out)), nil
 }
 
+// Irreversible reports that a run rule without undo: cannot be rolled back.
+func (h *RunHandler) Irreversible() string {
+	if h.Rule.RunUndo == "" {
+		return "no undo command"
+	}
+	return ""
+}
+
 // Down executes the undo command if set
 func (h *RunHandler) Down() (string, error) {
 	if h.Rule.RunUndo == "" {
@@ -127,11 +291,11 @@ func (h *RunHandler) Down() (string, error) {
 
 	undoCmd := h.Rule.RunUndo
 	if h.Rule.RunSudo {
-		undoCmd = "sudo " + undoCmd
+		undoCmd = PrivilegeTool() + " " + undoCmd
 	}
 
-	cmd := exec.Command("sh", "-c", undoCmd) // #nosec G204 -- user-supplied undo command from blueprint
-	out, err := cmd.CombinedOutput()
+	cmd := shellCommand(ruleShell(h.Rule), undoCmd, h.Rule.RunCleanEnv)
+	out, err := combinedOutput(cmd)
 	if err != nil {
 		return "", fmt.Errorf("undo command failed: %w\n%s", err, string(out))
 	}
@@ -160,28 +324,17 @@ func (h *RunHandler) UpdateStatus(status *Status, records []ExecutionRecord, blu
 	blueprint = normalizeBlueprint(blueprint)
 
 	if h.Rule.Action == "run" {
-		cmd := h.GetCommand()
-		_, executed := commandSuccessfullyExecuted(cmd, records)
-
-		// Also treat a "skipped" result as success (idempotent re-run)
-		if !executed {
-			skipMsg := fmt.Sprintf("skipped (unless check passed): %s", h.Rule.RunUnless)
-			for _, record := range records {
-				if record.Status == "success" && strings.Contains(record.Output, skipMsg) {
-					executed = true
-					break
-				}
-			}
-		}
-
-		if executed {
+		// A "skipped" result counts as success too (idempotent re-run)
+		if runRecorded(h.Rule, h.GetCommand(), records) {
 			status.Runs = removeRunStatus(status.Runs, h.Rule.RunCommand, blueprint, osName)
 			status.Runs = append(status.Runs, RunStatus{
 				Action:    "run",
 				Command:   h.Rule.RunCommand,
 				UndoCmd:   h.Rule.RunUndo,
 				Sudo:      h.Rule.RunSudo,
-				RanAt:     time.Now().Format(time.RFC3339),
+				CleanEnv:  h.Rule.RunCleanEnv,
+				Creates:   h.Rule.RunCreates,
+				RanAt:     timeutil.Now(),
 				Blueprint: blueprint,
 				OS:        osName,
 			})
@@ -200,15 +353,21 @@ func (h *RunHandler) DisplayInfo() {
 		formatFunc = ui.FormatDim
 	}
 
-	fmt.Printf("  %s\n", formatFunc(fmt.Sprintf("Command: %s", h.Rule.RunCommand)))
+	printInfo(formatFunc, "Command", h.Rule.RunCommand)
 	if h.Rule.RunSudo {
 		fmt.Printf("  %s\n", formatFunc("sudo: true"))
 	}
+	if h.Rule.RunCleanEnv {
+		fmt.Printf("  %s\n", formatFunc("clean-env: true"))
+	}
+	if h.Rule.RunCreates != "" {
+		printInfo(formatFunc, "Creates", h.Rule.RunCreates)
+	}
 	if h.Rule.RunUnless != "" {
-		fmt.Printf("  %s\n", formatFunc(fmt.Sprintf("Unless: %s", h.Rule.RunUnless)))
+		printInfo(formatFunc, "Unless", h.Rule.RunUnless)
 	}
 	if h.Rule.RunUndo != "" {
-		fmt.Printf("  %s\n", formatFunc(fmt.Sprintf("Undo: %s", h.Rule.RunUndo)))
+		printInfo(formatFunc, "Undo", h.Rule.RunUndo)
 	}
 }
 
@@ -265,11 +424,12 @@ func (h *RunHandler) FindUninstallRules(status *Status, currentRules []parser.Ru
 				// If there's no undo command, Down() is a no-op but UpdateStatus
 				// still removes the status entry.
 				rules = append(rules, parser.Rule{
-					Action:     "uninstall",
-					RunCommand: r.Command,
-					RunUndo:    r.UndoCmd,
-					RunSudo:    r.Sudo,
-					OSList:     []string{osName},
+					Action:      "uninstall",
+					RunCommand:  r.Command,
+					RunUndo:     r.UndoCmd,
+					RunSudo:     r.Sudo,
+					RunCleanEnv: r.CleanEnv,
+					OSList:      []string{osName},
 				})
 			}
 		}
@@ -278,46 +438,43 @@ func (h *RunHandler) FindUninstallRules(status *Status, currentRules []parser.Ru
 	return rules
 }
 
-// IsInstalled returns true if the run command in this rule is already in status.
+// IsInstalled returns true if the run command in this rule is already in
+// status and the path it creates, if any, is still there.
 func (h *RunHandler) IsInstalled(status *Status, blueprintFile, osName string) bool {
 	normalizedBlueprint := normalizeBlueprint(blueprintFile)
 	for _, r := range status.Runs {
 		if r.Action == "run" && r.Command == h.Rule.RunCommand && normalizeBlueprint(r.Blueprint) == normalizedBlueprint && r.OS == osName {
-			return true
+			return runArtifactPresent(r)
 		}
 	}
 	return false
 }
 
+// IsSatisfied reports whether the path the rule creates already exists.
+func (h *RunHandler) IsSatisfied() (bool, error) {
+	return h.Rule.RunCreates != "" && pathExists(expandPath(h.Rule.RunCreates)), nil
+}
+
 // DisplayStatusFromStatus displays run status from Status object
 func (h *RunHandler) DisplayStatusFromStatus(status *Status) {
 	if status == nil || len(status.Runs) == 0 {
 		return
 	}
 
-	fmt.Printf("\n%s\n", ui.FormatHighlight("Run Commands:"))
+	rows := make([]statusRow, 0, len(status.Runs))
 	for _, r := range status.Runs {
-		t, err := time.Parse(time.RFC3339, r.RanAt)
-		var timeStr string
-		if err == nil {
-			timeStr = t.Format("2006-01-02 15:04:05")
-		} else {
-			timeStr = r.RanAt
-		}
-
-		cmd := r.Command
-		if len(cmd) > 60 {
-			cmd = cmd[:60] + "..."
+		details := []string{timeutil.Display(r.RanAt)}
+		if r.Creates != "" {
+			details = append(details, "creates "+r.Creates)
 		}
-
-		fmt.Printf("  %s %s (%s) [%s, %s]\n",
-			ui.FormatSuccess("●"),
-			ui.FormatInfo(cmd),
-			ui.FormatDim(timeStr),
-			ui.FormatDim(r.OS),
-			ui.FormatDim(abbreviateBlueprintPath(r.Blueprint)),
-		)
-	}
+		rows = append(rows, statusRow{
+			name:    ui.Truncate(r.Command, 60),
+			details: details,
+			tags:    []string{r.OS, abbreviateBlueprintPath(r.Blueprint)},
+			entry:   &r,
+		})
+	}
+	printStatusSection("Run Commands:", rows)
 }
 
 // RunShHandler handles downloading and executing shell scripts from URLs
@@ -342,11 +499,12 @@ func (h *RunShHandler) httpClient() *http.Client {
 }
 
 func (h *RunShHandler) Up() (string, error) {
-	if h.Rule.RunUnless != "" {
-		cmd := exec.Command("sh", "-c", h.Rule.RunUnless) // #nosec G204 -- user-supplied unless check from blueprint
-		if err := cmd.Run(); err == nil {
-			return fmt.Sprintf("skipped (unless check passed): %s", h.Rule.RunUnless), nil
-		}
+	if reason := runSkipReason(h.Rule); reason != "" {
+		return reason, nil
+	}
+
+	if err := checkRemoteScriptAllowed("run-sh", h.Rule.RunShURL); err != nil {
+		return "", err
 	}
 
 	// Download script to a temp file
@@ -377,19 +535,33 @@ func (h *RunShHandler) Up() (string, error) {
 		return "", fmt.Errorf("failed to write script: %w", copyErr)
 	}
 
-	runCmd := "sh " + tmpPath
+	// Installer scripts are written for sh, so BLUEPRINT_SHELL does not apply
+	// here; only a shell: on the rule picks another interpreter.
+	interpreter := "sh"
+	if h.Rule.Shell != "" {
+		interpreter = h.Rule.Shell
+	}
+	runCmd := interpreter + " " + tmpPath
 	if h.Rule.RunSudo {
-		runCmd = "sudo sh " + tmpPath
+		runCmd = PrivilegeTool() + " " + runCmd
 	}
 
-	cmd := exec.Command("sh", "-c", runCmd) // #nosec G204 -- temp script path is internally generated
-	out, err := cmd.CombinedOutput()
+	cmd := shellCommand(ruleShell(h.Rule), runCmd, h.Rule.RunCleanEnv)
+	out, err := combinedOutput(cmd)
 	if err != nil {
 		return "", fmt.Errorf("script failed: %w\n%s", err, string(out))
 	}
 	return strings.TrimSpace(string(out)), nil
 }
 
+// Irreversible reports that a run-sh rule without undo: cannot be rolled back.
+func (h *RunShHandler) Irreversible() string {
+	if h.Rule.RunUndo == "" {
+		return "no undo command"
+	}
+	return ""
+}
+
 // Down executes the undo command if set
 func (h *RunShHandler) Down() (string, error) {
 	if h.Rule.RunUndo == "" {
@@ -398,11 +570,11 @@ func (h *RunShHandler) Down() (string, error) {
 
 	undoCmd := h.Rule.RunUndo
 	if h.Rule.RunSudo {
-		undoCmd = "sudo " + undoCmd
+		undoCmd = PrivilegeTool() + " " + undoCmd
 	}
 
-	cmd := exec.Command("sh", "-c", undoCmd) // #nosec G204 -- user-supplied undo command from blueprint
-	out, err := cmd.CombinedOutput()
+	cmd := shellCommand(ruleShell(h.Rule), undoCmd, h.Rule.RunCleanEnv)
+	out, err := combinedOutput(cmd)
 	if err != nil {
 		return "", fmt.Errorf("undo command failed: %w\n%s", err, string(out))
 	}
@@ -428,27 +600,16 @@ func (h *RunShHandler) UpdateStatus(status *Status, records []ExecutionRecord, b
 	blueprint = normalizeBlueprint(blueprint)
 
 	if h.Rule.Action == "run-sh" {
-		cmd := h.GetCommand()
-		_, executed := commandSuccessfullyExecuted(cmd, records)
-
-		if !executed {
-			skipMsg := fmt.Sprintf("skipped (unless check passed): %s", h.Rule.RunUnless)
-			for _, record := range records {
-				if record.Status == "success" && strings.Contains(record.Output, skipMsg) {
-					executed = true
-					break
-				}
-			}
-		}
-
-		if executed {
+		if runRecorded(h.Rule, h.GetCommand(), records) {
 			status.Runs = removeRunStatus(status.Runs, h.Rule.RunShURL, blueprint, osName)
 			status.Runs = append(status.Runs, RunStatus{
 				Action:    "run-sh",
 				Command:   h.Rule.RunShURL,
 				UndoCmd:   h.Rule.RunUndo,
 				Sudo:      h.Rule.RunSudo,
-				RanAt:     time.Now().Format(time.RFC3339),
+				CleanEnv:  h.Rule.RunCleanEnv,
+				Creates:   h.Rule.RunCreates,
+				RanAt:     timeutil.Now(),
 				Blueprint: blueprint,
 				OS:        osName,
 			})
@@ -467,15 +628,21 @@ func (h *RunShHandler) DisplayInfo() {
 		formatFunc = ui.FormatDim
 	}
 
-	fmt.Printf("  %s\n", formatFunc(fmt.Sprintf("Script URL: %s", h.Rule.RunShURL)))
+	printInfo(formatFunc, "Script URL", h.Rule.RunShURL)
 	if h.Rule.RunSudo {
 		fmt.Printf("  %s\n", formatFunc("sudo: true"))
 	}
+	if h.Rule.RunCleanEnv {
+		fmt.Printf("  %s\n", formatFunc("clean-env: true"))
+	}
+	if h.Rule.RunCreates != "" {
+		printInfo(formatFunc, "Creates", h.Rule.RunCreates)
+	}
 	if h.Rule.RunUnless != "" {
-		fmt.Printf("  %s\n", formatFunc(fmt.Sprintf("Unless: %s", h.Rule.RunUnless)))
+		printInfo(formatFunc, "Unless", h.Rule.RunUnless)
 	}
 	if h.Rule.RunUndo != "" {
-		fmt.Printf("  %s\n", formatFunc(fmt.Sprintf("Undo: %s", h.Rule.RunUndo)))
+		printInfo(formatFunc, "Undo", h.Rule.RunUndo)
 	}
 }
 
@@ -523,11 +690,12 @@ func (h *RunShHandler) FindUninstallRules(status *Status, currentRules []parser.
 				// If there's no undo command, Down() is a no-op but UpdateStatus
 				// still removes the status entry.
 				rules = append(rules, parser.Rule{
-					Action:   "uninstall",
-					RunShURL: r.Command,
-					RunUndo:  r.UndoCmd,
-					RunSudo:  r.Sudo,
-					OSList:   []string{osName},
+					Action:      "uninstall",
+					RunShURL:    r.Command,
+					RunUndo:     r.UndoCmd,
+					RunSudo:     r.Sudo,
+					RunCleanEnv: r.CleanEnv,
+					OSList:      []string{osName},
 				})
 			}
 		}
@@ -536,17 +704,23 @@ func (h *RunShHandler) FindUninstallRules(status *Status, currentRules []parser.
 	return rules
 }
 
-// IsInstalled returns true if the run-sh URL in this rule is already in status.
+// IsInstalled returns true if the run-sh URL in this rule is already in
+// status and the path it creates, if any, is still there.
 func (h *RunShHandler) IsInstalled(status *Status, blueprintFile, osName string) bool {
 	normalizedBlueprint := normalizeBlueprint(blueprintFile)
 	for _, r := range status.Runs {
 		if r.Action == "run-sh" && r.Command == h.Rule.RunShURL && normalizeBlueprint(r.Blueprint) == normalizedBlueprint && r.OS == osName {
-			return true
+			return runArtifactPresent(r)
 		}
 	}
 	return false
 }
 
+// IsSatisfied reports whether the path the rule creates already exists.
+func (h *RunShHandler) IsSatisfied() (bool, error) {
+	return h.Rule.RunCreates != "" && pathExists(expandPath(h.Rule.RunCreates)), nil
+}
+
 // DisplayStatusFromStatus displays run-sh status from Status object (delegates to RunHandler)
 func (h *RunShHandler) DisplayStatusFromStatus(status *Status) {
 	// run and run-sh share the same Runs slice; display is handled by RunHandler
@@ -1,6 +1,9 @@
 package handlers
 
 import (
+	"os"
+	"os/exec"
+	"path/filepath"
 	"strings"
 	"testing"
 
@@ -153,3 +156,137 @@ func TestRunShHandlerHttpClientHasTimeout(t *testing.T) {
 		t.Error("httpClient() Timeout is 0, want a non-zero timeout")
 	}
 }
+
+func TestRunHandlerCleanEnv(t *testing.T) {
+	t.Setenv("BLUEPRINT_TEST_LEAK", "leaked")
+
+	t.Run("inherits environment by default", func(t *testing.T) {
+		h := NewRunHandler(parser.Rule{Action: "run", RunCommand: "echo $BLUEPRINT_TEST_LEAK"}, "")
+		out, err := h.Up()
+		if err != nil {
+			t.Fatalf("Up() error: %v", err)
+		}
+		if out != "leaked" {
+			t.Errorf("Up() = %q, want %q", out, "leaked")
+		}
+	})
+
+	t.Run("clean-env drops caller environment", func(t *testing.T) {
+		h := NewRunHandler(parser.Rule{
+			Action:      "run",
+			RunCommand:  `echo "[$BLUEPRINT_TEST_LEAK] $PATH $LANG"`,
+			RunCleanEnv: true,
+		}, "")
+		out, err := h.Up()
+		if err != nil {
+			t.Fatalf("Up() error: %v", err)
+		}
+		want := "[] " + cleanEnvPath + " " + cleanEnvLang
+		if out != want {
+			t.Errorf("Up() = %q, want %q", out, want)
+		}
+	})
+
+	t.Run("clean-env applies to unless check", func(t *testing.T) {
+		h := NewRunHandler(parser.Rule{
+			Action:      "run",
+			RunCommand:  "echo ran",
+			RunUnless:   `test -n "$BLUEPRINT_TEST_LEAK"`,
+			RunCleanEnv: true,
+		}, "")
+		out, err := h.Up()
+		if err != nil {
+			t.Fatalf("Up() error: %v", err)
+		}
+		if out != "ran" {
+			t.Errorf("Up() = %q, want %q (unless check should not see caller env)", out, "ran")
+		}
+	})
+}
+
+func TestRunHandlerCleanEnvRoundTripsThroughStatus(t *testing.T) {
+	rule := parser.Rule{Action: "run", RunCommand: "echo hi", RunUndo: "echo bye", RunCleanEnv: true}
+	h := NewRunHandler(rule, "")
+	status := &Status{}
+	records := []ExecutionRecord{{Command: "echo hi", Status: "success"}}
+	if err := h.UpdateStatus(status, records, "/tmp/test.bp", "linux"); err != nil {
+		t.Fatalf("UpdateStatus() error: %v", err)
+	}
+	if len(status.Runs) != 1 || !status.Runs[0].CleanEnv {
+		t.Fatalf("expected status entry with CleanEnv, got %+v", status.Runs)
+	}
+
+	uninstall := h.FindUninstallRules(status, nil, "/tmp/test.bp", "linux")
+	if len(uninstall) != 1 || !uninstall[0].RunCleanEnv {
+		t.Errorf("expected uninstall rule with RunCleanEnv, got %+v", uninstall)
+	}
+}
+
+func TestRunHandlerCreates(t *testing.T) {
+	artifact := filepath.Join(t.TempDir(), "rustup")
+	rule := parser.Rule{Action: "run", RunCommand: "touch " + artifact, RunCreates: artifact}
+	h := NewRunHandler(rule, "")
+
+	if ok, _ := h.IsSatisfied(); ok {
+		t.Fatal("IsSatisfied() = true before the artifact exists")
+	}
+	if _, err := h.Up(); err != nil {
+		t.Fatalf("Up() error: %v", err)
+	}
+	if ok, _ := h.IsSatisfied(); !ok {
+		t.Fatal("IsSatisfied() = false after the command created the artifact")
+	}
+	out, err := h.Up()
+	if err != nil || out != "skipped (creates exists): "+artifact {
+		t.Errorf("second Up() = %q, %v, want a creates skip", out, err)
+	}
+
+	status := &Status{}
+	records := []ExecutionRecord{{Command: "echo other", Status: "success"}, {Command: "# other", Status: "success", Output: out}}
+	if err := h.UpdateStatus(status, records, "/tmp/test.bp", "linux"); err != nil {
+		t.Fatalf("UpdateStatus() error: %v", err)
+	}
+	if len(status.Runs) != 1 || status.Runs[0].Creates != artifact {
+		t.Fatalf("expected status entry with Creates, got %+v", status.Runs)
+	}
+	if !h.IsInstalled(status, "/tmp/test.bp", "linux") {
+		t.Error("IsInstalled() = false while the artifact exists")
+	}
+	if err := os.Remove(artifact); err != nil {
+		t.Fatal(err)
+	}
+	if h.IsInstalled(status, "/tmp/test.bp", "linux") {
+		t.Error("IsInstalled() = true after the artifact was deleted")
+	}
+}
+
+func TestRunShellExportGuards(t *testing.T) {
+	def := GetAction("run")
+	rule := parser.Rule{Action: "run", RunCommand: "make install", RunCreates: "~/.local/bin/tool", RunUnless: "which tool"}
+	got := strings.Join(def.ShellExport(rule, "bash", "linux"), "\n")
+	want := "if [ ! -e \"$HOME/.local/bin/tool\" ] && ! (which tool) >/dev/null 2>&1; then\n  make install\nfi"
+	if got != want {
+		t.Errorf("ShellExport() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestRunHandlerShell(t *testing.T) {
+	if _, err := exec.LookPath("bash"); err != nil {
+		t.Skip("bash not installed")
+	}
+	// [[ ]] is a bash-ism that plain sh rejects
+	rule := parser.Rule{Action: "run", RunCommand: `[[ -n "$BASH_VERSION" ]] && echo bash`, Shell: "bash"}
+	out, err := NewRunHandler(rule, "").Up()
+	if err != nil {
+		t.Fatalf("Up() error: %v", err)
+	}
+	if out != "bash" {
+		t.Errorf("Up() = %q, want %q", out, "bash")
+	}
+
+	t.Setenv("BLUEPRINT_SHELL", "bash")
+	rule.Shell = ""
+	if out, err := NewRunHandler(rule, "").Up(); err != nil || out != "bash" {
+		t.Errorf("Up() with BLUEPRINT_SHELL=bash = %q, %v", out, err)
+	}
+}
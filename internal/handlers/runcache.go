@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"os/exec"
+	"strings"
+	"sync"
+)
+
+// The run cache memoizes commands that many rules repeat during one apply —
+// `which brew`, `brew list --versions git`, `apt-get update` — so each runs
+// once per run instead of once per rule. The engine calls ResetRunCache when
+// a run starts. Concurrent callers of the same key wait for the first one and
+// share its result.
+//
+// Entries are of two kinds, with different cache-busting rules:
+//
+//   - queryEntry: lookups of what is installed (which, command -v, brew list,
+//     PATH lookups). Any other command run through executeCommandWithCache
+//     may install or remove something, so it drops every query entry.
+//   - refreshEntry: package index refreshes (apt-get update, brew update, dnf
+//     makecache). They stay valid for the whole run unless the sources they
+//     read change: handlers that add or remove a repository or key call
+//     InvalidateRunCache(refreshEntry).
+//
+// Handlers with a lookup of their own should go through cachedRun or
+// cachedLookPath with the matching kind, and call InvalidateRunCache after
+// changing what such a lookup reports without using executeCommandWithCache.
+
+type runCacheKind int
+
+const (
+	queryEntry runCacheKind = iota
+	refreshEntry
+)
+
+type runCacheEntry struct {
+	kind   runCacheKind
+	once   sync.Once
+	output string
+	err    error
+}
+
+var (
+	runCacheMu      sync.Mutex
+	runCacheEntries = map[string]*runCacheEntry{}
+)
+
+// ResetRunCache drops every cached result. The engine calls it at the start
+// of each run, so nothing is carried over from an earlier one.
+func ResetRunCache() {
+	runCacheMu.Lock()
+	runCacheEntries = map[string]*runCacheEntry{}
+	runCacheMu.Unlock()
+}
+
+// InvalidateRunCache drops the cached results of the given kind, so the next
+// lookup or refresh runs again.
+func InvalidateRunCache(kind runCacheKind) {
+	runCacheMu.Lock()
+	defer runCacheMu.Unlock()
+	for key, entry := range runCacheEntries {
+		if entry.kind == kind {
+			delete(runCacheEntries, key)
+		}
+	}
+}
+
+// cachedRun returns the result of fn for key, calling it only the first time
+// key is asked for in this run (or since its kind was invalidated).
+func cachedRun(kind runCacheKind, key string, fn func() (string, error)) (string, error) {
+	runCacheMu.Lock()
+	entry, ok := runCacheEntries[key]
+	if !ok {
+		entry = &runCacheEntry{kind: kind}
+		runCacheEntries[key] = entry
+	}
+	runCacheMu.Unlock()
+
+	entry.once.Do(func() {
+		entry.output, entry.err = fn()
+	})
+	return entry.output, entry.err
+}
+
+// cachedLookPath is exec.LookPath memoized for the run.
+func cachedLookPath(name string) (string, error) {
+	return cachedRun(queryEntry, "lookpath:"+name, func() (string, error) {
+		return exec.LookPath(name)
+	})
+}
+
+// refreshCommands are the package index refreshes executeCommandWithCache
+// runs once per run.
+var refreshCommands = map[string]bool{
+	"apt-get update":      true,
+	"sudo apt-get update": true,
+	"apt update":          true,
+	"sudo apt update":     true,
+	"brew update":         true,
+	"dnf makecache":       true,
+	"sudo dnf makecache":  true,
+}
+
+// commandCacheKind reports whether cmd is a refresh or a read-only query that
+// may be answered from the run cache, and of which kind.
+func commandCacheKind(cmd string) (runCacheKind, bool) {
+	cmd = strings.TrimSpace(cmd)
+	if refreshCommands[cmd] || strings.HasSuffix(cmd, "/brew update") {
+		return refreshEntry, true
+	}
+	for _, prefix := range []string{"which ", "command -v "} {
+		if strings.HasPrefix(cmd, prefix) && !strings.ContainsAny(cmd, "|;&><") {
+			return queryEntry, true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestExecuteCommandWithCacheSquashesRefreshes(t *testing.T) {
+	ResetRunCache()
+	defer ResetRunCache()
+
+	var mu sync.Mutex
+	calls := map[string]int{}
+	originalExecutor := commandExecutor
+	defer func() { commandExecutor = originalExecutor }()
+	commandExecutor = &customMockExecutor{
+		executeFunc: func(cmd string) (string, error) {
+			mu.Lock()
+			calls[cmd]++
+			mu.Unlock()
+			return "", nil
+		},
+	}
+
+	var wg sync.WaitGroup
+	for range 5 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, _ = executeCommandWithCache("sudo apt-get update")
+			_, _ = executeCommandWithCache("which asdf")
+		}()
+	}
+	wg.Wait()
+	if calls["sudo apt-get update"] != 1 || calls["which asdf"] != 1 {
+		t.Fatalf("calls = %v, want each cached command run once", calls)
+	}
+
+	// An install may change what lookups report, but not the package index
+	_, _ = executeCommandWithCache("sudo apt-get install -y git")
+	_, _ = executeCommandWithCache("which asdf")
+	_, _ = executeCommandWithCache("sudo apt-get update")
+	if calls["which asdf"] != 2 || calls["sudo apt-get update"] != 1 {
+		t.Errorf("after install calls = %v, want which rerun and update still cached", calls)
+	}
+
+	// A changed repository does invalidate the index refresh
+	InvalidateRunCache(refreshEntry)
+	_, _ = executeCommandWithCache("sudo apt-get update")
+	if calls["sudo apt-get update"] != 2 {
+		t.Errorf("after invalidation apt-get update ran %d times, want 2", calls["sudo apt-get update"])
+	}
+
+	// Installs themselves are never cached
+	_, _ = executeCommandWithCache("sudo apt-get install -y git")
+	if calls["sudo apt-get install -y git"] != 2 {
+		t.Errorf("install ran %d times, want 2", calls["sudo apt-get install -y git"])
+	}
+}
+
+func TestCommandCacheKind(t *testing.T) {
+	tests := []struct {
+		cmd       string
+		kind      runCacheKind
+		cacheable bool
+	}{
+		{"apt-get update", refreshEntry, true},
+		{"/opt/homebrew/bin/brew update", refreshEntry, true},
+		{"which brew", queryEntry, true},
+		{"command -v mise", queryEntry, true},
+		{"which brew && brew install git", 0, false},
+		{"apt-get update && apt-get install -y git", 0, false},
+		{"brew install git", 0, false},
+	}
+	for _, tt := range tests {
+		kind, ok := commandCacheKind(tt.cmd)
+		if ok != tt.cacheable || (ok && kind != tt.kind) {
+			t.Errorf("commandCacheKind(%q) = %v, %v, want %v, %v", tt.cmd, kind, ok, tt.kind, tt.cacheable)
+		}
+	}
+}
@@ -1,22 +1,35 @@
 package handlers
 
 import (
-	"encoding/json"
 	"fmt"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strings"
-	"time"
 
 	"github.com/elpic/blueprint/internal/parser"
 	"github.com/elpic/blueprint/internal/ui"
+	"github.com/elpic/blueprint/internal/ui/timeutil"
 )
 
 func init() {
 	RegisterAction(ActionDef{
 		Name:   "schedule",
 		Prefix: "schedule ",
+		Meta: ActionMeta{
+			Summary: "Run blueprint apply on a schedule with cron.",
+			Usage:   "schedule daily|weekly|hourly source: <blueprint> | schedule cron: \"<expr>\" source: <blueprint>",
+			Attrs: []AttrMeta{
+				{Name: "cron", Type: "cron", Description: "Cron expression, quoted when it has spaces"},
+				{Name: "source", Type: "string", Required: true, Description: "Blueprint the schedule applies"},
+			},
+			Examples: []string{
+				"schedule daily source: ~/setup.bp",
+				"schedule cron: \"0 9 * * 1\" source: @github:user/setup",
+			},
+			OS:  []string{"mac", "linux"},
+			Doc: "schedule.md",
+		},
 		NewHandler: func(rule parser.Rule, basePath string, passwordCache map[string]string) Handler {
 			return NewScheduleHandler(rule, basePath)
 		},
@@ -183,21 +196,10 @@ func (h *ScheduleHandler) UpWithStatus(status *Status, records []ExecutionRecord
 	return fmt.Sprintf("Scheduled: %s", line), nil
 }
 
-// loadStatus reads the current blueprint status from ~/.blueprint/status.json.
-// Returns an empty Status if the file does not exist or cannot be parsed.
+// loadStatus returns the current blueprint status.
+// Returns an empty Status if there is none or it cannot be read.
 func loadStatus() *Status {
-	homeDir, err := os.UserHomeDir()
-	if err != nil {
-		return &Status{}
-	}
-	data, err := os.ReadFile(filepath.Join(homeDir, ".blueprint", "status.json"))
-	if err != nil {
-		return &Status{}
-	}
-	var s Status
-	if err := json.Unmarshal(data, &s); err != nil {
-		return &Status{}
-	}
+	s := CurrentStatus()
 	return &s
 }
 
@@ -270,7 +272,7 @@ func (h *ScheduleHandler) UpdateStatus(status *Status, records []ExecutionRecord
 		status.Schedules = append(status.Schedules, ScheduleStatus{
 			CronExpr:    cronExpr,
 			Source:      source,
-			InstalledAt: time.Now().Format(time.RFC3339),
+			InstalledAt: timeutil.Now(),
 			Blueprint:   blueprint,
 			OS:          osName,
 		})
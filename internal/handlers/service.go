@@ -0,0 +1,374 @@
+package handlers
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/elpic/blueprint/internal/parser"
+	"github.com/elpic/blueprint/internal/ui"
+	"github.com/elpic/blueprint/internal/ui/timeutil"
+)
+
+func init() {
+	RegisterAction(ActionDef{
+		Name:   "service",
+		Prefix: "service ",
+		Meta: ActionMeta{
+			Summary: "Enable or start a systemd unit (Linux) or launchd service (macOS).",
+			Usage:   "service <name> [state: enabled|started] [scope: system|user]",
+			Attrs: []AttrMeta{
+				{Name: "state", Type: "string", Default: "enabled", Description: "enabled starts the service now and at boot, started only starts it now"},
+				{Name: "scope", Type: "string", Default: "system", Description: "system services need sudo; user services run for the current user"},
+			},
+			Examples: []string{
+				"service docker on: [linux]",
+				"service syncthing scope: user on: [linux]",
+				"service com.example.agent scope: user on: [mac]",
+			},
+			OS:  []string{"mac", "linux"},
+			Doc: "service.md",
+		},
+		NewHandler: func(rule parser.Rule, basePath string, passwordCache map[string]string) Handler {
+			return NewServiceHandler(rule, basePath)
+		},
+		RuleKey: func(rule parser.Rule) string {
+			return "service-" + rule.ServiceName
+		},
+		Detect: func(rule parser.Rule) bool {
+			return rule.ServiceName != ""
+		},
+		Summary: func(rule parser.Rule) string {
+			return rule.ServiceName
+		},
+		OrphanIndex: func(rule parser.Rule, index func(string)) {
+			index(rule.ServiceName)
+		},
+		Verify: func(e StatusEntry) bool {
+			s := e.(*ServiceStatus)
+			rule := parser.Rule{ServiceName: s.Name, ServiceState: s.State, ServiceScope: s.Scope}
+			return serviceRunning(rule, s.OS)
+		},
+		ShellExport: func(rule parser.Rule, _, osName string) []string {
+			return []string{serviceCommand(rule, osName, true, "$HOME", "$(id -u)")}
+		},
+	})
+}
+
+// ServiceHandler enables or starts a service with systemctl on Linux and
+// launchctl on macOS. System services are managed with sudo, user services
+// (systemctl --user, launchd agents in the gui/<uid> domain) without.
+type ServiceHandler struct {
+	BaseHandler
+}
+
+// NewServiceHandler creates a new service handler
+func NewServiceHandler(rule parser.Rule, basePath string) *ServiceHandler {
+	return &ServiceHandler{
+		BaseHandler: BaseHandler{
+			Rule:     rule,
+			BasePath: basePath,
+		},
+	}
+}
+
+// serviceQuery runs a read-only systemctl or launchctl command and returns
+// its output. Overridable for testing.
+var serviceQuery = func(name string, args ...string) (string, error) {
+	out, err := exec.Command(name, args...).Output() // #nosec G204 -- service names are validated by the parser
+	return string(out), err
+}
+
+// serviceState and serviceScope return the rule's state and scope, with
+// their defaults for rules built outside the parser.
+func serviceState(rule parser.Rule) string {
+	if rule.ServiceState == "" {
+		return "enabled"
+	}
+	return rule.ServiceState
+}
+
+func serviceScope(rule parser.Rule) string {
+	if rule.ServiceScope == "" {
+		return "system"
+	}
+	return rule.ServiceScope
+}
+
+// launchdTarget returns the launchd domain and service target of rule, e.g.
+// "gui/501" and "gui/501/com.example.agent". uid is a number or, in exported
+// scripts, "$(id -u)".
+func launchdTarget(rule parser.Rule, uid string) (domain, target string) {
+	domain = "system"
+	if serviceScope(rule) == "user" {
+		domain = "gui/" + uid
+	}
+	return domain, domain + "/" + rule.ServiceName
+}
+
+// launchdPlist returns where the property list of a launchd service lives.
+func launchdPlist(rule parser.Rule, home string) string {
+	if serviceScope(rule) == "user" {
+		return filepath.Join(home, "Library", "LaunchAgents", rule.ServiceName+".plist")
+	}
+	return filepath.Join("/Library", "LaunchDaemons", rule.ServiceName+".plist")
+}
+
+// serviceCommand returns the command that brings the service to the rule's
+// state (up) or undoes it on osName. home and uid are used for launchd user
+// services.
+func serviceCommand(rule parser.Rule, osName string, up bool, home, uid string) string {
+	name := rule.ServiceName
+	started := serviceState(rule) == "started"
+
+	if osName == "mac" {
+		launchctl := "launchctl"
+		if serviceScope(rule) == "system" {
+			launchctl = "sudo launchctl"
+		}
+		domain, target := launchdTarget(rule, uid)
+		switch {
+		case up && started:
+			return fmt.Sprintf("%s kickstart %s", launchctl, target)
+		case up:
+			return fmt.Sprintf("%s enable %s && { %s print %s >/dev/null 2>&1 || %s bootstrap %s %s; }",
+				launchctl, target, launchctl, target, launchctl, domain, launchdPlist(rule, home))
+		case started:
+			return fmt.Sprintf("%s kill SIGTERM %s", launchctl, target)
+		default:
+			return fmt.Sprintf("%s bootout %s 2>/dev/null; %s disable %s", launchctl, target, launchctl, target)
+		}
+	}
+
+	systemctl := "sudo systemctl"
+	if serviceScope(rule) == "user" {
+		systemctl = "systemctl --user"
+	}
+	switch {
+	case up && started:
+		return fmt.Sprintf("%s start %s", systemctl, name)
+	case up:
+		return fmt.Sprintf("%s enable --now %s", systemctl, name)
+	case started:
+		return fmt.Sprintf("%s stop %s", systemctl, name)
+	default:
+		return fmt.Sprintf("%s disable --now %s", systemctl, name)
+	}
+}
+
+// serviceRunning reports whether the service is in the rule's state on
+// osName: running, and for enabled services also set to start at boot (on
+// Linux) or loaded (on macOS).
+func serviceRunning(rule parser.Rule, osName string) bool {
+	if osName == "mac" {
+		_, target := launchdTarget(rule, strconv.Itoa(os.Getuid()))
+		out, err := serviceQuery("launchctl", "print", target)
+		if err != nil {
+			return false
+		}
+		return serviceState(rule) == "enabled" || strings.Contains(out, "state = running")
+	}
+
+	var args []string
+	if serviceScope(rule) == "user" {
+		args = append(args, "--user")
+	}
+	if _, err := serviceQuery("systemctl", append(args, "is-active", "--quiet", rule.ServiceName)...); err != nil {
+		return false
+	}
+	if serviceState(rule) == "enabled" {
+		if _, err := serviceQuery("systemctl", append(args, "is-enabled", "--quiet", rule.ServiceName)...); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// command returns the command for this rule on the current OS.
+func (h *ServiceHandler) command(up bool) string {
+	home, _ := os.UserHomeDir()
+	return serviceCommand(h.Rule, getOSName(), up, home, strconv.Itoa(os.Getuid()))
+}
+
+// Up enables or starts the service
+func (h *ServiceHandler) Up() (string, error) {
+	if err := h.checkOS(); err != nil {
+		return "", err
+	}
+	if out, err := executeCommandWithCache(h.command(true)); err != nil {
+		return "", fmt.Errorf("failed to %s service %s: %w\n%s", h.verb(true), h.Rule.ServiceName, err, out)
+	}
+	return fmt.Sprintf("%s %s", h.verb(true), h.Rule.ServiceName), nil
+}
+
+// Down disables or stops the service
+func (h *ServiceHandler) Down() (string, error) {
+	if err := h.checkOS(); err != nil {
+		return "", err
+	}
+	if out, err := executeCommandWithCache(h.command(false)); err != nil {
+		return "", fmt.Errorf("failed to %s service %s: %w\n%s", h.verb(false), h.Rule.ServiceName, err, out)
+	}
+	return fmt.Sprintf("%s %s", h.verb(false), h.Rule.ServiceName), nil
+}
+
+// checkOS fails on systems without systemd or launchd support.
+func (h *ServiceHandler) checkOS() error {
+	if osName := getOSName(); osName != "mac" && osName != "linux" {
+		return fmt.Errorf("service is not supported on %s", osName)
+	}
+	return nil
+}
+
+// verb describes what Up (up) or Down does to the service.
+func (h *ServiceHandler) verb(up bool) string {
+	started := serviceState(h.Rule) == "started"
+	switch {
+	case up && started:
+		return "started"
+	case up:
+		return "enabled"
+	case started:
+		return "stopped"
+	default:
+		return "disabled"
+	}
+}
+
+// IsSatisfied reports whether the service already is in the rule's state
+func (h *ServiceHandler) IsSatisfied() (bool, error) {
+	return serviceRunning(h.Rule, getOSName()), nil
+}
+
+// GetCommand returns the actual command that will be executed
+func (h *ServiceHandler) GetCommand() string {
+	return h.command(h.Rule.Action != "uninstall")
+}
+
+// UpdateStatus records the managed service, or removes the one undone
+func (h *ServiceHandler) UpdateStatus(status *Status, records []ExecutionRecord, blueprint string, osName string) error {
+	blueprint = normalizeBlueprint(blueprint)
+
+	switch h.Rule.Action {
+	case "service":
+		if _, ok := commandSuccessfullyExecuted(h.GetCommand(), records); !ok {
+			return nil
+		}
+		status.Services = removeServiceStatus(status.Services, h.Rule.ServiceName, blueprint, osName)
+		status.Services = append(status.Services, ServiceStatus{
+			Name:        h.Rule.ServiceName,
+			State:       serviceState(h.Rule),
+			Scope:       serviceScope(h.Rule),
+			InstalledAt: timeutil.Now(),
+			Blueprint:   blueprint,
+			OS:          osName,
+		})
+	case "uninstall":
+		if _, ok := commandSuccessfullyExecuted(h.GetCommand(), records); !ok {
+			return nil
+		}
+		status.Services = removeServiceStatus(status.Services, h.Rule.ServiceName, blueprint, osName)
+	}
+
+	return nil
+}
+
+// NeedsSudo returns true for system services
+func (h *ServiceHandler) NeedsSudo() bool {
+	return serviceScope(h.Rule) == "system"
+}
+
+// GetDependencyKey returns the unique key for this rule in dependency resolution
+func (h *ServiceHandler) GetDependencyKey() string {
+	return getDependencyKey(h.Rule, "service-"+h.Rule.ServiceName)
+}
+
+// GetDisplayDetails returns the service to display during execution
+func (h *ServiceHandler) GetDisplayDetails(isUninstall bool) string {
+	return h.Rule.ServiceName
+}
+
+// DisplayInfo displays handler-specific information
+func (h *ServiceHandler) DisplayInfo() {
+	formatFunc := ui.FormatInfo
+	if h.Rule.Action == "uninstall" {
+		formatFunc = ui.FormatDim
+	}
+
+	printInfo(formatFunc, "Service", h.Rule.ServiceName)
+	printInfo(formatFunc, "State", serviceState(h.Rule)+" ("+serviceScope(h.Rule)+")")
+}
+
+// DisplayStatusFromStatus displays service handler status from Status object
+func (h *ServiceHandler) DisplayStatusFromStatus(status *Status) {
+	if status == nil || len(status.Services) == 0 {
+		return
+	}
+
+	rows := make([]statusRow, 0, len(status.Services))
+	for _, s := range status.Services {
+		rows = append(rows, statusRow{
+			name:    s.Name,
+			details: []string{s.State, timeutil.Display(s.InstalledAt)},
+			tags:    []string{s.Scope, s.OS, abbreviateBlueprintPath(s.Blueprint)},
+			entry:   &s,
+		})
+	}
+	printStatusSection("Services:", rows)
+}
+
+// GetState returns handler-specific state as key-value pairs
+func (h *ServiceHandler) GetState(isUninstall bool) map[string]string {
+	return map[string]string{
+		"summary": h.GetDisplayDetails(isUninstall),
+		"service": h.Rule.ServiceName,
+		"state":   serviceState(h.Rule),
+		"scope":   serviceScope(h.Rule),
+	}
+}
+
+// FindUninstallRules compares service status against current rules and
+// returns rules that disable or stop the services no longer in the blueprint
+func (h *ServiceHandler) FindUninstallRules(status *Status, currentRules []parser.Rule, blueprintFile, osName string) []parser.Rule {
+	normalizedBlueprint := normalizeBlueprint(blueprintFile)
+
+	current := make(map[string]bool)
+	for _, rule := range currentRules {
+		if rule.Action == "service" && rule.ServiceName != "" {
+			current[rule.ServiceName] = true
+		}
+	}
+
+	var rules []parser.Rule
+	for _, s := range status.Services {
+		if normalizeBlueprint(s.Blueprint) == normalizedBlueprint && s.OS == osName && !current[s.Name] {
+			rules = append(rules, parser.Rule{
+				Action:       "uninstall",
+				ServiceName:  s.Name,
+				ServiceState: s.State,
+				ServiceScope: s.Scope,
+				OSList:       []string{osName},
+			})
+		}
+	}
+	return rules
+}
+
+// IsInstalled returns true if the service is in status with the same state and scope.
+func (h *ServiceHandler) IsInstalled(status *Status, blueprintFile, osName string) bool {
+	normalizedBlueprint := normalizeBlueprint(blueprintFile)
+	for _, s := range status.Services {
+		if s.Name == h.Rule.ServiceName && normalizeBlueprint(s.Blueprint) == normalizedBlueprint && s.OS == osName &&
+			s.State == serviceState(h.Rule) && s.Scope == serviceScope(h.Rule) {
+			return true
+		}
+	}
+	return false
+}
+
+func removeServiceStatus(sl []ServiceStatus, name, blueprint, osName string) []ServiceStatus {
+	return removeStatusEntry[ServiceStatus, *ServiceStatus](sl, name, blueprint, osName)
+}
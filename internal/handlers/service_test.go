@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/elpic/blueprint/internal/parser"
+)
+
+// stubServiceSystem stubs the OS and the command executor, recording the
+// commands run, and makes every service query report queryErr.
+func stubServiceSystem(t *testing.T, osName string, queryErr error) *[]string {
+	t.Helper()
+	origOS, origExec, origQuery := getOSName, commandExecutor, serviceQuery
+	t.Cleanup(func() { getOSName, commandExecutor, serviceQuery = origOS, origExec, origQuery })
+
+	getOSName = func() string { return osName }
+	var ran []string
+	commandExecutor = &customMockExecutor{executeFunc: func(cmd string) (string, error) {
+		ran = append(ran, cmd)
+		return "", nil
+	}}
+	serviceQuery = func(string, ...string) (string, error) { return "", queryErr }
+	return &ran
+}
+
+func TestServiceCommand(t *testing.T) {
+	tests := []struct {
+		rule parser.Rule
+		os   string
+		up   bool
+		want string
+	}{
+		{parser.Rule{ServiceName: "docker"}, "linux", true, "sudo systemctl enable --now docker"},
+		{parser.Rule{ServiceName: "docker"}, "linux", false, "sudo systemctl disable --now docker"},
+		{parser.Rule{ServiceName: "syncthing", ServiceState: "started", ServiceScope: "user"}, "linux", true, "systemctl --user start syncthing"},
+		{parser.Rule{ServiceName: "syncthing", ServiceState: "started", ServiceScope: "user"}, "linux", false, "systemctl --user stop syncthing"},
+		{parser.Rule{ServiceName: "com.example.agent", ServiceScope: "user"}, "mac", true,
+			"launchctl enable gui/501/com.example.agent && { launchctl print gui/501/com.example.agent >/dev/null 2>&1 || launchctl bootstrap gui/501 /Users/me/Library/LaunchAgents/com.example.agent.plist; }"},
+		{parser.Rule{ServiceName: "com.example.agent", ServiceScope: "user"}, "mac", false,
+			"launchctl bootout gui/501/com.example.agent 2>/dev/null; launchctl disable gui/501/com.example.agent"},
+		{parser.Rule{ServiceName: "com.example.daemon", ServiceState: "started"}, "mac", true, "sudo launchctl kickstart system/com.example.daemon"},
+	}
+	for _, tt := range tests {
+		if got := serviceCommand(tt.rule, tt.os, tt.up, "/Users/me", "501"); got != tt.want {
+			t.Errorf("serviceCommand(%+v, %s, %v) = %q, want %q", tt.rule, tt.os, tt.up, got, tt.want)
+		}
+	}
+}
+
+func TestServiceHandlerUpAndStatus(t *testing.T) {
+	ran := stubServiceSystem(t, "linux", nil)
+
+	rule := parser.Rule{Action: "service", ServiceName: "docker", ServiceState: "enabled", ServiceScope: "system"}
+	h := NewServiceHandler(rule, "")
+	out, err := h.Up()
+	if err != nil || out != "enabled docker" {
+		t.Fatalf("Up() = %q, %v", out, err)
+	}
+	if len(*ran) != 1 || (*ran)[0] != "sudo systemctl enable --now docker" {
+		t.Errorf("ran %q", *ran)
+	}
+	if !h.NeedsSudo() {
+		t.Error("a system service needs sudo")
+	}
+
+	status := &Status{}
+	records := []ExecutionRecord{{Command: h.GetCommand(), Status: "success"}}
+	if err := h.UpdateStatus(status, records, "/tmp/setup.bp", "linux"); err != nil {
+		t.Fatal(err)
+	}
+	if len(status.Services) != 1 || status.Services[0].State != "enabled" || status.Services[0].Scope != "system" {
+		t.Fatalf("status services = %+v", status.Services)
+	}
+	if !h.IsInstalled(status, "/tmp/setup.bp", "linux") {
+		t.Error("IsInstalled() = false after UpdateStatus")
+	}
+
+	// Removing the rule disables the service it enabled
+	uninstall := h.FindUninstallRules(status, nil, "/tmp/setup.bp", "linux")
+	if len(uninstall) != 1 || uninstall[0].ServiceName != "docker" || uninstall[0].ServiceState != "enabled" {
+		t.Fatalf("FindUninstallRules() = %+v", uninstall)
+	}
+	down := NewServiceHandler(uninstall[0], "")
+	if _, err := down.Down(); err != nil {
+		t.Fatal(err)
+	}
+	if last := (*ran)[len(*ran)-1]; last != "sudo systemctl disable --now docker" {
+		t.Errorf("Down() ran %q", last)
+	}
+	if err := down.UpdateStatus(status, []ExecutionRecord{{Command: down.GetCommand(), Status: "success"}}, "/tmp/setup.bp", "linux"); err != nil {
+		t.Fatal(err)
+	}
+	if len(status.Services) != 0 {
+		t.Errorf("status services after uninstall = %+v", status.Services)
+	}
+}
+
+func TestServiceHandlerIsSatisfied(t *testing.T) {
+	stubServiceSystem(t, "linux", nil)
+	h := NewServiceHandler(parser.Rule{Action: "service", ServiceName: "docker"}, "")
+	if ok, _ := h.IsSatisfied(); !ok {
+		t.Error("IsSatisfied() = false for an active, enabled unit")
+	}
+
+	stubServiceSystem(t, "linux", errors.New("exit status 3"))
+	if ok, _ := h.IsSatisfied(); ok {
+		t.Error("IsSatisfied() = true for an inactive unit")
+	}
+}
@@ -2,7 +2,6 @@ package handlers
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"os"
 	"os/exec"
@@ -13,15 +12,25 @@ import (
 	"strings"
 	"time"
 
-	"github.com/elpic/blueprint/internal"
 	"github.com/elpic/blueprint/internal/parser"
 	"github.com/elpic/blueprint/internal/ui"
+	"github.com/elpic/blueprint/internal/ui/timeutil"
 )
 
 func init() {
 	RegisterAction(ActionDef{
 		Name:   "shell",
 		Prefix: "shell ",
+		Meta: ActionMeta{
+			Summary: "Set the default login shell.",
+			Usage:   "shell <name-or-path>",
+			Examples: []string{
+				"shell zsh",
+				"shell /opt/homebrew/bin/fish on: [mac]",
+			},
+			OS:  []string{"mac", "linux"},
+			Doc: "shell.md",
+		},
 		NewHandler: func(rule parser.Rule, basePath string, passwordCache map[string]string) Handler {
 			return NewShellHandler(rule, basePath)
 		},
@@ -146,7 +155,7 @@ func (h *ShellHandler) Up() (string, error) {
 // Down reverts the shell change using stored previous shell information
 func (h *ShellHandler) Down() (string, error) {
 	// Load current status to find the previous shell
-	status := h.loadCurrentStatus()
+	status := CurrentStatus()
 
 	// Get current user
 	currentUser, err := user.Current()
@@ -289,7 +298,7 @@ func (h *ShellHandler) UpdateStatus(status *Status, records []ExecutionRecord, b
 				Shell:         shellPath,
 				PreviousShell: previousShell,
 				User:          currentUser.Username,
-				ChangedAt:     time.Now().Format(time.RFC3339),
+				ChangedAt:     timeutil.Now(),
 				Blueprint:     blueprint,
 				OS:            osName,
 			})
@@ -330,11 +339,11 @@ func (h *ShellHandler) DisplayInfo() {
 		formatFunc = ui.FormatDim
 	}
 
-	fmt.Printf("  %s\n", formatFunc(fmt.Sprintf("Shell: %s", h.Rule.ShellName)))
+	printInfo(formatFunc, "Shell", h.Rule.ShellName)
 
 	// Try to resolve and show the full path
 	if shellPath, err := h.resolveShellPath(h.Rule.ShellName); err == nil {
-		fmt.Printf("  %s\n", formatFunc(fmt.Sprintf("Path: %s", shellPath)))
+		printInfo(formatFunc, "Path", shellPath)
 	}
 }
 
@@ -624,40 +633,6 @@ func (h *ShellHandler) isMacOS() bool {
 	return runtime.GOOS == "darwin"
 }
 
-// loadCurrentStatus loads the current status from the status file
-func (h *ShellHandler) loadCurrentStatus() Status {
-	var status Status
-	statusPath, err := h.getStatusPath()
-	if err != nil {
-		return status
-	}
-
-	data, err := os.ReadFile(statusPath)
-	if err != nil {
-		return status
-	}
-
-	_ = json.Unmarshal(data, &status)
-	return status
-}
-
-// getStatusPath returns the path to the status file in ~/.blueprint/
-func (h *ShellHandler) getStatusPath() (string, error) {
-	homeDir, err := os.UserHomeDir()
-	if err != nil {
-		return "", fmt.Errorf("failed to get home directory: %w", err)
-	}
-
-	blueprintDir := filepath.Join(homeDir, ".blueprint")
-
-	// Create directory if it doesn't exist
-	if err := os.MkdirAll(blueprintDir, internal.DirectoryPermission); err != nil {
-		return "", fmt.Errorf("failed to create .blueprint directory: %w", err)
-	}
-
-	return filepath.Join(blueprintDir, "status.json"), nil
-}
-
 // findShellStatus finds a shell entry in the status shells list and returns it
 func findShellStatus(shells []ShellStatus, user string, blueprint string, osName string) *ShellStatus {
 	normalizedBlueprint := normalizeBlueprint(blueprint)
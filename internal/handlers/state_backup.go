@@ -0,0 +1,265 @@
+package handlers
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/elpic/blueprint/internal/parser"
+	"github.com/elpic/blueprint/internal/ui"
+	"github.com/elpic/blueprint/internal/ui/timeutil"
+)
+
+func init() {
+	RegisterAction(ActionDef{
+		Name:   "state-backup",
+		Prefix: "state-backup ",
+		Meta: ActionMeta{
+			Summary: "Back up blueprint's own state in ~/.blueprint on a schedule with cron.",
+			Usage:   "state-backup every: daily|weekly|hourly to: <directory>",
+			Attrs: []AttrMeta{
+				{Name: "every", Type: "string", Default: "weekly", Description: "How often to back up: daily, weekly or hourly"},
+				{Name: "to", Type: "path", Required: true, Description: "Directory the backup archives are written to"},
+			},
+			Examples: []string{
+				"state-backup every: weekly to: ~/Backups",
+				"state-backup every: daily to: ~/Dropbox/blueprint",
+			},
+			OS:  []string{"mac", "linux"},
+			Doc: "state-backup.md",
+		},
+		NewHandler: func(rule parser.Rule, basePath string, passwordCache map[string]string) Handler {
+			return NewStateBackupHandler(rule, basePath)
+		},
+		RuleKey: func(rule parser.Rule) string {
+			return "state-backup-" + rule.StateBackupTo
+		},
+		Detect: func(rule parser.Rule) bool {
+			return rule.StateBackupTo != ""
+		},
+		Summary: func(rule parser.Rule) string {
+			return rule.StateBackupEvery + " to " + rule.StateBackupTo
+		},
+		OrphanIndex: func(rule parser.Rule, index func(string)) {
+			index(rule.StateBackupTo)
+		},
+		ShellExport: func(rule parser.Rule, _, _ string) []string {
+			// cron's shell expands $HOME, but not ~ inside quotes
+			to := rule.StateBackupTo
+			if rest, ok := strings.CutPrefix(to, "~/"); ok {
+				to = "$HOME/" + rest
+			}
+			command := fmt.Sprintf(`state backup --to "%s"`, to)
+			cronLine := fmt.Sprintf(`@%s blueprint %s >> ~/.blueprint/state-backup.log 2>&1`, rule.StateBackupEvery, command)
+			return []string{
+				fmt.Sprintf(`(crontab -l 2>/dev/null | grep -vF %s; echo %s) | crontab -`, shellQ(command), shellQ(cronLine)),
+			}
+		},
+	})
+}
+
+// StateBackupHandler installs/removes a crontab entry that archives
+// ~/.blueprint with `blueprint state backup`.
+type StateBackupHandler struct {
+	BaseHandler
+}
+
+// NewStateBackupHandler creates a new state-backup handler
+func NewStateBackupHandler(rule parser.Rule, basePath string) *StateBackupHandler {
+	return &StateBackupHandler{
+		BaseHandler: BaseHandler{
+			Rule:     rule,
+			BasePath: basePath,
+		},
+	}
+}
+
+// stateBackupLogPath returns the path to the state backup log file
+func stateBackupLogPath() string {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "~/.blueprint/state-backup.log"
+	}
+	return filepath.Join(homeDir, ".blueprint", "state-backup.log")
+}
+
+// cronLine returns the full crontab line for this rule. The destination is
+// expanded here because cron does not expand ~ inside quotes.
+func (h *StateBackupHandler) cronLine() string {
+	return fmt.Sprintf(`@%s %s state backup --to "%s" >> %s 2>&1`,
+		h.Rule.StateBackupEvery, blueprintBinary(), expandPath(h.Rule.StateBackupTo), stateBackupLogPath())
+}
+
+// UpWithCrontab adds the crontab entry using injectable crontab functions.
+// This is the testable core of Up().
+func (h *StateBackupHandler) UpWithCrontab(readCron func() (string, error), writeCron func(string) error) (string, error) {
+	current, err := readCron()
+	if err != nil {
+		return "", fmt.Errorf("failed to read crontab: %w", err)
+	}
+
+	line := h.cronLine()
+	if strings.Contains(current, line) {
+		return fmt.Sprintf("already scheduled: %s", line), nil
+	}
+
+	newContent := current
+	if newContent != "" && !strings.HasSuffix(newContent, "\n") {
+		newContent += "\n"
+	}
+	newContent += line + "\n"
+
+	if err := writeCron(newContent); err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("Scheduled state backup: %s", line), nil
+}
+
+// Up adds the crontab entry for this state-backup rule
+func (h *StateBackupHandler) Up() (string, error) {
+	return h.UpWithCrontab(readCrontab, writeCrontab)
+}
+
+// DownWithCrontab removes the crontab entry using injectable crontab functions.
+func (h *StateBackupHandler) DownWithCrontab(readCron func() (string, error), writeCron func(string) error) (string, error) {
+	current, err := readCron()
+	if err != nil {
+		return "", fmt.Errorf("failed to read crontab: %w", err)
+	}
+
+	line := h.cronLine()
+	if !strings.Contains(current, line) {
+		return fmt.Sprintf("crontab entry not found (already removed): %s", line), nil
+	}
+
+	var kept []string
+	for _, l := range strings.Split(current, "\n") {
+		if l != line {
+			kept = append(kept, l)
+		}
+	}
+	newContent := strings.TrimRight(strings.Join(kept, "\n"), "\n")
+	if newContent != "" {
+		newContent += "\n"
+	}
+
+	if err := writeCron(newContent); err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("Removed state backup: %s", line), nil
+}
+
+// Down removes the crontab entry for this state-backup rule
+func (h *StateBackupHandler) Down() (string, error) {
+	return h.DownWithCrontab(readCrontab, writeCrontab)
+}
+
+// GetCommand returns a string representing the install operation (used for record matching)
+func (h *StateBackupHandler) GetCommand() string {
+	return fmt.Sprintf(`{ crontab -l 2>/dev/null; echo "%s"; } | crontab -`, h.cronLine())
+}
+
+// UpdateStatus updates the status after installing or removing a state backup
+func (h *StateBackupHandler) UpdateStatus(status *Status, records []ExecutionRecord, blueprint string, osName string) error {
+	blueprint = normalizeBlueprint(blueprint)
+	to := h.Rule.StateBackupTo
+
+	if h.Rule.Action == "state-backup" {
+		if _, ok := commandSuccessfullyExecuted(h.GetCommand(), records); !ok {
+			return nil
+		}
+
+		// Replace an entry for the same destination, whose schedule may have changed
+		status.StateBackups = removeStateBackupStatus(status.StateBackups, to, blueprint, osName)
+		status.StateBackups = append(status.StateBackups, StateBackupStatus{
+			Every:       h.Rule.StateBackupEvery,
+			To:          to,
+			InstalledAt: timeutil.Now(),
+			Blueprint:   blueprint,
+			OS:          osName,
+		})
+	} else if h.Rule.Action == "uninstall" && DetectRuleType(h.Rule) == "state-backup" {
+		// Match the schedule too: when it changes, the new entry for the same
+		// destination may already be recorded
+		var kept []StateBackupStatus
+		for _, s := range status.StateBackups {
+			if s.Every != h.Rule.StateBackupEvery || s.To != to || normalizeBlueprint(s.Blueprint) != blueprint || s.OS != osName {
+				kept = append(kept, s)
+			}
+		}
+		status.StateBackups = kept
+	}
+
+	return nil
+}
+
+// DisplayInfo displays handler-specific information
+func (h *StateBackupHandler) DisplayInfo() {
+	formatFunc := ui.FormatInfo
+	if h.Rule.Action == "uninstall" {
+		formatFunc = ui.FormatDim
+	}
+	fmt.Printf("  %s\n", formatFunc(fmt.Sprintf("@%s → blueprint state backup --to %s", h.Rule.StateBackupEvery, h.Rule.StateBackupTo)))
+}
+
+// GetDependencyKey returns the unique key for this rule in dependency resolution
+func (h *StateBackupHandler) GetDependencyKey() string {
+	return getDependencyKey(h.Rule, "state-backup-"+h.Rule.StateBackupTo)
+}
+
+// GetDisplayDetails returns the display detail for this rule during execution
+func (h *StateBackupHandler) GetDisplayDetails(isUninstall bool) string {
+	return fmt.Sprintf("@%s %s", h.Rule.StateBackupEvery, h.Rule.StateBackupTo)
+}
+
+// GetState returns handler-specific state as key-value pairs
+func (h *StateBackupHandler) GetState(isUninstall bool) map[string]string {
+	return map[string]string{
+		"summary": fmt.Sprintf("@%s %s", h.Rule.StateBackupEvery, h.Rule.StateBackupTo),
+		"every":   h.Rule.StateBackupEvery,
+		"to":      h.Rule.StateBackupTo,
+	}
+}
+
+// FindUninstallRules compares state-backup status against current rules and
+// returns uninstall rules for backups no longer in the blueprint or whose
+// schedule changed, so the old crontab line is removed.
+func (h *StateBackupHandler) FindUninstallRules(status *Status, currentRules []parser.Rule, blueprintFile, osName string) []parser.Rule {
+	normalizedBlueprint := normalizeBlueprint(blueprintFile)
+
+	type key struct{ every, to string }
+	current := make(map[key]bool)
+	for _, rule := range currentRules {
+		if rule.Action == "state-backup" {
+			current[key{rule.StateBackupEvery, rule.StateBackupTo}] = true
+		}
+	}
+
+	var rules []parser.Rule
+	for _, s := range status.StateBackups {
+		if normalizeBlueprint(s.Blueprint) == normalizedBlueprint && s.OS == osName && !current[key{s.Every, s.To}] {
+			rules = append(rules, parser.Rule{
+				Action:           "uninstall",
+				StateBackupEvery: s.Every,
+				StateBackupTo:    s.To,
+				OSList:           []string{osName},
+			})
+		}
+	}
+
+	return rules
+}
+
+// IsInstalled returns true if this state backup is already in status with the same schedule.
+func (h *StateBackupHandler) IsInstalled(status *Status, blueprintFile, osName string) bool {
+	normalizedBlueprint := normalizeBlueprint(blueprintFile)
+	for _, s := range status.StateBackups {
+		if s.Every == h.Rule.StateBackupEvery && s.To == h.Rule.StateBackupTo && normalizeBlueprint(s.Blueprint) == normalizedBlueprint && s.OS == osName {
+			return true
+		}
+	}
+	return false
+}
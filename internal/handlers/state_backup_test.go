@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/elpic/blueprint/internal/parser"
+)
+
+func TestStateBackupCronLine(t *testing.T) {
+	h := NewStateBackupHandler(parser.Rule{
+		Action:           "state-backup",
+		StateBackupEvery: "daily",
+		StateBackupTo:    "/backups/my state",
+	}, "")
+
+	line := h.cronLine()
+
+	for _, want := range []string{"@daily ", ` state backup --to "/backups/my state" >> `, "state-backup.log 2>&1"} {
+		if !strings.Contains(line, want) {
+			t.Errorf("cronLine() = %q, missing %q", line, want)
+		}
+	}
+}
+
+func TestStateBackupUpAndDown(t *testing.T) {
+	h := NewStateBackupHandler(parser.Rule{
+		Action:           "state-backup",
+		StateBackupEvery: "weekly",
+		StateBackupTo:    "/backups",
+	}, "")
+
+	written := ""
+	write := func(c string) error {
+		written = c
+		return nil
+	}
+
+	msg, err := h.UpWithCrontab(fakeReadCrontab("other line"), write)
+	if err != nil {
+		t.Fatalf("Up() failed: %v", err)
+	}
+	if !strings.Contains(msg, "Scheduled state backup") {
+		t.Errorf("expected 'Scheduled state backup', got: %q", msg)
+	}
+	if written != "other line\n"+h.cronLine()+"\n" {
+		t.Errorf("Up() wrote %q", written)
+	}
+
+	msg, err = h.UpWithCrontab(fakeReadCrontab(written), fakeWriteCrontab())
+	if err != nil || !strings.Contains(msg, "already scheduled") {
+		t.Errorf("second Up() = %q, %v; want already scheduled", msg, err)
+	}
+
+	msg, err = h.DownWithCrontab(fakeReadCrontab(written), write)
+	if err != nil {
+		t.Fatalf("Down() failed: %v", err)
+	}
+	if !strings.Contains(msg, "Removed state backup") {
+		t.Errorf("expected 'Removed state backup', got: %q", msg)
+	}
+	if written != "other line\n" {
+		t.Errorf("Down() wrote %q, want only the other line", written)
+	}
+}
+
+func TestStateBackupUpdateStatusReplacesSchedule(t *testing.T) {
+	bp := "/home/user/setup.bp"
+	status := &Status{
+		StateBackups: []StateBackupStatus{{Every: "weekly", To: "~/Backups", Blueprint: bp, OS: "linux"}},
+	}
+
+	h := NewStateBackupHandler(parser.Rule{Action: "state-backup", StateBackupEvery: "daily", StateBackupTo: "~/Backups"}, "")
+	records := []ExecutionRecord{{Status: "success", Command: h.GetCommand()}}
+	if err := h.UpdateStatus(status, records, bp, "linux"); err != nil {
+		t.Fatalf("UpdateStatus() failed: %v", err)
+	}
+
+	// The auto-uninstall of the weekly entry must not drop the new daily one
+	old := NewStateBackupHandler(parser.Rule{Action: "uninstall", StateBackupEvery: "weekly", StateBackupTo: "~/Backups"}, "")
+	if err := old.UpdateStatus(status, nil, bp, "linux"); err != nil {
+		t.Fatalf("UpdateStatus() for uninstall failed: %v", err)
+	}
+
+	if len(status.StateBackups) != 1 || status.StateBackups[0].Every != "daily" {
+		t.Errorf("StateBackups = %+v, want the daily entry only", status.StateBackups)
+	}
+}
+
+func TestStateBackupFindUninstallRules(t *testing.T) {
+	h := NewStateBackupHandler(parser.Rule{}, "")
+
+	bp := "/home/user/setup.bp"
+	status := &Status{
+		StateBackups: []StateBackupStatus{
+			{Every: "weekly", To: "~/Backups", Blueprint: bp, OS: "linux"},
+			{Every: "daily", To: "~/Gone", Blueprint: bp, OS: "linux"},
+			{Every: "daily", To: "~/Other", Blueprint: "/elsewhere.bp", OS: "linux"},
+		},
+	}
+	currentRules := []parser.Rule{
+		{Action: "state-backup", StateBackupEvery: "weekly", StateBackupTo: "~/Backups"},
+	}
+
+	rules := h.FindUninstallRules(status, currentRules, bp, "linux")
+	if len(rules) != 1 {
+		t.Fatalf("expected 1 uninstall rule, got %d: %+v", len(rules), rules)
+	}
+	if rules[0].StateBackupTo != "~/Gone" || DetectRuleType(rules[0]) != "state-backup" {
+		t.Errorf("uninstall rule = %+v, want the ~/Gone state backup", rules[0])
+	}
+}
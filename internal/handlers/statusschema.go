@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// StatusSchemaVersion is the version of the status.json layout this build
+// writes. Bump it together with a new entry in statusMigrations whenever the
+// meaning of a stored field changes.
+const StatusSchemaVersion = 1
+
+// statusMigrations upgrade a status file one schema version at a time:
+// statusMigrations[i] turns version i into version i+1. Files written before
+// schema_version existed are version 0.
+var statusMigrations = []func(*Status){
+	// 0 → 1: blueprint identifiers are stored normalized
+	MigrateStatus,
+}
+
+// StatusSchemaError is returned for a status file written by a newer
+// blueprint, with a schema version this build does not know.
+type StatusSchemaError struct {
+	Version int
+}
+
+func (e *StatusSchemaError) Error() string {
+	return fmt.Sprintf("status file has schema version %d, this blueprint reads up to %d: upgrade blueprint", e.Version, StatusSchemaVersion)
+}
+
+// UnmarshalStatus decodes a status.json into s, upgrading it from the schema
+// version it was written with to StatusSchemaVersion. A file written by a
+// newer blueprint is refused rather than read with fields it does not know.
+func UnmarshalStatus(data []byte, s *Status) error {
+	if err := json.Unmarshal(data, s); err != nil {
+		return err
+	}
+	if s.SchemaVersion > StatusSchemaVersion {
+		return &StatusSchemaError{Version: s.SchemaVersion}
+	}
+	for v := max(s.SchemaVersion, 0); v < StatusSchemaVersion; v++ {
+		statusMigrations[v](s)
+	}
+	s.SchemaVersion = StatusSchemaVersion
+	return nil
+}
+
+// MarshalStatus encodes s as status.json, stamped with StatusSchemaVersion.
+func MarshalStatus(s Status) ([]byte, error) {
+	s.SchemaVersion = StatusSchemaVersion
+	return json.MarshalIndent(s, "", "  ")
+}
+
+// CurrentStatus returns the status recorded so far, or an empty Status when
+// there is none or it cannot be read. Handlers that undo earlier changes look
+// their previous state up through it. The engine replaces it with a reader of
+// its configured state store; the default reads ~/.blueprint/status.json.
+var CurrentStatus = func() Status {
+	var s Status
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return s
+	}
+	data, err := os.ReadFile(filepath.Join(homeDir, ".blueprint", "status.json")) // #nosec G304 -- fixed path under the user's home
+	if err != nil {
+		return s
+	}
+	if err := UnmarshalStatus(data, &s); err != nil {
+		return Status{}
+	}
+	return s
+}
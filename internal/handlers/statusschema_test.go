@@ -0,0 +1,35 @@
+package handlers
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestUnmarshalStatusMigrates(t *testing.T) {
+	// Written before schema_version, with the blueprint stored as an SSH URL
+	old := []byte(`{"packages": [{"name": "curl", "blueprint": "git@github.com:user/setup.git", "os": "linux"}]}`)
+	var s Status
+	if err := UnmarshalStatus(old, &s); err != nil {
+		t.Fatalf("UnmarshalStatus() error = %v", err)
+	}
+	if s.SchemaVersion != StatusSchemaVersion {
+		t.Errorf("SchemaVersion = %d, want %d", s.SchemaVersion, StatusSchemaVersion)
+	}
+	if got := s.Packages[0].Blueprint; got != "https://github.com/user/setup" {
+		t.Errorf("Blueprint = %q, want it normalized by the migration", got)
+	}
+
+	data, err := MarshalStatus(Status{})
+	if err != nil || !strings.Contains(string(data), `"schema_version": 1`) {
+		t.Errorf("MarshalStatus() = %s, %v; want the schema version stamped", data, err)
+	}
+
+	var schemaErr *StatusSchemaError
+	if err := UnmarshalStatus([]byte(`{"schema_version": 99}`), &s); !errors.As(err, &schemaErr) || schemaErr.Version != 99 {
+		t.Errorf("UnmarshalStatus() error = %v, want a StatusSchemaError for version 99", err)
+	}
+	if err := UnmarshalStatus([]byte(`{"packages": [`), &s); err == nil {
+		t.Error("UnmarshalStatus() error = nil for a truncated file")
+	}
+}
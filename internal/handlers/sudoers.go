@@ -6,16 +6,29 @@ import (
 	"os/exec"
 	"path/filepath"
 	"strings"
-	"time"
 
 	"github.com/elpic/blueprint/internal/parser"
 	"github.com/elpic/blueprint/internal/ui"
+	"github.com/elpic/blueprint/internal/ui/timeutil"
 )
 
 func init() {
 	RegisterAction(ActionDef{
 		Name:   "sudoers",
 		Prefix: "sudoers",
+		Meta: ActionMeta{
+			Summary: "Grant a user passwordless sudo.",
+			Usage:   "sudoers [user: <name>]",
+			Attrs: []AttrMeta{
+				{Name: "user", Type: "string", Default: "current user", Description: "User to grant passwordless sudo"},
+			},
+			Examples: []string{
+				"sudoers",
+				"sudoers user: deploy",
+			},
+			OS:  []string{"mac", "linux"},
+			Doc: "sudoers.md",
+		},
 		NewHandler: func(rule parser.Rule, basePath string, passwordCache map[string]string) Handler {
 			return NewSudoersHandler(rule, basePath)
 		},
@@ -98,22 +111,17 @@ func (h *SudoersHandler) NeedsSudo() bool {
 }
 
 // sudoersFileReader reads the contents of a sudoers drop-in file.
-// Uses sudo cat since /etc/sudoers.d/ files are root-owned (mode 0440).
+// Uses cat as root since /etc/sudoers.d/ files are root-owned (mode 0440).
 // Overridable for testing.
 var sudoersFileReader = func(path string) ([]byte, error) {
-	cmd := exec.Command("sudo", "cat", path)
-	cmd.Stdin = nil
-	out, err := cmd.Output()
-	return out, err
+	return sudoCommand("", "cat", path).Output()
 }
 
-// sudoRun runs a command under sudo directly, bypassing executeCommandWithCache
-// to avoid the engine's double-sudo logic. Overridable for testing.
+// sudoRun runs a command as root with the privilege tool directly, bypassing
+// executeCommandWithCache to avoid the engine's double-sudo logic.
+// Overridable for testing.
 var sudoRun = func(args ...string) (string, error) {
-	fullArgs := append([]string{"sudo"}, args...)
-	cmd := exec.Command(fullArgs[0], fullArgs[1:]...) // #nosec G204
-	cmd.Stdin = nil
-	out, err := cmd.CombinedOutput()
+	out, err := sudoCommand("", args...).CombinedOutput()
 	return string(out), err
 }
 
@@ -239,7 +247,7 @@ func (h *SudoersHandler) UpdateStatus(status *Status, records []ExecutionRecord,
 
 		status.Sudoers = append(status.Sudoers, SudoersStatus{
 			User:      resolvedUser,
-			AddedAt:   time.Now().Format(time.RFC3339),
+			AddedAt:   timeutil.Now(),
 			Blueprint: blueprint,
 			OS:        osName,
 		})
@@ -276,23 +284,16 @@ func (h *SudoersHandler) DisplayStatusFromStatus(status *Status) {
 		return
 	}
 
-	fmt.Printf("\n%s\n", ui.FormatHighlight("Sudoers:"))
+	rows := make([]statusRow, 0, len(status.Sudoers))
 	for _, s := range status.Sudoers {
-		t, err := time.Parse(time.RFC3339, s.AddedAt)
-		var timeStr string
-		if err == nil {
-			timeStr = t.Format("2006-01-02 15:04:05")
-		} else {
-			timeStr = s.AddedAt
-		}
-		fmt.Printf("  %s %s (%s) [%s, %s]\n",
-			ui.FormatSuccess("●"),
-			ui.FormatInfo(fmt.Sprintf("/etc/sudoers.d/%s", s.User)),
-			ui.FormatDim(timeStr),
-			ui.FormatDim(s.OS),
-			ui.FormatDim(abbreviateBlueprintPath(s.Blueprint)),
-		)
+		rows = append(rows, statusRow{
+			name:    fmt.Sprintf("/etc/sudoers.d/%s", s.User),
+			details: []string{timeutil.Display(s.AddedAt)},
+			tags:    []string{s.OS, abbreviateBlueprintPath(s.Blueprint)},
+			entry:   &s,
+		})
 	}
+	printStatusSection("Sudoers:", rows)
 }
 
 // GetDependencyKey returns the unique key for this rule in dependency resolution
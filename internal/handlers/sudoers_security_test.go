@@ -1,6 +1,8 @@
 package handlers
 
 import (
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 
@@ -99,3 +101,45 @@ func TestSudoersTempFileUsesSecureDir(t *testing.T) {
 		t.Errorf("SECURITY BUG: temp file created outside secure dir (got %q, want prefix %q)", capturedTmpPath, secureMarker)
 	}
 }
+
+// TestSudoersUsesPrivilegeTool verifies that the sudoers handler reads and
+// writes the drop-in file with doas on a machine without sudo.
+func TestSudoersUsesPrivilegeTool(t *testing.T) {
+	usePrivilegeTools(t, PrivilegeDoas)
+
+	// A doas on PATH that logs the commands it runs
+	bin := t.TempDir()
+	logPath := filepath.Join(bin, "doas.log")
+	script := "#!/bin/sh\necho \"$*\" >> " + logPath + "\n"
+	if err := os.WriteFile(filepath.Join(bin, "doas"), []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin)
+
+	origTempDir := sudoersTempDir
+	defer func() { sudoersTempDir = origTempDir }()
+	tmpDir := t.TempDir()
+	sudoersTempDir = func() (string, error) { return tmpDir, nil }
+
+	h := NewSudoersHandler(parser.Rule{Action: "sudoers", SudoersUser: "testuser"}, "")
+	if _, err := h.Up(); err != nil {
+		t.Fatalf("Up() returned error: %v", err)
+	}
+	if _, err := h.Down(); err != nil {
+		t.Fatalf("Down() returned error: %v", err)
+	}
+
+	logged, err := os.ReadFile(logPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"cat /etc/sudoers.d/testuser",
+		"chmod 0440 /etc/sudoers.d/testuser",
+		"rm -f /etc/sudoers.d/testuser",
+	} {
+		if !strings.Contains(string(logged), want) {
+			t.Errorf("doas did not run %q, ran:\n%s", want, logged)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Marks starting the lines of a per-target report, so UpdateStatus can tell
+// from the output of a failed rule which of its targets were put in place.
+const (
+	targetDoneMark   = "✓ "
+	targetFailedMark = "✗ "
+)
+
+// runTargets runs run for every target, at most jobs at a time, and returns
+// a report with one line per target in the rule's order. Unlike one command
+// chaining them all, a failed target does not stop the others: the error
+// names the targets that failed, and the report keeps the ones that did not.
+func runTargets(targets []string, jobs int, run func(target string) error) (string, error) {
+	errs := make([]error, len(targets))
+	slots := make(chan struct{}, max(jobs, 1))
+	var wg sync.WaitGroup
+	for i, target := range targets {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+			errs[i] = run(target)
+		}()
+	}
+	wg.Wait()
+
+	lines := make([]string, len(targets))
+	var failed []string
+	for i, target := range targets {
+		if errs[i] == nil {
+			lines[i] = targetDoneMark + target
+			continue
+		}
+		// Indent the rest of a multi-line error so it cannot pass for a mark
+		lines[i] = targetFailedMark + target + ": " + strings.ReplaceAll(errs[i].Error(), "\n", "\n  ")
+		failed = append(failed, target)
+	}
+	report := strings.Join(lines, "\n")
+	if len(failed) > 0 {
+		return report, fmt.Errorf("%d of %d targets failed: %s", len(failed), len(targets), strings.Join(failed, ", "))
+	}
+	return report, nil
+}
+
+// succeededTargets returns the targets of the rule that ran cmd which the run
+// put in place: all of them when the command succeeded, otherwise those the
+// per-target report of runTargets marks done.
+func succeededTargets(cmd string, records []ExecutionRecord, targets []string) []string {
+	if _, ok := commandSuccessfullyExecuted(cmd, records); ok {
+		return targets
+	}
+	done := make(map[string]bool)
+	for _, record := range records {
+		if record.Command != cmd {
+			continue
+		}
+		for _, line := range strings.Split(record.Output, "\n") {
+			if target, ok := strings.CutPrefix(line, targetDoneMark); ok {
+				done[target] = true
+			}
+		}
+	}
+	var succeeded []string
+	for _, target := range targets {
+		if done[target] {
+			succeeded = append(succeeded, target)
+		}
+	}
+	return succeeded
+}
@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/elpic/blueprint/internal/parser"
+	"github.com/elpic/blueprint/internal/platform"
+)
+
+func TestRunTargets(t *testing.T) {
+	var running, most atomic.Int32
+	report, err := runTargets([]string{"a", "b", "c", "d"}, 2, func(target string) error {
+		n := running.Add(1)
+		defer running.Add(-1)
+		for {
+			m := most.Load()
+			if n <= m || most.CompareAndSwap(m, n) {
+				break
+			}
+		}
+		if target == "c" {
+			return errors.New("exit status 1\nno such model")
+		}
+		return nil
+	})
+	if most.Load() > 2 {
+		t.Errorf("ran %d targets at once, want at most 2", most.Load())
+	}
+	if err == nil || err.Error() != "1 of 4 targets failed: c" {
+		t.Errorf("runTargets() error = %v", err)
+	}
+	want := "✓ a\n✓ b\n✗ c: exit status 1\n  no such model\n✓ d"
+	if report != want {
+		t.Errorf("runTargets() report = %q, want %q", report, want)
+	}
+
+	records := []ExecutionRecord{{Command: "pull a && pull b", Output: report, Status: "error"}}
+	got := succeededTargets("pull a && pull b", records, []string{"a", "b", "c", "d"})
+	if strings.Join(got, ",") != "a,b,d" {
+		t.Errorf("succeededTargets() after a failure = %q", got)
+	}
+	records[0].Status = "success"
+	if got := succeededTargets("pull a && pull b", records, []string{"a", "b"}); len(got) != 2 {
+		t.Errorf("succeededTargets() after success = %q", got)
+	}
+	if got := succeededTargets("other", records, []string{"a"}); len(got) != 0 {
+		t.Errorf("succeededTargets() for another command = %q", got)
+	}
+}
+
+func TestInstallJobsRecordsInstalledPackages(t *testing.T) {
+	container := platform.NewTestContainer().WithSystemProvider(linuxSystem("ID=fedora\n", "dnf")).Build()
+	origExec := commandExecutor
+	t.Cleanup(func() { commandExecutor = origExec })
+	var mu sync.Mutex
+	var ran []string
+	commandExecutor = &customMockExecutor{executeFunc: func(cmd string) (string, error) {
+		mu.Lock()
+		ran = append(ran, cmd)
+		mu.Unlock()
+		if strings.HasSuffix(cmd, " jq") {
+			return "", errors.New("No match for argument: jq")
+		}
+		return "", nil
+	}}
+
+	rule := parser.Rule{Action: "install", Jobs: 4, Packages: []parser.Package{{Name: "jq"}, {Name: "tree"}}}
+	h := NewInstallHandler(rule, "", container)
+	output, err := h.Up()
+	if err == nil || !strings.Contains(err.Error(), "1 of 2 targets failed: jq") {
+		t.Fatalf("Up() error = %v", err)
+	}
+	if len(ran) != 2 {
+		t.Errorf("ran %q, want one command per package", ran)
+	}
+
+	status := &Status{}
+	records := []ExecutionRecord{{Command: h.GetCommand(), Output: output, Status: "error"}}
+	if err := h.UpdateStatus(status, records, "/tmp/setup.bp", "linux"); err != nil {
+		t.Fatal(err)
+	}
+	if len(status.Packages) != 1 || status.Packages[0].Name != "tree" {
+		t.Errorf("status packages = %+v, want only tree", status.Packages)
+	}
+}
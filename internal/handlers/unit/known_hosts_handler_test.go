@@ -21,21 +21,21 @@ func TestKnownHostsHandler_GetCommand_Pure(t *testing.T) {
 			host:        "github.com",
 			keyType:     "",
 			isUninstall: false,
-			expectedCmd: "ssh-keyscan -t ed25519 github.com",
+			expectedCmd: "ssh-keyscan -T 5 -t ed25519 github.com",
 		},
 		{
 			name:        "add host with specific rsa key type",
 			host:        "gitlab.com",
 			keyType:     "rsa",
 			isUninstall: false,
-			expectedCmd: "ssh-keyscan -t rsa gitlab.com",
+			expectedCmd: "ssh-keyscan -T 5 -t rsa gitlab.com",
 		},
 		{
 			name:        "add host with ecdsa key",
 			host:        "bitbucket.org",
 			keyType:     "ecdsa",
 			isUninstall: false,
-			expectedCmd: "ssh-keyscan -t ecdsa bitbucket.org",
+			expectedCmd: "ssh-keyscan -T 5 -t ecdsa bitbucket.org",
 		},
 		{
 			name:        "remove host from known_hosts",
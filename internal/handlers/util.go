@@ -2,8 +2,8 @@ package handlers
 
 import (
 	"os"
-	"path/filepath"
-	"strings"
+
+	"github.com/elpic/blueprint/internal"
 )
 
 // homeDirProvider is a port interface for getting the home directory.
@@ -23,14 +23,37 @@ func (d *defaultHomeDirProvider) UserHomeDir() (string, error) {
 // homeDir is a variable for testability.
 var homeDir homeDirProvider = &defaultHomeDirProvider{}
 
-// expandPath expands a leading ~ to the current user's home directory.
+// expandPath expands a leading ~ (or %USERPROFILE% on Windows) to the
+// current user's home directory.
 func expandPath(path string) string {
-	if strings.HasPrefix(path, "~") {
+	if internal.HasHomePrefix(path) {
 		home, err := homeDir.UserHomeDir()
 		if err != nil {
 			return path
 		}
-		return filepath.Join(home, path[1:])
+		return internal.ExpandHome(path, home)
 	}
 	return path
 }
+
+// pathExists reports whether path exists. It is a variable for testability.
+var pathExists = func(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// versionOrNone returns version, or a placeholder when none was recorded.
+func versionOrNone(version string) string {
+	if version == "" {
+		return "(none)"
+	}
+	return version
+}
+
+// shortSHA abbreviates a commit SHA for display.
+func shortSHA(sha string) string {
+	if len(sha) > 8 {
+		return sha[:8]
+	}
+	return versionOrNone(sha)
+}
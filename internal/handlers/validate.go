@@ -0,0 +1,138 @@
+package handlers
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	gitpkg "github.com/elpic/blueprint/internal/git"
+)
+
+// Validator is an optional interface for handlers that can check their rule
+// before anything runs: URL syntax, permission strings, version formats,
+// destinations that cannot be created and the like. `blueprint validate` and
+// plan report the error against the rule.
+type Validator interface {
+	// Validate returns what is wrong with the rule's configuration, or nil.
+	Validate() error
+}
+
+// ValidateRule returns the configuration error of handler's rule, or nil when
+// it has none or the handler does not check its rule.
+func ValidateRule(handler Handler) error {
+	if v, ok := handler.(Validator); ok {
+		return v.Validate()
+	}
+	return nil
+}
+
+// validFilePermissions matches the octal modes download: accepts, such as
+// 755 or 0755.
+var validFilePermissions = regexp.MustCompile(`^[0-7]{3,4}$`)
+
+// validateHTTPURL checks that raw is an absolute http or https URL.
+func validateHTTPURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return fmt.Errorf("invalid URL %q: %w", raw, err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid URL %q: want http:// or https://", raw)
+	}
+	return nil
+}
+
+// validateParentDir checks that the directories above path can be created:
+// the nearest of them that exists must be a directory. Relative paths are
+// resolved against the blueprint at run time and are not checked.
+func validateParentDir(path string) error {
+	path = expandPath(path)
+	if !filepath.IsAbs(path) {
+		return nil
+	}
+	for dir := filepath.Dir(path); ; dir = filepath.Dir(dir) {
+		info, err := os.Stat(dir)
+		if err == nil {
+			if !info.IsDir() {
+				return fmt.Errorf("cannot create %s: %s is not a directory", path, dir)
+			}
+			return nil
+		}
+		if dir == filepath.Dir(dir) {
+			return nil
+		}
+	}
+}
+
+// Validate checks the permissions and that the directory can be created.
+func (h *MkdirHandler) Validate() error {
+	if h.Rule.Action == "uninstall" {
+		return nil
+	}
+	if h.Rule.MkdirPerms != "" && !mkdirIsValidOctalPermissions(h.Rule.MkdirPerms) {
+		return fmt.Errorf("invalid permissions %q: must be valid octal (0-777)", h.Rule.MkdirPerms)
+	}
+	return validateParentDir(h.Rule.Mkdir)
+}
+
+// Validate checks the URL, the permissions and that the destination can be
+// created.
+func (h *DownloadHandler) Validate() error {
+	if h.Rule.Action == "uninstall" {
+		return nil
+	}
+	if err := validateHTTPURL(h.Rule.DownloadURL); err != nil {
+		return err
+	}
+	if h.Rule.DownloadPerms != "" && !validFilePermissions.MatchString(h.Rule.DownloadPerms) {
+		return fmt.Errorf("invalid permissions %q: want an octal mode such as 755 or 0755", h.Rule.DownloadPerms)
+	}
+	return validateParentDir(h.Rule.DownloadPath)
+}
+
+// Validate checks the repository URL and that the clone can be created.
+func (h *CloneHandler) Validate() error {
+	if h.Rule.Action == "uninstall" {
+		return nil
+	}
+	repo := h.Rule.CloneURL
+	local := strings.HasPrefix(repo, "file://") || filepath.IsAbs(expandPath(repo)) || strings.HasPrefix(repo, ".")
+	if !gitpkg.IsGitURL(repo) && !local {
+		return fmt.Errorf("invalid repository %q: want an https://, git:// or git@ URL or a local path", repo)
+	}
+	return validateParentDir(h.Rule.ClonePath)
+}
+
+// Validate checks the script URL.
+func (h *RunShHandler) Validate() error {
+	if h.Rule.Action == "uninstall" {
+		return nil
+	}
+	return validateHTTPURL(h.Rule.RunShURL)
+}
+
+// Validate checks that the decrypted file can be written.
+func (h *DecryptHandler) Validate() error {
+	if h.Rule.Action == "uninstall" {
+		return nil
+	}
+	return validateParentDir(h.Rule.DecryptPath)
+}
+
+// Validate checks that every package is plugin@version with names asdf
+// accepts.
+func (h *AsdfHandler) Validate() error {
+	for _, pkg := range h.Rule.AsdfPackages {
+		plugin, version, ok := strings.Cut(pkg, "@")
+		if !ok {
+			return fmt.Errorf("invalid asdf package %q: want plugin@version", pkg)
+		}
+		if !isValidAsdfIdentifier(plugin) || !isValidAsdfIdentifier(version) {
+			return fmt.Errorf("invalid asdf package %q: plugin and version may only hold letters, digits and . _ - +", pkg)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/elpic/blueprint/internal/parser"
+)
+
+func TestValidateRule(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "file")
+	if err := os.WriteFile(file, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		rule parser.Rule
+		want string // substring of the error, "" for none
+	}{
+		{"mkdir ok", parser.Rule{Action: "mkdir", Mkdir: filepath.Join(dir, "a", "b"), MkdirPerms: "755"}, ""},
+		{"mkdir bad perms", parser.Rule{Action: "mkdir", Mkdir: filepath.Join(dir, "a"), MkdirPerms: "rwx"}, `invalid permissions "rwx"`},
+		{"mkdir under a file", parser.Rule{Action: "mkdir", Mkdir: filepath.Join(file, "a", "b")}, file + " is not a directory"},
+		{"mkdir relative", parser.Rule{Action: "mkdir", Mkdir: "build/out"}, ""},
+		{"download ok", parser.Rule{Action: "download", DownloadURL: "https://example.com/tool", DownloadPath: filepath.Join(dir, "tool"), DownloadPerms: "0755"}, ""},
+		{"download bad url", parser.Rule{Action: "download", DownloadURL: "example.com/tool", DownloadPath: filepath.Join(dir, "tool")}, `invalid URL "example.com/tool"`},
+		{"download bad perms", parser.Rule{Action: "download", DownloadURL: "https://example.com/tool", DownloadPath: filepath.Join(dir, "tool"), DownloadPerms: "999"}, `invalid permissions "999"`},
+		{"download under a file", parser.Rule{Action: "download", DownloadURL: "https://example.com/tool", DownloadPath: filepath.Join(file, "tool")}, "is not a directory"},
+		{"clone ok", parser.Rule{Action: "clone", CloneURL: "git@github.com:elpic/blueprint.git", ClonePath: filepath.Join(dir, "bp")}, ""},
+		{"clone local", parser.Rule{Action: "clone", CloneURL: "./repo", ClonePath: filepath.Join(dir, "bp")}, ""},
+		{"clone bad url", parser.Rule{Action: "clone", CloneURL: "github.com/elpic/blueprint", ClonePath: filepath.Join(dir, "bp")}, `invalid repository "github.com/elpic/blueprint"`},
+		{"run-sh bad url", parser.Rule{Action: "run-sh", RunShURL: "ftp://example.com/install.sh"}, "want http:// or https://"},
+		{"asdf ok", parser.Rule{Action: "asdf", AsdfPackages: []string{"nodejs@20.11.0", "python@3.12.1"}}, ""},
+		{"asdf no version", parser.Rule{Action: "asdf", AsdfPackages: []string{"nodejs"}}, `invalid asdf package "nodejs": want plugin@version`},
+		{"asdf bad name", parser.Rule{Action: "asdf", AsdfPackages: []string{"node;rm@20"}}, `invalid asdf package "node;rm@20"`},
+		{"uninstall not checked", parser.Rule{Action: "uninstall", Mkdir: filepath.Join(file, "a"), MkdirPerms: "rwx"}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := NewHandler(tt.rule, "", nil)
+			if handler == nil {
+				t.Fatalf("no handler for %+v", tt.rule)
+			}
+			err := ValidateRule(handler)
+			switch {
+			case tt.want == "" && err != nil:
+				t.Errorf("ValidateRule() = %v, want nil", err)
+			case tt.want != "" && (err == nil || !strings.Contains(err.Error(), tt.want)):
+				t.Errorf("ValidateRule() = %v, want it to contain %q", err, tt.want)
+			}
+		})
+	}
+}
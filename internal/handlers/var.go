@@ -8,6 +8,14 @@ func init() {
 	RegisterAction(ActionDef{
 		Name:   "var",
 		Prefix: "var ",
+		Meta: ActionMeta{
+			Summary: "Declare a variable usable as ${NAME}; without a default it must be passed with --var.",
+			Usage:   "var <NAME> [default]",
+			Examples: []string{
+				"var EMAIL",
+				"var EDITOR nvim",
+			},
+		},
 		NewHandler: func(rule parser.Rule, basePath string, passwordCache map[string]string) Handler {
 			return &varHandler{BaseHandler: BaseHandler{Rule: rule, BasePath: basePath}}
 		},
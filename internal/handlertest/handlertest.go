@@ -0,0 +1,265 @@
+// Package handlertest lets the handlers of blueprint be unit tested without
+// running anything on the machine, reading or writing the real ~/.blueprint,
+// or depending on the OS the test runs on.
+//
+//	func TestRemoveModels(t *testing.T) {
+//		h := handlertest.New(t)
+//		handlertest.UseOS(t, "linux")
+//		h.Runner.On("ollama rm llama3", "deleted", nil)
+//
+//		rule := handlertest.ParseRule(t, "ollama llama3")
+//		if _, err := h.Handler(rule).Down(); err != nil {
+//			t.Fatal(err)
+//		}
+//		h.Runner.AssertRan(t, "ollama rm llama3")
+//	}
+//
+// New gives each test a temporary HOME and a FakeRunner that answers the
+// commands handlers run through the engine's command executor; NewStatus
+// builds the status a handler reads back or updates; AssertGolden compares
+// any output with a golden file as blueprinttest does for whole blueprints.
+package handlertest
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/elpic/blueprint/internal/handlers"
+	"github.com/elpic/blueprint/internal/parser"
+	"github.com/elpic/blueprint/pkg/blueprinttest"
+)
+
+// Harness is the test environment New sets up.
+type Harness struct {
+	// Home is the temporary home directory HOME points to. It holds an
+	// empty .blueprint directory.
+	Home string
+	// BasePath is the directory handlers resolve relative paths against,
+	// as the directory of the blueprint would be. It starts as a temporary
+	// directory of its own.
+	BasePath string
+	// Runner answers every command handlers run through the command executor.
+	Runner *FakeRunner
+
+	t testing.TB
+}
+
+// New sets up a harness for t: a temporary HOME, a FakeRunner installed as
+// the command executor with an empty run cache, and the status read back by
+// handlers starting empty. Everything is put back when t ends, so tests using
+// it must not run in parallel.
+func New(t testing.TB) *Harness {
+	t.Helper()
+	h := &Harness{
+		Home:     TempHome(t),
+		BasePath: t.TempDir(),
+		Runner:   NewRunner(),
+		t:        t,
+	}
+	UseRunner(t, h.Runner)
+	UseStatus(t, handlers.Status{})
+	return h
+}
+
+// Handler returns the handler of rule, as the engine would create it, or
+// fails t when no action handles rule.
+func (h *Harness) Handler(rule parser.Rule) handlers.Handler {
+	h.t.Helper()
+	handler := handlers.NewHandler(rule, h.BasePath, map[string]string{})
+	if handler == nil {
+		h.t.Fatalf("no handler for action %q", rule.Action)
+	}
+	return handler
+}
+
+// TempHome points HOME at a new temporary directory holding an empty
+// .blueprint directory and returns it. HOME is restored when t ends.
+func TempHome(t testing.TB) string {
+	t.Helper()
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	if err := os.MkdirAll(filepath.Join(home, ".blueprint"), 0o750); err != nil {
+		t.Fatalf("creating %s: %v", filepath.Join(home, ".blueprint"), err)
+	}
+	return home
+}
+
+// UseRunner installs r as the command executor of the handlers and empties
+// the run cache, so no result of an earlier test is reused. The previous
+// executor is restored when t ends.
+func UseRunner(t testing.TB, r *FakeRunner) {
+	t.Helper()
+	orig := handlers.GetCommandExecutor()
+	handlers.SetCommandExecutor(r)
+	handlers.ResetRunCache()
+	t.Cleanup(func() {
+		handlers.SetCommandExecutor(orig)
+		handlers.ResetRunCache()
+	})
+}
+
+// UseOS makes handlers see osName ("mac", "linux", ...) as the current OS
+// until t ends.
+func UseOS(t testing.TB, osName string) {
+	t.Helper()
+	t.Cleanup(handlers.SetOSName(osName))
+}
+
+// UseStatus makes status the one handlers read back as recorded by earlier
+// runs, such as the command a run rule must undo, until t ends.
+func UseStatus(t testing.TB, status handlers.Status) {
+	t.Helper()
+	orig := handlers.CurrentStatus
+	handlers.CurrentStatus = func() handlers.Status { return status }
+	t.Cleanup(func() { handlers.CurrentStatus = orig })
+}
+
+// ParseRule parses a single blueprint line into its rule, failing t when the
+// line does not parse to exactly one rule.
+func ParseRule(t testing.TB, line string) parser.Rule {
+	t.Helper()
+	rules, err := parser.Parse(line + "\n")
+	if err != nil {
+		t.Fatalf("parsing %q: %v", line, err)
+	}
+	if len(rules) != 1 {
+		t.Fatalf("parsing %q: got %d rules, want 1", line, len(rules))
+	}
+	return rules[0]
+}
+
+// Record returns the execution record of cmd as the engine passes it to
+// UpdateStatus: successful when err is nil, failed with err otherwise.
+func Record(cmd, output string, err error) handlers.ExecutionRecord {
+	record := handlers.ExecutionRecord{Command: cmd, Output: output, Status: "success"}
+	if err != nil {
+		record.Status = "error"
+		record.Error = err.Error()
+	}
+	return record
+}
+
+// AssertGolden fails t when got differs from the golden file, reporting the
+// first line that differs. With BLUEPRINT_UPDATE_GOLDEN=1 it writes got to
+// golden instead.
+func AssertGolden(t testing.TB, got, golden string) {
+	t.Helper()
+	blueprinttest.AssertGoldenText(t, got, golden)
+}
+
+// response is a scripted answer of a FakeRunner.
+type response struct {
+	command string
+	prefix  bool
+	output  string
+	err     error
+}
+
+// FakeRunner is a command executor that runs nothing. It answers each
+// command with the first response scripted for it, in the order they were
+// added, and with the default response when none matches, and it records
+// every command it was asked to run. It is safe for concurrent use, as
+// handlers with jobs: run commands in parallel.
+type FakeRunner struct {
+	mu        sync.Mutex
+	responses []response
+	defOutput string
+	defErr    error
+	commands  []string
+}
+
+// NewRunner returns a FakeRunner that answers every command with no output
+// and no error until responses are scripted.
+func NewRunner() *FakeRunner {
+	return &FakeRunner{}
+}
+
+// On scripts the answer to the command cmd.
+func (r *FakeRunner) On(cmd, output string, err error) *FakeRunner {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.responses = append(r.responses, response{command: cmd, output: output, err: err})
+	return r
+}
+
+// OnPrefix scripts the answer to every command starting with prefix.
+func (r *FakeRunner) OnPrefix(prefix, output string, err error) *FakeRunner {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.responses = append(r.responses, response{command: prefix, prefix: true, output: output, err: err})
+	return r
+}
+
+// Default sets the answer to the commands no response matches.
+func (r *FakeRunner) Default(output string, err error) *FakeRunner {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.defOutput, r.defErr = output, err
+	return r
+}
+
+// Execute records cmd and returns its scripted answer.
+func (r *FakeRunner) Execute(cmd string) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.commands = append(r.commands, cmd)
+	for _, resp := range r.responses {
+		if cmd == resp.command || (resp.prefix && strings.HasPrefix(cmd, resp.command)) {
+			return resp.output, resp.err
+		}
+	}
+	return r.defOutput, r.defErr
+}
+
+// Commands returns the commands run so far, in the order they ran.
+func (r *FakeRunner) Commands() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.commands...)
+}
+
+// Ran reports whether cmd was run.
+func (r *FakeRunner) Ran(cmd string) bool {
+	for _, c := range r.Commands() {
+		if c == cmd {
+			return true
+		}
+	}
+	return false
+}
+
+// AssertRan fails t unless cmds were all run, in this order, possibly with
+// other commands between them.
+func (r *FakeRunner) AssertRan(t testing.TB, cmds ...string) {
+	t.Helper()
+	ran := r.Commands()
+	i := 0
+	for _, c := range ran {
+		if i < len(cmds) && c == cmds[i] {
+			i++
+		}
+	}
+	if i < len(cmds) {
+		t.Errorf("command %q was not run in order; ran:\n  %s", cmds[i], strings.Join(ran, "\n  "))
+	}
+}
+
+// AssertNotRan fails t if a command starting with prefix was run.
+func (r *FakeRunner) AssertNotRan(t testing.TB, prefix string) {
+	t.Helper()
+	for _, c := range r.Commands() {
+		if strings.HasPrefix(c, prefix) {
+			t.Errorf("command %q was run, want none starting with %q", c, prefix)
+		}
+	}
+}
+
+// Reset forgets the commands run so far, keeping the scripted responses.
+func (r *FakeRunner) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.commands = nil
+}
@@ -0,0 +1,88 @@
+package handlertest
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/elpic/blueprint/internal/handlers"
+)
+
+func TestHarnessRunsHandlerAgainstFakeRunner(t *testing.T) {
+	h := New(t)
+	UseOS(t, "linux")
+	h.Runner.On("ollama rm llama3", "deleted 'llama3'", nil)
+
+	if _, err := os.Stat(filepath.Join(h.Home, ".blueprint")); err != nil {
+		t.Errorf("New() did not create ~/.blueprint: %v", err)
+	}
+	if home, _ := os.UserHomeDir(); home != h.Home {
+		t.Errorf("HOME = %q, want %q", home, h.Home)
+	}
+
+	out, err := h.Handler(ParseRule(t, "ollama llama3")).Down()
+	if err != nil || out != "deleted 'llama3'" {
+		t.Errorf("Down() = %q, %v; want the scripted answer", out, err)
+	}
+	h.Runner.AssertRan(t, "ollama rm llama3")
+	h.Runner.AssertNotRan(t, "ollama pull")
+	AssertGolden(t, strings.Join(h.Runner.Commands(), "\n")+"\n", "testdata/down.golden")
+}
+
+func TestFakeRunnerMatching(t *testing.T) {
+	r := NewRunner().
+		On("brew list git", "git 2.45", nil).
+		OnPrefix("brew ", "", errors.New("brew failed")).
+		Default("ok", nil)
+
+	if out, err := r.Execute("brew list git"); out != "git 2.45" || err != nil {
+		t.Errorf("exact match = %q, %v", out, err)
+	}
+	if _, err := r.Execute("brew install vim"); err == nil || err.Error() != "brew failed" {
+		t.Errorf("prefix match error = %v, want brew failed", err)
+	}
+	if out, err := r.Execute("apt-get update"); out != "ok" || err != nil {
+		t.Errorf("default = %q, %v", out, err)
+	}
+
+	want := []string{"brew list git", "brew install vim", "apt-get update"}
+	if got := r.Commands(); strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("Commands() = %v, want %v", got, want)
+	}
+	if !r.Ran("apt-get update") || r.Ran("apt-get upgrade") {
+		t.Errorf("Ran() does not match the commands run")
+	}
+	r.Reset()
+	if len(r.Commands()) != 0 {
+		t.Errorf("Commands() after Reset() = %v, want none", r.Commands())
+	}
+}
+
+func TestStatusBuilderAndUpdateStatus(t *testing.T) {
+	h := New(t)
+	status := NewStatus("/tmp/setup.bp", "linux").
+		Package("git").
+		Mkdir("/tmp/projects").
+		With(func(s *handlers.Status) {
+			s.Ollamas = append(s.Ollamas, handlers.OllamaStatus{Model: "mistral", OS: "linux"})
+		}).
+		Use(t)
+
+	if got := handlers.CurrentStatus(); len(got.Packages) != 1 || len(got.Mkdirs) != 1 {
+		t.Errorf("CurrentStatus() = %+v, want the built status", got)
+	}
+	if status.Ollamas[0].Blueprint != "/tmp/setup.bp" {
+		t.Errorf("With() left the blueprint of its entry empty")
+	}
+
+	rule := ParseRule(t, "ollama llama3")
+	records := []handlers.ExecutionRecord{Record("ollama pull llama3", "", nil)}
+	if err := h.Handler(rule).UpdateStatus(&status, records, "/tmp/setup.bp", "linux"); err != nil {
+		t.Fatal(err)
+	}
+	if len(status.Ollamas) != 2 || status.Ollamas[1].Model != "llama3" {
+		t.Errorf("UpdateStatus() = %+v, want llama3 recorded", status.Ollamas)
+	}
+}
@@ -0,0 +1,104 @@
+package handlertest
+
+import (
+	"testing"
+
+	"github.com/elpic/blueprint/internal/handlers"
+)
+
+// StatusBuilder builds a handlers.Status for a test, entry by entry, with
+// the blueprint and OS of the builder and a fixed timestamp filled in:
+//
+//	status := handlertest.NewStatus("/tmp/setup.bp", "linux").
+//		Package("git").
+//		Run("make install", "make uninstall").
+//		Build()
+type StatusBuilder struct {
+	blueprint string
+	osName    string
+	status    handlers.Status
+}
+
+// StatusTimestamp is the time the entries of a StatusBuilder were recorded.
+const StatusTimestamp = "2025-01-01T00:00:00Z"
+
+// NewStatus returns a builder of a status whose entries were recorded by
+// blueprint on osName.
+func NewStatus(blueprint, osName string) *StatusBuilder {
+	return &StatusBuilder{blueprint: blueprint, osName: osName}
+}
+
+// Package records an installed package.
+func (b *StatusBuilder) Package(name string) *StatusBuilder {
+	b.status.Packages = append(b.status.Packages, handlers.PackageStatus{
+		Name:        name,
+		InstalledAt: StatusTimestamp,
+		Blueprint:   b.blueprint,
+		OS:          b.osName,
+	})
+	return b
+}
+
+// Clone records url cloned at sha into path.
+func (b *StatusBuilder) Clone(url, path, sha string) *StatusBuilder {
+	b.status.Clones = append(b.status.Clones, handlers.CloneStatus{
+		URL:       url,
+		Path:      path,
+		SHA:       sha,
+		ClonedAt:  StatusTimestamp,
+		Blueprint: b.blueprint,
+		OS:        b.osName,
+	})
+	return b
+}
+
+// Mkdir records a created directory.
+func (b *StatusBuilder) Mkdir(path string) *StatusBuilder {
+	b.status.Mkdirs = append(b.status.Mkdirs, handlers.MkdirStatus{
+		Path:      path,
+		CreatedAt: StatusTimestamp,
+		Blueprint: b.blueprint,
+		OS:        b.osName,
+	})
+	return b
+}
+
+// Run records a run rule's command and the command undoing it, which may
+// be empty.
+func (b *StatusBuilder) Run(command, undo string) *StatusBuilder {
+	b.status.Runs = append(b.status.Runs, handlers.RunStatus{
+		Action:    "run",
+		Command:   command,
+		UndoCmd:   undo,
+		RanAt:     StatusTimestamp,
+		Blueprint: b.blueprint,
+		OS:        b.osName,
+	})
+	return b
+}
+
+// With lets fn add entries of any other kind; the builder fills in their
+// blueprint when fn leaves it empty.
+func (b *StatusBuilder) With(fn func(*handlers.Status)) *StatusBuilder {
+	fn(&b.status)
+	for _, entry := range b.status.AllEntries() {
+		if entry.GetBlueprint() == "" {
+			entry.SetBlueprint(b.blueprint)
+		}
+	}
+	return b
+}
+
+// Build returns the status built so far.
+func (b *StatusBuilder) Build() handlers.Status {
+	return b.status
+}
+
+// Use makes the status built so far the one handlers read back until t
+// ends, as UseStatus does, and returns it.
+func (b *StatusBuilder) Use(t testing.TB) handlers.Status {
+	t.Helper()
+	status := b.Build()
+	UseStatus(t, status)
+	return status
+}
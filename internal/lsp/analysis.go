@@ -0,0 +1,527 @@
+package lsp
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/elpic/blueprint/internal/engine"
+	handlerskg "github.com/elpic/blueprint/internal/handlers"
+	"github.com/elpic/blueprint/internal/parser"
+	"github.com/elpic/blueprint/pkg/ast"
+)
+
+// document is an open editor buffer with its syntax tree.
+type document struct {
+	uri   string
+	lines []string
+	file  *ast.File
+}
+
+func newDocument(uri, text string) *document {
+	return &document{
+		uri:   uri,
+		lines: strings.Split(text, "\n"),
+		file:  ast.ParseContent(uriToPath(uri), text),
+	}
+}
+
+// nodeAt returns the node covering the 1-based line, or nil.
+func (d *document) nodeAt(line int) ast.Node {
+	for _, n := range d.file.Nodes {
+		if span := n.Range(); span.Start.Line <= line && line <= span.End.Line {
+			return n
+		}
+	}
+	return nil
+}
+
+// line returns the text of the 1-based line, or "" when out of range.
+func (d *document) line(n int) string {
+	if n < 1 || n > len(d.lines) {
+		return ""
+	}
+	return d.lines[n-1]
+}
+
+// position converts an ast position to an LSP position in this document.
+func (d *document) position(p ast.Pos) Position {
+	line := d.line(p.Line)
+	col := min(max(p.Column-1, 0), len(line))
+	return Position{Line: p.Line - 1, Character: utf16Len(line[:col])}
+}
+
+// rangeOf returns the range of length bytes starting at p.
+func (d *document) rangeOf(p ast.Pos, length int) Range {
+	end := p
+	end.Column += length
+	return Range{Start: d.position(p), End: d.position(end)}
+}
+
+// valueItem is one comma-separated item of an attribute value and where it is.
+type valueItem struct {
+	value string
+	rng   Range
+}
+
+// valueItems locates the items of a list attribute (after:, on:) on the
+// line where its value starts.
+func (d *document) valueItems(attr *ast.Attr) []valueItem {
+	items := attr.List
+	if !attr.Bracket {
+		for _, part := range strings.Split(strings.Trim(attr.Value, "[]"), ",") {
+			if v := strings.TrimSpace(part); v != "" {
+				items = append(items, v)
+			}
+		}
+	}
+	if attr.ValuePos.Line == 0 {
+		return nil
+	}
+	line := d.line(attr.ValuePos.Line)
+	cursor := min(attr.ValuePos.Column-1, len(line))
+	var out []valueItem
+	for _, item := range items {
+		pos := ast.Pos{Line: attr.ValuePos.Line, Column: attr.ValuePos.Column}
+		if idx := strings.Index(line[cursor:], item); idx >= 0 {
+			pos.Column = cursor + idx + 1
+			cursor += idx + len(item)
+		}
+		out = append(out, valueItem{value: item, rng: d.rangeOf(pos, len(item))})
+	}
+	return out
+}
+
+// definition is a rule that after: entries can refer to.
+type definition struct {
+	path string
+	rule *ast.Rule
+}
+
+// parseRule runs the blueprint parser on a single rule.
+func parseRule(r *ast.Rule) (parser.Rule, error) {
+	rules, err := parser.Parse(r.String())
+	if err != nil {
+		return parser.Rule{}, err
+	}
+	if len(rules) == 0 {
+		return parser.Rule{}, fmt.Errorf("empty rule")
+	}
+	return rules[0], nil
+}
+
+// definitions indexes every rule of the file and its local includes by the
+// keys after: can use: the rule id (namespaced like "include ... as ns" does)
+// and its primary resource key — the same keys `blueprint validate` accepts.
+func definitions(f *ast.File) map[string][]definition {
+	defs := map[string][]definition{}
+	var walk func(f *ast.File, prefix string)
+	walk = func(f *ast.File, prefix string) {
+		for _, n := range f.Nodes {
+			switch n := n.(type) {
+			case *ast.Rule:
+				rule, err := parseRule(n)
+				if err != nil {
+					continue
+				}
+				if rule.ID != "" {
+					rule.ID = prefix + rule.ID
+				}
+				def := definition{path: f.Path, rule: n}
+				keys := map[string]bool{rule.ID: true, handlerskg.RuleKey(rule): true}
+				for key := range keys {
+					if key != "" {
+						defs[key] = append(defs[key], def)
+					}
+				}
+			case *ast.Include:
+				if n.File == nil {
+					continue
+				}
+				childPrefix := prefix
+				if n.Namespace != "" {
+					childPrefix = prefix + n.Namespace + "."
+				}
+				walk(n.File, childPrefix)
+			}
+		}
+	}
+	walk(f, "")
+	return defs
+}
+
+// diagnostics reports unknown directives, parse errors, missing local
+// includes, unbalanced group blocks, malformed defaults lines, unresolved
+// after: references and unknown on: and arch: values.
+func diagnostics(d *document) []Diagnostic {
+	diags := []Diagnostic{}
+	report := func(rng Range, severity int, format string, args ...any) {
+		diags = append(diags, Diagnostic{Range: rng, Severity: severity, Source: "blueprint", Message: fmt.Sprintf(format, args...)})
+	}
+	defs := definitions(d.file)
+
+	// checkAttrs reports the after:, on: and arch: values of a rule or group
+	// that match nothing.
+	checkAttrs := func(attr func(key string) *ast.Attr) {
+		if after := attr("after"); after != nil {
+			for _, item := range d.valueItems(after) {
+				if len(defs[item.value]) == 0 {
+					report(item.rng, SeverityError, "after: %q does not match any rule id or resource", item.value)
+				}
+			}
+		}
+		if on := attr("on"); on != nil {
+			for _, item := range d.valueItems(on) {
+				if !engine.IsValidOSName(item.value) {
+					report(item.rng, SeverityError, "unknown os filter %q (valid: mac, linux, windows)", item.value)
+				}
+			}
+		}
+		if arch := attr("arch"); arch != nil {
+			for _, item := range d.valueItems(arch) {
+				if !engine.IsValidArchName(item.value) {
+					report(item.rng, SeverityError, "unknown arch filter %q (valid: arm64, amd64)", item.value)
+				}
+			}
+		}
+	}
+
+	var open []*ast.Group
+	for _, n := range d.file.Nodes {
+		switch n := n.(type) {
+		case *ast.Group:
+			switch {
+			case n.Name == "":
+				report(d.firstLineRange(n.Span), SeverityError, "group requires a name")
+			case !n.Open:
+				report(d.firstLineRange(n.Span), SeverityError, "group must end with {")
+			}
+			if n.Open {
+				open = append(open, n)
+			}
+			checkAttrs(n.Attr)
+		case *ast.Defaults:
+			code, _ := parser.SplitComment(d.line(n.Span.Start.Line))
+			if err := parser.CheckDefaults(strings.TrimSpace(code)); err != nil {
+				report(d.firstLineRange(n.Span), SeverityError, "%s", err)
+				continue
+			}
+			checkAttrs(n.Attr)
+		case *ast.GroupEnd:
+			if len(open) == 0 {
+				report(d.firstLineRange(n.Span), SeverityError, "} without a group to close")
+				continue
+			}
+			open = open[:len(open)-1]
+		case *ast.Include:
+			if n.IsGit() || n.File != nil {
+				continue
+			}
+			if _, err := os.Stat(n.Resolved); err != nil {
+				report(d.firstLineRange(n.Span), SeverityError, "include file not found: %s", n.Path)
+			} else if n.Err != nil {
+				report(d.firstLineRange(n.Span), SeverityError, "cannot include %s: %v", n.Path, n.Err)
+			}
+		case *ast.Pin:
+			if _, _, err := parser.ParsePin(n.String()); err != nil {
+				report(d.firstLineRange(n.Span), SeverityError, "%s", err)
+			}
+		case *ast.Rule:
+			if !n.Known() {
+				report(d.rangeOf(n.Start, len(n.Directive)), SeverityError, "unknown directive %q", n.Directive)
+				continue
+			}
+			if _, err := parseRule(n); err != nil {
+				report(d.firstLineRange(n.Span), SeverityError, "%s", strings.TrimPrefix(err.Error(), "line 1: "))
+				continue
+			}
+			checkAttrs(n.Attr)
+		}
+	}
+	for _, g := range open {
+		report(d.firstLineRange(g.Span), SeverityError, "group %q is not closed with }", g.Name)
+	}
+	return diags
+}
+
+// firstLineRange covers a node's first line from its start to the line end.
+func (d *document) firstLineRange(span ast.Span) Range {
+	end := ast.Pos{Line: span.Start.Line, Column: len(d.line(span.Start.Line)) + 1}
+	return Range{Start: d.position(span.Start), End: d.position(end)}
+}
+
+// completion suggests directives at the start of a line, rule ids inside an
+// after: value, and the rule's attribute keywords elsewhere.
+func completion(d *document, pos Position) []CompletionItem {
+	text := d.line(pos.Line + 1)
+	before := strings.TrimLeft(text[:byteOffset(text, pos.Character)], " \t")
+
+	rule, _ := d.nodeAt(pos.Line + 1).(*ast.Rule)
+	firstWord := !strings.ContainsAny(before, " \t")
+	if rule == nil || (firstWord && rule.Start.Line == pos.Line+1) {
+		if !firstWord {
+			return []CompletionItem{}
+		}
+		return directiveItems()
+	}
+
+	if lastKeyword(before) == "after:" {
+		return referenceItems(d, rule)
+	}
+	return attributeItems(rule)
+}
+
+func directiveItems() []CompletionItem {
+	names := directiveNames()
+	items := make([]CompletionItem, 0, len(names))
+	for _, name := range names {
+		meta, _ := directiveMeta(name)
+		items = append(items, CompletionItem{
+			Label:      name,
+			Kind:       CompletionKindKeyword,
+			Detail:     meta.Summary,
+			InsertText: name + " ",
+		})
+	}
+	return items
+}
+
+func attributeItems(rule *ast.Rule) []CompletionItem {
+	items := []CompletionItem{}
+	meta, ok := directiveMeta(rule.Directive)
+	if !ok || rule.Directive == "var" {
+		return items
+	}
+	for _, attr := range append(append([]handlerskg.AttrMeta{}, meta.Attrs...), handlerskg.CommonAttrs...) {
+		if rule.Attr(attr.Name) != nil {
+			continue
+		}
+		items = append(items, CompletionItem{
+			Label:      attr.Keyword(),
+			Kind:       CompletionKindProperty,
+			Detail:     attr.Description,
+			InsertText: attr.Keyword() + " ",
+		})
+	}
+	return items
+}
+
+func referenceItems(d *document, current *ast.Rule) []CompletionItem {
+	defs := definitions(d.file)
+	keys := make([]string, 0, len(defs))
+	for key, ds := range defs {
+		if len(ds) == 1 && ds[0].rule == current {
+			continue
+		}
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	items := make([]CompletionItem, 0, len(keys))
+	for _, key := range keys {
+		items = append(items, CompletionItem{
+			Label:  key,
+			Kind:   CompletionKindReference,
+			Detail: defs[key][0].rule.String(),
+		})
+	}
+	return items
+}
+
+// lastKeyword returns the last keyword token in text, or "".
+func lastKeyword(text string) string {
+	words := strings.Fields(text)
+	for i := len(words) - 1; i >= 0; i-- {
+		if strings.HasSuffix(words[i], ":") && !strings.Contains(words[i], "://") {
+			return words[i]
+		}
+	}
+	return ""
+}
+
+// definitionAt resolves the after: entry or include path under the cursor.
+func definitionAt(d *document, pos Position) []Location {
+	switch n := d.nodeAt(pos.Line + 1).(type) {
+	case *ast.Include:
+		if n.Resolved == "" {
+			return nil
+		}
+		if _, err := os.Stat(n.Resolved); err != nil {
+			return nil
+		}
+		return []Location{{URI: pathToURI(n.Resolved)}}
+	case *ast.Rule:
+		item := afterItemAt(d, n, pos)
+		if item == nil {
+			return nil
+		}
+		var locs []Location
+		for _, def := range definitions(d.file)[item.value] {
+			locs = append(locs, definitionLocation(d, def))
+		}
+		return locs
+	}
+	return nil
+}
+
+// afterItemAt returns the after: entry of rule under the cursor, or nil.
+func afterItemAt(d *document, rule *ast.Rule, pos Position) *valueItem {
+	after := rule.Attr("after")
+	if after == nil {
+		return nil
+	}
+	for _, item := range d.valueItems(after) {
+		if contains(item.rng, pos) {
+			return &item
+		}
+	}
+	return nil
+}
+
+// definitionLocation points at the first line of the defining rule.
+func definitionLocation(d *document, def definition) Location {
+	uri := d.uri
+	if def.path != d.file.Path {
+		uri = pathToURI(def.path)
+	}
+	start := Position{Line: def.rule.Start.Line - 1, Character: def.rule.Start.Column - 1}
+	end := Position{Line: start.Line, Character: start.Character + len(def.rule.Directive)}
+	return Location{URI: uri, Range: Range{Start: start, End: end}}
+}
+
+// hoverAt documents the directive, attribute keyword or after: entry under
+// the cursor.
+func hoverAt(d *document, pos Position) *Hover {
+	switch n := d.nodeAt(pos.Line + 1).(type) {
+	case *ast.Include:
+		rng := d.rangeOf(n.Start, len("include"))
+		if contains(rng, pos) {
+			return &Hover{Contents: markdown(directiveMarkdown("include")), Range: &rng}
+		}
+	case *ast.Pin:
+		rng := d.rangeOf(n.Start, len("pin"))
+		if contains(rng, pos) {
+			return &Hover{Contents: markdown(directiveMarkdown("pin")), Range: &rng}
+		}
+	case *ast.Rule:
+		rng := d.rangeOf(n.Start, len(n.Directive))
+		if contains(rng, pos) {
+			if _, ok := directiveMeta(n.Directive); ok {
+				return &Hover{Contents: markdown(directiveMarkdown(n.Directive)), Range: &rng}
+			}
+			return nil
+		}
+		for _, attr := range n.Attrs {
+			rng := d.rangeOf(attr.Pos, len(attr.Key)+1)
+			if contains(rng, pos) {
+				if meta, ok := attrMeta(n.Directive, attr.Key); ok {
+					return &Hover{Contents: markdown(fmt.Sprintf("`%s` (%s) %s", meta.Keyword(), meta.Type, meta.Description)), Range: &rng}
+				}
+				return nil
+			}
+		}
+		if item := afterItemAt(d, n, pos); item != nil {
+			defs := definitions(d.file)[item.value]
+			if len(defs) == 0 {
+				return nil
+			}
+			def := defs[0]
+			where := filepath.Base(def.path)
+			return &Hover{
+				Contents: markdown(fmt.Sprintf("```\n%s\n```\n%s:%d", def.rule.String(), where, def.rule.Start.Line)),
+				Range:    &item.rng,
+			}
+		}
+	}
+	return nil
+}
+
+func directiveMarkdown(name string) string {
+	meta, _ := directiveMeta(name)
+	var b strings.Builder
+	fmt.Fprintf(&b, "**%s** — %s\n\n```\n%s\n```\n", name, meta.Summary, meta.Usage)
+	if len(meta.Attrs) > 0 {
+		keywords := make([]string, len(meta.Attrs))
+		for i, attr := range meta.Attrs {
+			keywords[i] = attr.Keyword()
+		}
+		fmt.Fprintf(&b, "\nAttributes: `%s`\n", strings.Join(keywords, "`, `"))
+	}
+	if name != "include" && name != "pin" && name != "var" {
+		keywords := make([]string, len(handlerskg.CommonAttrs))
+		for i, attr := range handlerskg.CommonAttrs {
+			keywords[i] = attr.Keyword()
+		}
+		fmt.Fprintf(&b, "\nCommon: `%s`\n", strings.Join(keywords, "`, `"))
+	}
+	if len(meta.OS) > 0 {
+		fmt.Fprintf(&b, "\nSupported on: %s\n", strings.Join(meta.OS, ", "))
+	}
+	if url := meta.DocURL(); url != "" {
+		fmt.Fprintf(&b, "\n[Documentation](%s)\n", url)
+	}
+	return b.String()
+}
+
+func markdown(s string) MarkupContent {
+	return MarkupContent{Kind: "markdown", Value: s}
+}
+
+// contains reports whether pos lies within rng (end inclusive, so a cursor
+// just after a word still counts as on it).
+func contains(rng Range, pos Position) bool {
+	if pos.Line < rng.Start.Line || pos.Line > rng.End.Line {
+		return false
+	}
+	if pos.Line == rng.Start.Line && pos.Character < rng.Start.Character {
+		return false
+	}
+	if pos.Line == rng.End.Line && pos.Character > rng.End.Character {
+		return false
+	}
+	return true
+}
+
+// utf16Len returns the length of s in UTF-16 code units, the unit LSP
+// positions are measured in.
+func utf16Len(s string) int {
+	n := 0
+	for _, r := range s {
+		if r >= 0x10000 {
+			n += 2
+		} else {
+			n++
+		}
+	}
+	return n
+}
+
+// byteOffset converts a UTF-16 character offset in line to a byte offset.
+func byteOffset(line string, character int) int {
+	n := 0
+	for i, r := range line {
+		if n >= character {
+			return i
+		}
+		if r >= 0x10000 {
+			n += 2
+		} else {
+			n++
+		}
+	}
+	return len(line)
+}
+
+func uriToPath(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme != "file" {
+		return uri
+	}
+	return filepath.FromSlash(u.Path)
+}
+
+func pathToURI(path string) string {
+	return (&url.URL{Scheme: "file", Path: filepath.ToSlash(path)}).String()
+}
@@ -0,0 +1,215 @@
+package lsp
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/elpic/blueprint/internal/parser"
+)
+
+func writeFile(t *testing.T, dir, name, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestEveryDirectiveDocumented(t *testing.T) {
+	for _, name := range parser.Directives() {
+		if meta, ok := directiveMeta(name); !ok || meta.Summary == "" {
+			t.Errorf("directive %q has no documentation", name)
+		}
+	}
+}
+
+func TestDiagnostics(t *testing.T) {
+	dir := t.TempDir()
+	path := writeFile(t, dir, "main.bp", "")
+	writeFile(t, dir, "notes.txt", "install git\n")
+	text := strings.Join([]string{
+		"instal git",
+		"install git id: git",
+		"run make after: git, nope on: [mac, bsd]",
+		"include missing.bp",
+		"clone https://github.com/user/repo.git",
+		"include notes.txt",
+	}, "\n")
+	diags := diagnostics(newDocument(pathToURI(path), text))
+
+	want := []struct {
+		line, char int
+		message    string
+	}{
+		{0, 0, `unknown directive "instal"`},
+		{2, 21, `after: "nope" does not match any rule id or resource`},
+		{2, 36, `unknown os filter "bsd"`},
+		{3, 0, "include file not found: missing.bp"},
+		{4, 0, "clone"},
+		{5, 0, "cannot include notes.txt: not a blueprint file: expected a .bp or .yaml extension, got .txt"},
+	}
+	if len(diags) != len(want) {
+		t.Fatalf("got %d diagnostics, want %d: %+v", len(diags), len(want), diags)
+	}
+	for i, w := range want {
+		d := diags[i]
+		if d.Range.Start.Line != w.line || d.Range.Start.Character != w.char || !strings.Contains(d.Message, w.message) {
+			t.Errorf("diagnostic %d = %+v, want line %d char %d containing %q", i, d, w.line, w.char, w.message)
+		}
+	}
+}
+
+func TestDiagnosticsGroups(t *testing.T) {
+	text := strings.Join([]string{
+		"group work on: [bsd] after: nope {",
+		"  install slack",
+		"}",
+		"}",
+		"group tools on: [mac]",
+		"group open {",
+	}, "\n")
+	diags := diagnostics(newDocument("file:///tmp/main.bp", text))
+
+	want := []struct {
+		line    int
+		message string
+	}{
+		{0, `after: "nope" does not match any rule id or resource`},
+		{0, `unknown os filter "bsd"`},
+		{3, "} without a group to close"},
+		{4, "group must end with {"},
+		{5, `group "open" is not closed with }`},
+	}
+	if len(diags) != len(want) {
+		t.Fatalf("got %d diagnostics, want %d: %+v", len(diags), len(want), diags)
+	}
+	for i, w := range want {
+		d := diags[i]
+		if d.Range.Start.Line != w.line || !strings.Contains(d.Message, w.message) {
+			t.Errorf("diagnostic %d = %+v, want line %d containing %q", i, d, w.line, w.message)
+		}
+	}
+}
+
+func TestDiagnosticsDefaults(t *testing.T) {
+	text := strings.Join([]string{
+		"defaults { on: [bsd]; after: nope }",
+		"defaults { retry: 2 }",
+		"defaults on: [mac]",
+		"install git",
+	}, "\n")
+	diags := diagnostics(newDocument("file:///tmp/main.bp", text))
+
+	want := []struct {
+		line    int
+		message string
+	}{
+		{0, `after: "nope" does not match any rule id or resource`},
+		{0, `unknown os filter "bsd"`},
+		{1, "defaults does not support retry:"},
+		{2, "defaults must be written as"},
+	}
+	if len(diags) != len(want) {
+		t.Fatalf("got %d diagnostics, want %d: %+v", len(diags), len(want), diags)
+	}
+	for i, w := range want {
+		d := diags[i]
+		if d.Range.Start.Line != w.line || !strings.Contains(d.Message, w.message) {
+			t.Errorf("diagnostic %d = %+v, want line %d containing %q", i, d, w.line, w.message)
+		}
+	}
+}
+
+func TestCompletion(t *testing.T) {
+	text := "install git id: git\nclone https://x/y.git to: ~/y after: \nin"
+	doc := newDocument("file:///tmp/main.bp", text)
+
+	labels := func(items []CompletionItem) map[string]bool {
+		out := map[string]bool{}
+		for _, item := range items {
+			out[item.Label] = true
+		}
+		return out
+	}
+
+	if got := labels(completion(doc, Position{Line: 2, Character: 2})); !got["install"] || !got["clone"] {
+		t.Errorf("directive completion = %v", got)
+	}
+	refs := labels(completion(doc, Position{Line: 1, Character: 38}))
+	if !refs["git"] || refs["~/y"] {
+		t.Errorf("after: completion = %v, want other rules only", refs)
+	}
+	attrs := labels(completion(doc, Position{Line: 0, Character: 12}))
+	if !attrs["package-manager:"] || !attrs["after:"] || attrs["id:"] {
+		t.Errorf("attribute completion = %v", attrs)
+	}
+}
+
+func TestDefinitionAcrossNamespacedInclude(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "tools.bp", "# tools\ninstall git id: git\n")
+	main := writeFile(t, dir, "main.bp", "")
+	text := "include tools.bp as tools\nrun make after: tools.git"
+	doc := newDocument(pathToURI(main), text)
+
+	if diags := diagnostics(doc); len(diags) != 0 {
+		t.Fatalf("unexpected diagnostics: %+v", diags)
+	}
+	locs := definitionAt(doc, Position{Line: 1, Character: 18})
+	if len(locs) != 1 {
+		t.Fatalf("expected one location, got %+v", locs)
+	}
+	if locs[0].URI != pathToURI(filepath.Join(dir, "tools.bp")) || locs[0].Range.Start.Line != 1 {
+		t.Errorf("definition = %+v", locs[0])
+	}
+
+	inc := definitionAt(doc, Position{Line: 0, Character: 10})
+	if len(inc) != 1 || inc[0].URI != pathToURI(filepath.Join(dir, "tools.bp")) {
+		t.Errorf("include definition = %+v", inc)
+	}
+}
+
+func TestHover(t *testing.T) {
+	doc := newDocument("file:///tmp/main.bp", "install git id: git\nrun make after: git")
+
+	h := hoverAt(doc, Position{Line: 0, Character: 3})
+	if h == nil || !strings.Contains(h.Contents.Value, "**install**") || !strings.Contains(h.Contents.Value, "blob/main/docs/install.md") {
+		t.Errorf("directive hover = %+v", h)
+	}
+	if h := hoverAt(doc, Position{Line: 0, Character: 13}); h == nil || !strings.Contains(h.Contents.Value, "`id:`") {
+		t.Errorf("attribute hover = %+v", h)
+	}
+	if h := hoverAt(doc, Position{Line: 1, Character: 17}); h == nil || !strings.Contains(h.Contents.Value, "install git id: git") {
+		t.Errorf("after: hover = %+v", h)
+	}
+}
+
+func TestUTF16Positions(t *testing.T) {
+	line := "run echo 🎉 after: x"
+	if got := utf16Len("🎉"); got != 2 {
+		t.Errorf("utf16Len = %d, want 2", got)
+	}
+	if got := byteOffset(line, 12); line[got:] != "after: x" {
+		t.Errorf("byteOffset = %d (%q)", got, line[got:])
+	}
+}
+
+func TestDiagnosticsPins(t *testing.T) {
+	path := writeFile(t, t.TempDir(), "main.bp", "")
+	text := strings.Join([]string{
+		"pin @github:acme/setup sha256: " + strings.Repeat("ab", 32),
+		"pin @github:acme/setup sha256: abc",
+		"pin ./local.bp sha256: " + strings.Repeat("ab", 32),
+	}, "\n")
+	diags := diagnostics(newDocument(pathToURI(path), text))
+	if len(diags) != 2 || diags[0].Range.Start.Line != 1 || !strings.Contains(diags[0].Message, "invalid sha256") ||
+		diags[1].Range.Start.Line != 2 || !strings.Contains(diags[1].Message, "not a git URL") {
+		t.Errorf("diagnostics = %+v", diags)
+	}
+	if hover := hoverAt(newDocument(pathToURI(path), text), Position{Line: 0, Character: 1}); hover == nil || !strings.Contains(hover.Contents.Value, "sha256:") {
+		t.Errorf("hover on pin = %+v", hover)
+	}
+}
@@ -0,0 +1,63 @@
+package lsp
+
+import (
+	"sort"
+
+	handlerskg "github.com/elpic/blueprint/internal/handlers"
+)
+
+// includeMeta documents include, which the parser handles itself rather than
+// through a registered action.
+var includeMeta = handlerskg.ActionMeta{
+	Summary: "Include another blueprint file or git repository.",
+	Usage:   "include <file-or-git-url> [as <namespace>] [prefer_ssh: true]",
+}
+
+// pinMeta documents pin, which the parser handles itself like include.
+var pinMeta = handlerskg.ActionMeta{
+	Summary: "Pin the sha256 of a remote blueprint included from this file.",
+	Usage:   "pin <git-url> sha256: <hex>",
+	Attrs: []handlerskg.AttrMeta{
+		{Name: "sha256", Type: "string", Required: true, Description: "sha256 of the included blueprint file, as printed by `shasum -a 256`."},
+	},
+}
+
+// directiveMeta returns the documentation of a directive from the handler
+// registry, so completion and hover stay in sync with `blueprint help-rules`.
+func directiveMeta(name string) (handlerskg.ActionMeta, bool) {
+	switch name {
+	case "include":
+		return includeMeta, true
+	case "pin":
+		return pinMeta, true
+	}
+	def := handlerskg.GetAction(name)
+	if def == nil || def.IsAlias || def.Name == "uninstall" {
+		return handlerskg.ActionMeta{}, false
+	}
+	return def.Meta, true
+}
+
+// directiveNames returns every documented directive, sorted.
+func directiveNames() []string {
+	names := []string{"include", "pin"}
+	for _, def := range handlerskg.DocumentedActions() {
+		names = append(names, def.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// attrMeta looks up an attribute of a directive, falling back to the common
+// attributes every rule accepts.
+func attrMeta(directive, name string) (handlerskg.AttrMeta, bool) {
+	meta, _ := directiveMeta(directive)
+	for _, attrs := range [][]handlerskg.AttrMeta{meta.Attrs, handlerskg.CommonAttrs} {
+		for _, attr := range attrs {
+			if attr.Name == name {
+				return attr, true
+			}
+		}
+	}
+	return handlerskg.AttrMeta{}, false
+}
@@ -0,0 +1,129 @@
+// Package lsp implements `blueprint lsp`, a Language Server Protocol server
+// for .bp files over stdio: diagnostics, completion of directives, attribute
+// keywords and after: ids, go-to-definition for after: ids across includes,
+// and hover documentation.
+package lsp
+
+import (
+	"encoding/json"
+	"io"
+	"strings"
+)
+
+// server holds the open documents. Messages are handled one at a time, so
+// no locking is needed.
+type server struct {
+	conn    *conn
+	version string
+	docs    map[string]*document
+}
+
+// Serve runs the language server on in/out until the client sends exit or
+// closes the stream. version is reported to the client in serverInfo.
+func Serve(in io.Reader, out io.Writer, version string) error {
+	s := &server{conn: newConn(in, out), version: version, docs: map[string]*document{}}
+	for {
+		msg, err := s.conn.read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if msg.Method == "exit" {
+			return nil
+		}
+		if err := s.handle(msg); err != nil {
+			return err
+		}
+	}
+}
+
+func (s *server) handle(msg *message) error {
+	switch msg.Method {
+	case "initialize":
+		return s.reply(msg, map[string]any{
+			"capabilities": map[string]any{
+				"textDocumentSync":   1, // full document on every change
+				"completionProvider": map[string]any{"triggerCharacters": []string{" ", ","}},
+				"definitionProvider": true,
+				"hoverProvider":      true,
+			},
+			"serverInfo": map[string]string{"name": "blueprint", "version": s.version},
+		})
+	case "shutdown":
+		return s.reply(msg, nil)
+
+	case "textDocument/didOpen":
+		var p didOpenParams
+		if json.Unmarshal(msg.Params, &p) == nil {
+			return s.update(p.TextDocument.URI, p.TextDocument.Text)
+		}
+	case "textDocument/didChange":
+		var p didChangeParams
+		if json.Unmarshal(msg.Params, &p) == nil && len(p.ContentChanges) > 0 {
+			return s.update(p.TextDocument.URI, p.ContentChanges[len(p.ContentChanges)-1].Text)
+		}
+	case "textDocument/didSave":
+		// Included files may have changed on disk; re-check every open document
+		for uri, doc := range s.docs {
+			if err := s.update(uri, strings.Join(doc.lines, "\n")); err != nil {
+				return err
+			}
+		}
+	case "textDocument/didClose":
+		var p didCloseParams
+		if json.Unmarshal(msg.Params, &p) == nil {
+			delete(s.docs, p.TextDocument.URI)
+			return s.publish(p.TextDocument.URI, []Diagnostic{})
+		}
+
+	case "textDocument/completion", "textDocument/definition", "textDocument/hover":
+		var p textDocumentPositionParams
+		if err := json.Unmarshal(msg.Params, &p); err != nil {
+			return s.replyError(msg, codeInvalidParams, err.Error())
+		}
+		doc, ok := s.docs[p.TextDocument.URI]
+		if !ok {
+			return s.reply(msg, nil)
+		}
+		switch msg.Method {
+		case "textDocument/completion":
+			return s.reply(msg, completion(doc, p.Position))
+		case "textDocument/definition":
+			return s.reply(msg, definitionAt(doc, p.Position))
+		default:
+			return s.reply(msg, hoverAt(doc, p.Position))
+		}
+
+	default:
+		// Unknown notifications are ignored; unknown requests must be answered
+		if msg.ID != nil {
+			return s.replyError(msg, codeMethodNotFound, "method not supported: "+msg.Method)
+		}
+	}
+	return nil
+}
+
+// update replaces a document's text and publishes its diagnostics.
+func (s *server) update(uri, text string) error {
+	doc := newDocument(uri, text)
+	s.docs[uri] = doc
+	return s.publish(uri, diagnostics(doc))
+}
+
+func (s *server) publish(uri string, diags []Diagnostic) error {
+	return s.conn.write(notification{
+		JSONRPC: "2.0",
+		Method:  "textDocument/publishDiagnostics",
+		Params:  publishDiagnosticsParams{URI: uri, Diagnostics: diags},
+	})
+}
+
+func (s *server) reply(msg *message, result any) error {
+	return s.conn.write(response{JSONRPC: "2.0", ID: msg.ID, Result: result})
+}
+
+func (s *server) replyError(msg *message, code int, text string) error {
+	return s.conn.write(errorResponse{JSONRPC: "2.0", ID: msg.ID, Error: responseError{Code: code, Message: text}})
+}
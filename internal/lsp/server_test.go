@@ -0,0 +1,90 @@
+package lsp
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func frame(t *testing.T, msgs ...string) string {
+	t.Helper()
+	var b strings.Builder
+	for _, m := range msgs {
+		fmt.Fprintf(&b, "Content-Length: %d\r\n\r\n%s", len(m), m)
+	}
+	return b.String()
+}
+
+// readAll decodes every framed message written by the server.
+func readAll(t *testing.T, out *bytes.Buffer) []map[string]any {
+	t.Helper()
+	c := newConn(out, nil)
+	var msgs []map[string]any
+	for {
+		header, err := c.r.ReadString('\n')
+		if err != nil {
+			return msgs
+		}
+		var length int
+		if _, err := fmt.Sscanf(header, "Content-Length: %d", &length); err != nil {
+			t.Fatalf("bad header %q", header)
+		}
+		if _, err := c.r.ReadString('\n'); err != nil {
+			t.Fatal(err)
+		}
+		body := make([]byte, length)
+		if _, err := c.r.Read(body); err != nil {
+			t.Fatal(err)
+		}
+		var m map[string]any
+		if err := json.Unmarshal(body, &m); err != nil {
+			t.Fatal(err)
+		}
+		msgs = append(msgs, m)
+	}
+}
+
+func TestServeSession(t *testing.T) {
+	in := frame(t,
+		`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{}}`,
+		`{"jsonrpc":"2.0","method":"textDocument/didOpen","params":{"textDocument":{"uri":"file:///tmp/a.bp","text":"instal git"}}}`,
+		`{"jsonrpc":"2.0","id":2,"method":"textDocument/hover","params":{"textDocument":{"uri":"file:///tmp/a.bp"},"position":{"line":0,"character":1}}}`,
+		`{"jsonrpc":"2.0","id":3,"method":"workspace/symbol","params":{}}`,
+		`{"jsonrpc":"2.0","id":4,"method":"shutdown"}`,
+		`{"jsonrpc":"2.0","method":"exit"}`,
+	)
+	var out bytes.Buffer
+	if err := Serve(strings.NewReader(in), &out, "1.2.3"); err != nil {
+		t.Fatal(err)
+	}
+
+	msgs := readAll(t, &out)
+	if len(msgs) != 5 {
+		t.Fatalf("expected 5 messages, got %d: %v", len(msgs), msgs)
+	}
+	init := msgs[0]["result"].(map[string]any)
+	if init["serverInfo"].(map[string]any)["version"] != "1.2.3" {
+		t.Errorf("initialize result = %v", init)
+	}
+	diags := msgs[1]["params"].(map[string]any)["diagnostics"].([]any)
+	if msgs[1]["method"] != "textDocument/publishDiagnostics" || len(diags) != 1 {
+		t.Errorf("diagnostics notification = %v", msgs[1])
+	}
+	if result, ok := msgs[2]["result"]; !ok || result != nil {
+		t.Errorf("hover on unknown directive should be a null result, got %v", msgs[2])
+	}
+	if msgs[3]["error"].(map[string]any)["code"].(float64) != codeMethodNotFound {
+		t.Errorf("unknown request = %v", msgs[3])
+	}
+	if result, ok := msgs[4]["result"]; !ok || result != nil {
+		t.Errorf("shutdown = %v", msgs[4])
+	}
+}
+
+func TestServeEOF(t *testing.T) {
+	if err := Serve(strings.NewReader(""), &bytes.Buffer{}, "dev"); err != nil {
+		t.Errorf("closed input should end cleanly, got %v", err)
+	}
+}
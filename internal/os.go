@@ -1,10 +1,51 @@
 package internal
 
-import "runtime"
+import (
+	"os/exec"
+	"runtime"
+	"strings"
+)
 
 // runtimeOS is a variable for testability, allowing tests to override the OS detection.
 var runtimeOS = runtime.GOOS
 
+// runtimeArch is a variable for testability, like runtimeOS.
+var runtimeArch = runtime.GOARCH
+
+// rosettaTranslated reports whether this process is an amd64 build running
+// under Rosetta 2 on Apple Silicon; a variable for testability.
+var rosettaTranslated = func() bool {
+	out, err := exec.Command("sysctl", "-n", "sysctl.proc_translated").Output()
+	return err == nil && strings.TrimSpace(string(out)) == "1"
+}
+
+// archAliases maps other common names of architectures to their GOARCH name.
+var archAliases = map[string]string{
+	"aarch64": "arm64",
+	"x86_64":  "amd64",
+	"x64":     "amd64",
+}
+
+// NormalizeArch returns the GOARCH name for an architecture as written in an
+// arch: filter, so uname-style names such as x86_64 and aarch64 match too.
+func NormalizeArch(name string) string {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if goarch, ok := archAliases[name]; ok {
+		return goarch
+	}
+	return name
+}
+
+// ArchName returns the machine architecture arch: filters are matched
+// against. It is GOARCH, except that an amd64 build running under Rosetta 2
+// reports arm64: the filters describe the Mac, not the blueprint binary.
+func ArchName() string {
+	if runtimeOS == "darwin" && runtimeArch == "amd64" && rosettaTranslated() {
+		return "arm64"
+	}
+	return runtimeArch
+}
+
 // OSDetector is a port interface for OS detection.
 // Adapters can implement this to provide OS information.
 type OSDetector interface {
@@ -152,3 +152,34 @@ func TestMockOSDetector(t *testing.T) {
 		})
 	}
 }
+
+func TestNormalizeArch(t *testing.T) {
+	tests := map[string]string{"arm64": "arm64", "aarch64": "arm64", "X86_64": "amd64", "x64": "amd64", " amd64 ": "amd64", "riscv64": "riscv64"}
+	for in, want := range tests {
+		if got := NormalizeArch(in); got != want {
+			t.Errorf("NormalizeArch(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestArchNameUnderRosetta(t *testing.T) {
+	origOS, origArch, origTranslated := runtimeOS, runtimeArch, rosettaTranslated
+	defer func() { runtimeOS, runtimeArch, rosettaTranslated = origOS, origArch, origTranslated }()
+
+	runtimeOS, runtimeArch = "darwin", "amd64"
+	rosettaTranslated = func() bool { return true }
+	if got := ArchName(); got != "arm64" {
+		t.Errorf("ArchName() under Rosetta = %q, want arm64", got)
+	}
+
+	rosettaTranslated = func() bool { return false }
+	if got := ArchName(); got != "amd64" {
+		t.Errorf("ArchName() on an Intel Mac = %q, want amd64", got)
+	}
+
+	runtimeOS = "linux"
+	rosettaTranslated = func() bool { t.Error("Rosetta is only checked on macOS"); return true }
+	if got := ArchName(); got != "amd64" {
+		t.Errorf("ArchName() on linux = %q, want amd64", got)
+	}
+}
@@ -0,0 +1,116 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+)
+
+// defaultsAttrs are the attributes a defaults block can set.
+var defaultsAttrs = map[string]bool{
+	"on:":        true,
+	"arch:":      true,
+	"group:":     true,
+	"after:":     true,
+	"sensitive:": true,
+}
+
+// ruleDefaults holds the attributes of a "defaults { ... }" line. They apply
+// to every rule after it, including included ones, until the next defaults
+// line replaces them.
+type ruleDefaults struct {
+	osList    []string
+	archList  []string
+	group     string
+	after     []string
+	sensitive bool
+}
+
+// defaultsSpan records that defaults apply from the rule at index start on.
+// The spans are applied once the whole file is read, so a group block's
+// attributes win over them.
+type defaultsSpan struct {
+	start    int
+	defaults *ruleDefaults
+}
+
+// IsDefaultsLine reports whether line is a defaults block.
+func IsDefaultsLine(line string) bool {
+	return line == "defaults" || strings.HasPrefix(line, "defaults ") || strings.HasPrefix(line, "defaults{")
+}
+
+// DefaultsBody returns the attributes between the braces of a defaults line,
+// with the semicolons separating them turned into spaces so byte offsets
+// into the body still match the line. ok is false when the braces are missing.
+func DefaultsBody(line string) (body string, ok bool) {
+	inner := strings.TrimSpace(strings.TrimPrefix(line, "defaults"))
+	if !strings.HasPrefix(inner, "{") || !strings.HasSuffix(inner, "}") || len(inner) < 2 {
+		return "", false
+	}
+	return strings.ReplaceAll(inner[1:len(inner)-1], ";", " "), true
+}
+
+// CheckDefaults reports what is wrong with a defaults line, or nil.
+func CheckDefaults(line string) error {
+	_, err := parseDefaults(line)
+	return err
+}
+
+// parseDefaults parses a "defaults { on: [...]; group: ...; after: ... }" line.
+func parseDefaults(line string) (*ruleDefaults, error) {
+	body, ok := DefaultsBody(line)
+	if !ok {
+		return nil, lineError(line, "defaults must be written as defaults { <attr>: <value>; ... }")
+	}
+	for _, field := range ScanFields(body) {
+		if field.Key == "" {
+			return nil, lineError(line, fmt.Sprintf("defaults only takes attributes, got %q", field.Value))
+		}
+		if !defaultsAttrs[field.Key] {
+			return nil, lineError(line, fmt.Sprintf("defaults does not support %s (use on:, arch:, group:, after: or sensitive:)", field.Key))
+		}
+	}
+	f := parseFields(body)
+	return &ruleDefaults{
+		osList:    f.osFilter,
+		archList:  f.list("arch:"),
+		group:     f.word("group:"),
+		after:     f.list("after:"),
+		sensitive: f.word("sensitive:") == "true",
+	}, nil
+}
+
+// applyDefaults gives each span's defaults to the rules it covers. Rules
+// whose line set sensitive: themselves are listed in sensitiveSet.
+func applyDefaults(rules []Rule, spans []defaultsSpan, sensitiveSet map[int]bool) {
+	for i, span := range spans {
+		end := len(rules)
+		if i+1 < len(spans) {
+			end = spans[i+1].start
+		}
+		for j := span.start; j < end; j++ {
+			span.defaults.apply(&rules[j], sensitiveSet[j])
+		}
+	}
+}
+
+// apply fills in the attributes r leaves unset from d; after: is combined
+// like a group's, skipping r itself.
+func (d *ruleDefaults) apply(r *Rule, sensitiveSet bool) {
+	if r.Group == "" {
+		r.Group = d.group
+	}
+	if len(r.OSList) == 0 {
+		r.OSList = append([]string(nil), d.osList...)
+	}
+	if len(r.ArchList) == 0 {
+		r.ArchList = append([]string(nil), d.archList...)
+	}
+	if !sensitiveSet && d.sensitive {
+		r.Sensitive = true
+	}
+	for _, dep := range d.after {
+		if dep != r.ID && !containsString(r.After, dep) {
+			r.After = append(r.After, dep)
+		}
+	}
+}
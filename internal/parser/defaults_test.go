@@ -0,0 +1,90 @@
+package parser
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseDefaults(t *testing.T) {
+	rules, err := Parse(`
+install curl id: base
+defaults { on: [mac, linux]; group: base; after: base; sensitive: true }
+install git
+run echo hi on: [mac] group: tools sensitive: false
+group work on: [linux] {
+  install slack
+}
+defaults { arch: [arm64] }
+install jq
+`)
+	if err != nil {
+		t.Fatalf("Parse() error: %v", err)
+	}
+	if len(rules) != 5 {
+		t.Fatalf("got %d rules, want 5", len(rules))
+	}
+
+	tests := []struct {
+		name      string
+		rule      Rule
+		group     string
+		os        []string
+		arch      []string
+		after     []string
+		sensitive bool
+	}{
+		{"before the defaults", rules[0], "", nil, nil, nil, false},
+		{"takes every default", rules[1], "base", []string{"mac", "linux"}, nil, []string{"base"}, true},
+		{"own attributes win", rules[2], "tools", []string{"mac"}, nil, []string{"base"}, false},
+		{"group block wins", rules[3], "work", []string{"linux"}, nil, []string{"base"}, true},
+		{"later defaults replace earlier ones", rules[4], "", nil, []string{"arm64"}, nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.rule.Group != tt.group {
+				t.Errorf("Group = %q, want %q", tt.rule.Group, tt.group)
+			}
+			if len(tt.rule.OSList)+len(tt.os) > 0 && !reflect.DeepEqual(tt.rule.OSList, tt.os) {
+				t.Errorf("OSList = %v, want %v", tt.rule.OSList, tt.os)
+			}
+			if len(tt.rule.ArchList)+len(tt.arch) > 0 && !reflect.DeepEqual(tt.rule.ArchList, tt.arch) {
+				t.Errorf("ArchList = %v, want %v", tt.rule.ArchList, tt.arch)
+			}
+			if len(tt.rule.After)+len(tt.after) > 0 && !reflect.DeepEqual(tt.rule.After, tt.after) {
+				t.Errorf("After = %v, want %v", tt.rule.After, tt.after)
+			}
+			if tt.rule.Sensitive != tt.sensitive {
+				t.Errorf("Sensitive = %v, want %v", tt.rule.Sensitive, tt.sensitive)
+			}
+		})
+	}
+}
+
+func TestParseDefaultsSkipsSelfDependency(t *testing.T) {
+	rules, err := Parse("defaults { after: base }\nmkdir ~/base id: base\ninstall git")
+	if err != nil {
+		t.Fatalf("Parse() error: %v", err)
+	}
+	if len(rules[0].After) != 0 || !reflect.DeepEqual(rules[1].After, []string{"base"}) {
+		t.Errorf("After = %v and %v, want only the second rule to run after base", rules[0].After, rules[1].After)
+	}
+}
+
+func TestParseDefaultsErrors(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"defaults on: [mac]", "defaults must be written as"},
+		{"defaults { on: [mac]", "defaults must be written as"},
+		{"defaults { retry: 2 }", "defaults does not support retry:"},
+		{"defaults { base }", `defaults only takes attributes, got "base"`},
+	}
+	for _, tt := range tests {
+		_, err := Parse(tt.input + "\ninstall git")
+		if err == nil || !strings.Contains(err.Error(), tt.want) || !strings.HasPrefix(err.Error(), "line 1:") {
+			t.Errorf("Parse(%q) error = %v, want line 1 and %q", tt.input, err, tt.want)
+		}
+	}
+}
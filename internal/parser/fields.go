@@ -2,6 +2,7 @@ package parser
 
 import (
 	"fmt"
+	"slices"
 	"strings"
 )
 
@@ -9,6 +10,7 @@ import (
 // from a single rule line after the directive prefix is stripped.
 type lineFields struct {
 	kv       map[string]string // keyword → raw value string
+	quoted   map[string]bool   // keywords whose value was written in double quotes
 	tokens   []string          // non-keyword positional tokens
 	osFilter []string          // parsed from on: [...]
 }
@@ -16,176 +18,204 @@ type lineFields struct {
 // multiwordKeys are keywords whose values may span multiple words (until the next keyword).
 // All other keywords take exactly one word.
 var multiwordKeys = map[string]bool{
-	"unless:": true,
-	"undo:":   true,
-	"after:":  true, // comma-separated list which may contain spaces: "after: a, b, c"
-	"var:":    true, // comma-separated KEY=VALUE pairs: "var: KEY1=VAL1, KEY2=VAL2"
+	"unless:":      true,
+	"undo:":        true,
+	"after:":       true, // comma-separated list which may contain spaces: "after: a, b, c"
+	"var:":         true, // comma-separated KEY=VALUE pairs: "var: KEY1=VAL1, KEY2=VAL2"
+	"components:":  true, // comma-separated apt components: "components: main, contrib"
+	"fingerprint:": true, // key fingerprint, often written in groups of four: "fingerprint: 9DC8 5822 ..."
+	"pubkey:":      true, // SSH host key as in known_hosts: "pubkey: ssh-ed25519 AAAA..."
+	"exec:":        true, // command line of an autostart rule: "exec: syncthing serve --no-browser"
 }
 
 // bracketKeys are keywords whose value is a bracket-delimited list: "key: [a, b, c]".
 var bracketKeys = map[string]bool{
-	"on:":   true,
-	"skip:": true,
+	"on:":      true,
+	"skip:":    true,
+	"aliases:": true,
+	"arch:":    true,
+	"map:":     true,
 }
 
-// parseFields tokenizes a rule body into keyword fields and positional tokens.
+// Field is one element of a rule body in source order: a keyword attribute
+// (Key set, e.g. "after:") or a positional token (Key empty, text in Value).
+type Field struct {
+	Key         string   // keyword including its trailing colon; "" for positional tokens
+	Value       string   // token text, or the keyword's raw value (empty for bracket keywords)
+	List        []string // trimmed items of a bracket value (on:, skip:, aliases:, map:)
+	Bracket     bool     // the value was a bracket list
+	Quoted      bool     // the value was written in double quotes
+	Ignored     bool     // keyword without a usable value (missing "[", unterminated "]" or quote); the parser skips it
+	Offset      int      // byte offset of the token or keyword within the scanned body
+	ValueOffset int      // byte offset of the keyword's value, or -1 when it has none
+}
+
+// isKeyword reports whether tok is a keyword key: it ends with ":" and is not
+// a URL scheme token (does not contain "://").
+func isKeyword(tok string) bool {
+	return strings.HasSuffix(tok, ":") && !strings.Contains(tok, "://")
+}
+
+// ScanFields splits a rule body (the line without its directive) into fields
+// in source order. It is the single tokenizer for rule lines: parseFields
+// builds on it, and external tooling uses it to keep positions.
 //
 // Single-pass algorithm: scan whitespace-separated tokens left-to-right.
-// A token is a keyword key when ALL of these hold:
-//   - It ends with ":"
-//   - It is not a URL scheme token (does not contain "://")
-//
-// Special value handling per keyword type:
-//   - bracketKeys (on:, skip:): consume the rest of the line up to and
+// A token is a keyword key when isKeyword holds. Value handling per keyword type:
+//   - bracketKeys (on:, skip:, aliases:, arch:, map:): consume the rest of the line up to and
 //     including the closing "]", then continue scanning after it.
-//   - cron:: if the next character is a double-quote, consume the quoted
-//     string; otherwise consume tokens until the next keyword.
-//   - multiwordKeys (unless:, undo:, after:): consume tokens until the
+//   - a value starting with a double-quote (other than for multiwordKeys) is
+//     the quoted string, without the quotes: cron: "0 9 * * *", to: "~/My Dir".
+//   - cron:: otherwise consume tokens until the next keyword.
+//   - multiwordKeys (unless:, undo:, after:, var:, components:, fingerprint:, pubkey:, exec:): consume tokens until the
 //     next keyword or end-of-input.
 //   - all others: consume exactly one token.
 //
-// Tokens that are not keyword keys or keyword values are positional (f.tokens).
-func parseFields(body string) lineFields {
-	f := lineFields{
-		kv: make(map[string]string),
-	}
-
-	// We work on the raw string with a cursor so that bracket and quoted
-	// values (which may contain spaces) can be consumed without re-joining.
-	s := strings.TrimSpace(body)
+// Tokens that are not keyword keys or keyword values are positional.
+func ScanFields(body string) []Field {
+	var fields []Field
+	pos := 0
 
-	for len(s) > 0 {
-		s = strings.TrimSpace(s)
-		if len(s) == 0 {
-			break
+	skipSpace := func() {
+		for pos < len(body) && strings.IndexByte(" \t\r\n\v\f", body[pos]) >= 0 {
+			pos++
 		}
-
-		// Find the end of the current token (next whitespace).
-		spIdx := strings.IndexAny(s, " \t")
-		var tok string
-		if spIdx < 0 {
-			tok = s
-			s = ""
+	}
+	// nextWord consumes the next whitespace-separated word and returns it with its offset.
+	nextWord := func() (string, int) {
+		skipSpace()
+		start := pos
+		if sp := strings.IndexAny(body[pos:], " \t"); sp < 0 {
+			pos = len(body)
 		} else {
-			tok = s[:spIdx]
-			s = strings.TrimSpace(s[spIdx:])
+			pos += sp
 		}
+		return body[start:pos], start
+	}
+	// untilKeyword consumes words up to (not including) the next keyword.
+	untilKeyword := func() []string {
+		var parts []string
+		for {
+			save := pos
+			word, _ := nextWord()
+			if word == "" || isKeyword(word) {
+				pos = save
+				return parts
+			}
+			parts = append(parts, word)
+		}
+	}
 
-		// Is this token a keyword key?
-		// Condition: ends with ":" and contains no "://" (rules out URL schemes).
-		if strings.HasSuffix(tok, ":") && !strings.Contains(tok, "://") {
-			key := tok
+	for {
+		tok, start := nextWord()
+		if tok == "" {
+			break
+		}
+		if !isKeyword(tok) {
+			fields = append(fields, Field{Value: tok, Offset: start, ValueOffset: start})
+			continue
+		}
 
-			switch {
-			case bracketKeys[key]:
-				// Value is "[item, item, ...]" — may span the rest of the line.
-				s = strings.TrimSpace(s)
-				if strings.HasPrefix(s, "[") {
-					end := strings.Index(s, "]")
-					if end >= 0 {
-						inner := s[1:end]
-						s = strings.TrimSpace(s[end+1:])
-						if key == "on:" {
-							for _, part := range strings.Split(inner, ",") {
-								if v := strings.TrimSpace(part); v != "" {
-									f.osFilter = append(f.osFilter, v)
-								}
-							}
-						} else {
-							// skip: — store as comma-joined trimmed list
-							var items []string
-							for _, part := range strings.Split(inner, ",") {
-								if v := strings.TrimSpace(part); v != "" {
-									items = append(items, v)
-								}
-							}
-							f.kv[key] = strings.Join(items, ",")
-						}
-					}
-					// If no "]" found, ignore malformed bracket value.
+		field := Field{Key: tok, Offset: start, ValueOffset: -1}
+		skipSpace()
+		switch {
+		case bracketKeys[tok]:
+			// Value is "[item, item, ...]" — may span the rest of the line.
+			// Without "[" or without the closing "]" the keyword is ignored
+			// (no value to extract, no side-effects on subsequent tokens).
+			end := strings.Index(body[pos:], "]")
+			if !strings.HasPrefix(body[pos:], "[") || end < 0 {
+				field.Ignored = true
+				break
+			}
+			field.ValueOffset = pos
+			field.Bracket = true
+			for _, part := range strings.Split(body[pos+1:pos+end], ",") {
+				if v := strings.TrimSpace(part); v != "" {
+					field.List = append(field.List, v)
 				}
-				// If not followed by "[", the keyword is silently ignored
-				// (no value to extract, no side-effects on subsequent tokens).
+			}
+			pos += end + 1
 
-			case key == "cron:":
-				s = strings.TrimSpace(s)
-				if strings.HasPrefix(s, `"`) {
-					// Quoted cron expression: consume up to the closing quote.
-					end := strings.Index(s[1:], `"`)
-					if end >= 0 {
-						f.kv[key] = s[1 : end+1]
-						s = strings.TrimSpace(s[end+2:])
-					}
-				} else {
-					// Unquoted: consume tokens until the next keyword or end.
-					var parts []string
-					for len(s) > 0 {
-						sp := strings.IndexAny(s, " \t")
-						var word string
-						if sp < 0 {
-							word = s
-							s = ""
-						} else {
-							word = s[:sp]
-							s = strings.TrimSpace(s[sp:])
-						}
-						if strings.HasSuffix(word, ":") && !strings.Contains(word, "://") {
-							// Put the keyword back for the outer loop.
-							s = word + " " + s
-							break
-						}
-						parts = append(parts, word)
-					}
-					f.kv[key] = strings.Join(parts, " ")
-				}
+		case strings.HasPrefix(body[pos:], `"`) && !multiwordKeys[tok]:
+			// Quoted value, such as a cron expression or a path with
+			// spaces: consume up to the closing quote.
+			end := strings.Index(body[pos+1:], `"`)
+			if end < 0 {
+				field.Ignored = true
+				break
+			}
+			field.ValueOffset = pos
+			field.Value = body[pos+1 : pos+1+end]
+			field.Quoted = true
+			pos += end + 2
 
-			case multiwordKeys[key]:
-				// Consume tokens until the next keyword or end.
-				var parts []string
-				for len(s) > 0 {
-					sp := strings.IndexAny(s, " \t")
-					var word string
-					if sp < 0 {
-						word = s
-						s = ""
-					} else {
-						word = s[:sp]
-						s = strings.TrimSpace(s[sp:])
-					}
-					if strings.HasSuffix(word, ":") && !strings.Contains(word, "://") {
-						s = word + " " + s
-						break
-					}
-					parts = append(parts, word)
-				}
-				f.kv[key] = strings.Join(parts, " ")
+		case tok == "cron:" || multiwordKeys[tok]:
+			if pos < len(body) {
+				field.ValueOffset = pos
+			}
+			field.Value = strings.Join(untilKeyword(), " ")
 
-			default:
-				// Single-word value.
-				sp := strings.IndexAny(s, " \t")
-				if sp < 0 {
-					f.kv[key] = s
-					s = ""
-				} else {
-					f.kv[key] = s[:sp]
-					s = strings.TrimSpace(s[sp:])
-				}
+		default:
+			// Single-word value, even when it looks like a keyword.
+			if pos < len(body) {
+				field.ValueOffset = pos
 			}
-		} else {
-			// Positional token.
-			f.tokens = append(f.tokens, tok)
+			field.Value, _ = nextWord()
 		}
+		fields = append(fields, field)
 	}
 
+	return fields
+}
+
+// parseFields tokenizes a rule body into keyword fields and positional tokens
+// (see ScanFields for the grammar).
+func parseFields(body string) lineFields {
+	f := lineFields{
+		kv:     make(map[string]string),
+		quoted: make(map[string]bool),
+	}
+	for _, field := range ScanFields(body) {
+		switch {
+		case field.Key == "":
+			f.tokens = append(f.tokens, field.Value)
+		case field.Ignored:
+		case field.Key == "on:":
+			f.osFilter = append(f.osFilter, field.List...)
+		case bracketKeys[field.Key]:
+			// skip:/aliases:/arch:/map: — store as comma-joined trimmed list
+			f.kv[field.Key] = strings.Join(field.List, ",")
+		default:
+			f.kv[field.Key] = field.Value
+			f.quoted[field.Key] = field.Quoted
+		}
+	}
 	return f
 }
 
-// word returns the first whitespace-separated word for a keyword, or "" if absent.
+// lineAttributes returns the keywords of a rule line without their colon, in
+// source order and each once.
+func lineAttributes(line string) []string {
+	var attrs []string
+	for _, field := range ScanFields(line) {
+		if name := strings.TrimSuffix(field.Key, ":"); name != "" && !slices.Contains(attrs, name) {
+			attrs = append(attrs, name)
+		}
+	}
+	return attrs
+}
+
+// word returns the first whitespace-separated word for a keyword, or the
+// whole value when it was quoted, or "" if absent.
 func (f lineFields) word(key string) string {
 	v, ok := f.kv[key]
 	if !ok {
 		return ""
 	}
+	if f.quoted[key] {
+		return v
+	}
 	fields := strings.Fields(v)
 	if len(fields) == 0 {
 		return ""
@@ -229,11 +259,35 @@ func (f lineFields) rest() string {
 	return strings.Join(f.tokens, " ")
 }
 
+// checkFields returns an error for the first keyword of line without a usable
+// value, which ScanFields leaves out: without it a rule would silently run
+// everywhere (on: linux) or take the value as a positional token.
+func checkFields(line string) error {
+	for _, field := range ScanFields(line) {
+		if !field.Ignored {
+			continue
+		}
+		if bracketKeys[field.Key] {
+			return lineError(line, fmt.Sprintf("%s needs a bracket list, such as %s [a, b]", field.Key, field.Key))
+		}
+		return lineError(line, fmt.Sprintf("unterminated quote in the value of %s", field.Key))
+	}
+	return nil
+}
+
 // lineError formats a parse error with the offending line content.
 func lineError(line, msg string) error {
 	return fmt.Errorf("%s (in: %q)", msg, line)
 }
 
+// SplitComment splits a line into its code and its inline comment (including
+// the marker), using the same rules as stripComment. comment is "" when the
+// line has none.
+func SplitComment(line string) (code, comment string) {
+	code = stripComment(line)
+	return code, line[len(code):]
+}
+
 // stripComment removes an inline comment from a line.
 // Both # and // are supported as comment markers.
 // A marker is only treated as a comment if it is preceded by whitespace or
@@ -317,3 +317,90 @@ func containsStr(s, substr string) bool {
 	}
 	return false
 }
+
+func TestScanFieldsOffsets(t *testing.T) {
+	body := `make unless: test -f x on: [mac] cron: "0 * * * *" id: build`
+	got := ScanFields(body)
+	want := []Field{
+		{Value: "make", Offset: 0, ValueOffset: 0},
+		{Key: "unless:", Value: "test -f x", Offset: 5, ValueOffset: 13},
+		{Key: "on:", List: []string{"mac"}, Bracket: true, Offset: 23, ValueOffset: 27},
+		{Key: "cron:", Value: "0 * * * *", Quoted: true, Offset: 33, ValueOffset: 39},
+		{Key: "id:", Value: "build", Offset: 51, ValueOffset: 55},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ScanFields() =\n%+v\nwant\n%+v", got, want)
+	}
+}
+
+func TestScanFieldsIgnoredKeyword(t *testing.T) {
+	got := ScanFields("git on: linux skip: [a")
+	if len(got) != 5 {
+		t.Fatalf("expected 5 fields, got %+v", got)
+	}
+	if !got[1].Ignored || got[1].ValueOffset != -1 {
+		t.Errorf("on: without brackets should be ignored, got %+v", got[1])
+	}
+	if !got[3].Ignored || got[4].Value != "[a" {
+		t.Errorf("unterminated bracket should be ignored and left positional, got %+v", got[3:])
+	}
+}
+
+func TestSplitComment(t *testing.T) {
+	code, comment := SplitComment("install git # tools")
+	if code != "install git " || comment != "# tools" {
+		t.Errorf("SplitComment() = %q, %q", code, comment)
+	}
+	if _, comment := SplitComment("clone https://x/y.git to: ~/y"); comment != "" {
+		t.Errorf("URL must not start a comment, got %q", comment)
+	}
+}
+
+func TestRuleAttributes(t *testing.T) {
+	rules, err := Parse("clone https://github.com/user/repo.git to: ~/repo brnach: main on: [mac]\nvar GREETING hello: world\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"to", "brnach", "on"}; !reflect.DeepEqual(rules[0].Attributes, want) {
+		t.Errorf("clone Attributes = %v, want %v", rules[0].Attributes, want)
+	}
+	if rules[1].Attributes != nil {
+		t.Errorf("var Attributes = %v, want none: its value is taken verbatim", rules[1].Attributes)
+	}
+}
+
+func TestScanFieldsQuotedValue(t *testing.T) {
+	got := ScanFields(`https://example.com/a.git to: "~/My Notes" id: notes unless: "test -d x"`)
+	if len(got) != 4 {
+		t.Fatalf("expected 4 fields, got %+v", got)
+	}
+	if got[1].Value != "~/My Notes" || !got[1].Quoted {
+		t.Errorf("to: = %+v, want the quoted value without its quotes", got[1])
+	}
+	if got[2].Value != "notes" {
+		t.Errorf("id: = %+v, want notes after the quoted value", got[2])
+	}
+	if got[3].Value != `"test -d x"` || got[3].Quoted {
+		t.Errorf("unless: = %+v, want multi-word values kept as written", got[3])
+	}
+}
+
+func TestParseRejectsIgnoredAttributes(t *testing.T) {
+	for _, line := range []string{
+		"install git on: linux",
+		"mkdir ~/x arch: [arm64",
+		`clone https://example.com/a.git to: "~/My Notes`,
+	} {
+		if _, err := Parse(line); err == nil {
+			t.Errorf("Parse(%q) error = nil, want an error", line)
+		}
+	}
+
+	rules, err := Parse(`clone https://example.com/a.git to: "~/My Notes" on: [linux]`)
+	if err != nil {
+		t.Fatalf("Parse() error: %v", err)
+	}
+	if rules[0].ClonePath != "~/My Notes" {
+		t.Errorf("ClonePath = %q, want ~/My Notes", rules[0].ClonePath)
+	}
+}
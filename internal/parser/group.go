@@ -0,0 +1,81 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+)
+
+// groupBlock is an open "group <name> [on: [...]] [arch: [...]] [after: ...] {"
+// block. Rules up to the matching "}" — including rules of files included
+// inside it and of nested groups — inherit its name and attributes.
+type groupBlock struct {
+	name     string
+	osList   []string
+	archList []string
+	after    []string
+	start    int // index of the block's first rule
+	line     int // line of the opening statement, for errors
+}
+
+// isGroupStart reports whether line opens a group block.
+func isGroupStart(line string) bool {
+	return line == "group" || strings.HasPrefix(line, "group ")
+}
+
+// parseGroupStart parses the opening line of a group block.
+func parseGroupStart(line string) (*groupBlock, error) {
+	body, ok := strings.CutSuffix(strings.TrimPrefix(line, "group"), "{")
+	if !ok {
+		return nil, lineError(line, "group must end with {")
+	}
+	f := parseFields(body)
+	if len(f.tokens) != 1 {
+		return nil, lineError(line, "group requires a name: group <name> [on: [...]] [after: ...] {")
+	}
+	return &groupBlock{
+		name:     f.tokens[0],
+		osList:   f.osFilter,
+		archList: f.list("arch:"),
+		after:    f.list("after:"),
+	}, nil
+}
+
+// apply gives the group's attributes to rules, the rules of the block. A
+// rule's own group:, on: and arch: win over the group's, which are only
+// defaults; after: is combined, so every rule of the group still runs after
+// what the group names. Rules of nested groups have already been given the
+// inner group's attributes, so those win over the outer group's.
+func (g *groupBlock) apply(rules []Rule) {
+	for i := range rules {
+		r := &rules[i]
+		if r.Group == "" {
+			r.Group = g.name
+		}
+		if len(r.OSList) == 0 {
+			r.OSList = append([]string(nil), g.osList...)
+		}
+		if len(r.ArchList) == 0 {
+			r.ArchList = append([]string(nil), g.archList...)
+		}
+		for _, dep := range g.after {
+			if !containsString(r.After, dep) {
+				r.After = append(r.After, dep)
+			}
+		}
+	}
+}
+
+// unclosedGroupError reports the innermost group still open at the end of a file.
+func unclosedGroupError(groups []*groupBlock) error {
+	g := groups[len(groups)-1]
+	return fmt.Errorf("line %d: group %q is not closed with }", g.line, g.name)
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
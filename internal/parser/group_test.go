@@ -0,0 +1,124 @@
+package parser
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseGroupBlock(t *testing.T) {
+	rules, err := Parse(`
+mkdir ~/base id: base
+group work on: [mac] after: base {
+  install slack
+  mkdir ~/w on: [linux] after: other group: mine
+  group inner arch: [arm64] after: slack {
+    run echo hi
+  }
+}
+install git
+`)
+	if err != nil {
+		t.Fatalf("Parse() error: %v", err)
+	}
+	if len(rules) != 5 {
+		t.Fatalf("got %d rules, want 5", len(rules))
+	}
+
+	tests := []struct {
+		name  string
+		rule  Rule
+		group string
+		os    []string
+		arch  []string
+		after []string
+	}{
+		{"before the group", rules[0], "", nil, nil, nil},
+		{"inherits everything", rules[1], "work", []string{"mac"}, nil, []string{"base"}},
+		{"own attributes win, after: is combined", rules[2], "mine", []string{"linux"}, nil, []string{"other", "base"}},
+		{"nested group", rules[3], "inner", []string{"mac"}, []string{"arm64"}, []string{"slack", "base"}},
+		{"after the group", rules[4], "", nil, nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.rule.Group != tt.group {
+				t.Errorf("Group = %q, want %q", tt.rule.Group, tt.group)
+			}
+			if len(tt.rule.OSList)+len(tt.os) > 0 && !reflect.DeepEqual(tt.rule.OSList, tt.os) {
+				t.Errorf("OSList = %v, want %v", tt.rule.OSList, tt.os)
+			}
+			if len(tt.rule.ArchList)+len(tt.arch) > 0 && !reflect.DeepEqual(tt.rule.ArchList, tt.arch) {
+				t.Errorf("ArchList = %v, want %v", tt.rule.ArchList, tt.arch)
+			}
+			if len(tt.rule.After)+len(tt.after) > 0 && !reflect.DeepEqual(tt.rule.After, tt.after) {
+				t.Errorf("After = %v, want %v", tt.rule.After, tt.after)
+			}
+		})
+	}
+}
+
+func TestParseGroupBlockIncludes(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "work.bp"), []byte("install slack\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	main := filepath.Join(dir, "setup.bp")
+	if err := os.WriteFile(main, []byte("group work on: [mac] {\n  include work.bp\n}\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	rules, err := ParseFile(main)
+	if err != nil {
+		t.Fatalf("ParseFile() error: %v", err)
+	}
+	if len(rules) != 1 || rules[0].Group != "work" || !reflect.DeepEqual(rules[0].OSList, []string{"mac"}) {
+		t.Errorf("included rule = %+v, want it in group work on mac", rules)
+	}
+}
+
+func TestParseGroupBlockErrors(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"group work on: [mac]\ninstall git\n}", "line 1: group must end with {"},
+		{"group {\ninstall git\n}", "group requires a name"},
+		{"group work {\ninstall git", `line 1: group "work" is not closed`},
+		{"install git\n}", "line 2: } without a group to close"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			_, err := Parse(tt.input)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Parse() error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestGroupAttributeOnEveryAction(t *testing.T) {
+	lines := []string{
+		"install curl git",
+		"clone https://github.com/acme/tools.git to: ~/src/tools",
+		"mkdir ~/projects",
+		"asdf nodejs@20.11.0",
+		"known_hosts github.com",
+		"gpg_key https://download.docker.com/linux/ubuntu/gpg keyring: docker deb-url: https://download.docker.com/linux/ubuntu",
+		"decrypt secrets/key.enc to: ~/.key",
+		"run make setup",
+		"download https://example.com/tool.tar.gz to: ~/tool.tar.gz",
+	}
+	for _, line := range lines {
+		t.Run(strings.Fields(line)[0], func(t *testing.T) {
+			rules, err := Parse(line + " group: tools")
+			if err != nil {
+				t.Fatalf("Parse(%q) error: %v", line, err)
+			}
+			if len(rules) != 1 || rules[0].Group != "tools" {
+				t.Errorf("Parse(%q) = %+v, want one rule in group tools", line, rules)
+			}
+		})
+	}
+}
@@ -0,0 +1,81 @@
+package parser
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+)
+
+// MaxIncludeSize is the largest file include reads. Blueprints are a few
+// kilobytes; a file this big is almost certainly the wrong path.
+const MaxIncludeSize = 1 << 20
+
+// binarySniffLen is how much of an included file is checked for NUL bytes,
+// the same amount git looks at to tell binary files from text.
+const binarySniffLen = 8000
+
+// ReadInclude reads an included blueprint after checking that it is one: a
+// regular file with a .bp, .yaml or .yml extension (or none), no larger than MaxIncludeSize
+// and holding UTF-8 text. Each check fails with an error naming the problem,
+// rather than letting the parser report every line of a binary as unknown;
+// callers add the path.
+func ReadInclude(path string) ([]byte, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("file not found: %s", path)
+	}
+	if info.IsDir() {
+		return nil, fmt.Errorf("is a directory, not a blueprint file")
+	}
+	if !info.Mode().IsRegular() {
+		return nil, fmt.Errorf("is not a regular file")
+	}
+	if ext := filepath.Ext(path); ext != "" && !strings.EqualFold(ext, ".bp") && !IsYAMLFile(path) {
+		return nil, fmt.Errorf("not a blueprint file: expected a .bp or .yaml extension, got %s", ext)
+	}
+	if info.Size() > MaxIncludeSize {
+		return nil, fmt.Errorf("file is %s, over the %s limit for blueprint files", formatSize(info.Size()), formatSize(MaxIncludeSize))
+	}
+
+	f, err := os.Open(path) // #nosec G304 -- path is a user-supplied blueprint path
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+	defer func() { _ = f.Close() }()
+	// Read one byte past the limit in case the file grew since the stat
+	content, err := io.ReadAll(io.LimitReader(f, MaxIncludeSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+	if len(content) > MaxIncludeSize {
+		return nil, fmt.Errorf("file is over the %s limit for blueprint files", formatSize(MaxIncludeSize))
+	}
+	if isBinary(content) {
+		return nil, fmt.Errorf("looks like a binary file, not a blueprint")
+	}
+	return content, nil
+}
+
+// isBinary reports whether content has a NUL byte near its start or is not
+// valid UTF-8, which no blueprint written in an editor is.
+func isBinary(content []byte) bool {
+	if bytes.IndexByte(content[:min(len(content), binarySniffLen)], 0) >= 0 {
+		return true
+	}
+	return !utf8.Valid(content)
+}
+
+// formatSize formats a byte count for an error message.
+func formatSize(n int64) string {
+	switch {
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MiB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1f KiB", float64(n)/(1<<10))
+	}
+	return fmt.Sprintf("%d bytes", n)
+}
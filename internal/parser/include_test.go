@@ -0,0 +1,61 @@
+package parser
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReadInclude(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name string, content []byte) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, content, 0600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	for _, name := range []string{"tools.bp", "TOOLS.BP", "Blueprintfile"} {
+		if _, err := ReadInclude(write(name, []byte("install git\n"))); err != nil {
+			t.Errorf("ReadInclude(%s) = %v, want it accepted", name, err)
+		}
+	}
+
+	tests := []struct {
+		name    string
+		path    string
+		wantErr string
+	}{
+		{"missing", filepath.Join(dir, "missing.bp"), "file not found"},
+		{"directory", dir, "is a directory"},
+		{"wrong extension", write("logo.png", []byte("install git\n")), "expected a .bp or .yaml extension, got .png"},
+		{"too large", write("huge.bp", []byte(strings.Repeat("# padding\n", MaxIncludeSize/10+1))), "over the 1.0 MiB limit"},
+		{"nul bytes", write("bin.bp", []byte("install git\x00\x01\x02")), "looks like a binary file"},
+		{"invalid utf-8", write("latin1.bp", []byte("run echo caf\xe9\n")), "looks like a binary file"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ReadInclude(tt.path)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("ReadInclude() error = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestParseFileRejectsBinaryInclude(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "setup.bp"), []byte("install git\ninclude tool\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "tool"), []byte("\x7fELF\x02\x01\x01\x00\x00"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := ParseFile(filepath.Join(dir, "setup.bp"))
+	if err == nil || !strings.Contains(err.Error(), "tool: looks like a binary file") {
+		t.Fatalf("ParseFile() error = %v, want a binary include error", err)
+	}
+}
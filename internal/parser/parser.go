@@ -1,10 +1,15 @@
 package parser
 
 import (
+	"encoding/base64"
 	"fmt"
 	"os"
 	"path/filepath"
+	"regexp"
+	"strconv"
 	"strings"
+	"time"
+	"unicode"
 
 	"github.com/elpic/blueprint/internal/git"
 )
@@ -12,23 +17,61 @@ import (
 type Package struct {
 	Name           string
 	Version        string
-	PackageManager string // e.g., "apt", "snap", defaults to system default
-	Stage          string // e.g., "build", "runtime" — used by container templates
+	PackageManager string            // e.g., "apt", "snap", defaults to system default
+	Stage          string            // e.g., "build", "runtime" — used by container templates
+	OSNames        map[string]string // OS name → package name on that OS (see mac-name:, linux-name:, map:)
+}
+
+// NameFor returns the package name to use on osName.
+func (p Package) NameFor(osName string) string {
+	if name, ok := p.OSNames[osName]; ok {
+		return name
+	}
+	return p.Name
 }
 
 type Rule struct {
-	ID       string // Unique identifier for this rule
-	Action   string // "install", "uninstall", "clone", "mkdir", "decrypt", "asdf", "mise", "homebrew", "ollama", "known_hosts", "gpg_key", "sudoers", "schedule", "shell", or "authorized_keys"
-	Packages []Package
-	OSList   []string
-	After    []string // List of IDs or package names this rule depends on
-	Group    string
+	ID          string // Unique identifier for this rule
+	Action      string // "install", "uninstall", "clone", "mkdir", "decrypt", "asdf", "mise", "homebrew", "ollama", "mas", "devcert", "known_hosts", "gpg_key", "repo", "sudoers", "schedule", "state-backup", "shell", or "authorized_keys"
+	Packages    []Package
+	OSList      []string
+	ArchList    []string // CPU architectures the rule applies to (see arch:); empty means all
+	After       []string // List of IDs or package names this rule depends on
+	Group       string
+	Aliases     []string      // Previous IDs or resource keys this rule was known by (see aliases:)
+	Transaction string        // Group whose file writes are applied all or nothing (see transaction:)
+	Sensitive   bool          // Output may hold secrets: kept out of history and hidden in the terminal (see sensitive:)
+	Shell       string        // Shell user commands run in: sh, bash, zsh, fish or pwsh (see shell:)
+	Timeout     time.Duration // Longest one attempt may run before the rule fails; 0 means no limit (see timeout:)
+	Retries     int           // Attempts after a failed first one, with exponential backoff (see retries:)
+	Jobs        int           // Targets a multi-target rule processes at once, each on its own; 0 runs them as one command (see jobs:)
+	OnFailure   string        // Id of a rule run only when this one fails, in its place (see on-failure:)
+	// ExpectChanged is "false" when the rule asserts it converges, doing
+	// nothing once applied, "true" when it is meant to change something on
+	// every run, and "" when it asserts neither (see expect-changed:)
+	ExpectChanged string
+
+	// Where the rule was written, for diagnostics. Left out of JSON so that
+	// moving a rule does not read as a change to it.
+	SourceFile string `json:"-"` // Blueprint file, or "" for content parsed with Parse
+	SourceLine int    `json:"-"` // 1-based line the rule starts on
+
+	// Attributes are the keywords written on the rule's line, without their
+	// colon and in source order, so that unknown ones can be reported.
+	Attributes []string `json:"-"`
+
+	// Address names the rule on the command line when it has no id:, such
+	// as install.curl (see handlers.SetRuleAddresses). Set by the engine
+	// after variables are expanded.
+	Address string `json:"-"`
 
 	// Clone-specific fields
 	CloneURL     string // Git repository URL
 	ClonePath    string // Destination path for cloned repository
 	Branch       string // Branch to clone (optional, defaults to repo default)
 	CloneWorkdir bool   // If true, clone with .git intact (for active development repos)
+	CloneApply   string // Blueprint inside the clone to apply after it, relative to its root (apply:)
+	CloneReplace bool   // If true, replace what is at the destination when it is not this repository (replace:)
 
 	// ASDF-specific fields
 	AsdfPackages []string // List of "plugin@version" for asdf (e.g., "nodejs@21.4.0")
@@ -51,17 +94,28 @@ type Rule struct {
 	DecryptPasswordID string // Password ID to use for decryption
 
 	// KnownHosts-specific fields
-	KnownHosts    string // SSH host to add to known_hosts (hostname or IP)
-	KnownHostsKey string // Key type for ssh-keyscan (ed25519, ecdsa, rsa, etc.) - optional
+	KnownHosts       string // SSH host to add to known_hosts (hostname or IP)
+	KnownHostsKey    string // Key type for ssh-keyscan (ed25519, ecdsa, rsa, etc.) - optional
+	KnownHostsPubkey string // Host key written as is instead of scanning, e.g. "ssh-ed25519 AAAA..." (see pubkey:)
 
 	// Mkdir-specific fields
 	Mkdir      string // Directory path to create
 	MkdirPerms string // Octal permissions (e.g., "755", "700") - optional
 
 	// GPG Key-specific fields
-	GPGKeyURL  string // URL to the GPG key file
-	GPGKeyring string // Name of the keyring (without path or .gpg extension)
-	GPGDebURL  string // Debian repository URL
+	GPGKeyURL         string // URL to the GPG key file
+	GPGKeyring        string // Name of the keyring (without path or .gpg extension)
+	GPGDebURL         string // Debian repository URL
+	GPGKeyFingerprint string // Expected fingerprint of the key, upper-case hex without spaces (see fingerprint:)
+
+	// Repo-specific fields
+	RepoName           string   // Repository name, used for its key and source file names
+	RepoURL            string   // Repository base URL
+	RepoKeyURL         string   // URL of the key the repository is signed with
+	RepoKeyFingerprint string   // Expected fingerprint of the key, upper-case hex without spaces (see fingerprint:)
+	RepoType           string   // "apt" or "dnf"; detected from the distro family when empty
+	RepoSuite          string   // apt suite (defaults to the distro codename)
+	RepoComponents     []string // apt components (defaults to "main")
 
 	// Homebrew-specific fields
 	HomebrewPackages []string // List of "formula[@version]" for homebrew (e.g., "node@20", "git")
@@ -76,6 +130,32 @@ type Rule struct {
 	// Ollama-specific fields
 	OllamaModels []string // List of model names for ollama (e.g., "llama3", "codellama")
 
+	// Docker-specific fields
+	DockerImages []string // Images to pull, with an optional tag or digest (e.g., "postgres:16", "redis")
+
+	// Mas-specific fields
+	MasApps []string // Mac App Store apps, by numeric ID or name (e.g., "497799835", "Xcode")
+
+	// Devcert-specific fields
+	DevcertNames  []string // Host names and IPs the certificate is valid for (e.g., "myapp.local", "*.myapp.local")
+	DevcertVia    string   // How the certificate is made: "mkcert" (default) or "builtin"
+	DevcertCert   string   // Certificate path (optional, defaults to ~/.blueprint/certs/<name>.pem)
+	DevcertKey    string   // Private key path (optional, defaults to ~/.blueprint/certs/<name>-key.pem)
+	DevcertDropCA bool     // Set on the uninstall rule of the last builtin certificate so its CA is untrusted too
+
+	// PPA-specific fields
+	PPA            string // Launchpad PPA as "owner/name" (e.g., "neovim-ppa/unstable")
+	PPAFingerprint string // Expected signing key fingerprint (optional, looked up on Launchpad otherwise)
+
+	// Service-specific fields
+	ServiceName  string // systemd unit on Linux, launchd label on macOS (e.g., "docker", "com.example.agent")
+	ServiceState string // "enabled" (default: started now and at boot) or "started" (started now only)
+	ServiceScope string // "system" (default) or "user"
+
+	// Autostart-specific fields
+	AutostartName string // Name of the login item (e.g., "Syncthing")
+	AutostartExec string // Command it runs at login (e.g., "syncthing serve --no-browser")
+
 	// Download-specific fields
 	DownloadURL       string // Source URL
 	DownloadPath      string // Destination path
@@ -83,14 +163,20 @@ type Rule struct {
 	DownloadPerms     string // Optional octal permissions (e.g. "0755")
 
 	// Run-specific fields
-	RunCommand string // Shell command to execute
-	RunUnless  string // Skip if this command exits 0 (idempotency check)
-	RunUndo    string // Execute when rule is removed from blueprint
-	RunSudo    bool   // If true, prepend sudo to the command
+	RunCommand  string // Shell command to execute
+	RunUnless   string // Skip if this command exits 0 (idempotency check)
+	RunUndo     string // Execute when rule is removed from blueprint
+	RunSudo     bool   // If true, prepend sudo to the command
+	RunCleanEnv bool   // If true, run with a minimal environment instead of inheriting the caller's
+	RunCreates  string // Skip if this path exists; the artifact the command makes (see creates:)
 
 	// Run-sh-specific fields
 	RunShURL string // URL to the script to download and execute
 
+	// State-backup-specific fields
+	StateBackupEvery string // "daily", "weekly" or "hourly"
+	StateBackupTo    string // directory the archives are written to
+
 	// Shell-specific fields
 	ShellName string // Shell name or path to set as default login shell
 
@@ -110,6 +196,26 @@ type Rule struct {
 	RenderVars     []string // KEY=VALUE variable overrides
 }
 
+// ForOS returns the rule with its per-OS package name overrides resolved for
+// osName. Rules without overrides are returned unchanged.
+func (r Rule) ForOS(osName string) Rule {
+	var pkgs []Package
+	for i, pkg := range r.Packages {
+		if len(pkg.OSNames) == 0 {
+			continue
+		}
+		if pkgs == nil {
+			pkgs = append([]Package(nil), r.Packages...)
+		}
+		pkgs[i].Name = pkg.NameFor(osName)
+		pkgs[i].OSNames = nil
+	}
+	if pkgs != nil {
+		r.Packages = pkgs
+	}
+	return r
+}
+
 type parseEntry struct {
 	prefix string
 	fn     func(string) (*Rule, error)
@@ -124,22 +230,40 @@ var parsers = []parseEntry{
 	{"asdf", ParseAsdfRule},
 	{"homebrew", ParseHomebrewRule},
 	{"ollama", ParseOllamaRule},
+	{"mas ", ParseMasRule},
+	{"devcert ", ParseDevcertRule},
+	{"ppa ", ParsePPARule},
 	{"decrypt ", ParseDecryptRule},
 	{"known_hosts ", ParseKnownHostsRule},
 	{"mkdir ", ParseMkdirRule},
 	{"gpg_key ", ParseGPGKeyRule},
+	{"repo ", ParseRepoRule},
 	{"download ", ParseDownloadRule},
 	{"run-sh ", ParseRunShRule},
 	{"run ", ParseRunRule},
 	{"dotfiles ", ParseDotfilesRule},
 	{"sudoers", ParseSudoersRule},
+	{"state-backup ", ParseStateBackupRule},
 	{"schedule", ParseScheduleRule},
 	{"shell ", ParseShellRule},
+	{"service ", ParseServiceRule},
+	{"docker ", ParseDockerRule},
+	{"autostart ", ParseAutostartRule},
 	{"authorized_keys ", ParseAuthorizedKeysRule},
 	{"var ", ParseVarRule},
 	{"render ", ParseRenderRule},
 }
 
+// Directives returns the rule directive names the parser understands
+// ("install", "run-sh", ...), in the order they are matched.
+func Directives() []string {
+	names := make([]string, len(parsers))
+	for i, p := range parsers {
+		names[i] = strings.TrimSpace(p.prefix)
+	}
+	return names
+}
+
 // Parse parses content without include support
 func Parse(content string) ([]Rule, error) {
 	return parseContent(content, "", make(map[string]bool))
@@ -159,9 +283,26 @@ func ParseFile(filePath string) ([]Rule, error) {
 		return nil, fmt.Errorf("failed to read file: %w", err)
 	}
 
+	source, err := blueprintSource(absFilePath, content)
+	if err != nil {
+		return nil, err
+	}
+
 	// baseDir is now absolute, so all relative includes will be resolved correctly
 	baseDir := filepath.Dir(absFilePath)
-	return parseContent(string(content), baseDir, make(map[string]bool))
+	rules, err := parseContent(source, baseDir, map[string]bool{absFilePath: true})
+	return setSourceFile(rules, absFilePath), err
+}
+
+// setSourceFile records file as the source of the rules parsed from it,
+// leaving the rules of its includes pointing at their own files.
+func setSourceFile(rules []Rule, file string) []Rule {
+	for i := range rules {
+		if rules[i].SourceFile == "" {
+			rules[i].SourceFile = file
+		}
+	}
+	return rules
 }
 
 // joinContinuationLines joins physical lines that end with a backslash (\) continuation
@@ -177,18 +318,30 @@ func ParseFile(filePath string) ([]Rule, error) {
 //	"run echo hello \\ # comment\n  world" → "run echo hello   world"
 //	"run echo \\\n  hello \\\n  world"     → "run echo   hello   world"
 //
-// This is called before the main parsing loop so that all Parse*Rule functions
-// see already-joined lines and do not need any multi-line awareness.
+// The main parsing loop joins lines the same way (see logicalLines) before
+// dispatching on the directive, so that all Parse*Rule functions see
+// already-joined lines and do not need any multi-line awareness.
 func joinContinuationLines(content string) string {
-	lines := strings.Split(content, "\n")
+	lines, _ := logicalLines(content)
+	return strings.Join(lines, "\n")
+}
+
+// logicalLines splits content into lines the way joinContinuationLines joins
+// them, and returns with each the 1-based physical line it starts on, so
+// errors point at the line the user wrote rather than at its index after
+// joining.
+func logicalLines(content string) ([]string, []int) {
 	var result []string
+	var lineNums []int
 	var pending string
+	pendingStart := 0
 
-	for _, line := range lines {
+	for i, line := range strings.Split(content, "\n") {
 		// Strip inline comments first so that `\ # comment` continues.
 		line = stripComment(line)
 		// Right-trim to detect a trailing continuation backslash.
 		trimmed := strings.TrimRight(line, " \t")
+		start := i + 1
 
 		if pending != "" {
 			if trimmed == "" {
@@ -197,34 +350,84 @@ func joinContinuationLines(content string) string {
 			}
 			// Join the continued text with the current line.
 			trimmed = pending + " " + strings.TrimSpace(trimmed)
+			start = pendingStart
 			pending = ""
 		}
 
 		if strings.HasSuffix(trimmed, "\\") {
 			// Line continues — store the text without the trailing backslash.
 			pending = strings.TrimSpace(trimmed[:len(trimmed)-1])
+			pendingStart = start
 			continue
 		}
 
 		result = append(result, trimmed)
+		lineNums = append(lineNums, start)
 	}
 
 	if pending != "" {
 		result = append(result, pending)
+		lineNums = append(lineNums, pendingStart)
 	}
 
-	return strings.Join(result, "\n")
+	return result, lineNums
+}
+
+// parseContent parses content with optional include file support. active
+// holds the files being parsed, so an include of one of them is a cycle.
+func parseContent(content string, baseDir string, active map[string]bool) ([]Rule, error) {
+	includes := includeSet{active: active, included: map[string]bool{}}
+	return parsePinnedContent(content, baseDir, includes, nil)
 }
 
-// parseContent parses content with optional include file support
-func parseContent(content string, baseDir string, loadedFiles map[string]bool) ([]Rule, error) {
-	content = joinContinuationLines(content)
-	lines := strings.Split(content, "\n")
+// parsePinnedContent is parseContent for a blueprint whose includers pinned
+// the remote blueprints in pins.
+func parsePinnedContent(content string, baseDir string, includes includeSet, pins Pins) ([]Rule, error) {
+	lines, lineNums := logicalLines(content)
 	var rules []Rule
 
-	for lineNum, line := range lines {
+	// Pins apply to every include of the file, wherever they are written
+	pins, err := collectPins(lines, lineNums, pins)
+	if err != nil {
+		return nil, err
+	}
+	var groups []*groupBlock // open group blocks, innermost last
+	var defaults []defaultsSpan
+	sensitiveSet := map[int]bool{}
+
+	for i, line := range lines {
+		lineNum := lineNums[i]
 		line = strings.TrimSpace(stripComment(line))
-		if line == "" {
+		if line == "" || isPin(line) {
+			continue
+		}
+
+		if IsDefaultsLine(line) {
+			d, err := parseDefaults(line)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", lineNum, err)
+			}
+			defaults = append(defaults, defaultsSpan{start: len(rules), defaults: d})
+			continue
+		}
+
+		// Handle group blocks
+		if isGroupStart(line) {
+			group, err := parseGroupStart(line)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", lineNum, err)
+			}
+			group.start, group.line = len(rules), lineNum
+			groups = append(groups, group)
+			continue
+		}
+		if line == "}" {
+			if len(groups) == 0 {
+				return nil, fmt.Errorf("line %d: } without a group to close", lineNum)
+			}
+			group := groups[len(groups)-1]
+			groups = groups[:len(groups)-1]
+			group.apply(rules[group.start:])
 			continue
 		}
 
@@ -234,12 +437,14 @@ func parseContent(content string, baseDir string, loadedFiles map[string]bool) (
 			rest = strings.TrimSpace(rest)
 
 			// Parse optional prefer_ssh: true flag
-			preferSSH := false
-			filePath := rest
-			if idx := strings.Index(rest, "prefer_ssh:"); idx >= 0 {
-				filePath = strings.TrimSpace(rest[:idx])
-				val := strings.TrimSpace(rest[idx+len("prefer_ssh:"):])
-				preferSSH = strings.EqualFold(val, "true")
+			f := parseFields(rest)
+			preferSSH := strings.EqualFold(f.word("prefer_ssh:"), "true")
+			filePath := f.rest()
+
+			// Parse optional "as <namespace>" suffix
+			filePath, namespace, err := splitIncludeNamespace(filePath)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", lineNum, err)
 			}
 
 			// Dispatch git URLs to the remote include handler
@@ -249,16 +454,19 @@ func parseContent(content string, baseDir string, loadedFiles map[string]bool) (
 				} else {
 					filePath = git.ExpandShorthand(filePath)
 				}
-				if loadedFiles[filePath] {
+				if includes.active[filePath] {
 					fmt.Printf("Warning: Skipping circular include: %s\n", filePath)
 					continue
 				}
-				loadedFiles[filePath] = true
-				includedRules, err := loadGitInclude(filePath, loadedFiles)
+				inner, ok := includes.enter(filePath, namespace)
+				if !ok {
+					continue
+				}
+				includedRules, err := loadGitInclude(filePath, inner, pins)
 				if err != nil {
 					return nil, fmt.Errorf("failed to include %s: %w", filePath, err)
 				}
-				rules = append(rules, includedRules...)
+				rules = append(rules, namespaceRules(includedRules, namespace)...)
 				continue
 			}
 
@@ -273,17 +481,21 @@ func parseContent(content string, baseDir string, loadedFiles map[string]bool) (
 				return nil, fmt.Errorf("failed to resolve include path: %w", err)
 			}
 
-			if loadedFiles[absPath] {
+			if includes.active[absPath] {
 				fmt.Printf("Warning: Skipping circular include: %s\n", filePath)
 				continue
 			}
+			inner, ok := includes.enter(absPath, namespace)
+			if !ok {
+				continue
+			}
 
 			// Load included file
-			includedRules, err := loadInclude(absPath, loadedFiles)
+			includedRules, err := loadInclude(absPath, inner, pins)
 			if err != nil {
 				return nil, fmt.Errorf("failed to include %s: %w", filePath, err)
 			}
-			rules = append(rules, includedRules...)
+			rules = append(rules, namespaceRules(includedRules, namespace)...)
 			continue
 		}
 
@@ -300,39 +512,197 @@ func parseContent(content string, baseDir string, loadedFiles map[string]bool) (
 			}
 		}
 		if !matched {
-			return nil, fmt.Errorf("line %d: unknown directive %q", lineNum+1, line)
+			return nil, fmt.Errorf("line %d: unknown directive %q", lineNum, line)
 		}
 
 		if err != nil {
-			return nil, fmt.Errorf("line %d: %w", lineNum+1, err)
+			return nil, fmt.Errorf("line %d: %w", lineNum, err)
 		}
 		if rule != nil {
+			sensitive, err := parseCommonFields(rule, line)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", lineNum, err)
+			}
+			if sensitive {
+				sensitiveSet[len(rules)] = true
+			}
+			rule.SourceLine = lineNum
+			if rule.Action != "var" { // a var value is taken verbatim
+				rule.Attributes = lineAttributes(line)
+			}
 			rules = append(rules, *rule)
 		}
 	}
+	if len(groups) > 0 {
+		return nil, unclosedGroupError(groups)
+	}
+	applyDefaults(rules, defaults, sensitiveSet)
 
 	return rules, nil
 }
 
+// parseCommonFields fills in attributes that every rule type accepts, so the
+// individual Parse*Rule functions don't have to repeat them. It reports
+// whether the line sets sensitive:, which a defaults block must not override.
+func parseCommonFields(rule *Rule, line string) (bool, error) {
+	if err := checkFields(line); err != nil {
+		return false, err
+	}
+	f := parseFields(line)
+	if v := f.word("timeout:"); v != "" {
+		timeout, err := time.ParseDuration(v)
+		if err != nil || timeout <= 0 {
+			return false, lineError(line, fmt.Sprintf("invalid timeout %q (use a duration such as 90s or 5m)", v))
+		}
+		rule.Timeout = timeout
+	}
+	if v := f.word("retries:"); v != "" {
+		retries, err := strconv.Atoi(v)
+		if err != nil || retries < 0 {
+			return false, lineError(line, fmt.Sprintf("invalid retries %q (use a number of attempts such as 3)", v))
+		}
+		rule.Retries = retries
+	}
+	if v := f.word("jobs:"); v != "" {
+		jobs, err := strconv.Atoi(v)
+		if err != nil || jobs < 1 {
+			return false, lineError(line, fmt.Sprintf("invalid jobs %q (use a number of targets such as 4)", v))
+		}
+		rule.Jobs = jobs
+	}
+	switch v := f.word("expect-changed:"); v {
+	case "", "true", "false":
+		rule.ExpectChanged = v
+	default:
+		return false, lineError(line, fmt.Sprintf("invalid expect-changed %q (use true or false)", v))
+	}
+	rule.Aliases = f.list("aliases:")
+	rule.ArchList = f.list("arch:")
+	rule.Transaction = f.word("transaction:")
+	rule.Sensitive = f.word("sensitive:") == "true"
+	rule.Shell = f.word("shell:")
+	rule.OnFailure = f.word("on-failure:")
+	if rule.Group == "" {
+		rule.Group = f.word("group:")
+	}
+	_, sensitiveSet := f.kv["sensitive:"]
+	return sensitiveSet, nil
+}
+
+// splitIncludeNamespace splits "path as ns" into its path and namespace.
+// Without an "as" clause the namespace is empty.
+func splitIncludeNamespace(spec string) (string, string, error) {
+	fields := strings.Fields(spec)
+	if len(fields) < 2 || fields[len(fields)-2] != "as" {
+		return spec, "", nil
+	}
+	namespace := fields[len(fields)-1]
+	if !validNamespace(namespace) {
+		return "", "", fmt.Errorf("invalid include namespace %q: use letters, digits, '-' or '_'", namespace)
+	}
+	return strings.Join(fields[:len(fields)-2], " "), namespace, nil
+}
+
+// validNamespace reports whether ns can prefix rule IDs. Dots are reserved as
+// the namespace separator, so they are not allowed inside a namespace.
+func validNamespace(ns string) bool {
+	if ns == "" {
+		return false
+	}
+	for _, r := range ns {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '-' && r != '_' {
+			return false
+		}
+	}
+	return true
+}
+
+// namespaceRules prefixes every rule ID from an "include ... as ns" file with
+// "ns.", and rewrites after: and on-failure: references to those IDs to match, so that shared
+// files included from several sources cannot collide. References to anything
+// not defined by an id: inside the included file (package names, resource keys,
+// IDs from the including file) are left untouched.
+func namespaceRules(rules []Rule, ns string) []Rule {
+	if ns == "" {
+		return rules
+	}
+
+	ids := make(map[string]bool)
+	for _, r := range rules {
+		if r.ID != "" {
+			ids[r.ID] = true
+		}
+	}
+
+	for i := range rules {
+		if rules[i].ID != "" {
+			rules[i].ID = ns + "." + rules[i].ID
+		}
+		if ids[rules[i].OnFailure] {
+			rules[i].OnFailure = ns + "." + rules[i].OnFailure
+		}
+		if len(rules[i].After) == 0 {
+			continue
+		}
+		after := make([]string, len(rules[i].After))
+		for j, dep := range rules[i].After {
+			if ids[dep] {
+				dep = ns + "." + dep
+			}
+			after[j] = dep
+		}
+		rules[i].After = after
+	}
+	return rules
+}
+
+// includeSet tracks the includes of one parse.
+type includeSet struct {
+	active    map[string]bool // files on the include stack, to catch cycles
+	included  map[string]bool // namespace and file of every include so far
+	namespace string          // namespace the current file's rules end up in
+}
+
+// enter returns the set to parse file with when it is included as
+// namespace, or false when file was already included into the same
+// namespace, so a file reached twice is only parsed once. A file included
+// under two namespaces is parsed for each.
+func (s includeSet) enter(file, namespace string) (includeSet, bool) {
+	if s.namespace != "" && namespace != "" {
+		namespace = s.namespace + "." + namespace
+	} else if namespace == "" {
+		namespace = s.namespace
+	}
+	key := namespace + " " + file
+	if s.included[key] {
+		return s, false
+	}
+	s.included[key] = true
+	s.namespace = namespace
+	return s, true
+}
+
 // loadInclude loads and parses an included file
-func loadInclude(filePath string, loadedFiles map[string]bool) ([]Rule, error) {
-	// Check if file exists
-	if _, err := os.Stat(filePath); err != nil { // #nosec G703 -- filePath is a user-supplied blueprint path
-		return nil, fmt.Errorf("file not found: %s", filePath)
+func loadInclude(filePath string, includes includeSet, pins Pins) ([]Rule, error) {
+	// Read file, rejecting anything that is not a blueprint
+	content, err := ReadInclude(filePath)
+	if err != nil {
+		return nil, err
 	}
 
-	// Mark as loaded
-	loadedFiles[filePath] = true
+	// Mark as being parsed until its includes are done
+	includes.active[filePath] = true
+	defer delete(includes.active, filePath)
 
-	// Read file
-	content, err := os.ReadFile(filePath) // #nosec G703 -- filePath is a user-supplied blueprint path
+	source, err := blueprintSource(filePath, content)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read file: %w", err)
+		return nil, err
 	}
 
 	// Parse with base directory for nested includes
 	baseDir := filepath.Dir(filePath)
-	return parseContent(string(content), baseDir, loadedFiles)
+	rules, err := parsePinnedContent(source, baseDir, includes, pins)
+	return setSourceFile(rules, filePath), err
 }
 
 // localPathForGitInclude derives a stable local cache path from a git URL.
@@ -366,7 +736,10 @@ func localPathForGitInclude(rawURL string) string {
 }
 
 // loadGitInclude clones/updates the remote repo and parses the target blueprint file.
-func loadGitInclude(rawURL string, loadedFiles map[string]bool) ([]Rule, error) {
+func loadGitInclude(rawURL string, includes includeSet, pins Pins) ([]Rule, error) {
+	includes.active[rawURL] = true
+	defer delete(includes.active, rawURL)
+
 	params := git.ParseGitURL(rawURL)
 	localPath := localPathForGitInclude(rawURL)
 
@@ -380,23 +753,39 @@ func loadGitInclude(rawURL string, loadedFiles map[string]bool) ([]Rule, error)
 		return nil, fmt.Errorf("setup file not found in %s: %w", rawURL, err)
 	}
 
-	content, err := os.ReadFile(setupFile) // #nosec G304 -- setupFile is derived from trusted clone path
+	content, err := ReadInclude(setupFile)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read %s: %w", setupFile, err)
+		return nil, fmt.Errorf("%s: %w", setupFile, err)
+	}
+	// Check the fetched file before any of it is used, so a force-push
+	// upstream cannot change what gets applied
+	if err := pins.verify(rawURL, content); err != nil {
+		return nil, err
+	}
+	source, err := blueprintSource(setupFile, content)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", setupFile, err)
 	}
 	baseDir := filepath.Dir(setupFile)
-	return parseContent(string(content), baseDir, loadedFiles)
+	rules, err := parsePinnedContent(source, baseDir, includes, pins)
+	return setSourceFile(rules, setupFile), err
 }
 
 func ParseInstallRule(line string) (*Rule, error) {
 	f := parseFields(strings.TrimPrefix(line, "install "))
 	packageManager := f.word("package-manager:")
+	if packageManager == "" {
+		packageManager = f.word("pm:")
+	}
 	stage := f.word("stage:")
 	packageNames := f.tokens
 	pkgs := make([]Package, len(packageNames))
 	for i, pkg := range packageNames {
 		pkgs[i] = Package{Name: pkg, Version: "latest", PackageManager: packageManager, Stage: stage}
 	}
+	if err := parseOSNames(f, pkgs); err != nil {
+		return nil, lineError(line, err.Error())
+	}
 	return &Rule{
 		ID:       f.word("id:"),
 		Action:   "install",
@@ -406,6 +795,64 @@ func ParseInstallRule(line string) (*Rule, error) {
 	}, nil
 }
 
+// parseOSNames applies the per-OS package name overrides of an install rule:
+// "<os>-name: <name>" for a single-package rule, and
+// "map: [<os>=<name>, <os>:<package>=<name>]" for any rule.
+func parseOSNames(f lineFields, pkgs []Package) error {
+	set := func(pkg *Package, osName, name string) {
+		if pkg.OSNames == nil {
+			pkg.OSNames = map[string]string{}
+		}
+		pkg.OSNames[osName] = name
+	}
+
+	for key := range f.kv {
+		osName, ok := strings.CutSuffix(key, "-name:")
+		if !ok || osName == "" {
+			continue
+		}
+		name := f.word(key)
+		if name == "" {
+			return fmt.Errorf("%s requires a package name", key)
+		}
+		if len(pkgs) != 1 {
+			return fmt.Errorf("%s needs exactly one package; use map: [%s:<package>=<name>] instead", key, osName)
+		}
+		set(&pkgs[0], osName, name)
+	}
+
+	for _, item := range f.list("map:") {
+		target, name, ok := strings.Cut(item, "=")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" {
+			return fmt.Errorf("invalid map: entry %q: expected <os>=<name> or <os>:<package>=<name>", item)
+		}
+		osName, pkgName, qualified := strings.Cut(strings.TrimSpace(target), ":")
+		if !qualified {
+			if len(pkgs) != 1 {
+				return fmt.Errorf("map: entry %q must name the package (<os>:<package>=<name>) when installing several", item)
+			}
+			set(&pkgs[0], osName, name)
+			continue
+		}
+		found := false
+		for i := range pkgs {
+			if pkgs[i].Name == pkgName {
+				set(&pkgs[i], osName, name)
+				found = true
+			}
+		}
+		if !found {
+			return fmt.Errorf("map: entry %q refers to %q, which this rule does not install", item, pkgName)
+		}
+	}
+	return nil
+}
+
+// DefaultCloneBlueprint is the blueprint a clone rule with apply: true
+// applies from the root of the repository it cloned.
+const DefaultCloneBlueprint = ".blueprint.bp"
+
 func ParseCloneRule(line string) (*Rule, error) {
 	f := parseFields(strings.TrimPrefix(line, "clone "))
 	tokens := f.tokens
@@ -417,6 +864,16 @@ func ParseCloneRule(line string) (*Rule, error) {
 	if clonePath == "" {
 		return nil, lineError(line, "clone requires to:")
 	}
+	apply := f.word("apply:")
+	switch apply {
+	case "true":
+		apply = DefaultCloneBlueprint
+	case "false":
+		apply = ""
+	}
+	if apply != "" && !filepath.IsLocal(apply) {
+		return nil, lineError(line, "apply: must be a path inside the repository")
+	}
 	id := f.word("id:")
 	if id == "" {
 		id = "clone-" + cloneURL
@@ -428,6 +885,8 @@ func ParseCloneRule(line string) (*Rule, error) {
 		ClonePath:    clonePath,
 		Branch:       f.word("branch:"),
 		CloneWorkdir: f.word("workdir:") == "true",
+		CloneApply:   apply,
+		CloneReplace: f.word("replace:") == "true",
 		OSList:       f.osFilter,
 		After:        f.list("after:"),
 	}, nil
@@ -502,6 +961,89 @@ func ParseOllamaRule(line string) (*Rule, error) {
 	}, nil
 }
 
+// ParseMasRule parses "mas install <app>..." where each app is an App Store
+// ID or an app name; the install keyword may be left out.
+func ParseMasRule(line string) (*Rule, error) {
+	f := parseFields(strings.TrimPrefix(line, "mas "))
+	apps := f.tokens
+	if len(apps) > 0 && apps[0] == "install" {
+		apps = apps[1:]
+	}
+	if len(apps) == 0 {
+		return nil, lineError(line, "mas requires an App Store app ID or name")
+	}
+	id := f.word("id:")
+	if id == "" {
+		id = "mas-" + apps[0]
+	}
+	return &Rule{
+		ID:      id,
+		Action:  "mas",
+		OSList:  f.osFilter,
+		After:   f.list("after:"),
+		MasApps: apps,
+	}, nil
+}
+
+// ParseDevcertRule parses "devcert <name>... [via: mkcert|builtin]
+// [cert: <path>] [key: <path>]".
+func ParseDevcertRule(line string) (*Rule, error) {
+	f := parseFields(strings.TrimPrefix(line, "devcert "))
+	if len(f.tokens) == 0 {
+		return nil, lineError(line, "devcert requires a host name")
+	}
+	via := f.word("via:")
+	switch via {
+	case "", "mkcert", "builtin":
+	default:
+		return nil, lineError(line, fmt.Sprintf("unknown devcert via: %q (use mkcert or builtin)", via))
+	}
+	id := f.word("id:")
+	if id == "" {
+		id = "devcert-" + f.tokens[0]
+	}
+	return &Rule{
+		ID:           id,
+		Action:       "devcert",
+		OSList:       f.osFilter,
+		After:        f.list("after:"),
+		DevcertNames: f.tokens,
+		DevcertVia:   via,
+		DevcertCert:  f.word("cert:"),
+		DevcertKey:   f.word("key:"),
+	}, nil
+}
+
+// ParsePPARule parses "ppa ppa:<owner>/<name> [fingerprint: <fpr>]". The
+// ppa: prefix is optional.
+func ParsePPARule(line string) (*Rule, error) {
+	f := parseFields(strings.TrimPrefix(line, "ppa "))
+	if len(f.tokens) != 1 {
+		return nil, lineError(line, "ppa requires one PPA, as ppa:<owner>/<name>")
+	}
+	ppa := strings.TrimPrefix(f.tokens[0], "ppa:")
+	owner, name, ok := strings.Cut(ppa, "/")
+	if !ok || owner == "" || name == "" || strings.ContainsAny(name, "/") {
+		return nil, lineError(line, fmt.Sprintf("invalid PPA %q: expected ppa:<owner>/<name>", f.tokens[0]))
+	}
+	fingerprint, err := parseFingerprint(f.multiword("fingerprint:"))
+	if err != nil {
+		return nil, lineError(line, err.Error())
+	}
+	id := f.word("id:")
+	if id == "" {
+		id = "ppa-" + owner + "-" + name
+	}
+	return &Rule{
+		ID:             id,
+		Action:         "ppa",
+		OSList:         f.osFilter,
+		After:          f.list("after:"),
+		PPA:            ppa,
+		PPAFingerprint: fingerprint,
+	}, nil
+}
+
 func ParseDecryptRule(line string) (*Rule, error) {
 	f := parseFields(strings.TrimPrefix(line, "decrypt "))
 	tokens := f.tokens
@@ -531,16 +1073,36 @@ func ParseKnownHostsRule(line string) (*Rule, error) {
 	if len(tokens) == 0 {
 		return nil, lineError(line, "known_hosts requires a hostname")
 	}
+	pubkey := strings.Trim(f.multiword("pubkey:"), `"'`)
+	if pubkey != "" {
+		if err := checkSSHPublicKey(pubkey); err != nil {
+			return nil, lineError(line, err.Error())
+		}
+	}
 	return &Rule{
-		ID:            f.word("id:"),
-		Action:        "known_hosts",
-		KnownHosts:    tokens[0],
-		KnownHostsKey: f.word("key:"),
-		OSList:        f.osFilter,
-		After:         f.list("after:"),
+		ID:               f.word("id:"),
+		Action:           "known_hosts",
+		KnownHosts:       tokens[0],
+		KnownHostsKey:    f.word("key:"),
+		KnownHostsPubkey: pubkey,
+		OSList:           f.osFilter,
+		After:            f.list("after:"),
 	}, nil
 }
 
+// checkSSHPublicKey checks that key reads like an SSH public key line:
+// a key type such as ssh-ed25519 followed by the base64 key data.
+func checkSSHPublicKey(key string) error {
+	parts := strings.Fields(key)
+	if len(parts) < 2 || !(strings.HasPrefix(parts[0], "ssh-") || strings.HasPrefix(parts[0], "ecdsa-") || strings.HasPrefix(parts[0], "sk-")) {
+		return fmt.Errorf("pubkey: must be a key type and key, such as \"ssh-ed25519 AAAA...\"")
+	}
+	if _, err := base64.StdEncoding.DecodeString(parts[1]); err != nil {
+		return fmt.Errorf("pubkey: key data is not valid base64")
+	}
+	return nil
+}
+
 func ParseMkdirRule(line string) (*Rule, error) {
 	f := parseFields(strings.TrimPrefix(line, "mkdir "))
 	tokens := f.tokens
@@ -578,14 +1140,74 @@ func ParseGPGKeyRule(line string) (*Rule, error) {
 	if debURL == "" {
 		return nil, lineError(line, "gpg_key requires deb-url:")
 	}
+	fingerprint, err := parseFingerprint(f.multiword("fingerprint:"))
+	if err != nil {
+		return nil, lineError(line, err.Error())
+	}
 	return &Rule{
-		ID:         f.word("id:"),
-		Action:     "gpg_key",
-		GPGKeyURL:  gpgKeyURL,
-		GPGKeyring: keyring,
-		GPGDebURL:  debURL,
-		OSList:     f.osFilter,
-		After:      f.list("after:"),
+		ID:                f.word("id:"),
+		Action:            "gpg_key",
+		GPGKeyURL:         gpgKeyURL,
+		GPGKeyring:        keyring,
+		GPGDebURL:         debURL,
+		GPGKeyFingerprint: fingerprint,
+		OSList:            f.osFilter,
+		After:             f.list("after:"),
+	}, nil
+}
+
+// parseFingerprint normalizes a fingerprint: value, which may be written in
+// groups of four like gpg prints it, to upper-case hex without spaces. An
+// empty value means no fingerprint was given.
+func parseFingerprint(value string) (string, error) {
+	fpr := strings.ToUpper(strings.TrimPrefix(strings.ReplaceAll(value, " ", ""), "0x"))
+	if fpr == "" {
+		return "", nil
+	}
+	if len(fpr) != 40 && len(fpr) != 64 {
+		return "", fmt.Errorf("fingerprint: must be the 40 (or 64 for v5 keys) hex digit key fingerprint, got %q", value)
+	}
+	for _, c := range fpr {
+		if !strings.ContainsRune("0123456789ABCDEF", c) {
+			return "", fmt.Errorf("fingerprint: must be hexadecimal, got %q", value)
+		}
+	}
+	return fpr, nil
+}
+
+func ParseRepoRule(line string) (*Rule, error) {
+	f := parseFields(strings.TrimPrefix(line, "repo "))
+	if len(f.tokens) == 0 {
+		return nil, lineError(line, "repo requires a name")
+	}
+	repoURL := f.word("url:")
+	if repoURL == "" {
+		return nil, lineError(line, "repo requires url:")
+	}
+	keyURL := f.word("key:")
+	if keyURL == "" {
+		return nil, lineError(line, "repo requires key:")
+	}
+	repoType := f.word("type:")
+	if repoType != "" && repoType != "apt" && repoType != "dnf" {
+		return nil, lineError(line, fmt.Sprintf("repo type: must be apt or dnf, got %q", repoType))
+	}
+	fingerprint, err := parseFingerprint(f.multiword("fingerprint:"))
+	if err != nil {
+		return nil, lineError(line, err.Error())
+	}
+	return &Rule{
+		ID:                 f.word("id:"),
+		Action:             "repo",
+		RepoName:           f.tokens[0],
+		RepoURL:            repoURL,
+		RepoKeyURL:         keyURL,
+		RepoKeyFingerprint: fingerprint,
+		RepoType:           repoType,
+		RepoSuite:          f.word("suite:"),
+		RepoComponents:     f.list("components:"),
+		OSList:             f.osFilter,
+		After:              f.list("after:"),
 	}, nil
 }
 
@@ -614,22 +1236,33 @@ func ParseDownloadRule(line string) (*Rule, error) {
 
 func ParseRunRule(line string) (*Rule, error) {
 	f := parseFields(strings.TrimPrefix(line, "run "))
-	runCommand := f.rest()
+	runCommand := unquoteCommand(f.rest())
 	if runCommand == "" {
 		return nil, lineError(line, "run requires a command")
 	}
 	return &Rule{
-		ID:         f.word("id:"),
-		Action:     "run",
-		RunCommand: runCommand,
-		RunUnless:  f.multiword("unless:"),
-		RunUndo:    f.multiword("undo:"),
-		RunSudo:    f.word("sudo:") == "true",
-		OSList:     f.osFilter,
-		After:      f.list("after:"),
+		ID:          f.word("id:"),
+		Action:      "run",
+		RunCommand:  runCommand,
+		RunUnless:   f.multiword("unless:"),
+		RunUndo:     f.multiword("undo:"),
+		RunSudo:     f.word("sudo:") == "true",
+		RunCleanEnv: f.word("clean-env:") == "true",
+		RunCreates:  f.word("creates:"),
+		OSList:      f.osFilter,
+		After:       f.list("after:"),
 	}, nil
 }
 
+// unquoteCommand strips the double quotes around a run command written as
+// run "<command>". Quotes that only open or close part of it are kept.
+func unquoteCommand(cmd string) string {
+	if len(cmd) >= 2 && strings.HasPrefix(cmd, `"`) && strings.HasSuffix(cmd, `"`) && !strings.Contains(cmd[1:len(cmd)-1], `"`) {
+		return cmd[1 : len(cmd)-1]
+	}
+	return cmd
+}
+
 func ParseRunShRule(line string) (*Rule, error) {
 	f := parseFields(strings.TrimPrefix(line, "run-sh "))
 	tokens := f.tokens
@@ -637,14 +1270,16 @@ func ParseRunShRule(line string) (*Rule, error) {
 		return nil, lineError(line, "run-sh requires a URL")
 	}
 	return &Rule{
-		ID:        f.word("id:"),
-		Action:    "run-sh",
-		RunShURL:  tokens[0],
-		RunUnless: f.multiword("unless:"),
-		RunUndo:   f.multiword("undo:"),
-		RunSudo:   f.word("sudo:") == "true",
-		OSList:    f.osFilter,
-		After:     f.list("after:"),
+		ID:          f.word("id:"),
+		Action:      "run-sh",
+		RunShURL:    tokens[0],
+		RunUnless:   f.multiword("unless:"),
+		RunUndo:     f.multiword("undo:"),
+		RunSudo:     f.word("sudo:") == "true",
+		RunCleanEnv: f.word("clean-env:") == "true",
+		RunCreates:  f.word("creates:"),
+		OSList:      f.osFilter,
+		After:       f.list("after:"),
 	}, nil
 }
 
@@ -681,6 +1316,10 @@ func ParseDotfilesRule(line string) (*Rule, error) {
 func ParseMiseRule(line string) (*Rule, error) {
 	f := parseFields(strings.TrimPrefix(strings.TrimPrefix(line, "mise"), " "))
 	misePackages := f.tokens
+	// "mise install node@20" reads like the mise command line it runs
+	if len(misePackages) > 0 && misePackages[0] == "install" {
+		misePackages = misePackages[1:]
+	}
 	id := f.word("id:")
 	if id == "" {
 		if len(misePackages) > 0 {
@@ -747,6 +1386,32 @@ func ParseScheduleRule(line string) (*Rule, error) {
 	}, nil
 }
 
+// ParseStateBackupRule parses "state-backup every: <preset> to: <dir>" lines.
+// every: defaults to weekly.
+func ParseStateBackupRule(line string) (*Rule, error) {
+	f := parseFields(strings.TrimPrefix(line, "state-backup "))
+	to := f.word("to:")
+	if to == "" {
+		return nil, lineError(line, "state-backup requires to: <directory>")
+	}
+	every := f.word("every:")
+	switch every {
+	case "":
+		every = "weekly"
+	case "daily", "weekly", "hourly":
+	default:
+		return nil, lineError(line, fmt.Sprintf("state-backup every: must be daily, weekly or hourly, got %q", every))
+	}
+	return &Rule{
+		ID:               f.word("id:"),
+		Action:           "state-backup",
+		OSList:           f.osFilter,
+		After:            f.list("after:"),
+		StateBackupEvery: every,
+		StateBackupTo:    to,
+	}, nil
+}
+
 func ParseShellRule(line string) (*Rule, error) {
 	f := parseFields(strings.TrimPrefix(line, "shell "))
 	tokens := f.tokens
@@ -767,6 +1432,140 @@ func ParseShellRule(line string) (*Rule, error) {
 	}, nil
 }
 
+// dockerImagePattern matches image references: an optional registry host
+// and port, a lowercase repository path, and an optional tag or digest.
+var dockerImagePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9._/-]*(:[0-9]+/[a-z0-9._/-]+)?(:[A-Za-z0-9_][A-Za-z0-9_.-]*)?(@sha256:[a-f0-9]{64})?$`)
+
+// ParseDockerRule parses "docker [pull] <image>...".
+func ParseDockerRule(line string) (*Rule, error) {
+	f := parseFields(strings.TrimPrefix(line, "docker"))
+	images := f.tokens
+	// "docker pull postgres:16" reads like the docker command line it runs
+	if len(images) > 0 && images[0] == "pull" {
+		images = images[1:]
+	}
+	if len(images) == 0 {
+		return nil, lineError(line, "docker requires an image")
+	}
+	for _, image := range images {
+		if !dockerImagePattern.MatchString(image) {
+			return nil, lineError(line, fmt.Sprintf("invalid docker image %q", image))
+		}
+	}
+	id := f.word("id:")
+	if id == "" {
+		id = "docker-" + images[0]
+	}
+	return &Rule{
+		ID:           id,
+		Action:       "docker",
+		OSList:       f.osFilter,
+		After:        f.list("after:"),
+		DockerImages: images,
+	}, nil
+}
+
+// ParseAutostartRule parses "autostart <name> exec: <command>". A name with
+// spaces is written in double quotes: autostart "Google Drive" exec: ...
+func ParseAutostartRule(line string) (*Rule, error) {
+	body := strings.TrimSpace(strings.TrimPrefix(line, "autostart"))
+	var name string
+	if strings.HasPrefix(body, `"`) {
+		end := strings.Index(body[1:], `"`)
+		if end < 0 {
+			return nil, lineError(line, "unterminated quote in autostart name")
+		}
+		name, body = strings.TrimSpace(body[1:end+1]), body[end+2:]
+	}
+	f := parseFields(body)
+	if name == "" {
+		if len(f.tokens) != 1 {
+			return nil, lineError(line, "autostart requires one name; quote a name with spaces")
+		}
+		name = f.tokens[0]
+	} else if len(f.tokens) > 0 {
+		return nil, lineError(line, fmt.Sprintf("unexpected %q after the autostart name", f.rest()))
+	}
+	command := f.multiword("exec:")
+	if command == "" {
+		return nil, lineError(line, "autostart requires exec: <command>")
+	}
+	id := f.word("id:")
+	if id == "" {
+		id = "autostart-" + AutostartSlug(name)
+	}
+	return &Rule{
+		ID:            id,
+		Action:        "autostart",
+		OSList:        f.osFilter,
+		After:         f.list("after:"),
+		AutostartName: name,
+		AutostartExec: command,
+	}, nil
+}
+
+// AutostartSlug returns the file name form of a login item name: lowercase
+// letters and digits, with dashes for anything else.
+func AutostartSlug(name string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(name) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			b.WriteRune(r)
+			dash = false
+		} else if !dash && b.Len() > 0 {
+			b.WriteByte('-')
+			dash = true
+		}
+	}
+	return strings.TrimSuffix(b.String(), "-")
+}
+
+// serviceNamePattern matches systemd unit names and launchd labels.
+var serviceNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9@._:-]*$`)
+
+// ParseServiceRule parses "service <name> [state: enabled|started]
+// [scope: user|system]".
+func ParseServiceRule(line string) (*Rule, error) {
+	f := parseFields(strings.TrimPrefix(line, "service"))
+	if len(f.tokens) != 1 {
+		return nil, lineError(line, "service requires one service name")
+	}
+	name := f.tokens[0]
+	if !serviceNamePattern.MatchString(name) {
+		return nil, lineError(line, fmt.Sprintf("invalid service name %q", name))
+	}
+	state := f.word("state:")
+	switch state {
+	case "":
+		state = "enabled"
+	case "enabled", "started":
+	default:
+		return nil, lineError(line, fmt.Sprintf("unknown service state: %q (use enabled or started)", state))
+	}
+	scope := f.word("scope:")
+	switch scope {
+	case "":
+		scope = "system"
+	case "system", "user":
+	default:
+		return nil, lineError(line, fmt.Sprintf("unknown service scope: %q (use system or user)", scope))
+	}
+	id := f.word("id:")
+	if id == "" {
+		id = "service-" + name
+	}
+	return &Rule{
+		ID:           id,
+		Action:       "service",
+		OSList:       f.osFilter,
+		After:        f.list("after:"),
+		ServiceName:  name,
+		ServiceState: state,
+		ServiceScope: scope,
+	}, nil
+}
+
 func ParseAuthorizedKeysRule(line string) (*Rule, error) {
 	f := parseFields(strings.TrimPrefix(line, "authorized_keys "))
 	fileVal := f.word("file:")
@@ -786,8 +1585,9 @@ func ParseAuthorizedKeysRule(line string) (*Rule, error) {
 	}, nil
 }
 
-// ParseVarRule parses "var NAME [default]" lines.
-// If no default is provided the variable is required at render time.
+// ParseVarRule parses "var NAME [default]" lines, also written
+// "var NAME = default". If no default is provided the variable is required
+// at render time.
 // ParseRenderRule parses a render action line.
 // Syntax: render <template> [output: <path>] [var: KEY=VALUE ...]
 // template may be a local path or @github: shorthand.
@@ -815,6 +1615,10 @@ func ParseRenderRule(line string) (*Rule, error) {
 
 func ParseVarRule(line string) (*Rule, error) {
 	rest := strings.TrimPrefix(line, "var ")
+	// "var NAME = value" and "var NAME=value" read the same as "var NAME value"
+	if name, value, ok := strings.Cut(rest, "="); ok && !strings.ContainsAny(strings.TrimSpace(name), " \t") {
+		rest = strings.TrimSpace(name) + " " + value
+	}
 	tokens := strings.Fields(rest)
 	if len(tokens) == 0 {
 		return nil, lineError(line, "var requires a variable name")
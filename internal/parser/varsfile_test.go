@@ -0,0 +1,59 @@
+package parser
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseVarsFile(t *testing.T) {
+	vars, err := ParseVarsFile([]byte(`# this laptop
+workspace = "~/work"   # where code lives
+email = 'me@example.com'
+quoted = "tab\tand \"quotes\""
+jobs = 8
+gpu = false
+tools = ["ripgrep", 'fd', "jq",]
+"odd key" = "x"
+
+[host]
+name = "laptop"
+`))
+	if err != nil {
+		t.Fatalf("ParseVarsFile() error: %v", err)
+	}
+	want := map[string]string{
+		"workspace": "~/work",
+		"email":     "me@example.com",
+		"quoted":    "tab\tand \"quotes\"",
+		"jobs":      "8",
+		"gpu":       "false",
+		"tools":     "ripgrep fd jq",
+		"odd key":   "x",
+		"host.name": "laptop",
+	}
+	if len(vars) != len(want) {
+		t.Errorf("ParseVarsFile() = %v, want %v", vars, want)
+	}
+	for k, v := range want {
+		if vars[k] != v {
+			t.Errorf("vars[%q] = %q, want %q", k, vars[k], v)
+		}
+	}
+}
+
+func TestParseVarsFileErrors(t *testing.T) {
+	for _, content := range []string{
+		"a = 1\nname\n",
+		"a = 1\nname = \"unterminated\n",
+		"a = 1\nname = two words\n",
+		"a = 1\n[host\n",
+		"a = 1\n[[hosts]]\n",
+		"a = 1\ntools = [\n",
+		"a = 1\nnotes = \"\"\"\n",
+		"a = 1\nname =\n",
+	} {
+		if _, err := ParseVarsFile([]byte(content)); err == nil || !strings.Contains(err.Error(), "line 2") {
+			t.Errorf("ParseVarsFile(%q) error = %v, want a line 2 error", content, err)
+		}
+	}
+}
@@ -0,0 +1,475 @@
+package parser
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// A YAML blueprint is a list of rules, at the top level or under "rules:".
+// Each rule is a mapping whose first key is the directive and whose other
+// keys are its attributes:
+//
+//	rules:
+//	  - install: [git, curl]
+//	    on: [linux]
+//	  - clone: https://github.com/elpic/dotfiles.git
+//	    to: ~/dotfiles
+//	    after: [git]
+//	  - include: work.yaml
+//
+// Each rule is turned into the line the DSL would have, placed on the line
+// number of its "-" so errors point into the YAML file, and parsed like any
+// other blueprint. The rules therefore mean exactly what they mean in a .bp
+// file. Only the part of YAML blueprints need is read: block mappings and
+// sequences, flow sequences ([a, b]), plain and quoted scalars, folded
+// scalars (>) and comments.
+
+// IsYAMLFile reports whether path is a YAML blueprint, by its extension.
+func IsYAMLFile(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	return ext == ".yaml" || ext == ".yml"
+}
+
+// blueprintSource returns the DSL text of a blueprint file's content,
+// converting YAML blueprints.
+func blueprintSource(path string, content []byte) (string, error) {
+	if !IsYAMLFile(path) {
+		return string(content), nil
+	}
+	return YAMLToDSL(string(content))
+}
+
+// yamlNode is a parsed YAML value: a scalar, a sequence or a mapping.
+type yamlNode struct {
+	line   int // 1-based line the value starts on
+	kind   byte
+	scalar string
+	items  []*yamlNode // sequence items
+	keys   []string    // mapping keys, in source order
+	values []*yamlNode // mapping values, matching keys
+}
+
+const (
+	yamlScalar   = 's'
+	yamlSequence = 'q'
+	yamlMapping  = 'm'
+)
+
+// yamlLine is a non-blank line with its comment removed.
+type yamlLine struct {
+	num    int
+	indent int
+	text   string
+	raw    string // the line as written, for folded scalars
+}
+
+// yamlParser reads yamlLines into yamlNodes.
+type yamlParser struct {
+	lines []yamlLine
+	pos   int
+}
+
+// YAMLToDSL converts a YAML blueprint to the equivalent DSL text, keeping
+// each rule on the line number of its item in the YAML file.
+func YAMLToDSL(content string) (string, error) {
+	p := &yamlParser{}
+	physical := strings.Split(content, "\n")
+	for i, raw := range physical {
+		raw = strings.TrimRight(raw, " \t\r")
+		if strings.HasPrefix(raw, "\t") {
+			return "", fmt.Errorf("line %d: YAML does not allow tabs for indentation", i+1)
+		}
+		text := strings.TrimRight(stripYAMLComment(raw), " ")
+		trimmed := strings.TrimSpace(text)
+		if trimmed == "" || trimmed == "---" {
+			// Blank lines still count for folded scalars
+			p.lines = append(p.lines, yamlLine{num: i + 1, indent: -1, raw: raw})
+			continue
+		}
+		p.lines = append(p.lines, yamlLine{num: i + 1, indent: len(text) - len(strings.TrimLeft(text, " ")), text: trimmed, raw: raw})
+	}
+
+	p.skipBlank()
+	if p.pos >= len(p.lines) {
+		return "", nil
+	}
+	root, err := p.parseBlock(p.lines[p.pos].indent)
+	if err != nil {
+		return "", err
+	}
+	if p.skipBlank(); p.pos < len(p.lines) {
+		return "", fmt.Errorf("line %d: unexpected indentation", p.lines[p.pos].num)
+	}
+
+	rules := root
+	if root.kind == yamlMapping {
+		rules = nil
+		for i, key := range root.keys {
+			if key != "rules" {
+				return "", fmt.Errorf("line %d: unknown top-level key %q (put rules under rules:)", root.values[i].line, key)
+			}
+			rules = root.values[i]
+		}
+	}
+	if rules == nil || rules.kind == yamlScalar && rules.scalar == "" {
+		return "", nil
+	}
+	if rules.kind != yamlSequence {
+		return "", fmt.Errorf("line %d: a YAML blueprint is a list of rules", rules.line)
+	}
+
+	out := make([]string, len(physical))
+	for _, item := range rules.items {
+		line, err := yamlRuleLine(item)
+		if err != nil {
+			return "", fmt.Errorf("line %d: %w", item.line, err)
+		}
+		out[item.line-1] = line
+	}
+	return strings.Join(out, "\n"), nil
+}
+
+// stripYAMLComment removes a # comment that starts the line or follows a
+// space, outside quotes.
+func stripYAMLComment(line string) string {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			if i == 0 || strings.ContainsRune(" [,:-", rune(line[i-1])) {
+				quote = c
+			}
+		case c == '#' && (i == 0 || line[i-1] == ' '):
+			return line[:i]
+		}
+	}
+	return line
+}
+
+// skipBlank moves past blank lines.
+func (p *yamlParser) skipBlank() {
+	for p.pos < len(p.lines) && p.lines[p.pos].indent < 0 {
+		p.pos++
+	}
+}
+
+// isSeqItem reports whether text starts a sequence item.
+func isSeqItem(text string) bool {
+	return text == "-" || strings.HasPrefix(text, "- ")
+}
+
+// parseBlock parses the sequence, mapping or scalar starting at the current
+// line, which is indented by indent.
+func (p *yamlParser) parseBlock(indent int) (*yamlNode, error) {
+	l := p.lines[p.pos]
+	if isSeqItem(l.text) {
+		return p.parseSequence(indent)
+	}
+	if _, _, ok := splitYAMLKey(l.text); ok {
+		return p.parseMapping(indent)
+	}
+	p.pos++
+	return parseYAMLScalar(l.text, l.num)
+}
+
+// parseSequence parses the "- " items indented by indent.
+func (p *yamlParser) parseSequence(indent int) (*yamlNode, error) {
+	node := &yamlNode{kind: yamlSequence, line: p.lines[p.pos].num}
+	for p.skipBlank(); p.pos < len(p.lines); p.skipBlank() {
+		l := p.lines[p.pos]
+		if l.indent < indent {
+			break
+		}
+		if l.indent > indent || !isSeqItem(l.text) {
+			return nil, fmt.Errorf("line %d: unexpected indentation", l.num)
+		}
+		content := strings.TrimSpace(strings.TrimPrefix(l.text, "-"))
+		if content == "" {
+			p.pos++
+			if p.skipBlank(); p.pos >= len(p.lines) || p.lines[p.pos].indent <= indent {
+				node.items = append(node.items, &yamlNode{kind: yamlScalar, line: l.num})
+				continue
+			}
+			item, err := p.parseBlock(p.lines[p.pos].indent)
+			if err != nil {
+				return nil, err
+			}
+			item.line = l.num
+			node.items = append(node.items, item)
+			continue
+		}
+		// The item's content continues as a block at the column it starts
+		// on: "- install: git" followed by "  on: [mac]"
+		p.lines[p.pos].indent = l.indent + len(l.text) - len(content)
+		p.lines[p.pos].text = content
+		item, err := p.parseBlock(p.lines[p.pos].indent)
+		if err != nil {
+			return nil, err
+		}
+		item.line = l.num
+		node.items = append(node.items, item)
+	}
+	return node, nil
+}
+
+// parseMapping parses the "key: value" pairs indented by indent.
+func (p *yamlParser) parseMapping(indent int) (*yamlNode, error) {
+	node := &yamlNode{kind: yamlMapping, line: p.lines[p.pos].num}
+	for p.skipBlank(); p.pos < len(p.lines); p.skipBlank() {
+		l := p.lines[p.pos]
+		if l.indent < indent || isSeqItem(l.text) && l.indent == indent {
+			break
+		}
+		key, rest, ok := splitYAMLKey(l.text)
+		if l.indent > indent || !ok {
+			return nil, fmt.Errorf("line %d: expected \"key: value\"", l.num)
+		}
+		for _, k := range node.keys {
+			if k == key {
+				return nil, fmt.Errorf("line %d: duplicate key %q", l.num, key)
+			}
+		}
+		p.pos++
+
+		var value *yamlNode
+		var err error
+		switch {
+		case rest == ">" || rest == ">-":
+			value = p.parseFolded(indent, l.num)
+		case rest == "|" || rest == "|-":
+			return nil, fmt.Errorf("line %d: literal block scalars (|) are not supported; use > to fold lines", l.num)
+		case rest != "":
+			value, err = parseYAMLScalar(rest, l.num)
+		default:
+			// The value is the block below the key: indented further, or a
+			// sequence at the key's own indentation
+			p.skipBlank()
+			if p.pos < len(p.lines) && (p.lines[p.pos].indent > indent || p.lines[p.pos].indent == indent && isSeqItem(p.lines[p.pos].text)) {
+				value, err = p.parseBlock(p.lines[p.pos].indent)
+			} else {
+				value = &yamlNode{kind: yamlScalar, line: l.num}
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+		node.keys = append(node.keys, key)
+		node.values = append(node.values, value)
+	}
+	return node, nil
+}
+
+// parseFolded reads the lines of a ">" scalar, indented past indent, and
+// joins them with spaces.
+func (p *yamlParser) parseFolded(indent, num int) *yamlNode {
+	var words []string
+	for ; p.pos < len(p.lines); p.pos++ {
+		l := p.lines[p.pos]
+		if l.indent >= 0 && l.indent <= indent {
+			break
+		}
+		if s := strings.TrimSpace(l.raw); s != "" {
+			words = append(words, s)
+		}
+	}
+	return &yamlNode{kind: yamlScalar, line: num, scalar: strings.Join(words, " ")}
+}
+
+// splitYAMLKey splits "key: value" (or "key:") outside quotes.
+func splitYAMLKey(text string) (key, rest string, ok bool) {
+	if text == "" || text[0] == '"' || text[0] == '\'' || text[0] == '[' || text[0] == '{' {
+		return "", "", false
+	}
+	for i := 0; i < len(text); i++ {
+		if text[i] == ':' && (i+1 == len(text) || text[i+1] == ' ') {
+			return strings.TrimSpace(text[:i]), strings.TrimSpace(text[i+1:]), true
+		}
+	}
+	return "", "", false
+}
+
+// parseYAMLScalar parses an inline value: a flow sequence, a flow mapping
+// or a scalar.
+func parseYAMLScalar(text string, num int) (*yamlNode, error) {
+	switch {
+	case strings.HasPrefix(text, "["):
+		if !strings.HasSuffix(text, "]") {
+			return nil, fmt.Errorf("line %d: unterminated [", num)
+		}
+		node := &yamlNode{kind: yamlSequence, line: num}
+		for _, item := range splitFlow(text[1 : len(text)-1]) {
+			v, err := unquoteYAML(item, num)
+			if err != nil {
+				return nil, err
+			}
+			node.items = append(node.items, &yamlNode{kind: yamlScalar, line: num, scalar: v})
+		}
+		return node, nil
+	case strings.HasPrefix(text, "{"):
+		if !strings.HasSuffix(text, "}") {
+			return nil, fmt.Errorf("line %d: unterminated {", num)
+		}
+		node := &yamlNode{kind: yamlMapping, line: num}
+		for _, item := range splitFlow(text[1 : len(text)-1]) {
+			key, rest, ok := splitYAMLKey(item)
+			if !ok {
+				return nil, fmt.Errorf("line %d: expected \"key: value\" in {}, got %q", num, item)
+			}
+			v, err := unquoteYAML(rest, num)
+			if err != nil {
+				return nil, err
+			}
+			node.keys = append(node.keys, key)
+			node.values = append(node.values, &yamlNode{kind: yamlScalar, line: num, scalar: v})
+		}
+		return node, nil
+	}
+	v, err := unquoteYAML(text, num)
+	return &yamlNode{kind: yamlScalar, line: num, scalar: v}, err
+}
+
+// splitFlow splits the inside of [] or {} on commas outside quotes.
+func splitFlow(s string) []string {
+	var parts []string
+	var quote byte
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == ',':
+			parts = append(parts, strings.TrimSpace(s[start:i]))
+			start = i + 1
+		}
+	}
+	if last := strings.TrimSpace(s[start:]); last != "" || len(parts) > 0 {
+		parts = append(parts, last)
+	}
+	return parts
+}
+
+// unquoteYAML returns the value of a plain, 'single' or "double" quoted scalar.
+func unquoteYAML(s string, num int) (string, error) {
+	if len(s) >= 2 && s[0] == '\'' && s[len(s)-1] == '\'' {
+		return strings.ReplaceAll(s[1:len(s)-1], "''", "'"), nil
+	}
+	if len(s) >= 2 && s[0] == '"' && s[len(s)-1] == '"' {
+		r := strings.NewReplacer(`\\`, `\`, `\"`, `"`, `\t`, "\t")
+		return r.Replace(s[1 : len(s)-1]), nil
+	}
+	if strings.HasPrefix(s, "'") || strings.HasPrefix(s, "\"") {
+		return "", fmt.Errorf("line %d: unterminated quote", num)
+	}
+	if s == "~" || s == "null" {
+		return "", nil
+	}
+	return s, nil
+}
+
+// yamlDirective returns the DSL directive for a rule's first key, accepting
+// "-" and "_" interchangeably (gpg-key and gpg_key).
+func yamlDirective(key string) (string, bool) {
+	norm := strings.ReplaceAll(key, "-", "_")
+	if norm == "include" {
+		return "include", true
+	}
+	for _, d := range Directives() {
+		if strings.ReplaceAll(d, "-", "_") == norm {
+			return d, true
+		}
+	}
+	return "", false
+}
+
+// yamlRuleLine renders one rule mapping as a DSL line.
+func yamlRuleLine(rule *yamlNode) (string, error) {
+	if rule.kind != yamlMapping || len(rule.keys) == 0 {
+		return "", fmt.Errorf("a rule is a mapping starting with its directive, e.g. \"- install: git\"")
+	}
+	directive, ok := yamlDirective(rule.keys[0])
+	if !ok {
+		return "", fmt.Errorf("unknown directive %q (the first key of a rule names it)", rule.keys[0])
+	}
+	body, err := yamlValue(rule.keys[0], rule.values[0], " ")
+	if err != nil {
+		return "", err
+	}
+	parts := []string{directive}
+	if body != "" {
+		parts = append(parts, body)
+	}
+
+	for i, key := range rule.keys[1:] {
+		attr := key + ":"
+		value, err := yamlAttrValue(attr, rule.values[i+1])
+		if err != nil {
+			return "", err
+		}
+		parts = append(parts, attr+" "+value)
+	}
+
+	line := strings.Join(parts, " ")
+	if stripComment(line) != line {
+		return "", fmt.Errorf("values cannot contain \" #\" or \" //\", which start a comment in a blueprint")
+	}
+	return line, nil
+}
+
+// yamlAttrValue renders an attribute's value the way the DSL writes it.
+func yamlAttrValue(attr string, v *yamlNode) (string, error) {
+	switch {
+	case bracketKeys[attr]:
+		s, err := yamlValue(attr, v, ", ")
+		return "[" + s + "]", err
+	case multiwordKeys[attr]:
+		return yamlValue(attr, v, ", ")
+	}
+	s, err := yamlValue(attr, v, ",")
+	if err != nil {
+		return "", err
+	}
+	if attr == "cron:" && strings.ContainsAny(s, " \t") {
+		return `"` + s + `"`, nil
+	}
+	if s == "" || strings.ContainsAny(s, " \t") {
+		return "", fmt.Errorf("%s takes a single word, got %q", attr, s)
+	}
+	return s, nil
+}
+
+// yamlValue joins a scalar, a sequence of scalars or a mapping (as
+// key=value items) with sep.
+func yamlValue(key string, v *yamlNode, sep string) (string, error) {
+	switch v.kind {
+	case yamlScalar:
+		return v.scalar, nil
+	case yamlSequence:
+		items := make([]string, 0, len(v.items))
+		for _, item := range v.items {
+			if item.kind != yamlScalar {
+				return "", fmt.Errorf("line %d: %s takes a list of plain values", item.line, key)
+			}
+			items = append(items, item.scalar)
+		}
+		return strings.Join(items, sep), nil
+	default:
+		items := make([]string, 0, len(v.keys))
+		for i, k := range v.keys {
+			if v.values[i].kind != yamlScalar {
+				return "", fmt.Errorf("line %d: %s takes key: value pairs of plain values", v.values[i].line, key)
+			}
+			items = append(items, k+"="+v.values[i].scalar)
+		}
+		return strings.Join(items, sep), nil
+	}
+}
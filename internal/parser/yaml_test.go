@@ -0,0 +1,140 @@
+package parser
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestParseFileYAML tests that a YAML blueprint parses to the same rules as
+// the equivalent DSL blueprint
+func TestParseFileYAML(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	write("extra.yml", "- mkdir: ~/extra\n")
+
+	yamlPath := write("setup.yaml", `# Workstation
+rules:
+  - install: [git, curl]
+    on: [linux, mac]
+    id: base
+
+  - clone: https://github.com/elpic/dotfiles.git
+    to: ~/dotfiles
+    branch: main
+    after: [base]
+  - decrypt: secrets/id_rsa.enc
+    to: ~/.ssh/id_rsa
+    password-id: ssh   # which password to ask for
+  - mkdir: ~/code
+    perms: "0750"
+  - asdf:
+      - nodejs@20.11.0
+      - python@3.12.1
+  - gpg-key: https://download.docker.com/linux/ubuntu/gpg
+    keyring: docker
+    deb-url: https://download.docker.com/linux/ubuntu
+  - known_hosts: github.com
+    key: ssh-ed25519
+  - run: >
+      echo one &&
+      echo two
+    unless: test -f ~/.done
+  - include: extra.yml
+`)
+	dslPath := write("setup.bp", `install git curl on: [linux, mac] id: base
+clone https://github.com/elpic/dotfiles.git to: ~/dotfiles branch: main after: base
+decrypt secrets/id_rsa.enc to: ~/.ssh/id_rsa password-id: ssh
+mkdir ~/code perms: 0750
+asdf nodejs@20.11.0 python@3.12.1
+gpg_key https://download.docker.com/linux/ubuntu/gpg keyring: docker deb-url: https://download.docker.com/linux/ubuntu
+known_hosts github.com key: ssh-ed25519
+run echo one && echo two unless: test -f ~/.done
+include extra.yml
+`)
+
+	got, err := ParseFile(yamlPath)
+	if err != nil {
+		t.Fatalf("ParseFile(yaml) error: %v", err)
+	}
+	want, err := ParseFile(dslPath)
+	if err != nil {
+		t.Fatalf("ParseFile(bp) error: %v", err)
+	}
+	// The two files place their rules on different lines
+	for _, rules := range [][]Rule{got, want} {
+		for i := range rules {
+			rules[i].SourceFile, rules[i].SourceLine = "", 0
+		}
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("YAML rules differ from DSL rules:\n got: %+v\nwant: %+v", got, want)
+	}
+}
+
+// TestYAMLToDSL tests the conversion of YAML forms and its errors
+func TestYAMLToDSL(t *testing.T) {
+	tests := []struct {
+		name    string
+		yaml    string
+		want    string // expected DSL, without blank lines
+		wantErr string
+	}{
+		{"top-level list", "- install: git\n- homebrew: [jq]\n", "install git\nhomebrew jq", ""},
+		{"sequence under key at same indent", "rules:\n- install: git\n  after:\n  - a\n  - b\n", "install git after: a, b", ""},
+		{"flow mapping", "- install: fd\n  map: {linux: fd-find}\n", "install fd map: [linux=fd-find]", ""},
+		{"comment after quoted value", "- run: 'echo a#1' # note\n", "run echo a#1", ""},
+		{"cron is quoted", "- schedule: daily\n  cron: 0 9 * * 1\n", `schedule daily cron: "0 9 * * 1"`, ""},
+		{"empty", "# nothing\n", "", ""},
+		{"unknown directive", "- frobnicate: x\n", "", `line 1: unknown directive "frobnicate"`},
+		{"single word attr", "- clone: https://x/y.git\n  to: my dir\n", "", "line 1: to: takes a single word"},
+		{"comment in value", "- run: echo a //b\n", "", "start a comment"},
+		{"literal block", "- run: |\n    echo\n", "", "literal block scalars"},
+		{"tabs", "-\tinstall: git\n\t  on: [mac]\n", "", "line 2: YAML does not allow tabs"},
+		{"other top-level key", "version: 1\nrules: []\n", "", `unknown top-level key "version"`},
+		{"bad indentation", "- install: git\n    on: [mac]\n", "", "line 2: expected"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := YAMLToDSL(tt.yaml)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("YAMLToDSL() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("YAMLToDSL() error: %v", err)
+			}
+			var lines []string
+			for _, l := range strings.Split(got, "\n") {
+				if l != "" {
+					lines = append(lines, l)
+				}
+			}
+			if strings.Join(lines, "\n") != tt.want {
+				t.Errorf("YAMLToDSL() = %q, want %q", strings.Join(lines, "\n"), tt.want)
+			}
+		})
+	}
+}
+
+// TestParseFileYAMLErrorLine tests that rule errors point at the YAML line
+func TestParseFileYAMLErrorLine(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "setup.yml")
+	if err := os.WriteFile(path, []byte("rules:\n  - install: git\n\n  - mas:\n    on: [mac]\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	_, err := ParseFile(path)
+	if err == nil || !strings.HasPrefix(err.Error(), "line 4:") {
+		t.Errorf("ParseFile() error = %v, want it on line 4", err)
+	}
+}
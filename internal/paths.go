@@ -0,0 +1,101 @@
+package internal
+
+import (
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// windowsHomeVars are the environment references to the home directory that
+// Windows users write at the start of a path.
+var windowsHomeVars = []string{"%USERPROFILE%", "%HOME%", "$env:USERPROFILE", "$HOME"}
+
+// PathKey returns the form of p used to store and compare local paths. On
+// Windows paths are case-insensitive and accept both separators, so the key
+// uses backslashes only, is lowercased (drive letter included) and has no
+// trailing separator. Elsewhere it is filepath.Clean(p).
+func PathKey(p string) string {
+	if runtimeOS != "windows" {
+		return filepath.Clean(p)
+	}
+	if p == "" {
+		return "."
+	}
+	p = strings.ToLower(strings.ReplaceAll(p, `\`, "/"))
+	// Keep the leading // of a UNC path (\\server\share), which path.Clean
+	// would collapse.
+	unc := strings.HasPrefix(p, "//")
+	p = path.Clean(p)
+	if unc && !strings.HasPrefix(p, "//") {
+		p = "/" + p
+	}
+	// A bare drive needs its root to stay absolute: c: means "current
+	// directory on c", c:\ the root of c.
+	if len(p) == 2 && p[1] == ':' {
+		p += "/"
+	}
+	return strings.ReplaceAll(p, "/", `\`)
+}
+
+// SamePath reports whether a and b name the same path, ignoring case and
+// separator differences on Windows.
+func SamePath(a, b string) bool {
+	return PathKey(a) == PathKey(b)
+}
+
+// HasPathPrefix reports whether p is dir or lies inside it. Unlike
+// strings.HasPrefix it only matches whole path elements, so /home/me does
+// not contain /home/meow.
+func HasPathPrefix(p, dir string) bool {
+	p, dir = PathKey(p), PathKey(dir)
+	if p == dir {
+		return true
+	}
+	sep := "/"
+	if runtimeOS == "windows" {
+		sep = `\`
+	}
+	return strings.HasPrefix(p, strings.TrimSuffix(dir, sep)+sep)
+}
+
+// ExpandHome replaces a leading ~ in p with home. On Windows it also expands
+// a leading %USERPROFILE% (or $HOME, as PowerShell users write it), matched
+// without regard to case. p is returned unchanged when home is empty.
+func ExpandHome(p, home string) string {
+	rest, ok := cutHome(p)
+	if !ok || home == "" {
+		return p
+	}
+	if rest == "" {
+		return home
+	}
+	return filepath.Join(home, rest)
+}
+
+// HasHomePrefix reports whether ExpandHome would expand p, so callers can
+// look up the home directory only when it is needed.
+func HasHomePrefix(p string) bool {
+	_, ok := cutHome(p)
+	return ok
+}
+
+// cutHome strips a leading home reference and the separator after it.
+func cutHome(p string) (string, bool) {
+	prefixes := []string{"~"}
+	if runtimeOS == "windows" {
+		prefixes = append(prefixes, windowsHomeVars...)
+	}
+	for _, prefix := range prefixes {
+		if len(p) < len(prefix) || !strings.EqualFold(p[:len(prefix)], prefix) {
+			continue
+		}
+		rest := p[len(prefix):]
+		if rest == "" {
+			return "", true
+		}
+		if rest[0] == '/' || (runtimeOS == "windows" && rest[0] == '\\') {
+			return rest[1:], true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,108 @@
+package internal
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestPathKeyWindows(t *testing.T) {
+	original := runtimeOS
+	defer func() { runtimeOS = original }()
+	runtimeOS = "windows"
+
+	tests := map[string]string{
+		`C:\Users\Me\setup.bp`:      `c:\users\me\setup.bp`,
+		`c:/Users/me/./dotfiles/`:   `c:\users\me\dotfiles`,
+		`C:\Users\me\..\Shared\bp`:  `c:\users\shared\bp`,
+		`C:`:                        `c:\`,
+		`\\Server\Share\setup.bp`:   `\\server\share\setup.bp`,
+		`relative\Path\..\setup.bp`: `relative\setup.bp`,
+	}
+	for in, want := range tests {
+		if got := PathKey(in); got != want {
+			t.Errorf("PathKey(%q) = %q, want %q", in, got, want)
+		}
+	}
+
+	if !SamePath(`C:\Users\Me\setup.bp`, `c:/users/me/SETUP.bp`) {
+		t.Error("SamePath() = false for paths differing in case and separators")
+	}
+}
+
+func TestPathKeyPOSIX(t *testing.T) {
+	original := runtimeOS
+	defer func() { runtimeOS = original }()
+	runtimeOS = "linux"
+
+	if got := PathKey("/home/Me/./setup.bp"); got != filepath.Clean("/home/Me/setup.bp") {
+		t.Errorf("PathKey() = %q", got)
+	}
+	if SamePath("/home/me/setup.bp", "/home/Me/setup.bp") {
+		t.Error("SamePath() = true for paths differing in case on a case-sensitive OS")
+	}
+}
+
+func TestHasPathPrefix(t *testing.T) {
+	original := runtimeOS
+	defer func() { runtimeOS = original }()
+
+	runtimeOS = "linux"
+	tests := []struct {
+		p, dir string
+		want   bool
+	}{
+		{"/home/me/.blueprint/status.json", "/home/me/.blueprint", true},
+		{"/home/me/.blueprint", "/home/me/.blueprint/", true},
+		{"/home/me/.blueprint-other/status.json", "/home/me/.blueprint", false},
+		{"/etc/passwd", "/home/me/.blueprint", false},
+		{"/anything", "/", true},
+	}
+	for _, tt := range tests {
+		if got := HasPathPrefix(tt.p, tt.dir); got != tt.want {
+			t.Errorf("HasPathPrefix(%q, %q) = %v, want %v", tt.p, tt.dir, got, tt.want)
+		}
+	}
+
+	runtimeOS = "windows"
+	if !HasPathPrefix(`c:/users/me/.blueprint/status.json`, `C:\Users\Me\.blueprint`) {
+		t.Error("HasPathPrefix() = false on Windows for a path differing in case and separators")
+	}
+	if HasPathPrefix(`D:\Users\Me\.blueprint\status.json`, `C:\Users\Me\.blueprint`) {
+		t.Error("HasPathPrefix() = true on Windows for a path on another drive")
+	}
+	if !HasPathPrefix(`C:\anything`, `C:\`) {
+		t.Error("HasPathPrefix() = false on Windows for a path under a drive root")
+	}
+}
+
+func TestExpandHome(t *testing.T) {
+	original := runtimeOS
+	defer func() { runtimeOS = original }()
+
+	runtimeOS = "linux"
+	tests := map[string]string{
+		"~":                    "/home/me",
+		"~/.config":            filepath.Join("/home/me", ".config"),
+		"~other/file":          "~other/file",
+		"%USERPROFILE%/.gitrc": "%USERPROFILE%/.gitrc",
+		"/etc/hosts":           "/etc/hosts",
+	}
+	for in, want := range tests {
+		if got := ExpandHome(in, "/home/me"); got != want {
+			t.Errorf("ExpandHome(%q) = %q, want %q", in, got, want)
+		}
+	}
+	if got := ExpandHome("~/x", ""); got != "~/x" {
+		t.Errorf("ExpandHome() without a home = %q, want it unchanged", got)
+	}
+
+	runtimeOS = "windows"
+	for _, in := range []string{`%USERPROFILE%\.gitconfig`, `%userprofile%/.gitconfig`, `$HOME\.gitconfig`, `~\.gitconfig`} {
+		if !HasHomePrefix(in) {
+			t.Errorf("HasHomePrefix(%q) = false on Windows", in)
+		}
+		if got := ExpandHome(in, "home"); got != filepath.Join("home", ".gitconfig") {
+			t.Errorf("ExpandHome(%q) = %q on Windows", in, got)
+		}
+	}
+}
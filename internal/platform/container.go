@@ -9,7 +9,6 @@ import (
 	"os/exec"
 	"os/user"
 	"path/filepath"
-	"runtime"
 	"strconv"
 	"strings"
 	"sync"
@@ -230,7 +229,7 @@ func (d *realOSDetector) Name() string {
 
 // Architecture returns the system architecture.
 func (d *realOSDetector) Architecture() string {
-	return runtime.GOARCH
+	return internal.ArchName()
 }
 
 // IsRoot returns true if running with root/admin privileges.
@@ -516,9 +515,9 @@ func (f *realFilesystemProvider) TempDirectory(prefix string) (string, error) {
 
 // ExpandPath expands ~ and environment variables in paths.
 func (f *realFilesystemProvider) ExpandPath(path string) string {
-	if strings.HasPrefix(path, "~/") {
+	if internal.HasHomePrefix(path) {
 		if currentUser, err := user.Current(); err == nil {
-			path = filepath.Join(currentUser.HomeDir, path[2:])
+			path = internal.ExpandHome(path, currentUser.HomeDir)
 		}
 	}
 	return os.ExpandEnv(path)
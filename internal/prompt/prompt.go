@@ -0,0 +1,158 @@
+// Package prompt asks the user questions on the terminal: yes/no
+// confirmations and free-form values, each with a default answer.
+//
+// Every command that needs input goes through here so they all behave the
+// same way when stdin is not a terminal (CI, pipes) or when --yes was given:
+// instead of blocking on a read, the default answer is taken.
+package prompt
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"golang.org/x/term"
+
+	"github.com/elpic/blueprint/internal/ui"
+)
+
+// ErrNoInput is returned when a value is required but none can be obtained:
+// stdin is not interactive (or --yes was given) and there is no default.
+var ErrNoInput = errors.New("input required but no terminal is available")
+
+// Prompter reads answers from In and writes questions to Out.
+type Prompter struct {
+	In          *bufio.Reader
+	Out         io.Writer
+	Interactive bool // false when In is not a terminal; defaults are used without asking
+	AssumeYes   bool // --yes: confirmations are accepted and defaults taken without asking
+}
+
+// New returns a Prompter reading from in and writing to out. Interactive is
+// set when in is a terminal.
+func New(in *os.File, out io.Writer) *Prompter {
+	return &Prompter{
+		In:          bufio.NewReader(in),
+		Out:         out,
+		Interactive: term.IsTerminal(int(in.Fd())),
+	}
+}
+
+var (
+	defaultMu       sync.Mutex
+	defaultPrompter *Prompter
+	assumeYes       bool
+)
+
+// Default returns the process-wide Prompter on stdin/stderr. Questions go to
+// stderr so they never mix into output meant for redirection.
+func Default() *Prompter {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+	if defaultPrompter == nil {
+		defaultPrompter = New(os.Stdin, os.Stderr)
+	}
+	defaultPrompter.AssumeYes = assumeYes
+	return defaultPrompter
+}
+
+// SetAssumeYes makes every prompt take its default (and every confirmation
+// succeed) without asking. Set from the --yes flag.
+func SetAssumeYes(yes bool) {
+	defaultMu.Lock()
+	assumeYes = yes
+	defaultMu.Unlock()
+}
+
+// Confirm asks the default Prompter a yes/no question.
+func Confirm(question string, def bool) (bool, error) {
+	return Default().Confirm(question, def)
+}
+
+// Input asks the default Prompter for a value.
+func Input(label, def string, required bool) (string, error) {
+	return Default().Input(label, def, required)
+}
+
+// Confirm asks a yes/no question and returns the answer. An empty answer
+// selects def. With AssumeYes the answer is always yes; when not interactive
+// def is returned without asking.
+func (p *Prompter) Confirm(question string, def bool) (bool, error) {
+	if p.AssumeYes {
+		return true, nil
+	}
+	if !p.Interactive {
+		return def, nil
+	}
+
+	choices := "[y/N]"
+	if def {
+		choices = "[Y/n]"
+	}
+	for {
+		_, _ = fmt.Fprintf(p.Out, "%s %s ", ui.FormatHighlight(question), ui.FormatDim(choices))
+		line, err := p.readLine()
+		if err != nil {
+			return false, err
+		}
+		switch strings.ToLower(line) {
+		case "":
+			return def, nil
+		case "y", "yes":
+			return true, nil
+		case "n", "no":
+			return false, nil
+		}
+		_, _ = fmt.Fprintln(p.Out, ui.FormatError("please answer y or n"))
+	}
+}
+
+// Input asks for a value, showing def when there is one. An empty answer
+// selects def; if required and there is no default the question is repeated.
+// With AssumeYes or when not interactive, def is returned without asking, or
+// ErrNoInput if the value is required and def is empty.
+func (p *Prompter) Input(label, def string, required bool) (string, error) {
+	if p.AssumeYes || !p.Interactive {
+		if def == "" && required {
+			return "", fmt.Errorf("%s: %w", label, ErrNoInput)
+		}
+		return def, nil
+	}
+
+	for {
+		switch {
+		case def != "":
+			_, _ = fmt.Fprint(p.Out, ui.FormatInfo(fmt.Sprintf("%s (default: %s): ", label, def)))
+		case required:
+			_, _ = fmt.Fprint(p.Out, ui.FormatHighlight(fmt.Sprintf("%s (required): ", label)))
+		default:
+			_, _ = fmt.Fprint(p.Out, ui.FormatInfo(fmt.Sprintf("%s: ", label)))
+		}
+		line, err := p.readLine()
+		if err != nil {
+			return "", err
+		}
+		if line != "" {
+			return line, nil
+		}
+		if def != "" || !required {
+			return def, nil
+		}
+		_, _ = fmt.Fprintln(p.Out, ui.FormatError("value is required"))
+	}
+}
+
+// readLine reads one line without its trailing newline. A final line without
+// a newline is returned as-is; io.EOF is only returned when nothing was read.
+func (p *Prompter) readLine() (string, error) {
+	line, err := p.In.ReadString('\n')
+	if err != nil && (err != io.EOF || line == "") {
+		_, _ = fmt.Fprintln(p.Out)
+		return "", err
+	}
+	return strings.TrimSpace(line), nil
+}
@@ -0,0 +1,112 @@
+package prompt
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func newTestPrompter(input string, interactive bool) *Prompter {
+	return &Prompter{
+		In:          bufio.NewReader(strings.NewReader(input)),
+		Out:         io.Discard,
+		Interactive: interactive,
+	}
+}
+
+func TestConfirm(t *testing.T) {
+	tests := []struct {
+		name        string
+		input       string
+		def         bool
+		interactive bool
+		assumeYes   bool
+		want        bool
+	}{
+		{name: "yes", input: "y\n", interactive: true, want: true},
+		{name: "no overrides default", input: "no\n", def: true, interactive: true, want: false},
+		{name: "empty takes default", input: "\n", def: true, interactive: true, want: true},
+		{name: "invalid answer re-asks", input: "maybe\nYES\n", interactive: true, want: true},
+		{name: "answer without trailing newline", input: "y", interactive: true, want: true},
+		{name: "non-interactive takes default", input: "y\n", def: false, want: false},
+		{name: "assume yes", def: false, assumeYes: true, want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newTestPrompter(tt.input, tt.interactive)
+			p.AssumeYes = tt.assumeYes
+			got, err := p.Confirm("Continue?", tt.def)
+			if err != nil {
+				t.Fatalf("Confirm() error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Confirm() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConfirmEOF(t *testing.T) {
+	p := newTestPrompter("", true)
+	if _, err := p.Confirm("Continue?", true); !errors.Is(err, io.EOF) {
+		t.Errorf("Confirm() error = %v, want io.EOF", err)
+	}
+}
+
+func TestInput(t *testing.T) {
+	tests := []struct {
+		name        string
+		input       string
+		def         string
+		required    bool
+		interactive bool
+		assumeYes   bool
+		want        string
+		wantErr     error
+	}{
+		{name: "typed value", input: "api\n", def: "web", interactive: true, want: "api"},
+		{name: "empty takes default", input: "\n", def: "8000", interactive: true, want: "8000"},
+		{name: "required re-asks until given", input: "\n\nmy-app\n", required: true, interactive: true, want: "my-app"},
+		{name: "optional without default may be empty", input: "\n", interactive: true, want: ""},
+		{name: "non-interactive takes default", input: "ignored\n", def: "8000", want: "8000"},
+		{name: "non-interactive required fails", required: true, wantErr: ErrNoInput},
+		{name: "assume yes takes default", input: "ignored\n", def: "main", interactive: true, assumeYes: true, want: "main"},
+		{name: "assume yes required fails", required: true, interactive: true, assumeYes: true, wantErr: ErrNoInput},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newTestPrompter(tt.input, tt.interactive)
+			p.AssumeYes = tt.assumeYes
+			got, err := p.Input("NAME", tt.def, tt.required)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Input() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Input() error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Input() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSetAssumeYesAppliesToDefault(t *testing.T) {
+	SetAssumeYes(true)
+	defer SetAssumeYes(false)
+
+	if !Default().AssumeYes {
+		t.Error("Default().AssumeYes = false after SetAssumeYes(true)")
+	}
+	ok, err := Confirm("Proceed?", false)
+	if err != nil || !ok {
+		t.Errorf("Confirm() = %v, %v; want true, nil", ok, err)
+	}
+}
@@ -14,6 +14,7 @@ import (
 	"sync"
 	"text/template"
 
+	"github.com/elpic/blueprint/internal"
 	gitpkg "github.com/elpic/blueprint/internal/git"
 	"github.com/elpic/blueprint/internal/parser"
 )
@@ -116,9 +117,9 @@ func (d *TemplateData) Get(action, key string) (string, error) {
 // the first match wins. The output directory is always checked last.
 func RenderWithRules(rules []parser.Rule, tmplPath, output string, preferSSH bool, cliVars map[string]string, verbose bool, overrideDirs ...string) error {
 	// Expand leading ~/ so paths like ~/workspace/... resolve correctly.
-	if strings.HasPrefix(output, "~/") {
+	if internal.HasHomePrefix(output) {
 		if homeDir, err := os.UserHomeDir(); err == nil {
-			output = filepath.Join(homeDir, output[2:])
+			output = internal.ExpandHome(output, homeDir)
 		}
 	}
 
@@ -0,0 +1,444 @@
+package ui
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/lipgloss"
+	"golang.org/x/term"
+)
+
+// ItemState is where a dashboard item is in a run.
+type ItemState int
+
+const (
+	ItemPending ItemState = iota
+	ItemRunning
+	ItemDone
+	ItemFailed
+	ItemSkipped
+)
+
+// spinnerFrames are drawn in turn next to running items.
+var spinnerFrames = []string{"⠋", "⠙", "⠹", "⠸", "⠼", "⠴", "⠦", "⠧", "⠇", "⠏"}
+
+// maxDetailLines bounds how much of an item's detail is shown when it is
+// expanded; the earlier lines are left to blueprint history.
+const maxDetailLines = 15
+
+// DashboardItem is a rule as the dashboard lists it.
+type DashboardItem struct {
+	Group   string        // group the item is listed under; "" for none
+	Label   string        // e.g. "install git, curl (base)"
+	Note    string        // shown after the label, e.g. a plan's "+ create"
+	Detail  string        // shown under the item when it is expanded: its output or command
+	State   ItemState     // where the item is in the run
+	Elapsed time.Duration // how long the item ran, once it finished
+
+	started time.Time
+}
+
+// Dashboard is a live view of the rules of a plan or apply: a tree of the
+// rules by group, with a spinner on the running ones, how long each took,
+// output that opens under a rule and a summary panel. It redraws itself in
+// place on a terminal, showing the part of the tree that fits.
+type Dashboard struct {
+	mu       sync.Mutex
+	out      *os.File
+	title    string
+	footer   string
+	items    []DashboardItem
+	started  time.Time
+	live     bool // Run was called: the panel counts items by state
+	frame    int
+	drawn    int // lines of the last redraw, which the next one replaces
+	cursor   int // item selected while browsing, -1 otherwise
+	expanded map[int]bool
+	stop     chan struct{}
+	stopped  chan struct{}
+}
+
+// NewDashboard returns a dashboard drawn on out, titled title.
+func NewDashboard(out *os.File, title string, items []DashboardItem) *Dashboard {
+	return &Dashboard{
+		out:      out,
+		title:    title,
+		items:    items,
+		started:  time.Now(),
+		cursor:   -1,
+		expanded: map[int]bool{},
+	}
+}
+
+// IsTerminal reports whether f is a terminal a dashboard can be drawn on.
+func IsTerminal(f *os.File) bool {
+	return term.IsTerminal(int(f.Fd()))
+}
+
+// SetFooter sets a line shown at the bottom of the summary panel.
+func (d *Dashboard) SetFooter(footer string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.footer = footer
+}
+
+// Add appends items to the dashboard and returns the index of the first.
+func (d *Dashboard) Add(items ...DashboardItem) int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.items = append(d.items, items...)
+	return len(d.items) - len(items)
+}
+
+// Begin marks item i as running.
+func (d *Dashboard) Begin(i int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if i < 0 || i >= len(d.items) {
+		return
+	}
+	d.items[i].State = ItemRunning
+	d.items[i].started = time.Now()
+}
+
+// End marks item i as finished in state, with detail as its output.
+func (d *Dashboard) End(i int, state ItemState, detail string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if i < 0 || i >= len(d.items) {
+		return
+	}
+	item := &d.items[i]
+	if !item.started.IsZero() {
+		item.Elapsed = time.Since(item.started)
+	}
+	item.State = state
+	item.Detail = detail
+}
+
+// Run starts redrawing the dashboard as items change, until Stop.
+func (d *Dashboard) Run() {
+	d.mu.Lock()
+	d.live = true
+	d.stop = make(chan struct{})
+	d.stopped = make(chan struct{})
+	d.mu.Unlock()
+
+	_, _ = io.WriteString(d.out, "\033[?25l") // hide the cursor
+	go func() {
+		defer close(d.stopped)
+		ticker := time.NewTicker(100 * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			d.redraw()
+			select {
+			case <-d.stop:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Stop stops redrawing and draws the final state, with the output of the
+// items that failed expanded.
+func (d *Dashboard) Stop() {
+	if d.stop == nil {
+		return
+	}
+	close(d.stop)
+	<-d.stopped
+	d.stop = nil
+
+	d.mu.Lock()
+	for i, item := range d.items {
+		if item.State == ItemFailed {
+			d.expanded[i] = true
+		}
+	}
+	d.mu.Unlock()
+	d.redraw()
+	_, _ = io.WriteString(d.out, "\033[?25h")
+}
+
+// Browse lets the user move through the items with the arrow keys (or j
+// and k) and open or close their output with enter or space, until q. It
+// returns at once when in is not a terminal. The final view is left on the
+// screen.
+func (d *Dashboard) Browse(in *os.File) error {
+	if !IsTerminal(in) || len(d.items) == 0 {
+		d.redraw()
+		_, _ = io.WriteString(d.out, "\r\n")
+		return nil
+	}
+	state, err := term.MakeRaw(int(in.Fd()))
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = term.Restore(int(in.Fd()), state)
+	}()
+
+	_, _ = io.WriteString(d.out, "\033[?25l")
+	defer func() {
+		_, _ = io.WriteString(d.out, "\033[?25h")
+	}()
+
+	d.mu.Lock()
+	d.cursor = 0
+	d.mu.Unlock()
+	buf := make([]byte, 8)
+	for {
+		d.redraw()
+		n, err := in.Read(buf)
+		if err != nil {
+			return err
+		}
+		key := string(buf[:n])
+		d.mu.Lock()
+		switch key {
+		case "q", "\x03", "\x1b":
+			d.cursor = -1
+			d.mu.Unlock()
+			d.redraw()
+			_, _ = io.WriteString(d.out, "\r\n")
+			return nil
+		case "k", "\x1b[A":
+			d.cursor = max(d.cursor-1, 0)
+		case "j", "\x1b[B":
+			d.cursor = min(d.cursor+1, len(d.items)-1)
+		case "\r", " ":
+			d.expanded[d.cursor] = !d.expanded[d.cursor]
+		}
+		d.mu.Unlock()
+	}
+}
+
+// redraw replaces the lines drawn last with the current view.
+func (d *Dashboard) redraw() {
+	width, height, err := term.GetSize(int(d.out.Fd()))
+	if err != nil {
+		width, height = 0, 0
+	}
+	d.mu.Lock()
+	d.frame++
+	lines := d.render(width, height)
+	var b strings.Builder
+	if d.drawn > 1 {
+		fmt.Fprintf(&b, "\033[%dA", d.drawn-1)
+	}
+	b.WriteString("\r\033[J")
+	b.WriteString(strings.Join(lines, "\r\n"))
+	d.drawn = len(lines)
+	d.mu.Unlock()
+	_, _ = io.WriteString(d.out, b.String())
+}
+
+// render returns the lines of the view for a terminal of width columns and
+// height rows; 0 means unlimited. d.mu must be held.
+func (d *Dashboard) render(width, height int) []string {
+	tree, focus := d.renderTree(width)
+	panel := d.renderPanel()
+
+	lines := []string{FormatHeader(d.title), ""}
+	if room := height - len(lines) - len(panel) - 1; height > 0 && len(tree) > room {
+		tree = window(tree, focus, max(room, 3))
+	}
+	lines = append(lines, tree...)
+	return append(lines, panel...)
+}
+
+// renderTree returns the lines of the items by group, and the line the view
+// should keep in sight: the selected item, or else the first running one.
+func (d *Dashboard) renderTree(width int) (lines []string, focus int) {
+	var groups []string
+	byGroup := map[string][]int{}
+	grouped := false
+	for i, item := range d.items {
+		if _, ok := byGroup[item.Group]; !ok {
+			groups = append(groups, item.Group)
+		}
+		byGroup[item.Group] = append(byGroup[item.Group], i)
+		grouped = grouped || item.Group != ""
+	}
+
+	focus = -1
+	for _, group := range groups {
+		indent := ""
+		if grouped {
+			name := group
+			if name == "" {
+				name = "ungrouped"
+			}
+			lines = append(lines, d.groupIcon(byGroup[group])+" "+FormatHighlight(name))
+			indent = "  "
+		}
+		for _, i := range byGroup[group] {
+			item := d.items[i]
+			if i == d.cursor || (d.cursor < 0 && focus < 0 && item.State == ItemRunning) {
+				focus = len(lines)
+			}
+			lines = append(lines, d.renderItem(i, indent, width))
+			if d.expanded[i] {
+				lines = append(lines, renderDetail(item.Detail, indent+"     ", width)...)
+			}
+		}
+	}
+	return lines, focus
+}
+
+// renderItem returns the line of item i.
+func (d *Dashboard) renderItem(i int, indent string, width int) string {
+	item := d.items[i]
+	pointer := "  "
+	if i == d.cursor {
+		pointer = Info.Render("›") + " "
+	}
+
+	var suffix []string
+	if item.Note != "" {
+		suffix = append(suffix, item.Note)
+	}
+	switch {
+	case item.State == ItemRunning:
+		suffix = append(suffix, FormatDim(formatElapsed(time.Since(item.started))))
+	case item.Elapsed > 0:
+		suffix = append(suffix, FormatDim(formatElapsed(item.Elapsed)))
+	}
+	tail := ""
+	if len(suffix) > 0 {
+		tail = "  " + strings.Join(suffix, "  ")
+	}
+
+	head := indent + pointer + d.stateIcon(item.State) + " "
+	label := item.Label
+	if width > 0 {
+		label = Truncate(label, max(width-lipgloss.Width(head)-lipgloss.Width(tail), minFitWidth))
+	}
+	if i == d.cursor {
+		label = lipgloss.NewStyle().Bold(true).Render(label)
+	}
+	return head + label + tail
+}
+
+// renderPanel returns the summary panel under the tree.
+func (d *Dashboard) renderPanel() []string {
+	panel := []string{FormatDim(strings.Repeat("─", 40))}
+	if d.live {
+		counts := map[ItemState]int{}
+		for _, item := range d.items {
+			counts[item.State]++
+		}
+		var parts []string
+		for _, s := range []struct {
+			state ItemState
+			name  string
+		}{{ItemDone, "done"}, {ItemFailed, "failed"}, {ItemSkipped, "skipped"}, {ItemRunning, "running"}, {ItemPending, "pending"}} {
+			if counts[s.state] > 0 {
+				parts = append(parts, fmt.Sprintf("%s %d %s", d.stateIcon(s.state), counts[s.state], s.name))
+			}
+		}
+		parts = append(parts, FormatDim(formatElapsed(time.Since(d.started))))
+		panel = append(panel, strings.Join(parts, "   "))
+	}
+	if d.footer != "" {
+		panel = append(panel, d.footer)
+	}
+	if d.cursor >= 0 {
+		panel = append(panel, FormatDim("↑/↓ move · enter show/hide details · q quit"))
+	}
+	return panel
+}
+
+// groupIcon sums up the items of a group: failed when one failed, running
+// while one runs, done when all are.
+func (d *Dashboard) groupIcon(items []int) string {
+	state := ItemDone
+	for _, i := range items {
+		switch d.items[i].State {
+		case ItemFailed:
+			return d.stateIcon(ItemFailed)
+		case ItemRunning:
+			state = ItemRunning
+		case ItemPending:
+			if state != ItemRunning {
+				state = ItemPending
+			}
+		}
+	}
+	if !d.live {
+		return "▾"
+	}
+	return d.stateIcon(state)
+}
+
+// stateIcon returns the symbol of state.
+func (d *Dashboard) stateIcon(state ItemState) string {
+	switch state {
+	case ItemRunning:
+		return Info.Render(spinnerFrames[d.frame%len(spinnerFrames)])
+	case ItemDone:
+		return Success.Render("✓")
+	case ItemFailed:
+		return Error.Render("✗")
+	case ItemSkipped:
+		return Highlight.Render("-")
+	}
+	return FormatDim("·")
+}
+
+// renderDetail returns the last maxDetailLines lines of detail, indented
+// under their item.
+func renderDetail(detail, indent string, width int) []string {
+	text := strings.TrimRight(detail, "\n")
+	if strings.TrimSpace(text) == "" {
+		return []string{indent + FormatDim("(no output)")}
+	}
+	all := strings.Split(text, "\n")
+	var lines []string
+	if len(all) > maxDetailLines {
+		lines = append(lines, indent+FormatDim(fmt.Sprintf("… %d earlier line(s), see blueprint history", len(all)-maxDetailLines)))
+		all = all[len(all)-maxDetailLines:]
+	}
+	for _, line := range all {
+		line = strings.TrimRight(line, "\r")
+		if width > 0 {
+			line = Truncate(line, max(width-len(indent)-2, minFitWidth))
+		}
+		lines = append(lines, indent+FormatDim("│ "+line))
+	}
+	return lines
+}
+
+// window returns size lines of lines around line focus, marking how many
+// are hidden above and below.
+func window(lines []string, focus, size int) []string {
+	if size >= len(lines) {
+		return lines
+	}
+	focus = max(focus, 0)
+	start := min(max(focus-size/2, 0), len(lines)-size)
+	end := start + size
+	out := slices.Clone(lines[start:end])
+	if start > 0 {
+		out[0] = FormatDim(fmt.Sprintf("  ↑ %d more", start+1))
+	}
+	if end < len(lines) {
+		out[len(out)-1] = FormatDim(fmt.Sprintf("  ↓ %d more", len(lines)-end+1))
+	}
+	return out
+}
+
+// formatElapsed formats d to a tenth of a second below a minute and to the
+// second above.
+func formatElapsed(d time.Duration) string {
+	if d < time.Minute {
+		return d.Round(100 * time.Millisecond).String()
+	}
+	return d.Round(time.Second).String()
+}
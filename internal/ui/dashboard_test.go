@@ -0,0 +1,119 @@
+package ui
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// plainLines renders d and strips the styles, for comparing text.
+func plainLines(d *Dashboard, width, height int) []string {
+	lines := d.render(width, height)
+	for i, line := range lines {
+		lines[i] = stripANSI(line)
+	}
+	return lines
+}
+
+// stripANSI removes the escape sequences lipgloss writes.
+func stripANSI(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\x1b' {
+			for i < len(s) && s[i] != 'm' {
+				i++
+			}
+			continue
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+func TestDashboardGroupsItems(t *testing.T) {
+	d := NewDashboard(os.Stdout, "Apply: setup.bp", []DashboardItem{
+		{Group: "tools", Label: "install git"},
+		{Label: "mkdir ~/src"},
+		{Group: "tools", Label: "install curl"},
+	})
+	d.live = true
+	d.Begin(0)
+	d.End(0, ItemDone, "")
+	d.End(2, ItemFailed, "E: unable to locate package curl")
+	d.expanded[2] = true
+
+	got := strings.Join(plainLines(d, 0, 0), "\n")
+	for _, want := range []string{
+		"✗ tools\n    ✓ install git",
+		"    ✗ install curl\n       │ E: unable to locate package curl\n",
+		"· ungrouped\n    · mkdir ~/src\n",
+		"✓ 1 done   ✗ 1 failed   · 1 pending",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("view does not contain %q:\n%s", want, got)
+		}
+	}
+}
+
+func TestDashboardWithoutGroups(t *testing.T) {
+	d := NewDashboard(os.Stdout, "Plan: setup.bp", []DashboardItem{
+		{Label: "install git", Note: "+ create"},
+	})
+	d.SetFooter("Plan: 1 to create.")
+
+	got := plainLines(d, 0, 0)
+	want := []string{"Plan: setup.bp", "", "  · install git  + create", strings.Repeat("─", 40), "Plan: 1 to create."}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("view =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestDashboardFitsTerminal(t *testing.T) {
+	var items []DashboardItem
+	for i := 0; i < 60; i++ {
+		items = append(items, DashboardItem{Label: fmt.Sprintf("run step %d", i)})
+	}
+	d := NewDashboard(os.Stdout, "Apply: setup.bp", items)
+	d.live = true
+	d.Begin(40)
+
+	got := plainLines(d, 80, 20)
+	if len(got) >= 20 {
+		t.Fatalf("view has %d lines, want fewer than the terminal's 20", len(got))
+	}
+	view := strings.Join(got, "\n")
+	if !strings.Contains(view, "run step 40") || !strings.Contains(view, "↑") || !strings.Contains(view, "↓") {
+		t.Errorf("view does not keep the running item in sight:\n%s", view)
+	}
+}
+
+func TestRenderDetailKeepsLastLines(t *testing.T) {
+	var out []string
+	for i := 1; i <= 20; i++ {
+		out = append(out, fmt.Sprintf("line %d", i))
+	}
+	lines := renderDetail(strings.Join(out, "\n"), "", 0)
+	if len(lines) != maxDetailLines+1 {
+		t.Fatalf("got %d lines, want %d", len(lines), maxDetailLines+1)
+	}
+	if first := stripANSI(lines[0]); !strings.Contains(first, "5 earlier line(s)") {
+		t.Errorf("first line = %q, want a note of the 5 lines left out", first)
+	}
+	if last := stripANSI(lines[len(lines)-1]); last != "│ line 20" {
+		t.Errorf("last line = %q, want the last line of output", last)
+	}
+}
+
+func TestFormatElapsed(t *testing.T) {
+	tests := map[time.Duration]string{
+		1234 * time.Millisecond: "1.2s",
+		83 * time.Second:        "1m23s",
+	}
+	for in, want := range tests {
+		if got := formatElapsed(in); got != want {
+			t.Errorf("formatElapsed(%v) = %q, want %q", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package ui
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/elpic/blueprint/internal"
+	"golang.org/x/term"
+)
+
+// Ellipsis marks text shortened to fit the terminal.
+const Ellipsis = "…"
+
+// minFitWidth is the narrowest a value is cut to, however little room is
+// left on the line; below it the line wraps instead.
+const minFitWidth = 16
+
+// TerminalWidth returns the width of the terminal stdout is attached to, or
+// $COLUMNS when it is set. It returns 0 when output is not a terminal, so
+// piped output and logs are never truncated.
+var TerminalWidth = func() int {
+	if n, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && n > 0 {
+		return n
+	}
+	if w, _, err := term.GetSize(int(os.Stdout.Fd())); err == nil && w > 0 {
+		return w
+	}
+	return 0
+}
+
+// homeDir is the directory AbbreviateHome replaces with ~.
+var homeDir = func() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Clean(home)
+}
+
+// AbbreviateHome replaces a leading home directory in path with ~.
+func AbbreviateHome(path string) string {
+	home := homeDir()
+	if home == "" || home == string(filepath.Separator) {
+		return path
+	}
+	if !internal.HasPathPrefix(path, home) {
+		return path
+	}
+	if len(path) <= len(home)+1 {
+		return "~"
+	}
+	return "~" + string(filepath.Separator) + path[len(home)+1:]
+}
+
+// Truncate shortens s to at most width columns, ending it with an ellipsis.
+// s must be plain text: apply styles after truncating.
+func Truncate(s string, width int) string {
+	if width <= 0 || lipgloss.Width(s) <= width {
+		return s
+	}
+	return takeColumns(s, width-1) + Ellipsis
+}
+
+// TruncateMiddle shortens s to at most width columns by replacing its middle
+// with an ellipsis, keeping the scheme or root of a URL or path and its last
+// element, which tell entries apart better than a cut-off tail.
+func TruncateMiddle(s string, width int) string {
+	if width <= 0 || lipgloss.Width(s) <= width {
+		return s
+	}
+	tail := (width - 1) / 2
+	head := width - 1 - tail
+	return takeColumns(s, head) + Ellipsis + lastColumns(s, tail)
+}
+
+// Fit shortens s with TruncateMiddle so that it fits in what is left of the
+// terminal line after used columns. Output that is not a terminal is left
+// as is.
+func Fit(s string, used int) string {
+	width := TerminalWidth()
+	if width <= 0 {
+		return s
+	}
+	return TruncateMiddle(s, max(width-used, minFitWidth))
+}
+
+// PadRight pads s with spaces to width columns. Styled text is measured by
+// its visible width, so styled columns line up too.
+func PadRight(s string, width int) string {
+	if pad := width - lipgloss.Width(s); pad > 0 {
+		return s + strings.Repeat(" ", pad)
+	}
+	return s
+}
+
+// AlignColumns lays rows out as columns separated by two spaces, each as
+// wide as its widest cell. The last cell of a row is not padded, so rows of
+// different lengths carry no trailing spaces.
+func AlignColumns(rows [][]string) []string {
+	var widths []int
+	for _, row := range rows {
+		for i, cell := range row {
+			if i == len(widths) {
+				widths = append(widths, 0)
+			}
+			widths[i] = max(widths[i], lipgloss.Width(cell))
+		}
+	}
+
+	lines := make([]string, len(rows))
+	for r, row := range rows {
+		var b strings.Builder
+		for i, cell := range row {
+			if i == len(row)-1 {
+				b.WriteString(cell)
+				break
+			}
+			b.WriteString(PadRight(cell, widths[i]))
+			b.WriteString("  ")
+		}
+		lines[r] = b.String()
+	}
+	return lines
+}
+
+// takeColumns returns the longest prefix of s at most width columns wide.
+func takeColumns(s string, width int) string {
+	used := 0
+	for i, r := range s {
+		w := lipgloss.Width(string(r))
+		if used+w > width {
+			return s[:i]
+		}
+		used += w
+	}
+	return s
+}
+
+// lastColumns returns the longest suffix of s at most width columns wide.
+func lastColumns(s string, width int) string {
+	runes := []rune(s)
+	used := 0
+	for i := len(runes) - 1; i >= 0; i-- {
+		w := lipgloss.Width(string(runes[i]))
+		if used+w > width {
+			return string(runes[i+1:])
+		}
+		used += w
+	}
+	return s
+}
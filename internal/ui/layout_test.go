@@ -0,0 +1,92 @@
+package ui
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestAbbreviateHome(t *testing.T) {
+	orig := homeDir
+	defer func() { homeDir = orig }()
+	homeDir = func() string { return "/home/me" }
+
+	tests := map[string]string{
+		"/home/me":                 "~",
+		"/home/me/.config/nvim":    "~/.config/nvim",
+		"/home/meow/file":          "/home/meow/file",
+		"/etc/apt/sources.list.d/": "/etc/apt/sources.list.d/",
+		"relative/path":            "relative/path",
+	}
+	for in, want := range tests {
+		if got := AbbreviateHome(in); got != want {
+			t.Errorf("AbbreviateHome(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	tests := []struct {
+		in    string
+		width int
+		want  string
+	}{
+		{"short", 10, "short"},
+		{"exactly10!", 10, "exactly10!"},
+		{"a longer command line", 10, "a longer …"},
+		{"ünïcödé text", 6, "ünïcö…"},
+		{"unlimited", 0, "unlimited"},
+	}
+	for _, tt := range tests {
+		if got := Truncate(tt.in, tt.width); got != tt.want {
+			t.Errorf("Truncate(%q, %d) = %q, want %q", tt.in, tt.width, got, tt.want)
+		}
+	}
+}
+
+func TestTruncateMiddle(t *testing.T) {
+	got := TruncateMiddle("https://github.com/someone/a-very-long-repository-name.git", 30)
+	if len([]rune(got)) != 30 {
+		t.Errorf("TruncateMiddle() = %q, want 30 columns", got)
+	}
+	if !strings.HasPrefix(got, "https://") || !strings.HasSuffix(got, ".git") || !strings.Contains(got, Ellipsis) {
+		t.Errorf("TruncateMiddle() = %q, want scheme and suffix kept", got)
+	}
+	if got := TruncateMiddle("short", 30); got != "short" {
+		t.Errorf("TruncateMiddle() = %q, want it unchanged", got)
+	}
+}
+
+func TestFit(t *testing.T) {
+	orig := TerminalWidth
+	defer func() { TerminalWidth = orig }()
+	long := strings.Repeat("x", 100)
+
+	TerminalWidth = func() int { return 0 }
+	if got := Fit(long, 10); got != long {
+		t.Errorf("Fit() without a terminal = %q, want it unchanged", got)
+	}
+
+	TerminalWidth = func() int { return 50 }
+	if got := Fit(long, 10); len([]rune(got)) != 40 {
+		t.Errorf("Fit() = %q (%d columns), want 40", got, len([]rune(got)))
+	}
+	if got := Fit(long, 48); len([]rune(got)) != minFitWidth {
+		t.Errorf("Fit() = %q, want at least %d columns", got, minFitWidth)
+	}
+}
+
+func TestAlignColumns(t *testing.T) {
+	lines := AlignColumns([][]string{
+		{"git", FormatDim("(2024-01-01)"), "[linux]"},
+		{"ripgrep", FormatDim("(2024-01-02)"), "[mac]"},
+	})
+	want := []string{
+		"git      " + FormatDim("(2024-01-01)") + "  [linux]",
+		"ripgrep  " + FormatDim("(2024-01-02)") + "  [mac]",
+	}
+	for i := range want {
+		if lines[i] != want[i] {
+			t.Errorf("line %d = %q, want %q", i, lines[i], want[i])
+		}
+	}
+}
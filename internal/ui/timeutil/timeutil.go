@@ -0,0 +1,131 @@
+// Package timeutil stores, parses and displays the timestamps and durations
+// blueprint keeps in status.json and the run history.
+//
+// Timestamps are stored as RFC 3339 strings, which read the same whatever
+// the locale, and shown in the local time zone. Every command that prints
+// one goes through Display, so they all honor --relative and all say so
+// when a stored value cannot be read instead of printing it as if it were a
+// time.
+package timeutil
+
+import (
+	"fmt"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// DisplayLayout is how timestamps are shown: local time, to the second.
+const DisplayLayout = "2006-01-02 15:04:05"
+
+// Clock is the time Now and relative times are measured against, a variable
+// for testability.
+var Clock = time.Now
+
+// relative makes Display describe timestamps by how long ago they were.
+var relative atomic.Bool
+
+// SetRelative makes Display show "3 days ago" instead of the date and time.
+// Set from the --relative flag.
+func SetRelative(on bool) {
+	relative.Store(on)
+}
+
+// Now returns the current time as stored in status and history files.
+func Now() string {
+	return Format(Clock())
+}
+
+// Format returns t as stored in status and history files.
+func Format(t time.Time) string {
+	return t.Format(time.RFC3339)
+}
+
+// Parse reads a stored timestamp. Besides RFC 3339 it accepts the
+// fractional seconds some files carry and the display layout, which older
+// versions wrote in places, read as local time.
+func Parse(ts string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339Nano, ts); err == nil {
+		return t, nil
+	}
+	t, err := time.ParseInLocation(DisplayLayout, ts, time.Local)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid timestamp %s", strconv.Quote(ts))
+	}
+	return t, nil
+}
+
+// Display returns a stored timestamp for people to read: in local time, or
+// how long ago it was with --relative. An empty value is "unknown" and one
+// that does not parse is marked as such rather than passed off as a time.
+func Display(ts string) string {
+	if ts == "" {
+		return "unknown"
+	}
+	t, err := Parse(ts)
+	if err != nil {
+		return "invalid time " + strconv.Quote(ts)
+	}
+	if relative.Load() {
+		return Ago(t, Clock())
+	}
+	return t.Local().Format(DisplayLayout)
+}
+
+// Ago describes t by how long before now it was, in its largest whole unit:
+// "just now", "5 minutes ago", "1 hour ago", "3 days ago".
+func Ago(t, now time.Time) string {
+	d := now.Sub(t)
+	switch {
+	case d < time.Minute:
+		return "just now"
+	case d < time.Hour:
+		return plural(int(d.Minutes()), "minute") + " ago"
+	case d < 24*time.Hour:
+		return plural(int(d.Hours()), "hour") + " ago"
+	}
+	return plural(int(d.Hours()/24), "day") + " ago"
+}
+
+// DaysAgo describes t as a whole number of days before now: "today",
+// "1 day ago", "12 days ago".
+func DaysAgo(t, now time.Time) string {
+	days := int(now.Sub(t).Hours() / 24)
+	if days <= 0 {
+		return "today"
+	}
+	return plural(days, "day") + " ago"
+}
+
+func plural(n int, unit string) string {
+	if n == 1 {
+		return "1 " + unit
+	}
+	return fmt.Sprintf("%d %ss", n, unit)
+}
+
+// Duration formats d in whole seconds: "45s", "2m 30s", "1h 5m 0s".
+func Duration(d time.Duration) string {
+	if d < time.Minute {
+		return fmt.Sprintf("%ds", int(d.Seconds()))
+	}
+	if d < time.Hour {
+		m := int(d.Minutes())
+		s := int(d.Seconds()) % 60
+		return fmt.Sprintf("%dm %ds", m, s)
+	}
+	h := int(d.Hours())
+	m := int(d.Minutes()) % 60
+	s := int(d.Seconds()) % 60
+	return fmt.Sprintf("%dh %dm %ds", h, m, s)
+}
+
+// Milliseconds formats a duration stored in milliseconds, to a tenth of a
+// second below a minute ("0.4s", "12.5s") and as Duration above.
+func Milliseconds(ms int64) string {
+	d := time.Duration(ms) * time.Millisecond
+	if d < time.Minute {
+		return fmt.Sprintf("%.1fs", d.Seconds())
+	}
+	return Duration(d)
+}
@@ -0,0 +1,91 @@
+package timeutil
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDisplay(t *testing.T) {
+	orig := time.Local
+	t.Cleanup(func() { time.Local = orig })
+	time.Local = time.FixedZone("UTC+2", 2*60*60)
+
+	tests := []struct {
+		ts   string
+		want string
+	}{
+		{"2024-03-01T10:20:30Z", "2024-03-01 12:20:30"},
+		{"2024-03-01T10:20:30.123456789+02:00", "2024-03-01 10:20:30"},
+		{"2024-03-01 10:20:30", "2024-03-01 10:20:30"},
+		{"", "unknown"},
+		{"yesterday", `invalid time "yesterday"`},
+	}
+	for _, tt := range tests {
+		if got := Display(tt.ts); got != tt.want {
+			t.Errorf("Display(%q) = %q, want %q", tt.ts, got, tt.want)
+		}
+	}
+
+	origClock := Clock
+	t.Cleanup(func() { Clock = origClock; SetRelative(false) })
+	Clock = func() time.Time { return time.Date(2024, 3, 4, 10, 20, 30, 0, time.UTC) }
+	SetRelative(true)
+	if got := Display("2024-03-01T10:20:30Z"); got != "3 days ago" {
+		t.Errorf("Display() with relative times = %q, want 3 days ago", got)
+	}
+}
+
+func TestAgo(t *testing.T) {
+	now := time.Date(2024, 3, 4, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		ago  time.Duration
+		want string
+	}{
+		{10 * time.Second, "just now"},
+		{time.Minute, "1 minute ago"},
+		{45 * time.Minute, "45 minutes ago"},
+		{5 * time.Hour, "5 hours ago"},
+		{30 * time.Hour, "1 day ago"},
+		{400 * 24 * time.Hour, "400 days ago"},
+	}
+	for _, tt := range tests {
+		if got := Ago(now.Add(-tt.ago), now); got != tt.want {
+			t.Errorf("Ago(-%s) = %q, want %q", tt.ago, got, tt.want)
+		}
+	}
+	if got := DaysAgo(now.Add(-time.Hour), now); got != "today" {
+		t.Errorf("DaysAgo(-1h) = %q, want today", got)
+	}
+}
+
+func TestDuration(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"0s", "0s"},
+		{"30s", "30s"},
+		{"59s", "59s"},
+		{"1m0s", "1m 0s"},
+		{"2m30s", "2m 30s"},
+		{"59m59s", "59m 59s"},
+		{"1h0m0s", "1h 0m 0s"},
+		{"2h30m45s", "2h 30m 45s"},
+		{"29h30m15s", "29h 30m 15s"},
+	}
+	for _, tt := range tests {
+		d, err := time.ParseDuration(tt.input)
+		if err != nil {
+			t.Fatalf("invalid test duration %q: %v", tt.input, err)
+		}
+		if got := Duration(d); got != tt.expected {
+			t.Errorf("Duration(%s) = %q, want %q", tt.input, got, tt.expected)
+		}
+	}
+	if got := Milliseconds(1240); got != "1.2s" {
+		t.Errorf("Milliseconds(1240) = %q, want 1.2s", got)
+	}
+	if got := Milliseconds(90_000); got != "1m 30s" {
+		t.Errorf("Milliseconds(90000) = %q, want 1m 30s", got)
+	}
+}
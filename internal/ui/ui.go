@@ -59,7 +59,7 @@ func PrintRuleSummary(index, total int, action, command string, status string) {
 	}
 
 	fmt.Printf("[%d/%d] %s\n", index, total, FormatHighlight(action))
-	fmt.Printf("       Command: %s\n", FormatDim(command))
+	fmt.Printf("       Command: %s\n", FormatDim(Fit(command, len("       Command: "))))
 	fmt.Printf("       %s\n\n", statusStr)
 }
 
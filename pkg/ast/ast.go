@@ -0,0 +1,471 @@
+// Package ast exposes a blueprint file as a syntax tree: rules with their
+// positions and attributes, includes (resolved into a tree for local files),
+// group blocks, defaults lines, comments and blank lines, in source order.
+//
+// It shares its tokenizer with the blueprint parser (parser.ScanFields), so
+// editor plugins, language servers and formatters see a rule exactly as
+// `blueprint apply` does. Format turns a tree back into .bp text.
+//
+// Parsing is lenient: unknown directives and malformed values are kept in
+// the tree instead of failing, so tooling can still work on a file that is
+// being edited. Use the parser itself to validate a blueprint.
+package ast
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/elpic/blueprint/internal/git"
+	"github.com/elpic/blueprint/internal/parser"
+)
+
+// Pos is a position in a blueprint file. Line and Column are 1-based; Column
+// counts bytes.
+type Pos struct {
+	Line   int
+	Column int
+}
+
+// Span is the source range covered by a node. End is just past the last byte
+// of the node's last line.
+type Span struct {
+	Start Pos
+	End   Pos
+}
+
+// Range returns the span; it makes every node satisfy Node.
+func (s Span) Range() Span { return s }
+
+// Node is a top-level element of a file: *Rule, *Include, *Pin, *Group,
+// *GroupEnd, *Defaults, *Comment or *Blank. The nodes of a group block are not nested: they follow
+// its *Group in File.Nodes up to the matching *GroupEnd.
+type Node interface {
+	Range() Span
+}
+
+// File is a parsed blueprint file.
+type File struct {
+	Path  string // absolute path; "" when parsed from a string
+	Nodes []Node // in source order
+}
+
+// Rules returns the rules of this file (not of its includes) in source order.
+func (f *File) Rules() []*Rule {
+	var rules []*Rule
+	for _, n := range f.Nodes {
+		if r, ok := n.(*Rule); ok {
+			rules = append(rules, r)
+		}
+	}
+	return rules
+}
+
+// Includes returns the include statements of this file in source order.
+func (f *File) Includes() []*Include {
+	var includes []*Include
+	for _, n := range f.Nodes {
+		if inc, ok := n.(*Include); ok {
+			includes = append(includes, inc)
+		}
+	}
+	return includes
+}
+
+// Rule is one directive line, after joining backslash continuations.
+type Rule struct {
+	Span
+	Directive string  // e.g. "install", "run-sh"; see Known
+	Args      []Arg   // positional tokens, in source order
+	Attrs     []*Attr // keyword attributes, in source order
+	Comment   string  // inline comment including its marker; comments on continuation lines are joined here
+}
+
+// Known reports whether the parser understands the rule's directive.
+func (r *Rule) Known() bool {
+	for _, d := range parser.Directives() {
+		if d == r.Directive {
+			return true
+		}
+	}
+	return false
+}
+
+// Attr returns the first attribute with the given key (without colon), or nil.
+func (r *Rule) Attr(key string) *Attr {
+	for _, a := range r.Attrs {
+		if a.Key == key {
+			return a
+		}
+	}
+	return nil
+}
+
+// ID returns the value of the rule's id: attribute, or "" when it has none.
+// Rules without an explicit id get a derived one from the parser.
+func (r *Rule) ID() string {
+	if a := r.Attr("id"); a != nil {
+		return a.Value
+	}
+	return ""
+}
+
+// Group opens a group block: "group <name> [on: [...]] [after: ...] {". The
+// rules up to the matching *GroupEnd inherit its name and attributes.
+type Group struct {
+	Span
+	Name    string  // "" when missing
+	Attrs   []*Attr // keyword attributes, in source order
+	Open    bool    // the line ends with "{"; the parser rejects it otherwise
+	Comment string
+}
+
+// Attr returns the first attribute with the given key (without colon), or nil.
+func (g *Group) Attr(key string) *Attr {
+	for _, a := range g.Attrs {
+		if a.Key == key {
+			return a
+		}
+	}
+	return nil
+}
+
+// Defaults is a "defaults { on: [...]; group: ... }" line. Its attributes
+// apply to the rules after it until the next defaults line.
+type Defaults struct {
+	Span
+	Attrs   []*Attr // keyword attributes, in source order
+	Braced  bool    // the attributes are enclosed in { }; the parser rejects it otherwise
+	Comment string
+}
+
+// Attr returns the first attribute with the given key (without colon), or nil.
+func (d *Defaults) Attr(key string) *Attr {
+	for _, a := range d.Attrs {
+		if a.Key == key {
+			return a
+		}
+	}
+	return nil
+}
+
+// GroupEnd is the "}" that closes a group block.
+type GroupEnd struct {
+	Span
+	Comment string
+}
+
+// Arg is a positional token of a rule.
+type Arg struct {
+	Value string
+	Pos   Pos
+}
+
+// Attr is a keyword attribute of a rule, e.g. "after: a, b" or "on: [mac]".
+type Attr struct {
+	Key      string   // keyword without its trailing colon
+	Value    string   // raw value; empty for bracket lists
+	List     []string // items of a bracket value (on:, skip:, aliases:)
+	Bracket  bool     // the value is a bracket list
+	Quoted   bool     // the value was written in double quotes
+	Ignored  bool     // no usable value (missing "[", unterminated "]" or quote); the parser skips it
+	Pos      Pos      // position of the keyword
+	ValuePos Pos      // position of the value; zero when there is none
+}
+
+// Include is an include statement. File is the parsed included file when it
+// is local and could be read; git includes are not fetched.
+type Include struct {
+	Span
+	Path      string // as written, without "as" and prefer_ssh:
+	Namespace string // from "as <ns>"
+	PreferSSH bool   // prefer_ssh: true
+	Comment   string
+	Resolved  string // absolute path of a local include
+	File      *File  // nil for git includes, missing files and circular includes
+	Err       error  // why a local include could not be read, e.g. it is not a blueprint file
+}
+
+// IsGit reports whether the include points at a git repository.
+func (i *Include) IsGit() bool {
+	return git.IsGitURL(i.Path)
+}
+
+// Pin is a "pin <source> sha256: <hex>" statement, which fixes the content
+// of a remote blueprint included from this file or the files it includes.
+type Pin struct {
+	Span
+	Source  string // "" when missing
+	Sum     string // value of sha256: as written; "" when missing
+	Comment string
+}
+
+// Comment is a line holding only a comment.
+type Comment struct {
+	Span
+	Text string // including the marker ("#" or "//")
+}
+
+// Blank is an empty line.
+type Blank struct {
+	Span
+}
+
+// Parse parses blueprint content. Includes are recorded but not resolved.
+func Parse(content string) *File {
+	return parseContent(content)
+}
+
+// ParseFile parses a blueprint file and, recursively, its local includes.
+// Only reading the top-level file can fail.
+func ParseFile(path string) (*File, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	return parseFileTree(abs, map[string]bool{})
+}
+
+func parseFileTree(abs string, loading map[string]bool) (*File, error) {
+	content, err := os.ReadFile(abs) // #nosec G304 -- abs is a user-supplied blueprint path
+	if err != nil {
+		return nil, err
+	}
+	return parseTree(abs, string(content), loading), nil
+}
+
+// ParseContent parses content as the file at path and, recursively, the
+// local includes it names (read from disk). Editors use it for unsaved buffers.
+func ParseContent(path, content string) *File {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		abs = path
+	}
+	return parseTree(abs, content, map[string]bool{})
+}
+
+func parseTree(abs, content string, loading map[string]bool) *File {
+	loading[abs] = true
+	defer delete(loading, abs)
+
+	f := parseContent(content)
+	f.Path = abs
+	for _, inc := range f.Includes() {
+		if inc.IsGit() {
+			continue
+		}
+		inc.Resolved = inc.Path
+		if !filepath.IsAbs(inc.Resolved) {
+			inc.Resolved = filepath.Join(filepath.Dir(abs), inc.Resolved)
+		}
+		if loading[inc.Resolved] {
+			continue
+		}
+		content, err := parser.ReadInclude(inc.Resolved)
+		if err != nil {
+			inc.Err = err
+			continue
+		}
+		inc.File = parseTree(inc.Resolved, string(content), loading)
+	}
+	return f
+}
+
+// segment maps the start of a physical line's text to its offset in the
+// joined logical line.
+type segment struct {
+	offset int
+	pos    Pos
+}
+
+// logicalLine is one statement after joining backslash continuations, the
+// same way the parser does before matching directives.
+type logicalLine struct {
+	text     string
+	segments []segment
+	comments []string
+	start    Pos
+	end      Pos
+}
+
+// posAt maps a byte offset in the logical text back to a source position.
+func (l *logicalLine) posAt(offset int) Pos {
+	seg := l.segments[0]
+	for _, s := range l.segments[1:] {
+		if s.offset > offset {
+			break
+		}
+		seg = s
+	}
+	return Pos{Line: seg.pos.Line, Column: seg.pos.Column + offset - seg.offset}
+}
+
+func parseContent(content string) *File {
+	f := &File{}
+	if content == "" {
+		return f
+	}
+	var pending *logicalLine
+
+	// A trailing newline ends the last line rather than starting an empty one
+	for i, raw := range strings.Split(strings.TrimSuffix(content, "\n"), "\n") {
+		lineNo := i + 1
+		code, comment := parser.SplitComment(raw)
+		code = strings.TrimRight(code, " \t")
+		piece := strings.TrimSpace(code)
+		lineEnd := Pos{Line: lineNo, Column: len(raw) + 1}
+
+		if pending == nil && piece == "" {
+			span := Span{Start: Pos{Line: lineNo, Column: 1}, End: lineEnd}
+			if comment != "" {
+				span.Start.Column = strings.Index(raw, comment) + 1
+				f.Nodes = append(f.Nodes, &Comment{Span: span, Text: strings.TrimSpace(comment)})
+			} else {
+				f.Nodes = append(f.Nodes, &Blank{Span: span})
+			}
+			continue
+		}
+
+		l := pending
+		pending = nil
+		piecePos := Pos{Line: lineNo, Column: len(code) - len(strings.TrimLeft(code, " \t")) + 1}
+		switch {
+		case l == nil:
+			l = &logicalLine{text: piece, start: piecePos, segments: []segment{{offset: 0, pos: piecePos}}}
+		case piece == "":
+			// Blank or comment-only line inside a continuation is skipped
+		default:
+			l.text += " "
+			l.segments = append(l.segments, segment{offset: len(l.text), pos: piecePos})
+			l.text += piece
+		}
+		if comment != "" {
+			l.comments = append(l.comments, strings.TrimSpace(comment))
+		}
+		l.end = lineEnd
+
+		if strings.HasSuffix(l.text, "\\") {
+			l.text = strings.TrimSpace(l.text[:len(l.text)-1])
+			pending = l
+			continue
+		}
+		f.Nodes = append(f.Nodes, statementNode(l))
+	}
+	if pending != nil {
+		f.Nodes = append(f.Nodes, statementNode(pending))
+	}
+	return f
+}
+
+// statementNode turns a logical line into an *Include, a *Pin, a *Group, a
+// *GroupEnd, a *Defaults or a *Rule.
+func statementNode(l *logicalLine) Node {
+	span := Span{Start: l.start, End: l.end}
+	comment := strings.Join(l.comments, " ")
+
+	if l.text == "}" {
+		return &GroupEnd{Span: span, Comment: comment}
+	}
+	if l.text == "group" || strings.HasPrefix(l.text, "group ") {
+		group := &Group{Span: span, Comment: comment}
+		body, open := strings.CutSuffix(l.text[len("group"):], "{")
+		group.Open = open
+		var args []Arg
+		args, group.Attrs = scanBody(l, body, len("group"))
+		if len(args) > 0 {
+			group.Name = args[0].Value
+		}
+		return group
+	}
+
+	if parser.IsDefaultsLine(l.text) {
+		defaults := &Defaults{Span: span, Comment: comment}
+		body, braced := parser.DefaultsBody(l.text)
+		defaults.Braced = braced
+		if braced {
+			// The body starts just after the "{"
+			base := strings.Index(l.text, "{") + 1
+			_, defaults.Attrs = scanBody(l, body, base)
+		}
+		return defaults
+	}
+
+	if strings.HasPrefix(l.text, "include ") {
+		inc := &Include{Span: span, Comment: comment}
+		spec := strings.TrimSpace(strings.TrimPrefix(l.text, "include "))
+		if idx := strings.Index(spec, "prefer_ssh:"); idx >= 0 {
+			inc.PreferSSH = strings.EqualFold(strings.TrimSpace(spec[idx+len("prefer_ssh:"):]), "true")
+			spec = strings.TrimSpace(spec[:idx])
+		}
+		if words := strings.Fields(spec); len(words) >= 2 && words[len(words)-2] == "as" {
+			inc.Namespace = words[len(words)-1]
+			spec = strings.Join(words[:len(words)-2], " ")
+		}
+		inc.Path = spec
+		return inc
+	}
+
+	if strings.HasPrefix(l.text, "pin ") {
+		pin := &Pin{Span: span, Comment: comment}
+		args, attrs := scanBody(l, l.text[len("pin"):], len("pin"))
+		if len(args) > 0 {
+			pin.Source = args[0].Value
+		}
+		for _, a := range attrs {
+			if a.Key == "sha256" {
+				pin.Sum = a.Value
+			}
+		}
+		return pin
+	}
+
+	directive := l.text
+	if idx := strings.IndexAny(l.text, " \t"); idx >= 0 {
+		directive = l.text[:idx]
+	}
+	rule := &Rule{Span: span, Directive: directive, Comment: comment}
+	body := l.text[len(directive):]
+	base := len(directive)
+
+	// var takes its value verbatim (it may contain colons, e.g. JSON), so
+	// its words are never keywords.
+	if directive == "var" {
+		offset := 0
+		for _, word := range strings.Fields(body) {
+			offset += strings.Index(body[offset:], word)
+			rule.Args = append(rule.Args, Arg{Value: word, Pos: l.posAt(base + offset)})
+			offset += len(word)
+		}
+		return rule
+	}
+
+	rule.Args, rule.Attrs = scanBody(l, body, base)
+	return rule
+}
+
+// scanBody splits body, the text of l after its first base bytes, into
+// positional arguments and attributes.
+func scanBody(l *logicalLine, body string, base int) ([]Arg, []*Attr) {
+	var args []Arg
+	var attrs []*Attr
+	for _, field := range parser.ScanFields(body) {
+		if field.Key == "" {
+			args = append(args, Arg{Value: field.Value, Pos: l.posAt(base + field.Offset)})
+			continue
+		}
+		attr := &Attr{
+			Key:     strings.TrimSuffix(field.Key, ":"),
+			Value:   field.Value,
+			List:    field.List,
+			Bracket: field.Bracket,
+			Quoted:  field.Quoted,
+			Ignored: field.Ignored,
+			Pos:     l.posAt(base + field.Offset),
+		}
+		if field.ValueOffset >= 0 {
+			attr.ValuePos = l.posAt(base + field.ValueOffset)
+		}
+		attrs = append(attrs, attr)
+	}
+	return args, attrs
+}
@@ -0,0 +1,254 @@
+package ast
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/elpic/blueprint/internal/parser"
+)
+
+const sample = `# Tools
+install git curl on: [mac, linux] id: tools // base packages
+
+clone https://github.com/user/repo.git to: ~/repo branch: main after: tools
+run make install unless: test -f /usr/local/bin/x \
+    undo: rm -f /usr/local/bin/x sudo: true
+schedule cron: "0 * * * *" source: ~/setup.bp
+mise node@20 python@3.12 aliases: [old-mise] skip: [a]
+var CONFIG { "file": "setup.bp" }
+`
+
+func TestParseStructure(t *testing.T) {
+	f := Parse(sample)
+
+	var kinds []string
+	for _, n := range f.Nodes {
+		switch n.(type) {
+		case *Rule:
+			kinds = append(kinds, "rule")
+		case *Comment:
+			kinds = append(kinds, "comment")
+		case *Blank:
+			kinds = append(kinds, "blank")
+		case *Include:
+			kinds = append(kinds, "include")
+		}
+	}
+	want := "comment rule blank rule rule rule rule rule"
+	if got := strings.Join(kinds, " "); got != want {
+		t.Fatalf("node kinds = %q, want %q", got, want)
+	}
+
+	rules := f.Rules()
+	install := rules[0]
+	if install.Directive != "install" || install.ID() != "tools" || install.Comment != "// base packages" {
+		t.Errorf("install rule = %+v", install)
+	}
+	if len(install.Args) != 2 || install.Args[1].Value != "curl" || install.Args[1].Pos != (Pos{Line: 2, Column: 13}) {
+		t.Errorf("install args = %+v", install.Args)
+	}
+	on := install.Attr("on")
+	if on == nil || !on.Bracket || !reflect.DeepEqual(on.List, []string{"mac", "linux"}) || on.Pos != (Pos{Line: 2, Column: 18}) {
+		t.Errorf("on attr = %+v", on)
+	}
+
+	after := rules[1].Attr("after")
+	if after == nil || after.Value != "tools" || after.ValuePos != (Pos{Line: 4, Column: 71}) {
+		t.Errorf("after attr = %+v", after)
+	}
+
+	run := rules[2]
+	if run.Start != (Pos{Line: 5, Column: 1}) || run.End.Line != 6 {
+		t.Errorf("run span = %+v", run.Span)
+	}
+	undo := run.Attr("undo")
+	if undo == nil || undo.Value != "rm -f /usr/local/bin/x" || undo.Pos != (Pos{Line: 6, Column: 5}) {
+		t.Errorf("undo attr on continuation line = %+v", undo)
+	}
+
+	if cron := rules[3].Attr("cron"); cron == nil || !cron.Quoted || cron.Value != "0 * * * *" {
+		t.Errorf("cron attr = %+v", cron)
+	}
+
+	v := rules[5]
+	if len(v.Attrs) != 0 || len(v.Args) != 5 || v.Args[1].Value != "{" {
+		t.Errorf("var words must stay positional, got args=%+v attrs=%+v", v.Args, v.Attrs)
+	}
+	if !v.Known() || (&Rule{Directive: "instal"}).Known() {
+		t.Error("Known() does not match the parser's directives")
+	}
+}
+
+func TestFormatRoundTrip(t *testing.T) {
+	f := Parse(sample)
+	out := string(Format(f))
+
+	want, err := parser.Parse(sample)
+	if err != nil {
+		t.Fatalf("parser.Parse(sample): %v", err)
+	}
+	got, err := parser.Parse(out)
+	if err != nil {
+		t.Fatalf("parser.Parse(Format()): %v\n%s", err, out)
+	}
+	if !reflect.DeepEqual(withoutSource(got), withoutSource(want)) {
+		t.Errorf("formatted blueprint parses differently:\n%s", out)
+	}
+
+	// Formatting is stable
+	if again := string(Format(Parse(out))); again != out {
+		t.Errorf("Format is not idempotent:\n%s\n---\n%s", out, again)
+	}
+	if !strings.HasPrefix(out, "# Tools\ninstall git curl on: [mac, linux] id: tools // base packages\n\n") {
+		t.Errorf("comments and blank lines not preserved:\n%s", out)
+	}
+}
+
+func TestParseGroupBlock(t *testing.T) {
+	src := "group work on: [mac] after: base { // work laptop\ninstall slack\n    }\n"
+	f := Parse(src)
+	if len(f.Nodes) != 3 {
+		t.Fatalf("got %d nodes, want 3", len(f.Nodes))
+	}
+	g, ok := f.Nodes[0].(*Group)
+	if !ok {
+		t.Fatalf("node 0 is %T, want *Group", f.Nodes[0])
+	}
+	if g.Name != "work" || !g.Open || g.Comment != "// work laptop" {
+		t.Errorf("group = %+v", g)
+	}
+	if on := g.Attr("on"); on == nil || len(on.List) != 1 || on.List[0] != "mac" {
+		t.Errorf("on: = %+v", on)
+	}
+	if after := g.Attr("after"); after == nil || after.Value != "base" {
+		t.Errorf("after: = %+v, want base without the brace", after)
+	}
+	if _, ok := f.Nodes[2].(*GroupEnd); !ok {
+		t.Errorf("node 2 is %T, want *GroupEnd", f.Nodes[2])
+	}
+	if len(f.Rules()) != 1 {
+		t.Errorf("Rules() = %d, want the rule inside the group", len(f.Rules()))
+	}
+
+	want := "group work on: [mac] after: base { // work laptop\n  install slack\n}\n"
+	if out := string(Format(f)); out != want {
+		t.Errorf("Format() =\n%s\nwant\n%s", out, want)
+	}
+}
+
+func TestFormatRoundTripSetupBP(t *testing.T) {
+	_, filename, _, _ := runtime.Caller(0)
+	path := filepath.Join(filepath.Dir(filename), "..", "..", "setup.bp")
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := parser.Parse(string(data))
+	if err != nil {
+		t.Fatalf("parser.Parse(setup.bp): %v", err)
+	}
+	got, err := parser.Parse(string(Format(Parse(string(data)))))
+	if err != nil {
+		t.Fatalf("parser.Parse(Format(setup.bp)): %v", err)
+	}
+	if !reflect.DeepEqual(withoutSource(got), withoutSource(want)) {
+		t.Error("formatted setup.bp parses differently")
+	}
+}
+
+func TestParseFileIncludesTree(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("main.bp", "include tools.bp as tools\ninclude @github:user/shared prefer_ssh: true\ninclude missing.bp\n")
+	write("tools.bp", "install git id: git\ninclude main.bp\n")
+
+	f, err := ParseFile(filepath.Join(dir, "main.bp"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	includes := f.Includes()
+	if len(includes) != 3 {
+		t.Fatalf("expected 3 includes, got %d", len(includes))
+	}
+
+	tools := includes[0]
+	if tools.Namespace != "tools" || tools.File == nil || len(tools.File.Rules()) != 1 {
+		t.Fatalf("local include not resolved: %+v", tools)
+	}
+	if cyclic := tools.File.Includes()[0]; cyclic.File != nil {
+		t.Error("circular include must not be resolved")
+	}
+	if git := includes[1]; !git.IsGit() || !git.PreferSSH || git.File != nil {
+		t.Errorf("git include = %+v", git)
+	}
+	if missing := includes[2]; missing.File != nil || missing.Resolved != filepath.Join(dir, "missing.bp") {
+		t.Errorf("missing include = %+v", missing)
+	}
+	if got := includes[1].String(); got != "include @github:user/shared prefer_ssh: true" {
+		t.Errorf("Include.String() = %q", got)
+	}
+}
+
+func TestParseFileMissing(t *testing.T) {
+	if _, err := ParseFile(filepath.Join(t.TempDir(), "nope.bp")); err == nil {
+		t.Error("expected error for missing file")
+	}
+}
+
+func TestParsePin(t *testing.T) {
+	sum := strings.Repeat("ab", 32)
+	f := Parse("pin @github:acme/setup sha256: " + sum + " # trusted\ninclude @github:acme/setup\n")
+	pin, ok := f.Nodes[0].(*Pin)
+	if !ok {
+		t.Fatalf("node = %T, want *Pin", f.Nodes[0])
+	}
+	if pin.Source != "@github:acme/setup" || pin.Sum != sum || pin.Comment != "# trusted" {
+		t.Errorf("pin = %+v", pin)
+	}
+	if out := string(Format(f)); !strings.HasPrefix(out, "pin @github:acme/setup sha256: "+sum+" # trusted\n") {
+		t.Errorf("Format() = %q", out)
+	}
+}
+
+func TestParseDefaults(t *testing.T) {
+	src := "defaults {on: [mac, linux];group: base} # everything\ninstall git\n"
+	f := Parse(src)
+	d, ok := f.Nodes[0].(*Defaults)
+	if !ok {
+		t.Fatalf("node 0 is %T, want *Defaults", f.Nodes[0])
+	}
+	if !d.Braced || d.Comment != "# everything" {
+		t.Errorf("defaults = %+v", d)
+	}
+	if on := d.Attr("on"); on == nil || len(on.List) != 2 || on.Pos != (Pos{Line: 1, Column: 11}) {
+		t.Errorf("on: = %+v", on)
+	}
+	if group := d.Attr("group"); group == nil || group.Value != "base" {
+		t.Errorf("group: = %+v, want base without the semicolon or brace", group)
+	}
+	if len(f.Rules()) != 1 {
+		t.Errorf("Rules() = %d, want only install", len(f.Rules()))
+	}
+
+	want := "defaults { on: [mac, linux]; group: base } # everything\ninstall git\n"
+	if out := string(Format(f)); out != want {
+		t.Errorf("Format() =\n%s\nwant\n%s", out, want)
+	}
+}
+
+// withoutSource clears where each rule was written, which formatting may
+// change by joining or splitting lines.
+func withoutSource(rules []parser.Rule) []parser.Rule {
+	for i := range rules {
+		rules[i].SourceFile, rules[i].SourceLine = "", 0
+	}
+	return rules
+}
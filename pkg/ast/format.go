@@ -0,0 +1,121 @@
+package ast
+
+import (
+	"strings"
+)
+
+// Format renders a file back to .bp text, one node per line. Rules are
+// written in canonical form: the directive, its positional arguments, then
+// its attributes in source order. Rules that spanned several lines with
+// backslash continuations are written on one line. Lines inside a group
+// block are indented by two spaces per level.
+func Format(f *File) []byte {
+	var b strings.Builder
+	depth := 0
+	for _, n := range f.Nodes {
+		if _, ok := n.(*GroupEnd); ok && depth > 0 {
+			depth--
+		}
+		if _, ok := n.(*Blank); !ok {
+			b.WriteString(strings.Repeat("  ", depth))
+		}
+		switch n := n.(type) {
+		case *Rule:
+			b.WriteString(withComment(n.String(), n.Comment))
+		case *Include:
+			b.WriteString(withComment(n.String(), n.Comment))
+		case *Pin:
+			b.WriteString(withComment(n.String(), n.Comment))
+		case *Group:
+			b.WriteString(withComment(n.String(), n.Comment))
+			depth++
+		case *GroupEnd:
+			b.WriteString(withComment("}", n.Comment))
+		case *Defaults:
+			b.WriteString(withComment(n.String(), n.Comment))
+		case *Comment:
+			b.WriteString(n.Text)
+		}
+		b.WriteByte('\n')
+	}
+	return []byte(b.String())
+}
+
+// String renders the rule without its comment.
+func (r *Rule) String() string {
+	parts := []string{r.Directive}
+	for _, a := range r.Args {
+		parts = append(parts, a.Value)
+	}
+	for _, a := range r.Attrs {
+		parts = append(parts, a.String())
+	}
+	return strings.Join(parts, " ")
+}
+
+// String renders the attribute as "key: value".
+func (a *Attr) String() string {
+	key := a.Key + ":"
+	switch {
+	case a.Bracket:
+		return key + " [" + strings.Join(a.List, ", ") + "]"
+	case a.Quoted:
+		return key + ` "` + a.Value + `"`
+	case a.Ignored || a.Value == "":
+		return key
+	}
+	return key + " " + a.Value
+}
+
+// String renders the opening line of the group block without its comment.
+func (g *Group) String() string {
+	parts := []string{"group"}
+	if g.Name != "" {
+		parts = append(parts, g.Name)
+	}
+	for _, a := range g.Attrs {
+		parts = append(parts, a.String())
+	}
+	return strings.Join(append(parts, "{"), " ")
+}
+
+// String renders the defaults line without its comment, its attributes
+// separated by semicolons.
+func (d *Defaults) String() string {
+	if len(d.Attrs) == 0 {
+		return "defaults { }"
+	}
+	attrs := make([]string, len(d.Attrs))
+	for i, a := range d.Attrs {
+		attrs[i] = a.String()
+	}
+	return "defaults { " + strings.Join(attrs, "; ") + " }"
+}
+
+// String renders the include statement without its comment.
+func (i *Include) String() string {
+	s := "include " + i.Path
+	if i.Namespace != "" {
+		s += " as " + i.Namespace
+	}
+	if i.PreferSSH {
+		s += " prefer_ssh: true"
+	}
+	return s
+}
+
+// String renders the pin statement without its comment.
+func (p *Pin) String() string {
+	parts := []string{"pin"}
+	if p.Source != "" {
+		parts = append(parts, p.Source)
+	}
+	return strings.Join(append(parts, "sha256:", p.Sum), " ")
+}
+
+func withComment(s, comment string) string {
+	if comment == "" {
+		return s
+	}
+	return s + " " + comment
+}
@@ -0,0 +1,92 @@
+// Package blueprinttest lets blueprint authors write regression tests for
+// their own blueprints. Record lists the commands a blueprint would run on
+// each OS, with variables resolved, without running anything; AssertGolden
+// compares that list with a golden file kept next to the blueprint:
+//
+//	func TestSetup(t *testing.T) {
+//		blueprinttest.AssertGolden(t, "setup.bp", "testdata/setup.golden")
+//	}
+//
+// Run the test with BLUEPRINT_UPDATE_GOLDEN=1 to write or update the golden
+// file. It holds the same text as `blueprint record setup.bp`.
+package blueprinttest
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/elpic/blueprint/internal/engine"
+)
+
+// UpdateEnv is the environment variable that makes AssertGolden rewrite
+// golden files instead of comparing with them.
+const UpdateEnv = "BLUEPRINT_UPDATE_GOLDEN"
+
+// Record returns the commands the blueprint at path would run on each of
+// osNames (linux and mac when none are given), as kept in golden files.
+// vars sets variables as --var does; it may be nil.
+func Record(path string, vars map[string]string, osNames ...string) (string, error) {
+	return engine.RecordBlueprint(path, osNames, vars)
+}
+
+// AssertGolden fails t when the recording of blueprint differs from the
+// golden file, reporting the first lines that differ. With
+// BLUEPRINT_UPDATE_GOLDEN=1 it writes the recording to golden instead.
+func AssertGolden(t testing.TB, blueprint, golden string, osNames ...string) {
+	t.Helper()
+	got, err := Record(blueprint, nil, osNames...)
+	if err != nil {
+		t.Fatalf("recording %s: %v", blueprint, err)
+	}
+
+	compareGolden(t, blueprint, got, golden)
+}
+
+// AssertGoldenText fails t when got differs from the golden file, reporting
+// the first line that differs. With BLUEPRINT_UPDATE_GOLDEN=1 it writes got
+// to golden instead. It is AssertGolden for any text, such as the output of
+// a command.
+func AssertGoldenText(t testing.TB, got, golden string) {
+	t.Helper()
+	compareGolden(t, "output", got, golden)
+}
+
+// compareGolden compares got, named name in failures, with golden, or
+// writes it there when BLUEPRINT_UPDATE_GOLDEN is set.
+func compareGolden(t testing.TB, name, got, golden string) {
+	t.Helper()
+	if os.Getenv(UpdateEnv) != "" {
+		if err := os.MkdirAll(filepath.Dir(golden), 0o750); err != nil {
+			t.Fatalf("creating %s: %v", filepath.Dir(golden), err)
+		}
+		if err := os.WriteFile(golden, []byte(got), 0o600); err != nil {
+			t.Fatalf("writing %s: %v", golden, err)
+		}
+		return
+	}
+
+	want, err := os.ReadFile(golden) // #nosec G304 -- golden file named by the test
+	if err != nil {
+		t.Fatalf("reading %s: %v (run with %s=1 to create it)", golden, err, UpdateEnv)
+	}
+	if string(want) == got {
+		return
+	}
+	wantLines, gotLines := strings.Split(string(want), "\n"), strings.Split(got, "\n")
+	for i := 0; i < len(wantLines) || i < len(gotLines); i++ {
+		var w, g string
+		if i < len(wantLines) {
+			w = wantLines[i]
+		}
+		if i < len(gotLines) {
+			g = gotLines[i]
+		}
+		if w != g {
+			t.Errorf("%s does not match %s at line %d:\n  want: %s\n  got:  %s\n(run with %s=1 to update it)",
+				name, golden, i+1, w, g, UpdateEnv)
+			return
+		}
+	}
+}
@@ -0,0 +1,23 @@
+package blueprinttest
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestAssertGolden(t *testing.T) {
+	AssertGolden(t, "testdata/setup.bp", "testdata/setup.golden")
+}
+
+func TestRecordOneOS(t *testing.T) {
+	got, err := Record("testdata/setup.bp", map[string]string{"PROJECTS": "/srv/src"}, "mac")
+	if err != nil {
+		t.Fatalf("Record() error: %v", err)
+	}
+	if strings.Contains(got, "## linux") || strings.Contains(got, "linux only") {
+		t.Errorf("Record(mac) included linux rules:\n%s", got)
+	}
+	if !strings.Contains(got, "/srv/src") {
+		t.Errorf("Record() did not resolve the variable:\n%s", got)
+	}
+}